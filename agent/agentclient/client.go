@@ -26,13 +26,15 @@ import (
 
 // Client errors.
 var (
-	ErrTagNotFound = errors.New("tag not found")
+	ErrTagNotFound     = errors.New("tag not found")
+	ErrBlobNotInFlight = errors.New("blob is not being downloaded")
 )
 
 // Client defines a client for accessing the agent server.
 type Client interface {
 	GetTag(tag string) (core.Digest, error)
 	Download(namespace string, d core.Digest) (io.ReadCloser, error)
+	PrioritizeRange(d core.Digest, offset, length int64) error
 }
 
 // HTTPClient provides a wrapper for HTTP operations on an agent.
@@ -79,3 +81,20 @@ func (c *HTTPClient) Download(namespace string, d core.Digest) (io.ReadCloser, e
 	}
 	return resp.Body, nil
 }
+
+// PrioritizeRange hints that the length bytes of d starting at offset are
+// needed first by an in-progress download of d. Returns ErrBlobNotInFlight if
+// d is not being downloaded.
+func (c *HTTPClient) PrioritizeRange(d core.Digest, offset, length int64) error {
+	_, err := httputil.Post(
+		fmt.Sprintf(
+			"http://%s/blobs/%s/priority?offset=%d&length=%d",
+			c.addr, d, offset, length))
+	if err != nil {
+		if httputil.IsNotFound(err) {
+			return ErrBlobNotInFlight
+		}
+		return err
+	}
+	return nil
+}
@@ -16,11 +16,13 @@ package agentserver
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	_ "net/http/pprof" // Registers /debug/pprof endpoints in http.DefaultServeMux.
 	"os"
+	"strconv"
 	"strings"
 
 	"github.com/uber/kraken/build-index/tagclient"
@@ -28,6 +30,7 @@ import (
 	"github.com/uber/kraken/lib/dockerdaemon"
 	"github.com/uber/kraken/lib/middleware"
 	"github.com/uber/kraken/lib/store"
+	"github.com/uber/kraken/lib/torrent/networkevent"
 	"github.com/uber/kraken/lib/torrent/scheduler"
 	"github.com/uber/kraken/utils/handler"
 	"github.com/uber/kraken/utils/httputil"
@@ -47,6 +50,16 @@ type Server struct {
 	sched     scheduler.ReloadableScheduler
 	tags      tagclient.Client
 	dockerCli dockerdaemon.DockerClient
+	tracer    networkevent.PieceTracer
+}
+
+// Option allows setting optional Server parameters.
+type Option func(*Server)
+
+// WithPieceTracer configures the Server to serve piece traces of downloads
+// from t.
+func WithPieceTracer(t networkevent.PieceTracer) Option {
+	return func(s *Server) { s.tracer = t }
 }
 
 // New creates a new Server.
@@ -56,13 +69,25 @@ func New(
 	cads *store.CADownloadStore,
 	sched scheduler.ReloadableScheduler,
 	tags tagclient.Client,
-	dockerCli dockerdaemon.DockerClient) *Server {
+	dockerCli dockerdaemon.DockerClient,
+	opts ...Option) *Server {
 
 	stats = stats.Tagged(map[string]string{
 		"module": "agentserver",
 	})
 
-	return &Server{config, stats, cads, sched, tags, dockerCli}
+	s := &Server{
+		config:    config,
+		stats:     stats,
+		cads:      cads,
+		sched:     sched,
+		tags:      tags,
+		dockerCli: dockerCli,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
 }
 
 // Handler returns the HTTP handler.
@@ -80,6 +105,9 @@ func (s *Server) Handler() http.Handler {
 
 	r.Delete("/blobs/{digest}", handler.Wrap(s.deleteBlobHandler))
 
+	// Hints the byte range of an in-progress download which is needed first.
+	r.Post("/blobs/{digest}/priority", handler.Wrap(s.prioritizeRangeHandler))
+
 	// Preheat/preload endpoints.
 	r.Get("/preload/tags/{tag}", handler.Wrap(s.preloadTagHandler))
 
@@ -88,6 +116,13 @@ func (s *Server) Handler() http.Handler {
 
 	r.Get("/x/blacklist", handler.Wrap(s.getBlacklistHandler))
 
+	// Returns the piece flow trace of the most recent download of a blob.
+	r.Get("/x/traces/{digest}", handler.Wrap(s.getPieceTraceHandler))
+
+	// Stops accepting new downloads ahead of decommissioning the host. Must be
+	// polled until the returned status is safe.
+	r.Post("/x/drain", handler.Wrap(s.drainHandler))
+
 	// Serves /debug/pprof endpoints.
 	r.Mount("/", http.DefaultServeMux)
 
@@ -128,6 +163,9 @@ func (s *Server) downloadBlobHandler(w http.ResponseWriter, r *http.Request) err
 				if err == scheduler.ErrTorrentNotFound {
 					return handler.ErrorStatus(http.StatusNotFound)
 				}
+				if err == scheduler.ErrSchedulerDraining {
+					return handler.ErrorStatus(http.StatusServiceUnavailable)
+				}
 				return handler.Errorf("download torrent: %s", err)
 			}
 			f, err = s.cads.Cache().GetFileReader(d.Hex())
@@ -155,6 +193,34 @@ func (s *Server) deleteBlobHandler(w http.ResponseWriter, r *http.Request) error
 	return nil
 }
 
+// prioritizeRangeHandler hints that the bytes of a blob within the range given
+// by offset and length query args are needed first, such that the pieces
+// covering the range are downloaded ahead of all others.
+func (s *Server) prioritizeRangeHandler(w http.ResponseWriter, r *http.Request) error {
+	d, err := parseDigest(r)
+	if err != nil {
+		return err
+	}
+	offset, err := strconv.ParseInt(httputil.GetQueryArg(r, "offset", "0"), 10, 64)
+	if err != nil || offset < 0 {
+		return handler.Errorf("invalid offset").Status(http.StatusBadRequest)
+	}
+	length, err := strconv.ParseInt(httputil.GetQueryArg(r, "length", ""), 10, 64)
+	if err != nil || length <= 0 {
+		return handler.Errorf("invalid length").Status(http.StatusBadRequest)
+	}
+	if err := s.sched.PrioritizeRange(d, offset, length); err != nil {
+		if err == scheduler.ErrTorrentNotFound {
+			return handler.ErrorStatus(http.StatusNotFound)
+		}
+		if errors.Is(err, scheduler.ErrInvalidRange) {
+			return handler.Errorf("%s", err).Status(http.StatusBadRequest)
+		}
+		return handler.Errorf("prioritize range: %s", err)
+	}
+	return nil
+}
+
 // preloadTagHandler triggers docker daemon to download specified docker image.
 func (s *Server) preloadTagHandler(w http.ResponseWriter, r *http.Request) error {
 	tag, err := httputil.ParseParam(r, "tag")
@@ -205,6 +271,39 @@ func (s *Server) getBlacklistHandler(w http.ResponseWriter, r *http.Request) err
 	return nil
 }
 
+// getPieceTraceHandler returns the piece trace events of the most recent
+// download of a blob.
+func (s *Server) getPieceTraceHandler(w http.ResponseWriter, r *http.Request) error {
+	d, err := parseDigest(r)
+	if err != nil {
+		return err
+	}
+	if s.tracer == nil {
+		return handler.Errorf("piece tracing is disabled").Status(http.StatusNotFound)
+	}
+	events, ok := s.tracer.PieceTrace(d)
+	if !ok {
+		return handler.ErrorStatus(http.StatusNotFound)
+	}
+	if err := json.NewEncoder(w).Encode(events); err != nil {
+		return handler.Errorf("json encode: %s", err)
+	}
+	return nil
+}
+
+// drainHandler drains the scheduler and returns whether the agent is safe to
+// terminate.
+func (s *Server) drainHandler(w http.ResponseWriter, r *http.Request) error {
+	status, err := s.sched.Drain()
+	if err != nil {
+		return handler.Errorf("drain: %s", err)
+	}
+	if err := json.NewEncoder(w).Encode(&status); err != nil {
+		return handler.Errorf("json encode: %s", err)
+	}
+	return nil
+}
+
 func parseDigest(r *http.Request) (core.Digest, error) {
 	raw, err := httputil.ParseParam(r, "digest")
 	if err != nil {
@@ -20,6 +20,7 @@ import (
 	"errors"
 	"fmt"
 	"io/ioutil"
+	"net/http"
 	"net/url"
 	"testing"
 	"time"
@@ -28,6 +29,7 @@ import (
 	"github.com/uber/kraken/build-index/tagclient"
 	"github.com/uber/kraken/core"
 	"github.com/uber/kraken/lib/store"
+	"github.com/uber/kraken/lib/torrent/networkevent"
 	"github.com/uber/kraken/lib/torrent/scheduler"
 	"github.com/uber/kraken/lib/torrent/scheduler/connstate"
 	mocktagclient "github.com/uber/kraken/mocks/build-index/tagclient"
@@ -67,8 +69,8 @@ func newServerMocks(t *testing.T) (*serverMocks, func()) {
 	return &serverMocks{cads, sched, tags, dockerCli, &cleanup}, cleanup.Run
 }
 
-func (m *serverMocks) startServer() string {
-	s := New(Config{}, tally.NoopScope, m.cads, m.sched, m.tags, m.dockerCli)
+func (m *serverMocks) startServer(opts ...Option) string {
+	s := New(Config{}, tally.NoopScope, m.cads, m.sched, m.tags, m.dockerCli, opts...)
 	addr, stop := testutil.StartServer(s.Handler())
 	m.cleanup.Add(stop)
 	return addr
@@ -245,6 +247,47 @@ func TestGetBlacklistHandler(t *testing.T) {
 	require.Equal(blacklist, result)
 }
 
+func TestDrainHandler(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t)
+	defer cleanup()
+
+	status := scheduler.DrainStatus{
+		InflightDownloads: 1,
+		SoleSeeds:         []core.Digest{core.DigestFixture()},
+	}
+	mocks.sched.EXPECT().Drain().Return(status, nil)
+
+	addr := mocks.startServer()
+
+	resp, err := httputil.Post(fmt.Sprintf("http://%s/x/drain", addr))
+	require.NoError(err)
+
+	var result scheduler.DrainStatus
+	require.NoError(json.NewDecoder(resp.Body).Decode(&result))
+	require.Equal(status, result)
+}
+
+func TestDownloadDraining(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t)
+	defer cleanup()
+
+	namespace := core.TagFixture()
+	blob := core.NewBlobFixture()
+
+	mocks.sched.EXPECT().Download(namespace, blob.Digest).Return(scheduler.ErrSchedulerDraining)
+
+	addr := mocks.startServer()
+	c := agentclient.New(addr)
+
+	_, err := c.Download(namespace, blob.Digest)
+	require.Error(err)
+	require.True(httputil.IsStatus(err, http.StatusServiceUnavailable))
+}
+
 func TestDeleteBlobHandler(t *testing.T) {
 	require := require.New(t)
 
@@ -276,3 +319,78 @@ func TestPreloadHandler(t *testing.T) {
 	_, err := httputil.Get(fmt.Sprintf("http://%s/preload/tags/%s", addr, tag))
 	require.NoError(err)
 }
+
+func TestPrioritizeRangeHandler(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t)
+	defer cleanup()
+
+	d := core.DigestFixture()
+
+	addr := mocks.startServer()
+	c := agentclient.New(addr)
+
+	mocks.sched.EXPECT().PrioritizeRange(d, int64(128), int64(64)).Return(nil)
+	require.NoError(c.PrioritizeRange(d, 128, 64))
+
+	mocks.sched.EXPECT().PrioritizeRange(d, int64(0), int64(64)).Return(scheduler.ErrTorrentNotFound)
+	require.Equal(agentclient.ErrBlobNotInFlight, c.PrioritizeRange(d, 0, 64))
+
+	err := c.PrioritizeRange(d, 0, 0)
+	require.True(httputil.IsStatus(err, http.StatusBadRequest))
+
+	// Ranges beyond the end of the blob are only detected by the scheduler.
+	mocks.sched.EXPECT().PrioritizeRange(d, int64(1024), int64(64)).Return(
+		fmt.Errorf("%w [1024, 1088) for blob of length 1024", scheduler.ErrInvalidRange))
+	err = c.PrioritizeRange(d, 1024, 64)
+	require.True(httputil.IsStatus(err, http.StatusBadRequest))
+}
+
+func TestGetPieceTraceHandler(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t)
+	defer cleanup()
+
+	producer, err := networkevent.NewProducer(networkevent.Config{
+		PieceTrace: networkevent.PieceTraceConfig{Enabled: true},
+	})
+	require.NoError(err)
+	tracer := producer.(networkevent.PieceTracer)
+
+	d := core.DigestFixture()
+	e := networkevent.VerifyPieceEvent(
+		core.InfoHashFixture(), core.PeerIDFixture(), core.PeerIDFixture(), 3)
+	e.TraceID = "some-trace"
+	e.Digest = d.String()
+	producer.Produce(e)
+
+	addr := mocks.startServer(WithPieceTracer(tracer))
+
+	resp, err := httputil.Get(fmt.Sprintf("http://%s/x/traces/%s", addr, d))
+	require.NoError(err)
+	defer resp.Body.Close()
+
+	var events []*networkevent.Event
+	require.NoError(json.NewDecoder(resp.Body).Decode(&events))
+	require.Len(events, 1)
+	require.Equal(networkevent.VerifyPiece, events[0].Name)
+	require.Equal("some-trace", events[0].TraceID)
+	require.Equal(3, events[0].Piece)
+
+	_, err = httputil.Get(fmt.Sprintf("http://%s/x/traces/%s", addr, core.DigestFixture()))
+	require.True(httputil.IsNotFound(err))
+}
+
+func TestGetPieceTraceHandlerDisabled(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t)
+	defer cleanup()
+
+	addr := mocks.startServer()
+
+	_, err := httputil.Get(fmt.Sprintf("http://%s/x/traces/%s", addr, core.DigestFixture()))
+	require.True(httputil.IsNotFound(err))
+}
@@ -24,6 +24,7 @@ import (
 	"github.com/uber/kraken/core"
 	"github.com/uber/kraken/lib/dockerdaemon"
 	"github.com/uber/kraken/lib/dockerregistry/transfer"
+	"github.com/uber/kraken/lib/faults"
 	"github.com/uber/kraken/lib/store"
 	"github.com/uber/kraken/lib/torrent/networkevent"
 	"github.com/uber/kraken/lib/torrent/scheduler"
@@ -182,8 +183,14 @@ func Run(flags *Flags, opts ...Option) {
 		log.Fatalf("Error building client tls config: %s", err)
 	}
 
+	faultInjector, err := faults.New(config.FaultInjection, stats)
+	if err != nil {
+		log.Fatalf("Error creating fault injector: %s", err)
+	}
+
 	sched, err := scheduler.NewAgentScheduler(
-		config.Scheduler, stats, pctx, cads, netevents, trackers, tls)
+		config.Scheduler, stats, pctx, cads, netevents, trackers, tls,
+		scheduler.WithFaultInjector(faultInjector))
 	if err != nil {
 		log.Fatalf("Error creating scheduler: %s", err)
 	}
@@ -193,7 +200,8 @@ func Run(flags *Flags, opts ...Option) {
 		log.Fatalf("Error building build-index upstream: %s", err)
 	}
 
-	tagClient := tagclient.NewClusterClient(buildIndexes, tls)
+	tagClient := tagclient.NewClusterClient(
+		buildIndexes, tls, tagclient.WithBudget(config.BuildIndexBudget))
 
 	transferer := transfer.NewReadOnlyTransferer(stats, cads, tagClient, sched)
 
@@ -208,12 +216,17 @@ func Run(flags *Flags, opts ...Option) {
 		log.Fatalf("failed to init docker client for preload: %s", err)
 	}
 
+	var serverOpts []agentserver.Option
+	if tracer, ok := netevents.(networkevent.PieceTracer); ok {
+		serverOpts = append(serverOpts, agentserver.WithPieceTracer(tracer))
+	}
+
 	agentServer := agentserver.New(
-		config.AgentServer, stats, cads, sched, tagClient, dockerCli)
+		config.AgentServer, stats, cads, sched, tagClient, dockerCli, serverOpts...)
 	addr := fmt.Sprintf(":%d", flags.AgentServerPort)
 	log.Infof("Starting agent server on %s", addr)
 	go func() {
-		log.Fatal(http.ListenAndServe(addr, agentServer.Handler()))
+		log.Fatal(http.ListenAndServe(addr, faultInjector.Mount(agentServer.Handler())))
 	}()
 
 	log.Info("Starting registry...")
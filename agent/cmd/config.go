@@ -15,9 +15,11 @@ package cmd
 
 import (
 	"github.com/uber/kraken/agent/agentserver"
+	"github.com/uber/kraken/build-index/tagclient"
 	"github.com/uber/kraken/core"
 	"github.com/uber/kraken/lib/dockerdaemon"
 	"github.com/uber/kraken/lib/dockerregistry"
+	"github.com/uber/kraken/lib/faults"
 	"github.com/uber/kraken/lib/store"
 	"github.com/uber/kraken/lib/torrent/networkevent"
 	"github.com/uber/kraken/lib/torrent/scheduler"
@@ -46,4 +48,12 @@ type Config struct {
 	TLS             httputil.TLSConfig             `yaml:"tls"`
 	AllowedCidrs    []string                       `yaml:"allowed_cidrs"`
 	DockerDaemon    dockerdaemon.Config            `yaml:"docker_daemon"`
+
+	// BuildIndexBudget bounds the total time of build-index requests across
+	// retries against different build-indexes.
+	BuildIndexBudget tagclient.BudgetConfig `yaml:"build_index_budget"`
+
+	// FaultInjection injects faults into peer connections, for chaos testing
+	// only.
+	FaultInjection faults.Config `yaml:"fault_injection"`
 }
@@ -14,18 +14,27 @@
 package cmd
 
 import (
+	"context"
 	"flag"
+	"os"
+	"os/signal"
+	"syscall"
 
+	"github.com/uber/kraken/build-index/tagaudit"
 	"github.com/uber/kraken/build-index/tagclient"
+	"github.com/uber/kraken/build-index/tagrefs"
 	"github.com/uber/kraken/build-index/tagserver"
 	"github.com/uber/kraken/build-index/tagstore"
 	"github.com/uber/kraken/build-index/tagtype"
 	"github.com/uber/kraken/lib/backend"
+	"github.com/uber/kraken/lib/faults"
 	"github.com/uber/kraken/lib/healthcheck"
 	"github.com/uber/kraken/lib/hostlist"
 	"github.com/uber/kraken/lib/persistedretry"
+	"github.com/uber/kraken/lib/persistedretry/callback"
 	"github.com/uber/kraken/lib/persistedretry/tagreplication"
 	"github.com/uber/kraken/lib/persistedretry/writeback"
+	"github.com/uber/kraken/lib/slo"
 	"github.com/uber/kraken/lib/store"
 	"github.com/uber/kraken/lib/upstream"
 	"github.com/uber/kraken/localdb"
@@ -33,8 +42,11 @@ import (
 	"github.com/uber/kraken/nginx"
 	"github.com/uber/kraken/origin/blobclient"
 	"github.com/uber/kraken/utils/configutil"
+	"github.com/uber/kraken/utils/httputil"
 	"github.com/uber/kraken/utils/log"
+	"github.com/uber/kraken/utils/syncutil"
 
+	"github.com/andres-erbsen/clock"
 	"github.com/uber-go/tally"
 	"go.uber.org/zap"
 )
@@ -136,7 +148,15 @@ func Run(flags *Flags, opts ...Option) {
 		log.Fatalf("Error creating simple store: %s", err)
 	}
 
-	backends, err := backend.NewManager(config.Backends, config.Auth)
+	faultInjector, err := faults.New(config.FaultInjection, stats)
+	if err != nil {
+		log.Fatalf("Error creating fault injector: %s", err)
+	}
+
+	backends, err := backend.NewManager(
+		config.Backends, config.Auth, stats, backend.WithWriteFairness(config.WriteFairness),
+		backend.WithDualWrite(config.DualWrite), backend.WithFaultInjector(faultInjector),
+		backend.WithHistograms(config.Metrics.Histograms))
 	if err != nil {
 		log.Fatalf("Error creating backend manager: %s", err)
 	}
@@ -152,7 +172,11 @@ func Run(flags *Flags, opts ...Option) {
 	}
 
 	r := blobclient.NewClientResolver(blobclient.NewProvider(blobclient.WithTLS(tls)), origins)
-	originClient := blobclient.NewClusterClient(r)
+	originClient := blobclient.NewClusterClient(
+		r,
+		blobclient.WithHealthTracking(config.OriginHealth, clock.New()),
+		blobclient.WithFanoutPool(syncutil.NewFanoutPool(config.Fanout, stats)),
+		blobclient.WithOriginWeights(config.OriginWeights))
 
 	localOriginDNS, err := config.Origin.StableAddr()
 	if err != nil {
@@ -177,20 +201,100 @@ func Run(flags *Flags, opts ...Option) {
 	if err != nil {
 		log.Fatalf("Error building remotes from configuration: %s", err)
 	}
+	mirrors, err := config.Mirrors.Build()
+	if err != nil {
+		log.Fatalf("Error building mirrors from configuration: %s", err)
+	}
+
+	var remoteTagClientOpts []tagclient.Option
+	if config.OriginSelection.Enabled {
+		remoteTagClientOpts = append(
+			remoteTagClientOpts, tagclient.WithOriginSelection(config.OriginSelection))
+	}
+	if config.RemoteResponseCache.Enabled {
+		remoteTagClientOpts = append(remoteTagClientOpts, tagclient.WithResponseCache(
+			httputil.NewResponseCache(config.RemoteResponseCache, clock.New())))
+	}
+
+	remoteTagClients := tagclient.NewProvider(tls, remoteTagClientOpts...)
+	if config.RemoteConnectionPool.Enabled {
+		remoteTagClients = tagclient.NewPooledProvider(
+			config.RemoteConnectionPool, tls, remoteTagClientOpts...)
+	}
+	neighborTagClients := tagclient.NewProvider(tls)
+	if config.BuildIndexProbe.Enabled {
+		remoteTagClients = tagclient.NewProbingProvider(
+			config.BuildIndexProbe, clock.New(), remoteTagClients, healthcheck.Default(tls))
+		neighborTagClients = tagclient.NewProbingProvider(
+			config.BuildIndexProbe, clock.New(), neighborTagClients, healthcheck.Default(tls))
+	}
 
+	namespaceTags, err := config.Metrics.Namespaces.Build()
+	if err != nil {
+		log.Fatalf("Error building metric namespaces: %s", err)
+	}
+
+	tagReplicationOpts := []tagreplication.ExecutorOption{
+		tagreplication.WithRemoteDigestAlgorithms(config.RemoteDigestAlgorithms),
+		tagreplication.WithFaultInjector(faultInjector),
+		tagreplication.WithHistograms(config.Metrics.Histograms),
+		tagreplication.WithNamespaceTags(namespaceTags),
+	}
+	if !config.DisableOrderedTagReplication {
+		tagReplicationOpts = append(tagReplicationOpts, tagreplication.WithOrderedCommit(
+			blobclient.NewProvider(blobclient.WithTLS(tls))))
+	} else if config.VerifyReplicatedDependencies {
+		tagReplicationOpts = append(tagReplicationOpts, tagreplication.WithDependencyVerification(
+			blobclient.NewProvider(blobclient.WithTLS(tls))))
+	}
+	if len(config.Mirrors) > 0 {
+		mirrorBackends, err := config.Mirrors.Backends(config.Auth, stats)
+		if err != nil {
+			log.Fatalf("Error creating mirror backends: %s", err)
+		}
+		tagReplicationOpts = append(tagReplicationOpts, tagreplication.WithMirrors(mirrorBackends))
+	}
+	if len(config.MirrorSource) > 0 {
+		mirrorSource, err := backend.NewManager(config.MirrorSource, config.Auth, stats)
+		if err != nil {
+			log.Fatalf("Error creating mirror source backends: %s", err)
+		}
+		tagReplicationOpts = append(tagReplicationOpts, tagreplication.WithMirrorSource(mirrorSource))
+	}
 	tagReplicationExecutor := tagreplication.NewExecutor(
 		stats,
 		originClient,
-		tagclient.NewProvider(tls))
-	tagReplicationStore, err := tagreplication.NewStore(localDB, remotes)
+		remoteTagClients,
+		tagReplicationOpts...)
+	// Tasks of both remotes and mirrors are persisted.
+	tagReplicationStore, err := tagreplication.NewStore(
+		localDB, append(remotes, mirrors...), tagreplication.WithCapacity(config.TagReplicationCapacity, stats))
 	if err != nil {
 		log.Fatalf("Error creating tag replication store: %s", err)
 	}
+	callbackManager, err := persistedretry.NewManager(
+		config.ReplicationCallback.Retry,
+		stats,
+		callback.NewStore(localDB),
+		callback.NewExecutor(config.ReplicationCallback, stats))
+	if err != nil {
+		log.Fatalf("Error creating replication callback manager: %s", err)
+	}
+	pausedRemotes, err := tagreplication.NewPausedRemotes(localDB)
+	if err != nil {
+		log.Fatalf("Error loading paused remotes: %s", err)
+	}
+	namespaceLimiter := tagreplication.NewNamespaceLimiter(config.TagReplicationConcurrency, stats)
 	tagReplicationManager, err := persistedretry.NewManager(
 		config.TagReplication,
 		stats,
 		tagReplicationStore,
-		tagReplicationExecutor)
+		tagReplicationExecutor,
+		persistedretry.WithHooks(tagreplication.CallbackHooks(callbackManager, config.ReplicationCallback)),
+		persistedretry.WithHooks(tagreplication.ReplicaHooks(tagReplicationStore)),
+		persistedretry.WithPauser(pausedRemotes),
+		persistedretry.WithPauser(tagreplication.NewOrderGate(tagReplicationStore)),
+		persistedretry.WithLimiter(namespaceLimiter))
 	if err != nil {
 		log.Fatalf("Error creating tag replication manager: %s", err)
 	}
@@ -204,14 +308,30 @@ func Run(flags *Flags, opts ...Option) {
 		log.Fatalf("Error creating write-back manager: %s", err)
 	}
 
-	tagStore := tagstore.New(config.TagStore, stats, ss, backends, writeBackManager)
+	tagStore := tagstore.New(
+		config.TagStore, stats, ss, backends, writeBackManager, tagstore.WithBatchJournal(localDB))
+
+	var refs *tagrefs.Store
+	if config.EnableRefCounts {
+		refs = tagrefs.NewStore(localDB)
+	}
 
 	depResolver, err := tagtype.NewMap(config.TagTypes, originClient)
 	if err != nil {
 		log.Fatalf("Error creating tag type manager: %s", err)
 	}
 
-	server := tagserver.New(
+	auditLog, err := tagaudit.New(config.TagAudit, stats, backends)
+	if err != nil {
+		log.Fatalf("Error creating tag audit log: %s", err)
+	}
+
+	slos := slo.NewRegistry(stats)
+	slos.Register(tagreplication.Indicators(
+		config.ReplicationSLO, tagReplicationStore, clock.New())...)
+	go tagreplication.EmitIndicators(config.ReplicationSLO, slos, clock.New())
+
+	server, err := tagserver.New(
 		config.TagServer,
 		stats,
 		backends,
@@ -221,18 +341,62 @@ func Run(flags *Flags, opts ...Option) {
 		tagStore,
 		remotes,
 		tagReplicationManager,
-		tagclient.NewProvider(tls),
-		depResolver)
+		neighborTagClients,
+		depResolver,
+		tagserver.WithFaultInjector(faultInjector),
+		tagserver.WithMirrors(mirrors),
+		tagserver.WithAuditLog(auditLog),
+		tagserver.WithReplicaStore(tagReplicationStore),
+		tagserver.WithPausedRemotes(pausedRemotes),
+		tagserver.WithNamespaceLimiter(namespaceLimiter),
+		tagserver.WithSLOs(slos),
+		tagserver.WithRefCounts(refs),
+		tagserver.WithHistograms(config.Metrics.Histograms))
+	if err != nil {
+		log.Fatalf("Error creating tag server: %s", err)
+	}
+
+	// On shutdown, nginx is stopped before the tag server, such that requests
+	// proxied by nginx complete. The managers are closed once no more tasks are
+	// added, which gives them a chance to drain pending tasks. Tasks which are
+	// not drained remain persisted in the local db.
+	shutdown, stop := context.WithCancel(context.Background())
+	serverShutdown, stopServer := context.WithCancel(context.Background())
+	serverDone := make(chan struct{})
+	go func() {
+		if err := server.ListenAndServeContext(serverShutdown); err != nil {
+			log.Fatal(err)
+		}
+		close(serverDone)
+	}()
+
 	go func() {
-		log.Fatal(server.ListenAndServe())
+		sigs := make(chan os.Signal, 1)
+		signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+		sig := <-sigs
+		log.Infof("Received %s, shutting down...", sig)
+		stop()
 	}()
 
 	log.Info("Starting nginx...")
-	log.Fatal(nginx.Run(
+	if err := nginx.Run(
 		config.Nginx,
 		map[string]interface{}{
 			"port":   flags.Port,
 			"server": nginx.GetServer(config.TagServer.Listener.Net, config.TagServer.Listener.Addr),
 		},
-		nginx.WithTLS(config.TLS)))
+		nginx.WithTLS(config.TLS),
+		nginx.WithContext(shutdown)); err != nil {
+		log.Fatalf("Error running nginx: %s", err)
+	}
+	if shutdown.Err() == nil {
+		log.Fatal("Nginx exited unexpectedly")
+	}
+	stopServer()
+	<-serverDone
+	tagStore.Close()
+	tagReplicationManager.Close()
+	callbackManager.Close()
+	writeBackManager.Close()
+	log.Info("Shut down")
 }
@@ -14,18 +14,24 @@
 package cmd
 
 import (
+	"github.com/uber/kraken/build-index/tagaudit"
+	"github.com/uber/kraken/build-index/tagclient"
 	"github.com/uber/kraken/build-index/tagserver"
 	"github.com/uber/kraken/build-index/tagstore"
 	"github.com/uber/kraken/build-index/tagtype"
 	"github.com/uber/kraken/lib/backend"
+	"github.com/uber/kraken/lib/faults"
 	"github.com/uber/kraken/lib/persistedretry"
+	"github.com/uber/kraken/lib/persistedretry/callback"
 	"github.com/uber/kraken/lib/persistedretry/tagreplication"
 	"github.com/uber/kraken/lib/store"
 	"github.com/uber/kraken/lib/upstream"
 	"github.com/uber/kraken/localdb"
 	"github.com/uber/kraken/metrics"
 	"github.com/uber/kraken/nginx"
+	"github.com/uber/kraken/origin/blobclient"
 	"github.com/uber/kraken/utils/httputil"
+	"github.com/uber/kraken/utils/syncutil"
 
 	"go.uber.org/zap"
 )
@@ -36,9 +42,13 @@ type Config struct {
 	Metrics        metrics.Config               `yaml:"metrics"`
 	Backends       []backend.Config             `yaml:"backends"`
 	Auth           backend.AuthConfig           `yaml:"auth"`
+	WriteFairness  backend.WriteFairnessConfig  `yaml:"backend_write_fairness"`
+	DualWrite      backend.DualWriteConfig      `yaml:"backend_dual_write"`
 	TagServer      tagserver.Config             `yaml:"tagserver"`
 	Remotes        tagreplication.RemotesConfig `yaml:"remotes"`
+	Mirrors        tagreplication.MirrorsConfig `yaml:"mirrors"`
 	TagReplication persistedretry.Config        `yaml:"tag_replication"`
+	ReplicationSLO tagreplication.SLOConfig     `yaml:"replication_slo"`
 	TagTypes       []tagtype.Config             `yaml:"tag_types"`
 	Origin         upstream.ActiveConfig        `yaml:"origin"`
 	LocalDB        localdb.Config               `yaml:"localdb"`
@@ -48,4 +58,70 @@ type Config struct {
 	WriteBack      persistedretry.Config        `yaml:"writeback"`
 	Nginx          nginx.Config                 `yaml:"nginx"`
 	TLS            httputil.TLSConfig           `yaml:"tls"`
+	Fanout         syncutil.FanoutConfig        `yaml:"fanout"`
+
+	// TagReplicationCapacity bounds the replication tasks held in the local
+	// database.
+	TagReplicationCapacity tagreplication.CapacityConfig `yaml:"tag_replication_capacity"`
+
+	// TagReplicationConcurrency bounds the in-flight replications of each
+	// namespace.
+	TagReplicationConcurrency tagreplication.ConcurrencyConfig `yaml:"tag_replication_concurrency"`
+
+	// OriginHealth configures demotion of unhealthy origins of the local
+	// origin cluster.
+	OriginHealth blobclient.HealthConfig `yaml:"origin_health"`
+
+	// OriginWeights prefers origins of the local origin cluster with higher
+	// hash ring weights.
+	OriginWeights map[string]int `yaml:"origin_weights"`
+
+	// OriginSelection configures which origin cluster of remotes tags are
+	// replicated to, when remotes advertise multiple clusters.
+	OriginSelection tagclient.OriginSelectionConfig `yaml:"origin_selection"`
+
+	// RemoteConnectionPool configures reuse of connections to remote
+	// build-indexes across tag replication tasks.
+	RemoteConnectionPool tagclient.PoolConfig `yaml:"remote_connection_pool"`
+
+	// RemoteResponseCache caches the origins advertised by remote
+	// build-indexes, which are revalidated with their ETags.
+	RemoteResponseCache httputil.ResponseCacheConfig `yaml:"remote_response_cache"`
+
+	// BuildIndexProbe configures active health probing of neighbors and
+	// remote build-indexes, such that unhealthy ones fail fast.
+	BuildIndexProbe tagclient.ProbeConfig `yaml:"build_index_probe"`
+
+	// VerifyReplicatedDependencies only acknowledges tag replication once every
+	// dependency is available on the remote origin cluster. Only applies if
+	// ordered tag replication is disabled, since ordering implies verification.
+	VerifyReplicatedDependencies bool `yaml:"verify_replicated_dependencies"`
+
+	// DisableOrderedTagReplication commits replicated tags to remotes right
+	// after their dependencies are replicated, rather than once they are
+	// confirmed available on the remote origin cluster. Remote tags may then
+	// briefly resolve to blobs which cannot be pulled yet.
+	DisableOrderedTagReplication bool `yaml:"disable_ordered_tag_replication"`
+
+	// Preferred digest algorithms of remotes, keyed by remote address.
+	RemoteDigestAlgorithms map[string]string `yaml:"remote_digest_algorithms"`
+
+	// MirrorSource configures the backends in which origins persist blobs,
+	// from which blobs are copied server-side into mirrors of the same store.
+	MirrorSource []backend.Config `yaml:"mirror_source"`
+
+	// FaultInjection injects faults into backend operations and tag replication
+	// dispatch, for chaos testing only.
+	FaultInjection faults.Config `yaml:"fault_injection"`
+
+	// TagAudit records tag mutations in a hash-chained log in a backend.
+	TagAudit tagaudit.Config `yaml:"tag_audit"`
+
+	// ReplicationCallback configures delivery of replication outcomes to the
+	// callback URLs of replicate requests.
+	ReplicationCallback callback.Config `yaml:"replication_callback"`
+
+	// EnableRefCounts durably counts the tags which reference each blob, such
+	// that deleting a tag only releases blobs no other tag references.
+	EnableRefCounts bool `yaml:"enable_refcounts"`
 }
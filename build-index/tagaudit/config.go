@@ -0,0 +1,28 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package tagaudit
+
+// Config defines the audit log of tag mutations.
+type Config struct {
+	Enabled bool `yaml:"enabled"`
+
+	// Namespace is the backend namespace entries are written to. The backend
+	// should use an identity name path, such that entries of a chain can be
+	// listed by prefix.
+	Namespace string `yaml:"namespace"`
+
+	// Chain names the hash chain entries of this build-index are appended to.
+	// Each build-index must append to its own chain. Defaults to the hostname.
+	Chain string `yaml:"chain"`
+}
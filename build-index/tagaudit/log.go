@@ -0,0 +1,298 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package tagaudit
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/backend"
+	"github.com/uber/kraken/lib/backend/backenderrors"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/uber-go/tally"
+)
+
+// Entry records a single tag mutation. Each entry carries the hash of the
+// previous entry of its chain, such that altering, removing or reordering
+// entries breaks the chain.
+type Entry struct {
+	Seq       int64       `json:"seq"`
+	Principal string      `json:"principal"`
+	Operation string      `json:"operation"`
+	Tag       string      `json:"tag"`
+	Digest    core.Digest `json:"digest"`
+	Timestamp time.Time   `json:"timestamp"`
+	PrevHash  string      `json:"prev_hash"`
+	Hash      string      `json:"hash"`
+}
+
+// computeHash returns the hash of every field of e besides its own hash.
+func (e Entry) computeHash() (string, error) {
+	e.Hash = ""
+	b, err := json.Marshal(e)
+	if err != nil {
+		return "", err
+	}
+	h := sha256.Sum256(b)
+	return hex.EncodeToString(h[:]), nil
+}
+
+// Verify returns an error if entries, ordered by sequence number, do not form
+// an intact chain starting at the first entry.
+func Verify(entries []Entry) error {
+	var prev string
+	for i, e := range entries {
+		if e.Seq != int64(i+1) {
+			return fmt.Errorf("entry %d: expected seq %d, got %d", i, i+1, e.Seq)
+		}
+		if e.PrevHash != prev {
+			return fmt.Errorf("entry %d: previous hash mismatch", e.Seq)
+		}
+		h, err := e.computeHash()
+		if err != nil {
+			return fmt.Errorf("entry %d: hash: %s", e.Seq, err)
+		}
+		if e.Hash != h {
+			return fmt.Errorf("entry %d: hash mismatch", e.Seq)
+		}
+		prev = e.Hash
+	}
+	return nil
+}
+
+// Log appends tag mutations to a hash chain stored in a backend. Each entry
+// is written as a separate object, which is only created if absent, such that
+// existing entries are never overwritten. A nil Log records nothing.
+type Log struct {
+	config Config
+	stats  tally.Scope
+	clk    clock.Clock
+	client backend.Client
+
+	mu     sync.Mutex
+	loaded bool
+	last   *Entry
+}
+
+// Option allows setting optional Log parameters.
+type Option func(*Log)
+
+// WithClock configures the clock used to timestamp entries.
+func WithClock(clk clock.Clock) Option {
+	return func(l *Log) { l.clk = clk }
+}
+
+// New creates a new Log. Returns nil if the audit log is disabled.
+func New(
+	config Config, stats tally.Scope, backends *backend.Manager, opts ...Option) (*Log, error) {
+
+	if !config.Enabled {
+		return nil, nil
+	}
+	if config.Chain == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return nil, fmt.Errorf("hostname: %s", err)
+		}
+		config.Chain = hostname
+	}
+	client, err := backends.GetClient(config.Namespace)
+	if err != nil {
+		return nil, fmt.Errorf("get backend client: %s", err)
+	}
+	l := &Log{
+		config: config,
+		stats: stats.Tagged(map[string]string{
+			"module": "tagaudit",
+		}),
+		clk:    clock.New(),
+		client: client,
+	}
+	for _, opt := range opts {
+		opt(l)
+	}
+	return l, nil
+}
+
+func (l *Log) name(seq int64) string {
+	// Zero-padded, such that entries list in order.
+	return path.Join(l.config.Chain, fmt.Sprintf("%020d", seq))
+}
+
+// Append records principal performing operation on tag pointing to d. Returns
+// once the entry is persisted.
+func (l *Log) Append(principal, operation, tag string, d core.Digest) error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if !l.loaded {
+		// Resume the chain left behind by a previous run.
+		last, err := l.tail()
+		if err != nil {
+			return fmt.Errorf("load chain: %s", err)
+		}
+		l.last = last
+		l.loaded = true
+	}
+	e := Entry{
+		Seq:       1,
+		Principal: principal,
+		Operation: operation,
+		Tag:       tag,
+		Digest:    d,
+		Timestamp: l.clk.Now().UTC(),
+	}
+	if l.last != nil {
+		e.Seq = l.last.Seq + 1
+		e.PrevHash = l.last.Hash
+	}
+	h, err := e.computeHash()
+	if err != nil {
+		return fmt.Errorf("hash: %s", err)
+	}
+	e.Hash = h
+	b, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("json marshal: %s", err)
+	}
+	if err := l.uploadIfAbsent(l.name(e.Seq), b); err != nil {
+		l.stats.Counter("append_failures").Inc(1)
+		if err == backenderrors.ErrBlobExists {
+			// Another writer appended to the chain. Reload its tail on the
+			// next append instead of overwriting the entry.
+			l.loaded = false
+			return fmt.Errorf("entry %d already exists", e.Seq)
+		}
+		return fmt.Errorf("upload: %s", err)
+	}
+	l.stats.Counter("appended_entries").Inc(1)
+	l.last = &e
+	return nil
+}
+
+// Entries returns the persisted entries of the chain, ordered by sequence
+// number.
+func (l *Log) Entries() ([]Entry, error) {
+	if l == nil {
+		return nil, errors.New("audit log disabled")
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.entries()
+}
+
+// Verify returns the number of persisted entries of the chain, and an error if
+// the chain has been tampered with.
+func (l *Log) Verify() (int, error) {
+	entries, err := l.Entries()
+	if err != nil {
+		return 0, err
+	}
+	return len(entries), Verify(entries)
+}
+
+// uploadIfAbsent uploads b into name, returning backenderrors.ErrBlobExists if
+// name already exists. Without conditional writes, existence is checked
+// upfront, which only narrows the window for concurrent writers.
+func (l *Log) uploadIfAbsent(name string, b []byte) error {
+	if l.client.Capabilities().ConditionalWrites {
+		return l.client.(backend.ConditionalClient).UploadIfAbsent(
+			l.config.Namespace, name, bytes.NewReader(b))
+	}
+	if _, err := l.client.Stat(l.config.Namespace, name); err == nil {
+		return backenderrors.ErrBlobExists
+	} else if err != backenderrors.ErrBlobNotFound {
+		return fmt.Errorf("stat: %s", err)
+	}
+	return l.client.Upload(l.config.Namespace, name, bytes.NewReader(b))
+}
+
+// seqs returns the sequence numbers of the persisted entries of the chain in
+// ascending order.
+func (l *Log) seqs() ([]int64, error) {
+	result, err := l.client.List(l.config.Chain + "/")
+	if err != nil {
+		return nil, fmt.Errorf("list: %s", err)
+	}
+	var seqs []int64
+	for _, name := range result.Names {
+		seq, err := strconv.ParseInt(path.Base(name), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid entry name %s: %s", name, err)
+		}
+		seqs = append(seqs, seq)
+	}
+	sort.Slice(seqs, func(i, j int) bool { return seqs[i] < seqs[j] })
+	return seqs, nil
+}
+
+func (l *Log) entry(seq int64) (Entry, error) {
+	var b bytes.Buffer
+	if err := l.client.Download(l.config.Namespace, l.name(seq), &b); err != nil {
+		return Entry{}, fmt.Errorf("download entry %d: %s", seq, err)
+	}
+	var e Entry
+	if err := json.Unmarshal(b.Bytes(), &e); err != nil {
+		return Entry{}, fmt.Errorf("json unmarshal entry %d: %s", seq, err)
+	}
+	return e, nil
+}
+
+// tail returns the last persisted entry of the chain, or nil if it is empty.
+func (l *Log) tail() (*Entry, error) {
+	seqs, err := l.seqs()
+	if err != nil {
+		return nil, err
+	}
+	if len(seqs) == 0 {
+		return nil, nil
+	}
+	e, err := l.entry(seqs[len(seqs)-1])
+	if err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+func (l *Log) entries() ([]Entry, error) {
+	seqs, err := l.seqs()
+	if err != nil {
+		return nil, err
+	}
+	var entries []Entry
+	for _, seq := range seqs {
+		e, err := l.entry(seq)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
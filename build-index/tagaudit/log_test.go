@@ -0,0 +1,189 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package tagaudit
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/backend"
+	"github.com/uber/kraken/lib/backend/namepath"
+	"github.com/uber/kraken/lib/backend/testfs"
+	"github.com/uber/kraken/utils/testutil"
+
+	"github.com/stretchr/testify/require"
+	"github.com/uber-go/tally"
+)
+
+const _testNamespace = "audit"
+
+func backendsFixture(t *testing.T) (*backend.Manager, func()) {
+	s := testfs.NewServer()
+	addr, stop := testutil.StartServer(s.Handler())
+	cleanup := func() {
+		stop()
+		s.Cleanup()
+	}
+	m, err := backend.NewManager([]backend.Config{{
+		Namespace: _testNamespace,
+		Backend: map[string]interface{}{
+			"testfs": testfs.Config{Addr: addr, Root: "root", NamePath: namepath.Identity},
+		},
+	}}, backend.AuthConfig{}, tally.NoopScope)
+	if err != nil {
+		cleanup()
+		t.Fatal(err)
+	}
+	return m, cleanup
+}
+
+func newLog(t *testing.T, backends *backend.Manager) *Log {
+	l, err := New(Config{
+		Enabled:   true,
+		Namespace: _testNamespace,
+		Chain:     "build-index-1",
+	}, tally.NoopScope, backends)
+	require.NoError(t, err)
+	return l
+}
+
+func TestDisabledLogRecordsNothing(t *testing.T) {
+	require := require.New(t)
+
+	l, err := New(Config{}, tally.NoopScope, backend.ManagerFixture())
+	require.NoError(err)
+	require.Nil(l)
+	require.NoError(l.Append("alice", "put", "repo:tag", core.DigestFixture()))
+}
+
+func TestChainVerifiesAfterMutations(t *testing.T) {
+	require := require.New(t)
+
+	backends, cleanup := backendsFixture(t)
+	defer cleanup()
+
+	l := newLog(t, backends)
+	for i := 0; i < 5; i++ {
+		require.NoError(l.Append("alice", "put", "repo:tag", core.DigestFixture()))
+	}
+
+	n, err := l.Verify()
+	require.NoError(err)
+	require.Equal(5, n)
+
+	entries, err := l.Entries()
+	require.NoError(err)
+	require.Equal("alice", entries[0].Principal)
+	require.Equal("put", entries[0].Operation)
+	require.Equal("repo:tag", entries[0].Tag)
+	require.Equal("", entries[0].PrevHash)
+	require.Equal(entries[3].Hash, entries[4].PrevHash)
+}
+
+func TestChainResumesAcrossRestarts(t *testing.T) {
+	require := require.New(t)
+
+	backends, cleanup := backendsFixture(t)
+	defer cleanup()
+
+	require.NoError(newLog(t, backends).Append("alice", "put", "repo:a", core.DigestFixture()))
+	require.NoError(newLog(t, backends).Append("bob", "replicate", "repo:a", core.DigestFixture()))
+
+	n, err := newLog(t, backends).Verify()
+	require.NoError(err)
+	require.Equal(2, n)
+}
+
+func TestChainFailsVerificationWhenEntryAltered(t *testing.T) {
+	require := require.New(t)
+
+	backends, cleanup := backendsFixture(t)
+	defer cleanup()
+
+	l := newLog(t, backends)
+	for i := 0; i < 3; i++ {
+		require.NoError(l.Append("alice", "put", "repo:tag", core.DigestFixture()))
+	}
+
+	entries, err := l.Entries()
+	require.NoError(err)
+
+	// Point the second entry at a different digest, keeping its links intact.
+	altered := entries[1]
+	altered.Digest = core.DigestFixture()
+	b, err := json.Marshal(altered)
+	require.NoError(err)
+	client, err := backends.GetClient(_testNamespace)
+	require.NoError(err)
+	require.NoError(client.Upload(_testNamespace, l.name(2), bytes.NewReader(b)))
+
+	_, err = l.Verify()
+	require.Error(err)
+
+	// Re-hashing the altered entry breaks the link of its successor instead.
+	altered.Hash, err = altered.computeHash()
+	require.NoError(err)
+	b, err = json.Marshal(altered)
+	require.NoError(err)
+	require.NoError(client.Upload(_testNamespace, l.name(2), bytes.NewReader(b)))
+
+	_, err = l.Verify()
+	require.Error(err)
+}
+
+func TestVerifyDetectsMissingEntries(t *testing.T) {
+	require := require.New(t)
+
+	backends, cleanup := backendsFixture(t)
+	defer cleanup()
+
+	l := newLog(t, backends)
+	for i := 0; i < 3; i++ {
+		require.NoError(l.Append("alice", "put", "repo:tag", core.DigestFixture()))
+	}
+	entries, err := l.Entries()
+	require.NoError(err)
+
+	require.NoError(Verify(entries))
+	require.Error(Verify([]Entry{entries[0], entries[2]}))
+	require.Error(Verify(entries[1:]))
+}
+
+func TestAppendNeverOverwritesEntriesOfConcurrentWriter(t *testing.T) {
+	require := require.New(t)
+
+	backends, cleanup := backendsFixture(t)
+	defer cleanup()
+
+	l1 := newLog(t, backends)
+	l2 := newLog(t, backends)
+
+	require.NoError(l1.Append("alice", "put", "repo:a", core.DigestFixture()))
+	require.NoError(l2.Append("bob", "put", "repo:b", core.DigestFixture()))
+
+	// l1 still believes it holds the tail, so its append conflicts with the
+	// entry of l2 instead of overwriting it.
+	require.Error(l1.Append("alice", "put", "repo:c", core.DigestFixture()))
+
+	// The next append resumes from the actual tail.
+	require.NoError(l1.Append("alice", "put", "repo:c", core.DigestFixture()))
+
+	entries, err := l1.Entries()
+	require.NoError(err)
+	require.NoError(Verify(entries))
+	require.Len(entries, 3)
+	require.Equal("bob", entries[1].Principal)
+}
@@ -0,0 +1,93 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package tagclient
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrBudgetExhausted is returned by cluster clients when the time budget of an
+// operation ran out before any attempt could be made.
+var ErrBudgetExhausted = errors.New("time budget exhausted")
+
+// BudgetConfig bounds the total time of each cluster client operation across
+// its attempts against different hosts. The remaining budget is split evenly
+// across the remaining attempts, such that one slow host cannot consume the
+// time left for the others, and the operation never exceeds Timeout.
+type BudgetConfig struct {
+	Enabled bool `yaml:"enabled"`
+
+	// Timeout is the overall deadline of each operation.
+	Timeout time.Duration `yaml:"timeout"`
+
+	// MinAttemptTimeout stops retrying once less budget than this remains, since
+	// such attempts would likely time out anyway.
+	MinAttemptTimeout time.Duration `yaml:"min_attempt_timeout"`
+}
+
+func (c BudgetConfig) applyDefaults() BudgetConfig {
+	if c.Timeout == 0 {
+		c.Timeout = 30 * time.Second
+	}
+	if c.MinAttemptTimeout == 0 {
+		c.MinAttemptTimeout = 100 * time.Millisecond
+	}
+	return c
+}
+
+// WithBudget configures a cluster Client to split the time budget of config
+// across the attempts of each operation. Attempts are bounded by the smaller of
+// their share of the budget and their own timeout.
+func WithBudget(config BudgetConfig) Option {
+	return func(o *clientOptions) {
+		if config.Enabled {
+			c := config.applyDefaults()
+			o.budget = &c
+		}
+	}
+}
+
+// withContext configures a Client to send all requests with ctx.
+func withContext(ctx context.Context) Option {
+	return func(o *clientOptions) { o.ctx = ctx }
+}
+
+// budget tracks the time left of a single operation.
+type budget struct {
+	config   BudgetConfig
+	deadline time.Time
+}
+
+func newBudget(config BudgetConfig) *budget {
+	return &budget{config, time.Now().Add(config.Timeout)}
+}
+
+// next returns the timeout of the next of n remaining attempts, or false if
+// the budget is nearly exhausted.
+func (b *budget) next(n int) (time.Duration, bool) {
+	left := time.Until(b.deadline)
+	if left < b.config.MinAttemptTimeout {
+		return 0, false
+	}
+	if n < 1 {
+		n = 1
+	}
+	timeout := left / time.Duration(n)
+	if timeout < b.config.MinAttemptTimeout {
+		timeout = b.config.MinAttemptTimeout
+	}
+	return timeout, true
+}
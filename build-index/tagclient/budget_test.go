@@ -0,0 +1,107 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package tagclient
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/healthcheck"
+	"github.com/uber/kraken/lib/hostlist"
+	"github.com/uber/kraken/utils/httputil"
+	"github.com/uber/kraken/utils/testutil"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/atomic"
+)
+
+func startSlowServer(delay time.Duration, requests *atomic.Int64) (string, func()) {
+	return testutil.StartServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Inc()
+		select {
+		case <-time.After(delay):
+		case <-r.Context().Done():
+		}
+	}))
+}
+
+func TestClusterClientBudgetBoundsTotalTimeAcrossRetries(t *testing.T) {
+	require := require.New(t)
+
+	requests := atomic.NewInt64(0)
+	var addrs []string
+	for i := 0; i < 3; i++ {
+		addr, stop := startSlowServer(5*time.Second, requests)
+		defer stop()
+		addrs = append(addrs, addr)
+	}
+
+	timeout := 600 * time.Millisecond
+	client := NewClusterClient(
+		healthcheck.NoopFailed(hostlist.Fixture(addrs...)), nil,
+		WithBudget(BudgetConfig{Enabled: true, Timeout: timeout}))
+
+	start := time.Now()
+	_, err := client.Get(core.TagFixture())
+	elapsed := time.Since(start)
+
+	require.True(httputil.IsNetworkError(err))
+	require.True(elapsed < timeout+200*time.Millisecond, "took %s", elapsed)
+
+	// The budget is split across attempts, rather than spent on the first host.
+	require.Equal(int64(3), requests.Load())
+}
+
+func TestClusterClientBudgetLeavesTimeForHealthyHost(t *testing.T) {
+	require := require.New(t)
+
+	requests := atomic.NewInt64(0)
+	slow1, stop := startSlowServer(5*time.Second, requests)
+	defer stop()
+	slow2, stop := startSlowServer(5*time.Second, requests)
+	defer stop()
+
+	d := core.DigestFixture()
+	healthy, stop := testutil.StartServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(d.String()))
+	}))
+	defer stop()
+
+	client := NewClusterClient(
+		healthcheck.NoopFailed(hostlist.Fixture(slow1, slow2, healthy)), nil,
+		WithBudget(BudgetConfig{Enabled: true, Timeout: 900 * time.Millisecond}))
+
+	result, err := client.Get(core.TagFixture())
+	require.NoError(err)
+	require.Equal(d, result)
+}
+
+func TestBudgetNextSplitsRemainingTime(t *testing.T) {
+	require := require.New(t)
+
+	b := newBudget(BudgetConfig{
+		Timeout:           time.Second,
+		MinAttemptTimeout: 100 * time.Millisecond,
+	})
+
+	timeout, ok := b.next(4)
+	require.True(ok)
+	require.InDelta(float64(250*time.Millisecond), float64(timeout), float64(10*time.Millisecond))
+
+	b.deadline = time.Now().Add(50 * time.Millisecond)
+	_, ok = b.next(1)
+	require.False(ok)
+}
@@ -15,82 +15,268 @@ package tagclient
 
 import (
 	"bytes"
+	"context"
 	"crypto/tls"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"net/http"
 	"net/url"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/uber/kraken/build-index/tagmodels"
 	"github.com/uber/kraken/core"
 	"github.com/uber/kraken/lib/healthcheck"
+	"github.com/uber/kraken/utils/handler"
 	"github.com/uber/kraken/utils/httputil"
 )
 
 // Client errors.
 var (
-	ErrTagNotFound = errors.New("tag not found")
+	ErrTagNotFound        = errors.New("tag not found")
+	ErrQuotaExceeded      = errors.New("namespace quota exceeded")
+	ErrNamespaceNotFound  = errors.New("namespace not found")
+	ErrBackendUnavailable = errors.New("backend unavailable")
+	ErrTagValueTooLarge   = errors.New("tag value too large")
+	ErrReadOnly           = errors.New("build-index is read-only")
+	ErrInvalidTagName     = errors.New("invalid tag name")
+	ErrRateLimited        = errors.New("namespace read rate limit exceeded")
+	ErrBacklogFull        = errors.New("replication backlog full")
 )
 
+// _codeErrors maps the codes of tagserver error responses to Client errors.
+var _codeErrors = map[string]error{
+	tagmodels.ErrCodeTagNotFound:        ErrTagNotFound,
+	tagmodels.ErrCodeQuotaExceeded:      ErrQuotaExceeded,
+	tagmodels.ErrCodeNamespaceNotFound:  ErrNamespaceNotFound,
+	tagmodels.ErrCodeBackendUnavailable: ErrBackendUnavailable,
+	tagmodels.ErrCodeTagValueTooLarge:   ErrTagValueTooLarge,
+	tagmodels.ErrCodeReadOnly:           ErrReadOnly,
+	tagmodels.ErrCodeInvalidTagName:     ErrInvalidTagName,
+	tagmodels.ErrCodeRateLimited:        ErrRateLimited,
+	tagmodels.ErrCodeBacklogFull:        ErrBacklogFull,
+}
+
 // Client wraps tagserver endpoints.
 type Client interface {
 	Put(tag string, d core.Digest) error
 	PutAndReplicate(tag string, d core.Digest) error
+	PutAndReplicateTranslated(tag string, d, translated core.Digest) error
+	PutAndReplicateWithOptions(tag string, d core.Digest, opts PutAndReplicateOptions) error
 	Get(tag string) (core.Digest, error)
+	GetStream(tag string, w io.Writer) error
 	Has(tag string) (bool, error)
+	Delete(tag string) error
+	Undelete(tag string) error
 	List(prefix string) ([]string, error)
 	ListWithPagination(prefix string, filter ListFilter) (tagmodels.ListResponse, error)
 	ListRepository(repo string) ([]string, error)
 	ListRepositoryWithPagination(repo string, filter ListFilter) (tagmodels.ListResponse, error)
-	Replicate(tag string) error
+	Replicate(tag string, exclude ...string) error
+	ReplicateTo(tag string, remotes ...string) error
+	ReplicateWithDependencies(tag string, dependencies core.DigestList, exclude ...string) error
+	ReplicateWithCallback(
+		tag string, dependencies core.DigestList, callback string, exclude ...string) error
+	ReplicateBatch(tags []string, dependencyOrder bool) error
+	ReplicaRemotes(tag string) ([]string, error)
 	Origin() (string, error)
 
 	DuplicateReplicate(
-		tag string, d core.Digest, dependencies core.DigestList, delay time.Duration) error
+		tag string, d core.Digest, dependencies core.DigestList, delay time.Duration,
+		priority int, exclude ...string) error
 	DuplicatePut(tag string, d core.Digest, delay time.Duration) error
+	DuplicatePauseRemote(remote string, paused bool) error
+	InvalidateCache(tag string) error
+}
+
+// Option allows setting optional Client parameters.
+type Option func(*clientOptions)
+
+type clientOptions struct {
+	requestHooks   []httputil.RequestHook
+	responseHooks  []httputil.ResponseHook
+	interceptors   []httputil.Interceptor
+	originSelector *originSelector
+	transport      http.RoundTripper
+	responseCache  *httputil.ResponseCache
+	budget         *BudgetConfig
+	ctx            context.Context
+}
+
+// WithRequestHooks configures a Client to run hooks against every request
+// before it is sent, e.g. to inject auth tokens or tracing headers.
+func WithRequestHooks(hooks ...httputil.RequestHook) Option {
+	return func(o *clientOptions) { o.requestHooks = append(o.requestHooks, hooks...) }
+}
+
+// WithResponseHooks configures a Client to run hooks after every request
+// completes, e.g. to emit metrics.
+func WithResponseHooks(hooks ...httputil.ResponseHook) Option {
+	return func(o *clientOptions) { o.responseHooks = append(o.responseHooks, hooks...) }
+}
+
+// WithInterceptors configures a Client to wrap every request in interceptors,
+// the first of which is the outermost, e.g. AuthInterceptor, or
+// httputil.RetryInterceptor to retry every call. Interceptors after a retry
+// interceptor run once per attempt.
+func WithInterceptors(interceptors ...httputil.Interceptor) Option {
+	return func(o *clientOptions) { o.interceptors = append(o.interceptors, interceptors...) }
+}
+
+// AuthInterceptor authenticates every request by setting header to the
+// credentials returned by creds, e.g. a bearer token checked by a proxy in
+// front of the tagservers. creds is called per request, such that it may
+// refresh expired credentials. Requests fail if creds returns an error.
+func AuthInterceptor(header string, creds func() (string, error)) httputil.Interceptor {
+	return func(req *http.Request, next httputil.RoundTrip) (*http.Response, error) {
+		v, err := creds()
+		if err != nil {
+			return nil, fmt.Errorf("auth credentials: %s", err)
+		}
+		req.Header.Set(header, v)
+		return next(req)
+	}
+}
+
+// WithResponseCache configures a Client to cache origin responses in cache,
+// revalidating them with their ETags. Caches should be shared by all Clients.
+func WithResponseCache(cache *httputil.ResponseCache) Option {
+	return func(o *clientOptions) { o.responseCache = cache }
 }
 
 type singleClient struct {
 	addr string
 	tls  *tls.Config
+	opts clientOptions
 }
 
 // ListFilter contains filter request for list with pagination operations.
 type ListFilter struct {
 	Offset string
 	Limit  int
+
+	// ModifiedSince, if set, filters out tags last modified before it. Ignored
+	// by backends which do not support it, which list all tags.
+	ModifiedSince time.Time
 }
 
 // NewSingleClient returns a Client scoped to a single tagserver instance.
-func NewSingleClient(addr string, config *tls.Config) Client {
-	return &singleClient{addr, config}
+func NewSingleClient(addr string, config *tls.Config, opts ...Option) Client {
+	var o clientOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return &singleClient{addr, config, o}
+}
+
+// send sends a request with the options shared by all tagserver requests.
+func (c *singleClient) send(
+	method, rawurl string, options ...httputil.SendOption) (*http.Response, error) {
+
+	transport := httputil.SendTLS(c.tls)
+	if c.opts.transport != nil {
+		transport = httputil.SendTransport(c.opts.transport)
+		if c.tls != nil {
+			transport = httputil.SendTLSTransport(c.opts.transport)
+		}
+	}
+	if c.opts.ctx != nil {
+		options = append(options, httputil.SendContext(c.opts.ctx))
+	}
+	options = append(options,
+		httputil.SendDeadline(),
+		transport,
+		httputil.SendRequestHooks(c.opts.requestHooks...),
+		httputil.SendInterceptors(c.opts.interceptors...),
+		httputil.SendResponseHooks(c.opts.responseHooks...))
+	resp, err := httputil.Send(method, rawurl, options...)
+	if err != nil {
+		return nil, codeError(err)
+	}
+	return resp, nil
+}
+
+// codeError converts error responses which carry a machine-readable code into
+// Client errors. Other errors are returned as is.
+func codeError(err error) error {
+	serr, ok := err.(httputil.StatusError)
+	if !ok {
+		return err
+	}
+	var resp handler.ErrorResponse
+	if json.Unmarshal([]byte(serr.ResponseDump), &resp) != nil {
+		return err
+	}
+	if cerr, ok := _codeErrors[resp.Code]; ok {
+		return cerr
+	}
+	return err
 }
 
 func (c *singleClient) Put(tag string, d core.Digest) error {
-	_, err := httputil.Put(
+	_, err := c.send("PUT",
 		fmt.Sprintf("http://%s/tags/%s/digest/%s", c.addr, url.PathEscape(tag), d.String()),
-		httputil.SendTimeout(30*time.Second),
-		httputil.SendTLS(c.tls))
-	return err
+		httputil.SendTimeout(30*time.Second))
+	return putError(err)
 }
 
 func (c *singleClient) PutAndReplicate(tag string, d core.Digest) error {
-	_, err := httputil.Put(
-		fmt.Sprintf("http://%s/tags/%s/digest/%s?replicate=true", c.addr, url.PathEscape(tag), d.String()),
-		httputil.SendTimeout(30*time.Second),
-		httputil.SendTLS(c.tls))
+	return c.PutAndReplicateWithOptions(tag, d, PutAndReplicateOptions{})
+}
+
+// PutAndReplicateTranslated is like PutAndReplicate, but additionally carries
+// the translation of d into the remote's preferred digest algorithm.
+func (c *singleClient) PutAndReplicateTranslated(tag string, d, translated core.Digest) error {
+	return c.PutAndReplicateWithOptions(tag, d, PutAndReplicateOptions{Translated: &translated})
+}
+
+// PutAndReplicateOptions are the optional parameters of PutAndReplicate.
+type PutAndReplicateOptions struct {
+	// Translated, if set, is the translation of d into the remote's preferred
+	// digest algorithm.
+	Translated *core.Digest
+
+	// Priority, if set, is the priority of the replications the tagserver
+	// enqueues, which is inherited from the replication putting the tag.
+	Priority int
+}
+
+// PutAndReplicateWithOptions is like PutAndReplicate, with opts.
+func (c *singleClient) PutAndReplicateWithOptions(
+	tag string, d core.Digest, opts PutAndReplicateOptions) error {
+
+	query := url.Values{"replicate": {"true"}}
+	if opts.Translated != nil {
+		query.Set("translated", opts.Translated.String())
+	}
+	if opts.Priority != 0 {
+		query.Set("priority", strconv.Itoa(opts.Priority))
+	}
+	_, err := c.send("PUT",
+		fmt.Sprintf(
+			"http://%s/tags/%s/digest/%s?%s",
+			c.addr, url.PathEscape(tag), d.String(), query.Encode()),
+		httputil.SendTimeout(30*time.Second))
+	return putError(err)
+}
+
+// putError converts errors of put requests into Client errors. Servers which
+// predate error codes signal exceeded quotas by status alone.
+func putError(err error) error {
+	if httputil.IsStatus(err, http.StatusTooManyRequests) {
+		return ErrQuotaExceeded
+	}
 	return err
 }
 
 func (c *singleClient) Get(tag string) (core.Digest, error) {
-	resp, err := httputil.Get(
+	resp, err := c.send("GET",
 		fmt.Sprintf("http://%s/tags/%s", c.addr, url.PathEscape(tag)),
-		httputil.SendTimeout(10*time.Second),
-		httputil.SendTLS(c.tls))
+		httputil.SendTimeout(10*time.Second))
 	if err != nil {
 		if httputil.IsNotFound(err) {
 			return core.Digest{}, ErrTagNotFound
@@ -102,20 +288,44 @@ func (c *singleClient) Get(tag string) (core.Digest, error) {
 	if err != nil {
 		return core.Digest{}, fmt.Errorf("read body: %s", err)
 	}
-	d, err := core.ParseSHA256Digest(string(b))
+	d, err := core.ParseDigest(string(b))
 	if err != nil {
 		return core.Digest{}, fmt.Errorf("new digest: %s", err)
 	}
 	return d, nil
 }
 
-func (c *singleClient) Has(tag string) (bool, error) {
-	_, err := httputil.Head(
+// GetStream streams the stored value of tag into w without buffering it. If w
+// has headers, such as an http.ResponseWriter, the content type of the value
+// is set on w before streaming. Returns ErrTagNotFound if tag does not exist.
+func (c *singleClient) GetStream(tag string, w io.Writer) error {
+	resp, err := c.send("GET",
 		fmt.Sprintf("http://%s/tags/%s", c.addr, url.PathEscape(tag)),
-		httputil.SendTimeout(10*time.Second),
-		httputil.SendTLS(c.tls))
+		httputil.SendTimeout(30*time.Second))
 	if err != nil {
 		if httputil.IsNotFound(err) {
+			return ErrTagNotFound
+		}
+		return err
+	}
+	defer resp.Body.Close()
+	if hw, ok := w.(interface{ Header() http.Header }); ok {
+		if ct := resp.Header.Get("Content-Type"); ct != "" {
+			hw.Header().Set("Content-Type", ct)
+		}
+	}
+	if _, err := io.Copy(w, resp.Body); err != nil {
+		return fmt.Errorf("copy body: %s", err)
+	}
+	return nil
+}
+
+func (c *singleClient) Has(tag string) (bool, error) {
+	_, err := c.send("HEAD",
+		fmt.Sprintf("http://%s/tags/%s", c.addr, url.PathEscape(tag)),
+		httputil.SendTimeout(10*time.Second))
+	if err != nil {
+		if err == ErrTagNotFound || httputil.IsNotFound(err) {
 			return false, nil
 		}
 		return false, err
@@ -123,6 +333,32 @@ func (c *singleClient) Has(tag string) (bool, error) {
 	return true, nil
 }
 
+// Delete deletes tag. Returns ErrTagNotFound if tag does not exist.
+func (c *singleClient) Delete(tag string) error {
+	_, err := c.send("DELETE",
+		fmt.Sprintf("http://%s/tags/%s", c.addr, url.PathEscape(tag)),
+		httputil.SendTimeout(30*time.Second),
+		httputil.SendAcceptedCodes(http.StatusNoContent))
+	if err != nil && httputil.IsNotFound(err) {
+		return ErrTagNotFound
+	}
+	return err
+}
+
+// Undelete restores tag to the digest it pointed to before it was deleted.
+// Returns ErrTagNotFound if tag does not exist or was deleted longer than the
+// soft delete retention ago.
+func (c *singleClient) Undelete(tag string) error {
+	_, err := c.send("POST",
+		fmt.Sprintf("http://%s/tags/%s/undelete", c.addr, url.PathEscape(tag)),
+		httputil.SendTimeout(30*time.Second),
+		httputil.SendAcceptedCodes(http.StatusNoContent))
+	if err != nil && httputil.IsNotFound(err) {
+		return ErrTagNotFound
+	}
+	return err
+}
+
 func (c *singleClient) doListPaginated(urlFormat string, pathSub string,
 	filter ListFilter) (tagmodels.ListResponse, error) {
 
@@ -134,6 +370,9 @@ func (c *singleClient) doListPaginated(urlFormat string, pathSub string,
 	if filter.Limit != 0 {
 		reqVal.Add(tagmodels.LimitQ, strconv.Itoa(filter.Limit))
 	}
+	if !filter.ModifiedSince.IsZero() {
+		reqVal.Add(tagmodels.ModifiedSinceQ, filter.ModifiedSince.UTC().Format(time.RFC3339Nano))
+	}
 
 	// Fetch list response from server.
 	serverUrl := url.URL{
@@ -143,10 +382,9 @@ func (c *singleClient) doListPaginated(urlFormat string, pathSub string,
 		RawQuery: reqVal.Encode(),
 	}
 	var resp tagmodels.ListResponse
-	httpResp, err := httputil.Get(
+	httpResp, err := c.send("GET",
 		serverUrl.String(),
-		httputil.SendTimeout(60*time.Second),
-		httputil.SendTLS(c.tls))
+		httputil.SendTimeout(60*time.Second))
 	if err != nil {
 		return resp, err
 	}
@@ -212,37 +450,129 @@ func (c *singleClient) ListRepositoryWithPagination(repo string,
 // ReplicateRequest defines a Replicate request body.
 type ReplicateRequest struct {
 	Dependencies []core.Digest `json:"dependencies"`
+
+	// Callback is posted the outcome of replication to each remote, if set.
+	Callback string `json:"callback,omitempty"`
 }
 
-func (c *singleClient) Replicate(tag string) error {
-	_, err := httputil.Post(
-		fmt.Sprintf("http://%s/remotes/tags/%s", c.addr, url.PathEscape(tag)),
-		httputil.SendTimeout(15*time.Second),
-		httputil.SendTLS(c.tls))
+// Replicate replicates tag to all remotes it matches, except for the remotes
+// listed in exclude. The dependencies of tag are resolved by the server.
+func (c *singleClient) Replicate(tag string, exclude ...string) error {
+	return c.ReplicateWithDependencies(tag, nil, exclude...)
+}
+
+// ReplicateTo replicates tag to remotes only, each of which tag must match.
+// Mirrors which tag matches are replicated to regardless.
+func (c *singleClient) ReplicateTo(tag string, remotes ...string) error {
+	_, err := c.send("POST",
+		fmt.Sprintf("http://%s/remotes/tags/%s?%s",
+			c.addr, url.PathEscape(tag), url.Values{"remote": remotes}.Encode()),
+		httputil.SendTimeout(15*time.Second))
+	return err
+}
+
+// ReplicateWithDependencies is like Replicate, but replicates dependencies
+// instead of the dependencies resolved by the server, if set.
+func (c *singleClient) ReplicateWithDependencies(
+	tag string, dependencies core.DigestList, exclude ...string) error {
+
+	return c.ReplicateWithCallback(tag, dependencies, "", exclude...)
+}
+
+// ReplicateWithCallback is like ReplicateWithDependencies, but additionally
+// posts the outcome of replication to each remote to callback, if set.
+func (c *singleClient) ReplicateWithCallback(
+	tag string, dependencies core.DigestList, callback string, exclude ...string) error {
+
+	u := fmt.Sprintf("http://%s/remotes/tags/%s", c.addr, url.PathEscape(tag))
+	if len(exclude) > 0 {
+		u += "?" + url.Values{"exclude": exclude}.Encode()
+	}
+	opts := []httputil.SendOption{httputil.SendTimeout(15 * time.Second)}
+	if len(dependencies) > 0 || callback != "" {
+		b, err := json.Marshal(ReplicateRequest{dependencies, callback})
+		if err != nil {
+			return fmt.Errorf("json marshal: %s", err)
+		}
+		opts = append(opts, httputil.SendBody(bytes.NewReader(b)))
+	}
+	_, err := c.send("POST", u, opts...)
 	return err
 }
 
+// BatchReplicateRequest defines a ReplicateBatch request body.
+type BatchReplicateRequest struct {
+	Tags []string `json:"tags"`
+
+	// DependencyOrder replicates dependencies shared by several tags of the
+	// batch before replicating any of the tags.
+	DependencyOrder bool `json:"dependency_order,omitempty"`
+}
+
+// ReplicateBatch replicates every tag of tags to all remotes it matches. The
+// dependencies of each tag are resolved by the server. If dependencyOrder is
+// set, dependencies shared by several tags are replicated before the tags, and
+// the call blocks until they are.
+func (c *singleClient) ReplicateBatch(tags []string, dependencyOrder bool) error {
+	b, err := json.Marshal(BatchReplicateRequest{tags, dependencyOrder})
+	if err != nil {
+		return fmt.Errorf("json marshal: %s", err)
+	}
+	timeout := 15 * time.Second
+	if dependencyOrder {
+		timeout = 5 * time.Minute
+	}
+	_, err = c.send(
+		"POST",
+		fmt.Sprintf("http://%s/remotes/tags", c.addr),
+		httputil.SendBody(bytes.NewReader(b)),
+		httputil.SendTimeout(timeout))
+	return err
+}
+
+// ReplicaRemotes returns the remotes which acknowledged replication of the
+// current digest of tag.
+func (c *singleClient) ReplicaRemotes(tag string) ([]string, error) {
+	resp, err := c.send("GET",
+		fmt.Sprintf("http://%s/remotes/tags/%s", c.addr, url.PathEscape(tag)),
+		httputil.SendTimeout(10*time.Second))
+	if err != nil {
+		if httputil.IsNotFound(err) {
+			return nil, ErrTagNotFound
+		}
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var r tagmodels.ReplicaRemotesResponse
+	if err := json.NewDecoder(resp.Body).Decode(&r); err != nil {
+		return nil, fmt.Errorf("json decode: %s", err)
+	}
+	return r.Remotes, nil
+}
+
 // DuplicateReplicateRequest defines a DuplicateReplicate request body.
 type DuplicateReplicateRequest struct {
 	Dependencies core.DigestList `json:"dependencies"`
 	Delay        time.Duration   `json:"delay"`
+	Exclude      []string        `json:"exclude,omitempty"`
+	Priority     int             `json:"priority,omitempty"`
 }
 
 func (c *singleClient) DuplicateReplicate(
-	tag string, d core.Digest, dependencies core.DigestList, delay time.Duration) error {
+	tag string, d core.Digest, dependencies core.DigestList, delay time.Duration,
+	priority int, exclude ...string) error {
 
-	b, err := json.Marshal(DuplicateReplicateRequest{dependencies, delay})
+	b, err := json.Marshal(DuplicateReplicateRequest{dependencies, delay, exclude, priority})
 	if err != nil {
 		return fmt.Errorf("json marshal: %s", err)
 	}
-	_, err = httputil.Post(
+	_, err = c.send("POST",
 		fmt.Sprintf(
 			"http://%s/internal/duplicate/remotes/tags/%s/digest/%s",
 			c.addr, url.PathEscape(tag), d.String()),
 		httputil.SendBody(bytes.NewReader(b)),
 		httputil.SendTimeout(10*time.Second),
-		httputil.SendRetry(),
-		httputil.SendTLS(c.tls))
+		httputil.SendRetry())
 	return err
 }
 
@@ -256,22 +586,56 @@ func (c *singleClient) DuplicatePut(tag string, d core.Digest, delay time.Durati
 	if err != nil {
 		return fmt.Errorf("json marshal: %s", err)
 	}
-	_, err = httputil.Put(
+	_, err = c.send("PUT",
 		fmt.Sprintf(
 			"http://%s/internal/duplicate/tags/%s/digest/%s",
 			c.addr, url.PathEscape(tag), d.String()),
 		httputil.SendBody(bytes.NewReader(b)),
 		httputil.SendTimeout(10*time.Second),
-		httputil.SendRetry(),
-		httputil.SendTLS(c.tls))
+		httputil.SendRetry())
 	return err
 }
 
-func (c *singleClient) Origin() (string, error) {
-	resp, err := httputil.Get(
-		fmt.Sprintf("http://%s/origin", c.addr),
+// DuplicatePauseRemote pauses or resumes replication to remote on the
+// tagserver, without forwarding to its neighbors.
+func (c *singleClient) DuplicatePauseRemote(remote string, paused bool) error {
+	method := "PUT"
+	if !paused {
+		method = "DELETE"
+	}
+	_, err := c.send(method,
+		fmt.Sprintf(
+			"http://%s/internal/duplicate/replication/paused/%s",
+			c.addr, url.PathEscape(remote)),
 		httputil.SendTimeout(5*time.Second),
-		httputil.SendTLS(c.tls))
+		httputil.SendRetry())
+	return err
+}
+
+// InvalidateCache drops the value of tag cached by the tagserver.
+func (c *singleClient) InvalidateCache(tag string) error {
+	_, err := c.send("POST",
+		fmt.Sprintf("http://%s/internal/invalidate/tags/%s", c.addr, url.PathEscape(tag)),
+		httputil.SendTimeout(5*time.Second))
+	return err
+}
+
+func (c *singleClient) Origin() (string, error) {
+	if c.opts.originSelector != nil {
+		return c.opts.originSelector.get(c.addr, c.originClusters)
+	}
+	rawurl := fmt.Sprintf("http://%s/origin", c.addr)
+	get := func(options ...httputil.SendOption) (*http.Response, error) {
+		return c.send("GET", rawurl, append(options, httputil.SendTimeout(5*time.Second))...)
+	}
+	if c.opts.responseCache != nil {
+		b, err := c.opts.responseCache.Get(rawurl, get)
+		if err != nil {
+			return "", err
+		}
+		return string(b), nil
+	}
+	resp, err := get()
 	if err != nil {
 		return "", err
 	}
@@ -283,15 +647,49 @@ func (c *singleClient) Origin() (string, error) {
 	return string(b), nil
 }
 
+// originClusters returns all origin clusters advertised by the tagserver. Falls
+// back to the local origin if the tagserver only supports plain responses.
+func (c *singleClient) originClusters() ([]tagmodels.OriginCluster, error) {
+	resp, err := c.send("GET",
+		fmt.Sprintf("http://%s/origin", c.addr),
+		httputil.SendHeaders(map[string]string{"Accept": "application/json"}),
+		httputil.SendTimeout(5*time.Second))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read body: %s", err)
+	}
+	if !strings.HasPrefix(resp.Header.Get("Content-Type"), "application/json") {
+		return []tagmodels.OriginCluster{{Addr: string(b)}}, nil
+	}
+	var origins tagmodels.OriginResponse
+	if err := json.Unmarshal(b, &origins); err != nil {
+		return nil, fmt.Errorf("json unmarshal: %s", err)
+	}
+	if len(origins.Clusters) == 0 {
+		return nil, errors.New("no origin clusters")
+	}
+	return origins.Clusters, nil
+}
+
 type clusterClient struct {
-	hosts healthcheck.List
-	tls   *tls.Config
+	hosts  healthcheck.List
+	tls    *tls.Config
+	opts   []Option
+	budget *BudgetConfig
 }
 
 // NewClusterClient creates a Client which operates on tagserver instances as
 // a cluster.
-func NewClusterClient(hosts healthcheck.List, config *tls.Config) Client {
-	return &clusterClient{hosts, config}
+func NewClusterClient(hosts healthcheck.List, config *tls.Config, opts ...Option) Client {
+	var o clientOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return &clusterClient{hosts, config, opts, o.budget}
 }
 
 func (cc *clusterClient) do(request func(c Client) error) error {
@@ -299,9 +697,26 @@ func (cc *clusterClient) do(request func(c Client) error) error {
 	if len(addrs) == 0 {
 		return errors.New("cluster client: no hosts could be resolved")
 	}
-	var err error
+	var b *budget
+	if cc.budget != nil {
+		b = newBudget(*cc.budget)
+	}
+	err := ErrBudgetExhausted
+	var attempts int
 	for addr := range addrs {
-		err = request(NewSingleClient(addr, cc.tls))
+		opts := cc.opts
+		if b != nil {
+			timeout, ok := b.next(len(addrs) - attempts)
+			if !ok {
+				// Returns the error of the last attempt, if any.
+				break
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+			opts = append(opts[:len(opts):len(opts)], withContext(ctx))
+		}
+		attempts++
+		err = request(NewSingleClient(addr, cc.tls, opts...))
 		if httputil.IsNetworkError(err) {
 			cc.hosts.Failed(addr)
 			continue
@@ -319,6 +734,16 @@ func (cc *clusterClient) PutAndReplicate(tag string, d core.Digest) error {
 	return cc.do(func(c Client) error { return c.PutAndReplicate(tag, d) })
 }
 
+func (cc *clusterClient) PutAndReplicateTranslated(tag string, d, translated core.Digest) error {
+	return cc.do(func(c Client) error { return c.PutAndReplicateTranslated(tag, d, translated) })
+}
+
+func (cc *clusterClient) PutAndReplicateWithOptions(
+	tag string, d core.Digest, opts PutAndReplicateOptions) error {
+
+	return cc.do(func(c Client) error { return c.PutAndReplicateWithOptions(tag, d, opts) })
+}
+
 func (cc *clusterClient) Get(tag string) (d core.Digest, err error) {
 	err = cc.do(func(c Client) error {
 		d, err = c.Get(tag)
@@ -327,6 +752,12 @@ func (cc *clusterClient) Get(tag string) (d core.Digest, err error) {
 	return
 }
 
+// GetStream only retries on another host if the request fails before any bytes
+// are written to w, since errors while streaming are not network errors.
+func (cc *clusterClient) GetStream(tag string, w io.Writer) error {
+	return cc.do(func(c Client) error { return c.GetStream(tag, w) })
+}
+
 func (cc *clusterClient) Has(tag string) (ok bool, err error) {
 	err = cc.do(func(c Client) error {
 		ok, err = c.Has(tag)
@@ -335,6 +766,14 @@ func (cc *clusterClient) Has(tag string) (ok bool, err error) {
 	return
 }
 
+func (cc *clusterClient) Delete(tag string) error {
+	return cc.do(func(c Client) error { return c.Delete(tag) })
+}
+
+func (cc *clusterClient) Undelete(tag string) error {
+	return cc.do(func(c Client) error { return c.Undelete(tag) })
+}
+
 func (cc *clusterClient) List(prefix string) (tags []string, err error) {
 	err = cc.do(func(c Client) error {
 		tags, err = c.List(prefix)
@@ -371,8 +810,40 @@ func (cc *clusterClient) ListRepositoryWithPagination(repo string,
 	return
 }
 
-func (cc *clusterClient) Replicate(tag string) error {
-	return cc.do(func(c Client) error { return c.Replicate(tag) })
+func (cc *clusterClient) Replicate(tag string, exclude ...string) error {
+	return cc.do(func(c Client) error { return c.Replicate(tag, exclude...) })
+}
+
+func (cc *clusterClient) ReplicateTo(tag string, remotes ...string) error {
+	return cc.do(func(c Client) error { return c.ReplicateTo(tag, remotes...) })
+}
+
+func (cc *clusterClient) ReplicateWithDependencies(
+	tag string, dependencies core.DigestList, exclude ...string) error {
+
+	return cc.do(func(c Client) error {
+		return c.ReplicateWithDependencies(tag, dependencies, exclude...)
+	})
+}
+
+func (cc *clusterClient) ReplicateWithCallback(
+	tag string, dependencies core.DigestList, callback string, exclude ...string) error {
+
+	return cc.do(func(c Client) error {
+		return c.ReplicateWithCallback(tag, dependencies, callback, exclude...)
+	})
+}
+
+func (cc *clusterClient) ReplicateBatch(tags []string, dependencyOrder bool) error {
+	return cc.do(func(c Client) error { return c.ReplicateBatch(tags, dependencyOrder) })
+}
+
+func (cc *clusterClient) ReplicaRemotes(tag string) (remotes []string, err error) {
+	err = cc.do(func(c Client) error {
+		remotes, err = c.ReplicaRemotes(tag)
+		return err
+	})
+	return
 }
 
 func (cc *clusterClient) Origin() (origin string, err error) {
@@ -384,7 +855,8 @@ func (cc *clusterClient) Origin() (origin string, err error) {
 }
 
 func (cc *clusterClient) DuplicateReplicate(
-	tag string, d core.Digest, dependencies core.DigestList, delay time.Duration) error {
+	tag string, d core.Digest, dependencies core.DigestList, delay time.Duration,
+	priority int, exclude ...string) error {
 
 	return errors.New("duplicate replicate not supported on cluster client")
 }
@@ -392,3 +864,11 @@ func (cc *clusterClient) DuplicateReplicate(
 func (cc *clusterClient) DuplicatePut(tag string, d core.Digest, delay time.Duration) error {
 	return errors.New("duplicate put not supported on cluster client")
 }
+
+func (cc *clusterClient) DuplicatePauseRemote(remote string, paused bool) error {
+	return errors.New("duplicate pause not supported on cluster client")
+}
+
+func (cc *clusterClient) InvalidateCache(tag string) error {
+	return errors.New("invalidate cache not supported on cluster client")
+}
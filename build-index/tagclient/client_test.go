@@ -0,0 +1,223 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package tagclient
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/uber/kraken/build-index/tagmodels"
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/healthcheck"
+	"github.com/uber/kraken/lib/hostlist"
+	"github.com/uber/kraken/utils/handler"
+	"github.com/uber/kraken/utils/httputil"
+	"github.com/uber/kraken/utils/testutil"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/atomic"
+)
+
+func TestRequestHooksAppliedToEveryCall(t *testing.T) {
+	require := require.New(t)
+
+	received := atomic.NewInt64(0)
+	missing := atomic.NewInt64(0)
+	addr, stop := testutil.StartServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received.Inc()
+		if r.Header.Get("X-Auth-Token") != "secret" {
+			missing.Inc()
+		}
+	}))
+	defer stop()
+
+	responses := atomic.NewInt64(0)
+	opts := []Option{
+		WithRequestHooks(func(req *http.Request) error {
+			req.Header.Set("X-Auth-Token", "secret")
+			return nil
+		}),
+		WithResponseHooks(func(resp *http.Response, err error) {
+			responses.Inc()
+		}),
+	}
+
+	tag := core.TagFixture()
+	d := core.DigestFixture()
+
+	for _, test := range []struct {
+		client   Client
+		expected int64
+	}{
+		{NewSingleClient(addr, nil, opts...), 14},
+		{NewProvider(nil, opts...).Provide(addr), 14},
+		// Duplicate operations are not supported on cluster clients.
+		{NewClusterClient(healthcheck.NoopFailed(hostlist.Fixture(addr)), nil, opts...), 12},
+	} {
+		client := test.client
+		received.Store(0)
+		responses.Store(0)
+
+		// Only the requests matter, not whether the empty responses parse.
+		client.Put(tag, d)
+		client.PutAndReplicate(tag, d)
+		client.PutAndReplicateTranslated(tag, d, d)
+		client.Get(tag)
+		client.GetStream(tag, ioutil.Discard)
+		client.Has(tag)
+		client.List("prefix")
+		client.ListWithPagination("prefix", ListFilter{})
+		client.ListRepository("repo")
+		client.ListRepositoryWithPagination("repo", ListFilter{})
+		client.Replicate(tag)
+		client.Origin()
+		client.DuplicateReplicate(tag, d, core.DigestList{d}, time.Second, 0)
+		client.DuplicatePut(tag, d, time.Second)
+
+		require.Equal(test.expected, received.Load())
+		require.Equal(test.expected, responses.Load())
+	}
+	require.Zero(missing.Load())
+}
+
+func TestInterceptorsRetryAndAuthenticateCalls(t *testing.T) {
+	require := require.New(t)
+
+	attempts := atomic.NewInt64(0)
+	addr, stop := testutil.StartServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if attempts.Inc() == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+	}))
+	defer stop()
+
+	tokens := atomic.NewInt64(0)
+	client := NewSingleClient(addr, nil, WithInterceptors(
+		AuthInterceptor("Authorization", func() (string, error) {
+			tokens.Inc()
+			return "Bearer secret", nil
+		}),
+		httputil.RetryInterceptor()))
+
+	ok, err := client.Has(core.TagFixture())
+	require.NoError(err)
+	require.True(ok)
+	require.Equal(int64(2), attempts.Load())
+	require.Equal(int64(1), tokens.Load())
+}
+
+func TestAuthInterceptorCredentialsError(t *testing.T) {
+	require := require.New(t)
+
+	addr, stop := testutil.StartServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer stop()
+
+	client := NewSingleClient(addr, nil, WithInterceptors(
+		AuthInterceptor("Authorization", func() (string, error) {
+			return "", errors.New("token expired")
+		})))
+
+	_, err := client.Has(core.TagFixture())
+	require.Error(err)
+}
+
+func TestErrorCodes(t *testing.T) {
+	tag := core.TagFixture()
+
+	tests := []struct {
+		desc     string
+		err      *handler.Error
+		expected error
+	}{
+		{
+			"tag not found",
+			handler.Errorf("tag not found").Status(http.StatusNotFound).Code(tagmodels.ErrCodeTagNotFound),
+			ErrTagNotFound,
+		}, {
+			"namespace not found",
+			handler.Errorf("no matches").Code(tagmodels.ErrCodeNamespaceNotFound),
+			ErrNamespaceNotFound,
+		}, {
+			"backend unavailable",
+			handler.Errorf("timeout").Status(http.StatusGatewayTimeout).Code(tagmodels.ErrCodeBackendUnavailable),
+			ErrBackendUnavailable,
+		}, {
+			"quota exceeded",
+			handler.Errorf("full").Status(http.StatusTooManyRequests).Code(tagmodels.ErrCodeQuotaExceeded),
+			ErrQuotaExceeded,
+		}, {
+			"not found without code",
+			handler.ErrorStatus(http.StatusNotFound),
+			ErrTagNotFound,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			require := require.New(t)
+
+			addr, stop := testutil.StartServer(handler.Wrap(func(http.ResponseWriter, *http.Request) error {
+				return test.err
+			}))
+			defer stop()
+
+			_, err := NewSingleClient(addr, nil).Get(tag)
+			require.Equal(test.expected, err)
+		})
+	}
+}
+
+func TestErrorUnknownCode(t *testing.T) {
+	require := require.New(t)
+
+	addr, stop := testutil.StartServer(handler.Wrap(func(http.ResponseWriter, *http.Request) error {
+		return handler.Errorf("oops").Code("SOMETHING_NEW")
+	}))
+	defer stop()
+
+	_, err := NewSingleClient(addr, nil).List("prefix")
+	require.Error(err)
+	require.True(httputil.IsStatus(err, http.StatusInternalServerError))
+}
+
+func TestOriginServedFromResponseCacheOnNotModified(t *testing.T) {
+	require := require.New(t)
+
+	notModified := atomic.NewInt64(0)
+	addr, stop := testutil.StartServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") != "" {
+			notModified.Inc()
+		}
+		httputil.WriteWithETag(w, r, []byte("some-origin"))
+	}))
+	defer stop()
+
+	cache := httputil.NewResponseCache(httputil.ResponseCacheConfig{}, clock.NewMock())
+	client := NewSingleClient(addr, nil, WithResponseCache(cache))
+
+	for i := 0; i < 2; i++ {
+		origin, err := client.Origin()
+		require.NoError(err)
+		require.Equal("some-origin", origin)
+	}
+	require.Equal(int64(1), notModified.Load())
+}
@@ -0,0 +1,161 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package tagclient
+
+import (
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/uber/kraken/build-index/tagmodels"
+)
+
+// OriginSelectionConfig defines how a Client picks an origin cluster when a
+// tagserver advertises multiple clusters.
+type OriginSelectionConfig struct {
+	Enabled bool `yaml:"enabled"`
+
+	// Region and Zone of the client. Clusters in the same region are preferred,
+	// and within the region, those in the same zone.
+	Region string `yaml:"region"`
+	Zone   string `yaml:"zone"`
+
+	// CacheTTL is how long the selected cluster is cached.
+	CacheTTL time.Duration `yaml:"cache_ttl"`
+
+	// ProbeLatency enables measuring the latency of connecting to each cluster
+	// whenever the cached selection expires. The fastest reachable cluster is
+	// preferred over location labels.
+	ProbeLatency bool          `yaml:"probe_latency"`
+	ProbeTimeout time.Duration `yaml:"probe_timeout"`
+}
+
+func (c OriginSelectionConfig) applyDefaults() OriginSelectionConfig {
+	if c.CacheTTL == 0 {
+		c.CacheTTL = 5 * time.Minute
+	}
+	if c.ProbeTimeout == 0 {
+		c.ProbeTimeout = time.Second
+	}
+	return c
+}
+
+// WithOriginSelection configures a Client to request all origin clusters from
+// the tagserver and select the closest one. Selections are cached per tagserver
+// address, shared by all Clients created with the returned Option.
+func WithOriginSelection(config OriginSelectionConfig) Option {
+	s := newOriginSelector(config)
+	return func(o *clientOptions) { o.originSelector = s }
+}
+
+type originSelection struct {
+	addr    string
+	expires time.Time
+}
+
+type originSelector struct {
+	config OriginSelectionConfig
+
+	mu         sync.Mutex
+	selections map[string]originSelection
+}
+
+func newOriginSelector(config OriginSelectionConfig) *originSelector {
+	return &originSelector{
+		config:     config.applyDefaults(),
+		selections: make(map[string]originSelection),
+	}
+}
+
+// get returns the cached selection for the tagserver at addr, else selects one
+// of the origin clusters returned by fetch.
+func (s *originSelector) get(
+	addr string, fetch func() ([]tagmodels.OriginCluster, error)) (string, error) {
+
+	s.mu.Lock()
+	sel, ok := s.selections[addr]
+	s.mu.Unlock()
+	if ok && time.Now().Before(sel.expires) {
+		return sel.addr, nil
+	}
+
+	clusters, err := fetch()
+	if err != nil {
+		return "", err
+	}
+	origin := s.choose(clusters)
+
+	s.mu.Lock()
+	s.selections[addr] = originSelection{origin, time.Now().Add(s.config.CacheTTL)}
+	s.mu.Unlock()
+
+	return origin, nil
+}
+
+// choose returns the address of the preferred cluster. Clusters must not be
+// empty.
+func (s *originSelector) choose(clusters []tagmodels.OriginCluster) string {
+	ranked := make([]tagmodels.OriginCluster, len(clusters))
+	copy(ranked, clusters)
+
+	// Stable sort keeps the tagserver's order among equally ranked clusters.
+	sort.SliceStable(ranked, func(i, j int) bool {
+		return s.locality(ranked[i]) < s.locality(ranked[j])
+	})
+	if s.config.ProbeLatency {
+		latencies := make([]time.Duration, len(ranked))
+		var wg sync.WaitGroup
+		for i := range ranked {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				latencies[i] = s.probe(ranked[i].Addr)
+			}(i)
+		}
+		wg.Wait()
+		best := -1
+		for i, l := range latencies {
+			if l >= 0 && (best == -1 || l < latencies[best]) {
+				best = i
+			}
+		}
+		if best != -1 {
+			return ranked[best].Addr
+		}
+	}
+	return ranked[0].Addr
+}
+
+// locality ranks c by distance from the client, lower is closer.
+func (s *originSelector) locality(c tagmodels.OriginCluster) int {
+	if s.config.Region == "" || c.Region != s.config.Region {
+		return 2
+	}
+	if s.config.Zone == "" || c.Zone != s.config.Zone {
+		return 1
+	}
+	return 0
+}
+
+// probe returns the time taken to connect to addr, or -1 if addr is unreachable.
+func (s *originSelector) probe(addr string) time.Duration {
+	start := time.Now()
+	conn, err := net.DialTimeout("tcp", addr, s.config.ProbeTimeout)
+	if err != nil {
+		return -1
+	}
+	conn.Close()
+	return time.Since(start)
+}
@@ -0,0 +1,66 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package tagclient
+
+import (
+	"net"
+	"testing"
+
+	"github.com/uber/kraken/build-index/tagmodels"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestOriginSelectorProbePrefersReachableCluster(t *testing.T) {
+	require := require.New(t)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(err)
+	defer l.Close()
+
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(err)
+	closed.Close()
+
+	clusters := []tagmodels.OriginCluster{
+		{Addr: closed.Addr().String(), Region: "east"},
+		{Addr: l.Addr().String(), Region: "west"},
+	}
+
+	// Without probes, the cluster in the local region is preferred even though
+	// it is unreachable.
+	s := newOriginSelector(OriginSelectionConfig{Region: "east"})
+	require.Equal(closed.Addr().String(), s.choose(clusters))
+
+	s = newOriginSelector(OriginSelectionConfig{Region: "east", ProbeLatency: true})
+	require.Equal(l.Addr().String(), s.choose(clusters))
+}
+
+func TestOriginSelectorCachesSelection(t *testing.T) {
+	require := require.New(t)
+
+	s := newOriginSelector(OriginSelectionConfig{Region: "east"})
+
+	var fetches int
+	fetch := func() ([]tagmodels.OriginCluster, error) {
+		fetches++
+		return []tagmodels.OriginCluster{{Addr: "origin:80", Region: "east"}}, nil
+	}
+	for i := 0; i < 3; i++ {
+		origin, err := s.get("tagserver:80", fetch)
+		require.NoError(err)
+		require.Equal("origin:80", origin)
+	}
+	require.Equal(1, fetches)
+}
@@ -0,0 +1,141 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package tagclient
+
+import (
+	"crypto/tls"
+	"net/http"
+	"sync"
+	"time"
+
+	"go.uber.org/atomic"
+)
+
+// PoolConfig defines connection pooling for Clients created by a PooledProvider.
+type PoolConfig struct {
+	Enabled bool `yaml:"enabled"`
+
+	// MaxIdleConnsPerAddr bounds the idle connections kept open to each address.
+	MaxIdleConnsPerAddr int `yaml:"max_idle_conns_per_addr"`
+
+	// IdleConnTimeout closes connections which have been idle for longer.
+	IdleConnTimeout time.Duration `yaml:"idle_conn_timeout"`
+
+	// MaxFailures is the number of consecutive transport errors to an address
+	// after which its idle connections are recycled.
+	MaxFailures int `yaml:"max_failures"`
+}
+
+func (c PoolConfig) applyDefaults() PoolConfig {
+	if c.MaxIdleConnsPerAddr == 0 {
+		c.MaxIdleConnsPerAddr = 16
+	}
+	if c.IdleConnTimeout == 0 {
+		c.IdleConnTimeout = 90 * time.Second
+	}
+	if c.MaxFailures == 0 {
+		c.MaxFailures = 3
+	}
+	return c
+}
+
+// WithTransport configures a Client to send requests over transport instead of
+// a fresh transport per request.
+func WithTransport(transport http.RoundTripper) Option {
+	return func(o *clientOptions) { o.transport = transport }
+}
+
+// PooledProvider is a Provider which reuses a single Client per address, whose
+// requests share a pool of connections. This avoids a TLS handshake per
+// request when repeatedly talking to the same addresses.
+type PooledProvider struct {
+	config PoolConfig
+	tls    *tls.Config
+	opts   []Option
+
+	mu      sync.Mutex
+	clients map[string]*pooledClient
+}
+
+type pooledClient struct {
+	Client
+	transport *recyclingTransport
+}
+
+// NewPooledProvider creates a new PooledProvider.
+func NewPooledProvider(config PoolConfig, tls *tls.Config, opts ...Option) *PooledProvider {
+	return &PooledProvider{
+		config:  config.applyDefaults(),
+		tls:     tls,
+		opts:    opts,
+		clients: make(map[string]*pooledClient),
+	}
+}
+
+// Provide returns the pooled Client of addr.
+func (p *PooledProvider) Provide(addr string) Client {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	c, ok := p.clients[addr]
+	if !ok {
+		t := &recyclingTransport{
+			transport: &http.Transport{
+				Proxy:               http.ProxyFromEnvironment,
+				TLSClientConfig:     p.tls,
+				MaxIdleConnsPerHost: p.config.MaxIdleConnsPerAddr,
+				IdleConnTimeout:     p.config.IdleConnTimeout,
+			},
+			maxFailures: int32(p.config.MaxFailures),
+			failures:    atomic.NewInt32(0),
+		}
+		opts := append(append([]Option{}, p.opts...), WithTransport(t))
+		c = &pooledClient{NewSingleClient(addr, p.tls, opts...), t}
+		p.clients[addr] = c
+	}
+	return c
+}
+
+// Close tears down all pooled Clients, e.g. when the addresses they talk to
+// are reconfigured. Subsequent calls to Provide create new Clients.
+func (p *PooledProvider) Close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for addr, c := range p.clients {
+		c.transport.transport.CloseIdleConnections()
+		delete(p.clients, addr)
+	}
+}
+
+// recyclingTransport closes idle connections once requests fail repeatedly, such
+// that connections to an unhealthy address are not reused.
+type recyclingTransport struct {
+	transport   *http.Transport
+	maxFailures int32
+	failures    *atomic.Int32
+}
+
+func (t *recyclingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.transport.RoundTrip(req)
+	if err != nil {
+		if t.failures.Inc() >= t.maxFailures {
+			t.failures.Store(0)
+			t.transport.CloseIdleConnections()
+		}
+		return nil, err
+	}
+	t.failures.Store(0)
+	return resp, nil
+}
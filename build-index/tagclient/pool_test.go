@@ -0,0 +1,110 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package tagclient
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/uber/kraken/core"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/atomic"
+)
+
+// startTLSServer starts a TLS tagserver stub which counts the connections it
+// accepts.
+func startTLSServer() (s *httptest.Server, conns *atomic.Int64) {
+	conns = atomic.NewInt64(0)
+	s = httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	s.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			conns.Inc()
+		}
+	}
+	s.StartTLS()
+	return s, conns
+}
+
+func TestPooledProviderReusesConnectionsAcrossTasks(t *testing.T) {
+	require := require.New(t)
+
+	s, conns := startTLSServer()
+	defer s.Close()
+
+	tls := s.Client().Transport.(*http.Transport).TLSClientConfig
+	addr := s.Listener.Addr().String()
+
+	p := NewPooledProvider(PoolConfig{}, tls)
+	defer p.Close()
+
+	// Each task provides its own client of the remote.
+	for i := 0; i < 5; i++ {
+		ok, err := p.Provide(addr).Has(core.TagFixture())
+		require.NoError(err)
+		require.True(ok)
+	}
+	require.Equal(int64(1), conns.Load())
+
+	// Torn down clients do not reuse connections.
+	p.Close()
+	_, err := p.Provide(addr).Has(core.TagFixture())
+	require.NoError(err)
+	require.Equal(int64(2), conns.Load())
+}
+
+func TestProviderCreatesConnectionPerTask(t *testing.T) {
+	require := require.New(t)
+
+	s, conns := startTLSServer()
+	defer s.Close()
+
+	tls := s.Client().Transport.(*http.Transport).TLSClientConfig
+	addr := s.Listener.Addr().String()
+
+	p := NewProvider(tls)
+
+	for i := 0; i < 5; i++ {
+		_, err := p.Provide(addr).Has(core.TagFixture())
+		require.NoError(err)
+	}
+	require.Equal(int64(5), conns.Load())
+}
+
+func BenchmarkProviderSequentialTasks(b *testing.B) {
+	s, _ := startTLSServer()
+	defer s.Close()
+
+	tls := s.Client().Transport.(*http.Transport).TLSClientConfig
+	addr := s.Listener.Addr().String()
+	tag := core.TagFixture()
+
+	for _, bench := range []struct {
+		desc     string
+		provider Provider
+	}{
+		{"unpooled", NewProvider(tls)},
+		{"pooled", NewPooledProvider(PoolConfig{}, tls)},
+	} {
+		b.Run(bench.desc, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := bench.provider.Provide(addr).Has(tag); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
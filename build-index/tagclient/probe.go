@@ -0,0 +1,289 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package tagclient
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/uber/kraken/build-index/tagmodels"
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/healthcheck"
+	"github.com/uber/kraken/utils/log"
+
+	"github.com/andres-erbsen/clock"
+)
+
+// ErrUnhealthy is returned by Clients of addresses which failed health probes.
+var ErrUnhealthy = errors.New("build-index is unhealthy")
+
+// ProbeConfig defines active health probing of addresses by a ProbingProvider.
+// Addresses are marked unhealthy after Fails consecutive failed probes, after
+// which they are probed with exponential backoff until a probe succeeds.
+type ProbeConfig struct {
+	Enabled bool `yaml:"enabled"`
+
+	// Interval is the interval at which healthy addresses are probed.
+	Interval time.Duration `yaml:"interval"`
+
+	// Timeout bounds each probe.
+	Timeout time.Duration `yaml:"timeout"`
+
+	// Fails is the number of consecutive failed probes after which an address
+	// is marked unhealthy.
+	Fails int `yaml:"fails"`
+
+	// MaxBackoff bounds the interval at which unhealthy addresses are probed,
+	// which doubles after every failed probe.
+	MaxBackoff time.Duration `yaml:"max_backoff"`
+}
+
+func (c ProbeConfig) applyDefaults() ProbeConfig {
+	if c.Interval == 0 {
+		c.Interval = 10 * time.Second
+	}
+	if c.Timeout == 0 {
+		c.Timeout = 3 * time.Second
+	}
+	if c.Fails == 0 {
+		c.Fails = 3
+	}
+	if c.MaxBackoff == 0 {
+		c.MaxBackoff = 5 * time.Minute
+	}
+	if c.MaxBackoff < c.Interval {
+		c.MaxBackoff = c.Interval
+	}
+	return c
+}
+
+// _probeTick is the granularity at which probes are scheduled.
+const _probeTick = time.Second
+
+type addrHealth struct {
+	failures  int
+	unhealthy bool
+	backoff   time.Duration
+	nextProbe time.Time
+}
+
+// ProbingProvider is a Provider which actively probes the health of the
+// addresses it provides Clients for. Clients of unhealthy addresses fail with
+// ErrUnhealthy without issuing requests, such that callers do not repeatedly
+// wait on dead addresses.
+type ProbingProvider struct {
+	config   ProbeConfig
+	clk      clock.Clock
+	provider Provider
+	checker  healthcheck.Checker
+
+	mu    sync.Mutex
+	addrs map[string]*addrHealth
+
+	stop chan struct{}
+}
+
+func newProbingProvider(
+	config ProbeConfig,
+	clk clock.Clock,
+	provider Provider,
+	checker healthcheck.Checker) *ProbingProvider {
+
+	return &ProbingProvider{
+		config:   config.applyDefaults(),
+		clk:      clk,
+		provider: provider,
+		checker:  checker,
+		addrs:    make(map[string]*addrHealth),
+		stop:     make(chan struct{}),
+	}
+}
+
+// NewProbingProvider creates a ProbingProvider which wraps provider and probes
+// addresses with checker in the background until stopped. Addresses are
+// probed once they are first provided.
+func NewProbingProvider(
+	config ProbeConfig,
+	clk clock.Clock,
+	provider Provider,
+	checker healthcheck.Checker) *ProbingProvider {
+
+	p := newProbingProvider(config, clk, provider, checker)
+	go p.loop()
+	return p
+}
+
+// Provide returns the Client of addr, or a Client which fails with
+// ErrUnhealthy if addr is unhealthy.
+func (p *ProbingProvider) Provide(addr string) Client {
+	p.mu.Lock()
+	h, ok := p.addrs[addr]
+	if !ok {
+		// Assumed healthy until probed.
+		h = &addrHealth{nextProbe: p.clk.Now()}
+		p.addrs[addr] = h
+	}
+	unhealthy := h.unhealthy
+	p.mu.Unlock()
+
+	if unhealthy {
+		return unhealthyClient{}
+	}
+	return p.provider.Provide(addr)
+}
+
+// Stop stops probing.
+func (p *ProbingProvider) Stop() {
+	close(p.stop)
+}
+
+func (p *ProbingProvider) loop() {
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-p.clk.After(_probeTick):
+			p.probe()
+		}
+	}
+}
+
+// probe probes all addresses which are due.
+func (p *ProbingProvider) probe() {
+	now := p.clk.Now()
+	var due []string
+	p.mu.Lock()
+	for addr, h := range p.addrs {
+		if !now.Before(h.nextProbe) {
+			due = append(due, addr)
+		}
+	}
+	p.mu.Unlock()
+
+	for _, addr := range due {
+		ctx, cancel := context.WithTimeout(context.Background(), p.config.Timeout)
+		err := p.checker.Check(ctx, addr)
+		cancel()
+		p.record(addr, err)
+	}
+}
+
+func (p *ProbingProvider) record(addr string, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	h := p.addrs[addr]
+	now := p.clk.Now()
+	if err == nil {
+		if h.unhealthy {
+			log.With("addr", addr).Info("Build-index is healthy again")
+		}
+		*h = addrHealth{nextProbe: now.Add(p.config.Interval)}
+		return
+	}
+	h.failures++
+	if !h.unhealthy {
+		if h.failures < p.config.Fails {
+			h.nextProbe = now.Add(p.config.Interval)
+			return
+		}
+		log.With("addr", addr).Infof("Marking build-index unhealthy: %s", err)
+		h.unhealthy = true
+		h.backoff = p.config.Interval
+	} else {
+		h.backoff *= 2
+		if h.backoff > p.config.MaxBackoff {
+			h.backoff = p.config.MaxBackoff
+		}
+	}
+	h.nextProbe = now.Add(h.backoff)
+}
+
+// unhealthyClient fails all operations with ErrUnhealthy.
+type unhealthyClient struct{}
+
+var _ Client = unhealthyClient{}
+
+func (unhealthyClient) Put(string, core.Digest) error { return ErrUnhealthy }
+
+func (unhealthyClient) PutAndReplicate(string, core.Digest) error { return ErrUnhealthy }
+
+func (unhealthyClient) PutAndReplicateTranslated(string, core.Digest, core.Digest) error {
+	return ErrUnhealthy
+}
+
+func (unhealthyClient) PutAndReplicateWithOptions(
+	string, core.Digest, PutAndReplicateOptions) error {
+
+	return ErrUnhealthy
+}
+
+func (unhealthyClient) Get(string) (core.Digest, error) { return core.Digest{}, ErrUnhealthy }
+
+func (unhealthyClient) GetStream(string, io.Writer) error { return ErrUnhealthy }
+
+func (unhealthyClient) Has(string) (bool, error) { return false, ErrUnhealthy }
+
+func (unhealthyClient) Delete(string) error { return ErrUnhealthy }
+
+func (unhealthyClient) Undelete(string) error { return ErrUnhealthy }
+
+func (unhealthyClient) List(string) ([]string, error) { return nil, ErrUnhealthy }
+
+func (unhealthyClient) ListWithPagination(string, ListFilter) (tagmodels.ListResponse, error) {
+	return tagmodels.ListResponse{}, ErrUnhealthy
+}
+
+func (unhealthyClient) ListRepository(string) ([]string, error) { return nil, ErrUnhealthy }
+
+func (unhealthyClient) ListRepositoryWithPagination(
+	string, ListFilter) (tagmodels.ListResponse, error) {
+
+	return tagmodels.ListResponse{}, ErrUnhealthy
+}
+
+func (unhealthyClient) Replicate(string, ...string) error { return ErrUnhealthy }
+
+func (unhealthyClient) ReplicateTo(string, ...string) error { return ErrUnhealthy }
+
+func (unhealthyClient) ReplicateWithDependencies(string, core.DigestList, ...string) error {
+	return ErrUnhealthy
+}
+
+func (unhealthyClient) ReplicateWithCallback(string, core.DigestList, string, ...string) error {
+	return ErrUnhealthy
+}
+
+func (unhealthyClient) ReplicateBatch([]string, bool) error { return ErrUnhealthy }
+
+func (unhealthyClient) ReplicaRemotes(string) ([]string, error) { return nil, ErrUnhealthy }
+
+func (unhealthyClient) Origin() (string, error) { return "", ErrUnhealthy }
+
+func (unhealthyClient) DuplicateReplicate(
+	string, core.Digest, core.DigestList, time.Duration, int, ...string) error {
+
+	return ErrUnhealthy
+}
+
+func (unhealthyClient) DuplicatePut(string, core.Digest, time.Duration) error {
+	return ErrUnhealthy
+}
+
+func (unhealthyClient) DuplicatePauseRemote(string, bool) error { return ErrUnhealthy }
+
+func (unhealthyClient) InvalidateCache(string) error { return ErrUnhealthy }
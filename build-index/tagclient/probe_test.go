@@ -0,0 +1,112 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package tagclient
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/uber/kraken/mocks/lib/healthcheck"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProbingProviderBacksOffAndRestoresFailingAddr(t *testing.T) {
+	require := require.New(t)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	addr := "build-index:80"
+	clk := clock.NewMock()
+	checker := mockhealthcheck.NewMockChecker(ctrl)
+
+	provider := NewTestProvider()
+	provider.Register(addr, NewSingleClient(addr, nil))
+
+	p := newProbingProvider(ProbeConfig{
+		Interval:   10 * time.Second,
+		Fails:      3,
+		MaxBackoff: 80 * time.Second,
+	}, clk, provider, checker)
+
+	start := clk.Now()
+	var probes []time.Duration
+	healthy := false
+	checker.EXPECT().Check(gomock.Any(), addr).DoAndReturn(
+		func(context.Context, string) error {
+			probes = append(probes, clk.Now().Sub(start))
+			if healthy {
+				return nil
+			}
+			return errors.New("connection refused")
+		}).AnyTimes()
+
+	require.NotEqual(unhealthyClient{}, p.Provide(addr))
+
+	advance := func(d time.Duration) {
+		for i := 0; i < int(d/time.Second); i++ {
+			p.probe()
+			clk.Add(time.Second)
+		}
+	}
+	advance(251 * time.Second)
+
+	// Probed at the regular interval until deemed unhealthy after 3 failures,
+	// then with doubling intervals up to the maximum backoff.
+	require.Equal([]time.Duration{
+		0,
+		10 * time.Second,
+		20 * time.Second,
+		30 * time.Second,
+		50 * time.Second,
+		90 * time.Second,
+		170 * time.Second,
+		250 * time.Second,
+	}, probes)
+
+	_, err := p.Provide(addr).Get("tag")
+	require.Equal(ErrUnhealthy, err)
+
+	healthy = true
+	advance(80 * time.Second)
+
+	require.Len(probes, 9)
+	require.Equal(NewSingleClient(addr, nil), p.Provide(addr))
+}
+
+func TestProbingProviderProvidesHealthyAddr(t *testing.T) {
+	require := require.New(t)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	addr := "build-index:80"
+	checker := mockhealthcheck.NewMockChecker(ctrl)
+	checker.EXPECT().Check(gomock.Any(), addr).Return(nil)
+
+	provider := NewTestProvider()
+	c := NewSingleClient(addr, nil)
+	provider.Register(addr, c)
+
+	p := newProbingProvider(ProbeConfig{}, clock.NewMock(), provider, checker)
+
+	require.Equal(c, p.Provide(addr))
+	p.probe()
+	require.Equal(c, p.Provide(addr))
+}
@@ -22,11 +22,14 @@ type Provider interface {
 	Provide(addr string) Client
 }
 
-type provider struct{ tls *tls.Config }
+type provider struct {
+	tls  *tls.Config
+	opts []Option
+}
 
 // NewProvider creates a Provider which wraps NewSingleClient.
-func NewProvider(config *tls.Config) Provider { return provider{config} }
+func NewProvider(config *tls.Config, opts ...Option) Provider { return provider{config, opts} }
 
 func (p provider) Provide(addr string) Client {
-	return NewSingleClient(addr, p.tls)
+	return NewSingleClient(addr, p.tls, p.opts...)
 }
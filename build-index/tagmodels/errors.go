@@ -0,0 +1,27 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package tagmodels
+
+// Machine-readable codes of tagserver error responses.
+const (
+	ErrCodeTagNotFound        = "TAG_NOT_FOUND"
+	ErrCodeNamespaceNotFound  = "NAMESPACE_NOT_FOUND"
+	ErrCodeBackendUnavailable = "BACKEND_UNAVAILABLE"
+	ErrCodeQuotaExceeded      = "QUOTA_EXCEEDED"
+	ErrCodeTagValueTooLarge   = "TAG_VALUE_TOO_LARGE"
+	ErrCodeReadOnly           = "READ_ONLY"
+	ErrCodeInvalidTagName     = "INVALID_TAG_NAME"
+	ErrCodeRateLimited        = "RATE_LIMITED"
+	ErrCodeBacklogFull        = "REPLICATION_BACKLOG_FULL"
+)
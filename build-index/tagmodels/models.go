@@ -21,8 +21,9 @@ import (
 
 const (
 	// Filters.
-	LimitQ  string = "limit"
-	OffsetQ string = "offset"
+	LimitQ         string = "limit"
+	OffsetQ        string = "offset"
+	ModifiedSinceQ string = "modified_since"
 )
 
 // List Response with pagination. Models tagserver reponse to list and
@@ -57,3 +58,30 @@ func (resp ListResponse) GetOffset() (string, error) {
 	}
 	return offset, nil
 }
+
+// OriginCluster describes the location of an origin cluster.
+type OriginCluster struct {
+	Addr   string `json:"addr" yaml:"addr"`
+	Region string `json:"region" yaml:"region"`
+	Zone   string `json:"zone,omitempty" yaml:"zone"`
+}
+
+// OriginResponse models tagserver response to origin requests which accept
+// JSON. Clusters are listed in the tagserver's order of preference.
+type OriginResponse struct {
+	Clusters []OriginCluster `json:"clusters"`
+}
+
+// PullableOriginsResponse models tagserver response to digest-specific origin
+// requests. Origins are listed in order of preference. If BackendFetch is set,
+// no origin has the blob yet and pulls will be served from the backend.
+type PullableOriginsResponse struct {
+	Origins      []string `json:"origins"`
+	BackendFetch bool     `json:"backend_fetch"`
+}
+
+// ReplicaRemotesResponse models tagserver response to replica remotes requests.
+// Remotes are listed in lexical order.
+type ReplicaRemotesResponse struct {
+	Remotes []string `json:"remotes"`
+}
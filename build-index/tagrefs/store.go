@@ -0,0 +1,235 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package tagrefs
+
+import (
+	"fmt"
+
+	"github.com/uber/kraken/core"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Store durably counts the tags which reference each blob. A blob is only
+// eligible for garbage collection once no tag references it.
+//
+// The dependencies of each tag are stored alongside the counts, such that
+// overwriting or deleting a tag releases exactly the references it held.
+type Store struct {
+	db *sqlx.DB
+}
+
+// NewStore creates a new Store.
+func NewStore(db *sqlx.DB) *Store {
+	return &Store{db}
+}
+
+// Put sets the dependencies of tag to deps, replacing the dependencies of any
+// previous digest of tag. Returns the blobs which are no longer referenced by
+// any tag as a result.
+func (s *Store) Put(tag string, deps core.DigestList) ([]core.Digest, error) {
+	var released []core.Digest
+	err := s.transact(func(tx *sqlx.Tx) error {
+		prev, err := getDependencies(tx, tag)
+		if err != nil {
+			return fmt.Errorf("get dependencies: %s", err)
+		}
+		deps = unique(deps)
+		if _, err := tx.Exec(`
+			INSERT OR REPLACE INTO tag_reference (tag, dependencies)
+			VALUES (?, ?)`, tag, deps); err != nil {
+			return fmt.Errorf("insert tag: %s", err)
+		}
+		released, err = adjust(tx, prev, deps)
+		return err
+	})
+	return released, err
+}
+
+// Delete drops the dependencies of tag. Returns the blobs which are no longer
+// referenced by any tag as a result.
+func (s *Store) Delete(tag string) ([]core.Digest, error) {
+	var released []core.Digest
+	err := s.transact(func(tx *sqlx.Tx) error {
+		prev, err := getDependencies(tx, tag)
+		if err != nil {
+			return fmt.Errorf("get dependencies: %s", err)
+		}
+		if _, err := tx.Exec(`DELETE FROM tag_reference WHERE tag=?`, tag); err != nil {
+			return fmt.Errorf("delete tag: %s", err)
+		}
+		released, err = adjust(tx, prev, nil)
+		return err
+	})
+	return released, err
+}
+
+// Count returns the number of tags which reference d.
+func (s *Store) Count(d core.Digest) (int, error) {
+	return getCount(s.db, d)
+}
+
+// Reconcile corrects drift between the stored counts and a full scan of tags.
+// The dependencies of all tags starting with prefix are replaced by tags, which
+// maps every existing tag starting with prefix to its dependencies. Counts are
+// then recomputed from the dependencies of all tags. Returns the number of
+// blobs whose counts were corrected.
+func (s *Store) Reconcile(prefix string, tags map[string]core.DigestList) (int, error) {
+	var corrected int
+	err := s.transact(func(tx *sqlx.Tx) error {
+		if _, err := tx.Exec(`
+			DELETE FROM tag_reference
+			WHERE substr(tag, 1, ?)=?`, len(prefix), prefix); err != nil {
+			return fmt.Errorf("delete tags: %s", err)
+		}
+		for tag, deps := range tags {
+			if _, err := tx.Exec(`
+				INSERT OR REPLACE INTO tag_reference (tag, dependencies)
+				VALUES (?, ?)`, tag, unique(deps)); err != nil {
+				return fmt.Errorf("insert tag: %s", err)
+			}
+		}
+
+		var refs []core.DigestList
+		if err := tx.Select(&refs, `SELECT dependencies FROM tag_reference`); err != nil {
+			return fmt.Errorf("select tags: %s", err)
+		}
+		expected := make(map[core.Digest]int)
+		for _, deps := range refs {
+			for _, d := range deps {
+				expected[d]++
+			}
+		}
+
+		var counts []struct {
+			Digest core.Digest `db:"digest"`
+			Count  int         `db:"count"`
+		}
+		if err := tx.Select(&counts, `SELECT digest, count FROM blob_reference`); err != nil {
+			return fmt.Errorf("select counts: %s", err)
+		}
+		actual := make(map[core.Digest]int)
+		for _, c := range counts {
+			actual[c.Digest] = c.Count
+		}
+
+		for d := range actual {
+			if _, ok := expected[d]; !ok {
+				expected[d] = 0
+			}
+		}
+		for d, n := range expected {
+			if actual[d] == n {
+				continue
+			}
+			corrected++
+			if err := setCount(tx, d, n); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return corrected, err
+}
+
+func (s *Store) transact(f func(*sqlx.Tx) error) error {
+	tx, err := s.db.Beginx()
+	if err != nil {
+		return fmt.Errorf("begin: %s", err)
+	}
+	if err := f(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func getDependencies(tx *sqlx.Tx, tag string) (core.DigestList, error) {
+	var deps []core.DigestList
+	if err := tx.Select(&deps, `SELECT dependencies FROM tag_reference WHERE tag=?`, tag); err != nil {
+		return nil, err
+	}
+	if len(deps) == 0 {
+		return nil, nil
+	}
+	return deps[0], nil
+}
+
+func getCount(q sqlx.Queryer, d core.Digest) (int, error) {
+	var counts []int
+	if err := sqlx.Select(q, &counts, `SELECT count FROM blob_reference WHERE digest=?`, d); err != nil {
+		return 0, err
+	}
+	if len(counts) == 0 {
+		return 0, nil
+	}
+	return counts[0], nil
+}
+
+// setCount sets the count of d to n. Blobs without references are not stored.
+func setCount(tx *sqlx.Tx, d core.Digest, n int) error {
+	if n <= 0 {
+		if _, err := tx.Exec(`DELETE FROM blob_reference WHERE digest=?`, d); err != nil {
+			return fmt.Errorf("delete count: %s", err)
+		}
+		return nil
+	}
+	if _, err := tx.Exec(`
+		INSERT OR REPLACE INTO blob_reference (digest, count)
+		VALUES (?, ?)`, d, n); err != nil {
+		return fmt.Errorf("set count: %s", err)
+	}
+	return nil
+}
+
+// adjust moves references from the blobs in prev to the blobs in next, and
+// returns the blobs of prev which are no longer referenced.
+func adjust(tx *sqlx.Tx, prev, next core.DigestList) ([]core.Digest, error) {
+	delta := make(map[core.Digest]int)
+	for _, d := range prev {
+		delta[d]--
+	}
+	for _, d := range next {
+		delta[d]++
+	}
+	var released []core.Digest
+	for d, change := range delta {
+		if change == 0 {
+			continue
+		}
+		n, err := getCount(tx, d)
+		if err != nil {
+			return nil, fmt.Errorf("get count: %s", err)
+		}
+		if err := setCount(tx, d, n+change); err != nil {
+			return nil, err
+		}
+		if change < 0 && n+change <= 0 {
+			released = append(released, d)
+		}
+	}
+	return released, nil
+}
+
+func unique(deps core.DigestList) core.DigestList {
+	seen := make(map[core.Digest]bool)
+	var result core.DigestList
+	for _, d := range deps {
+		if !seen[d] {
+			seen[d] = true
+			result = append(result, d)
+		}
+	}
+	return result
+}
@@ -0,0 +1,143 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package tagrefs
+
+import (
+	"testing"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/localdb"
+
+	"github.com/stretchr/testify/require"
+)
+
+func requireCounts(t *testing.T, s *Store, expected map[core.Digest]int) {
+	t.Helper()
+
+	for d, n := range expected {
+		count, err := s.Count(d)
+		require.NoError(t, err)
+		require.Equal(t, n, count, "count of %s", d)
+	}
+}
+
+func TestStoreCountsSharedBlobsAcrossTags(t *testing.T) {
+	require := require.New(t)
+
+	db, cleanup := localdb.Fixture()
+	defer cleanup()
+
+	s := NewStore(db)
+
+	shared := core.DigestFixture()
+	a := core.DigestFixture()
+	b := core.DigestFixture()
+
+	released, err := s.Put("repo:a", core.DigestList{shared, a})
+	require.NoError(err)
+	require.Empty(released)
+
+	released, err = s.Put("repo:b", core.DigestList{shared, b, b})
+	require.NoError(err)
+	require.Empty(released)
+
+	requireCounts(t, s, map[core.Digest]int{shared: 2, a: 1, b: 1})
+
+	// Deleting one tag keeps the shared blob referenced.
+	released, err = s.Delete("repo:a")
+	require.NoError(err)
+	require.Equal([]core.Digest{a}, released)
+	requireCounts(t, s, map[core.Digest]int{shared: 1, a: 0, b: 1})
+
+	// Deleting an unknown tag changes nothing.
+	released, err = s.Delete("repo:a")
+	require.NoError(err)
+	require.Empty(released)
+
+	released, err = s.Delete("repo:b")
+	require.NoError(err)
+	require.ElementsMatch([]core.Digest{shared, b}, released)
+	requireCounts(t, s, map[core.Digest]int{shared: 0, a: 0, b: 0})
+}
+
+func TestStoreOverwriteReleasesPreviousDependencies(t *testing.T) {
+	require := require.New(t)
+
+	db, cleanup := localdb.Fixture()
+	defer cleanup()
+
+	s := NewStore(db)
+
+	base := core.DigestFixture()
+	v1 := core.DigestFixture()
+	v2 := core.DigestFixture()
+
+	_, err := s.Put("repo:latest", core.DigestList{base, v1})
+	require.NoError(err)
+
+	released, err := s.Put("repo:latest", core.DigestList{base, v2})
+	require.NoError(err)
+	require.Equal([]core.Digest{v1}, released)
+
+	requireCounts(t, s, map[core.Digest]int{base: 1, v1: 0, v2: 1})
+}
+
+func TestStoreReconcileCorrectsDrift(t *testing.T) {
+	require := require.New(t)
+
+	db, cleanup := localdb.Fixture()
+	defer cleanup()
+
+	s := NewStore(db)
+
+	shared := core.DigestFixture()
+	a := core.DigestFixture()
+	b := core.DigestFixture()
+	other := core.DigestFixture()
+
+	_, err := s.Put("repo:a", core.DigestList{shared, a})
+	require.NoError(err)
+	_, err = s.Put("repo:stale", core.DigestList{shared})
+	require.NoError(err)
+	_, err = s.Put("other:a", core.DigestList{other})
+	require.NoError(err)
+
+	// Drift the count of a blob, e.g. after a missed update.
+	_, err = db.Exec(`UPDATE blob_reference SET count=5 WHERE digest=?`, a)
+	require.NoError(err)
+
+	// The scan finds that repo:stale was deleted and repo:b was added elsewhere.
+	corrected, err := s.Reconcile("repo:", map[string]core.DigestList{
+		"repo:a": {shared, a},
+		"repo:b": {shared, b},
+	})
+	require.NoError(err)
+	require.Equal(2, corrected)
+
+	// Tags outside of the prefix are untouched.
+	requireCounts(t, s, map[core.Digest]int{shared: 2, a: 1, b: 1, other: 1})
+
+	// Reconciling again finds nothing to correct.
+	corrected, err = s.Reconcile("repo:", map[string]core.DigestList{
+		"repo:a": {shared, a},
+		"repo:b": {shared, b},
+	})
+	require.NoError(err)
+	require.Equal(0, corrected)
+
+	// Later updates apply against the reconciled dependencies.
+	released, err := s.Delete("repo:b")
+	require.NoError(err)
+	require.Equal([]core.Digest{b}, released)
+}
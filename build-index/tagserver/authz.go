@@ -0,0 +1,284 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package tagserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/uber/kraken/utils/handler"
+	"github.com/uber/kraken/utils/httputil"
+	"github.com/uber/kraken/utils/log"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/uber-go/tally"
+)
+
+// Operations which requests are authorized for.
+const (
+	opRead      = "read"
+	opWrite     = "write"
+	opReplicate = "replicate"
+)
+
+// Authorizer decides whether principal may perform operation on namespace,
+// where namespace is the repository of the tags operated on.
+type Authorizer interface {
+	Authorize(principal, operation, namespace string) (bool, error)
+}
+
+// AuthzConfig defines authorization of tagserver requests. Internal endpoints,
+// which are only called by other build-index instances, are not authorized.
+type AuthzConfig struct {
+	Enabled bool `yaml:"enabled"`
+
+	// PrincipalHeader, if set, is the request header identifying the principal
+	// of requests without client certificates, e.g. "X-Kraken-Principal". Since
+	// clients may set any header, it must only be set if every request passes
+	// through a proxy which terminates TLS and overwrites the header. The common
+	// name of the client certificate always takes precedence.
+	PrincipalHeader string `yaml:"principal_header"`
+
+	// If Policy is configured, decisions are made by an external policy
+	// service. Otherwise, Static rules apply.
+	Static StaticAuthzConfig `yaml:"static"`
+	Policy PolicyAuthzConfig `yaml:"policy"`
+}
+
+func (c AuthzConfig) applyDefaults() AuthzConfig {
+	c.Policy = c.Policy.applyDefaults()
+	return c
+}
+
+func newAuthorizer(config AuthzConfig, clk clock.Clock, stats tally.Scope) Authorizer {
+	if config.Policy.Addr != "" {
+		return newPolicyAuthorizer(config.Policy, clk, stats)
+	}
+	return staticAuthorizer(config.Static)
+}
+
+// StaticAuthzConfig grants operations through a fixed list of rules. Requests
+// which match no rule are denied.
+type StaticAuthzConfig struct {
+	Rules []AuthzRule `yaml:"rules"`
+}
+
+// AuthzRule allows Principal to perform Operations on namespaces which start
+// with Namespace. A Principal of "*" matches any principal.
+type AuthzRule struct {
+	Principal  string   `yaml:"principal"`
+	Namespace  string   `yaml:"namespace"`
+	Operations []string `yaml:"operations"`
+}
+
+type staticAuthorizer StaticAuthzConfig
+
+func (a staticAuthorizer) Authorize(principal, operation, namespace string) (bool, error) {
+	for _, rule := range a.Rules {
+		if rule.Principal != "*" && rule.Principal != principal {
+			continue
+		}
+		if !strings.HasPrefix(namespace, rule.Namespace) {
+			continue
+		}
+		for _, op := range rule.Operations {
+			if op == operation {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// PolicyAuthzConfig defines an external policy service, which is sent a
+// PolicyRequest as a JSON POST, and must respond with a PolicyDecision.
+type PolicyAuthzConfig struct {
+	Addr    string        `yaml:"addr"`
+	Timeout time.Duration `yaml:"timeout"`
+
+	// Decisions are cached for CacheTTL, up to CacheSize decisions.
+	CacheTTL  time.Duration `yaml:"cache_ttl"`
+	CacheSize int           `yaml:"cache_size"`
+
+	// FailOpen allows requests when the policy service is unavailable. By
+	// default, such requests are rejected with 503.
+	FailOpen bool `yaml:"fail_open"`
+}
+
+func (c PolicyAuthzConfig) applyDefaults() PolicyAuthzConfig {
+	if c.Timeout == 0 {
+		c.Timeout = time.Second
+	}
+	if c.CacheTTL == 0 {
+		c.CacheTTL = 30 * time.Second
+	}
+	if c.CacheSize == 0 {
+		c.CacheSize = 10000
+	}
+	return c
+}
+
+// PolicyRequest is the body of requests to the policy service.
+type PolicyRequest struct {
+	Principal string `json:"principal"`
+	Operation string `json:"operation"`
+	Namespace string `json:"namespace"`
+}
+
+// PolicyDecision is the body of responses from the policy service.
+type PolicyDecision struct {
+	Allow bool `json:"allow"`
+}
+
+type cachedDecision struct {
+	allow   bool
+	expires time.Time
+}
+
+type policyAuthorizer struct {
+	config PolicyAuthzConfig
+	clk    clock.Clock
+	stats  tally.Scope
+
+	mu    sync.Mutex
+	cache map[PolicyRequest]cachedDecision
+}
+
+func newPolicyAuthorizer(
+	config PolicyAuthzConfig, clk clock.Clock, stats tally.Scope) *policyAuthorizer {
+
+	return &policyAuthorizer{
+		config: config.applyDefaults(),
+		clk:    clk,
+		stats:  stats,
+		cache:  make(map[PolicyRequest]cachedDecision),
+	}
+}
+
+func (a *policyAuthorizer) Authorize(principal, operation, namespace string) (bool, error) {
+	req := PolicyRequest{principal, operation, namespace}
+
+	a.mu.Lock()
+	d, ok := a.cache[req]
+	a.mu.Unlock()
+	if ok && a.clk.Now().Before(d.expires) {
+		return d.allow, nil
+	}
+
+	allow, err := a.query(req)
+	if err != nil {
+		a.stats.Counter("policy_errors").Inc(1)
+		if a.config.FailOpen {
+			log.With("principal", principal, "namespace", namespace).Errorf(
+				"Policy service unavailable, failing open: %s", err)
+			return true, nil
+		}
+		return false, err
+	}
+
+	a.mu.Lock()
+	if len(a.cache) >= a.config.CacheSize {
+		a.cache = make(map[PolicyRequest]cachedDecision)
+	}
+	a.cache[req] = cachedDecision{allow, a.clk.Now().Add(a.config.CacheTTL)}
+	a.mu.Unlock()
+
+	return allow, nil
+}
+
+func (a *policyAuthorizer) query(req PolicyRequest) (bool, error) {
+	b, err := json.Marshal(req)
+	if err != nil {
+		return false, fmt.Errorf("json marshal: %s", err)
+	}
+	resp, err := httputil.Post(
+		a.config.Addr,
+		httputil.SendBody(bytes.NewReader(b)),
+		httputil.SendHeaders(map[string]string{"Content-Type": "application/json"}),
+		httputil.SendTimeout(a.config.Timeout))
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	var d PolicyDecision
+	if err := json.NewDecoder(resp.Body).Decode(&d); err != nil {
+		return false, fmt.Errorf("decode decision: %s", err)
+	}
+	return d.Allow, nil
+}
+
+// authorize returns a middleware which only serves requests whose principal
+// may perform op on the requested namespace.
+func (s *Server) authorize(op string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if !s.config.Authz.Enabled {
+			return next
+		}
+		return handler.Wrap(func(w http.ResponseWriter, r *http.Request) error {
+			if err := s.checkAuthorized(r, op, requestNamespace(r)); err != nil {
+				return err
+			}
+			next.ServeHTTP(w, r)
+			return nil
+		})
+	}
+}
+
+// checkAuthorized returns a 403 error if the principal of r may not perform op
+// in namespace. Always succeeds if authorization is disabled.
+func (s *Server) checkAuthorized(r *http.Request, op, namespace string) error {
+	if !s.config.Authz.Enabled {
+		return nil
+	}
+	principal := s.principal(r)
+	allow, err := s.authorizer.Authorize(principal, op, namespace)
+	if err != nil {
+		return handler.Errorf("authorize: %s", err).Status(http.StatusServiceUnavailable)
+	}
+	if !allow {
+		s.stats.Tagged(map[string]string{
+			"operation": op,
+		}).Counter("unauthorized").Inc(1)
+		return handler.Errorf(
+			"principal %q may not %s namespace %q", principal, op, namespace).
+			Status(http.StatusForbidden)
+	}
+	return nil
+}
+
+func (s *Server) principal(r *http.Request) string {
+	if r.TLS != nil && len(r.TLS.PeerCertificates) > 0 {
+		return r.TLS.PeerCertificates[0].Subject.CommonName
+	}
+	if s.config.Authz.PrincipalHeader != "" {
+		return r.Header.Get(s.config.Authz.PrincipalHeader)
+	}
+	return ""
+}
+
+// requestNamespace returns the repository a request operates on.
+func requestNamespace(r *http.Request) string {
+	if tag := unescapedParam(r, "tag"); tag != "" {
+		return tagRepository(tag)
+	}
+	if repo := unescapedParam(r, "repo"); repo != "" {
+		return repo
+	}
+	return strings.TrimPrefix(r.URL.Path, "/list/")
+}
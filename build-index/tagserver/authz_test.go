@@ -0,0 +1,226 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package tagserver
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/utils/httputil"
+	"github.com/uber/kraken/utils/testutil"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/stretchr/testify/require"
+	"github.com/uber-go/tally"
+	"go.uber.org/atomic"
+)
+
+func TestStaticAuthorizer(t *testing.T) {
+	a := staticAuthorizer(StaticAuthzConfig{
+		Rules: []AuthzRule{
+			{Principal: "ci", Namespace: "team-foo/", Operations: []string{opRead, opWrite}},
+			{Principal: "*", Namespace: "", Operations: []string{opRead}},
+		},
+	})
+
+	tests := []struct {
+		principal string
+		operation string
+		namespace string
+		expected  bool
+	}{
+		{"ci", opWrite, "team-foo/repo", true},
+		{"ci", opWrite, "team-bar/repo", false},
+		{"ci", opReplicate, "team-foo/repo", false},
+		{"someone", opRead, "team-bar/repo", true},
+		{"someone", opWrite, "team-foo/repo", false},
+	}
+	for _, test := range tests {
+		t.Run(fmt.Sprintf("%s %s %s", test.principal, test.operation, test.namespace), func(t *testing.T) {
+			allow, err := a.Authorize(test.principal, test.operation, test.namespace)
+			require.NoError(t, err)
+			require.Equal(t, test.expected, allow)
+		})
+	}
+}
+
+// startPolicyServer starts a policy service which allows writes by "ci" only,
+// and counts the requests it receives.
+func startPolicyServer(t *testing.T) (addr string, requests *atomic.Int64, stop func()) {
+	requests = atomic.NewInt64(0)
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Inc()
+		var req PolicyRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		allow := req.Principal == "ci" && req.Operation == opWrite && req.Namespace == "team-foo/repo"
+		require.NoError(t, json.NewEncoder(w).Encode(PolicyDecision{Allow: allow}))
+	}))
+	return s.URL, requests, s.Close
+}
+
+func TestPolicyAuthorizerAllowAndDeny(t *testing.T) {
+	require := require.New(t)
+
+	addr, requests, stop := startPolicyServer(t)
+	defer stop()
+
+	a := newPolicyAuthorizer(PolicyAuthzConfig{Addr: addr}, clock.New(), tally.NoopScope)
+
+	allow, err := a.Authorize("ci", opWrite, "team-foo/repo")
+	require.NoError(err)
+	require.True(allow)
+
+	allow, err = a.Authorize("someone", opWrite, "team-foo/repo")
+	require.NoError(err)
+	require.False(allow)
+
+	// Decisions are cached.
+	allow, err = a.Authorize("ci", opWrite, "team-foo/repo")
+	require.NoError(err)
+	require.True(allow)
+	require.Equal(int64(2), requests.Load())
+}
+
+func TestPolicyAuthorizerCacheExpires(t *testing.T) {
+	require := require.New(t)
+
+	addr, requests, stop := startPolicyServer(t)
+	defer stop()
+
+	clk := clock.NewMock()
+	a := newPolicyAuthorizer(PolicyAuthzConfig{Addr: addr, CacheTTL: time.Minute}, clk, tally.NoopScope)
+
+	for i := 0; i < 2; i++ {
+		allow, err := a.Authorize("ci", opWrite, "team-foo/repo")
+		require.NoError(err)
+		require.True(allow)
+	}
+	require.Equal(int64(1), requests.Load())
+
+	clk.Add(time.Minute)
+
+	allow, err := a.Authorize("ci", opWrite, "team-foo/repo")
+	require.NoError(err)
+	require.True(allow)
+	require.Equal(int64(2), requests.Load())
+}
+
+func TestPolicyAuthorizerUnavailable(t *testing.T) {
+	addr, _, stop := startPolicyServer(t)
+	stop()
+
+	tests := []struct {
+		desc     string
+		failOpen bool
+	}{
+		{"fail closed", false},
+		{"fail open", true},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			require := require.New(t)
+
+			a := newPolicyAuthorizer(PolicyAuthzConfig{
+				Addr:     addr,
+				FailOpen: test.failOpen,
+			}, clock.New(), tally.NoopScope)
+
+			allow, err := a.Authorize("ci", opWrite, "team-foo/repo")
+			if test.failOpen {
+				require.NoError(err)
+				require.True(allow)
+			} else {
+				require.Error(err)
+				require.False(allow)
+			}
+		})
+	}
+}
+
+func TestAuthzMiddleware(t *testing.T) {
+	tag := "team-foo/repo:latest"
+	path := fmt.Sprintf("tags/%s/digest/%s", url.PathEscape(tag), core.DigestFixture())
+
+	addr, _, stop := startPolicyServer(t)
+	defer stop()
+
+	tests := []struct {
+		desc      string
+		policy    string
+		principal string
+		status    int
+	}{
+		{"denied", addr, "someone", http.StatusForbidden},
+		{"policy service unavailable", "http://localhost:0", "ci", http.StatusServiceUnavailable},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			require := require.New(t)
+
+			mocks, cleanup := newServerMocks(t)
+			defer cleanup()
+
+			mocks.config.Authz = AuthzConfig{
+				Enabled:         true,
+				PrincipalHeader: "X-Kraken-Principal",
+				Policy:          PolicyAuthzConfig{Addr: test.policy},
+			}
+
+			addr, stop := testutil.StartServer(mocks.handler())
+			defer stop()
+
+			_, err := httputil.Put(
+				fmt.Sprintf("http://%s/%s", addr, path),
+				httputil.SendHeaders(map[string]string{"X-Kraken-Principal": test.principal}))
+			require.Error(err)
+			require.True(httputil.IsStatus(err, test.status))
+		})
+	}
+}
+
+func TestPrincipalPrefersClientCertificateOverHeader(t *testing.T) {
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: "ci"}}
+
+	tests := []struct {
+		desc     string
+		header   string
+		cert     *x509.Certificate
+		expected string
+	}{
+		{"certificate", "X-Kraken-Principal", cert, "ci"},
+		{"header", "X-Kraken-Principal", nil, "spoofed"},
+		{"header not configured", "", nil, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			s := &Server{config: Config{Authz: AuthzConfig{PrincipalHeader: test.header}}}
+
+			r := httptest.NewRequest("GET", "/tags/foo", nil)
+			r.Header.Set("X-Kraken-Principal", "spoofed")
+			if test.cert != nil {
+				r.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{test.cert}}
+			}
+			require.Equal(t, test.expected, s.principal(r))
+		})
+	}
+}
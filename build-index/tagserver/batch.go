@@ -0,0 +1,132 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package tagserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/uber/kraken/build-index/tagclient"
+	"github.com/uber/kraken/build-index/tagstore"
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/persistedretry/tagreplication"
+	"github.com/uber/kraken/utils/handler"
+	"github.com/uber/kraken/utils/stringset"
+)
+
+// batchTag is a tag of a batch replication, resolved to its digest and
+// dependencies.
+type batchTag struct {
+	tag  string
+	d    core.Digest
+	deps core.DigestList
+}
+
+// replicateBatchHandler replicates every tag of the request. All tags are
+// resolved before any is replicated, such that a batch with a missing tag
+// replicates nothing. If dependency ordering is requested, the replications of
+// tags sharing dependencies with earlier tags of the batch are held back until
+// the replications of the earlier tags complete.
+func (s *Server) replicateBatchHandler(w http.ResponseWriter, r *http.Request) error {
+	var req tagclient.BatchReplicateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return handler.Errorf("decode body: %s", err).Status(http.StatusBadRequest)
+	}
+	if len(req.Tags) == 0 {
+		return handler.Errorf("empty batch").Status(http.StatusBadRequest)
+	}
+	batch := make([]batchTag, len(req.Tags))
+	for i, tag := range req.Tags {
+		if err := s.checkAuthorized(r, opReplicate, tagRepository(tag)); err != nil {
+			return err
+		}
+		setStage(r.Context(), stageAwaitingBackend)
+		d, resolved, _, err := s.resolveTag(r, opReplicate, tag)
+		if err != nil {
+			if err == tagstore.ErrTagNotFound {
+				return tagNotFoundError(tag)
+			}
+			return err
+		}
+		deps, err := s.replicateDependencies(r, tagclient.ReplicateRequest{}, resolved, d)
+		if err != nil {
+			return err
+		}
+		batch[i] = batchTag{resolved, d, deps}
+	}
+	order := make([]map[string][]string, len(batch))
+	if req.DependencyOrder {
+		order = s.replicationOrder(batch)
+	}
+	for i, bt := range batch {
+		if err := s.replicateTag(r.Context(), bt.tag, bt.d, bt.deps, "", order[i], 0); err != nil {
+			return err
+		}
+		if err := s.audit(r, "replicate", bt.tag, bt.d); err != nil {
+			return err
+		}
+	}
+	s.stats.Counter("batch_replications").Inc(1)
+	w.WriteHeader(http.StatusOK)
+	return nil
+}
+
+// replicationOrder returns, for each tag of batch at the same index, the tags
+// of batch whose replications to each destination must complete first. A tag is
+// ordered after the first tag of batch replicated to the same destination which
+// depends on any dependency it shares with it, such that the shared dependency
+// is transferred once, and is present on the remote once the tag is looked up.
+// Mirrors are excluded, since their replications share no remote origin
+// cluster.
+func (s *Server) replicationOrder(batch []batchTag) []map[string][]string {
+	order := make([]map[string][]string, len(batch))
+	bases := make(map[string]map[core.Digest]string) // Destination to base tags.
+	for i, bt := range batch {
+		for _, dest := range s.destinations(bt.tag, nil) {
+			if tagreplication.IsMirrorDestination(dest) {
+				continue
+			}
+			if _, ok := bases[dest]; !ok {
+				bases[dest] = make(map[core.Digest]string)
+			}
+			var after []string
+			seen := stringset.New()
+			for _, d := range bt.deps {
+				base, ok := bases[dest][d]
+				if !ok {
+					bases[dest][d] = bt.tag
+				} else if base != bt.tag && !seen.Has(base) {
+					seen.Add(base)
+					after = append(after, base)
+				}
+			}
+			if len(after) > 0 {
+				if order[i] == nil {
+					order[i] = make(map[string][]string)
+				}
+				order[i][dest] = after
+			}
+		}
+	}
+	return order
+}
+
+// tagRepository returns the repository of tag.
+func tagRepository(tag string) string {
+	if i := strings.LastIndex(tag, ":"); i >= 0 {
+		return tag[:i]
+	}
+	return tag
+}
@@ -0,0 +1,128 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package tagserver
+
+import (
+	"testing"
+
+	"github.com/uber/kraken/build-index/tagclient"
+	"github.com/uber/kraken/build-index/tagstore"
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/persistedretry/tagreplication"
+	"github.com/uber/kraken/utils/testutil"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReplicateBatchDependencyOrderHoldsBackDependentTags(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t)
+	defer cleanup()
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	client := newClusterClient(addr)
+
+	base := core.DigestFixture()
+	tag1 := core.TagFixture()
+	d1 := core.DigestFixture()
+	deps1 := core.DigestList{d1, base}
+	tag2 := core.TagFixture()
+	d2 := core.DigestFixture()
+	deps2 := core.DigestList{d2, base}
+
+	replicaClient := mocks.client()
+
+	// The second tag shares base with the first, so its replication waits for
+	// the replication of the first.
+	task2 := tagreplication.NewTask(tag2, d2, deps2, _testRemote, 0)
+	task2.After = tagreplication.TagList{tag1}
+
+	gomock.InOrder(
+		mocks.store.EXPECT().GetContext(gomock.Any(), tag1).Return(d1, nil),
+		mocks.depResolver.EXPECT().Resolve(tag1, d1).Return(deps1, nil),
+		mocks.store.EXPECT().GetContext(gomock.Any(), tag2).Return(d2, nil),
+		mocks.depResolver.EXPECT().Resolve(tag2, d2).Return(deps2, nil),
+		mocks.tagReplicationManager.EXPECT().Add(tagreplication.MatchTask(
+			tagreplication.NewTask(tag1, d1, deps1, _testRemote, 0))).Return(nil),
+		mocks.provider.EXPECT().Provide(_testNeighbor).Return(replicaClient),
+		replicaClient.EXPECT().DuplicateReplicate(
+			tag1, d1, deps1, mocks.config.DuplicateReplicateStagger, 0).Return(nil),
+		mocks.tagReplicationManager.EXPECT().Add(tagreplication.MatchTask(task2)).Return(nil),
+		mocks.provider.EXPECT().Provide(_testNeighbor).Return(replicaClient),
+		replicaClient.EXPECT().DuplicateReplicate(
+			tag2, d2, deps2, mocks.config.DuplicateReplicateStagger, 0).Return(nil),
+	)
+
+	require.NoError(client.ReplicateBatch([]string{tag1, tag2}, true))
+}
+
+func TestReplicateBatchWithoutDependencyOrder(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t)
+	defer cleanup()
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	client := newClusterClient(addr)
+
+	base := core.DigestFixture()
+	tag1 := core.TagFixture()
+	d1 := core.DigestFixture()
+	tag2 := core.TagFixture()
+	d2 := core.DigestFixture()
+
+	replicaClient := mocks.client()
+
+	mocks.store.EXPECT().GetContext(gomock.Any(), tag1).Return(d1, nil)
+	mocks.depResolver.EXPECT().Resolve(tag1, d1).Return(core.DigestList{base}, nil)
+	mocks.store.EXPECT().GetContext(gomock.Any(), tag2).Return(d2, nil)
+	mocks.depResolver.EXPECT().Resolve(tag2, d2).Return(core.DigestList{base}, nil)
+	mocks.tagReplicationManager.EXPECT().Add(tagreplication.MatchTask(
+		tagreplication.NewTask(tag1, d1, core.DigestList{base}, _testRemote, 0))).Return(nil)
+	mocks.tagReplicationManager.EXPECT().Add(tagreplication.MatchTask(
+		tagreplication.NewTask(tag2, d2, core.DigestList{base}, _testRemote, 0))).Return(nil)
+	mocks.provider.EXPECT().Provide(_testNeighbor).Return(replicaClient).Times(2)
+	replicaClient.EXPECT().DuplicateReplicate(
+		gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).Times(2)
+
+	require.NoError(client.ReplicateBatch([]string{tag1, tag2}, false))
+}
+
+func TestReplicateBatchNotFoundReplicatesNothing(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t)
+	defer cleanup()
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	client := newClusterClient(addr)
+
+	tag1 := core.TagFixture()
+	d1 := core.DigestFixture()
+	tag2 := core.TagFixture()
+
+	mocks.store.EXPECT().GetContext(gomock.Any(), tag1).Return(d1, nil)
+	mocks.depResolver.EXPECT().Resolve(tag1, d1).Return(core.DigestList{d1}, nil)
+	mocks.store.EXPECT().GetContext(gomock.Any(), tag2).Return(core.Digest{}, tagstore.ErrTagNotFound)
+
+	require.Equal(tagclient.ErrTagNotFound, client.ReplicateBatch([]string{tag1, tag2}, true))
+}
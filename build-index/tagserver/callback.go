@@ -0,0 +1,84 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package tagserver
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/uber/kraken/utils/handler"
+)
+
+// CallbackConfig bounds the callback URLs which replications may notify once
+// they complete.
+type CallbackConfig struct {
+	// MaxURLLength is the maximum length of callback URLs.
+	MaxURLLength int `yaml:"max_url_length"`
+
+	// AllowedHosts lists the hosts callbacks may be delivered to, such that
+	// replicate requests cannot direct build-index at arbitrary internal
+	// endpoints. Entries are host names, or "*." followed by a domain to allow
+	// all its subdomains. Callbacks are rejected if empty.
+	AllowedHosts []string `yaml:"allowed_hosts"`
+}
+
+func (c CallbackConfig) applyDefaults() CallbackConfig {
+	if c.MaxURLLength == 0 {
+		c.MaxURLLength = 2048
+	}
+	return c
+}
+
+// validateCallback rejects callback URLs which are too long, or which are not
+// absolute http or https URLs.
+func (s *Server) validateCallback(callback string) error {
+	if callback == "" {
+		return nil
+	}
+	if len(callback) > s.config.Callback.MaxURLLength {
+		return handler.Errorf(
+			"callback url exceeds %d characters", s.config.Callback.MaxURLLength).
+			Status(http.StatusBadRequest)
+	}
+	u, err := url.Parse(callback)
+	if err != nil {
+		return handler.Errorf("invalid callback url: %s", err).Status(http.StatusBadRequest)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return handler.Errorf("callback url scheme must be http or https").Status(http.StatusBadRequest)
+	}
+	if u.Host == "" || u.User != nil {
+		return handler.Errorf("callback url must have a host and no credentials").Status(http.StatusBadRequest)
+	}
+	if !s.config.Callback.allowed(u.Hostname()) {
+		return handler.Errorf("callback host %s is not allowed", u.Hostname()).Status(http.StatusBadRequest)
+	}
+	return nil
+}
+
+func (c CallbackConfig) allowed(host string) bool {
+	host = strings.ToLower(host)
+	for _, a := range c.AllowedHosts {
+		a = strings.ToLower(a)
+		if strings.HasPrefix(a, "*.") {
+			if strings.HasSuffix(host, a[1:]) {
+				return true
+			}
+		} else if host == a {
+			return true
+		}
+	}
+	return false
+}
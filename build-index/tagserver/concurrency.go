@@ -0,0 +1,41 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package tagserver
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/uber/kraken/utils/handler"
+)
+
+// InflightReplicationsStatus counts the in-flight replications of each
+// namespace with replications in flight.
+type InflightReplicationsStatus struct {
+	Inflight map[string]int `json:"inflight"`
+}
+
+// inflightReplicationsHandler returns the in-flight replications of each
+// namespace.
+func (s *Server) inflightReplicationsHandler(w http.ResponseWriter, r *http.Request) error {
+	if s.namespaceLimiter == nil {
+		return handler.Errorf("replication concurrency limits not enabled").Status(http.StatusNotImplemented)
+	}
+	status := InflightReplicationsStatus{Inflight: s.namespaceLimiter.InFlight()}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(status); err != nil {
+		return handler.Errorf("json encode: %s", err)
+	}
+	return nil
+}
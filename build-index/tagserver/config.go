@@ -16,6 +16,8 @@ package tagserver
 import (
 	"time"
 
+	"github.com/uber/kraken/build-index/tagmodels"
+	"github.com/uber/kraken/core"
 	"github.com/uber/kraken/utils/listener"
 )
 
@@ -24,6 +26,69 @@ type Config struct {
 	Listener                  listener.Config `yaml:"listener"`
 	DuplicateReplicateStagger time.Duration   `yaml:"duplicate_replicate_stagger"`
 	DuplicatePutStagger       time.Duration   `yaml:"duplicate_put_stagger"`
+
+	// ReplicateDedupWindow is the window in which identical replications of a
+	// tag to a remote are collapsed into a single task. Unlike the duplicate
+	// replicate stagger, which delays the tasks of replicas, this prevents
+	// concurrent callers from enqueueing the same task. Disabled if zero.
+	ReplicateDedupWindow time.Duration `yaml:"replicate_dedup_window"`
+
+	// DigestAlgorithm is the preferred algorithm of tag digests. Remotes
+	// replicating tags of a different algorithm may provide a translation, which
+	// is recorded in the audit log. Tags always store the source digest.
+	DigestAlgorithm string `yaml:"digest_algorithm"`
+
+	// EnableAdmin exposes debugging endpoints under /admin.
+	EnableAdmin bool `yaml:"enable_admin"`
+
+	// Quotas limit the usage of namespaces. Puts which would exceed a quota
+	// are rejected with 429.
+	Quotas                 []QuotaConfig `yaml:"quotas"`
+	QuotaReconcileInterval time.Duration `yaml:"quota_reconcile_interval"`
+
+	// Fallbacks define namespaces which gets of missing tags are resolved
+	// from. Namespaces without a fallback configuration never fall back.
+	Fallbacks []FallbackConfig `yaml:"fallbacks"`
+
+	// OriginClusters lists origin clusters across regions, such that clients
+	// may pick the closest one. If empty, only the local origin is returned.
+	OriginClusters []tagmodels.OriginCluster `yaml:"origin_clusters"`
+
+	// EnableOriginAvailability exposes a digest-specific origin endpoint which
+	// only returns local origins holding or warming the blob. Each request
+	// probes every owning origin, so the plain /origin endpoint remains the
+	// default for clients which do not need it.
+	EnableOriginAvailability bool `yaml:"enable_origin_availability"`
+
+	// EnableCacheInvalidation invalidates the cached value of a tag on all
+	// neighbors when the tag is put or deleted, such that replicas behind a load balancer
+	// do not serve different digests for the same tag. Invalidation is
+	// best-effort and should be paired with a tag store cache TTL.
+	EnableCacheInvalidation bool `yaml:"enable_cache_invalidation"`
+
+	// TagValue bounds the values which may be put under tags.
+	TagValue TagValueConfig `yaml:"tag_value"`
+
+	// TagName bounds the names which may be put as tags.
+	TagName TagNameConfig `yaml:"tag_name"`
+
+	// Authz authorizes requests against static rules or a policy service.
+	Authz AuthzConfig `yaml:"authz"`
+
+	// ReadOnly defines degraded read-only operation during partial outages.
+	ReadOnly ReadOnlyConfig `yaml:"read_only"`
+
+	// Preload bounds the tags preloaded via the admin preload endpoint.
+	Preload PreloadConfig `yaml:"preload"`
+
+	// Callback bounds the callback URLs of replicate requests.
+	Callback CallbackConfig `yaml:"callback"`
+
+	// BlobEviction evicts blobs from origins once their last tag is deleted.
+	BlobEviction BlobEvictionConfig `yaml:"blob_eviction"`
+
+	// ReadLimit rate limits tag reads per namespace.
+	ReadLimit ReadLimitConfig `yaml:"read_limit"`
 }
 
 func (c Config) applyDefaults() Config {
@@ -33,5 +98,17 @@ func (c Config) applyDefaults() Config {
 	if c.DuplicatePutStagger == 0 {
 		c.DuplicatePutStagger = 20 * time.Minute
 	}
+	if c.QuotaReconcileInterval == 0 {
+		c.QuotaReconcileInterval = time.Hour
+	}
+	if c.DigestAlgorithm == "" {
+		c.DigestAlgorithm = core.SHA256
+	}
+	c.TagValue = c.TagValue.applyDefaults()
+	c.Authz = c.Authz.applyDefaults()
+	c.ReadOnly = c.ReadOnly.applyDefaults()
+	c.Preload = c.Preload.applyDefaults()
+	c.Callback = c.Callback.applyDefaults()
+	c.BlobEviction = c.BlobEviction.applyDefaults()
 	return c
 }
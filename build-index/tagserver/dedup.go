@@ -0,0 +1,119 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package tagserver
+
+import (
+	"sync"
+	"time"
+
+	"github.com/uber/kraken/core"
+
+	"github.com/andres-erbsen/clock"
+)
+
+// replicationKey identifies identical replications. Replications with different
+// callbacks are not identical, such that every callback is notified.
+type replicationKey struct {
+	tag      string
+	digest   core.Digest
+	remote   string
+	callback string
+}
+
+type replicationCall struct {
+	done      chan struct{}
+	err       error
+	expiresAt time.Time
+}
+
+// expired returns whether c succeeded longer than the window ago. Must hold the
+// lock of the replicationDedup.
+func (c *replicationCall) expired(now time.Time) bool {
+	select {
+	case <-c.done:
+		return !now.Before(c.expiresAt)
+	default:
+		return false
+	}
+}
+
+// replicationDedup collapses identical replications, e.g. of several CI jobs
+// promoting the same build, into a single enqueued task. Calls which are in
+// flight, or succeeded within the window, are shared by identical calls.
+// Failed calls are not shared once they return, such that callers may retry.
+type replicationDedup struct {
+	window time.Duration
+	clk    clock.Clock
+
+	mu        sync.Mutex
+	calls     map[replicationKey]*replicationCall
+	nextSweep time.Time
+}
+
+func newReplicationDedup(window time.Duration, clk clock.Clock) *replicationDedup {
+	return &replicationDedup{
+		window: window,
+		clk:    clk,
+		calls:  make(map[replicationKey]*replicationCall),
+	}
+}
+
+// do runs enqueue unless an identical call is in flight or recently succeeded,
+// in which case the result of that call is returned. Returns whether enqueue
+// was run by this call.
+func (r *replicationDedup) do(key replicationKey, enqueue func() error) (bool, error) {
+	if r.window <= 0 {
+		return true, enqueue()
+	}
+
+	r.mu.Lock()
+	now := r.clk.Now()
+	r.sweep(now)
+	if c, ok := r.calls[key]; ok && !c.expired(now) {
+		r.mu.Unlock()
+		<-c.done
+		return false, c.err
+	}
+	c := &replicationCall{done: make(chan struct{})}
+	r.calls[key] = c
+	r.mu.Unlock()
+
+	err := enqueue()
+
+	r.mu.Lock()
+	c.err = err
+	if err != nil {
+		delete(r.calls, key)
+	} else {
+		c.expiresAt = r.clk.Now().Add(r.window)
+	}
+	close(c.done)
+	r.mu.Unlock()
+
+	return true, err
+}
+
+// sweep removes succeeded calls whose window passed. At most runs once per
+// window, to amortize the cost of iterating all calls. Must hold r.mu.
+func (r *replicationDedup) sweep(now time.Time) {
+	if now.Before(r.nextSweep) {
+		return
+	}
+	r.nextSweep = now.Add(r.window)
+	for key, c := range r.calls {
+		if c.expired(now) {
+			delete(r.calls, key)
+		}
+	}
+}
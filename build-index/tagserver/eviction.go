@@ -0,0 +1,285 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package tagserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/uber/kraken/build-index/tagstore"
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/backend"
+	"github.com/uber/kraken/utils/log"
+)
+
+// BlobEvictionConfig defines coordination of tag deletion with origins. When
+// enabled, deleting a tag releases its digest, or with reference counting
+// enabled, the dependencies no other tag known to this build-index references.
+// Released blobs are marked as eviction candidates on the origins, which evict
+// them once their grace period has elapsed, but only once a sweep confirmed
+// that no tag in the backend references them. Tags of any repository and tags
+// put through other build-index hosts are thus accounted for.
+type BlobEvictionConfig struct {
+	Enabled bool `yaml:"enabled"`
+
+	// SweepInterval is the interval at which released blobs are checked against
+	// a full scan of tags and marked as eviction candidates.
+	SweepInterval time.Duration `yaml:"sweep_interval"`
+
+	// ConsistencyGrace is how long a blob must have been released before sweeps
+	// consider it. Backend listings may lag behind writes, such that tags put
+	// shortly before a sweep are missing from its scan.
+	ConsistencyGrace time.Duration `yaml:"consistency_grace"`
+
+	// ScanPrefixes are the tag prefixes scanned by sweeps. Together, they must
+	// cover every tag which may reference a blob, and every configured backend
+	// namespace must be resolved by at least one of them.
+	ScanPrefixes []string `yaml:"scan_prefixes"`
+}
+
+func (c BlobEvictionConfig) applyDefaults() BlobEvictionConfig {
+	if c.SweepInterval == 0 {
+		c.SweepInterval = 10 * time.Minute
+	}
+	if c.ConsistencyGrace == 0 {
+		c.ConsistencyGrace = time.Hour
+	}
+	return c
+}
+
+// validateScanPrefixes returns an error unless the scan prefixes of config
+// resolve every backend namespace of backends.
+func (c BlobEvictionConfig) validateScanPrefixes(backends *backend.Manager) error {
+	if len(c.ScanPrefixes) == 0 {
+		return errors.New("scan prefixes required")
+	}
+	scanned := make(map[string]bool)
+	for _, prefix := range c.ScanPrefixes {
+		namespace, err := backends.MatchNamespace(prefix)
+		if err != nil {
+			return fmt.Errorf("scan prefix %q: %s", prefix, err)
+		}
+		scanned[namespace] = true
+	}
+	for _, namespace := range backends.Namespaces() {
+		if !scanned[namespace] {
+			return fmt.Errorf("no scan prefix resolves backend namespace %s", namespace)
+		}
+	}
+	return nil
+}
+
+// release records the tags which released a blob, and when it was last
+// released.
+type release struct {
+	tags map[string]bool
+	at   time.Time
+}
+
+// releasedBlobs are blobs which may no longer be referenced by any tag, but
+// have not been confirmed as unreferenced by a sweep yet.
+type releasedBlobs struct {
+	sync.Mutex
+	digests map[core.Digest]*release
+}
+
+func newReleasedBlobs() *releasedBlobs {
+	return &releasedBlobs{digests: make(map[core.Digest]*release)}
+}
+
+// add records that tag released ds at the given time.
+func (b *releasedBlobs) add(tag string, ds []core.Digest, at time.Time) {
+	b.Lock()
+	defer b.Unlock()
+	for _, d := range ds {
+		r, ok := b.digests[d]
+		if !ok {
+			r = &release{tags: make(map[string]bool)}
+			b.digests[d] = r
+		}
+		r.tags[tag] = true
+		r.at = at
+	}
+}
+
+// take removes and returns the blobs released no later than cutoff.
+func (b *releasedBlobs) take(cutoff time.Time) map[core.Digest]*release {
+	b.Lock()
+	defer b.Unlock()
+	taken := make(map[core.Digest]*release)
+	for d, r := range b.digests {
+		if !r.at.After(cutoff) {
+			taken[d] = r
+			delete(b.digests, d)
+		}
+	}
+	return taken
+}
+
+// restore returns releases taken by a failed sweep, keeping releases added
+// since.
+func (b *releasedBlobs) restore(releases map[core.Digest]*release) {
+	b.Lock()
+	defer b.Unlock()
+	for d, r := range releases {
+		cur, ok := b.digests[d]
+		if !ok {
+			b.digests[d] = r
+			continue
+		}
+		for tag := range r.tags {
+			cur.tags[tag] = true
+		}
+	}
+}
+
+// sweepReleasesPeriodically sweeps released blobs on an interval until ctx is
+// done.
+func (s *Server) sweepReleasesPeriodically(ctx context.Context) {
+	ticker := s.clk.Ticker(s.config.BlobEviction.SweepInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.sweepReleases()
+		}
+	}
+}
+
+// sweepReleases marks blobs released at least a consistency grace ago which no
+// tag references as eviction candidates. References are computed from a full
+// scan of the tags in the backend, which is shared by all build-index hosts,
+// and local reference counts are reconciled against the scan. Before a blob is
+// marked, its reference count and the current dependencies of the tags which
+// released it are checked directly, since they may have changed after the
+// scan. If the scan fails, released blobs are kept for the next sweep.
+func (s *Server) sweepReleases() {
+	released := s.released.take(s.clk.Now().Add(-s.config.BlobEviction.ConsistencyGrace))
+	if len(released) == 0 {
+		return
+	}
+	referenced := make(map[core.Digest]bool)
+	for _, prefix := range s.config.BlobEviction.ScanPrefixes {
+		tags, err := s.scanDependencies(context.Background(), prefix)
+		if err != nil {
+			s.stats.Counter("eviction_sweep_errors").Inc(1)
+			log.With("prefix", prefix).Errorf("Error scanning blob references: %s", err)
+			s.released.restore(released)
+			return
+		}
+		if s.refs != nil {
+			corrected, err := s.refs.Reconcile(prefix, tags)
+			if err != nil {
+				s.stats.Counter("refcount_errors").Inc(1)
+				log.With("prefix", prefix).Errorf("Error reconciling blob references: %s", err)
+			}
+			s.stats.Counter("refcount_corrections").Inc(int64(corrected))
+		}
+		for _, deps := range tags {
+			for _, d := range deps {
+				referenced[d] = true
+			}
+		}
+	}
+	for d, r := range released {
+		if referenced[d] {
+			continue
+		}
+		ok, err := s.referencedDirectly(d, r)
+		if err != nil {
+			s.stats.Counter("eviction_sweep_errors").Inc(1)
+			log.With("digest", d).Errorf("Error checking blob references: %s", err)
+			s.released.restore(map[core.Digest]*release{d: r})
+			continue
+		}
+		if ok {
+			continue
+		}
+		if err := s.localOriginClient.MarkEvictionCandidate(d); err != nil {
+			s.stats.Counter("eviction_notify_errors").Inc(1)
+			log.With("digest", d).Errorf("Error marking blob as eviction candidate: %s", err)
+			continue
+		}
+		s.stats.Counter("unreferenced_blobs").Inc(1)
+	}
+}
+
+// referencedDirectly returns whether d is referenced according to its local
+// reference count, or by the current digest of any tag which released it.
+func (s *Server) referencedDirectly(d core.Digest, r *release) (bool, error) {
+	if s.refs != nil {
+		n, err := s.refs.Count(d)
+		if err != nil {
+			return false, fmt.Errorf("count references: %s", err)
+		}
+		if n > 0 {
+			return true, nil
+		}
+	}
+	for tag := range r.tags {
+		td, err := s.store.Get(tag)
+		if err != nil {
+			if err == tagstore.ErrTagNotFound {
+				continue
+			}
+			return false, fmt.Errorf("get tag %s: %s", tag, err)
+		}
+		deps, err := s.depResolver.Resolve(tag, td)
+		if err != nil {
+			return false, fmt.Errorf("resolve dependencies of %s: %s", tag, err)
+		}
+		for _, dep := range deps {
+			if dep == d {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// scanDependencies returns the dependencies of every tag under prefix in the
+// backend.
+func (s *Server) scanDependencies(
+	ctx context.Context, prefix string) (map[string]core.DigestList, error) {
+
+	client, err := s.backendClient(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+	result, err := client.List(prefix)
+	if err != nil {
+		return nil, backendError(ctx, err)
+	}
+	tags := make(map[string]core.DigestList)
+	for _, tag := range result.Names {
+		d, err := s.store.Get(tag)
+		if err != nil {
+			if err == tagstore.ErrTagNotFound {
+				continue
+			}
+			return nil, storageError(err)
+		}
+		deps, err := s.depResolver.Resolve(tag, d)
+		if err != nil {
+			return nil, fmt.Errorf("resolve dependencies of %s: %s", tag, err)
+		}
+		tags[tag] = deps
+	}
+	return tags, nil
+}
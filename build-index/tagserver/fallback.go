@@ -0,0 +1,159 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package tagserver
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/uber/kraken/build-index/tagstore"
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/utils/stringset"
+)
+
+// FallbackNamespaceHeader is set on responses of tags which were resolved from
+// a fallback namespace, and holds that namespace.
+const FallbackNamespaceHeader = "X-Kraken-Fallback-Namespace"
+
+// FallbackConfig defines namespaces which gets of tags missing under Namespace
+// fall back to, in order. Namespaces are tag prefixes, which are swapped to
+// resolve a tag under a fallback. For example, given namespace team/ and
+// fallback base/, a get of team/foo:latest which misses is retried as
+// base/foo:latest.
+type FallbackConfig struct {
+	Namespace string   `yaml:"namespace"`
+	Fallbacks []string `yaml:"fallbacks"`
+}
+
+type fallbacks []FallbackConfig
+
+func newFallbacks(configs []FallbackConfig) fallbacks {
+	fs := append(fallbacks(nil), configs...)
+	// Sort by descending namespace length such that the most specific
+	// namespace matches first.
+	sort.SliceStable(fs, func(i, j int) bool {
+		return len(fs[i].Namespace) > len(fs[j].Namespace)
+	})
+	return fs
+}
+
+// match returns the fallback configuration which applies to tag, if any.
+func (fs fallbacks) match(tag string) (FallbackConfig, bool) {
+	for _, f := range fs {
+		if strings.HasPrefix(tag, f.Namespace) {
+			return f, true
+		}
+	}
+	return FallbackConfig{}, false
+}
+
+// swap returns p with the namespace of f swapped for the fallback namespace ns.
+func (f FallbackConfig) swap(p, ns string) string {
+	return ns + strings.TrimPrefix(p, f.Namespace)
+}
+
+// fallBack runs lookup with tag. If lookup returns notFound, lookup runs with
+// the tags which tag falls back to, in order, until one is found. Since
+// fallback tags are served in place of tag, the principal of r must be
+// authorized for op on the namespace of every fallback tag looked up. Returns
+// the tag which was found, and the fallback namespace which served it if it
+// was not tag itself.
+func (s *Server) fallBack(
+	r *http.Request, op, tag string, notFound error, lookup func(tag string) error) (string, string, error) {
+
+	err := lookup(tag)
+	if err != notFound {
+		return tag, "", err
+	}
+	f, ok := s.fallbacks.match(tag)
+	if !ok {
+		return tag, "", err
+	}
+	for _, ns := range f.Fallbacks {
+		fallbackTag := f.swap(tag, ns)
+		if err := s.checkAuthorized(r, op, tagRepository(fallbackTag)); err != nil {
+			return "", "", err
+		}
+		err := lookup(fallbackTag)
+		if err == notFound {
+			continue
+		}
+		if err != nil {
+			return "", "", err
+		}
+		s.stats.Tagged(map[string]string{
+			"namespace": f.Namespace,
+			"fallback":  ns,
+		}).Counter("tag_fallback_hits").Inc(1)
+		return fallbackTag, ns, nil
+	}
+	s.stats.Tagged(map[string]string{"namespace": f.Namespace}).Counter("tag_fallback_misses").Inc(1)
+	return tag, "", notFound
+}
+
+// resolveTag returns the digest of tag. If tag does not exist, tag is resolved
+// from the fallback namespaces of its namespace, for which the principal of r
+// must be authorized for op. Returns the tag which was resolved, and the
+// fallback namespace which served it, if any. Errors other than
+// tagstore.ErrTagNotFound are handler errors.
+func (s *Server) resolveTag(r *http.Request, op, tag string) (core.Digest, string, string, error) {
+	var d core.Digest
+	resolved, fallback, err := s.fallBack(r, op, tag, tagstore.ErrTagNotFound, func(tag string) error {
+		var err error
+		d, err = s.store.GetContext(r.Context(), tag)
+		if err != nil && err != tagstore.ErrTagNotFound {
+			if r.Context().Err() != nil {
+				return backendError(r.Context(), err)
+			}
+			return storageError(err)
+		}
+		return err
+	})
+	if err != nil {
+		return core.Digest{}, "", "", err
+	}
+	return d, resolved, fallback, nil
+}
+
+// mergeFallbackLists appends the names which list returns for each fallback of
+// prefix, in order, to the names listed under prefix itself. list must map
+// names back under prefix, such that names under prefix shadow the same names
+// of fallbacks. The principal of r must be authorized to read every fallback.
+func (s *Server) mergeFallbackLists(
+	r *http.Request, prefix string, names []string, list func(fallback string) ([]string, error)) ([]string, error) {
+
+	f, ok := s.fallbacks.match(prefix)
+	if !ok {
+		return names, nil
+	}
+	seen := stringset.FromSlice(names)
+	for _, ns := range f.Fallbacks {
+		fallback := f.swap(prefix, ns)
+		if err := s.checkAuthorized(r, opRead, fallback); err != nil {
+			return nil, err
+		}
+		fallbackNames, err := list(fallback)
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range fallbackNames {
+			if !seen.Has(name) {
+				seen.Add(name)
+				names = append(names, name)
+			}
+		}
+	}
+	return names, nil
+}
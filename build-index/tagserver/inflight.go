@@ -0,0 +1,132 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package tagserver
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/pressly/chi"
+	"go.uber.org/atomic"
+)
+
+// Stages of in-flight operations.
+const (
+	stageStarted               = "started"
+	stageResolvingDependencies = "resolving-dependencies"
+	stageVerifying             = "verifying"
+	stageAwaitingBackend       = "awaiting-backend"
+	stageDuplicating           = "duplicating"
+	stageEnqueueingReplication = "enqueueing-replication"
+)
+
+// InflightOp is a snapshot of a single in-flight operation.
+type InflightOp struct {
+	ID        int64         `json:"id"`
+	Method    string        `json:"method"`
+	Path      string        `json:"path"`
+	Tag       string        `json:"tag,omitempty"`
+	Namespace string        `json:"namespace,omitempty"`
+	Stage     string        `json:"stage"`
+	Elapsed   time.Duration `json:"elapsed"`
+}
+
+type inflightOp struct {
+	id        int64
+	method    string
+	path      string
+	tag       string
+	namespace string
+	start     time.Time
+	stage     *atomic.String
+}
+
+type inflightKey struct{}
+
+// inflightRegistry tracks operations currently being served. Registration and
+// stage updates are lock-free so tracking adds negligible overhead to requests.
+type inflightRegistry struct {
+	clk    clock.Clock
+	nextID *atomic.Int64
+	ops    sync.Map
+}
+
+func newInflightRegistry(clk clock.Clock) *inflightRegistry {
+	return &inflightRegistry{clk: clk, nextID: atomic.NewInt64(0)}
+}
+
+// track is a middleware which registers requests for the duration they are
+// being served. Must be installed on routes where URL params are resolved.
+func (reg *inflightRegistry) track(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		op := &inflightOp{
+			id:        reg.nextID.Inc(),
+			method:    r.Method,
+			path:      r.URL.Path,
+			tag:       unescapedParam(r, "tag"),
+			namespace: unescapedParam(r, "repo"),
+			start:     reg.clk.Now(),
+			stage:     atomic.NewString(stageStarted),
+		}
+		if op.namespace == "" && strings.HasPrefix(op.path, "/list/") {
+			op.namespace = op.path[len("/list/"):]
+		}
+		reg.ops.Store(op.id, op)
+		defer reg.ops.Delete(op.id)
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), inflightKey{}, op)))
+	})
+}
+
+// snapshot returns all in-flight operations, oldest first.
+func (reg *inflightRegistry) snapshot() []InflightOp {
+	now := reg.clk.Now()
+	ops := []InflightOp{}
+	reg.ops.Range(func(_, v interface{}) bool {
+		op := v.(*inflightOp)
+		ops = append(ops, InflightOp{
+			ID:        op.id,
+			Method:    op.method,
+			Path:      op.path,
+			Tag:       op.tag,
+			Namespace: op.namespace,
+			Stage:     op.stage.Load(),
+			Elapsed:   now.Sub(op.start),
+		})
+		return true
+	})
+	sort.Slice(ops, func(i, j int) bool { return ops[i].ID < ops[j].ID })
+	return ops
+}
+
+// setStage records the current stage of the operation tracked by ctx, if any.
+func setStage(ctx context.Context, stage string) {
+	if op, ok := ctx.Value(inflightKey{}).(*inflightOp); ok {
+		op.stage.Store(stage)
+	}
+}
+
+func unescapedParam(r *http.Request, name string) string {
+	param := chi.URLParam(r, name)
+	if val, err := url.PathUnescape(param); err == nil {
+		return val
+	}
+	return param
+}
@@ -0,0 +1,127 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package tagserver
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/uber/kraken/utils/handler"
+	"github.com/uber/kraken/utils/httputil"
+	"github.com/uber/kraken/utils/log"
+)
+
+// PausedRemotesStatus lists the remotes to which replication is paused.
+type PausedRemotesStatus struct {
+	Paused []string `json:"paused"`
+}
+
+// pausedRemotesHandler returns the remotes to which replication is paused.
+func (s *Server) pausedRemotesHandler(w http.ResponseWriter, r *http.Request) error {
+	if s.pausedRemotes == nil {
+		return handler.Errorf("replication pausing not enabled").Status(http.StatusNotImplemented)
+	}
+	status := PausedRemotesStatus{Paused: s.pausedRemotes.List()}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(status); err != nil {
+		return handler.Errorf("json encode: %s", err)
+	}
+	return nil
+}
+
+// pauseRemoteHandler stops dispatch of replications to a remote across the
+// cluster. Replications to the remote keep being queued until it is resumed.
+func (s *Server) pauseRemoteHandler(w http.ResponseWriter, r *http.Request) error {
+	remote, err := s.parsePausableRemote(r)
+	if err != nil {
+		return err
+	}
+	if err := s.setRemotePaused(remote, true); err != nil {
+		return err
+	}
+	s.duplicateRemotePaused(remote, true)
+	return s.pausedRemotesHandler(w, r)
+}
+
+// resumeRemoteHandler resumes dispatch of replications to a remote across the
+// cluster.
+func (s *Server) resumeRemoteHandler(w http.ResponseWriter, r *http.Request) error {
+	remote, err := s.parsePausableRemote(r)
+	if err != nil {
+		return err
+	}
+	if err := s.setRemotePaused(remote, false); err != nil {
+		return err
+	}
+	s.duplicateRemotePaused(remote, false)
+	return s.pausedRemotesHandler(w, r)
+}
+
+// duplicatePauseRemoteHandler pauses a remote on behalf of a neighbor.
+func (s *Server) duplicatePauseRemoteHandler(w http.ResponseWriter, r *http.Request) error {
+	remote, err := s.parsePausableRemote(r)
+	if err != nil {
+		return err
+	}
+	return s.setRemotePaused(remote, true)
+}
+
+// duplicateResumeRemoteHandler resumes a remote on behalf of a neighbor.
+func (s *Server) duplicateResumeRemoteHandler(w http.ResponseWriter, r *http.Request) error {
+	remote, err := s.parsePausableRemote(r)
+	if err != nil {
+		return err
+	}
+	return s.setRemotePaused(remote, false)
+}
+
+func (s *Server) setRemotePaused(remote string, paused bool) error {
+	if paused {
+		if err := s.pausedRemotes.PauseRemote(remote); err != nil {
+			return handler.Errorf("pause remote: %s", err)
+		}
+		log.With("remote", remote).Info("Paused replication to remote")
+	} else {
+		if err := s.pausedRemotes.ResumeRemote(remote); err != nil {
+			return handler.Errorf("resume remote: %s", err)
+		}
+		log.With("remote", remote).Info("Resumed replication to remote")
+	}
+	return nil
+}
+
+// duplicateRemotePaused pauses or resumes remote on all neighbors, since each
+// neighbor dispatches its own replication tasks.
+func (s *Server) duplicateRemotePaused(remote string, paused bool) {
+	for addr := range s.neighbors.Resolve() {
+		if err := s.provider.Provide(addr).DuplicatePauseRemote(remote, paused); err != nil {
+			s.stats.Counter("duplicate_pause_failures").Inc(1)
+			log.Errorf("Error duplicating pause of %s to %s: %s", remote, addr, err)
+		}
+	}
+}
+
+func (s *Server) parsePausableRemote(r *http.Request) (string, error) {
+	if s.pausedRemotes == nil {
+		return "", handler.Errorf("replication pausing not enabled").Status(http.StatusNotImplemented)
+	}
+	remote, err := httputil.ParseParam(r, "remote")
+	if err != nil {
+		return "", err
+	}
+	if !s.remotes.Contains(remote) {
+		return "", handler.Errorf("unknown remote %s", remote).Status(http.StatusBadRequest)
+	}
+	return remote, nil
+}
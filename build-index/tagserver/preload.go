@@ -0,0 +1,164 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package tagserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/uber/kraken/utils/handler"
+	"github.com/uber/kraken/utils/httputil"
+)
+
+// PreloadConfig bounds admin-triggered preloading of tags.
+type PreloadConfig struct {
+	// MaxTags bounds the number of tags preloaded per request. Tags listed
+	// under namespaces beyond MaxTags are skipped.
+	MaxTags int `yaml:"max_tags"`
+
+	// RPS limits the rate at which tags are preloaded, shared by all requests.
+	RPS float64 `yaml:"rps"`
+}
+
+func (c PreloadConfig) applyDefaults() PreloadConfig {
+	if c.MaxTags == 0 {
+		c.MaxTags = 1000
+	}
+	if c.RPS == 0 {
+		c.RPS = 20
+	}
+	return c
+}
+
+// PreloadRequest lists tags to cache ahead of anticipated lookups.
+type PreloadRequest struct {
+	Tags []string `json:"tags"`
+
+	// Namespaces are tag prefixes, under which every tag is preloaded.
+	Namespaces []string `json:"namespaces"`
+
+	// WarmBlobs instructs origins to warm the dependencies of preloaded tags.
+	WarmBlobs bool `json:"warm_blobs"`
+}
+
+// PreloadFailure describes a tag which could not be preloaded.
+type PreloadFailure struct {
+	Tag   string `json:"tag"`
+	Error string `json:"error"`
+}
+
+// PreloadResponse reports the outcome of a PreloadRequest.
+type PreloadResponse struct {
+	Preloaded   int              `json:"preloaded"`
+	WarmedBlobs int              `json:"warmed_blobs"`
+	Truncated   bool             `json:"truncated"`
+	Failures    []PreloadFailure `json:"failures"`
+}
+
+// preloadHandler caches the requested tags and optionally warms their blobs
+// on origins, throttled to config.Preload.RPS.
+func (s *Server) preloadHandler(w http.ResponseWriter, r *http.Request) error {
+	var req PreloadRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return handler.Errorf("decode body: %s", err).Status(http.StatusBadRequest)
+	}
+	tags, truncated, err := s.preloadTags(req)
+	if err != nil {
+		return err
+	}
+
+	resp := PreloadResponse{Truncated: truncated, Failures: []PreloadFailure{}}
+	fail := func(tag string, err error) {
+		resp.Failures = append(resp.Failures, PreloadFailure{tag, err.Error()})
+	}
+	for i, tag := range tags {
+		if err := s.preloadLimiter.Wait(r.Context()); err != nil {
+			for _, rest := range tags[i:] {
+				fail(rest, err)
+			}
+			break
+		}
+		d, err := s.store.Preload(tag)
+		if err != nil {
+			fail(tag, err)
+			continue
+		}
+		resp.Preloaded++
+		if !req.WarmBlobs {
+			continue
+		}
+		deps, err := s.depResolver.Resolve(tag, d)
+		if err != nil {
+			fail(tag, fmt.Errorf("resolve dependencies: %s", err))
+			continue
+		}
+		for _, dep := range deps {
+			// Origins respond with 202 while they download the blob from the
+			// backend, which is all we need.
+			_, err := s.localOriginClient.GetMetaInfo(tag, dep)
+			if err != nil && !httputil.IsAccepted(err) {
+				fail(tag, fmt.Errorf("warm blob %s: %s", dep, err))
+				continue
+			}
+			resp.WarmedBlobs++
+		}
+	}
+	s.stats.Counter("preloaded_tags").Inc(int64(resp.Preloaded))
+	s.stats.Counter("preload_failures").Inc(int64(len(resp.Failures)))
+
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		return handler.Errorf("json encode: %s", err)
+	}
+	return nil
+}
+
+// preloadTags returns the deduplicated tags of req, followed by the tags listed
+// under its namespaces, bounded by config.Preload.MaxTags.
+func (s *Server) preloadTags(req PreloadRequest) (tags []string, truncated bool, err error) {
+	seen := make(map[string]bool)
+	add := func(tag string) bool {
+		if seen[tag] {
+			return true
+		}
+		if len(tags) == s.config.Preload.MaxTags {
+			truncated = true
+			return false
+		}
+		seen[tag] = true
+		tags = append(tags, tag)
+		return true
+	}
+	for _, tag := range req.Tags {
+		if !add(tag) {
+			return tags, truncated, nil
+		}
+	}
+	for _, ns := range req.Namespaces {
+		client, err := s.backends.GetClient(ns)
+		if err != nil {
+			return nil, false, handler.Errorf("backend manager: %s", err).Status(http.StatusBadRequest)
+		}
+		result, err := client.List(ns)
+		if err != nil {
+			return nil, false, handler.Errorf("list %s: %s", ns, err)
+		}
+		for _, tag := range result.Names {
+			if !add(tag) {
+				return tags, truncated, nil
+			}
+		}
+	}
+	return tags, truncated, nil
+}
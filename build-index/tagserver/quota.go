@@ -0,0 +1,333 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package tagserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/uber/kraken/build-index/tagmodels"
+	"github.com/uber/kraken/build-index/tagstore"
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/utils/handler"
+	"github.com/uber/kraken/utils/log"
+
+	"github.com/c2h5oh/datasize"
+)
+
+// ErrQuotaExceeded is returned when a put would exceed the quota of the tag's
+// namespace.
+var ErrQuotaExceeded = errors.New("namespace quota exceeded")
+
+// QuotaConfig limits the tags stored under a namespace, where namespace is a
+// tag prefix, e.g. "team-foo/". A zero limit is unbounded.
+type QuotaConfig struct {
+	Namespace string            `yaml:"namespace"`
+	MaxTags   int64             `yaml:"max_tags"`
+	MaxBytes  datasize.ByteSize `yaml:"max_bytes"`
+}
+
+// QuotaUsage is a snapshot of the usage of a single namespace quota.
+type QuotaUsage struct {
+	Namespace string `json:"namespace"`
+	Tags      int64  `json:"tags"`
+	Bytes     int64  `json:"bytes"`
+	MaxTags   int64  `json:"max_tags,omitempty"`
+	MaxBytes  int64  `json:"max_bytes,omitempty"`
+}
+
+// quota tracks the usage of a namespace. Usage is maintained incrementally on
+// put, and periodically reconciled against the backend to correct drift, e.g.
+// from puts served by other build-index instances.
+type quota struct {
+	sync.Mutex
+	config QuotaConfig
+	tags   int64
+	bytes  int64
+
+	// Writes to the same tag are serialized, such that concurrent puts of a
+	// new tag reserve usage once.
+	writing map[string]chan struct{}
+}
+
+// lockTag blocks until no other write to tag is in progress. The returned
+// function unlocks tag.
+func (q *quota) lockTag(tag string) (unlock func()) {
+	for {
+		q.Lock()
+		done, ok := q.writing[tag]
+		if !ok {
+			done = make(chan struct{})
+			q.writing[tag] = done
+			q.Unlock()
+			return func() {
+				q.Lock()
+				delete(q.writing, tag)
+				q.Unlock()
+				close(done)
+			}
+		}
+		q.Unlock()
+		<-done
+	}
+}
+
+// reserve adds a new tag of size bytes to q's usage, or returns
+// ErrQuotaExceeded if q's limits do not allow it.
+func (q *quota) reserve(size int64) error {
+	q.Lock()
+	defer q.Unlock()
+
+	if q.config.MaxTags > 0 && q.tags+1 > q.config.MaxTags {
+		return ErrQuotaExceeded
+	}
+	if q.config.MaxBytes > 0 && q.bytes+size > int64(q.config.MaxBytes) {
+		return ErrQuotaExceeded
+	}
+	q.tags++
+	q.bytes += size
+	return nil
+}
+
+// release removes a tag of size bytes from q's usage, either reverting a
+// reservation or after the tag is deleted.
+func (q *quota) release(size int64) {
+	q.Lock()
+	defer q.Unlock()
+
+	// Usage may not include tags which were put elsewhere since the last
+	// reconciliation.
+	if q.tags > 0 {
+		q.tags--
+	}
+	q.bytes -= size
+	if q.bytes < 0 {
+		q.bytes = 0
+	}
+}
+
+// charge adds a tag of size bytes to the usage, regardless of the limits.
+func (q *quota) charge(size int64) {
+	q.Lock()
+	defer q.Unlock()
+
+	q.tags++
+	q.bytes += size
+}
+
+func (q *quota) set(tags, bytes int64) {
+	q.Lock()
+	defer q.Unlock()
+
+	q.tags = tags
+	q.bytes = bytes
+}
+
+func (q *quota) usage() QuotaUsage {
+	q.Lock()
+	defer q.Unlock()
+
+	return QuotaUsage{
+		Namespace: q.config.Namespace,
+		Tags:      q.tags,
+		Bytes:     q.bytes,
+		MaxTags:   q.config.MaxTags,
+		MaxBytes:  int64(q.config.MaxBytes),
+	}
+}
+
+type quotas []*quota
+
+func newQuotas(configs []QuotaConfig) quotas {
+	var qs quotas
+	for _, c := range configs {
+		qs = append(qs, &quota{config: c, writing: make(map[string]chan struct{})})
+	}
+	// Sort by descending namespace length such that the most specific
+	// namespace matches first.
+	sort.Slice(qs, func(i, j int) bool {
+		return len(qs[i].config.Namespace) > len(qs[j].config.Namespace)
+	})
+	return qs
+}
+
+// match returns the quota which applies to tag, or nil if no quota applies.
+func (qs quotas) match(tag string) *quota {
+	for _, q := range qs {
+		if strings.HasPrefix(tag, q.config.Namespace) {
+			return q
+		}
+	}
+	return nil
+}
+
+func (qs quotas) usage() []QuotaUsage {
+	usage := []QuotaUsage{}
+	for _, q := range qs {
+		usage = append(usage, q.usage())
+	}
+	sort.Slice(usage, func(i, j int) bool { return usage[i].Namespace < usage[j].Namespace })
+	return usage
+}
+
+// reconcileQuotasPeriodically reconciles all quotas on an interval, starting
+// immediately, until ctx is done.
+func (s *Server) reconcileQuotasPeriodically(ctx context.Context) {
+	ticker := s.clk.Ticker(s.config.QuotaReconcileInterval)
+	defer ticker.Stop()
+	for {
+		s.reconcileQuotas()
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Server) reconcileQuotas() {
+	for _, q := range s.quotas {
+		if err := s.reconcileQuota(q); err != nil {
+			log.With("namespace", q.config.Namespace).Errorf("Error reconciling quota: %s", err)
+			s.stats.Counter("quota_reconcile_failures").Inc(1)
+		}
+	}
+}
+
+// reserveQuota reserves usage for tag, if tag is new and falls under a quota.
+// Other writes to tag are blocked until the returned function is called with
+// whether tag was stored, which releases the reservation if it was not.
+func (s *Server) reserveQuota(tag string, size int64) (done func(stored bool), err error) {
+	q := s.quotas.match(tag)
+	if q == nil {
+		return func(bool) {}, nil
+	}
+	unlock := q.lockTag(tag)
+	if _, err := s.store.Get(tag); err == nil {
+		// Overwriting an existing tag does not change usage.
+		return func(bool) { unlock() }, nil
+	} else if err != tagstore.ErrTagNotFound {
+		unlock()
+		return nil, storageError(err)
+	}
+	if err := q.reserve(size); err != nil {
+		unlock()
+		s.stats.Counter("quota_exceeded").Inc(1)
+		return nil, handler.Errorf("namespace %s: %s", q.config.Namespace, err).
+			Status(http.StatusTooManyRequests).
+			Code(tagmodels.ErrCodeQuotaExceeded).
+			Detail("namespace", q.config.Namespace)
+	}
+	return func(stored bool) {
+		if !stored {
+			q.release(size)
+		}
+		unlock()
+	}, nil
+}
+
+// lockQuotaTag blocks other writes to tag, if tag falls under a quota. The
+// returned function unlocks tag.
+func (s *Server) lockQuotaTag(tag string) (unlock func()) {
+	q := s.quotas.match(tag)
+	if q == nil {
+		return func() {}
+	}
+	return q.lockTag(tag)
+}
+
+// releaseQuota removes tag, which resolved to d, from the usage of its quota
+// once tag is deleted.
+func (s *Server) releaseQuota(tag string, d core.Digest) {
+	q := s.quotas.match(tag)
+	if q == nil {
+		return
+	}
+	size, err := s.digestSize(tag, d)
+	if err != nil {
+		// The tag is still released, and its bytes are corrected on the
+		// next reconciliation.
+		log.With("tag", tag).Errorf("Error sizing deleted tag for quota: %s", err)
+	}
+	q.release(size)
+}
+
+// chargeQuota adds tag, which was undeleted and resolves to d, to the usage of
+// its quota. Undeleted tags are charged even if the quota is exceeded, since
+// their deletion is undone rather than new content written.
+func (s *Server) chargeQuota(tag string, d core.Digest) {
+	q := s.quotas.match(tag)
+	if q == nil {
+		return
+	}
+	size, err := s.digestSize(tag, d)
+	if err != nil {
+		log.With("tag", tag).Errorf("Error sizing undeleted tag for quota: %s", err)
+	}
+	q.charge(size)
+}
+
+// reconcileQuota recomputes the usage of q from the tags in the backend.
+func (s *Server) reconcileQuota(q *quota) error {
+	client, err := s.backends.GetClient(q.config.Namespace)
+	if err != nil {
+		return fmt.Errorf("backend manager: %s", err)
+	}
+	result, err := client.List(q.config.Namespace)
+	if err != nil {
+		return fmt.Errorf("list: %s", err)
+	}
+	var bytes int64
+	for _, tag := range result.Names {
+		size, err := s.tagSize(tag)
+		if err != nil {
+			return fmt.Errorf("size of tag %s: %s", tag, err)
+		}
+		bytes += size
+	}
+	q.set(int64(len(result.Names)), bytes)
+	return nil
+}
+
+// tagSize returns the total size of the blobs tag depends on.
+func (s *Server) tagSize(tag string) (int64, error) {
+	d, err := s.store.Get(tag)
+	if err != nil {
+		return 0, fmt.Errorf("storage: %s", err)
+	}
+	return s.digestSize(tag, d)
+}
+
+// digestSize returns the total size of the blobs tag, which resolves to d,
+// depends on.
+func (s *Server) digestSize(tag string, d core.Digest) (int64, error) {
+	deps, err := s.depResolver.Resolve(tag, d)
+	if err != nil {
+		return 0, fmt.Errorf("resolve dependencies: %s", err)
+	}
+	var size int64
+	for _, dep := range deps {
+		info, err := s.localOriginClient.Stat(tag, dep)
+		if err != nil {
+			return 0, fmt.Errorf("stat %s: %s", dep, err)
+		}
+		size += info.Size
+	}
+	return size, nil
+}
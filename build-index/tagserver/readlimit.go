@@ -0,0 +1,176 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package tagserver
+
+import (
+	"container/list"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/uber/kraken/build-index/tagmodels"
+	"github.com/uber/kraken/utils/handler"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/uber-go/tally"
+	"golang.org/x/time/rate"
+)
+
+// ReadLimitConfig defines rate limiting of tag reads. Each namespace, and
+// optionally each principal within a namespace, reads from its own token
+// bucket, such that a flood of reads in one namespace does not throttle reads
+// in other namespaces. Throttled reads are rejected with 429.
+type ReadLimitConfig struct {
+	Enabled bool `yaml:"enabled"`
+
+	// RPS and Burst are the default limits of each namespace.
+	RPS   float64 `yaml:"rps"`
+	Burst int     `yaml:"burst"`
+
+	// PerPrincipal limits each principal within a namespace separately, instead
+	// of all principals sharing the limit of the namespace.
+	PerPrincipal bool `yaml:"per_principal"`
+
+	// Overrides replace the default limits of specific namespaces.
+	Overrides []ReadLimitOverride `yaml:"overrides"`
+
+	// MaxBuckets bounds the buckets kept in memory. The buckets of the least
+	// recently read namespaces are dropped first, and start full if read again.
+	MaxBuckets int `yaml:"max_buckets"`
+}
+
+// ReadLimitOverride defines the read limits of a single namespace.
+type ReadLimitOverride struct {
+	Namespace string  `yaml:"namespace"`
+	RPS       float64 `yaml:"rps"`
+	Burst     int     `yaml:"burst"`
+}
+
+func (c ReadLimitConfig) applyDefaults() ReadLimitConfig {
+	if c.RPS == 0 {
+		c.RPS = 100
+	}
+	if c.Burst == 0 {
+		c.Burst = int(math.Ceil(c.RPS))
+	}
+	if c.MaxBuckets == 0 {
+		c.MaxBuckets = 10000
+	}
+	return c
+}
+
+type readLimitKey struct {
+	namespace string
+	principal string
+}
+
+type readBucket struct {
+	key     readLimitKey
+	limiter *rate.Limiter
+}
+
+// readLimiter holds the token buckets of recently read namespaces.
+type readLimiter struct {
+	config    ReadLimitConfig
+	clk       clock.Clock
+	stats     tally.Scope
+	overrides map[string]ReadLimitOverride
+
+	mu      sync.Mutex
+	buckets map[readLimitKey]*list.Element // To *readBucket.
+	lru     *list.List
+}
+
+func newReadLimiter(config ReadLimitConfig, clk clock.Clock, stats tally.Scope) *readLimiter {
+	config = config.applyDefaults()
+	overrides := make(map[string]ReadLimitOverride)
+	for _, o := range config.Overrides {
+		if o.Burst == 0 {
+			o.Burst = int(math.Ceil(o.RPS))
+		}
+		overrides[o.Namespace] = o
+	}
+	return &readLimiter{
+		config:    config,
+		clk:       clk,
+		stats:     stats.SubScope("read_limit"),
+		overrides: overrides,
+		buckets:   make(map[readLimitKey]*list.Element),
+		lru:       list.New(),
+	}
+}
+
+// reserve takes a token from the bucket of namespace and principal. If the
+// bucket is empty, returns false and how long until a token is available.
+func (l *readLimiter) reserve(namespace, principal string) (bool, time.Duration) {
+	if !l.config.PerPrincipal {
+		principal = ""
+	}
+	now := l.clk.Now()
+	r := l.bucket(readLimitKey{namespace, principal}).ReserveN(now, 1)
+	if !r.OK() {
+		return false, time.Second
+	}
+	if delay := r.DelayFrom(now); delay > 0 {
+		r.CancelAt(now)
+		return false, delay
+	}
+	return true, 0
+}
+
+// bucket returns the limiter of k, creating it if necessary.
+func (l *readLimiter) bucket(k readLimitKey) *rate.Limiter {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if el, ok := l.buckets[k]; ok {
+		l.lru.MoveToFront(el)
+		return el.Value.(*readBucket).limiter
+	}
+	rps, burst := l.config.RPS, l.config.Burst
+	if o, ok := l.overrides[k.namespace]; ok {
+		rps, burst = o.RPS, o.Burst
+	}
+	b := &readBucket{k, rate.NewLimiter(rate.Limit(rps), burst)}
+	l.buckets[k] = l.lru.PushFront(b)
+	if l.lru.Len() > l.config.MaxBuckets {
+		oldest := l.lru.Remove(l.lru.Back()).(*readBucket)
+		delete(l.buckets, oldest.key)
+		l.stats.Counter("evictions").Inc(1)
+	}
+	return b.limiter
+}
+
+// limitReads is a middleware which rejects reads exceeding the read limit of
+// their namespace.
+func (s *Server) limitReads(next http.Handler) http.Handler {
+	return handler.Wrap(func(w http.ResponseWriter, r *http.Request) error {
+		if s.readLimiter != nil {
+			namespace := requestNamespace(r)
+			if ok, delay := s.readLimiter.reserve(namespace, s.principal(r)); !ok {
+				s.readLimiter.stats.Counter("throttled").Inc(1)
+				retryAfter := int(math.Ceil(delay.Seconds()))
+				return handler.Errorf("namespace %s: read rate limit exceeded", namespace).
+					Status(http.StatusTooManyRequests).
+					Header("Retry-After", strconv.Itoa(retryAfter)).
+					Code(tagmodels.ErrCodeRateLimited).
+					Detail("namespace", namespace)
+			}
+		}
+		next.ServeHTTP(w, r)
+		return nil
+	})
+}
@@ -0,0 +1,151 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package tagserver
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/uber/kraken/build-index/tagclient"
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/utils/httputil"
+	"github.com/uber/kraken/utils/testutil"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+	"github.com/uber-go/tally"
+)
+
+func TestReadLimitIsolatesNamespaces(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t)
+	defer cleanup()
+
+	// Negligible refill, such that only the burst is served.
+	mocks.config.ReadLimit = ReadLimitConfig{Enabled: true, RPS: 0.001, Burst: 3}
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	flooded := "flooded/repo:latest"
+	quiet := "quiet/repo:latest"
+	digest := core.DigestFixture()
+
+	mocks.store.EXPECT().GetContext(gomock.Any(), flooded).Return(digest, nil).Times(3)
+	mocks.store.EXPECT().GetContext(gomock.Any(), quiet).Return(digest, nil).Times(3)
+
+	get := func(tag string) error {
+		_, err := httputil.Get(fmt.Sprintf("http://%s/tags/%s", addr, url.PathEscape(tag)))
+		return err
+	}
+
+	var throttled int
+	for i := 0; i < 10; i++ {
+		err := get(flooded)
+		if err == nil {
+			continue
+		}
+		require.True(httputil.IsStatus(err, http.StatusTooManyRequests))
+		serr := err.(httputil.StatusError)
+		require.Equal("1000", serr.Header.Get("Retry-After"))
+		throttled++
+	}
+	require.Equal(7, throttled)
+
+	// Reads of another namespace are unaffected by the flood.
+	for i := 0; i < 3; i++ {
+		require.NoError(get(quiet))
+	}
+
+	c := tagclient.NewSingleClient(addr, nil)
+	_, err := c.Get(flooded)
+	require.Equal(tagclient.ErrRateLimited, err)
+}
+
+func TestReadLimitPerPrincipal(t *testing.T) {
+	require := require.New(t)
+
+	l := newReadLimiter(ReadLimitConfig{
+		Enabled:      true,
+		RPS:          1,
+		Burst:        1,
+		PerPrincipal: true,
+	}, clock.NewMock(), tally.NoopScope)
+
+	ok, _ := l.reserve("repo", "alice")
+	require.True(ok)
+	ok, _ = l.reserve("repo", "alice")
+	require.False(ok)
+
+	ok, _ = l.reserve("repo", "bob")
+	require.True(ok)
+}
+
+func TestReadLimitRefillAndOverrides(t *testing.T) {
+	require := require.New(t)
+
+	clk := clock.NewMock()
+	l := newReadLimiter(ReadLimitConfig{
+		Enabled: true,
+		RPS:     1,
+		Overrides: []ReadLimitOverride{
+			{Namespace: "hot", RPS: 10, Burst: 5},
+		},
+	}, clk, tally.NoopScope)
+
+	ok, _ := l.reserve("repo", "")
+	require.True(ok)
+	ok, delay := l.reserve("repo", "")
+	require.False(ok)
+	require.Equal(time.Second, delay)
+
+	clk.Add(time.Second)
+	ok, _ = l.reserve("repo", "")
+	require.True(ok)
+
+	for i := 0; i < 5; i++ {
+		ok, _ = l.reserve("hot", "")
+		require.True(ok)
+	}
+	ok, delay = l.reserve("hot", "")
+	require.False(ok)
+	require.Equal(100*time.Millisecond, delay)
+}
+
+func TestReadLimitBoundsBuckets(t *testing.T) {
+	require := require.New(t)
+
+	l := newReadLimiter(ReadLimitConfig{
+		Enabled:    true,
+		RPS:        1,
+		MaxBuckets: 2,
+	}, clock.NewMock(), tally.NoopScope)
+
+	for _, ns := range []string{"a", "b", "c"} {
+		ok, _ := l.reserve(ns, "")
+		require.True(ok)
+	}
+	require.Len(l.buckets, 2)
+
+	// The bucket of a was dropped, so a starts full again.
+	ok, _ := l.reserve("a", "")
+	require.True(ok)
+	ok, _ = l.reserve("c", "")
+	require.False(ok)
+}
@@ -0,0 +1,172 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package tagserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/uber/kraken/build-index/tagmodels"
+	"github.com/uber/kraken/utils/handler"
+	"github.com/uber/kraken/utils/httputil"
+	"github.com/uber/kraken/utils/log"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/uber-go/tally"
+)
+
+// ReadOnlyConfig defines degraded read-only operation. While read-only, reads
+// are served as usual however writes are rejected with 503.
+type ReadOnlyConfig struct {
+	// Auto enters read-only mode when a critical dependency of writes, such
+	// as the replication store, fails.
+	Auto bool `yaml:"auto"`
+
+	// Cooldown is how long the server stays read-only after a dependency
+	// failure before writes are attempted again.
+	Cooldown time.Duration `yaml:"cooldown"`
+}
+
+func (c ReadOnlyConfig) applyDefaults() ReadOnlyConfig {
+	if c.Cooldown == 0 {
+		c.Cooldown = 30 * time.Second
+	}
+	return c
+}
+
+// ReadOnlyStatus describes the current read-only mode of the server.
+type ReadOnlyStatus struct {
+	ReadOnly bool   `json:"read_only"`
+	Forced   bool   `json:"forced"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+// readOnlyMode tracks whether the server is read-only, either because an admin
+// forced it or because a dependency recently failed.
+type readOnlyMode struct {
+	config ReadOnlyConfig
+	clk    clock.Clock
+	stats  tally.Scope
+
+	mu            sync.Mutex
+	forced        bool
+	degradedUntil time.Time
+	reason        string
+	active        bool
+}
+
+func newReadOnlyMode(config ReadOnlyConfig, clk clock.Clock, stats tally.Scope) *readOnlyMode {
+	return &readOnlyMode{config: config, clk: clk, stats: stats}
+}
+
+// status returns the current mode, emitting a transition if a degraded period
+// has elapsed.
+func (m *readOnlyMode) status() ReadOnlyStatus {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.update()
+	s := ReadOnlyStatus{ReadOnly: m.active, Forced: m.forced}
+	if m.active {
+		s.Reason = m.reason
+	}
+	return s
+}
+
+// force enables or disables admin-forced read-only mode.
+func (m *readOnlyMode) force(enabled bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.forced = enabled
+	if enabled {
+		m.reason = "forced by admin"
+	}
+	m.update()
+}
+
+// fail records a failure of dependency, entering read-only mode for the
+// configured cooldown if automatic mode is enabled.
+func (m *readOnlyMode) fail(dependency string, err error) {
+	if !m.config.Auto {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.degradedUntil = m.clk.Now().Add(m.config.Cooldown)
+	if !m.forced {
+		m.reason = dependency + " unavailable: " + err.Error()
+	}
+	m.update()
+}
+
+// update recomputes whether the server is read-only and emits mode transitions.
+// Must be called with mu held.
+func (m *readOnlyMode) update() {
+	active := m.forced || m.clk.Now().Before(m.degradedUntil)
+	if active == m.active {
+		return
+	}
+	m.active = active
+
+	mode := "read_write"
+	var gauge float64
+	if active {
+		mode = "read_only"
+		gauge = 1
+	}
+	m.stats.Tagged(map[string]string{"mode": mode}).Counter("mode_transitions").Inc(1)
+	m.stats.Gauge("read_only").Update(gauge)
+	if active {
+		log.With("reason", m.reason).Warn("Entering read-only mode")
+	} else {
+		log.Info("Leaving read-only mode")
+	}
+}
+
+// rejectWritesWhenReadOnly is a middleware which rejects requests while the
+// server is read-only.
+func (s *Server) rejectWritesWhenReadOnly(next http.Handler) http.Handler {
+	return handler.Wrap(func(w http.ResponseWriter, r *http.Request) error {
+		if status := s.readOnly.status(); status.ReadOnly {
+			return handler.Errorf("server is read-only: %s", status.Reason).
+				Status(http.StatusServiceUnavailable).
+				Code(tagmodels.ErrCodeReadOnly)
+		}
+		next.ServeHTTP(w, r)
+		return nil
+	})
+}
+
+// readOnlyHandler returns the current read-only mode.
+func (s *Server) readOnlyHandler(w http.ResponseWriter, r *http.Request) error {
+	if err := json.NewEncoder(w).Encode(s.readOnly.status()); err != nil {
+		return handler.Errorf("json encode: %s", err)
+	}
+	return nil
+}
+
+// setReadOnlyHandler forces read-only mode on or off.
+func (s *Server) setReadOnlyHandler(w http.ResponseWriter, r *http.Request) error {
+	enabled, err := strconv.ParseBool(httputil.GetQueryArg(r, "enabled", "true"))
+	if err != nil {
+		return handler.Errorf("parse query arg `enabled`: %s", err).Status(http.StatusBadRequest)
+	}
+	s.readOnly.force(enabled)
+	return s.readOnlyHandler(w, r)
+}
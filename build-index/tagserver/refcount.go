@@ -0,0 +1,97 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package tagserver
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/utils/handler"
+	"github.com/uber/kraken/utils/httputil"
+	"github.com/uber/kraken/utils/log"
+)
+
+// ReconcileRefCountsResponse reports the outcome of a reference count
+// reconciliation.
+type ReconcileRefCountsResponse struct {
+	Tags      int `json:"tags"`
+	Corrected int `json:"corrected"`
+}
+
+// addReferences records that tag references deps. Errors are logged, since the
+// tag is already stored and drifted counts are corrected by reconciliation.
+func (s *Server) addReferences(tag string, deps core.DigestList) {
+	if s.refs == nil {
+		return
+	}
+	released, err := s.refs.Put(tag, deps)
+	if err != nil {
+		s.stats.Counter("refcount_errors").Inc(1)
+		log.With("tag", tag).Errorf("Error adding blob references: %s", err)
+		return
+	}
+	s.releaseBlobs(tag, released)
+}
+
+// removeReferences drops the references of tag. Errors are logged, since the
+// tag is already deleted and drifted counts are corrected by reconciliation.
+func (s *Server) removeReferences(tag string) {
+	released, err := s.refs.Delete(tag)
+	if err != nil {
+		s.stats.Counter("refcount_errors").Inc(1)
+		log.With("tag", tag).Errorf("Error removing blob references: %s", err)
+		return
+	}
+	s.releaseBlobs(tag, released)
+}
+
+// releaseBlobs queues blobs which are no longer referenced by any tag known
+// to this build-index for the next eviction sweep, if blob eviction is enabled.
+// The sweep only marks them as eviction candidates if no tag put through other
+// build-index hosts references them either.
+func (s *Server) releaseBlobs(tag string, released []core.Digest) {
+	s.stats.Counter("released_blobs").Inc(int64(len(released)))
+	if !s.config.BlobEviction.Enabled {
+		return
+	}
+	s.released.add(tag, released, s.clk.Now())
+}
+
+// reconcileRefCountsHandler recomputes the reference counts of blobs from a
+// full scan of the tags under the prefix query argument.
+func (s *Server) reconcileRefCountsHandler(w http.ResponseWriter, r *http.Request) error {
+	if s.refs == nil {
+		return handler.Errorf("reference counting not enabled").Status(http.StatusNotImplemented)
+	}
+	prefix := httputil.GetQueryArg(r, "prefix", "")
+	if prefix == "" {
+		return handler.Errorf("query arg `prefix` required").Status(http.StatusBadRequest)
+	}
+	tags, err := s.scanDependencies(r.Context(), prefix)
+	if err != nil {
+		return err
+	}
+	corrected, err := s.refs.Reconcile(prefix, tags)
+	if err != nil {
+		return handler.Errorf("reconcile: %s", err)
+	}
+	s.stats.Counter("refcount_corrections").Inc(int64(corrected))
+	w.Header().Set("Content-Type", "application/json")
+	resp := ReconcileRefCountsResponse{Tags: len(tags), Corrected: corrected}
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		return handler.Errorf("json encode: %s", err)
+	}
+	return nil
+}
@@ -14,7 +14,9 @@
 package tagserver
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -24,26 +26,34 @@ import (
 	"strings"
 	"time"
 
+	"github.com/uber/kraken/build-index/tagaudit"
 	"github.com/uber/kraken/build-index/tagclient"
 	"github.com/uber/kraken/build-index/tagmodels"
+	"github.com/uber/kraken/build-index/tagrefs"
 	"github.com/uber/kraken/build-index/tagstore"
 	"github.com/uber/kraken/build-index/tagtype"
 	"github.com/uber/kraken/core"
 	"github.com/uber/kraken/lib/backend"
 	"github.com/uber/kraken/lib/backend/backenderrors"
+	"github.com/uber/kraken/lib/faults"
 	"github.com/uber/kraken/lib/hostlist"
 	"github.com/uber/kraken/lib/middleware"
 	"github.com/uber/kraken/lib/persistedretry"
 	"github.com/uber/kraken/lib/persistedretry/tagreplication"
+	"github.com/uber/kraken/lib/slo"
+	"github.com/uber/kraken/metrics"
 	"github.com/uber/kraken/origin/blobclient"
 	"github.com/uber/kraken/utils/handler"
 	"github.com/uber/kraken/utils/httputil"
 	"github.com/uber/kraken/utils/listener"
 	"github.com/uber/kraken/utils/log"
+	"github.com/uber/kraken/utils/stringset"
 
+	"github.com/andres-erbsen/clock"
 	"github.com/pressly/chi"
 	chimiddleware "github.com/pressly/chi/middleware"
 	"github.com/uber-go/tally"
+	"golang.org/x/time/rate"
 )
 
 // Server provides tag operations for the build-index.
@@ -58,11 +68,135 @@ type Server struct {
 
 	// For async new tag replication.
 	remotes               tagreplication.Remotes
+	mirrors               tagreplication.Remotes
 	tagReplicationManager persistedretry.Manager
 	provider              tagclient.Provider
 
 	// For checking if a tag has all dependent blobs.
 	depResolver tagtype.DependencyResolver
+
+	// For inspecting requests currently being served.
+	inflight *inflightRegistry
+
+	// For limiting the usage of namespaces.
+	quotas quotas
+
+	// For resolving missing tags from fallback namespaces.
+	fallbacks fallbacks
+
+	// For authorizing requests.
+	authorizer Authorizer
+
+	// For rejecting malformed tag names.
+	tagNames *tagNameValidator
+
+	// For collapsing identical concurrent replications.
+	replications *replicationDedup
+
+	// For rejecting writes during partial outages.
+	readOnly *readOnlyMode
+
+	// For throttling reads per namespace. Nil if disabled.
+	readLimiter *readLimiter
+
+	// For throttling admin-triggered preloads.
+	preloadLimiter *rate.Limiter
+
+	// For injecting faults at runtime, in chaos tests.
+	faults *faults.Injector
+
+	// For recording tag mutations in a tamper-evident log.
+	auditLog *tagaudit.Log
+
+	// For reporting which remotes acknowledged replications. Nil if disabled.
+	replicas *tagreplication.Store
+
+	// For pausing replication to remotes under maintenance. Nil if disabled.
+	pausedRemotes *tagreplication.PausedRemotes
+
+	// For reporting in-flight replications of each namespace. Nil if disabled.
+	namespaceLimiter *tagreplication.NamespaceLimiter
+
+	// For counting the tags which reference each blob. Nil if disabled.
+	refs *tagrefs.Store
+
+	// For evicting blobs once a sweep confirmed no tag references them.
+	released *releasedBlobs
+
+	// For reporting service level indicators. Nil if disabled.
+	slos *slo.Registry
+
+	// Buckets of endpoint latency histograms.
+	histograms metrics.HistogramsConfig
+
+	clk clock.Clock
+}
+
+// Option allows setting optional Server parameters.
+type Option func(*Server)
+
+// WithClock configures the clock used for cache expiry, read-only cooldowns and
+// in-flight operation timing.
+func WithClock(clk clock.Clock) Option {
+	return func(s *Server) { s.clk = clk }
+}
+
+// WithFaultInjector mounts the admin endpoint of f, which controls the faults
+// injected by f at runtime. Does nothing if f is nil.
+func WithFaultInjector(f *faults.Injector) Option {
+	return func(s *Server) { s.faults = f }
+}
+
+// WithAuditLog configures the Server to record tag mutations in l. Mutations
+// are only acknowledged once recorded. Does nothing if l is nil.
+func WithAuditLog(l *tagaudit.Log) Option {
+	return func(s *Server) { s.auditLog = l }
+}
+
+// WithReplicaStore configures the Server to report the remotes which
+// acknowledged replications of tags, as recorded in rs. Does nothing if rs is
+// nil.
+func WithReplicaStore(rs *tagreplication.Store) Option {
+	return func(s *Server) { s.replicas = rs }
+}
+
+// WithMirrors configures the object-store mirrors which tags are replicated to
+// alongside remotes. Unlike remotes, mirrors cannot be excluded or paused, and
+// are not reported as replica remotes.
+func WithMirrors(mirrors tagreplication.Remotes) Option {
+	return func(s *Server) { s.mirrors = mirrors }
+}
+
+// WithPausedRemotes exposes admin endpoints which pause and resume replication
+// to remotes via p. Does nothing if p is nil.
+func WithPausedRemotes(p *tagreplication.PausedRemotes) Option {
+	return func(s *Server) { s.pausedRemotes = p }
+}
+
+// WithNamespaceLimiter exposes an admin endpoint which reports the in-flight
+// replications of each namespace, as bounded by l. Does nothing if l is nil.
+func WithNamespaceLimiter(l *tagreplication.NamespaceLimiter) Option {
+	return func(s *Server) { s.namespaceLimiter = l }
+}
+
+// WithSLOs serves the service level indicators of r under /status/slo. Does
+// nothing if r is nil.
+func WithSLOs(r *slo.Registry) Option {
+	return func(s *Server) { s.slos = r }
+}
+
+// WithHistograms configures the buckets of the latency histograms of tag
+// endpoints.
+func WithHistograms(config metrics.HistogramsConfig) Option {
+	return func(s *Server) { s.histograms = config }
+}
+
+// WithRefCounts configures the Server to count the tags which reference each
+// blob in refs. With blob eviction enabled, blobs are marked as eviction
+// candidates once their count reaches zero, instead of once no tag of the same
+// repository references them. Does nothing if refs is nil.
+func WithRefCounts(refs *tagrefs.Store) Option {
+	return func(s *Server) { s.refs = refs }
 }
 
 // New creates a new Server.
@@ -77,7 +211,8 @@ func New(
 	remotes tagreplication.Remotes,
 	tagReplicationManager persistedretry.Manager,
 	provider tagclient.Provider,
-	depResolver tagtype.DependencyResolver) *Server {
+	depResolver tagtype.DependencyResolver,
+	opts ...Option) (*Server, error) {
 
 	config = config.applyDefaults()
 
@@ -85,7 +220,7 @@ func New(
 		"module": "tagserver",
 	})
 
-	return &Server{
+	s := &Server{
 		config:                config,
 		stats:                 stats,
 		backends:              backends,
@@ -97,7 +232,33 @@ func New(
 		tagReplicationManager: tagReplicationManager,
 		provider:              provider,
 		depResolver:           depResolver,
+		quotas:                newQuotas(config.Quotas),
+		fallbacks:             newFallbacks(config.Fallbacks),
+		released:              newReleasedBlobs(),
+		clk:                   clock.New(),
+	}
+	for _, opt := range opts {
+		opt(s)
 	}
+	s.inflight = newInflightRegistry(s.clk)
+	s.authorizer = newAuthorizer(config.Authz, s.clk, stats)
+	s.readOnly = newReadOnlyMode(config.ReadOnly, s.clk, stats)
+	tagNames, err := newTagNameValidator(config.TagName)
+	if err != nil {
+		return nil, fmt.Errorf("tag name: %s", err)
+	}
+	s.tagNames = tagNames
+	if config.BlobEviction.Enabled {
+		if err := config.BlobEviction.validateScanPrefixes(backends); err != nil {
+			return nil, fmt.Errorf("blob eviction: %s", err)
+		}
+	}
+	s.replications = newReplicationDedup(config.ReplicateDedupWindow, s.clk)
+	s.preloadLimiter = rate.NewLimiter(rate.Limit(config.Preload.RPS), 1)
+	if config.ReadLimit.Enabled {
+		s.readLimiter = newReadLimiter(config.ReadLimit, s.clk, stats)
+	}
+	return s, nil
 }
 
 // Handler returns an http.Handler for s.
@@ -105,39 +266,127 @@ func (s *Server) Handler() http.Handler {
 	r := chi.NewRouter()
 
 	r.Use(middleware.StatusCounter(s.stats))
-	r.Use(middleware.LatencyTimer(s.stats))
+	r.Use(middleware.LatencyTimer(s.stats, s.latencyHistograms()...))
+	r.Use(middleware.Deadline())
 
 	r.Get("/health", handler.Wrap(s.healthHandler))
 
-	r.Put("/tags/{tag}/digest/{digest}", handler.Wrap(s.putTagHandler))
-	r.Head("/tags/{tag}", handler.Wrap(s.hasTagHandler))
-	r.Get("/tags/{tag}", handler.Wrap(s.getTagHandler))
+	if s.slos != nil {
+		r.Get("/status/slo", handler.Wrap(s.slos.Handler))
+	}
 
-	r.Get("/repositories/{repo}/tags", handler.Wrap(s.listRepositoryHandler))
+	r.Group(func(r chi.Router) {
+		r.Use(s.inflight.track)
 
-	r.Get("/list/*", handler.Wrap(s.listHandler))
+		r.With(s.authorize(opWrite), s.rejectWritesWhenReadOnly).Put(
+			"/tags/{tag}/digest/{digest}", handler.Wrap(s.putTagHandler))
+		r.With(s.authorize(opRead), s.limitReads).Head("/tags/{tag}", handler.Wrap(s.hasTagHandler))
+		r.With(s.authorize(opRead), s.limitReads).Get("/tags/{tag}", handler.Wrap(s.getTagHandler))
+		r.With(s.authorize(opWrite), s.rejectWritesWhenReadOnly).Delete(
+			"/tags/{tag}", handler.Wrap(s.deleteTagHandler))
+		r.With(s.authorize(opWrite), s.rejectWritesWhenReadOnly).Post(
+			"/tags/{tag}/undelete", handler.Wrap(s.undeleteTagHandler))
 
-	r.Post("/remotes/tags/{tag}", handler.Wrap(s.replicateTagHandler))
+		r.With(s.authorize(opRead)).Get("/repositories/{repo}/tags", handler.Wrap(s.listRepositoryHandler))
 
-	r.Get("/origin", handler.Wrap(s.getOriginHandler))
+		r.With(s.authorize(opRead)).Get("/list/*", handler.Wrap(s.listHandler))
 
-	r.Post(
-		"/internal/duplicate/remotes/tags/{tag}/digest/{digest}",
-		handler.Wrap(s.duplicateReplicateTagHandler))
+		r.With(s.authorize(opReplicate), s.rejectWritesWhenReadOnly).Post(
+			"/remotes/tags/{tag}", handler.Wrap(s.replicateTagHandler))
+		r.With(s.rejectWritesWhenReadOnly).Post(
+			"/remotes/tags", handler.Wrap(s.replicateBatchHandler))
+		r.With(s.authorize(opRead)).Get("/remotes/tags/{tag}", handler.Wrap(s.getReplicaRemotesHandler))
 
-	r.Put(
-		"/internal/duplicate/tags/{tag}/digest/{digest}",
-		handler.Wrap(s.duplicatePutTagHandler))
+		r.Get("/origin", handler.Wrap(s.getOriginHandler))
+
+		if s.config.EnableOriginAvailability {
+			r.Get(
+				"/namespace/{namespace}/blobs/{digest}/origin",
+				handler.Wrap(s.getPullableOriginsHandler))
+		}
+
+		r.With(s.rejectWritesWhenReadOnly).Post(
+			"/internal/duplicate/remotes/tags/{tag}/digest/{digest}",
+			handler.Wrap(s.duplicateReplicateTagHandler))
+
+		r.With(s.rejectWritesWhenReadOnly).Put(
+			"/internal/duplicate/tags/{tag}/digest/{digest}",
+			handler.Wrap(s.duplicatePutTagHandler))
+
+		r.Post("/internal/invalidate/tags/{tag}", handler.Wrap(s.invalidateTagHandler))
+	})
 
 	r.Mount("/debug", chimiddleware.Profiler())
 
+	if s.config.EnableAdmin {
+		r.Get("/admin/inflight", handler.Wrap(s.inflightHandler))
+		r.Get("/admin/quotas", handler.Wrap(s.quotasHandler))
+		r.Get("/admin/readonly", handler.Wrap(s.readOnlyHandler))
+		r.Put("/admin/readonly", handler.Wrap(s.setReadOnlyHandler))
+		r.Post("/admin/preload", handler.Wrap(s.preloadHandler))
+		r.Post("/admin/refcounts/reconcile", handler.Wrap(s.reconcileRefCountsHandler))
+		r.Get("/admin/replication/paused", handler.Wrap(s.pausedRemotesHandler))
+		r.Put("/admin/replication/paused/{remote}", handler.Wrap(s.pauseRemoteHandler))
+		r.Delete("/admin/replication/paused/{remote}", handler.Wrap(s.resumeRemoteHandler))
+		r.Get("/admin/replication/inflight", handler.Wrap(s.inflightReplicationsHandler))
+
+		// Pauses are only ever duplicated from the admin endpoints of
+		// neighbors, which share the config of s.
+		r.Put(
+			"/internal/duplicate/replication/paused/{remote}",
+			handler.Wrap(s.duplicatePauseRemoteHandler))
+		r.Delete(
+			"/internal/duplicate/replication/paused/{remote}",
+			handler.Wrap(s.duplicateResumeRemoteHandler))
+		if s.auditLog != nil {
+			r.Get("/admin/audit/verify", handler.Wrap(s.verifyAuditLogHandler))
+		}
+	}
+
+	if s.faults != nil {
+		r.Mount("/admin/faults", s.faults.Handler())
+	}
+
 	return r
 }
 
+// latencyHistograms returns the endpoints whose latencies are recorded with
+// configured histogram buckets.
+func (s *Server) latencyHistograms() []middleware.EndpointHistogram {
+	var histograms []middleware.EndpointHistogram
+	if len(s.histograms.TagGet) > 0 {
+		histograms = append(histograms, middleware.EndpointHistogram{
+			Method:   http.MethodGet,
+			Endpoint: "tags",
+			Buckets:  tally.DurationBuckets(s.histograms.TagGet),
+		})
+	}
+	if len(s.histograms.TagPut) > 0 {
+		histograms = append(histograms, middleware.EndpointHistogram{
+			Method:   http.MethodPut,
+			Endpoint: "tags.digest",
+			Buckets:  tally.DurationBuckets(s.histograms.TagPut),
+		})
+	}
+	return histograms
+}
+
 // ListenAndServe is a blocking call which runs s.
 func (s *Server) ListenAndServe() error {
+	return s.ListenAndServeContext(context.Background())
+}
+
+// ListenAndServeContext is like ListenAndServe, but gracefully shuts down once
+// ctx is done, waiting for in-flight requests to complete.
+func (s *Server) ListenAndServeContext(ctx context.Context) error {
 	log.Infof("Starting tag server on %s", s.config.Listener)
-	return listener.Serve(s.config.Listener, s.Handler())
+	if len(s.quotas) > 0 {
+		go s.reconcileQuotasPeriodically(ctx)
+	}
+	if s.config.BlobEviction.Enabled {
+		go s.sweepReleasesPeriodically(ctx)
+	}
+	return listener.ServeContext(ctx, s.config.Listener, s.Handler())
 }
 
 func (s *Server) healthHandler(w http.ResponseWriter, r *http.Request) error {
@@ -145,11 +394,55 @@ func (s *Server) healthHandler(w http.ResponseWriter, r *http.Request) error {
 	return nil
 }
 
+// inflightHandler returns a snapshot of requests currently being served.
+func (s *Server) inflightHandler(w http.ResponseWriter, r *http.Request) error {
+	if err := json.NewEncoder(w).Encode(s.inflight.snapshot()); err != nil {
+		return handler.Errorf("json encode: %s", err)
+	}
+	return nil
+}
+
+// audit records the principal of r performing operation on tag pointing to d
+// in the audit log, if configured. Since mutations are idempotent, clients
+// retrying mutations which could not be recorded record them eventually.
+func (s *Server) audit(r *http.Request, operation, tag string, d core.Digest) error {
+	if err := s.auditLog.Append(s.principal(r), operation, tag, d); err != nil {
+		return handler.Errorf("audit: %s", err)
+	}
+	return nil
+}
+
+// verifyAuditLogHandler verifies the hash chain of the audit log.
+func (s *Server) verifyAuditLogHandler(w http.ResponseWriter, r *http.Request) error {
+	n, err := s.auditLog.Verify()
+	if err != nil {
+		return handler.Errorf("verify %d entries: %s", n, err)
+	}
+	if err := json.NewEncoder(w).Encode(map[string]int{"entries": n}); err != nil {
+		return handler.Errorf("json encode: %s", err)
+	}
+	return nil
+}
+
+// quotasHandler returns the current usage of all namespace quotas.
+func (s *Server) quotasHandler(w http.ResponseWriter, r *http.Request) error {
+	if err := json.NewEncoder(w).Encode(s.quotas.usage()); err != nil {
+		return handler.Errorf("json encode: %s", err)
+	}
+	return nil
+}
+
 func (s *Server) putTagHandler(w http.ResponseWriter, r *http.Request) error {
+	if err := s.limitPutBody(w, r); err != nil {
+		return err
+	}
 	tag, err := httputil.ParseParam(r, "tag")
 	if err != nil {
 		return err
 	}
+	if err := s.checkTagName(tag); err != nil {
+		return err
+	}
 	d, err := httputil.ParseDigest(r, "digest")
 	if err != nil {
 		return err
@@ -158,17 +451,40 @@ func (s *Server) putTagHandler(w http.ResponseWriter, r *http.Request) error {
 	if err != nil {
 		return handler.Errorf("parse query arg `replicate`: %s", err)
 	}
+	translated, err := s.parseTranslatedDigest(r)
+	if err != nil {
+		return err
+	}
+	priority, err := strconv.Atoi(httputil.GetQueryArg(r, "priority", "0"))
+	if err != nil || priority < 0 {
+		return handler.Errorf("invalid query arg `priority`").Status(http.StatusBadRequest)
+	}
+	if err := s.checkTagValue(d.String()); err != nil {
+		return err
+	}
 
+	setStage(r.Context(), stageResolvingDependencies)
 	deps, err := s.depResolver.Resolve(tag, d)
 	if err != nil {
 		return fmt.Errorf("resolve dependencies: %s", err)
 	}
-	if err := s.putTag(tag, d, deps); err != nil {
+	if err := s.putTag(r.Context(), tag, d, deps); err != nil {
+		return err
+	}
+	if err := s.audit(r, "put", tag, d); err != nil {
 		return err
 	}
+	if translated != nil {
+		if err := s.audit(r, "translate", tag, *translated); err != nil {
+			return err
+		}
+	}
 
 	if replicate {
-		if err := s.replicateTag(tag, d, deps); err != nil {
+		if err := s.replicateTag(r.Context(), tag, d, deps, "", nil, priority); err != nil {
+			return err
+		}
+		if err := s.audit(r, "replicate", tag, d); err != nil {
 			return err
 		}
 	}
@@ -176,11 +492,41 @@ func (s *Server) putTagHandler(w http.ResponseWriter, r *http.Request) error {
 	return nil
 }
 
+// parseTranslatedDigest returns the translation of the tag digest into our
+// preferred algorithm, if the client provided one. The tag itself always stores
+// the source digest: blobs are addressed by their source digest in the CAS, and
+// neighbors and origins only accept sha256 digests, so storing the translation
+// would leave the tag unpullable. The translation is recorded in the audit log
+// instead.
+func (s *Server) parseTranslatedDigest(r *http.Request) (*core.Digest, error) {
+	raw := httputil.GetQueryArg(r, "translated", "")
+	if raw == "" {
+		return nil, nil
+	}
+	translated, err := core.ParseDigest(raw)
+	if err != nil {
+		return nil, handler.Errorf(
+			"parse query arg `translated`: %s", err).Status(http.StatusBadRequest)
+	}
+	if translated.Algo() != s.config.DigestAlgorithm {
+		return nil, handler.Errorf(
+			"translated digest algo %s does not match preferred algo %s",
+			translated.Algo(), s.config.DigestAlgorithm).Status(http.StatusBadRequest)
+	}
+	return &translated, nil
+}
+
 func (s *Server) duplicatePutTagHandler(w http.ResponseWriter, r *http.Request) error {
+	if err := s.limitPutBody(w, r); err != nil {
+		return err
+	}
 	tag, err := httputil.ParseParam(r, "tag")
 	if err != nil {
 		return err
 	}
+	if err := s.checkTagName(tag); err != nil {
+		return err
+	}
 	d, err := httputil.ParseDigest(r, "digest")
 	if err != nil {
 		return err
@@ -191,27 +537,49 @@ func (s *Server) duplicatePutTagHandler(w http.ResponseWriter, r *http.Request)
 		return handler.Errorf("decode body: %s", err)
 	}
 	delay := req.Delay
+	if err := s.checkTagValue(d.String()); err != nil {
+		return err
+	}
 
+	setStage(r.Context(), stageAwaitingBackend)
 	if err := s.store.Put(tag, d, delay); err != nil {
-		return handler.Errorf("storage: %s", err)
+		return s.storagePutError(err)
 	}
 
 	w.WriteHeader(http.StatusOK)
 	return nil
 }
 
+// invalidateTagHandler drops the cached value of a tag, such that a put to a
+// neighbor is not shadowed by a stale value cached on this replica.
+func (s *Server) invalidateTagHandler(w http.ResponseWriter, r *http.Request) error {
+	tag, err := httputil.ParseParam(r, "tag")
+	if err != nil {
+		return err
+	}
+	if err := s.store.Invalidate(tag); err != nil {
+		return handler.Errorf("invalidate: %s", err)
+	}
+	w.WriteHeader(http.StatusOK)
+	return nil
+}
+
 func (s *Server) getTagHandler(w http.ResponseWriter, r *http.Request) error {
 	tag, err := httputil.ParseParam(r, "tag")
 	if err != nil {
 		return err
 	}
 
-	d, err := s.store.Get(tag)
+	setStage(r.Context(), stageAwaitingBackend)
+	d, _, fallback, err := s.resolveTag(r, opRead, tag)
 	if err != nil {
 		if err == tagstore.ErrTagNotFound {
-			return handler.ErrorStatus(http.StatusNotFound)
+			return tagNotFoundError(tag)
 		}
-		return handler.Errorf("storage: %s", err)
+		return err
+	}
+	if fallback != "" {
+		w.Header().Set(FallbackNamespaceHeader, fallback)
 	}
 
 	if _, err := io.WriteString(w, d.String()); err != nil {
@@ -220,22 +588,138 @@ func (s *Server) getTagHandler(w http.ResponseWriter, r *http.Request) error {
 	return nil
 }
 
-func (s *Server) hasTagHandler(w http.ResponseWriter, r *http.Request) error {
+func (s *Server) deleteTagHandler(w http.ResponseWriter, r *http.Request) error {
+	tag, err := httputil.ParseParam(r, "tag")
+	if err != nil {
+		return err
+	}
+
+	setStage(r.Context(), stageAwaitingBackend)
+	unlock := s.lockQuotaTag(tag)
+	d, err := s.store.Get(tag)
+	if err != nil {
+		unlock()
+		if err == tagstore.ErrTagNotFound {
+			return tagNotFoundError(tag)
+		}
+		return storageError(err)
+	}
+	if err := s.store.Delete(tag); err != nil {
+		unlock()
+		switch err {
+		case tagstore.ErrTagNotFound:
+			return tagNotFoundError(tag)
+		case tagstore.ErrSoftDeleteDisabled:
+			return handler.Errorf("delete: %s", err).Status(http.StatusNotImplemented)
+		}
+		return storageError(err)
+	}
+	s.releaseQuota(tag, d)
+	unlock()
+	if err := s.audit(r, "delete", tag, d); err != nil {
+		return err
+	}
+	if s.config.EnableCacheInvalidation {
+		setStage(r.Context(), stageDuplicating)
+		for addr := range s.neighbors.Resolve() {
+			s.invalidateCache(s.provider.Provide(addr), addr, tag)
+		}
+	}
+	if s.refs != nil {
+		s.removeReferences(tag)
+	} else if s.config.BlobEviction.Enabled {
+		s.released.add(tag, []core.Digest{d}, s.clk.Now())
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+// undeleteTagHandler restores a tag deleted within the soft delete retention,
+// undoing the side effects of deleteTagHandler. Undeleting a tag which is not
+// deleted is a no-op.
+func (s *Server) undeleteTagHandler(w http.ResponseWriter, r *http.Request) error {
 	tag, err := httputil.ParseParam(r, "tag")
 	if err != nil {
 		return err
 	}
 
-	client, err := s.backends.GetClient(tag)
+	setStage(r.Context(), stageAwaitingBackend)
+	unlock := s.lockQuotaTag(tag)
+	if _, err := s.store.Get(tag); err == nil {
+		unlock()
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	} else if err != tagstore.ErrTagNotFound {
+		unlock()
+		return storageError(err)
+	}
+	if err := s.store.Undelete(tag); err != nil {
+		unlock()
+		switch err {
+		case tagstore.ErrTagNotFound:
+			return tagNotFoundError(tag)
+		case tagstore.ErrSoftDeleteDisabled:
+			return handler.Errorf("undelete: %s", err).Status(http.StatusNotImplemented)
+		}
+		return storageError(err)
+	}
+	d, err := s.store.Get(tag)
 	if err != nil {
-		return handler.Errorf("backend manager: %s", err)
+		unlock()
+		return storageError(err)
+	}
+	s.chargeQuota(tag, d)
+	unlock()
+	if err := s.audit(r, "undelete", tag, d); err != nil {
+		return err
+	}
+	if s.config.EnableCacheInvalidation {
+		setStage(r.Context(), stageDuplicating)
+		for addr := range s.neighbors.Resolve() {
+			s.invalidateCache(s.provider.Provide(addr), addr, tag)
+		}
 	}
-	if _, err := client.Stat(tag, tag); err != nil {
+	if s.refs != nil {
+		if deps, err := s.depResolver.Resolve(tag, d); err != nil {
+			s.stats.Counter("refcount_errors").Inc(1)
+			log.With("tag", tag).Errorf("Error resolving dependencies of undeleted tag: %s", err)
+		} else {
+			s.addReferences(tag, deps)
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+func (s *Server) hasTagHandler(w http.ResponseWriter, r *http.Request) error {
+	tag, err := httputil.ParseParam(r, "tag")
+	if err != nil {
+		return err
+	}
+
+	_, fallback, err := s.fallBack(r, opRead, tag, backenderrors.ErrBlobNotFound, func(tag string) error {
+		client, err := s.backendClient(r.Context(), tag)
+		if err != nil {
+			return err
+		}
+		setStage(r.Context(), stageAwaitingBackend)
+		if _, err := client.Stat(tag, tag); err != nil {
+			if err == backenderrors.ErrBlobNotFound {
+				return err
+			}
+			return backendError(r.Context(), err)
+		}
+		return nil
+	})
+	if err != nil {
 		if err == backenderrors.ErrBlobNotFound {
-			return handler.ErrorStatus(http.StatusNotFound)
+			return tagNotFoundError(tag)
 		}
 		return err
 	}
+	if fallback != "" {
+		w.Header().Set(FallbackNamespaceHeader, fallback)
+	}
 	return nil
 }
 
@@ -244,9 +728,9 @@ func (s *Server) hasTagHandler(w http.ResponseWriter, r *http.Request) error {
 func (s *Server) listHandler(w http.ResponseWriter, r *http.Request) error {
 	prefix := r.URL.Path[len("/list/"):]
 
-	client, err := s.backends.GetClient(prefix)
+	client, err := s.backendClient(r.Context(), prefix)
 	if err != nil {
-		return handler.Errorf("backend manager: %s", err)
+		return err
 	}
 
 	opts, err := buildPaginationOptions(r.URL)
@@ -254,13 +738,36 @@ func (s *Server) listHandler(w http.ResponseWriter, r *http.Request) error {
 		return err
 	}
 
+	setStage(r.Context(), stageAwaitingBackend)
 	result, err := client.List(prefix, opts...)
 	if err != nil {
-		return handler.Errorf("error listing from backend: %s", err)
+		return backendError(r.Context(), fmt.Errorf("error listing from backend: %s", err))
+	}
+	names := result.Names
+	if len(opts) == 0 {
+		// Continuation tokens cannot span namespaces, so only unpaginated
+		// lists fall back.
+		names, err = s.mergeFallbackLists(r, prefix, names, func(fallback string) ([]string, error) {
+			client, err := s.backendClient(r.Context(), fallback)
+			if err != nil {
+				return nil, err
+			}
+			result, err := client.List(fallback)
+			if err != nil {
+				return nil, backendError(r.Context(), fmt.Errorf("error listing fallback from backend: %s", err))
+			}
+			var names []string
+			for _, name := range result.Names {
+				names = append(names, prefix+strings.TrimPrefix(name, fallback))
+			}
+			return names, nil
+		})
+		if err != nil {
+			return err
+		}
 	}
 
-	resp, err := buildPaginationResponse(r.URL, result.ContinuationToken,
-		result.Names)
+	resp, err := buildPaginationResponse(r.URL, result.ContinuationToken, names)
 	if err != nil {
 		return err
 	}
@@ -279,9 +786,9 @@ func (s *Server) listRepositoryHandler(w http.ResponseWriter, r *http.Request) e
 		return err
 	}
 
-	client, err := s.backends.GetClient(repo)
+	client, err := s.backendClient(r.Context(), repo)
 	if err != nil {
-		return handler.Errorf("backend manager: %s", err)
+		return err
 	}
 
 	opts, err := buildPaginationOptions(r.URL)
@@ -289,14 +796,45 @@ func (s *Server) listRepositoryHandler(w http.ResponseWriter, r *http.Request) e
 		return err
 	}
 
+	setStage(r.Context(), stageAwaitingBackend)
 	result, err := client.List(path.Join(repo, "_manifests/tags"), opts...)
 	if err != nil {
-		return handler.Errorf("error listing from backend: %s", err)
+		return backendError(r.Context(), fmt.Errorf("error listing from backend: %s", err))
+	}
+	tags := repositoryTags(result.Names)
+	if len(opts) == 0 {
+		// Continuation tokens cannot span namespaces, so only unpaginated
+		// lists fall back.
+		tags, err = s.mergeFallbackLists(r, repo, tags, func(fallback string) ([]string, error) {
+			client, err := s.backendClient(r.Context(), fallback)
+			if err != nil {
+				return nil, err
+			}
+			result, err := client.List(path.Join(fallback, "_manifests/tags"))
+			if err != nil {
+				return nil, backendError(r.Context(), fmt.Errorf("error listing fallback from backend: %s", err))
+			}
+			return repositoryTags(result.Names), nil
+		})
+		if err != nil {
+			return err
+		}
 	}
 
+	resp, err := buildPaginationResponse(r.URL, result.ContinuationToken, tags)
+	if err != nil {
+		return err
+	}
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		return handler.Errorf("json encode: %s", err)
+	}
+	return nil
+}
+
+// repositoryTags strips the repository of names of the form repo:tag.
+func repositoryTags(names []string) []string {
 	var tags []string
-	for _, name := range result.Names {
-		// Strip repo prefix.
+	for _, name := range names {
 		parts := strings.Split(name, ":")
 		if len(parts) != 2 {
 			log.With("name", name).Warn("Repo list skipping name, expected repo:tag format")
@@ -304,38 +842,113 @@ func (s *Server) listRepositoryHandler(w http.ResponseWriter, r *http.Request) e
 		}
 		tags = append(tags, parts[1])
 	}
+	return tags
+}
 
-	resp, err := buildPaginationResponse(r.URL, result.ContinuationToken, tags)
+func (s *Server) replicateTagHandler(w http.ResponseWriter, r *http.Request) error {
+	tag, err := httputil.ParseParam(r, "tag")
 	if err != nil {
 		return err
 	}
-	if err := json.NewEncoder(w).Encode(resp); err != nil {
-		return handler.Errorf("json encode: %s", err)
+	exclude := r.URL.Query()["exclude"]
+	if err := s.validateExclude(exclude); err != nil {
+		return err
+	}
+	if only := r.URL.Query()["remote"]; len(only) > 0 {
+		others, err := s.otherRemotes(tag, only)
+		if err != nil {
+			return err
+		}
+		exclude = append(exclude, others...)
+	}
+	var req tagclient.ReplicateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		return handler.Errorf("decode body: %s", err).Status(http.StatusBadRequest)
+	}
+	if err := s.validateCallback(req.Callback); err != nil {
+		return err
+	}
+
+	setStage(r.Context(), stageAwaitingBackend)
+	// Tags served from a fallback are replicated as the fallback tag, such
+	// that remotes with the same fallbacks resolve tag the same way.
+	d, resolved, fallback, err := s.resolveTag(r, opReplicate, tag)
+	if err != nil {
+		if err == tagstore.ErrTagNotFound {
+			return tagNotFoundError(tag)
+		}
+		return err
+	}
+	tag = resolved
+	deps, err := s.replicateDependencies(r, req, tag, d)
+	if err != nil {
+		return err
+	}
+	if err := s.replicateTag(r.Context(), tag, d, deps, req.Callback, nil, 0, exclude...); err != nil {
+		return err
+	}
+	if err := s.audit(r, "replicate", tag, d); err != nil {
+		return err
+	}
+	if fallback != "" {
+		w.Header().Set(FallbackNamespaceHeader, fallback)
 	}
+	w.WriteHeader(http.StatusOK)
 	return nil
 }
 
-func (s *Server) replicateTagHandler(w http.ResponseWriter, r *http.Request) error {
+// replicateDependencies returns the dependencies of tag pointing to d. The
+// dependencies listed in req take precedence, and are otherwise resolved by
+// the resolver configured for the namespace of tag.
+func (s *Server) replicateDependencies(
+	r *http.Request, req tagclient.ReplicateRequest, tag string, d core.Digest) (core.DigestList, error) {
+
+	if len(req.Dependencies) > 0 {
+		return req.Dependencies, nil
+	}
+	setStage(r.Context(), stageResolvingDependencies)
+	deps, err := s.depResolver.Resolve(tag, d)
+	if err != nil {
+		return nil, fmt.Errorf("resolve dependencies: %s", err)
+	}
+	return deps, nil
+}
+
+// getReplicaRemotesHandler returns the remotes which acknowledged replication of
+// the current digest of a tag. Remotes which only have pending or failed
+// replications, or which acknowledged a previous digest, are excluded.
+func (s *Server) getReplicaRemotesHandler(w http.ResponseWriter, r *http.Request) error {
 	tag, err := httputil.ParseParam(r, "tag")
 	if err != nil {
 		return err
 	}
+	if s.replicas == nil {
+		return handler.Errorf("replica tracking not enabled").Status(http.StatusNotImplemented)
+	}
 
+	setStage(r.Context(), stageAwaitingBackend)
 	d, err := s.store.Get(tag)
 	if err != nil {
 		if err == tagstore.ErrTagNotFound {
-			return handler.ErrorStatus(http.StatusNotFound)
+			return tagNotFoundError(tag)
 		}
-		return handler.Errorf("storage: %s", err)
+		return storageError(err)
 	}
-	deps, err := s.depResolver.Resolve(tag, d)
+
+	replicas, err := s.replicas.GetReplicas(tag)
 	if err != nil {
-		return fmt.Errorf("resolve dependencies: %s", err)
+		return handler.Errorf("get replicas: %s", err)
 	}
-	if err := s.replicateTag(tag, d, deps); err != nil {
-		return err
+	resp := tagmodels.ReplicaRemotesResponse{Remotes: []string{}}
+	for _, replica := range replicas {
+		if replica.Digest == d {
+			resp.Remotes = append(resp.Remotes, replica.Destination)
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		return handler.Errorf("json encode: %s", err)
 	}
-	w.WriteHeader(http.StatusOK)
 	return nil
 }
 
@@ -353,12 +966,14 @@ func (s *Server) duplicateReplicateTagHandler(w http.ResponseWriter, r *http.Req
 		return handler.Errorf("decode body: %s", err)
 	}
 
-	destinations := s.remotes.Match(tag)
+	destinations := s.destinations(tag, req.Exclude)
 
+	setStage(r.Context(), stageEnqueueingReplication)
 	for _, dest := range destinations {
 		task := tagreplication.NewTask(tag, d, req.Dependencies, dest, req.Delay)
+		task.Priority = req.Priority
 		if err := s.tagReplicationManager.Add(task); err != nil {
-			return handler.Errorf("add replicate task: %s", err)
+			return s.addReplicateTaskError(err)
 		}
 	}
 
@@ -366,25 +981,75 @@ func (s *Server) duplicateReplicateTagHandler(w http.ResponseWriter, r *http.Req
 }
 
 func (s *Server) getOriginHandler(w http.ResponseWriter, r *http.Request) error {
-	if _, err := io.WriteString(w, s.localOriginDNS); err != nil {
+	// Clients which accept JSON are sent all origin clusters, everyone else only
+	// the local origin.
+	if strings.Contains(r.Header.Get("Accept"), "application/json") {
+		clusters := s.config.OriginClusters
+		if len(clusters) == 0 {
+			clusters = []tagmodels.OriginCluster{{Addr: s.localOriginDNS}}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(tagmodels.OriginResponse{Clusters: clusters}); err != nil {
+			return handler.Errorf("json encode: %s", err)
+		}
+		return nil
+	}
+	if err := httputil.WriteWithETag(w, r, []byte(s.localOriginDNS)); err != nil {
 		return handler.Errorf("write local origin dns: %s", err)
 	}
 	return nil
 }
 
-func (s *Server) putTag(tag string, d core.Digest, deps core.DigestList) error {
+// getPullableOriginsHandler returns the local origins which can serve a blob
+// without cold-fetching it from the backend.
+func (s *Server) getPullableOriginsHandler(w http.ResponseWriter, r *http.Request) error {
+	namespace, err := httputil.ParseParam(r, "namespace")
+	if err != nil {
+		return err
+	}
+	d, err := httputil.ParseDigest(r, "digest")
+	if err != nil {
+		return err
+	}
+	origins, backendFetch, err := s.localOriginClient.PullableOrigins(namespace, d)
+	if err != nil {
+		return handler.Errorf("pullable origins: %s", err)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	resp := tagmodels.PullableOriginsResponse{Origins: origins, BackendFetch: backendFetch}
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		return handler.Errorf("json encode: %s", err)
+	}
+	return nil
+}
+
+func (s *Server) putTag(ctx context.Context, tag string, d core.Digest, deps core.DigestList) error {
+	setStage(ctx, stageVerifying)
+	var size int64
 	for _, dep := range deps {
-		if _, err := s.localOriginClient.Stat(tag, dep); err == blobclient.ErrBlobNotFound {
+		info, err := s.localOriginClient.Stat(tag, dep)
+		if err == blobclient.ErrBlobNotFound {
 			return handler.Errorf("cannot upload tag, missing dependency %s", dep)
 		} else if err != nil {
 			return handler.Errorf("check blob: %s", err)
 		}
+		size += info.Size
+	}
+
+	done, err := s.reserveQuota(tag, size)
+	if err != nil {
+		return err
 	}
 
-	if err := s.store.Put(tag, d, 0); err != nil {
-		return handler.Errorf("storage: %s", err)
+	setStage(ctx, stageAwaitingBackend)
+	err = s.store.Put(tag, d, 0)
+	done(err == nil)
+	if err != nil {
+		return s.storagePutError(err)
 	}
+	s.addReferences(tag, deps)
 
+	setStage(ctx, stageDuplicating)
 	neighbors := s.neighbors.Resolve()
 
 	var delay time.Duration
@@ -392,6 +1057,11 @@ func (s *Server) putTag(tag string, d core.Digest, deps core.DigestList) error {
 	for addr := range neighbors {
 		delay += s.config.DuplicatePutStagger
 		client := s.provider.Provide(addr)
+		if s.config.EnableCacheInvalidation {
+			// Must precede the duplicate put, which does not overwrite values
+			// already cached by the neighbor.
+			s.invalidateCache(client, addr, tag)
+		}
 		if err := client.DuplicatePut(tag, d, delay); err != nil {
 			log.Errorf("Error duplicating put task to %s: %s", addr, err)
 		} else {
@@ -404,19 +1074,100 @@ func (s *Server) putTag(tag string, d core.Digest, deps core.DigestList) error {
 	return nil
 }
 
-func (s *Server) replicateTag(tag string, d core.Digest, deps core.DigestList) error {
-	destinations := s.remotes.Match(tag)
+// invalidateCache drops the cached value of tag on the neighbor at addr. This
+// is best-effort: the neighbor's cache TTL bounds staleness if lost.
+func (s *Server) invalidateCache(client tagclient.Client, addr, tag string) {
+	if err := client.InvalidateCache(tag); err != nil {
+		s.stats.Counter("cache_invalidation_failures").Inc(1)
+		log.Errorf("Error invalidating tag cache of %s: %s", addr, err)
+	}
+}
+
+// validateExclude returns a 400 error if exclude lists remotes which are not
+// configured, since a typo would otherwise silently replicate everywhere.
+func (s *Server) validateExclude(exclude []string) error {
+	for _, addr := range exclude {
+		if !s.remotes.Contains(addr) {
+			return handler.Errorf("unknown remote %s", addr).Status(http.StatusBadRequest)
+		}
+	}
+	return nil
+}
+
+// otherRemotes returns the remotes tag matches other than only, or a 400 error
+// if tag does not match every remote of only.
+func (s *Server) otherRemotes(tag string, only []string) ([]string, error) {
+	matched := stringset.FromSlice(s.remotes.Match(tag))
+	for _, addr := range only {
+		if !matched.Has(addr) {
+			return nil, handler.Errorf(
+				"tag %s does not match remote %s", tag, addr).Status(http.StatusBadRequest)
+		}
+	}
+	return matched.Sub(stringset.FromSlice(only)).ToSlice(), nil
+}
+
+// destinations returns the remotes tag is replicated to, except for exclude,
+// and the mirrors tag is replicated to.
+func (s *Server) destinations(tag string, exclude []string) []string {
+	excluded := stringset.FromSlice(exclude)
+	var dests []string
+	for _, addr := range s.remotes.Match(tag) {
+		if !excluded.Has(addr) {
+			dests = append(dests, addr)
+		}
+	}
+	return append(dests, s.mirrors.Match(tag)...)
+}
+
+// replicateTag enqueues replication of tag to its destinations, and duplicates
+// the tasks to neighbors. Only the local tasks notify callback, if set, such
+// that it is notified once per destination. Local tasks to each destination in
+// after are held back until the replications of the listed tags to it complete.
+// Tasks, including duplicated ones, inherit priority, which is zero unless the
+// replication was cascaded from upstream.
+func (s *Server) replicateTag(
+	ctx context.Context,
+	tag string,
+	d core.Digest,
+	deps core.DigestList,
+	callback string,
+	after map[string][]string,
+	priority int,
+	exclude ...string) error {
+
+	destinations := s.destinations(tag, exclude)
 	if len(destinations) == 0 {
 		return nil
 	}
 
+	setStage(ctx, stageEnqueueingReplication)
+	var deduped []string
 	for _, dest := range destinations {
 		task := tagreplication.NewTask(tag, d, deps, dest, 0)
-		if err := s.tagReplicationManager.Add(task); err != nil {
-			return handler.Errorf("add replicate task: %s", err)
+		task.Callback = callback
+		task.After = after[dest]
+		task.Priority = priority
+		enqueued, err := s.replications.do(replicationKey{tag, d, dest, callback}, func() error {
+			return s.tagReplicationManager.Add(task)
+		})
+		if err != nil {
+			return s.addReplicateTaskError(err)
+		}
+		if !enqueued {
+			deduped = append(deduped, dest)
 		}
 	}
+	if len(deduped) > 0 {
+		s.stats.Counter("deduped_replications").Inc(int64(len(deduped)))
+		if len(deduped) == len(destinations) {
+			// The identical call which enqueued the tasks also duplicated them.
+			return nil
+		}
+		exclude = append(append([]string(nil), exclude...), deduped...)
+	}
 
+	setStage(ctx, stageDuplicating)
 	neighbors := s.neighbors.Resolve()
 
 	var delay time.Duration
@@ -424,7 +1175,7 @@ func (s *Server) replicateTag(tag string, d core.Digest, deps core.DigestList) e
 	for addr := range neighbors { // Loops in random order.
 		delay += s.config.DuplicateReplicateStagger
 		client := s.provider.Provide(addr)
-		if err := client.DuplicateReplicate(tag, d, deps, delay); err != nil {
+		if err := client.DuplicateReplicate(tag, d, deps, delay, priority, exclude...); err != nil {
 			log.Errorf("Error duplicating replicate task to %s: %s", addr, err)
 		} else {
 			successes++
@@ -436,6 +1187,70 @@ func (s *Server) replicateTag(tag string, d core.Digest, deps core.DigestList) e
 	return nil
 }
 
+// backendClient returns the backend client for namespace, which abandons
+// operations once ctx is done.
+func (s *Server) backendClient(ctx context.Context, namespace string) (backend.Client, error) {
+	client, err := s.backends.GetClient(namespace)
+	if err != nil {
+		herr := handler.Errorf("backend manager: %s", err)
+		if err == backend.ErrNamespaceNotFound {
+			herr.Code(tagmodels.ErrCodeNamespaceNotFound).Detail("namespace", namespace)
+		}
+		return nil, herr
+	}
+	return backend.WithContext(ctx, client), nil
+}
+
+// backendError converts err into a 504 if the backend operation was abandoned
+// because the client deadline passed.
+func backendError(ctx context.Context, err error) error {
+	if ctx.Err() == context.DeadlineExceeded {
+		return handler.Errorf("deadline exceeded: %s", err).
+			Status(http.StatusGatewayTimeout).
+			Code(tagmodels.ErrCodeBackendUnavailable)
+	}
+	return handler.Errorf("%s", err).Code(tagmodels.ErrCodeBackendUnavailable)
+}
+
+// storageError converts errors returned by the tag store into handler errors.
+func storageError(err error) error {
+	herr := handler.Errorf("storage: %s", err)
+	if errors.Is(err, backend.ErrNamespaceNotFound) {
+		herr.Code(tagmodels.ErrCodeNamespaceNotFound)
+	}
+	return herr
+}
+
+// addReplicateTaskError returns the error of a failed add of a replicate task.
+// A full backlog is not a failure of the replication store, so it does not
+// degrade the server to read-only.
+func (s *Server) addReplicateTaskError(err error) error {
+	if errors.Is(err, tagreplication.ErrReplicationBacklogFull) {
+		return handler.Errorf("add replicate task: %s", err).
+			Status(http.StatusServiceUnavailable).
+			Code(tagmodels.ErrCodeBacklogFull)
+	}
+	s.readOnly.fail("replication store", err)
+	return handler.Errorf("add replicate task: %s", err)
+}
+
+// storagePutError converts errors returned by tag store puts into handler
+// errors. Failures other than unknown namespaces indicate the store is
+// unavailable.
+func (s *Server) storagePutError(err error) error {
+	if !errors.Is(err, backend.ErrNamespaceNotFound) {
+		s.readOnly.fail("tag store", err)
+	}
+	return storageError(err)
+}
+
+func tagNotFoundError(tag string) error {
+	return handler.Errorf("tag not found").
+		Status(http.StatusNotFound).
+		Code(tagmodels.ErrCodeTagNotFound).
+		Detail("tag", tag)
+}
+
 func buildPaginationOptions(u *url.URL) ([]backend.ListOption, error) {
 	var opts []backend.ListOption
 	q := u.Query()
@@ -458,13 +1273,21 @@ func buildPaginationOptions(u *url.URL) ([]backend.ListOption, error) {
 			opts = append(opts, backend.ListWithMaxKeys(limitCount))
 		case tagmodels.OffsetQ:
 			opts = append(opts, backend.ListWithContinuationToken(v[0]))
+		case tagmodels.ModifiedSinceQ:
+			t, err := time.Parse(time.RFC3339Nano, v[0])
+			if err != nil {
+				return nil, handler.Errorf(
+					"invalid modified since %s: %s", v, err).Status(http.StatusBadRequest)
+			}
+			opts = append(opts, backend.ListModifiedSince(t))
 		default:
 			return nil, handler.Errorf(
 				"invalid query %s", k).Status(http.StatusBadRequest)
 		}
 	}
 	if len(opts) > 0 {
-		// Enable pagination if either or both of the query param exists.
+		// Enable pagination if any of the query params exist, such that
+		// filtered lists are paginated as well.
 		opts = append(opts, backend.ListWithPagination())
 	}
 
@@ -486,6 +1309,9 @@ func buildPaginationResponse(u *url.URL, continuationToken string,
 		if limit := u.Query().Get(tagmodels.LimitQ); limit != "" {
 			v.Add(tagmodels.LimitQ, limit)
 		}
+		if since := u.Query().Get(tagmodels.ModifiedSinceQ); since != "" {
+			v.Add(tagmodels.ModifiedSinceQ, since)
+		}
 		// ContinuationToken cannot be empty here.
 		v.Add(tagmodels.OffsetQ, continuationToken)
 		nextUrl.RawQuery = v.Encode()
@@ -0,0 +1,110 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package tagserver
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/uber/kraken/build-index/tagmodels"
+	"github.com/uber/kraken/utils/handler"
+)
+
+// TagNameConfig bounds the names which may be put as tags. Names are used as
+// backend keys and logged verbatim, so malformed names may be rejected before
+// they reach either. All checks are disabled by default, such that every name
+// which was valid before remains valid.
+type TagNameConfig struct {
+	// MaxLength, if set, is the maximum length of a tag name in bytes, e.g.
+	// 1024 for the key length limit of object stores.
+	MaxLength int `yaml:"max_length"`
+
+	// AllowedPattern, if set, is a regular expression which tag names must
+	// fully match, e.g. "[a-zA-Z0-9_./:-]+".
+	AllowedPattern string `yaml:"allowed_pattern"`
+
+	// RequireUTF8 rejects tag names which are not valid utf-8.
+	RequireUTF8 bool `yaml:"require_utf8"`
+
+	// DisallowControlChars rejects tag names containing control characters.
+	DisallowControlChars bool `yaml:"disallow_control_chars"`
+
+	// DisallowSurroundingWhitespace rejects tag names with leading or
+	// trailing whitespace.
+	DisallowSurroundingWhitespace bool `yaml:"disallow_surrounding_whitespace"`
+}
+
+// tagNameValidator validates tag names against a TagNameConfig.
+type tagNameValidator struct {
+	config  TagNameConfig
+	allowed *regexp.Regexp
+}
+
+// newTagNameValidator creates a new tagNameValidator. Returns an error if the
+// allowed pattern of config does not compile.
+func newTagNameValidator(config TagNameConfig) (*tagNameValidator, error) {
+	v := &tagNameValidator{config: config}
+	if config.AllowedPattern != "" {
+		allowed, err := regexp.Compile("^(?:" + config.AllowedPattern + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("allowed pattern: %s", err)
+		}
+		v.allowed = allowed
+	}
+	return v, nil
+}
+
+// validate returns an error describing why name violates the config, if any.
+// The error never includes name itself, which may not be safe to log.
+func (v *tagNameValidator) validate(name string) error {
+	if v.config.MaxLength > 0 && len(name) > v.config.MaxLength {
+		return fmt.Errorf(
+			"length of %d bytes exceeds limit of %d", len(name), v.config.MaxLength)
+	}
+	if v.config.RequireUTF8 && !utf8.ValidString(name) {
+		return fmt.Errorf("not valid utf-8")
+	}
+	if v.config.DisallowControlChars {
+		for i, r := range name {
+			if unicode.IsControl(r) {
+				return fmt.Errorf("control character %U at offset %d", r, i)
+			}
+		}
+	}
+	if v.config.DisallowSurroundingWhitespace && name != "" {
+		first, _ := utf8.DecodeRuneInString(name)
+		last, _ := utf8.DecodeLastRuneInString(name)
+		if unicode.IsSpace(first) || unicode.IsSpace(last) {
+			return fmt.Errorf("leading or trailing whitespace")
+		}
+	}
+	if v.allowed != nil && !v.allowed.MatchString(name) {
+		return fmt.Errorf("does not match allowed pattern %q", v.config.AllowedPattern)
+	}
+	return nil
+}
+
+// checkTagName validates name before it is put as a tag.
+func (s *Server) checkTagName(name string) error {
+	if err := s.tagNames.validate(name); err != nil {
+		s.stats.Counter("invalid_tag_name").Inc(1)
+		return handler.Errorf("invalid tag name: %s", err).
+			Status(http.StatusUnprocessableEntity).
+			Code(tagmodels.ErrCodeInvalidTagName)
+	}
+	return nil
+}
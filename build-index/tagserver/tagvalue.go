@@ -0,0 +1,76 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package tagserver
+
+import (
+	"net/http"
+
+	"github.com/uber/kraken/build-index/tagmodels"
+	"github.com/uber/kraken/build-index/tagstore"
+	"github.com/uber/kraken/utils/handler"
+
+	"github.com/c2h5oh/datasize"
+)
+
+// TagValueConfig bounds the values which may be put under tags. Tags should
+// only hold a digest or a small envelope, so larger values indicate misuse of
+// the tag store as a blob store.
+type TagValueConfig struct {
+	// MaxSize is the maximum size of a tag value, and of any request body
+	// accompanying a put. Puts exceeding it are rejected with 413.
+	MaxSize datasize.ByteSize `yaml:"max_size"`
+
+	// Strict rejects values which do not parse as a digest or envelope.
+	Strict bool `yaml:"strict"`
+}
+
+func (c TagValueConfig) applyDefaults() TagValueConfig {
+	if c.MaxSize == 0 {
+		c.MaxSize = datasize.KB
+	}
+	return c
+}
+
+func (s *Server) tagValueTooLarge(size int64) error {
+	s.stats.Counter("tag_value_too_large").Inc(1)
+	return handler.Errorf(
+		"tag value of %d bytes exceeds limit of %s", size, s.config.TagValue.MaxSize).
+		Status(http.StatusRequestEntityTooLarge).
+		Code(tagmodels.ErrCodeTagValueTooLarge)
+}
+
+// limitPutBody rejects put requests whose body exceeds the maximum tag value
+// size, and bounds reads of bodies of unknown length.
+func (s *Server) limitPutBody(w http.ResponseWriter, r *http.Request) error {
+	max := int64(s.config.TagValue.MaxSize)
+	if r.ContentLength > max {
+		return s.tagValueTooLarge(r.ContentLength)
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, max)
+	return nil
+}
+
+// checkTagValue validates value before it is stored under a tag.
+func (s *Server) checkTagValue(value string) error {
+	if int64(len(value)) > int64(s.config.TagValue.MaxSize) {
+		return s.tagValueTooLarge(int64(len(value)))
+	}
+	if s.config.TagValue.Strict {
+		if err := tagstore.ValidateValue([]byte(value)); err != nil {
+			s.stats.Counter("invalid_tag_value").Inc(1)
+			return handler.Errorf("invalid tag value: %s", err).Status(http.StatusBadRequest)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,245 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package tagstore
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/utils/log"
+)
+
+// PutOp is a single tag write of a batch.
+type PutOp struct {
+	Tag    string
+	Digest core.Digest
+}
+
+// PutBatch points every tag of ops to its digest, such that either all or none
+// of the writes are visible. Since backends cannot write several blobs
+// atomically, the new values are first written to the backend and only
+// published to disk once every write succeeded. If any write fails, the tags
+// already written are restored to their prior values. Single tag operations
+// on the tags of the batch are excluded while it is applied. If the store has
+// a batch journal, batches interrupted by a crash are rolled back, or published
+// if every write reached the backend, on startup.
+//
+// Tags which did not exist prior to the batch are restored as expired
+// tombstones, which behave as if the tag never existed. Batches therefore
+// require soft delete to be enabled.
+func (s *tagStore) PutBatch(ops []PutOp) error {
+	if !s.config.SoftDelete.Enabled {
+		return ErrSoftDeleteDisabled
+	}
+	seen := make(map[string]bool, len(ops))
+	for _, op := range ops {
+		if seen[op.Tag] {
+			return fmt.Errorf("duplicate tag in batch: %s", op.Tag)
+		}
+		seen[op.Tag] = true
+	}
+
+	tags := make([]string, len(ops))
+	for i, op := range ops {
+		tags[i] = op.Tag
+	}
+	defer s.locks.lock(tags)()
+
+	prior := make([][]byte, len(ops))
+	values := make([][]byte, len(ops))
+	// Prior values are only ever uploaded, never written to disk.
+	defer s.releaseValues(prior)
+	for i, op := range ops {
+		v, err := s.priorValue(op)
+		if err != nil {
+			s.releaseValues(values)
+			return fmt.Errorf("resolve %s: %s", op.Tag, err)
+		}
+		prior[i] = v
+		if values[i], err = s.value(op.Digest); err != nil {
+			s.releaseValues(values)
+			return fmt.Errorf("serialize %s: %s", op.Tag, err)
+		}
+	}
+
+	var id int64
+	if s.journal != nil {
+		var err error
+		if id, err = s.journal.begin(ops, prior, values); err != nil {
+			return fmt.Errorf("journal batch: %s", err)
+		}
+	}
+
+	mirrorErrs := make([]error, len(ops))
+	for i, op := range ops {
+		mirrorErr, err := s.upload(op.Tag, values[i])
+		if err != nil {
+			s.stats.Counter("batch_rollbacks").Inc(1)
+			if s.rollback(ops[:i], prior[:i]) {
+				s.endJournaledBatch(id)
+			}
+			s.releaseValues(values)
+			return fmt.Errorf("upload %s: %s", op.Tag, err)
+		}
+		mirrorErrs[i] = mirrorErr
+	}
+
+	// The backend has every value, so the batch is committed.
+	if s.journal != nil {
+		if err := s.journal.commit(id); err != nil {
+			// Publishing the batch on startup instead is equally correct.
+			log.Errorf("Error marking batch %d committed: %s", id, err)
+		}
+	}
+	defer s.endJournaledBatch(id)
+	for i, op := range ops {
+		if err := s.publish(op.Tag, values[i], mirrorErrs[i]); err != nil {
+			return fmt.Errorf("publish %s: %s", op.Tag, err)
+		}
+		if s.notFound != nil {
+			s.notFound.remove(op.Tag)
+		}
+	}
+	s.stats.Counter("batches").Inc(1)
+	return nil
+}
+
+// priorValue returns the value which restores the tag of op to its state prior
+// to the batch.
+func (s *tagStore) priorValue(op PutOp) ([]byte, error) {
+	d, t, err := s.resolve(context.Background(), op.Tag)
+	if err == ErrTagNotFound {
+		return (&tombstone{Digest: op.Digest, DeletedAt: time.Time{}}).serialize()
+	}
+	if err != nil {
+		return nil, err
+	}
+	if t != nil {
+		return t.serialize()
+	}
+	return s.value(d)
+}
+
+// rollback restores the tags of ops to their prior values in the backend, and
+// returns false if any tag could not be restored. Disk is never written before
+// a batch commits, so it already has the prior values.
+func (s *tagStore) rollback(ops []PutOp, prior [][]byte) bool {
+	ok := true
+	for i, op := range ops {
+		mirrorErr, err := s.upload(op.Tag, prior[i])
+		if err == nil {
+			err = mirrorErr
+		}
+		if err != nil {
+			s.stats.Counter("batch_rollback_failures").Inc(1)
+			log.With("tag", op.Tag).Errorf("Error rolling back batch write: %s", err)
+			ok = false
+		}
+	}
+	return ok
+}
+
+// endJournaledBatch removes batch id from the journal, if any. Batches which
+// remain in the journal are rolled back or published again on startup.
+func (s *tagStore) endJournaledBatch(id int64) {
+	if s.journal == nil {
+		return
+	}
+	if err := s.journal.end(id); err != nil {
+		log.Errorf("Error removing batch %d from journal: %s", id, err)
+	}
+}
+
+// recoverBatches completes the batches interrupted by a crash. Batches whose
+// writes all reached the backend are published to disk, and all others are
+// rolled back.
+func (s *tagStore) recoverBatches() error {
+	batches, err := s.journal.pending()
+	if err != nil {
+		return fmt.Errorf("journal: %s", err)
+	}
+	for id, entries := range batches {
+		for _, e := range entries {
+			// Both values of e hold references to their payloads, only one
+			// of which is written to disk.
+			var err error
+			if e.Committed {
+				err = s.publish(e.Tag, e.Value, nil)
+				s.releaseValue(e.Prior)
+			} else {
+				err = s.overwrite(e.Tag, e.Prior)
+				s.releaseValue(e.Value)
+			}
+			if err != nil {
+				return fmt.Errorf("recover %s of batch %d: %s", e.Tag, id, err)
+			}
+		}
+		if err := s.journal.end(id); err != nil {
+			return fmt.Errorf("end batch %d: %s", id, err)
+		}
+		s.stats.Counter("recovered_batches").Inc(1)
+	}
+	return nil
+}
+
+// _numTagLockStripes is the number of locks tags are hashed onto.
+const _numTagLockStripes = 256
+
+// tagLocks excludes single tag operations from batches writing the same tags,
+// such that they observe either none or all of the writes of a batch, without
+// blocking operations on other tags.
+type tagLocks struct {
+	stripes [_numTagLockStripes]sync.RWMutex
+}
+
+func tagStripe(tag string) int {
+	h := fnv.New32a()
+	h.Write([]byte(tag))
+	return int(h.Sum32() % _numTagLockStripes)
+}
+
+// rlock locks tag for a single tag operation, and returns the unlock function.
+func (l *tagLocks) rlock(tag string) func() {
+	m := &l.stripes[tagStripe(tag)]
+	m.RLock()
+	return m.RUnlock
+}
+
+// lock locks every tag of tags for a batch, and returns the unlock function.
+// Stripes are locked in order, such that concurrent batches cannot deadlock.
+func (l *tagLocks) lock(tags []string) func() {
+	seen := make(map[int]bool)
+	var stripes []int
+	for _, tag := range tags {
+		i := tagStripe(tag)
+		if !seen[i] {
+			seen[i] = true
+			stripes = append(stripes, i)
+		}
+	}
+	sort.Ints(stripes)
+	for _, i := range stripes {
+		l.stripes[i].Lock()
+	}
+	return func() {
+		for _, i := range stripes {
+			l.stripes[i].Unlock()
+		}
+	}
+}
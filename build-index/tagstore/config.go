@@ -13,7 +13,100 @@
 // limitations under the License.
 package tagstore
 
+import "time"
+
 // Config defines tag store configuration.
 type Config struct {
 	WriteThrough bool `yaml:"write_through"`
+
+	SoftDelete SoftDeleteConfig `yaml:"soft_delete"`
+
+	Warm WarmConfig `yaml:"warm"`
+
+	NegativeCache NegativeCacheConfig `yaml:"negative_cache"`
+
+	// CacheTTL, if set, bounds how long tags cached on disk are served before
+	// they are resolved from the backend again. Tags pending write-back never
+	// expire. Serves as a backstop for lost invalidations between replicas.
+	CacheTTL time.Duration `yaml:"cache_ttl"`
+
+	// ValueFormat is the format tag values are written in, either "string"
+	// (default) or "protobuf". Values in either format are always readable, so
+	// the format may be changed without migrating existing tags.
+	ValueFormat string `yaml:"value_format"`
+
+	Dedup DedupConfig `yaml:"dedup"`
+}
+
+// DedupConfig defines content-addressed deduplication of tag values. The
+// payload of each distinct value is stored once, named by its digest, and tags
+// store a reference to their payload instead. Tags with identical values thus
+// share storage, and payloads are only written to the backend if it does not
+// have them yet.
+type DedupConfig struct {
+	Enabled bool `yaml:"enabled"`
+
+	// Namespace is the backend namespace payloads are stored in. References
+	// are resolved from Namespace even if dedup is disabled, so Namespace must
+	// remain configured while references may be stored.
+	Namespace string `yaml:"namespace"`
+}
+
+// SoftDeleteConfig defines tag deletion configuration. Deleted tags are replaced
+// with tombstones, which may be undeleted until Retention has elapsed.
+type SoftDeleteConfig struct {
+	Enabled bool `yaml:"enabled"`
+
+	// Retention is how long deleted tags may be undeleted.
+	Retention time.Duration `yaml:"retention"`
+
+	// GCInterval is how often expired tombstones are purged from disk.
+	GCInterval time.Duration `yaml:"gc_interval"`
+}
+
+func (c SoftDeleteConfig) applyDefaults() SoftDeleteConfig {
+	if c.Retention == 0 {
+		c.Retention = 7 * 24 * time.Hour
+	}
+	if c.GCInterval == 0 {
+		c.GCInterval = time.Hour
+	}
+	return c
+}
+
+// WarmConfig defines warming of the on-disk tag cache on startup. Warmed tags
+// are resolved from the backend in the background and cached on disk, such
+// that the first lookups of hot tags after a restart do not hit the backend.
+type WarmConfig struct {
+	Enabled bool `yaml:"enabled"`
+
+	// Tags are warmed on every startup.
+	Tags []string `yaml:"tags"`
+
+	// RecentTagsFile, if set, is where the most recently accessed tags are
+	// periodically persisted. Tags in this file are warmed on startup.
+	RecentTagsFile string `yaml:"recent_tags_file"`
+
+	// PersistInterval is how often recently accessed tags are persisted.
+	PersistInterval time.Duration `yaml:"persist_interval"`
+
+	// MaxTags bounds both the number of tags warmed and the number of recently
+	// accessed tags tracked.
+	MaxTags int `yaml:"max_tags"`
+
+	// RPS limits the rate of backend lookups issued while warming.
+	RPS float64 `yaml:"rps"`
+}
+
+func (c WarmConfig) applyDefaults() WarmConfig {
+	if c.PersistInterval == 0 {
+		c.PersistInterval = time.Minute
+	}
+	if c.MaxTags == 0 {
+		c.MaxTags = 1000
+	}
+	if c.RPS == 0 {
+		c.RPS = 20
+	}
+	return c
 }
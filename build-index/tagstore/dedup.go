@@ -0,0 +1,257 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package tagstore
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/backend"
+	"github.com/uber/kraken/lib/backend/backenderrors"
+	"github.com/uber/kraken/lib/store/metadata"
+	"github.com/uber/kraken/utils/log"
+
+	"github.com/uber-go/tally"
+)
+
+// Deduplicated tag values are stored as a reference, consisting of refMagic
+// followed by the digest of the shared payload. Like valueMagic, the prefix
+// cannot start any other value.
+var refMagic = []byte("\x00ktr")
+
+// isValueRef returns true if b is a reference to a shared payload.
+func isValueRef(b []byte) bool {
+	return bytes.HasPrefix(b, refMagic)
+}
+
+func parseValueRef(b []byte) (core.Digest, error) {
+	return core.ParseDigest(string(b[len(refMagic):]))
+}
+
+func serializeValueRef(d core.Digest) []byte {
+	return append(append([]byte{}, refMagic...), d.String()...)
+}
+
+// payloadStore stores the payloads of deduplicated tag values by digest, both
+// in the backend and on disk. Payloads on disk are reference counted by the
+// tags on disk which point to them, and are deleted once unreferenced. Since
+// backends do not support deletion, payloads are never deleted from the
+// backend.
+type payloadStore struct {
+	namespace string
+	stats     tally.Scope
+	fs        FileStore
+	backends  *backend.Manager
+
+	// Excludes reference count updates and deletion of payloads on disk.
+	mu sync.Mutex
+}
+
+func newPayloadStore(
+	config DedupConfig, stats tally.Scope, fs FileStore, backends *backend.Manager) *payloadStore {
+
+	return &payloadStore{
+		namespace: config.Namespace,
+		stats:     stats.SubScope("dedup"),
+		fs:        fs,
+		backends:  backends,
+	}
+}
+
+// payloadName returns the name of the payload d on disk. Tag names cannot
+// start with an underscore, so payloads never collide with tags.
+func payloadName(d core.Digest) string {
+	return "_payloads/" + d.Hex()
+}
+
+// acquire stores payload, unless it is already stored, and returns a reference
+// to it. The reference count of payload is incremented, so the caller must
+// either write the reference to disk, or release it.
+func (p *payloadStore) acquire(payload []byte) ([]byte, error) {
+	d, err := core.NewDigester().FromBytes(payload)
+	if err != nil {
+		return nil, fmt.Errorf("digest: %s", err)
+	}
+	name := payloadName(d)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if _, err := p.fs.GetCacheFileStat(name); err == nil {
+		// Payloads are only written to disk once the backend has them.
+		p.stats.Counter("hits").Inc(1)
+	} else if os.IsNotExist(err) {
+		if err := p.upload(d, payload); err != nil {
+			return nil, err
+		}
+		if err := p.fs.CreateCacheFile(name, bytes.NewReader(payload)); err != nil && !os.IsExist(err) {
+			return nil, fmt.Errorf("write payload to disk: %s", err)
+		}
+	} else {
+		return nil, fmt.Errorf("stat payload: %s", err)
+	}
+	if err := p.addRefs(name, 1); err != nil {
+		return nil, err
+	}
+	return serializeValueRef(d), nil
+}
+
+// upload writes payload to the backend unless the backend already has it.
+func (p *payloadStore) upload(d core.Digest, payload []byte) error {
+	client, err := p.backends.GetClient(p.namespace)
+	if err != nil {
+		return fmt.Errorf("backend manager: %w", err)
+	}
+	if _, err := client.Stat(p.namespace, d.Hex()); err == nil {
+		p.stats.Counter("backend_hits").Inc(1)
+		return nil
+	} else if err != backenderrors.ErrBlobNotFound {
+		return fmt.Errorf("stat payload: %s", err)
+	}
+	if err := client.Upload(p.namespace, d.Hex(), bytes.NewReader(payload)); err != nil {
+		return fmt.Errorf("upload payload: %s", err)
+	}
+	p.stats.Counter("uploads").Inc(1)
+	return nil
+}
+
+// release decrements the reference count of the payload referenced by ref, and
+// deletes the payload from disk once it is no longer referenced.
+func (p *payloadStore) release(ref []byte) error {
+	d, err := parseValueRef(ref)
+	if err != nil {
+		return fmt.Errorf("parse reference: %s", err)
+	}
+	name := payloadName(d)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var rc metadata.RefCount
+	if err := p.fs.GetCacheFileMetadata(name, &rc); err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("get refcount: %s", err)
+	}
+	if rc.Value > 1 {
+		return p.addRefs(name, -1)
+	}
+	if err := p.fs.DeleteCacheFile(name); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("delete payload from disk: %s", err)
+	}
+	p.stats.Counter("deleted_payloads").Inc(1)
+	return nil
+}
+
+// addRefs adds delta to the reference count of the payload name. Must be called
+// with mu held.
+func (p *payloadStore) addRefs(name string, delta int64) error {
+	var rc metadata.RefCount
+	if err := p.fs.GetCacheFileMetadata(name, &rc); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("get refcount: %s", err)
+	}
+	rc.Value += delta
+	if _, err := p.fs.SetCacheFileMetadata(name, &rc); err != nil {
+		return fmt.Errorf("set refcount: %s", err)
+	}
+	return nil
+}
+
+// get returns the payload referenced by ref, from disk if present and else from
+// the backend.
+func (p *payloadStore) get(ref []byte) ([]byte, error) {
+	d, err := parseValueRef(ref)
+	if err != nil {
+		return nil, fmt.Errorf("parse reference: %s", err)
+	}
+	var b bytes.Buffer
+	f, err := p.fs.GetCacheFileReader(payloadName(d))
+	if err == nil {
+		defer f.Close()
+		if _, err := io.Copy(&b, f); err != nil {
+			return nil, fmt.Errorf("copy payload from fs: %s", err)
+		}
+		return b.Bytes(), nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("fs: %s", err)
+	}
+	client, err := p.backends.GetClient(p.namespace)
+	if err != nil {
+		return nil, fmt.Errorf("backend manager: %w", err)
+	}
+	if err := client.Download(p.namespace, d.Hex(), &b); err != nil {
+		return nil, fmt.Errorf("download payload: %s", err)
+	}
+	if actual, err := core.NewDigester().FromBytes(b.Bytes()); err != nil || actual != d {
+		return nil, fmt.Errorf("payload digest mismatch: expected %s, got %s", d, actual)
+	}
+	return b.Bytes(), nil
+}
+
+// value returns the stored value of d. If dedup is enabled, the value is a
+// reference to the shared payload of d, which the caller must either write to
+// disk or release.
+func (s *tagStore) value(d core.Digest) ([]byte, error) {
+	v, err := s.serialize(d)
+	if err != nil {
+		return nil, err
+	}
+	if !s.config.Dedup.Enabled {
+		return v, nil
+	}
+	return s.payloads.acquire(v)
+}
+
+// dereference returns the payload of b if b is a reference, and else b itself.
+func (s *tagStore) dereference(b []byte) ([]byte, error) {
+	if !isValueRef(b) {
+		return b, nil
+	}
+	return s.payloads.get(b)
+}
+
+// releaseValue releases the payload referenced by v, if any. Errors are logged,
+// since they at most leak the payload on disk.
+func (s *tagStore) releaseValue(v []byte) {
+	if !isValueRef(v) {
+		return
+	}
+	if err := s.payloads.release(v); err != nil {
+		log.Errorf("Error releasing tag payload: %s", err)
+	}
+}
+
+func (s *tagStore) releaseValues(vs [][]byte) {
+	for _, v := range vs {
+		s.releaseValue(v)
+	}
+}
+
+// deleteCacheFile deletes tag from disk, releasing its payload if deduplicated.
+func (s *tagStore) deleteCacheFile(tag string) error {
+	v, readErr := s.readFromDisk(tag)
+	if err := s.fs.DeleteCacheFile(tag); err != nil {
+		return err
+	}
+	if readErr == nil {
+		s.releaseValue(v)
+	}
+	return nil
+}
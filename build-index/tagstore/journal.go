@@ -0,0 +1,107 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package tagstore
+
+import (
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// journalEntry is the write of a single tag of a batch in flight.
+type journalEntry struct {
+	BatchID   int64  `db:"batch_id"`
+	Tag       string `db:"tag"`
+	Prior     []byte `db:"prior"`
+	Value     []byte `db:"value"`
+	Committed bool   `db:"committed"`
+}
+
+// batchJournal persists the prior and new values of the tags of batches in
+// flight, such that batches interrupted by a crash are rolled back on startup,
+// or published if every write already reached the backend.
+type batchJournal struct {
+	db *sqlx.DB
+}
+
+// begin journals the writes of ops and returns the id of the batch.
+func (j *batchJournal) begin(ops []PutOp, prior, values [][]byte) (int64, error) {
+	var id int64
+	err := j.transact(func(tx *sqlx.Tx) error {
+		if err := tx.Get(&id, `SELECT IFNULL(MAX(batch_id), 0) + 1 FROM tag_batch_journal`); err != nil {
+			return fmt.Errorf("next batch id: %s", err)
+		}
+		for i, op := range ops {
+			_, err := tx.NamedExec(`
+				INSERT INTO tag_batch_journal (
+					batch_id,
+					tag,
+					prior,
+					value
+				) VALUES (
+					:batch_id,
+					:tag,
+					:prior,
+					:value
+				)
+			`, &journalEntry{BatchID: id, Tag: op.Tag, Prior: prior[i], Value: values[i]})
+			if err != nil {
+				return fmt.Errorf("insert %s: %s", op.Tag, err)
+			}
+		}
+		return nil
+	})
+	return id, err
+}
+
+// commit marks every write of batch id as having reached the backend.
+func (j *batchJournal) commit(id int64) error {
+	_, err := j.db.Exec(`UPDATE tag_batch_journal SET committed=1 WHERE batch_id=?`, id)
+	return err
+}
+
+// end removes batch id from the journal.
+func (j *batchJournal) end(id int64) error {
+	_, err := j.db.Exec(`DELETE FROM tag_batch_journal WHERE batch_id=?`, id)
+	return err
+}
+
+// pending returns the entries of every batch in flight, keyed by batch id.
+func (j *batchJournal) pending() (map[int64][]*journalEntry, error) {
+	var entries []*journalEntry
+	err := j.db.Select(&entries, `
+		SELECT batch_id, tag, prior, value, committed
+		FROM tag_batch_journal
+		ORDER BY batch_id, tag`)
+	if err != nil {
+		return nil, err
+	}
+	batches := make(map[int64][]*journalEntry)
+	for _, e := range entries {
+		batches[e.BatchID] = append(batches[e.BatchID], e)
+	}
+	return batches, nil
+}
+
+func (j *batchJournal) transact(f func(*sqlx.Tx) error) error {
+	tx, err := j.db.Beginx()
+	if err != nil {
+		return fmt.Errorf("begin: %s", err)
+	}
+	if err := f(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,125 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package tagstore
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/andres-erbsen/clock"
+)
+
+// NegativeCacheConfig defines caching of tags which were not found in the
+// backend, such that repeated lookups of missing tags do not hit the backend.
+type NegativeCacheConfig struct {
+	Enabled bool `yaml:"enabled"`
+
+	// TTL is how long tags are cached as not found, unless overridden by the
+	// namespace of the tag.
+	TTL time.Duration `yaml:"ttl"`
+
+	// Namespaces override TTL for tags under a namespace, where namespace is a
+	// tag prefix, e.g. "team-foo/". The longest matching namespace applies.
+	Namespaces []NamespaceTTLConfig `yaml:"namespaces"`
+
+	// MaxSize bounds the number of cached tags.
+	MaxSize int `yaml:"max_size"`
+}
+
+// NamespaceTTLConfig defines the negative cache TTL of a namespace.
+type NamespaceTTLConfig struct {
+	Namespace string        `yaml:"namespace"`
+	TTL       time.Duration `yaml:"ttl"`
+}
+
+func (c NegativeCacheConfig) applyDefaults() NegativeCacheConfig {
+	if c.TTL == 0 {
+		c.TTL = 15 * time.Second
+	}
+	if c.MaxSize == 0 {
+		c.MaxSize = 10000
+	}
+	return c
+}
+
+// ttl returns the negative cache TTL of tag.
+func (c NegativeCacheConfig) ttl(tag string) time.Duration {
+	ttl := c.TTL
+	var longest int
+	for _, ns := range c.Namespaces {
+		if strings.HasPrefix(tag, ns.Namespace) && len(ns.Namespace) >= longest {
+			ttl = ns.TTL
+			longest = len(ns.Namespace)
+		}
+	}
+	return ttl
+}
+
+// negativeCache tracks tags which are known to be missing from the backend.
+type negativeCache struct {
+	config NegativeCacheConfig
+	clk    clock.Clock
+
+	mu      sync.Mutex
+	expires map[string]time.Time
+}
+
+func newNegativeCache(config NegativeCacheConfig, clk clock.Clock) *negativeCache {
+	return &negativeCache{
+		config:  config,
+		clk:     clk,
+		expires: make(map[string]time.Time),
+	}
+}
+
+// has returns true if tag was recently not found.
+func (c *negativeCache) has(tag string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.expires[tag]
+	if !ok {
+		return false
+	}
+	if !c.clk.Now().Before(e) {
+		delete(c.expires, tag)
+		return false
+	}
+	return true
+}
+
+// add records that tag was not found.
+func (c *negativeCache) add(tag string) {
+	ttl := c.config.ttl(tag)
+	if ttl <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.expires) >= c.config.MaxSize {
+		c.expires = make(map[string]time.Time)
+	}
+	c.expires[tag] = c.clk.Now().Add(ttl)
+}
+
+// remove forgets that tag was not found, e.g. because it was just put.
+func (c *negativeCache) remove(tag string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.expires, tag)
+}
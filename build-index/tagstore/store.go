@@ -15,10 +15,12 @@ package tagstore
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io"
 	"os"
+	"sync"
 	"time"
 
 	"github.com/uber/kraken/core"
@@ -28,26 +30,42 @@ import (
 	"github.com/uber/kraken/lib/persistedretry/writeback"
 	"github.com/uber/kraken/lib/store"
 	"github.com/uber/kraken/lib/store/metadata"
+	"github.com/uber/kraken/utils/log"
 
+	"github.com/andres-erbsen/clock"
+	"github.com/jmoiron/sqlx"
 	"github.com/uber-go/tally"
 )
 
 // Store errors.
 var (
-	ErrTagNotFound = errors.New("tag not found")
+	ErrTagNotFound        = errors.New("tag not found")
+	ErrSoftDeleteDisabled = errors.New("soft delete is disabled")
 )
 
 // FileStore defines operations required for storing tags on disk.
 type FileStore interface {
 	CreateCacheFile(name string, r io.Reader) error
 	SetCacheFileMetadata(name string, md metadata.Metadata) (bool, error)
+	DeleteCacheFileMetadata(name string, md metadata.Metadata) error
 	GetCacheFileReader(name string) (store.FileReader, error)
+	GetCacheFileStat(name string) (os.FileInfo, error)
+	GetCacheFileMetadata(name string, md metadata.Metadata) error
+	DeleteCacheFile(name string) error
+	ListCacheFiles() ([]string, error)
 }
 
 // Store defines tag storage operations.
 type Store interface {
 	Put(tag string, d core.Digest, writeBackDelay time.Duration) error
 	Get(tag string) (core.Digest, error)
+	GetContext(ctx context.Context, tag string) (core.Digest, error)
+	Delete(tag string) error
+	Undelete(tag string) error
+	Invalidate(tag string) error
+	Preload(tag string) (core.Digest, error)
+	PutBatch(ops []PutOp) error
+	Close()
 }
 
 // tagStore encapsulates two-level tag storage:
@@ -55,9 +73,33 @@ type Store interface {
 // 2. Remote storage: durable tag storage.
 type tagStore struct {
 	config           Config
+	stats            tally.Scope
+	clk              clock.Clock
 	fs               FileStore
 	backends         *backend.Manager
 	writeBackManager persistedretry.Manager
+	recent           *recentTags
+	notFound         *negativeCache
+	locks            tagLocks
+	journal          *batchJournal
+	payloads         *payloadStore
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+// Option allows setting optional Store parameters.
+type Option func(*tagStore)
+
+// WithClock configures a Store with a custom clock.
+func WithClock(clk clock.Clock) Option {
+	return func(s *tagStore) { s.clk = clk }
+}
+
+// WithBatchJournal configures a Store to journal batches in db, such that
+// batches interrupted by a crash are completed on startup.
+func WithBatchJournal(db *sqlx.DB) Option {
+	return func(s *tagStore) { s.journal = &batchJournal{db} }
 }
 
 // New creates a new Store.
@@ -66,24 +108,84 @@ func New(
 	stats tally.Scope,
 	fs FileStore,
 	backends *backend.Manager,
-	writeBackManager persistedretry.Manager) Store {
+	writeBackManager persistedretry.Manager,
+	opts ...Option) Store {
 
 	stats = stats.Tagged(map[string]string{
 		"module": "tagstore",
 	})
 
-	return &tagStore{
+	config.SoftDelete = config.SoftDelete.applyDefaults()
+	config.Warm = config.Warm.applyDefaults()
+	config.NegativeCache = config.NegativeCache.applyDefaults()
+
+	s := &tagStore{
 		config:           config,
+		stats:            stats,
+		clk:              clock.New(),
 		fs:               fs,
 		backends:         backends,
 		writeBackManager: writeBackManager,
+		stop:             make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	s.payloads = newPayloadStore(s.config.Dedup, stats, fs, backends)
+	if s.config.NegativeCache.Enabled {
+		s.notFound = newNegativeCache(s.config.NegativeCache, s.clk)
+	}
+	if s.journal != nil {
+		if err := s.recoverBatches(); err != nil {
+			log.Errorf("Error recovering tag batches: %s", err)
+		}
+	}
+	if s.config.SoftDelete.Enabled {
+		s.wg.Add(1)
+		go s.gcTombstones()
 	}
+	if s.config.Warm.Enabled {
+		if s.config.Warm.RecentTagsFile != "" {
+			s.recent = newRecentTags(s.config.Warm.MaxTags)
+			s.wg.Add(1)
+			go s.persistRecentTagsPeriodically()
+		}
+		go s.warm()
+	}
+	return s
+}
+
+// Close stops the background tasks of s and waits for them to exit.
+func (s *tagStore) Close() {
+	close(s.stop)
+	s.wg.Wait()
 }
 
 func (s *tagStore) Put(tag string, d core.Digest, writeBackDelay time.Duration) error {
+	defer s.locks.rlock(tag)()
+
+	if s.config.SoftDelete.Enabled {
+		// Write-back is skipped for tags which already exist in the backend,
+		// so tombstones must be overwritten directly.
+		_, t, err := s.resolve(context.Background(), tag)
+		if err != nil && err != ErrTagNotFound {
+			return fmt.Errorf("resolve: %w", err)
+		}
+		if t != nil {
+			v, err := s.value(d)
+			if err != nil {
+				return fmt.Errorf("serialize: %s", err)
+			}
+			return s.overwrite(tag, v)
+		}
+	}
+
 	if err := s.writeTagToDisk(tag, d); err != nil {
 		return fmt.Errorf("write tag to disk: %s", err)
 	}
+	if s.notFound != nil {
+		s.notFound.remove(tag)
+	}
 	if _, err := s.fs.SetCacheFileMetadata(tag, metadata.NewPersist(true)); err != nil {
 		return fmt.Errorf("set persist metadata: %s", err)
 	}
@@ -91,7 +193,16 @@ func (s *tagStore) Put(tag string, d core.Digest, writeBackDelay time.Duration)
 	task := writeback.NewTask(tag, tag, writeBackDelay)
 	if s.config.WriteThrough {
 		if err := s.writeBackManager.SyncExec(task); err != nil {
-			return fmt.Errorf("sync exec write-back task: %s", err)
+			if !backend.IsMirrorWriteError(err) {
+				return fmt.Errorf("sync exec write-back task: %s", err)
+			}
+			// The primary store has the tag, so the write-back task is
+			// retried in the background until the mirror has it too.
+			s.stats.Counter("mirror_write_failures").Inc(1)
+			log.With("tag", tag).Errorf("Error writing tag to mirror, retrying: %s", err)
+			if err := s.writeBackManager.Add(task); err != nil {
+				return fmt.Errorf("add write-back task: %s", err)
+			}
 		}
 	} else {
 		if err := s.writeBackManager.Add(task); err != nil {
@@ -101,63 +212,379 @@ func (s *tagStore) Put(tag string, d core.Digest, writeBackDelay time.Duration)
 	return nil
 }
 
-func (s *tagStore) Get(tag string) (d core.Digest, err error) {
-	for _, resolve := range []func(tag string) (core.Digest, error){
-		s.resolveFromDisk,
-		s.resolveFromBackend,
-	} {
-		d, err = resolve(tag)
-		if err == ErrTagNotFound {
+func (s *tagStore) Get(tag string) (core.Digest, error) {
+	return s.GetContext(context.Background(), tag)
+}
+
+// GetContext is like Get, however reads from the backend are abandoned once ctx
+// is done.
+func (s *tagStore) GetContext(ctx context.Context, tag string) (core.Digest, error) {
+	defer s.locks.rlock(tag)()
+
+	d, t, err := s.resolve(ctx, tag)
+	if err != nil {
+		return core.Digest{}, err
+	}
+	if t != nil {
+		return core.Digest{}, ErrTagNotFound
+	}
+	if s.recent != nil {
+		s.recent.add(tag)
+	}
+	return d, nil
+}
+
+// Delete replaces tag with a tombstone. Returns ErrTagNotFound if tag does not
+// exist or is already deleted.
+func (s *tagStore) Delete(tag string) error {
+	defer s.locks.rlock(tag)()
+
+	if !s.config.SoftDelete.Enabled {
+		return ErrSoftDeleteDisabled
+	}
+	d, t, err := s.resolve(context.Background(), tag)
+	if err != nil {
+		return err
+	}
+	if t != nil {
+		return ErrTagNotFound
+	}
+	b, err := (&tombstone{Digest: d, DeletedAt: s.clk.Now()}).serialize()
+	if err != nil {
+		return fmt.Errorf("serialize tombstone: %s", err)
+	}
+	if err := s.overwrite(tag, b); err != nil {
+		return err
+	}
+	s.stats.Counter("deletes").Inc(1)
+	return nil
+}
+
+// Undelete restores tag to the digest it pointed to before it was deleted.
+// Returns ErrTagNotFound if tag does not exist or its tombstone has expired.
+// Undeleting a tag which is not deleted is a no-op.
+func (s *tagStore) Undelete(tag string) error {
+	defer s.locks.rlock(tag)()
+
+	if !s.config.SoftDelete.Enabled {
+		return ErrSoftDeleteDisabled
+	}
+	_, t, err := s.resolve(context.Background(), tag)
+	if err != nil {
+		return err
+	}
+	if t == nil {
+		return nil
+	}
+	if t.expired(s.clk.Now(), s.config.SoftDelete.Retention) {
+		return ErrTagNotFound
+	}
+	v, err := s.value(t.Digest)
+	if err != nil {
+		return fmt.Errorf("serialize: %s", err)
+	}
+	if err := s.overwrite(tag, v); err != nil {
+		return err
+	}
+	s.stats.Counter("undeletes").Inc(1)
+	return nil
+}
+
+// Invalidate drops the cached value of tag, such that the next lookup resolves
+// tag from the backend. Values pending write-back are kept, since the backend
+// does not have them yet.
+func (s *tagStore) Invalidate(tag string) error {
+	if s.notFound != nil {
+		s.notFound.remove(tag)
+	}
+	persisted, err := s.persisted(tag)
+	if err != nil {
+		return fmt.Errorf("get persist metadata: %s", err)
+	}
+	if persisted {
+		s.stats.Counter("invalidations_skipped").Inc(1)
+		return nil
+	}
+	if err := s.deleteCacheFile(tag); err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("delete tag from disk: %s", err)
+	}
+	s.stats.Counter("invalidations").Inc(1)
+	return nil
+}
+
+// resolve returns the digest or tombstone which tag currently resolves to.
+func (s *tagStore) resolve(ctx context.Context, tag string) (d core.Digest, t *tombstone, err error) {
+	d, t, err = s.resolveFromDisk(tag)
+	if err == nil && s.cacheExpired(tag) {
+		err = ErrTagNotFound
+	}
+	if err != ErrTagNotFound {
+		return d, t, err
+	}
+	if s.notFound != nil && s.notFound.has(tag) {
+		s.stats.Counter("negative_cache_hits").Inc(1)
+		return core.Digest{}, nil, ErrTagNotFound
+	}
+	d, t, err = s.resolveFromBackend(ctx, tag)
+	if err == ErrTagNotFound && s.notFound != nil {
+		s.notFound.add(tag)
+	}
+	return d, t, err
+}
+
+// overwrite synchronously replaces the value of tag in both the backend and on
+// disk. The backend is written first, such that pending write-back tasks of
+// the prior value become no-ops.
+func (s *tagStore) overwrite(tag string, value []byte) error {
+	uploadErr, err := s.upload(tag, value)
+	if err != nil {
+		s.releaseValue(value)
+		return err
+	}
+	return s.publish(tag, value, uploadErr)
+}
+
+// upload writes value of tag to the backend. Failures to write to a mirror of
+// the primary backend are returned separately, since the value is durable.
+func (s *tagStore) upload(tag string, value []byte) (mirrorErr error, err error) {
+	backendClient, err := s.backends.GetClient(tag)
+	if err != nil {
+		return nil, fmt.Errorf("backend manager: %w", err)
+	}
+	uploadErr := backendClient.Upload(tag, tag, bytes.NewReader(value))
+	if uploadErr != nil && !backend.IsMirrorWriteError(uploadErr) {
+		return nil, fmt.Errorf("backend client: %s", uploadErr)
+	}
+	return uploadErr, nil
+}
+
+// publish replaces the value of tag on disk once it was uploaded. If uploadErr
+// is set, the value is written back until the mirror has it too.
+func (s *tagStore) publish(tag string, value []byte, uploadErr error) error {
+	if err := s.deleteTagFromDisk(tag); err != nil {
+		return fmt.Errorf("delete tag from disk: %s", err)
+	}
+	if err := s.fs.CreateCacheFile(tag, bytes.NewReader(value)); err != nil {
+		s.releaseValue(value)
+		return fmt.Errorf("write tag to disk: %s", err)
+	}
+	if uploadErr != nil {
+		// The primary store has the new value, so it is written back until the
+		// mirror has it too.
+		s.stats.Counter("mirror_write_failures").Inc(1)
+		log.With("tag", tag).Errorf("Error writing tag to mirror, retrying: %s", uploadErr)
+		if _, err := s.fs.SetCacheFileMetadata(tag, metadata.NewPersist(true)); err != nil {
+			return fmt.Errorf("set persist metadata: %s", err)
+		}
+		if err := s.writeBackManager.Add(writeback.NewTask(tag, tag, 0)); err != nil {
+			return fmt.Errorf("add write-back task: %s", err)
+		}
+	}
+	return nil
+}
+
+// gcTombstones periodically purges expired tombstones from disk and from the
+// backend. Backends which do not support deletes keep expired tombstones, which
+// behave as if the tag never existed.
+func (s *tagStore) gcTombstones() {
+	defer s.wg.Done()
+	ticker := s.clk.Ticker(s.config.SoftDelete.GCInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			if err := s.purgeTombstones(); err != nil {
+				log.Errorf("Error purging tag tombstones: %s", err)
+			}
+		}
+	}
+}
+
+func (s *tagStore) purgeTombstones() error {
+	tags, err := s.fs.ListCacheFiles()
+	if err != nil {
+		return fmt.Errorf("list cache files: %s", err)
+	}
+	for _, tag := range tags {
+		purged, err := s.purgeTombstone(tag)
+		if err != nil {
+			log.With("tag", tag).Errorf("Error purging tombstone: %s", err)
 			continue
 		}
-		break
+		if purged {
+			s.stats.Counter("purged_tombstones").Inc(1)
+		}
+	}
+	return nil
+}
+
+// purgeTombstone deletes tag from the backend and from disk if it is an expired
+// tombstone. Tombstones pending write-back are kept until the backend has them,
+// else the backend would keep the deleted digest.
+func (s *tagStore) purgeTombstone(tag string) (bool, error) {
+	defer s.locks.lock([]string{tag})()
+
+	_, t, err := s.resolveFromDisk(tag)
+	if err != nil || t == nil || !t.expired(s.clk.Now(), s.config.SoftDelete.Retention) {
+		return false, nil
+	}
+	if persisted, err := s.persisted(tag); err != nil || persisted {
+		return false, err
+	}
+	if err := s.deleteTombstoneFromBackend(tag, t); err != nil {
+		return false, fmt.Errorf("backend: %s", err)
+	}
+	if err := s.deleteTagFromDisk(tag); err != nil {
+		return false, fmt.Errorf("disk: %s", err)
+	}
+	return true, nil
+}
+
+// deleteTombstoneFromBackend deletes tag from the backend if it still holds
+// tombstone t, i.e. the tag was not put again through another build-index.
+func (s *tagStore) deleteTombstoneFromBackend(tag string, t *tombstone) error {
+	client, err := s.backends.GetClient(tag)
+	if err != nil {
+		return fmt.Errorf("backend manager: %w", err)
+	}
+	deleter, ok := client.(backend.DeleteClient)
+	if !ok || !client.Capabilities().Deletes {
+		return nil
+	}
+	_, current, err := s.resolveFromBackend(context.Background(), tag)
+	if err == ErrTagNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if current == nil || !current.DeletedAt.Equal(t.DeletedAt) {
+		return nil
 	}
-	return d, err
+	if err := deleter.Delete(tag, tag); err != nil && err != backenderrors.ErrBlobNotFound {
+		return fmt.Errorf("delete: %s", err)
+	}
+	return nil
 }
 
 func (s *tagStore) writeTagToDisk(tag string, d core.Digest) error {
-	buf := bytes.NewBufferString(d.String())
-	if err := s.fs.CreateCacheFile(tag, buf); err != nil && !os.IsExist(err) {
+	v, err := s.value(d)
+	if err != nil {
+		return err
+	}
+	if err := s.fs.CreateCacheFile(tag, bytes.NewReader(v)); err != nil {
+		s.releaseValue(v)
+		if !os.IsExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *tagStore) deleteTagFromDisk(tag string) error {
+	// Persisted files cannot be deleted.
+	err := s.fs.DeleteCacheFileMetadata(tag, &metadata.Persist{})
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("delete persist metadata: %s", err)
+	}
+	if err := s.deleteCacheFile(tag); err != nil && !os.IsNotExist(err) {
 		return err
 	}
 	return nil
 }
 
-func (s *tagStore) resolveFromDisk(tag string) (core.Digest, error) {
+// cacheExpired returns true if the cached value of tag is older than the cache
+// TTL, in which case it is dropped from disk. The TTL bounds how long a stale
+// value may be served if an invalidation from a peer is lost.
+func (s *tagStore) cacheExpired(tag string) bool {
+	if s.config.CacheTTL <= 0 {
+		return false
+	}
+	info, err := s.fs.GetCacheFileStat(tag)
+	if err != nil || s.clk.Now().Sub(info.ModTime()) < s.config.CacheTTL {
+		return false
+	}
+	if persisted, err := s.persisted(tag); err != nil || persisted {
+		return false
+	}
+	if err := s.deleteCacheFile(tag); err != nil && !os.IsNotExist(err) {
+		log.With("tag", tag).Errorf("Error deleting expired tag from disk: %s", err)
+	}
+	s.stats.Counter("expired_cache_entries").Inc(1)
+	return true
+}
+
+// persisted returns true if tag is pending write-back.
+func (s *tagStore) persisted(tag string) (bool, error) {
+	var md metadata.Persist
+	if err := s.fs.GetCacheFileMetadata(tag, &md); err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return md.Value, nil
+}
+
+func (s *tagStore) resolveFromDisk(tag string) (core.Digest, *tombstone, error) {
+	b, err := s.readFromDisk(tag)
+	if err != nil {
+		return core.Digest{}, nil, err
+	}
+	if b, err = s.dereference(b); err != nil {
+		return core.Digest{}, nil, fmt.Errorf("dereference fs value: %s", err)
+	}
+	d, t, err := parseTagValue(b)
+	if err != nil {
+		return core.Digest{}, nil, fmt.Errorf("parse fs digest: %s", err)
+	}
+	return d, t, nil
+}
+
+// readFromDisk returns the stored value of tag on disk.
+func (s *tagStore) readFromDisk(tag string) ([]byte, error) {
 	f, err := s.fs.GetCacheFileReader(tag)
 	if err != nil {
 		if os.IsNotExist(err) {
-			return core.Digest{}, ErrTagNotFound
+			return nil, ErrTagNotFound
 		}
-		return core.Digest{}, fmt.Errorf("fs: %s", err)
+		return nil, fmt.Errorf("fs: %s", err)
 	}
 	defer f.Close()
 	var b bytes.Buffer
 	if _, err := io.Copy(&b, f); err != nil {
-		return core.Digest{}, fmt.Errorf("copy from fs: %s", err)
+		return nil, fmt.Errorf("copy from fs: %s", err)
 	}
-	d, err := core.ParseSHA256Digest(b.String())
-	if err != nil {
-		return core.Digest{}, fmt.Errorf("parse fs digest: %s", err)
-	}
-	return d, nil
+	return b.Bytes(), nil
 }
 
-func (s *tagStore) resolveFromBackend(tag string) (core.Digest, error) {
+func (s *tagStore) resolveFromBackend(
+	ctx context.Context, tag string) (core.Digest, *tombstone, error) {
+
 	backendClient, err := s.backends.GetClient(tag)
 	if err != nil {
-		return core.Digest{}, fmt.Errorf("backend manager: %s", err)
+		return core.Digest{}, nil, fmt.Errorf("backend manager: %w", err)
 	}
+	backendClient = backend.WithContext(ctx, backendClient)
 	var b bytes.Buffer
 	if err := backendClient.Download(tag, tag, &b); err != nil {
 		if err == backenderrors.ErrBlobNotFound {
-			return core.Digest{}, ErrTagNotFound
+			return core.Digest{}, nil, ErrTagNotFound
 		}
-		return core.Digest{}, fmt.Errorf("backend client: %s", err)
+		return core.Digest{}, nil, fmt.Errorf("backend client: %s", err)
 	}
-	d, err := core.ParseSHA256Digest(b.String())
+	v, err := s.dereference(b.Bytes())
 	if err != nil {
-		return core.Digest{}, fmt.Errorf("parse backend digest: %s", err)
+		return core.Digest{}, nil, fmt.Errorf("dereference backend value: %s", err)
 	}
-	return d, nil
+	d, t, err := parseTagValue(v)
+	if err != nil {
+		return core.Digest{}, nil, fmt.Errorf("parse backend digest: %s", err)
+	}
+	return d, t, nil
 }
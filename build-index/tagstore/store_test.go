@@ -14,10 +14,15 @@
 package tagstore_test
 
 import (
+	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"sync"
 	"testing"
+	"time"
 
 	. "github.com/uber/kraken/build-index/tagstore"
 	"github.com/uber/kraken/core"
@@ -25,11 +30,14 @@ import (
 	"github.com/uber/kraken/lib/backend/backenderrors"
 	"github.com/uber/kraken/lib/persistedretry/writeback"
 	"github.com/uber/kraken/lib/store"
+	"github.com/uber/kraken/lib/store/metadata"
+	"github.com/uber/kraken/localdb"
 	"github.com/uber/kraken/mocks/lib/backend"
 	"github.com/uber/kraken/mocks/lib/persistedretry"
 	"github.com/uber/kraken/utils/mockutil"
 	"github.com/uber/kraken/utils/testutil"
 
+	"github.com/andres-erbsen/clock"
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/require"
 	"github.com/uber-go/tally"
@@ -64,8 +72,8 @@ func newStoreMocks(t *testing.T) (*storeMocks, func()) {
 	return &storeMocks{ctrl, ss, backends, backendClient, writeBackManager}, cleanup.Run
 }
 
-func (m *storeMocks) new(config Config) Store {
-	return New(config, tally.NoopScope, m.ss, m.backends, m.writeBackManager)
+func (m *storeMocks) new(config Config, opts ...Option) Store {
+	return New(config, tally.NoopScope, m.ss, m.backends, m.writeBackManager, opts...)
 }
 
 func checkConcurrentGets(t *testing.T, store Store, tag string, expected core.Digest) {
@@ -123,6 +131,54 @@ func TestPutAndGetFromDiskWriteThrough(t *testing.T) {
 	require.Equal(digest, result)
 }
 
+func TestPutAndGetProtobufValueFormat(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newStoreMocks(t)
+	defer cleanup()
+
+	store := mocks.new(Config{ValueFormat: ValueFormatProtobuf})
+
+	tag := core.TagFixture()
+	digest := core.DigestFixture()
+
+	mocks.writeBackManager.EXPECT().Add(
+		writeback.MatchTask(writeback.NewTask(tag, tag, 0))).Return(nil)
+
+	require.NoError(store.Put(tag, digest, 0))
+
+	f, err := mocks.ss.GetCacheFileReader(tag)
+	require.NoError(err)
+	defer f.Close()
+	b, err := ioutil.ReadAll(f)
+	require.NoError(err)
+	require.NotEqual(digest.String(), string(b))
+	require.NoError(ValidateValue(b))
+
+	result, err := store.Get(tag)
+	require.NoError(err)
+	require.Equal(digest, result)
+}
+
+func TestGetLegacyStringValueWithProtobufValueFormat(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newStoreMocks(t)
+	defer cleanup()
+
+	store := mocks.new(Config{ValueFormat: ValueFormatProtobuf})
+
+	tag := core.TagFixture()
+	digest := core.DigestFixture()
+
+	mocks.backendClient.EXPECT().Download(
+		tag, tag, mockutil.MatchWriter([]byte(digest.String()))).Return(nil)
+
+	result, err := store.Get(tag)
+	require.NoError(err)
+	require.Equal(digest, result)
+}
+
 func TestGetFromBackendNotFound(t *testing.T) {
 	require := require.New(t)
 
@@ -142,6 +198,228 @@ func TestGetFromBackendNotFound(t *testing.T) {
 	require.Equal(ErrTagNotFound, err)
 }
 
+func TestNegativeCacheExpiresPerNamespace(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newStoreMocks(t)
+	defer cleanup()
+
+	clk := clock.NewMock()
+	store := mocks.new(Config{
+		NegativeCache: NegativeCacheConfig{
+			Enabled: true,
+			TTL:     time.Minute,
+			Namespaces: []NamespaceTTLConfig{
+				{Namespace: "ci/", TTL: time.Second},
+				{Namespace: "stable/", TTL: time.Hour},
+			},
+		},
+	}, WithClock(clk))
+
+	ciTag := "ci/repo:pending"
+	stableTag := "stable/repo:missing"
+
+	expectNotFound := func(tag string) {
+		mocks.backendClient.EXPECT().Download(tag, tag, gomock.Any()).Return(backenderrors.ErrBlobNotFound)
+	}
+	get := func(tag string) {
+		_, err := store.Get(tag)
+		require.Equal(ErrTagNotFound, err)
+	}
+
+	// First lookups hit the backend, repeated ones are cached.
+	expectNotFound(ciTag)
+	expectNotFound(stableTag)
+	get(ciTag)
+	get(stableTag)
+	get(ciTag)
+	get(stableTag)
+
+	// Only the ci entry has expired.
+	clk.Add(time.Second)
+	expectNotFound(ciTag)
+	get(ciTag)
+	get(stableTag)
+
+	// The stable entry outlives the default TTL.
+	clk.Add(time.Minute)
+	expectNotFound(ciTag)
+	get(ciTag)
+	get(stableTag)
+
+	clk.Add(time.Hour)
+	expectNotFound(ciTag)
+	expectNotFound(stableTag)
+	get(ciTag)
+	get(stableTag)
+}
+
+func TestNegativeCacheBypassedAfterPut(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newStoreMocks(t)
+	defer cleanup()
+
+	store := mocks.new(Config{NegativeCache: NegativeCacheConfig{Enabled: true, TTL: time.Hour}})
+
+	tag := core.TagFixture()
+	digest := core.DigestFixture()
+
+	mocks.backendClient.EXPECT().Download(tag, tag, gomock.Any()).Return(backenderrors.ErrBlobNotFound)
+	_, err := store.Get(tag)
+	require.Equal(ErrTagNotFound, err)
+
+	mocks.writeBackManager.EXPECT().Add(gomock.Any()).Return(nil)
+	require.NoError(store.Put(tag, digest, 0))
+
+	result, err := store.Get(tag)
+	require.NoError(err)
+	require.Equal(digest, result)
+}
+
+// putWrittenBack puts tag and simulates completion of its write-back task.
+func putWrittenBack(t *testing.T, mocks *storeMocks, store Store, tag string, digest core.Digest) {
+	t.Helper()
+
+	mocks.writeBackManager.EXPECT().Add(gomock.Any()).Return(nil)
+	require.NoError(t, store.Put(tag, digest, 0))
+	require.NoError(t, mocks.ss.DeleteCacheFileMetadata(tag, &metadata.Persist{}))
+}
+
+func TestInvalidateDropsCachedTag(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newStoreMocks(t)
+	defer cleanup()
+
+	store := mocks.new(Config{})
+
+	tag := core.TagFixture()
+	stale := core.DigestFixture()
+	fresh := core.DigestFixture()
+
+	putWrittenBack(t, mocks, store, tag, stale)
+
+	require.NoError(store.Invalidate(tag))
+
+	mocks.backendClient.EXPECT().Download(
+		tag, tag, mockutil.MatchWriter([]byte(fresh.String()))).Return(nil)
+
+	result, err := store.Get(tag)
+	require.NoError(err)
+	require.Equal(fresh, result)
+
+	// Invalidating tags which are not cached is a no-op.
+	require.NoError(store.Invalidate(core.TagFixture()))
+}
+
+func TestInvalidateKeepsTagPendingWriteBack(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newStoreMocks(t)
+	defer cleanup()
+
+	store := mocks.new(Config{})
+
+	tag := core.TagFixture()
+	digest := core.DigestFixture()
+
+	mocks.writeBackManager.EXPECT().Add(gomock.Any()).Return(nil)
+	require.NoError(store.Put(tag, digest, 0))
+
+	require.NoError(store.Invalidate(tag))
+
+	result, err := store.Get(tag)
+	require.NoError(err)
+	require.Equal(digest, result)
+}
+
+func TestInvalidateClearsNegativeCache(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newStoreMocks(t)
+	defer cleanup()
+
+	store := mocks.new(Config{NegativeCache: NegativeCacheConfig{Enabled: true, TTL: time.Hour}})
+
+	tag := core.TagFixture()
+	digest := core.DigestFixture()
+
+	mocks.backendClient.EXPECT().Download(tag, tag, gomock.Any()).Return(backenderrors.ErrBlobNotFound)
+	_, err := store.Get(tag)
+	require.Equal(ErrTagNotFound, err)
+
+	require.NoError(store.Invalidate(tag))
+
+	mocks.backendClient.EXPECT().Download(
+		tag, tag, mockutil.MatchWriter([]byte(digest.String()))).Return(nil)
+
+	result, err := store.Get(tag)
+	require.NoError(err)
+	require.Equal(digest, result)
+}
+
+func TestCacheTTLExpiresCachedTag(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newStoreMocks(t)
+	defer cleanup()
+
+	clk := clock.NewMock()
+	clk.Set(time.Now())
+	store := mocks.new(Config{CacheTTL: time.Minute}, WithClock(clk))
+
+	tag := core.TagFixture()
+	stale := core.DigestFixture()
+	fresh := core.DigestFixture()
+
+	putWrittenBack(t, mocks, store, tag, stale)
+
+	result, err := store.Get(tag)
+	require.NoError(err)
+	require.Equal(stale, result)
+
+	clk.Add(2 * time.Minute)
+
+	mocks.backendClient.EXPECT().Download(
+		tag, tag, mockutil.MatchWriter([]byte(fresh.String()))).Return(nil)
+
+	result, err = store.Get(tag)
+	require.NoError(err)
+	require.Equal(fresh, result)
+}
+
+func TestPreload(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newStoreMocks(t)
+	defer cleanup()
+
+	store := mocks.new(Config{})
+
+	tag := core.TagFixture()
+	digest := core.DigestFixture()
+
+	mocks.backendClient.EXPECT().Download(
+		tag, tag, mockutil.MatchWriter([]byte(digest.String()))).Return(nil)
+
+	// Preloading a cached tag does not hit the backend again.
+	for i := 0; i < 2; i++ {
+		result, err := store.Preload(tag)
+		require.NoError(err)
+		require.Equal(digest, result)
+	}
+
+	result, err := store.Get(tag)
+	require.NoError(err)
+	require.Equal(digest, result)
+
+	mocks.backendClient.EXPECT().Download(gomock.Any(), gomock.Any(), gomock.Any()).Return(
+		backenderrors.ErrBlobNotFound)
+	_, err = store.Preload(core.TagFixture())
+	require.Equal(ErrTagNotFound, err)
+}
+
 func TestGetFromBackendUnkownError(t *testing.T) {
 	require := require.New(t)
 
@@ -182,3 +460,680 @@ func TestGetFromBackendInvalidValue(t *testing.T) {
 	_, err := store.Get(tag)
 	require.Error(err)
 }
+
+func softDeleteConfigFixture() Config {
+	return Config{
+		SoftDelete: SoftDeleteConfig{
+			Enabled:    true,
+			Retention:  time.Hour,
+			GCInterval: time.Hour,
+		},
+	}
+}
+
+func putAndDelete(t *testing.T, mocks *storeMocks, store Store, tag string, digest core.Digest) {
+	t.Helper()
+
+	mocks.backendClient.EXPECT().Download(tag, tag, gomock.Any()).Return(backenderrors.ErrBlobNotFound)
+	mocks.writeBackManager.EXPECT().Add(
+		writeback.MatchTask(writeback.NewTask(tag, tag, 0))).Return(nil)
+	require.NoError(t, store.Put(tag, digest, 0))
+
+	mocks.backendClient.EXPECT().Upload(tag, tag, gomock.Any()).Return(nil)
+	require.NoError(t, store.Delete(tag))
+}
+
+func TestDeleteAndUndelete(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newStoreMocks(t)
+	defer cleanup()
+
+	store := mocks.new(softDeleteConfigFixture(), WithClock(clock.NewMock()))
+
+	tag := core.TagFixture()
+	digest := core.DigestFixture()
+
+	putAndDelete(t, mocks, store, tag, digest)
+
+	_, err := store.Get(tag)
+	require.Equal(ErrTagNotFound, err)
+
+	require.Equal(ErrTagNotFound, store.Delete(tag))
+
+	mocks.backendClient.EXPECT().Upload(
+		tag, tag, mockutil.MatchReader([]byte(digest.String()))).Return(nil)
+	require.NoError(store.Undelete(tag))
+
+	result, err := store.Get(tag)
+	require.NoError(err)
+	require.Equal(digest, result)
+}
+
+func TestUndeleteAfterRetentionNotFound(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newStoreMocks(t)
+	defer cleanup()
+
+	clk := clock.NewMock()
+	config := softDeleteConfigFixture()
+	config.SoftDelete.GCInterval = 24 * time.Hour
+	store := mocks.new(config, WithClock(clk))
+
+	tag := core.TagFixture()
+	digest := core.DigestFixture()
+
+	putAndDelete(t, mocks, store, tag, digest)
+
+	clk.Add(config.SoftDelete.Retention + time.Minute)
+
+	require.Equal(ErrTagNotFound, store.Undelete(tag))
+}
+
+func TestPutOverwritesTombstone(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newStoreMocks(t)
+	defer cleanup()
+
+	store := mocks.new(softDeleteConfigFixture(), WithClock(clock.NewMock()))
+
+	tag := core.TagFixture()
+	digest := core.DigestFixture()
+
+	putAndDelete(t, mocks, store, tag, digest)
+
+	newDigest := core.DigestFixture()
+	mocks.backendClient.EXPECT().Upload(
+		tag, tag, mockutil.MatchReader([]byte(newDigest.String()))).Return(nil)
+	require.NoError(store.Put(tag, newDigest, 0))
+
+	result, err := store.Get(tag)
+	require.NoError(err)
+	require.Equal(newDigest, result)
+}
+
+func TestGCPurgesExpiredTombstones(t *testing.T) {
+	mocks, cleanup := newStoreMocks(t)
+	defer cleanup()
+
+	clk := clock.NewMock()
+	store := mocks.new(softDeleteConfigFixture(), WithClock(clk))
+
+	tag := core.TagFixture()
+	digest := core.DigestFixture()
+
+	putAndDelete(t, mocks, store, tag, digest)
+
+	require.NoError(t, testutil.PollUntilTrue(5*time.Second, func() bool {
+		clk.Add(time.Hour)
+		_, err := mocks.ss.GetCacheFileReader(tag)
+		return os.IsNotExist(err)
+	}))
+}
+
+func TestCloseStopsTombstoneGC(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newStoreMocks(t)
+	defer cleanup()
+
+	clk := clock.NewMock()
+	store := mocks.new(softDeleteConfigFixture(), WithClock(clk))
+
+	tag := core.TagFixture()
+	digest := core.DigestFixture()
+
+	putAndDelete(t, mocks, store, tag, digest)
+
+	store.Close()
+
+	clk.Add(2 * time.Hour)
+
+	_, err := mocks.ss.GetCacheFileReader(tag)
+	require.NoError(err)
+}
+
+func TestGCPurgesExpiredTombstonesFromBackend(t *testing.T) {
+	mocks, cleanup := newStoreMocks(t)
+	defer cleanup()
+
+	deleter := mockbackend.NewMockDeleteClient(mocks.ctrl)
+	backends := backend.ManagerFixture()
+	require.NoError(t, backends.Register(_testNamespace, deleter))
+
+	clk := clock.NewMock()
+	store := New(
+		softDeleteConfigFixture(), tally.NoopScope, mocks.ss, backends, mocks.writeBackManager,
+		WithClock(clk))
+
+	tag := core.TagFixture()
+	digest := core.DigestFixture()
+
+	deleter.EXPECT().Download(tag, tag, gomock.Any()).Return(backenderrors.ErrBlobNotFound)
+	mocks.writeBackManager.EXPECT().Add(
+		writeback.MatchTask(writeback.NewTask(tag, tag, 0))).Return(nil)
+	require.NoError(t, store.Put(tag, digest, 0))
+
+	var tombstone []byte
+	deleter.EXPECT().Upload(tag, tag, gomock.Any()).DoAndReturn(
+		func(namespace, name string, src io.Reader) error {
+			var err error
+			tombstone, err = ioutil.ReadAll(src)
+			return err
+		})
+	require.NoError(t, store.Delete(tag))
+
+	deleter.EXPECT().Capabilities().Return(backend.BackendCapabilities{Deletes: true}).AnyTimes()
+	deleter.EXPECT().Download(tag, tag, gomock.Any()).DoAndReturn(
+		func(namespace, name string, dst io.Writer) error {
+			_, err := dst.Write(tombstone)
+			return err
+		})
+	deleter.EXPECT().Delete(tag, tag).Return(nil)
+
+	require.NoError(t, testutil.PollUntilTrue(5*time.Second, func() bool {
+		clk.Add(time.Hour)
+		_, err := mocks.ss.GetCacheFileReader(tag)
+		return os.IsNotExist(err)
+	}))
+}
+
+func TestDeleteSoftDeleteDisabled(t *testing.T) {
+	mocks, cleanup := newStoreMocks(t)
+	defer cleanup()
+
+	store := mocks.new(Config{})
+
+	require.Equal(t, ErrSoftDeleteDisabled, store.Delete(core.TagFixture()))
+}
+
+func TestPutBatch(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newStoreMocks(t)
+	defer cleanup()
+
+	store := mocks.new(softDeleteConfigFixture(), WithClock(clock.NewMock()))
+
+	ops := []PutOp{
+		{core.TagFixture(), core.DigestFixture()},
+		{core.TagFixture(), core.DigestFixture()},
+	}
+	for _, op := range ops {
+		mocks.backendClient.EXPECT().Download(op.Tag, op.Tag, gomock.Any()).Return(backenderrors.ErrBlobNotFound)
+		mocks.backendClient.EXPECT().Upload(
+			op.Tag, op.Tag, mockutil.MatchReader([]byte(op.Digest.String()))).Return(nil)
+	}
+	require.NoError(store.PutBatch(ops))
+
+	for _, op := range ops {
+		result, err := store.Get(op.Tag)
+		require.NoError(err)
+		require.Equal(op.Digest, result)
+	}
+}
+
+func TestPutBatchFailureLeavesNoPartialWrites(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newStoreMocks(t)
+	defer cleanup()
+
+	store := mocks.new(softDeleteConfigFixture(), WithClock(clock.NewMock()))
+
+	// The first tag already exists, the others do not.
+	existing := core.TagFixture()
+	existingDigest := core.DigestFixture()
+	mocks.backendClient.EXPECT().Download(existing, existing, gomock.Any()).Return(backenderrors.ErrBlobNotFound)
+	putWrittenBack(t, mocks, store, existing, existingDigest)
+
+	ops := []PutOp{
+		{existing, core.DigestFixture()},
+		{core.TagFixture(), core.DigestFixture()},
+		{core.TagFixture(), core.DigestFixture()},
+	}
+	for _, op := range ops[1:] {
+		mocks.backendClient.EXPECT().Download(op.Tag, op.Tag, gomock.Any()).Return(backenderrors.ErrBlobNotFound)
+	}
+
+	// The last write fails, so the prior writes are rolled back.
+	var rolledBack []byte
+	gomock.InOrder(
+		mocks.backendClient.EXPECT().Upload(
+			ops[0].Tag, ops[0].Tag, mockutil.MatchReader([]byte(ops[0].Digest.String()))).Return(nil),
+		mocks.backendClient.EXPECT().Upload(
+			ops[1].Tag, ops[1].Tag, mockutil.MatchReader([]byte(ops[1].Digest.String()))).Return(nil),
+		mocks.backendClient.EXPECT().Upload(
+			ops[2].Tag, ops[2].Tag, gomock.Any()).Return(errors.New("some error")),
+		mocks.backendClient.EXPECT().Upload(
+			ops[0].Tag, ops[0].Tag, mockutil.MatchReader([]byte(existingDigest.String()))).Return(nil),
+		mocks.backendClient.EXPECT().Upload(ops[1].Tag, ops[1].Tag, gomock.Any()).DoAndReturn(
+			func(namespace, name string, src io.Reader) error {
+				b, err := ioutil.ReadAll(src)
+				rolledBack = b
+				return err
+			}),
+	)
+	require.Error(store.PutBatch(ops))
+
+	result, err := store.Get(existing)
+	require.NoError(err)
+	require.Equal(existingDigest, result)
+
+	// The tag created by the batch was rolled back to a value which resolves
+	// as not found.
+	mocks.backendClient.EXPECT().Download(ops[1].Tag, ops[1].Tag, gomock.Any()).DoAndReturn(
+		func(namespace, name string, dst io.Writer) error {
+			_, err := dst.Write(rolledBack)
+			return err
+		}).Times(2)
+	_, err = store.Get(ops[1].Tag)
+	require.Equal(ErrTagNotFound, err)
+	require.Equal(ErrTagNotFound, store.Undelete(ops[1].Tag))
+
+	mocks.backendClient.EXPECT().Download(ops[2].Tag, ops[2].Tag, gomock.Any()).Return(backenderrors.ErrBlobNotFound)
+	_, err = store.Get(ops[2].Tag)
+	require.Equal(ErrTagNotFound, err)
+}
+
+func TestNewRecoversBatchesInterruptedByCrash(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newStoreMocks(t)
+	defer cleanup()
+
+	db, dbCleanup := localdb.Fixture()
+	defer dbCleanup()
+
+	// A crash interrupted one batch while uploading, and another after every
+	// upload succeeded.
+	interrupted := PutOp{core.TagFixture(), core.DigestFixture()}
+	prior := core.DigestFixture()
+	committed := PutOp{core.TagFixture(), core.DigestFixture()}
+	for _, e := range []struct {
+		id        int
+		op        PutOp
+		prior     core.Digest
+		committed bool
+	}{
+		{1, interrupted, prior, false},
+		{2, committed, core.DigestFixture(), true},
+	} {
+		_, err := db.Exec(`
+			INSERT INTO tag_batch_journal (batch_id, tag, prior, value, committed)
+			VALUES (?, ?, ?, ?, ?)`,
+			e.id, e.op.Tag, []byte(e.prior.String()), []byte(e.op.Digest.String()), e.committed)
+		require.NoError(err)
+	}
+
+	mocks.backendClient.EXPECT().Upload(
+		interrupted.Tag, interrupted.Tag, mockutil.MatchReader([]byte(prior.String()))).Return(nil)
+
+	store := mocks.new(softDeleteConfigFixture(), WithClock(clock.NewMock()), WithBatchJournal(db))
+
+	result, err := store.Get(interrupted.Tag)
+	require.NoError(err)
+	require.Equal(prior, result)
+
+	result, err = store.Get(committed.Tag)
+	require.NoError(err)
+	require.Equal(committed.Digest, result)
+
+	var n int
+	require.NoError(db.Get(&n, `SELECT COUNT(*) FROM tag_batch_journal`))
+	require.Equal(0, n)
+}
+
+func TestPutBatchRejectsDuplicateTags(t *testing.T) {
+	mocks, cleanup := newStoreMocks(t)
+	defer cleanup()
+
+	store := mocks.new(softDeleteConfigFixture(), WithClock(clock.NewMock()))
+
+	tag := core.TagFixture()
+	require.Error(t, store.PutBatch([]PutOp{
+		{tag, core.DigestFixture()},
+		{tag, core.DigestFixture()},
+	}))
+}
+
+func TestPutBatchSoftDeleteDisabled(t *testing.T) {
+	mocks, cleanup := newStoreMocks(t)
+	defer cleanup()
+
+	store := mocks.new(Config{})
+
+	require.Equal(t, ErrSoftDeleteDisabled, store.PutBatch([]PutOp{
+		{core.TagFixture(), core.DigestFixture()},
+	}))
+}
+
+func waitForTagOnDisk(t *testing.T, mocks *storeMocks, tag string) {
+	t.Helper()
+
+	require.NoError(t, testutil.PollUntilTrue(5*time.Second, func() bool {
+		f, err := mocks.ss.GetCacheFileReader(tag)
+		if err != nil {
+			return false
+		}
+		f.Close()
+		return true
+	}))
+}
+
+func TestWarmConfiguredTags(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newStoreMocks(t)
+	defer cleanup()
+
+	tag := core.TagFixture()
+	digest := core.DigestFixture()
+
+	mocks.backendClient.EXPECT().Download(
+		tag, tag, mockutil.MatchWriter([]byte(digest.String()))).Return(nil).Times(1)
+
+	store := mocks.new(Config{Warm: WarmConfig{Enabled: true, Tags: []string{tag}}})
+
+	waitForTagOnDisk(t, mocks, tag)
+
+	// Served from disk without another backend call.
+	result, err := store.Get(tag)
+	require.NoError(err)
+	require.Equal(digest, result)
+}
+
+func TestWarmRecentTags(t *testing.T) {
+	require := require.New(t)
+
+	dir, err := ioutil.TempDir("", "tagstore-warm")
+	require.NoError(err)
+	defer os.RemoveAll(dir)
+
+	config := Config{Warm: WarmConfig{
+		Enabled:        true,
+		RecentTagsFile: filepath.Join(dir, "recent"),
+	}}
+
+	tag := core.TagFixture()
+	digest := core.DigestFixture()
+
+	mocks1, cleanup1 := newStoreMocks(t)
+	defer cleanup1()
+
+	clk := clock.NewMock()
+	store1 := mocks1.new(config, WithClock(clk))
+
+	mocks1.backendClient.EXPECT().Download(
+		tag, tag, mockutil.MatchWriter([]byte(digest.String()))).Return(nil)
+
+	_, err = store1.Get(tag)
+	require.NoError(err)
+
+	require.NoError(testutil.PollUntilTrue(5*time.Second, func() bool {
+		clk.Add(time.Minute)
+		_, err := os.Stat(config.Warm.RecentTagsFile)
+		return err == nil
+	}))
+
+	// A restarted store with an empty disk warms the recently accessed tag.
+	mocks2, cleanup2 := newStoreMocks(t)
+	defer cleanup2()
+
+	mocks2.backendClient.EXPECT().Download(
+		tag, tag, mockutil.MatchWriter([]byte(digest.String()))).Return(nil).Times(1)
+
+	store2 := mocks2.new(config)
+
+	waitForTagOnDisk(t, mocks2, tag)
+
+	result, err := store2.Get(tag)
+	require.NoError(err)
+	require.Equal(digest, result)
+}
+
+func TestValidateValue(t *testing.T) {
+	tests := []struct {
+		desc  string
+		value string
+		valid bool
+	}{
+		{"digest", core.DigestFixture().String(), true},
+		{"tombstone", `{"tombstone":{"digest":"` + core.DigestFixture().String() + `"}}`, true},
+		{"arbitrary bytes", "some blob", false},
+		{"envelope without tombstone", `{"foo":"bar"}`, false},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			err := ValidateValue([]byte(test.value))
+			if test.valid {
+				require.NoError(t, err)
+			} else {
+				require.Error(t, err)
+			}
+		})
+	}
+}
+
+type dualWriteMocks struct {
+	*storeMocks
+	newClient *mockbackend.MockClient
+	oldClient *mockbackend.MockClient
+}
+
+func newDualWriteMocks(t *testing.T) (*dualWriteMocks, func()) {
+	mocks, cleanup := newStoreMocks(t)
+
+	newClient := mockbackend.NewMockClient(mocks.ctrl)
+	oldClient := mockbackend.NewMockClient(mocks.ctrl)
+	newClient.EXPECT().Capabilities().Return(backend.BackendCapabilities{}).AnyTimes()
+	oldClient.EXPECT().Capabilities().Return(backend.BackendCapabilities{}).AnyTimes()
+
+	mocks.backends = backend.ManagerFixture()
+	require.NoError(t, mocks.backends.Register(
+		_testNamespace, backend.NewDualWriteClient(newClient, oldClient, backend.PrimaryNew)))
+
+	// Write-back tasks are executed against the dual-write client, such that
+	// errors from the mirror surface as they would in production.
+	executor := writeback.NewExecutor(tally.NoopScope, mocks.ss, mocks.backends)
+	mocks.writeBackManager.EXPECT().SyncExec(gomock.Any()).DoAndReturn(executor.Exec).AnyTimes()
+
+	return &dualWriteMocks{mocks, newClient, oldClient}, cleanup
+}
+
+func TestDualWritePutWritesBothBackends(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newDualWriteMocks(t)
+	defer cleanup()
+
+	store := mocks.new(Config{WriteThrough: true})
+
+	tag := core.TagFixture()
+	digest := core.DigestFixture()
+
+	r := mockutil.MatchReader([]byte(digest.String()))
+	mocks.newClient.EXPECT().Stat(tag, tag).Return(nil, backenderrors.ErrBlobNotFound)
+	mocks.newClient.EXPECT().Upload(tag, tag, r).Return(nil)
+	mocks.oldClient.EXPECT().Upload(tag, tag, r).Return(nil)
+
+	require.NoError(store.Put(tag, digest, 0))
+
+	result, err := store.Get(tag)
+	require.NoError(err)
+	require.Equal(digest, result)
+}
+
+func TestDualWriteMirrorFailureQueuedForRetry(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newDualWriteMocks(t)
+	defer cleanup()
+
+	store := mocks.new(Config{WriteThrough: true})
+
+	tag := core.TagFixture()
+	digest := core.DigestFixture()
+
+	mocks.newClient.EXPECT().Stat(tag, tag).Return(nil, backenderrors.ErrBlobNotFound)
+	mocks.newClient.EXPECT().Upload(tag, tag, gomock.Any()).Return(nil)
+	mocks.oldClient.EXPECT().Upload(tag, tag, gomock.Any()).Return(errors.New("some error"))
+	mocks.writeBackManager.EXPECT().Add(
+		writeback.MatchTask(writeback.NewTask(tag, tag, 0))).Return(nil)
+
+	require.NoError(store.Put(tag, digest, 0))
+}
+
+func TestDualWritePrimaryFailureFailsPut(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newDualWriteMocks(t)
+	defer cleanup()
+
+	store := mocks.new(Config{WriteThrough: true})
+
+	tag := core.TagFixture()
+	digest := core.DigestFixture()
+
+	mocks.newClient.EXPECT().Stat(tag, tag).Return(nil, backenderrors.ErrBlobNotFound)
+	mocks.newClient.EXPECT().Upload(tag, tag, gomock.Any()).Return(errors.New("some error"))
+
+	require.Error(store.Put(tag, digest, 0))
+}
+
+func TestDualWriteGetFallsBackToOldBackend(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newDualWriteMocks(t)
+	defer cleanup()
+
+	store := mocks.new(Config{})
+
+	tag := core.TagFixture()
+	digest := core.DigestFixture()
+
+	mocks.newClient.EXPECT().Download(tag, tag, gomock.Any()).Return(backenderrors.ErrBlobNotFound)
+	mocks.oldClient.EXPECT().Download(tag, tag, mockutil.MatchWriter([]byte(digest.String()))).Return(nil)
+
+	result, err := store.Get(tag)
+	require.NoError(err)
+	require.Equal(digest, result)
+}
+
+func TestDedupIdenticalValuesWrittenToBackendOnce(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newStoreMocks(t)
+	defer cleanup()
+
+	config := Config{Dedup: DedupConfig{Enabled: true, Namespace: "payloads"}}
+	store := mocks.new(config)
+
+	tag1 := core.TagFixture()
+	tag2 := core.TagFixture()
+	digest := core.DigestFixture()
+
+	payload, err := core.NewDigester().FromBytes([]byte(digest.String()))
+	require.NoError(err)
+
+	mocks.backendClient.EXPECT().Stat("payloads", payload.Hex()).Return(nil, backenderrors.ErrBlobNotFound)
+	mocks.backendClient.EXPECT().Upload(
+		"payloads", payload.Hex(), mockutil.MatchReader([]byte(digest.String()))).Return(nil)
+	for _, tag := range []string{tag1, tag2} {
+		mocks.writeBackManager.EXPECT().Add(
+			writeback.MatchTask(writeback.NewTask(tag, tag, 0))).Return(nil)
+	}
+
+	require.NoError(store.Put(tag1, digest, 0))
+	require.NoError(store.Put(tag2, digest, 0))
+
+	for _, tag := range []string{tag1, tag2} {
+		result, err := store.Get(tag)
+		require.NoError(err)
+		require.Equal(digest, result)
+	}
+}
+
+func TestDedupResolvesReferenceFromBackend(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newStoreMocks(t)
+	defer cleanup()
+
+	config := Config{Dedup: DedupConfig{Enabled: true, Namespace: "payloads"}}
+
+	tag := core.TagFixture()
+	digest := core.DigestFixture()
+
+	payload, err := core.NewDigester().FromBytes([]byte(digest.String()))
+	require.NoError(err)
+
+	// Write tag with a separate store to obtain its stored reference.
+	writer, c := newStoreMocks(t)
+	defer c()
+	writer.backendClient.EXPECT().Stat("payloads", payload.Hex()).Return(nil, backenderrors.ErrBlobNotFound)
+	writer.backendClient.EXPECT().Upload("payloads", payload.Hex(), gomock.Any()).Return(nil)
+	writer.writeBackManager.EXPECT().Add(gomock.Any()).Return(nil)
+	require.NoError(writer.new(config).Put(tag, digest, 0))
+	f, err := writer.ss.GetCacheFileReader(tag)
+	require.NoError(err)
+	ref, err := ioutil.ReadAll(f)
+	require.NoError(err)
+	f.Close()
+	require.NotEqual(digest.String(), string(ref))
+
+	mocks.backendClient.EXPECT().Download(tag, tag, mockutil.MatchWriter(ref)).Return(nil)
+	mocks.backendClient.EXPECT().Download(
+		"payloads", payload.Hex(), mockutil.MatchWriter([]byte(digest.String()))).Return(nil)
+
+	result, err := mocks.new(config).Get(tag)
+	require.NoError(err)
+	require.Equal(digest, result)
+}
+
+func TestDedupKeepsPayloadWhileReferenced(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newStoreMocks(t)
+	defer cleanup()
+
+	config := Config{
+		SoftDelete: SoftDeleteConfig{Enabled: true},
+		Dedup:      DedupConfig{Enabled: true, Namespace: "payloads"},
+	}
+	store := mocks.new(config)
+
+	tag1 := core.TagFixture()
+	tag2 := core.TagFixture()
+	digest := core.DigestFixture()
+
+	payload, err := core.NewDigester().FromBytes([]byte(digest.String()))
+	require.NoError(err)
+	payloadFile := "_payloads/" + payload.Hex()
+
+	mocks.backendClient.EXPECT().Stat("payloads", payload.Hex()).Return(nil, backenderrors.ErrBlobNotFound)
+	mocks.backendClient.EXPECT().Upload("payloads", payload.Hex(), gomock.Any()).Return(nil)
+	mocks.writeBackManager.EXPECT().Add(gomock.Any()).Return(nil).Times(2)
+	for _, tag := range []string{tag1, tag2} {
+		mocks.backendClient.EXPECT().Download(tag, tag, gomock.Any()).Return(backenderrors.ErrBlobNotFound)
+	}
+
+	require.NoError(store.Put(tag1, digest, 0))
+	require.NoError(store.Put(tag2, digest, 0))
+
+	mocks.backendClient.EXPECT().Upload(tag1, tag1, gomock.Any()).Return(nil)
+	require.NoError(store.Delete(tag1))
+
+	// The payload is still referenced by tag2, so it is served from disk.
+	result, err := store.Get(tag2)
+	require.NoError(err)
+	require.Equal(digest, result)
+
+	mocks.backendClient.EXPECT().Upload(tag2, tag2, gomock.Any()).Return(nil)
+	require.NoError(store.Delete(tag2))
+
+	_, err = mocks.ss.GetCacheFileStat(payloadFile)
+	require.True(os.IsNotExist(err))
+}
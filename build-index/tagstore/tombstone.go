@@ -0,0 +1,80 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package tagstore
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/uber/kraken/core"
+)
+
+// tombstone replaces the contents of a deleted tag, retaining the digest the
+// tag pointed to so the deletion may be undone.
+type tombstone struct {
+	Digest    core.Digest `json:"digest"`
+	DeletedAt time.Time   `json:"deleted_at"`
+}
+
+func (t *tombstone) expired(now time.Time, retention time.Duration) bool {
+	return now.Sub(t.DeletedAt) > retention
+}
+
+func (t *tombstone) serialize() ([]byte, error) {
+	return json.Marshal(struct {
+		Tombstone *tombstone `json:"tombstone"`
+	}{t})
+}
+
+// ValidateValue returns an error if b is not a valid stored tag value.
+func ValidateValue(b []byte) error {
+	_, _, err := parseTagValue(b)
+	return err
+}
+
+// parseTagValue parses the stored value of a tag, which is either a digest, in
+// the legacy string format or the protobuf format, or a tombstone. Exactly one
+// of the return values is set on success.
+func parseTagValue(b []byte) (core.Digest, *tombstone, error) {
+	if isProtobufValue(b) {
+		v, err := parseProtobufValue(b)
+		if err != nil {
+			return core.Digest{}, nil, err
+		}
+		d, err := core.ParseDigest(v.Digest)
+		if err != nil {
+			return core.Digest{}, nil, err
+		}
+		return d, nil, nil
+	}
+	if !bytes.HasPrefix(b, []byte("{")) {
+		d, err := core.ParseDigest(string(b))
+		if err != nil {
+			return core.Digest{}, nil, err
+		}
+		return d, nil, nil
+	}
+	var v struct {
+		Tombstone *tombstone `json:"tombstone"`
+	}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return core.Digest{}, nil, fmt.Errorf("json: %s", err)
+	}
+	if v.Tombstone == nil {
+		return core.Digest{}, nil, fmt.Errorf("missing tombstone")
+	}
+	return core.Digest{}, v.Tombstone, nil
+}
@@ -0,0 +1,78 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package tagstore
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/gen/go/proto/tagvalue"
+)
+
+// Formats of serialized tag values.
+const (
+	ValueFormatString   = "string"
+	ValueFormatProtobuf = "protobuf"
+)
+
+// Protobuf tag values are prefixed with valueMagic followed by a version byte.
+// The magic prefix cannot start a digest or a tombstone, so values written in
+// any format may be read back regardless of the configured format.
+var valueMagic = []byte("\x00ktv")
+
+const valueVersion byte = 1
+
+// serializeValue returns the stored value of v in format.
+func serializeValue(v *tagvalue.TagValue, format string) ([]byte, error) {
+	switch format {
+	case "", ValueFormatString:
+		return []byte(v.Digest), nil
+	case ValueFormatProtobuf:
+		b, err := proto.Marshal(v)
+		if err != nil {
+			return nil, fmt.Errorf("proto: %s", err)
+		}
+		return append(append(append([]byte{}, valueMagic...), valueVersion), b...), nil
+	default:
+		return nil, fmt.Errorf("unknown value format %q", format)
+	}
+}
+
+// serialize returns the stored value of d in the configured format.
+func (s *tagStore) serialize(d core.Digest) ([]byte, error) {
+	return serializeValue(&tagvalue.TagValue{Digest: d.String()}, s.config.ValueFormat)
+}
+
+// isProtobufValue returns true if b is a protobuf tag value.
+func isProtobufValue(b []byte) bool {
+	return bytes.HasPrefix(b, valueMagic)
+}
+
+// parseProtobufValue parses a protobuf tag value.
+func parseProtobufValue(b []byte) (*tagvalue.TagValue, error) {
+	b = b[len(valueMagic):]
+	if len(b) == 0 {
+		return nil, fmt.Errorf("missing version")
+	}
+	if b[0] != valueVersion {
+		return nil, fmt.Errorf("unsupported version %d", b[0])
+	}
+	var v tagvalue.TagValue
+	if err := proto.Unmarshal(b[1:], &v); err != nil {
+		return nil, fmt.Errorf("proto: %s", err)
+	}
+	return &v, nil
+}
@@ -0,0 +1,95 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package tagstore
+
+import (
+	"testing"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/gen/go/proto/tagvalue"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSerializeValueProtobufRoundTrip(t *testing.T) {
+	require := require.New(t)
+
+	d := core.DigestFixture()
+	v := &tagvalue.TagValue{
+		Digest:    d.String(),
+		MediaType: "application/vnd.docker.distribution.manifest.v2+json",
+		Labels:    map[string]string{"team": "foo"},
+		History:   []string{core.DigestFixture().String()},
+	}
+
+	b, err := serializeValue(v, ValueFormatProtobuf)
+	require.NoError(err)
+	require.True(isProtobufValue(b))
+
+	result, err := parseProtobufValue(b)
+	require.NoError(err)
+	require.True(proto.Equal(v, result))
+
+	parsed, tomb, err := parseTagValue(b)
+	require.NoError(err)
+	require.Nil(tomb)
+	require.Equal(d, parsed)
+}
+
+func TestParseTagValueLegacyString(t *testing.T) {
+	require := require.New(t)
+
+	d := core.DigestFixture()
+
+	b, err := serializeValue(&tagvalue.TagValue{Digest: d.String()}, ValueFormatString)
+	require.NoError(err)
+	require.Equal(d.String(), string(b))
+	require.False(isProtobufValue(b))
+
+	parsed, tomb, err := parseTagValue(b)
+	require.NoError(err)
+	require.Nil(tomb)
+	require.Equal(d, parsed)
+}
+
+func TestParseTagValueProtobufErrors(t *testing.T) {
+	valid, err := proto.Marshal(&tagvalue.TagValue{Digest: core.DigestFixture().String()})
+	require.NoError(t, err)
+
+	tests := []struct {
+		desc  string
+		value []byte
+	}{
+		{"missing version", valueMagic},
+		{"unsupported version", append(append(append([]byte{}, valueMagic...), 2), valid...)},
+		{"corrupt payload", append(append([]byte{}, valueMagic...), valueVersion, 0xff)},
+		{"invalid digest", func() []byte {
+			b, err := serializeValue(&tagvalue.TagValue{Digest: "foo"}, ValueFormatProtobuf)
+			require.NoError(t, err)
+			return b
+		}()},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			_, _, err := parseTagValue(test.value)
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestSerializeValueUnknownFormat(t *testing.T) {
+	_, err := serializeValue(&tagvalue.TagValue{Digest: core.DigestFixture().String()}, "xml")
+	require.Error(t, err)
+}
@@ -0,0 +1,227 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package tagstore
+
+import (
+	"bufio"
+	"container/list"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/utils/log"
+
+	"golang.org/x/time/rate"
+)
+
+// recentTags tracks the most recently accessed tags, bounded by size.
+type recentTags struct {
+	sync.Mutex
+	size  int
+	order *list.List
+	elems map[string]*list.Element
+}
+
+func newRecentTags(size int) *recentTags {
+	return &recentTags{
+		size:  size,
+		order: list.New(),
+		elems: make(map[string]*list.Element),
+	}
+}
+
+func (r *recentTags) add(tag string) {
+	r.Lock()
+	defer r.Unlock()
+
+	if e, ok := r.elems[tag]; ok {
+		r.order.MoveToFront(e)
+		return
+	}
+	r.elems[tag] = r.order.PushFront(tag)
+	if r.order.Len() > r.size {
+		e := r.order.Back()
+		r.order.Remove(e)
+		delete(r.elems, e.Value.(string))
+	}
+}
+
+// list returns tracked tags, most recently accessed first.
+func (r *recentTags) list() []string {
+	r.Lock()
+	defer r.Unlock()
+
+	tags := make([]string, 0, r.order.Len())
+	for e := r.order.Front(); e != nil; e = e.Next() {
+		tags = append(tags, e.Value.(string))
+	}
+	return tags
+}
+
+// warmTags returns the tags to warm on startup: configured tags first, followed
+// by tags persisted in the recent tags file.
+func (s *tagStore) warmTags() ([]string, error) {
+	tags := append([]string{}, s.config.Warm.Tags...)
+	if s.config.Warm.RecentTagsFile != "" {
+		recent, err := readRecentTags(s.config.Warm.RecentTagsFile)
+		if err != nil {
+			return nil, fmt.Errorf("read recent tags: %s", err)
+		}
+		tags = append(tags, recent...)
+	}
+	seen := make(map[string]bool)
+	var result []string
+	for _, tag := range tags {
+		if seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		result = append(result, tag)
+		if len(result) == s.config.Warm.MaxTags {
+			break
+		}
+	}
+	return result, nil
+}
+
+// warm caches tags which are not already on disk, throttled to config.Warm.RPS
+// backend lookups per second.
+func (s *tagStore) warm() {
+	tags, err := s.warmTags()
+	if err != nil {
+		log.Errorf("Error warming tag cache: %s", err)
+		return
+	}
+	limiter := rate.NewLimiter(rate.Limit(s.config.Warm.RPS), 1)
+	for _, tag := range tags {
+		if _, _, err := s.resolveFromDisk(tag); err != ErrTagNotFound {
+			continue
+		}
+		if err := limiter.Wait(context.Background()); err != nil {
+			log.Errorf("Error throttling tag cache warming: %s", err)
+			return
+		}
+		if _, err := s.cacheFromBackend(tag); err != nil {
+			if err != ErrTagNotFound {
+				log.With("tag", tag).Errorf("Error warming tag: %s", err)
+			}
+			continue
+		}
+		s.stats.Counter("warmed_tags").Inc(1)
+	}
+}
+
+// Preload caches tag on disk ahead of anticipated lookups, unless it is already
+// cached. Returns ErrTagNotFound if tag does not exist or is deleted.
+func (s *tagStore) Preload(tag string) (core.Digest, error) {
+	defer s.locks.rlock(tag)()
+
+	d, t, err := s.resolveFromDisk(tag)
+	if err == nil {
+		if t != nil {
+			return core.Digest{}, ErrTagNotFound
+		}
+		return d, nil
+	}
+	if err != ErrTagNotFound {
+		return core.Digest{}, err
+	}
+	d, err = s.cacheFromBackend(tag)
+	if err != nil {
+		return core.Digest{}, err
+	}
+	s.stats.Counter("preloaded_tags").Inc(1)
+	return d, nil
+}
+
+// cacheFromBackend resolves tag from the backend and caches it on disk. Returns
+// ErrTagNotFound if tag does not exist or is deleted.
+func (s *tagStore) cacheFromBackend(tag string) (core.Digest, error) {
+	d, t, err := s.resolveFromBackend(context.Background(), tag)
+	if err != nil {
+		return core.Digest{}, err
+	}
+	if t != nil {
+		return core.Digest{}, ErrTagNotFound
+	}
+	// Cached tags are not persisted, so they may be evicted from disk like
+	// any other cached file.
+	if err := s.writeTagToDisk(tag, d); err != nil {
+		return core.Digest{}, fmt.Errorf("write tag to disk: %s", err)
+	}
+	return d, nil
+}
+
+// persistRecentTagsPeriodically writes recently accessed tags to
+// config.Warm.RecentTagsFile every config.Warm.PersistInterval.
+func (s *tagStore) persistRecentTagsPeriodically() {
+	defer s.wg.Done()
+	ticker := s.clk.Ticker(s.config.Warm.PersistInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			if err := writeRecentTags(s.config.Warm.RecentTagsFile, s.recent.list()); err != nil {
+				log.Errorf("Error persisting recent tags: %s", err)
+			}
+		}
+	}
+}
+
+func readRecentTags(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+	var tags []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if tag := strings.TrimSpace(scanner.Text()); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags, scanner.Err()
+}
+
+// writeRecentTags atomically replaces path with tags, one per line.
+func writeRecentTags(path string, tags []string) error {
+	f, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path))
+	if err != nil {
+		return fmt.Errorf("create temp file: %s", err)
+	}
+	defer os.Remove(f.Name())
+	w := bufio.NewWriter(f)
+	for _, tag := range tags {
+		fmt.Fprintln(w, tag)
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return fmt.Errorf("write: %s", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("close: %s", err)
+	}
+	return os.Rename(f.Name(), path)
+}
@@ -0,0 +1,134 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package tagsync
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Checkpoint records the progress of syncing a namespace.
+type Checkpoint struct {
+	// Digests maps tags to their digest as of the last time they were synced.
+	Digests map[string]string `json:"digests"`
+
+	// Offset is the listing offset at which an interrupted sync resumes. Empty
+	// if the last sync ran to completion.
+	Offset string `json:"offset,omitempty"`
+
+	// LastSync is when the last sync which ran to completion started.
+	LastSync time.Time `json:"last_sync"`
+
+	// Started and ModifiedSince are when the current sync started, and the
+	// modification time it lists tags from.
+	Started       time.Time `json:"started"`
+	ModifiedSince time.Time `json:"modified_since"`
+}
+
+func newCheckpoint() *Checkpoint {
+	return &Checkpoint{Digests: make(map[string]string)}
+}
+
+// CheckpointStore persists checkpoints, keyed by the clusters and namespace
+// they record the sync of.
+type CheckpointStore interface {
+	Load(key string) (*Checkpoint, error)
+	Save(key string, cp *Checkpoint) error
+}
+
+// FileCheckpointStore persists checkpoints as a JSON file.
+type FileCheckpointStore struct {
+	sync.Mutex
+	path string
+}
+
+// NewFileCheckpointStore creates a new FileCheckpointStore which persists
+// checkpoints at path.
+func NewFileCheckpointStore(path string) *FileCheckpointStore {
+	return &FileCheckpointStore{path: path}
+}
+
+// Load returns the persisted checkpoint of key, or an empty checkpoint if none
+// has been saved yet.
+func (s *FileCheckpointStore) Load(key string) (*Checkpoint, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	cps, err := s.read()
+	if err != nil {
+		return nil, err
+	}
+	cp, ok := cps[key]
+	if !ok {
+		return newCheckpoint(), nil
+	}
+	if cp.Digests == nil {
+		cp.Digests = make(map[string]string)
+	}
+	return cp, nil
+}
+
+func (s *FileCheckpointStore) read() (map[string]*Checkpoint, error) {
+	cps := make(map[string]*Checkpoint)
+	b, err := ioutil.ReadFile(s.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return cps, nil
+		}
+		return nil, fmt.Errorf("read file: %s", err)
+	}
+	if err := json.Unmarshal(b, &cps); err != nil {
+		return nil, fmt.Errorf("json unmarshal: %s", err)
+	}
+	return cps, nil
+}
+
+// Save persists cp as the checkpoint of key. The previous checkpoints are
+// atomically replaced, such that a crash never leaves a partially written
+// checkpoint.
+func (s *FileCheckpointStore) Save(key string, cp *Checkpoint) error {
+	s.Lock()
+	defer s.Unlock()
+
+	cps, err := s.read()
+	if err != nil {
+		return err
+	}
+	cps[key] = cp
+	b, err := json.Marshal(cps)
+	if err != nil {
+		return fmt.Errorf("json marshal: %s", err)
+	}
+	f, err := ioutil.TempFile(filepath.Dir(s.path), filepath.Base(s.path)+".")
+	if err != nil {
+		return fmt.Errorf("create temp file: %s", err)
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return fmt.Errorf("write temp file: %s", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("close temp file: %s", err)
+	}
+	if err := os.Rename(f.Name(), s.path); err != nil {
+		return fmt.Errorf("rename: %s", err)
+	}
+	return nil
+}
@@ -0,0 +1,194 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package tagsync
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/uber/kraken/build-index/tagclient"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/uber-go/tally"
+)
+
+// Config defines Syncer configuration.
+type Config struct {
+	// Source and Destination are the addresses of the source and destination
+	// clusters. Destination must match a remote of the source, and
+	// checkpoints are keyed by both.
+	Source      string `yaml:"source"`
+	Destination string `yaml:"destination"`
+
+	// PageSize is the number of tags listed per page. The checkpoint is saved
+	// after every page.
+	PageSize int `yaml:"page_size"`
+
+	// Overlap is how far before the start of the last sync tags are listed
+	// from, which tolerates clock skew between the syncer and the backend.
+	Overlap time.Duration `yaml:"overlap"`
+}
+
+func (c Config) applyDefaults() Config {
+	if c.PageSize == 0 {
+		c.PageSize = 200
+	}
+	if c.Overlap == 0 {
+		c.Overlap = 5 * time.Minute
+	}
+	return c
+}
+
+// Result summarizes a sync.
+type Result struct {
+	// Scanned is the number of tags listed from the source.
+	Scanned int
+
+	// Synced is the number of tags replicated to the destination.
+	Synced int
+}
+
+// Syncer incrementally syncs the tags of a namespace from a source cluster to a
+// destination cluster. The destination must be configured as a remote of the
+// source, since tags are synced via the source's replication.
+//
+// Only tags modified since the last sync are listed, if the source's backend
+// supports it. Tags whose digest changed since they were last synced, or which
+// are missing or stale on the destination, are replicated to the destination
+// only. Progress is checkpointed after every page of tags, such that an
+// interrupted sync resumes where it left off and running a sync repeatedly
+// replicates nothing new.
+type Syncer struct {
+	config      Config
+	stats       tally.Scope
+	clk         clock.Clock
+	source      tagclient.Client
+	dest        tagclient.Client
+	checkpoints CheckpointStore
+}
+
+// New creates a new Syncer.
+func New(
+	config Config,
+	stats tally.Scope,
+	clk clock.Clock,
+	source tagclient.Client,
+	dest tagclient.Client,
+	checkpoints CheckpointStore) (*Syncer, error) {
+
+	if config.Source == "" || config.Destination == "" {
+		return nil, errors.New("source and destination required")
+	}
+	stats = stats.Tagged(map[string]string{
+		"module": "tagsync",
+	})
+	return &Syncer{config.applyDefaults(), stats, clk, source, dest, checkpoints}, nil
+}
+
+// Sync syncs all tags under namespace prefix.
+func (s *Syncer) Sync(namespace string) (Result, error) {
+	var result Result
+
+	key := s.checkpointKey(namespace)
+	cp, err := s.checkpoints.Load(key)
+	if err != nil {
+		return result, fmt.Errorf("load checkpoint: %s", err)
+	}
+	if cp.Offset == "" {
+		// Start a new sync. Interrupted syncs resume with the bounds they
+		// started with.
+		cp.Started = s.clk.Now()
+		cp.ModifiedSince = time.Time{}
+		if !cp.LastSync.IsZero() {
+			cp.ModifiedSince = cp.LastSync.Add(-s.config.Overlap)
+		}
+	}
+	for {
+		resp, err := s.source.ListWithPagination(namespace, tagclient.ListFilter{
+			Offset:        cp.Offset,
+			Limit:         s.config.PageSize,
+			ModifiedSince: cp.ModifiedSince,
+		})
+		if err != nil {
+			return result, fmt.Errorf("list source: %s", err)
+		}
+		for _, tag := range resp.Result {
+			result.Scanned++
+			synced, err := s.syncTag(cp, tag)
+			if err != nil {
+				s.stats.Counter("sync_errors").Inc(1)
+				return result, fmt.Errorf("sync %s: %s", tag, err)
+			}
+			if synced {
+				result.Synced++
+			}
+		}
+		offset, err := resp.GetOffset()
+		if err == io.EOF {
+			cp.Offset = ""
+			// Tags modified while the sync ran may have been listed already,
+			// so the next sync lists from when this one started.
+			cp.LastSync = cp.Started
+		} else if err != nil {
+			return result, fmt.Errorf("get offset: %s", err)
+		} else {
+			cp.Offset = offset
+		}
+		if err := s.checkpoints.Save(key, cp); err != nil {
+			return result, fmt.Errorf("save checkpoint: %s", err)
+		}
+		if cp.Offset == "" {
+			break
+		}
+	}
+	s.stats.Counter("synced_tags").Inc(int64(result.Synced))
+	return result, nil
+}
+
+// checkpointKey returns the key of the checkpoint of syncing namespace, which
+// is distinct per source and destination.
+func (s *Syncer) checkpointKey(namespace string) string {
+	return fmt.Sprintf("%s:%s:%s", s.config.Source, s.config.Destination, namespace)
+}
+
+// syncTag replicates tag if it changed since it was last synced, recording
+// its digest in cp. Returns whether tag was replicated.
+func (s *Syncer) syncTag(cp *Checkpoint, tag string) (bool, error) {
+	d, err := s.source.Get(tag)
+	if err != nil {
+		if err == tagclient.ErrTagNotFound {
+			// Tag was deleted since it was listed.
+			delete(cp.Digests, tag)
+			return false, nil
+		}
+		return false, fmt.Errorf("get source: %s", err)
+	}
+	if cp.Digests[tag] == d.String() {
+		return false, nil
+	}
+	remote, err := s.dest.Get(tag)
+	if err == nil && remote == d {
+		cp.Digests[tag] = d.String()
+		return false, nil
+	} else if err != nil && err != tagclient.ErrTagNotFound {
+		return false, fmt.Errorf("get destination: %s", err)
+	}
+	if err := s.source.ReplicateTo(tag, s.config.Destination); err != nil {
+		return false, fmt.Errorf("replicate: %s", err)
+	}
+	cp.Digests[tag] = d.String()
+	return true, nil
+}
@@ -0,0 +1,248 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package tagsync
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/uber/kraken/build-index/tagclient"
+	"github.com/uber/kraken/build-index/tagmodels"
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/mocks/build-index/tagclient"
+	"github.com/uber/kraken/utils/testutil"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+	"github.com/uber-go/tally"
+)
+
+const (
+	_testNamespace = "namespace-foo"
+	_testSource    = "source:80"
+	_testDest      = "dest:80"
+)
+
+func listResponse(next string, tags ...string) tagmodels.ListResponse {
+	var resp tagmodels.ListResponse
+	if next != "" {
+		resp.Links.Next = "http://source/list/" + _testNamespace + "?offset=" + next
+	}
+	resp.Size = len(tags)
+	resp.Result = tags
+	return resp
+}
+
+type syncerMocks struct {
+	clk         *clock.Mock
+	source      *mocktagclient.MockClient
+	dest        *mocktagclient.MockClient
+	checkpoints *FileCheckpointStore
+}
+
+func newSyncerMocks(t *testing.T) (*syncerMocks, func()) {
+	var cleanup testutil.Cleanup
+	defer cleanup.Recover()
+
+	ctrl := gomock.NewController(t)
+	cleanup.Add(ctrl.Finish)
+
+	dir, err := ioutil.TempDir("", "tagsync")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cleanup.Add(func() { os.RemoveAll(dir) })
+
+	return &syncerMocks{
+		clk:         clock.NewMock(),
+		source:      mocktagclient.NewMockClient(ctrl),
+		dest:        mocktagclient.NewMockClient(ctrl),
+		checkpoints: NewFileCheckpointStore(filepath.Join(dir, "checkpoint")),
+	}, cleanup.Run
+}
+
+func (m *syncerMocks) new(t *testing.T, dest string) *Syncer {
+	s, err := New(
+		Config{Source: _testSource, Destination: dest, PageSize: 2},
+		tally.NoopScope, m.clk, m.source, m.dest, m.checkpoints)
+	require.NoError(t, err)
+	return s
+}
+
+func TestSyncOnlyReplicatesNewTags(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newSyncerMocks(t)
+	defer cleanup()
+
+	syncer := mocks.new(t, _testDest)
+
+	tag1, d1 := core.TagFixture(), core.DigestFixture()
+	tag2, d2 := core.TagFixture(), core.DigestFixture()
+	tag3, d3 := core.TagFixture(), core.DigestFixture()
+
+	// Initial sync replicates everything missing on the destination.
+	gomock.InOrder(
+		mocks.source.EXPECT().ListWithPagination(
+			_testNamespace, tagclient.ListFilter{Limit: 2}).Return(listResponse("", tag1, tag2), nil),
+		mocks.source.EXPECT().Get(tag1).Return(d1, nil),
+		mocks.dest.EXPECT().Get(tag1).Return(core.Digest{}, tagclient.ErrTagNotFound),
+		mocks.source.EXPECT().ReplicateTo(tag1, _testDest).Return(nil),
+		mocks.source.EXPECT().Get(tag2).Return(d2, nil),
+		mocks.dest.EXPECT().Get(tag2).Return(d2, nil),
+	)
+
+	result, err := syncer.Sync(_testNamespace)
+	require.NoError(err)
+	require.Equal(Result{Scanned: 2, Synced: 1}, result)
+
+	// Adding a tag causes only that tag to be synced, listing tags modified
+	// since the initial sync.
+	start := mocks.clk.Now()
+	mocks.clk.Add(time.Hour)
+	since := start.Add(-5 * time.Minute).UTC()
+	gomock.InOrder(
+		mocks.source.EXPECT().ListWithPagination(
+			_testNamespace, tagclient.ListFilter{Limit: 2, ModifiedSince: since}).Return(
+			listResponse("o1", tag1), nil),
+		mocks.source.EXPECT().Get(tag1).Return(d1, nil),
+		mocks.source.EXPECT().ListWithPagination(
+			_testNamespace, tagclient.ListFilter{Offset: "o1", Limit: 2, ModifiedSince: since}).Return(
+			listResponse("", tag3), nil),
+		mocks.source.EXPECT().Get(tag3).Return(d3, nil),
+		mocks.dest.EXPECT().Get(tag3).Return(core.Digest{}, tagclient.ErrTagNotFound),
+		mocks.source.EXPECT().ReplicateTo(tag3, _testDest).Return(nil),
+	)
+
+	result, err = syncer.Sync(_testNamespace)
+	require.NoError(err)
+	require.Equal(Result{Scanned: 2, Synced: 1}, result)
+}
+
+func TestSyncReplicatesChangedTags(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newSyncerMocks(t)
+	defer cleanup()
+
+	syncer := mocks.new(t, _testDest)
+
+	tag, d := core.TagFixture(), core.DigestFixture()
+	updated := core.DigestFixture()
+
+	gomock.InOrder(
+		mocks.source.EXPECT().ListWithPagination(
+			_testNamespace, gomock.Any()).Return(listResponse("", tag), nil),
+		mocks.source.EXPECT().Get(tag).Return(d, nil),
+		mocks.dest.EXPECT().Get(tag).Return(d, nil),
+		mocks.source.EXPECT().ListWithPagination(
+			_testNamespace, gomock.Any()).Return(listResponse("", tag), nil),
+		mocks.source.EXPECT().Get(tag).Return(updated, nil),
+		mocks.dest.EXPECT().Get(tag).Return(d, nil),
+		mocks.source.EXPECT().ReplicateTo(tag, _testDest).Return(nil),
+	)
+
+	result, err := syncer.Sync(_testNamespace)
+	require.NoError(err)
+	require.Equal(0, result.Synced)
+
+	result, err = syncer.Sync(_testNamespace)
+	require.NoError(err)
+	require.Equal(1, result.Synced)
+}
+
+func TestSyncResumesFromCheckpoint(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newSyncerMocks(t)
+	defer cleanup()
+
+	syncer := mocks.new(t, _testDest)
+
+	tag1, d1 := core.TagFixture(), core.DigestFixture()
+	tag2, d2 := core.TagFixture(), core.DigestFixture()
+
+	// The sync is interrupted on the second page.
+	gomock.InOrder(
+		mocks.source.EXPECT().ListWithPagination(
+			_testNamespace, tagclient.ListFilter{Limit: 2}).Return(listResponse("o1", tag1), nil),
+		mocks.source.EXPECT().Get(tag1).Return(d1, nil),
+		mocks.dest.EXPECT().Get(tag1).Return(core.Digest{}, tagclient.ErrTagNotFound),
+		mocks.source.EXPECT().ReplicateTo(tag1, _testDest).Return(nil),
+		mocks.source.EXPECT().ListWithPagination(
+			_testNamespace, tagclient.ListFilter{Offset: "o1", Limit: 2}).Return(
+			tagmodels.ListResponse{}, errors.New("some error")),
+	)
+
+	_, err := syncer.Sync(_testNamespace)
+	require.Error(err)
+
+	// The next sync resumes at the second page, with a new Syncer.
+	gomock.InOrder(
+		mocks.source.EXPECT().ListWithPagination(
+			_testNamespace, tagclient.ListFilter{Offset: "o1", Limit: 2}).Return(listResponse("", tag2), nil),
+		mocks.source.EXPECT().Get(tag2).Return(d2, nil),
+		mocks.dest.EXPECT().Get(tag2).Return(core.Digest{}, tagclient.ErrTagNotFound),
+		mocks.source.EXPECT().ReplicateTo(tag2, _testDest).Return(nil),
+	)
+
+	result, err := mocks.new(t, _testDest).Sync(_testNamespace)
+	require.NoError(err)
+	require.Equal(Result{Scanned: 1, Synced: 1}, result)
+
+	cp, err := mocks.checkpoints.Load(mocks.new(t, _testDest).checkpointKey(_testNamespace))
+	require.NoError(err)
+	require.Empty(cp.Offset)
+	require.Equal(map[string]string{tag1: d1.String(), tag2: d2.String()}, cp.Digests)
+}
+
+func TestSyncCheckpointsAreKeyedByDestination(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newSyncerMocks(t)
+	defer cleanup()
+
+	tag, d := core.TagFixture(), core.DigestFixture()
+
+	gomock.InOrder(
+		mocks.source.EXPECT().ListWithPagination(
+			_testNamespace, tagclient.ListFilter{Limit: 2}).Return(listResponse("", tag), nil),
+		mocks.source.EXPECT().Get(tag).Return(d, nil),
+		mocks.dest.EXPECT().Get(tag).Return(core.Digest{}, tagclient.ErrTagNotFound),
+		mocks.source.EXPECT().ReplicateTo(tag, _testDest).Return(nil),
+	)
+
+	_, err := mocks.new(t, _testDest).Sync(_testNamespace)
+	require.NoError(err)
+
+	// A sync to another destination does not resume from the checkpoint of the
+	// first destination.
+	other := "other-dest:80"
+	gomock.InOrder(
+		mocks.source.EXPECT().ListWithPagination(
+			_testNamespace, tagclient.ListFilter{Limit: 2}).Return(listResponse("", tag), nil),
+		mocks.source.EXPECT().Get(tag).Return(d, nil),
+		mocks.dest.EXPECT().Get(tag).Return(core.Digest{}, tagclient.ErrTagNotFound),
+		mocks.source.EXPECT().ReplicateTo(tag, other).Return(nil),
+	)
+
+	result, err := mocks.new(t, other).Sync(_testNamespace)
+	require.NoError(err)
+	require.Equal(Result{Scanned: 1, Synced: 1}, result)
+}
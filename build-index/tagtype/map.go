@@ -60,6 +60,8 @@ func NewMap(configs []Config, originClient blobclient.ClusterClient) (*Map, erro
 		switch config.Type {
 		case "docker":
 			sr = &subResolver{re, &dockerResolver{originClient}}
+		case "oci":
+			sr = &subResolver{re, &ociResolver{originClient}}
 		case "default":
 			sr = &subResolver{re, &defaultResolver{}}
 		default:
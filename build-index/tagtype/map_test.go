@@ -29,6 +29,7 @@ func testConfigs() []Config {
 	return []Config{
 		{Namespace: "namespace-foo/.*", Type: "docker"},
 		{Namespace: "namespace-bar/.*", Type: "default"},
+		{Namespace: "namespace-baz/.*", Type: "oci"},
 	}
 }
 
@@ -54,6 +55,40 @@ func TestMapResolveDocker(t *testing.T) {
 	require.Equal(core.DigestList(append(layers, manifest)), deps)
 }
 
+func TestMapResolveOCI(t *testing.T) {
+	tag := "namespace-baz/repo-bar:0001"
+	layers := core.DigestListFixture(3)
+	ociManifest, ociRaw := dockerutil.OCIManifestFixture(layers[0], layers[1], layers[2])
+	dockerManifest, dockerRaw := dockerutil.ManifestFixture(layers[0], layers[1], layers[2])
+
+	for desc, test := range map[string]struct {
+		manifest core.Digest
+		raw      []byte
+	}{
+		"oci":    {ociManifest, ociRaw},
+		"docker": {dockerManifest, dockerRaw},
+	} {
+		t.Run(desc, func(t *testing.T) {
+			require := require.New(t)
+
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			originClient := mockblobclient.NewMockClusterClient(ctrl)
+
+			m, err := NewMap(testConfigs(), originClient)
+			require.NoError(err)
+
+			originClient.EXPECT().DownloadBlob(
+				tag, test.manifest, mockutil.MatchWriter(test.raw)).Return(nil)
+
+			deps, err := m.Resolve(tag, test.manifest)
+			require.NoError(err)
+			require.Equal(core.DigestList(append(layers, test.manifest)), deps)
+		})
+	}
+}
+
 func TestMapResolveDefault(t *testing.T) {
 	require := require.New(t)
 
@@ -0,0 +1,88 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package core
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// ChunkManifestMediaType identifies blobs which are chunk manifests.
+const ChunkManifestMediaType = "application/vnd.kraken.chunk-manifest.v1+json"
+
+// Chunk references a chunk blob of a chunked blob.
+type Chunk struct {
+	Digest Digest `json:"digest"`
+	Size   int64  `json:"size"`
+}
+
+// ChunkManifest describes a blob stored as the concatenation of an ordered list
+// of chunk blobs. Chunks are ordinary blobs, and thus deduplicated across
+// manifests which share them.
+type ChunkManifest struct {
+	MediaType string `json:"mediaType"`
+
+	// Digest and Size describe the assembled blob.
+	Digest Digest `json:"digest"`
+	Size   int64  `json:"size"`
+
+	Chunks []Chunk `json:"chunks"`
+}
+
+// NewChunkManifest creates a new ChunkManifest of the blob with digest d, which
+// is assembled from chunks.
+func NewChunkManifest(d Digest, chunks []Chunk) *ChunkManifest {
+	var size int64
+	for _, c := range chunks {
+		size += c.Size
+	}
+	return &ChunkManifest{
+		MediaType: ChunkManifestMediaType,
+		Digest:    d,
+		Size:      size,
+		Chunks:    chunks,
+	}
+}
+
+// ParseChunkManifest parses a ChunkManifest from b. Returns an error if b is
+// not a chunk manifest.
+func ParseChunkManifest(b []byte) (*ChunkManifest, error) {
+	var m ChunkManifest
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, fmt.Errorf("json: %s", err)
+	}
+	if m.MediaType != ChunkManifestMediaType {
+		return nil, fmt.Errorf("unsupported media type %q", m.MediaType)
+	}
+	if len(m.Chunks) == 0 {
+		return nil, errors.New("no chunks")
+	}
+	var size int64
+	for _, c := range m.Chunks {
+		if c.Size < 0 {
+			return nil, fmt.Errorf("chunk %s has negative size", c.Digest)
+		}
+		size += c.Size
+	}
+	if size != m.Size {
+		return nil, fmt.Errorf("chunks sum to %d bytes, expected %d", size, m.Size)
+	}
+	return &m, nil
+}
+
+// Serialize returns the JSON encoding of m.
+func (m *ChunkManifest) Serialize() ([]byte, error) {
+	return json.Marshal(m)
+}
@@ -0,0 +1,54 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package core
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestChunkManifestSerialization(t *testing.T) {
+	require := require.New(t)
+
+	m := NewChunkManifest(DigestFixture(), []Chunk{
+		{DigestFixture(), 10},
+		{DigestFixture(), 5},
+	})
+	require.Equal(int64(15), m.Size)
+
+	b, err := m.Serialize()
+	require.NoError(err)
+	result, err := ParseChunkManifest(b)
+	require.NoError(err)
+	require.Equal(m, result)
+}
+
+func TestParseChunkManifestErrors(t *testing.T) {
+	tests := []struct {
+		desc string
+		raw  string
+	}{
+		{"not json", "foo"},
+		{"wrong media type", `{"mediaType": "application/json", "size": 0, "chunks": []}`},
+		{"no chunks", `{"mediaType": "` + ChunkManifestMediaType + `", "size": 0, "chunks": []}`},
+		{"size mismatch", `{"mediaType": "` + ChunkManifestMediaType + `", "size": 3, "chunks": [{"size": 2}]}`},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			_, err := ParseChunkManifest([]byte(test.raw))
+			require.Error(t, err)
+		})
+	}
+}
@@ -15,6 +15,7 @@ package core
 
 import (
 	_ "crypto/sha256" // For computing digest.
+	_ "crypto/sha512" // For computing digest.
 	"database/sql/driver"
 	"encoding/hex"
 	"encoding/json"
@@ -67,6 +68,31 @@ func NewSHA256DigestFromHex(hex string) (Digest, error) {
 	}, nil
 }
 
+// NewDigestFromHex constructs a Digest of the given algo from a hash in
+// hexadecimal format. Returns error if algo is unsupported or hex is invalid.
+func NewDigestFromHex(algo, hex string) (Digest, error) {
+	if err := validateHex(algo, hex); err != nil {
+		return Digest{}, err
+	}
+	return Digest{
+		algo: algo,
+		hex:  hex,
+		raw:  fmt.Sprintf("%s:%s", algo, hex),
+	}, nil
+}
+
+// ParseDigest parses a raw "<algo>:<hex>" digest of any supported algo.
+func ParseDigest(raw string) (Digest, error) {
+	if raw == "" {
+		return Digest{}, errors.New("invalid digest: empty")
+	}
+	parts := strings.Split(raw, ":")
+	if len(parts) != 2 {
+		return Digest{}, errors.New("invalid digest: expected '<algo>:<hex>'")
+	}
+	return NewDigestFromHex(parts[0], parts[1])
+}
+
 // ParseSHA256Digest parses a raw "<algo>:<hex>" sha256 digest. Returns error if the
 // algo is not sha256 or the hex is not a valid sha256.
 func ParseSHA256Digest(raw string) (Digest, error) {
@@ -112,7 +138,7 @@ func (d *Digest) UnmarshalJSON(str []byte) error {
 	if err := json.Unmarshal(str, &raw); err != nil {
 		return err
 	}
-	digest, err := ParseSHA256Digest(raw)
+	digest, err := ParseDigest(raw)
 	if err != nil {
 		return err
 	}
@@ -159,3 +185,30 @@ func ValidateSHA256(s string) error {
 	}
 	return nil
 }
+
+// ValidateSHA512 returns error if s is not a valid SHA512 hex digest.
+func ValidateSHA512(s string) error {
+	if len(s) != 128 {
+		return fmt.Errorf("expected 128 characters, got %d from %q", len(s), s)
+	}
+	if _, err := hex.DecodeString(s); err != nil {
+		return fmt.Errorf("hex: %s", err)
+	}
+	return nil
+}
+
+func validateHex(algo, hex string) error {
+	switch algo {
+	case SHA256:
+		if err := ValidateSHA256(hex); err != nil {
+			return fmt.Errorf("invalid sha256: %s", err)
+		}
+	case SHA512:
+		if err := ValidateSHA512(hex); err != nil {
+			return fmt.Errorf("invalid sha512: %s", err)
+		}
+	default:
+		return fmt.Errorf("invalid digest algo: unsupported %q", algo)
+	}
+	return nil
+}
@@ -96,6 +96,49 @@ func TestParseSHA256DigestErrors(t *testing.T) {
 	}
 }
 
+func TestParseDigest(t *testing.T) {
+	tests := []struct {
+		desc  string
+		input string
+		algo  string
+	}{
+		{"sha256", "sha256:e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855", SHA256},
+		{
+			"sha512",
+			"sha512:cf83e1357eefb8bdf1542850d66d8007d620e4050b5715dc83f4a921d36ce9ce" +
+				"47d0d13c5d85f2b0ff8318d2877eec2f63b931bd47417a81a538327af927da3e",
+			SHA512,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			require := require.New(t)
+
+			d, err := ParseDigest(test.input)
+			require.NoError(err)
+			require.Equal(test.algo, d.Algo())
+			require.Equal(test.input, d.String())
+		})
+	}
+}
+
+func TestParseDigestErrors(t *testing.T) {
+	tests := []struct {
+		desc  string
+		input string
+	}{
+		{"empty", ""},
+		{"wrong algo", "sha1:e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"},
+		{"sha512 with sha256 hex", "sha512:e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			_, err := ParseDigest(test.input)
+			require.Error(t, err)
+		})
+	}
+}
+
 func TestDigestStringConversion(t *testing.T) {
 	d := DigestFixture()
 	result, err := ParseSHA256Digest(d.String())
@@ -29,6 +29,8 @@ It has these top-level messages:
 	CancelPieceMessage
 	ErrorMessage
 	CompleteMessage
+	PeerExchangeMessage
+	PeerAddress
 	Message
 */
 package p2p
@@ -76,6 +78,7 @@ const (
 	Message_CANCEL_PIECE  Message_Type = 4
 	Message_ERROR         Message_Type = 5
 	Message_COMPLETE      Message_Type = 6
+	Message_PEER_EXCHANGE Message_Type = 7
 )
 
 var Message_Type_name = map[int32]string{
@@ -86,6 +89,7 @@ var Message_Type_name = map[int32]string{
 	4: "CANCEL_PIECE",
 	5: "ERROR",
 	6: "COMPLETE",
+	7: "PEER_EXCHANGE",
 }
 var Message_Type_value = map[string]int32{
 	"BITFIELD":      0,
@@ -95,12 +99,13 @@ var Message_Type_value = map[string]int32{
 	"CANCEL_PIECE":  4,
 	"ERROR":         5,
 	"COMPLETE":      6,
+	"PEER_EXCHANGE": 7,
 }
 
 func (x Message_Type) String() string {
 	return proto.EnumName(Message_Type_name, int32(x))
 }
-func (Message_Type) EnumDescriptor() ([]byte, []int) { return fileDescriptor0, []int{7, 0} }
+func (Message_Type) EnumDescriptor() ([]byte, []int) { return fileDescriptor0, []int{9, 0} }
 
 // Binary set of all pieces that peer has downloaded so far. Also serves as a
 // handshaking message, which each peer sends once at the beginning of the
@@ -206,6 +211,38 @@ func (m *CompleteMessage) String() string            { return proto.CompactTextS
 func (*CompleteMessage) ProtoMessage()               {}
 func (*CompleteMessage) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{6} }
 
+// Gossips addresses of peers which the sender is connected to for the same
+// torrent, such that peers may discover each other without the tracker.
+type PeerExchangeMessage struct {
+	Peers []*PeerAddress `protobuf:"bytes,2,rep,name=peers" json:"peers,omitempty"`
+}
+
+func (m *PeerExchangeMessage) Reset()                    { *m = PeerExchangeMessage{} }
+func (m *PeerExchangeMessage) String() string            { return proto.CompactTextString(m) }
+func (*PeerExchangeMessage) ProtoMessage()               {}
+func (*PeerExchangeMessage) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{7} }
+
+func (m *PeerExchangeMessage) GetPeers() []*PeerAddress {
+	if m != nil {
+		return m.Peers
+	}
+	return nil
+}
+
+// Address of a peer, as gossiped in PeerExchangeMessage.
+type PeerAddress struct {
+	PeerID   string `protobuf:"bytes,2,opt,name=peerID" json:"peerID,omitempty"`
+	Ip       string `protobuf:"bytes,3,opt,name=ip" json:"ip,omitempty"`
+	Port     int32  `protobuf:"varint,4,opt,name=port" json:"port,omitempty"`
+	Origin   bool   `protobuf:"varint,5,opt,name=origin" json:"origin,omitempty"`
+	Complete bool   `protobuf:"varint,6,opt,name=complete" json:"complete,omitempty"`
+}
+
+func (m *PeerAddress) Reset()                    { *m = PeerAddress{} }
+func (m *PeerAddress) String() string            { return proto.CompactTextString(m) }
+func (*PeerAddress) ProtoMessage()               {}
+func (*PeerAddress) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{8} }
+
 type Message struct {
 	Version       string                `protobuf:"bytes,1,opt,name=version" json:"version,omitempty"`
 	Type          Message_Type          `protobuf:"varint,2,opt,name=type,enum=p2p.Message_Type" json:"type,omitempty"`
@@ -216,12 +253,13 @@ type Message struct {
 	CancelPiece   *CancelPieceMessage   `protobuf:"bytes,7,opt,name=cancelPiece" json:"cancelPiece,omitempty"`
 	Error         *ErrorMessage         `protobuf:"bytes,8,opt,name=error" json:"error,omitempty"`
 	Complete      *CompleteMessage      `protobuf:"bytes,9,opt,name=complete" json:"complete,omitempty"`
+	PeerExchange  *PeerExchangeMessage  `protobuf:"bytes,10,opt,name=peerExchange" json:"peerExchange,omitempty"`
 }
 
 func (m *Message) Reset()                    { *m = Message{} }
 func (m *Message) String() string            { return proto.CompactTextString(m) }
 func (*Message) ProtoMessage()               {}
-func (*Message) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{7} }
+func (*Message) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{9} }
 
 func (m *Message) GetBitfield() *BitfieldMessage {
 	if m != nil {
@@ -272,6 +310,13 @@ func (m *Message) GetComplete() *CompleteMessage {
 	return nil
 }
 
+func (m *Message) GetPeerExchange() *PeerExchangeMessage {
+	if m != nil {
+		return m.PeerExchange
+	}
+	return nil
+}
+
 func init() {
 	proto.RegisterType((*BitfieldMessage)(nil), "p2p.BitfieldMessage")
 	proto.RegisterType((*PieceRequestMessage)(nil), "p2p.PieceRequestMessage")
@@ -280,6 +325,8 @@ func init() {
 	proto.RegisterType((*CancelPieceMessage)(nil), "p2p.CancelPieceMessage")
 	proto.RegisterType((*ErrorMessage)(nil), "p2p.ErrorMessage")
 	proto.RegisterType((*CompleteMessage)(nil), "p2p.CompleteMessage")
+	proto.RegisterType((*PeerExchangeMessage)(nil), "p2p.PeerExchangeMessage")
+	proto.RegisterType((*PeerAddress)(nil), "p2p.PeerAddress")
 	proto.RegisterType((*Message)(nil), "p2p.Message")
 	proto.RegisterEnum("p2p.ErrorMessage_ErrorCode", ErrorMessage_ErrorCode_name, ErrorMessage_ErrorCode_value)
 	proto.RegisterEnum("p2p.Message_Type", Message_Type_name, Message_Type_value)
@@ -288,46 +335,53 @@ func init() {
 func init() { proto.RegisterFile("proto/p2p/p2p.proto", fileDescriptor0) }
 
 var fileDescriptor0 = []byte{
-	// 647 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x09, 0x6e, 0x88, 0x02, 0xff, 0xac, 0x54, 0x4f, 0x6f, 0xd3, 0x4e,
-	0x10, 0x6d, 0x12, 0x3b, 0x7f, 0x26, 0x69, 0xeb, 0x6c, 0xa3, 0xdf, 0xcf, 0x14, 0x0e, 0x95, 0x45,
-	0x45, 0x85, 0xa0, 0xad, 0xcc, 0x05, 0x10, 0x12, 0x4a, 0x1c, 0x57, 0x44, 0x4a, 0x9b, 0xb0, 0xa4,
-	0x07, 0xc4, 0xa1, 0x72, 0x9d, 0x49, 0x6b, 0x91, 0x7a, 0x8d, 0xed, 0x56, 0xcd, 0xd7, 0xe0, 0x43,
-	0x21, 0xf1, 0xad, 0xd0, 0x4e, 0xec, 0xc4, 0x6e, 0x02, 0xe2, 0xc0, 0x21, 0x92, 0xdf, 0xf3, 0x7b,
-	0xb3, 0xb3, 0x33, 0x2f, 0x86, 0x9d, 0x20, 0x14, 0xb1, 0x38, 0x0a, 0xcc, 0x40, 0xfe, 0x0e, 0x09,
-	0xb1, 0x52, 0x60, 0x06, 0xc6, 0x8f, 0x22, 0x6c, 0x77, 0xbc, 0x78, 0xe2, 0xe1, 0x74, 0x7c, 0x8a,
-	0x51, 0xe4, 0x5c, 0x21, 0xdb, 0x85, 0xaa, 0xe7, 0x4f, 0xc4, 0x07, 0x27, 0xba, 0xd6, 0x8b, 0x7b,
-	0x85, 0x83, 0x1a, 0x5f, 0x60, 0xc6, 0x40, 0xf1, 0x9d, 0x1b, 0xd4, 0x4b, 0xc4, 0xd3, 0x33, 0xfb,
-	0x0f, 0xca, 0x01, 0x62, 0xd8, 0xeb, 0xea, 0x0a, 0xb1, 0x09, 0x62, 0x4f, 0x61, 0xf3, 0x32, 0x29,
-	0xdd, 0x99, 0xc5, 0x18, 0xe9, 0xea, 0x5e, 0xe1, 0xa0, 0xc1, 0xf3, 0x24, 0x7b, 0x02, 0x35, 0x59,
-	0x25, 0x0a, 0x1c, 0x17, 0xf5, 0x32, 0x15, 0x58, 0x12, 0xec, 0x02, 0x76, 0x42, 0xbc, 0x11, 0x31,
-	0x76, 0x72, 0x95, 0x2a, 0x7b, 0xa5, 0x83, 0xba, 0xf9, 0xf2, 0x50, 0xde, 0xe6, 0x41, 0xfb, 0x87,
-	0x7c, 0x55, 0x6f, 0xfb, 0x71, 0x38, 0xe3, 0xeb, 0x2a, 0xed, 0x9e, 0x80, 0xfe, 0x3b, 0x03, 0xd3,
-	0xa0, 0xf4, 0x15, 0x67, 0x7a, 0x81, 0x9a, 0x92, 0x8f, 0xac, 0x05, 0xea, 0x9d, 0x33, 0xbd, 0x45,
-	0x9a, 0x4b, 0x83, 0xcf, 0xc1, 0xdb, 0xe2, 0xeb, 0x82, 0xf1, 0x05, 0x76, 0x86, 0x1e, 0xba, 0xc8,
-	0xf1, 0xdb, 0x2d, 0x46, 0x71, 0x3a, 0xcb, 0x16, 0xa8, 0x9e, 0x3f, 0xc6, 0x7b, 0x32, 0xa8, 0x7c,
-	0x0e, 0xe4, 0xc4, 0xc4, 0x64, 0x12, 0x61, 0x4c, 0x73, 0x54, 0x79, 0x82, 0x24, 0x3f, 0x45, 0xff,
-	0x2a, 0xbe, 0xa6, 0x49, 0xaa, 0x3c, 0x41, 0x46, 0x94, 0x14, 0x1f, 0x3a, 0xb3, 0xa9, 0x70, 0xc6,
-	0xff, 0xb4, 0xb8, 0xe4, 0xc7, 0xde, 0x15, 0x46, 0x31, 0xed, 0xa7, 0xc6, 0x13, 0x64, 0xbc, 0x80,
-	0x56, 0xdb, 0xf7, 0xc5, 0xad, 0xef, 0x22, 0x1d, 0xfe, 0xc7, 0x53, 0x8d, 0xe7, 0xc0, 0x2c, 0xc7,
-	0x77, 0x71, 0xfa, 0x17, 0xda, 0xef, 0x05, 0x68, 0xd8, 0x61, 0x28, 0xc2, 0x8c, 0x0c, 0x25, 0x4e,
-	0xe2, 0x36, 0x07, 0x4b, 0x73, 0x29, 0x7b, 0xbd, 0x23, 0x50, 0x5c, 0x31, 0x46, 0xba, 0xc4, 0x96,
-	0xf9, 0x98, 0x22, 0x90, 0x2d, 0x36, 0x07, 0x96, 0x18, 0x23, 0x27, 0xa1, 0xb1, 0x0f, 0xb5, 0x05,
-	0xc5, 0x74, 0x68, 0x0d, 0x7b, 0xb6, 0x65, 0x5f, 0x70, 0xfb, 0xe3, 0xb9, 0xfd, 0x69, 0x74, 0x71,
-	0xd2, 0xee, 0xf5, 0xed, 0xae, 0xb6, 0x61, 0x34, 0x61, 0xdb, 0x12, 0x37, 0xc1, 0x14, 0xe3, 0xb4,
-	0x7b, 0xe3, 0xa7, 0x02, 0x95, 0xb4, 0x45, 0x1d, 0x2a, 0x77, 0x18, 0x46, 0x9e, 0xf0, 0x93, 0x3c,
-	0xa4, 0x90, 0xed, 0x83, 0x12, 0xcf, 0x82, 0x79, 0x24, 0xb6, 0xcc, 0x26, 0x35, 0x94, 0xf6, 0x32,
-	0x9a, 0x05, 0xc8, 0xe9, 0x35, 0x3b, 0x86, 0x6a, 0x1a, 0x7c, 0xba, 0x50, 0xdd, 0x6c, 0xad, 0x8b,
-	0x2f, 0x5f, 0xa8, 0xd8, 0x3b, 0x68, 0x04, 0x99, 0x48, 0xd1, 0x8d, 0xeb, 0xa6, 0x4e, 0xae, 0x35,
-	0x59, 0xe3, 0x39, 0xf5, 0xc2, 0x9d, 0x64, 0x86, 0x96, 0x9b, 0x73, 0xe7, 0xc3, 0xc4, 0x73, 0x6a,
-	0xf6, 0x1e, 0x36, 0x9d, 0xec, 0xf2, 0xe9, 0x9f, 0x59, 0x37, 0x1f, 0x91, 0x7d, 0x5d, 0x2c, 0x78,
-	0x5e, 0xcf, 0xde, 0x40, 0xdd, 0x5d, 0xe6, 0x41, 0xaf, 0x90, 0xfd, 0x7f, 0xb2, 0xaf, 0xe6, 0x84,
-	0x67, 0xb5, 0xec, 0x59, 0x9a, 0x86, 0x2a, 0x99, 0x9a, 0x2b, 0x2b, 0x4e, 0x03, 0x72, 0x0c, 0x55,
-	0x37, 0x59, 0x99, 0x5e, 0xcb, 0x8c, 0xf4, 0xc1, 0x1e, 0xf9, 0x42, 0x65, 0xdc, 0x83, 0x22, 0x57,
-	0xc2, 0x1a, 0x50, 0xed, 0xf4, 0x46, 0x27, 0x3d, 0xbb, 0xdf, 0xd5, 0x36, 0x58, 0x13, 0x36, 0x73,
-	0xa1, 0xd0, 0x0a, 0x4b, 0x6a, 0xd8, 0xfe, 0xdc, 0x1f, 0xb4, 0xbb, 0x5a, 0x51, 0x52, 0xed, 0xb3,
-	0xb3, 0xc1, 0xb9, 0x24, 0xe5, 0x2b, 0xad, 0xc4, 0x34, 0x68, 0x58, 0xed, 0x33, 0xcb, 0xee, 0x27,
-	0x8c, 0xc2, 0x6a, 0xa0, 0xda, 0x9c, 0x0f, 0xb8, 0xa6, 0xca, 0x33, 0xac, 0xc1, 0xe9, 0xb0, 0x6f,
-	0x8f, 0x6c, 0xad, 0x7c, 0x59, 0xa6, 0x8f, 0xee, 0xab, 0x5f, 0x01, 0x00, 0x00, 0xff, 0xff, 0xfd,
-	0x11, 0xd8, 0xe6, 0x8b, 0x05, 0x00, 0x00,
+	// 758 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xac, 0x55, 0x4d, 0x6f, 0xda, 0x58,
+	0x14, 0x0d, 0x06, 0xf3, 0x71, 0x21, 0x89, 0x79, 0xa0, 0x19, 0x4f, 0x66, 0x16, 0x91, 0x35, 0x99,
+	0x89, 0x46, 0x33, 0x49, 0xe4, 0xd9, 0xb4, 0x55, 0xab, 0xca, 0x98, 0x97, 0x06, 0x89, 0x00, 0x7d,
+	0x25, 0x52, 0xab, 0x2e, 0x90, 0x63, 0x3f, 0x88, 0x55, 0x62, 0xbb, 0xb6, 0x13, 0x85, 0x45, 0x7f,
+	0x41, 0x77, 0xdd, 0xf6, 0xff, 0xf4, 0x77, 0x55, 0xef, 0x62, 0x83, 0x1d, 0xd2, 0xaa, 0x8b, 0x2e,
+	0x90, 0x7c, 0x8e, 0xef, 0xbd, 0xbe, 0x1f, 0xe7, 0x08, 0x68, 0x05, 0xa1, 0x1f, 0xfb, 0xc7, 0x81,
+	0x1e, 0x88, 0xdf, 0x11, 0x22, 0x52, 0x0c, 0xf4, 0x40, 0xfb, 0x22, 0xc1, 0x6e, 0xc7, 0x8d, 0xa7,
+	0x2e, 0x9f, 0x3b, 0xe7, 0x3c, 0x8a, 0xac, 0x19, 0x27, 0x7b, 0x50, 0x75, 0xbd, 0xa9, 0x7f, 0x66,
+	0x45, 0x57, 0xaa, 0xb4, 0x5f, 0x38, 0xac, 0xb1, 0x15, 0x26, 0x04, 0x4a, 0x9e, 0x75, 0xcd, 0xd5,
+	0x22, 0xf2, 0xf8, 0x4c, 0x7e, 0x81, 0x72, 0xc0, 0x79, 0xd8, 0xeb, 0xaa, 0x25, 0x64, 0x13, 0x44,
+	0xfe, 0x84, 0xed, 0xcb, 0xa4, 0x74, 0x67, 0x11, 0xf3, 0x48, 0x95, 0xf7, 0x0b, 0x87, 0x0d, 0x96,
+	0x27, 0xc9, 0x1f, 0x50, 0x13, 0x55, 0xa2, 0xc0, 0xb2, 0xb9, 0x5a, 0xc6, 0x02, 0x6b, 0x82, 0x4c,
+	0xa0, 0x15, 0xf2, 0x6b, 0x3f, 0xe6, 0x9d, 0x5c, 0xa5, 0xca, 0x7e, 0xf1, 0xb0, 0xae, 0xff, 0x77,
+	0x24, 0xa6, 0xb9, 0xd7, 0xfe, 0x11, 0xdb, 0x8c, 0xa7, 0x5e, 0x1c, 0x2e, 0xd8, 0x43, 0x95, 0xf6,
+	0x4e, 0x41, 0xfd, 0x56, 0x02, 0x51, 0xa0, 0xf8, 0x8e, 0x2f, 0xd4, 0x02, 0x36, 0x25, 0x1e, 0x49,
+	0x1b, 0xe4, 0x5b, 0x6b, 0x7e, 0xc3, 0x71, 0x2f, 0x0d, 0xb6, 0x04, 0x4f, 0xa4, 0x47, 0x05, 0xed,
+	0x2d, 0xb4, 0x46, 0x2e, 0xb7, 0x39, 0xe3, 0xef, 0x6f, 0x78, 0x14, 0xa7, 0xbb, 0x6c, 0x83, 0xec,
+	0x7a, 0x0e, 0xbf, 0xc3, 0x04, 0x99, 0x2d, 0x81, 0xd8, 0x98, 0x3f, 0x9d, 0x46, 0x3c, 0xc6, 0x3d,
+	0xca, 0x2c, 0x41, 0x82, 0x9f, 0x73, 0x6f, 0x16, 0x5f, 0xe1, 0x26, 0x65, 0x96, 0x20, 0x2d, 0x4a,
+	0x8a, 0x8f, 0xac, 0xc5, 0xdc, 0xb7, 0x9c, 0x9f, 0x5a, 0x5c, 0xf0, 0x8e, 0x3b, 0xe3, 0x51, 0x8c,
+	0xf7, 0xa9, 0xb1, 0x04, 0x69, 0xff, 0x42, 0xdb, 0xf0, 0x3c, 0xff, 0xc6, 0xb3, 0x39, 0x7e, 0xfc,
+	0xbb, 0x5f, 0xd5, 0xfe, 0x01, 0x62, 0x5a, 0x9e, 0xcd, 0xe7, 0x3f, 0x10, 0xfb, 0xa9, 0x00, 0x0d,
+	0x1a, 0x86, 0x7e, 0x98, 0x09, 0xe3, 0x02, 0x27, 0x72, 0x5b, 0x82, 0x75, 0x72, 0x31, 0x3b, 0xde,
+	0x31, 0x94, 0x6c, 0xdf, 0xe1, 0x38, 0xc4, 0x8e, 0xfe, 0x3b, 0x4a, 0x20, 0x5b, 0x6c, 0x09, 0x4c,
+	0xdf, 0xe1, 0x0c, 0x03, 0xb5, 0x03, 0xa8, 0xad, 0x28, 0xa2, 0x42, 0x7b, 0xd4, 0xa3, 0x26, 0x9d,
+	0x30, 0xfa, 0xf2, 0x82, 0xbe, 0x1a, 0x4f, 0x4e, 0x8d, 0x5e, 0x9f, 0x76, 0x95, 0x2d, 0xad, 0x09,
+	0xbb, 0xa6, 0x7f, 0x1d, 0xcc, 0x79, 0x9c, 0x76, 0xaf, 0x3d, 0x83, 0xd6, 0x88, 0xf3, 0x90, 0xde,
+	0xd9, 0x57, 0x96, 0x37, 0x5b, 0x0d, 0xf5, 0x17, 0xc8, 0x42, 0xe1, 0x91, 0x2a, 0xa1, 0x0a, 0x15,
+	0x6c, 0x41, 0x04, 0x1a, 0x8e, 0x13, 0xf2, 0x28, 0x62, 0xcb, 0xd7, 0xda, 0x07, 0xa8, 0x67, 0xd8,
+	0x8c, 0x4d, 0xa4, 0x9c, 0x4d, 0x76, 0x40, 0x72, 0x83, 0xc4, 0x50, 0x92, 0x1b, 0x08, 0x8b, 0x05,
+	0x7e, 0x18, 0x27, 0x57, 0xc2, 0x67, 0xbc, 0x69, 0xe8, 0xce, 0x5c, 0x0f, 0x6f, 0x54, 0x65, 0x09,
+	0x12, 0x56, 0xb5, 0x93, 0xa6, 0xd1, 0x3b, 0x55, 0xb6, 0xc2, 0xda, 0x67, 0x19, 0x2a, 0x69, 0xcb,
+	0x2a, 0x54, 0x6e, 0x79, 0x18, 0xb9, 0xbe, 0x97, 0xa8, 0x39, 0x85, 0xe4, 0x00, 0x4a, 0xf1, 0x22,
+	0x58, 0x0a, 0x7a, 0x47, 0x6f, 0xe2, 0x2c, 0xe9, 0x26, 0xc7, 0x8b, 0x80, 0x33, 0x7c, 0x4d, 0x4e,
+	0xa0, 0x9a, 0xda, 0x16, 0x5b, 0xad, 0xeb, 0xed, 0x87, 0xcc, 0xc7, 0x56, 0x51, 0xe4, 0x29, 0x34,
+	0x82, 0x8c, 0x21, 0x70, 0x9c, 0xba, 0xae, 0x2e, 0x97, 0xb5, 0xe9, 0x14, 0x96, 0x8b, 0x5e, 0x65,
+	0x27, 0x8a, 0x57, 0xe5, 0xfb, 0xd9, 0x79, 0x2b, 0xb0, 0x5c, 0x34, 0x79, 0x0e, 0xdb, 0x56, 0x56,
+	0xba, 0xb8, 0x9b, 0xba, 0xfe, 0x1b, 0xa6, 0x3f, 0x24, 0x6a, 0x96, 0x8f, 0x27, 0x8f, 0xa1, 0x6e,
+	0xaf, 0xd5, 0xac, 0x56, 0x30, 0xfd, 0x57, 0x4c, 0xdf, 0x54, 0x39, 0xcb, 0xc6, 0x92, 0xbf, 0x53,
+	0x2d, 0x57, 0x31, 0xa9, 0xb9, 0x21, 0xd0, 0x54, 0xde, 0x27, 0x99, 0xdb, 0xd5, 0x32, 0x2b, 0xbd,
+	0xa7, 0xc2, 0xf5, 0x45, 0x71, 0x29, 0x19, 0x3d, 0xaa, 0x90, 0x5d, 0xca, 0xa6, 0x50, 0x59, 0x2e,
+	0x5a, 0xfb, 0x58, 0x80, 0x92, 0xb8, 0x28, 0x69, 0x40, 0xb5, 0xd3, 0x1b, 0x9f, 0xf6, 0x68, 0xbf,
+	0xab, 0x6c, 0x91, 0x26, 0x6c, 0xe7, 0x1c, 0xa1, 0x14, 0xd6, 0xd4, 0xc8, 0x78, 0xd3, 0x1f, 0x1a,
+	0x5d, 0x45, 0x12, 0x94, 0x31, 0x18, 0x0c, 0x2f, 0x04, 0x29, 0x5e, 0x29, 0x45, 0xa2, 0x40, 0xc3,
+	0x34, 0x06, 0x26, 0xed, 0x27, 0x4c, 0x89, 0xd4, 0x40, 0xa6, 0x8c, 0x0d, 0x99, 0x22, 0x8b, 0x6f,
+	0x98, 0xc3, 0xf3, 0x51, 0x9f, 0x8e, 0xa9, 0x52, 0xc6, 0x82, 0x94, 0xb2, 0x09, 0x7d, 0x6d, 0x9e,
+	0x19, 0x83, 0x17, 0x54, 0xa9, 0x5c, 0x96, 0xf1, 0x4f, 0xe8, 0xff, 0xaf, 0x03, 0x00, 0x44, 0x3c,
+	0xc1, 0x56, 0x9b, 0x06, 0x00, 0x00,
 }
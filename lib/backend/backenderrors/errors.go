@@ -17,3 +17,7 @@ import "errors"
 
 // ErrBlobNotFound is returned when a blob is not found in a storage backend.
 var ErrBlobNotFound = errors.New("blob not found")
+
+// ErrBlobExists is returned when a conditional upload targets a blob which
+// already exists in a storage backend.
+var ErrBlobExists = errors.New("blob exists")
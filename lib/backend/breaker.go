@@ -0,0 +1,283 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package backend
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/backend/backenderrors"
+	"github.com/uber/kraken/utils/log"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/uber-go/tally"
+)
+
+// ErrCircuitOpen is returned when an operation is short-circuited because
+// recent operations of the same type failed.
+var ErrCircuitOpen = errors.New("backend circuit open")
+
+// BreakerConfig defines the thresholds of a circuit breaker.
+type BreakerConfig struct {
+	// Failures is the number of consecutive failures which trips the breaker.
+	Failures int `yaml:"failures"`
+
+	// Cooldown is how long a tripped breaker short-circuits operations before
+	// letting a single trial operation through. If the trial succeeds, the
+	// breaker closes, else it trips again.
+	Cooldown time.Duration `yaml:"cooldown"`
+}
+
+func (c BreakerConfig) applyDefaults() BreakerConfig {
+	if c.Failures == 0 {
+		c.Failures = 5
+	}
+	if c.Cooldown == 0 {
+		c.Cooldown = 30 * time.Second
+	}
+	return c
+}
+
+// CircuitBreakerConfig defines circuit breaking of backend operations. Reads
+// (stat, download, list) and writes (upload) are tracked by separate breakers,
+// since backends commonly fail writes, e.g. due to quota or permission issues,
+// while still serving reads.
+type CircuitBreakerConfig struct {
+	Enable bool `yaml:"enable"`
+
+	Read  BreakerConfig `yaml:"read"`
+	Write BreakerConfig `yaml:"write"`
+}
+
+// breaker is a circuit breaker for a single operation type.
+type breaker struct {
+	config BreakerConfig
+	clk    clock.Clock
+	stats  tally.Scope
+	op     string
+
+	mu       sync.Mutex
+	failures int
+	open     bool
+	openedAt time.Time
+	trial    bool
+}
+
+func newBreaker(config BreakerConfig, clk clock.Clock, stats tally.Scope, op string) *breaker {
+	return &breaker{
+		config: config.applyDefaults(),
+		clk:    clk,
+		stats:  stats.Tagged(map[string]string{"operation": op}),
+		op:     op,
+	}
+}
+
+// allow returns whether an operation may proceed.
+func (b *breaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !b.open {
+		return true
+	}
+	if !b.trial && b.clk.Now().Sub(b.openedAt) >= b.config.Cooldown {
+		b.trial = true
+		return true
+	}
+	b.stats.Counter("circuit_rejections").Inc(1)
+	return false
+}
+
+// record records the result of an allowed operation.
+func (b *breaker) record(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	// Missing and existing blobs are expected results, not backend failures.
+	if err == nil || err == backenderrors.ErrBlobNotFound || err == backenderrors.ErrBlobExists {
+		if b.open {
+			log.With("operation", b.op).Info("Backend circuit closed")
+		}
+		b.failures = 0
+		b.open = false
+		b.trial = false
+		return
+	}
+	b.failures++
+	if b.trial || (!b.open && b.failures >= b.config.Failures) {
+		if !b.open {
+			log.With("operation", b.op, "error", err).Warn("Backend circuit opened")
+		}
+		b.stats.Counter("circuit_trips").Inc(1)
+		b.open = true
+		b.openedAt = b.clk.Now()
+		b.trial = false
+	}
+}
+
+// release lets another trial operation through if an allowed operation was
+// abandoned without a result.
+func (b *breaker) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.trial = false
+}
+
+// breakerClient short-circuits operations of the wrapped client while the
+// breaker of their operation type is open.
+type breakerClient struct {
+	Client
+	read  *breaker
+	write *breaker
+
+	// ctx is the context the client is bound to, if any.
+	ctx context.Context
+}
+
+func withBreakers(
+	client Client, config CircuitBreakerConfig, clk clock.Clock, stats tally.Scope) *breakerClient {
+
+	return &breakerClient{
+		Client: client,
+		read:   newBreaker(config.Read, clk, stats, "read"),
+		write:  newBreaker(config.Write, clk, stats, "write"),
+	}
+}
+
+// record records the result of an operation with b. Operations abandoned
+// because the caller gave up, e.g. its deadline passed, say nothing about the
+// health of the backend, and are not recorded. Otherwise, since breakers are
+// shared by all requests, a few impatient callers would trip them for all.
+func (c *breakerClient) record(b *breaker, err error) {
+	if err != nil && (errors.Is(err, context.Canceled) ||
+		errors.Is(err, context.DeadlineExceeded) ||
+		(c.ctx != nil && c.ctx.Err() != nil)) {
+		b.release()
+		return
+	}
+	b.record(err)
+}
+
+// BindContext binds the wrapped client to ctx. Breakers are shared with c.
+func (c *breakerClient) BindContext(ctx context.Context) Client {
+	return &breakerClient{bindContext(ctx, c.Client), c.read, c.write, ctx}
+}
+
+// Stat returns blob info for name.
+func (c *breakerClient) Stat(namespace, name string) (*core.BlobInfo, error) {
+	if !c.read.allow() {
+		return nil, ErrCircuitOpen
+	}
+	info, err := c.Client.Stat(namespace, name)
+	c.record(c.read, err)
+	return info, err
+}
+
+// Upload uploads src into name.
+func (c *breakerClient) Upload(namespace, name string, src io.Reader) error {
+	if !c.write.allow() {
+		return ErrCircuitOpen
+	}
+	err := c.Client.Upload(namespace, name, src)
+	c.record(c.write, err)
+	return err
+}
+
+// Download downloads name into dst.
+func (c *breakerClient) Download(namespace, name string, dst io.Writer) error {
+	if !c.read.allow() {
+		return ErrCircuitOpen
+	}
+	err := c.Client.Download(namespace, name, dst)
+	c.record(c.read, err)
+	return err
+}
+
+// List lists entries whose names start with prefix.
+func (c *breakerClient) List(prefix string, opts ...ListOption) (*ListResult, error) {
+	if !c.read.allow() {
+		return nil, ErrCircuitOpen
+	}
+	result, err := c.Client.List(prefix, opts...)
+	c.record(c.read, err)
+	return result, err
+}
+
+// DownloadRange downloads length bytes of name, starting at offset, into dst.
+func (c *breakerClient) DownloadRange(
+	namespace, name string, offset, length int64, dst io.Writer) error {
+
+	if !c.read.allow() {
+		return ErrCircuitOpen
+	}
+	err := downloadRange(c.Client, namespace, name, offset, length, dst)
+	c.record(c.read, err)
+	return err
+}
+
+// UploadIfAbsent uploads src into name if name does not exist.
+func (c *breakerClient) UploadIfAbsent(namespace, name string, src io.Reader) error {
+	if !c.write.allow() {
+		return ErrCircuitOpen
+	}
+	err := uploadIfAbsent(c.Client, namespace, name, src)
+	c.record(c.write, err)
+	return err
+}
+
+// CanCopyFrom returns true if the wrapped client can copy from src.
+func (c *breakerClient) CanCopyFrom(src Client) bool {
+	return canCopyFrom(c.Client, src)
+}
+
+// CopyFrom copies name from src into name.
+func (c *breakerClient) CopyFrom(src Client, namespace, name string) error {
+	if !c.write.allow() {
+		return ErrCircuitOpen
+	}
+	err := copyFrom(c.Client, src, namespace, name)
+	c.record(c.write, err)
+	return err
+}
+
+// SignedURL returns a URL through which name may be downloaded until ttl
+// elapses. Signing is local to the client, so it is not short-circuited.
+func (c *breakerClient) SignedURL(namespace, name string, ttl time.Duration) (string, error) {
+	return signedURL(c.Client, namespace, name, ttl)
+}
+
+// Delete deletes name.
+func (c *breakerClient) Delete(namespace, name string) error {
+	if !c.write.allow() {
+		return ErrCircuitOpen
+	}
+	err := deleteBlob(c.Client, namespace, name)
+	c.record(c.write, err)
+	return err
+}
+
+// Capabilities returns the optional features of the wrapped client.
+func (c *breakerClient) Capabilities() BackendCapabilities {
+	return c.Client.Capabilities()
+}
+
+// Unwrap returns the wrapped client.
+func (c *breakerClient) Unwrap() Client {
+	return c.Client
+}
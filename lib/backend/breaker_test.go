@@ -0,0 +1,132 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package backend
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/uber/kraken/core"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/stretchr/testify/require"
+	"github.com/uber-go/tally"
+)
+
+// flakyClient fails uploads with uploadErr and counts calls which reach it.
+type flakyClient struct {
+	NoopClient
+	uploadErr error
+	uploads   int
+	stats     int
+}
+
+func (c *flakyClient) Stat(namespace, name string) (*core.BlobInfo, error) {
+	c.stats++
+	return core.NewBlobInfo(1), nil
+}
+
+func (c *flakyClient) Upload(namespace, name string, src io.Reader) error {
+	c.uploads++
+	io.Copy(ioutil.Discard, src)
+	return c.uploadErr
+}
+
+func TestBreakerWriteFailuresDoNotTripReads(t *testing.T) {
+	require := require.New(t)
+
+	clk := clock.NewMock()
+	flaky := &flakyClient{uploadErr: errors.New("quota exceeded")}
+	c := withBreakers(flaky, CircuitBreakerConfig{
+		Enable: true,
+		Write:  BreakerConfig{Failures: 3, Cooldown: time.Minute},
+	}, clk, tally.NoopScope)
+
+	for i := 0; i < 3; i++ {
+		require.Equal(flaky.uploadErr, c.Upload("ns", "name", bytes.NewReader(nil)))
+	}
+
+	// Writes are short-circuited, while reads continue to flow.
+	require.Equal(ErrCircuitOpen, c.Upload("ns", "name", bytes.NewReader(nil)))
+	require.Equal(3, flaky.uploads)
+
+	for i := 0; i < 10; i++ {
+		_, err := c.Stat("ns", "name")
+		require.NoError(err)
+	}
+	require.Equal(10, flaky.stats)
+
+	// After the cooldown a single trial write is let through, which trips the
+	// breaker again on failure.
+	clk.Add(time.Minute)
+	require.Equal(flaky.uploadErr, c.Upload("ns", "name", bytes.NewReader(nil)))
+	require.Equal(ErrCircuitOpen, c.Upload("ns", "name", bytes.NewReader(nil)))
+	require.Equal(4, flaky.uploads)
+
+	// A successful trial closes the breaker.
+	clk.Add(time.Minute)
+	flaky.uploadErr = nil
+	require.NoError(c.Upload("ns", "name", bytes.NewReader(nil)))
+	require.NoError(c.Upload("ns", "name", bytes.NewReader(nil)))
+	require.Equal(6, flaky.uploads)
+}
+
+func TestBreakerIgnoresCancelledCalls(t *testing.T) {
+	require := require.New(t)
+
+	clk := clock.NewMock()
+	flaky := &flakyClient{uploadErr: errors.New("request canceled")}
+	c := withBreakers(flaky, CircuitBreakerConfig{
+		Enable: true,
+		Write:  BreakerConfig{Failures: 1, Cooldown: time.Minute},
+	}, clk, tally.NoopScope)
+
+	// Errors of calls whose callers gave up are not backend failures, whether
+	// the error is the context error or whatever the backend returned.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	bound := c.BindContext(ctx)
+	for i := 0; i < 3; i++ {
+		require.Equal(flaky.uploadErr, bound.Upload("ns", "name", bytes.NewReader(nil)))
+	}
+	flaky.uploadErr = context.DeadlineExceeded
+	for i := 0; i < 3; i++ {
+		require.Equal(context.DeadlineExceeded, c.Upload("ns", "name", bytes.NewReader(nil)))
+	}
+	require.Equal(6, flaky.uploads)
+
+	// Calls of other callers still reach the backend, and trip the breaker on
+	// real failures.
+	flaky.uploadErr = errors.New("quota exceeded")
+	require.Equal(flaky.uploadErr, c.Upload("ns", "name", bytes.NewReader(nil)))
+	require.Equal(ErrCircuitOpen, c.Upload("ns", "name", bytes.NewReader(nil)))
+}
+
+func TestBreakerIgnoresNotFound(t *testing.T) {
+	require := require.New(t)
+
+	c := withBreakers(NoopClient{}, CircuitBreakerConfig{
+		Enable: true,
+		Read:   BreakerConfig{Failures: 1},
+	}, clock.NewMock(), tally.NoopScope)
+
+	for i := 0; i < 3; i++ {
+		require.NotEqual(ErrCircuitOpen, c.Download("ns", "name", ioutil.Discard))
+	}
+}
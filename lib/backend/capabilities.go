@@ -0,0 +1,179 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package backend
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+)
+
+// ErrUnsupported is returned by wrapping Clients for optional operations which
+// the wrapped Client does not support.
+var ErrUnsupported = errors.New("operation not supported by backend")
+
+// BackendCapabilities declares which optional features a Client supports.
+// Callers must check capabilities before relying on a feature, and fall back to
+// the plain Client operations otherwise.
+type BackendCapabilities struct {
+	// Ranges indicates that the Client implements RangeClient.
+	Ranges bool
+
+	// ConditionalWrites indicates that the Client implements ConditionalClient.
+	ConditionalWrites bool
+
+	// ServerSideCopy indicates that the Client implements CopyClient.
+	ServerSideCopy bool
+
+	// SignedURLs indicates that the Client implements SignedURLClient.
+	SignedURLs bool
+
+	// ListModifiedSince indicates that List honors ListModifiedSince. Other
+	// Clients list all names regardless.
+	ListModifiedSince bool
+
+	// Deletes indicates that the Client implements DeleteClient.
+	Deletes bool
+}
+
+// ConditionalClient is implemented by Clients which natively support uploading
+// a blob only if it does not already exist.
+type ConditionalClient interface {
+	Client
+
+	// UploadIfAbsent uploads src into name. Implementations should return
+	// backenderrors.ErrBlobExists if name already exists.
+	UploadIfAbsent(namespace, name string, src io.Reader) error
+}
+
+// CopyClient is implemented by Clients which can copy blobs natively from
+// another Client of the same store, without streaming content through the
+// caller.
+type CopyClient interface {
+	Client
+
+	// CanCopyFrom returns true if src belongs to the same store, such that
+	// CopyFrom src is supported.
+	CanCopyFrom(src Client) bool
+
+	// CopyFrom copies name from src into name. Implementations should return
+	// backenderrors.ErrBlobNotFound if name does not exist in src.
+	CopyFrom(src Client, namespace, name string) error
+}
+
+// SignedURLClient is implemented by Clients which can issue time-limited URLs,
+// through which blobs may be downloaded directly from the backend without
+// credentials.
+type SignedURLClient interface {
+	Client
+
+	// SignedURL returns a URL through which name may be downloaded until ttl
+	// elapses.
+	SignedURL(namespace, name string, ttl time.Duration) (string, error)
+}
+
+// DeleteClient is implemented by Clients which can delete blobs.
+type DeleteClient interface {
+	Client
+
+	// Delete deletes name. Implementations should return
+	// backenderrors.ErrBlobNotFound if name does not exist.
+	Delete(namespace, name string) error
+}
+
+// ContextBinder is implemented by Clients whose operations can be bound to a
+// context, such that in-flight requests are cancelled and retries stop once the
+// context is done. Wrapping Clients bind the Client they wrap.
+type ContextBinder interface {
+	// BindContext returns a Client which runs the operations of the receiver
+	// under ctx. The receiver itself is not modified.
+	BindContext(ctx context.Context) Client
+}
+
+// Wrapper is implemented by Clients which wrap another Client without changing
+// the content of blobs, such that blobs may be copied natively from the wrapped
+// Client.
+type Wrapper interface {
+	Unwrap() Client
+}
+
+// Unwrap returns the innermost Client wrapped by c.
+func Unwrap(c Client) Client {
+	for {
+		w, ok := c.(Wrapper)
+		if !ok {
+			return c
+		}
+		c = w.Unwrap()
+	}
+}
+
+// bindContext binds c to ctx, or returns c unchanged if c cannot be bound.
+func bindContext(ctx context.Context, c Client) Client {
+	if b, ok := c.(ContextBinder); ok {
+		return b.BindContext(ctx)
+	}
+	return c
+}
+
+// The following helpers run the optional operations of c, which wrappers
+// forward to after applying their own behavior. Each returns ErrUnsupported if
+// c does not declare the operation's capability.
+
+func downloadRange(c Client, namespace, name string, offset, length int64, dst io.Writer) error {
+	rc, ok := c.(RangeClient)
+	if !ok || !c.Capabilities().Ranges {
+		return ErrUnsupported
+	}
+	return rc.DownloadRange(namespace, name, offset, length, dst)
+}
+
+func uploadIfAbsent(c Client, namespace, name string, src io.Reader) error {
+	cc, ok := c.(ConditionalClient)
+	if !ok || !c.Capabilities().ConditionalWrites {
+		return ErrUnsupported
+	}
+	return cc.UploadIfAbsent(namespace, name, src)
+}
+
+// canCopyFrom checks src without its wrappers, since native copies bypass them.
+func canCopyFrom(c, src Client) bool {
+	cc, ok := c.(CopyClient)
+	return ok && c.Capabilities().ServerSideCopy && cc.CanCopyFrom(Unwrap(src))
+}
+
+func copyFrom(c, src Client, namespace, name string) error {
+	cc, ok := c.(CopyClient)
+	if !ok || !c.Capabilities().ServerSideCopy {
+		return ErrUnsupported
+	}
+	return cc.CopyFrom(Unwrap(src), namespace, name)
+}
+
+func deleteBlob(c Client, namespace, name string) error {
+	dc, ok := c.(DeleteClient)
+	if !ok || !c.Capabilities().Deletes {
+		return ErrUnsupported
+	}
+	return dc.Delete(namespace, name)
+}
+
+func signedURL(c Client, namespace, name string, ttl time.Duration) (string, error) {
+	sc, ok := c.(SignedURLClient)
+	if !ok || !c.Capabilities().SignedURLs {
+		return "", ErrUnsupported
+	}
+	return sc.SignedURL(namespace, name, ttl)
+}
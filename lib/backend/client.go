@@ -63,4 +63,7 @@ type Client interface {
 
 	// List lists entries whose names start with prefix.
 	List(prefix string, opts ...ListOption) (*ListResult, error)
+
+	// Capabilities returns the optional features supported by the client.
+	Capabilities() BackendCapabilities
 }
@@ -26,6 +26,21 @@ type Config struct {
 
 	// If enabled, throttles upload / download bandwidth.
 	Bandwidth bandwidth.Config `yaml:"bandwidth"`
+
+	// If enabled, emits operation latencies and logs slow operations.
+	Latency LatencyConfig `yaml:"latency"`
+
+	// If enabled, short-circuits reads or writes after repeated failures.
+	CircuitBreaker CircuitBreakerConfig `yaml:"circuit_breaker"`
+
+	// If enabled, retries operations which failed with retryable errors.
+	Retry RetryConfig `yaml:"retry"`
+
+	// If enabled, serves reads from a replica of the backend.
+	ReadReplica ReadReplicaConfig `yaml:"read_replica"`
+
+	// If enabled, encrypts blobs before upload and decrypts them after download.
+	Encryption EncryptionConfig `yaml:"encryption"`
 }
 
 func (c Config) applyDefaults() Config {
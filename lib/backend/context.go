@@ -0,0 +1,202 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package backend
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/uber/kraken/core"
+)
+
+// ContextClient wraps a Client such that operations are abandoned once the
+// context is done. The wrapped Client is bound to the context if it implements
+// ContextBinder, such that the underlying operation is cancelled too. Otherwise
+// it keeps running in the background, however its result is discarded and it is
+// cut off from the caller's readers and writers.
+type ContextClient struct {
+	Client
+	ctx context.Context
+}
+
+// WithContext returns a Client which abandons operations when ctx is done.
+func WithContext(ctx context.Context, c Client) *ContextClient {
+	return &ContextClient{bindContext(ctx, c), ctx}
+}
+
+func (c *ContextClient) run(f func() error) error {
+	if err := c.ctx.Err(); err != nil {
+		return err
+	}
+	errc := make(chan error, 1)
+	go func() { errc <- f() }()
+	select {
+	case err := <-errc:
+		return err
+	case <-c.ctx.Done():
+		return c.ctx.Err()
+	}
+}
+
+// Stat returns blob info for name, or ctx's error if ctx is done first.
+func (c *ContextClient) Stat(namespace, name string) (*core.BlobInfo, error) {
+	var result *core.BlobInfo
+	err := c.run(func() error {
+		var err error
+		result, err = c.Client.Stat(namespace, name)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Upload uploads src into name, or returns ctx's error if ctx is done first.
+func (c *ContextClient) Upload(namespace, name string, src io.Reader) error {
+	r := &cutoffReader{r: src}
+	defer r.cutoff()
+	return c.run(func() error { return c.Client.Upload(namespace, name, r) })
+}
+
+// Download downloads name into dst, or returns ctx's error if ctx is done first.
+func (c *ContextClient) Download(namespace, name string, dst io.Writer) error {
+	w := &cutoffWriter{w: dst}
+	defer w.cutoff()
+	return c.run(func() error { return c.Client.Download(namespace, name, w) })
+}
+
+// List lists entries whose names start with prefix, or returns ctx's error if
+// ctx is done first.
+func (c *ContextClient) List(prefix string, opts ...ListOption) (*ListResult, error) {
+	var result *ListResult
+	err := c.run(func() error {
+		var err error
+		result, err = c.Client.List(prefix, opts...)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// DownloadRange downloads length bytes of name, starting at offset, into dst,
+// or returns ctx's error if ctx is done first.
+func (c *ContextClient) DownloadRange(
+	namespace, name string, offset, length int64, dst io.Writer) error {
+
+	w := &cutoffWriter{w: dst}
+	defer w.cutoff()
+	return c.run(func() error {
+		return downloadRange(c.Client, namespace, name, offset, length, w)
+	})
+}
+
+// UploadIfAbsent uploads src into name if name does not exist, or returns ctx's
+// error if ctx is done first.
+func (c *ContextClient) UploadIfAbsent(namespace, name string, src io.Reader) error {
+	r := &cutoffReader{r: src}
+	defer r.cutoff()
+	return c.run(func() error { return uploadIfAbsent(c.Client, namespace, name, r) })
+}
+
+// CanCopyFrom returns true if the wrapped client can copy from src.
+func (c *ContextClient) CanCopyFrom(src Client) bool {
+	return canCopyFrom(c.Client, src)
+}
+
+// CopyFrom copies name from src into name, or returns ctx's error if ctx is
+// done first.
+func (c *ContextClient) CopyFrom(src Client, namespace, name string) error {
+	return c.run(func() error { return copyFrom(c.Client, src, namespace, name) })
+}
+
+// SignedURL returns a URL through which name may be downloaded until ttl
+// elapses, or returns ctx's error if ctx is done first.
+func (c *ContextClient) SignedURL(namespace, name string, ttl time.Duration) (string, error) {
+	var u string
+	err := c.run(func() error {
+		var err error
+		u, err = signedURL(c.Client, namespace, name, ttl)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	return u, nil
+}
+
+// Delete deletes name, or returns ctx's error if ctx is done first.
+func (c *ContextClient) Delete(namespace, name string) error {
+	return c.run(func() error { return deleteBlob(c.Client, namespace, name) })
+}
+
+// Capabilities returns the optional features of the wrapped client.
+func (c *ContextClient) Capabilities() BackendCapabilities {
+	return c.Client.Capabilities()
+}
+
+// Unwrap returns the wrapped client.
+func (c *ContextClient) Unwrap() Client {
+	return c.Client
+}
+
+// cutoffReader stops reading from r once cutoff is called, such that abandoned
+// operations cannot touch the caller's reader after returning.
+type cutoffReader struct {
+	sync.Mutex
+	r   io.Reader
+	off bool
+}
+
+func (r *cutoffReader) Read(b []byte) (int, error) {
+	r.Lock()
+	defer r.Unlock()
+	if r.off {
+		return 0, context.Canceled
+	}
+	return r.r.Read(b)
+}
+
+func (r *cutoffReader) cutoff() {
+	r.Lock()
+	r.off = true
+	r.Unlock()
+}
+
+// cutoffWriter stops writing to w once cutoff is called, such that abandoned
+// operations cannot touch the caller's writer after returning.
+type cutoffWriter struct {
+	sync.Mutex
+	w   io.Writer
+	off bool
+}
+
+func (w *cutoffWriter) Write(b []byte) (int, error) {
+	w.Lock()
+	defer w.Unlock()
+	if w.off {
+		return 0, context.Canceled
+	}
+	return w.w.Write(b)
+}
+
+func (w *cutoffWriter) cutoff() {
+	w.Lock()
+	w.off = true
+	w.Unlock()
+}
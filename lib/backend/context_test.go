@@ -0,0 +1,50 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package backend
+
+import (
+	"context"
+	"testing"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/stretchr/testify/require"
+	"github.com/uber-go/tally"
+)
+
+// bindingClient records the context it was bound to.
+type bindingClient struct {
+	NoopClient
+	ctx context.Context
+}
+
+func (c *bindingClient) BindContext(ctx context.Context) Client {
+	return &bindingClient{ctx: ctx}
+}
+
+func TestWithContextBindsThroughWrappers(t *testing.T) {
+	require := require.New(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	leaf := &bindingClient{}
+	c := WithContext(ctx, withBreakers(
+		withRetries(leaf, retryConfigFixture(), tally.NoopScope),
+		CircuitBreakerConfig{}, clock.NewMock(), tally.NoopScope))
+
+	bound, ok := Unwrap(c).(*bindingClient)
+	require.True(ok)
+	require.Equal(ctx, bound.ctx)
+	require.Nil(leaf.ctx)
+}
@@ -0,0 +1,307 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package backend
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/backend/backenderrors"
+)
+
+// Primaries of dual-writes.
+const (
+	PrimaryNew = "new"
+	PrimaryOld = "old"
+)
+
+// DualWriteConfig defines writing to both an old and a new store during a
+// backend migration. The backends of the Manager are the new store, and
+// OldBackends are the old store. Uploads are written to both stores, failing
+// only if the primary store fails, and downloads read from the new store with
+// fallback to the old store.
+type DualWriteConfig struct {
+	Enable bool `yaml:"enable"`
+
+	// Primary is the store whose failures fail uploads, either "new" or "old".
+	// Defaults to "new".
+	Primary string `yaml:"primary"`
+
+	OldBackends []Config `yaml:"old_backends"`
+}
+
+func (c DualWriteConfig) applyDefaults() DualWriteConfig {
+	if c.Primary == "" {
+		c.Primary = PrimaryNew
+	}
+	return c
+}
+
+// WithDualWrite configures the Manager to dual-write across its backends and
+// the old backends of config.
+func WithDualWrite(config DualWriteConfig) ManagerOption {
+	return func(o *managerOptions) { o.dualWrite = config }
+}
+
+// MirrorWriteError occurs when an upload succeeded against the primary store of
+// a dual-write, but failed against the other store. Callers are expected to
+// retry the upload.
+type MirrorWriteError struct {
+	err error
+}
+
+func (e MirrorWriteError) Error() string {
+	return fmt.Sprintf("mirror write: %s", e.err)
+}
+
+// IsMirrorWriteError returns true if err, or any error it wraps, is a
+// MirrorWriteError.
+func IsMirrorWriteError(err error) bool {
+	var e MirrorWriteError
+	return errors.As(err, &e)
+}
+
+// DualWriteClient composes the clients of the new and old store of a migration.
+// It is intended for small objects such as tags, since uploads are buffered in
+// memory such that they can be written twice.
+type DualWriteClient struct {
+	newer   Client
+	older   Client
+	primary string
+}
+
+// NewDualWriteClient returns a new DualWriteClient.
+func NewDualWriteClient(newer, older Client, primary string) *DualWriteClient {
+	return &DualWriteClient{newer, older, primary}
+}
+
+// BindContext binds both stores to ctx.
+func (c *DualWriteClient) BindContext(ctx context.Context) Client {
+	return &DualWriteClient{bindContext(ctx, c.newer), bindContext(ctx, c.older), c.primary}
+}
+
+func (c *DualWriteClient) stores() (primary, mirror Client) {
+	if c.primary == PrimaryOld {
+		return c.older, c.newer
+	}
+	return c.newer, c.older
+}
+
+// Stat returns blob info for name from the primary store. Name is reported
+// missing until it exists in both stores, such that callers which skip uploads
+// of existing blobs retry failed mirror writes.
+func (c *DualWriteClient) Stat(namespace, name string) (*core.BlobInfo, error) {
+	primary, mirror := c.stores()
+	info, err := primary.Stat(namespace, name)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := mirror.Stat(namespace, name); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// Upload uploads src into name in the primary store, and then in the other
+// store. Returns a MirrorWriteError if only the latter fails.
+func (c *DualWriteClient) Upload(namespace, name string, src io.Reader) error {
+	b, err := ioutil.ReadAll(src)
+	if err != nil {
+		return fmt.Errorf("read: %s", err)
+	}
+	primary, mirror := c.stores()
+	if err := primary.Upload(namespace, name, bytes.NewReader(b)); err != nil {
+		return err
+	}
+	if err := mirror.Upload(namespace, name, bytes.NewReader(b)); err != nil {
+		return MirrorWriteError{err}
+	}
+	return nil
+}
+
+// Download downloads name into dst from the new store, falling back to the old
+// store if name does not exist in the new store.
+func (c *DualWriteClient) Download(namespace, name string, dst io.Writer) error {
+	err := c.newer.Download(namespace, name, dst)
+	if err == backenderrors.ErrBlobNotFound {
+		return c.older.Download(namespace, name, dst)
+	}
+	return err
+}
+
+// Prefixes of the continuation tokens of paginated dual-write lists, which
+// denote the store the next page is listed from.
+const (
+	_newListToken = "new:"
+	_oldListToken = "old:"
+)
+
+// List lists names which start with prefix in either store, such that names
+// which were not migrated yet are still listed. Paginated lists page through
+// the new store and then the old store, skipping names of the old store which
+// the new store has, since they were listed already.
+func (c *DualWriteClient) List(prefix string, opts ...ListOption) (*ListResult, error) {
+	options := DefaultListOptions()
+	for _, opt := range opts {
+		opt(options)
+	}
+	if !options.Paginated {
+		return c.listAll(prefix, opts...)
+	}
+	token := options.ContinuationToken
+	if token == "" {
+		token = _newListToken
+	}
+	switch {
+	case strings.HasPrefix(token, _newListToken):
+		result, err := c.newer.List(
+			prefix, append(opts, ListWithContinuationToken(token[len(_newListToken):]))...)
+		if err != nil {
+			return nil, err
+		}
+		if result.ContinuationToken != "" {
+			result.ContinuationToken = _newListToken + result.ContinuationToken
+		} else {
+			result.ContinuationToken = _oldListToken
+		}
+		return result, nil
+	case strings.HasPrefix(token, _oldListToken):
+		result, err := c.older.List(
+			prefix, append(opts, ListWithContinuationToken(token[len(_oldListToken):]))...)
+		if err != nil {
+			return nil, err
+		}
+		names := make([]string, 0, len(result.Names))
+		for _, name := range result.Names {
+			// Tag clients are keyed by the tag itself.
+			_, err := c.newer.Stat(name, name)
+			if err == backenderrors.ErrBlobNotFound {
+				names = append(names, name)
+			} else if err != nil {
+				return nil, fmt.Errorf("stat %s in new store: %s", name, err)
+			}
+		}
+		result.Names = names
+		if result.ContinuationToken != "" {
+			result.ContinuationToken = _oldListToken + result.ContinuationToken
+		}
+		return result, nil
+	default:
+		return nil, fmt.Errorf("invalid continuation token %q", token)
+	}
+}
+
+// listAll lists names which start with prefix in both stores, names of the new
+// store first.
+func (c *DualWriteClient) listAll(prefix string, opts ...ListOption) (*ListResult, error) {
+	newer, err := c.newer.List(prefix, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("new store: %s", err)
+	}
+	older, err := c.older.List(prefix, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("old store: %s", err)
+	}
+	seen := make(map[string]bool, len(newer.Names))
+	for _, name := range newer.Names {
+		seen[name] = true
+	}
+	names := newer.Names
+	for _, name := range older.Names {
+		if !seen[name] {
+			names = append(names, name)
+		}
+	}
+	return &ListResult{Names: names}, nil
+}
+
+// DownloadRange downloads length bytes of name, starting at offset, into dst
+// from the new store, falling back to the old store like Download.
+func (c *DualWriteClient) DownloadRange(
+	namespace, name string, offset, length int64, dst io.Writer) error {
+
+	err := downloadRange(c.newer, namespace, name, offset, length, dst)
+	if err == backenderrors.ErrBlobNotFound {
+		return downloadRange(c.older, namespace, name, offset, length, dst)
+	}
+	return err
+}
+
+// UploadIfAbsent uploads src into name in the primary store if name does not
+// exist there, and then in the other store. Name already existing in the other
+// store is not a failure, since it was mirrored before.
+func (c *DualWriteClient) UploadIfAbsent(namespace, name string, src io.Reader) error {
+	b, err := ioutil.ReadAll(src)
+	if err != nil {
+		return fmt.Errorf("read: %s", err)
+	}
+	primary, mirror := c.stores()
+	if err := uploadIfAbsent(primary, namespace, name, bytes.NewReader(b)); err != nil {
+		return err
+	}
+	err = uploadIfAbsent(mirror, namespace, name, bytes.NewReader(b))
+	if err != nil && err != backenderrors.ErrBlobExists {
+		return MirrorWriteError{err}
+	}
+	return nil
+}
+
+// CanCopyFrom returns false, since native copies cannot write both stores.
+func (c *DualWriteClient) CanCopyFrom(src Client) bool {
+	return false
+}
+
+// CopyFrom is not supported.
+func (c *DualWriteClient) CopyFrom(src Client, namespace, name string) error {
+	return ErrUnsupported
+}
+
+// SignedURL is not supported, since name may only exist in the old store.
+func (c *DualWriteClient) SignedURL(namespace, name string, ttl time.Duration) (string, error) {
+	return "", ErrUnsupported
+}
+
+// Delete deletes name from the primary store, and then from the other store.
+// Name not existing in the other store is not a failure.
+func (c *DualWriteClient) Delete(namespace, name string) error {
+	primary, mirror := c.stores()
+	if err := deleteBlob(primary, namespace, name); err != nil {
+		return err
+	}
+	err := deleteBlob(mirror, namespace, name)
+	if err != nil && err != backenderrors.ErrBlobNotFound {
+		return MirrorWriteError{err}
+	}
+	return nil
+}
+
+// Capabilities returns the range reads, conditional writes, list filters and
+// deletes supported by both stores.
+func (c *DualWriteClient) Capabilities() BackendCapabilities {
+	newer := c.newer.Capabilities()
+	older := c.older.Capabilities()
+	return BackendCapabilities{
+		Ranges:            newer.Ranges && older.Ranges,
+		ConditionalWrites: newer.ConditionalWrites && older.ConditionalWrites,
+		ListModifiedSince: newer.ListModifiedSince && older.ListModifiedSince,
+		Deletes:           newer.Deletes && older.Deletes,
+	}
+}
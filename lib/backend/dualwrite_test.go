@@ -0,0 +1,240 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package backend_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/uber/kraken/core"
+	. "github.com/uber/kraken/lib/backend"
+	"github.com/uber/kraken/lib/backend/backenderrors"
+	"github.com/uber/kraken/lib/backend/namepath"
+	"github.com/uber/kraken/lib/backend/testfs"
+	"github.com/uber/kraken/mocks/lib/backend"
+	"github.com/uber/kraken/utils/mockutil"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+	"github.com/uber-go/tally"
+)
+
+func TestDualWriteClientUploadsToBothStores(t *testing.T) {
+	require := require.New(t)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	newer := mockbackend.NewMockClient(ctrl)
+	older := mockbackend.NewMockClient(ctrl)
+	client := NewDualWriteClient(newer, older, PrimaryNew)
+
+	blob := core.NewBlobFixture()
+
+	gomock.InOrder(
+		newer.EXPECT().Upload("ns", "name", mockutil.MatchReader(blob.Content)).Return(nil),
+		older.EXPECT().Upload("ns", "name", mockutil.MatchReader(blob.Content)).Return(nil),
+	)
+
+	require.NoError(client.Upload("ns", "name", bytes.NewReader(blob.Content)))
+}
+
+func TestDualWriteClientMirrorFailure(t *testing.T) {
+	tests := []struct {
+		primary string
+	}{
+		{PrimaryNew},
+		{PrimaryOld},
+	}
+	for _, test := range tests {
+		t.Run(test.primary, func(t *testing.T) {
+			require := require.New(t)
+
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			newer := mockbackend.NewMockClient(ctrl)
+			older := mockbackend.NewMockClient(ctrl)
+			client := NewDualWriteClient(newer, older, test.primary)
+
+			primary, mirror := newer, older
+			if test.primary == PrimaryOld {
+				primary, mirror = older, newer
+			}
+
+			primary.EXPECT().Upload("ns", "name", gomock.Any()).Return(nil)
+			mirror.EXPECT().Upload("ns", "name", gomock.Any()).Return(errors.New("some error"))
+
+			err := client.Upload("ns", "name", bytes.NewReader(core.NewBlobFixture().Content))
+			require.Error(err)
+			require.True(IsMirrorWriteError(err))
+		})
+	}
+}
+
+func TestDualWriteClientPrimaryFailure(t *testing.T) {
+	require := require.New(t)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	newer := mockbackend.NewMockClient(ctrl)
+	older := mockbackend.NewMockClient(ctrl)
+	client := NewDualWriteClient(newer, older, PrimaryOld)
+
+	older.EXPECT().Upload("ns", "name", gomock.Any()).Return(errors.New("some error"))
+
+	err := client.Upload("ns", "name", bytes.NewReader(core.NewBlobFixture().Content))
+	require.Error(err)
+	require.False(IsMirrorWriteError(err))
+}
+
+func TestDualWriteClientDownloadFallsBackToOldStore(t *testing.T) {
+	require := require.New(t)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	newer := mockbackend.NewMockClient(ctrl)
+	older := mockbackend.NewMockClient(ctrl)
+	client := NewDualWriteClient(newer, older, PrimaryNew)
+
+	blob := core.NewBlobFixture()
+
+	gomock.InOrder(
+		newer.EXPECT().Download("ns", "name", gomock.Any()).Return(backenderrors.ErrBlobNotFound),
+		older.EXPECT().Download("ns", "name", gomock.Any()).DoAndReturn(
+			func(namespace, name string, dst io.Writer) error {
+				_, err := dst.Write(blob.Content)
+				return err
+			}),
+	)
+
+	var b bytes.Buffer
+	require.NoError(client.Download("ns", "name", &b))
+	require.Equal(blob.Content, b.Bytes())
+}
+
+func TestDualWriteClientStatRequiresBothStores(t *testing.T) {
+	require := require.New(t)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	newer := mockbackend.NewMockClient(ctrl)
+	older := mockbackend.NewMockClient(ctrl)
+	client := NewDualWriteClient(newer, older, PrimaryNew)
+
+	newer.EXPECT().Stat("ns", "name").Return(core.NewBlobInfo(1), nil).Times(2)
+	gomock.InOrder(
+		older.EXPECT().Stat("ns", "name").Return(nil, backenderrors.ErrBlobNotFound),
+		older.EXPECT().Stat("ns", "name").Return(core.NewBlobInfo(1), nil),
+	)
+
+	_, err := client.Stat("ns", "name")
+	require.Equal(backenderrors.ErrBlobNotFound, err)
+
+	info, err := client.Stat("ns", "name")
+	require.NoError(err)
+	require.Equal(core.NewBlobInfo(1), info)
+}
+
+func TestDualWriteClientListsNamesOfBothStores(t *testing.T) {
+	require := require.New(t)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	newer := mockbackend.NewMockClient(ctrl)
+	older := mockbackend.NewMockClient(ctrl)
+	client := NewDualWriteClient(newer, older, PrimaryNew)
+
+	newer.EXPECT().List("repo").Return(&ListResult{Names: []string{"repo:a", "repo:b"}}, nil)
+	older.EXPECT().List("repo").Return(&ListResult{Names: []string{"repo:b", "repo:c"}}, nil)
+
+	result, err := client.List("repo")
+	require.NoError(err)
+	require.Equal([]string{"repo:a", "repo:b", "repo:c"}, result.Names)
+}
+
+func TestDualWriteClientPaginatesThroughNewStoreThenOldStore(t *testing.T) {
+	require := require.New(t)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	newer := mockbackend.NewMockClient(ctrl)
+	older := mockbackend.NewMockClient(ctrl)
+	client := NewDualWriteClient(newer, older, PrimaryNew)
+
+	gomock.InOrder(
+		newer.EXPECT().List("repo", gomock.Any(), gomock.Any(), gomock.Any()).Return(
+			&ListResult{Names: []string{"repo:a"}, ContinuationToken: "n1"}, nil),
+		newer.EXPECT().List("repo", gomock.Any(), gomock.Any(), gomock.Any()).Return(
+			&ListResult{Names: []string{"repo:b"}}, nil),
+	)
+	gomock.InOrder(
+		older.EXPECT().List("repo", gomock.Any(), gomock.Any(), gomock.Any()).Return(
+			&ListResult{Names: []string{"repo:b"}, ContinuationToken: "o1"}, nil),
+		older.EXPECT().List("repo", gomock.Any(), gomock.Any(), gomock.Any()).Return(
+			&ListResult{Names: []string{"repo:c"}}, nil),
+	)
+	newer.EXPECT().Stat("repo:b", "repo:b").Return(core.NewBlobInfo(1), nil)
+	newer.EXPECT().Stat("repo:c", "repo:c").Return(nil, backenderrors.ErrBlobNotFound)
+
+	var names []string
+	var token string
+	for {
+		result, err := client.List("repo", ListWithPagination(), ListWithContinuationToken(token))
+		require.NoError(err)
+		names = append(names, result.Names...)
+		if result.ContinuationToken == "" {
+			break
+		}
+		token = result.ContinuationToken
+	}
+	require.Equal([]string{"repo:a", "repo:b", "repo:c"}, names)
+}
+
+func TestManagerDualWriteWrapsClientsOfBothStores(t *testing.T) {
+	require := require.New(t)
+
+	m, err := NewManager([]Config{{
+		Namespace: ".*",
+		Backend: map[string]interface{}{
+			"testfs": testfs.Config{Addr: "new-addr", NamePath: namepath.Identity},
+		},
+	}}, AuthConfig{}, tally.NoopScope, WithDualWrite(DualWriteConfig{
+		Enable: true,
+		OldBackends: []Config{{
+			Namespace: "foo/.*",
+			Backend: map[string]interface{}{
+				"testfs": testfs.Config{Addr: "old-addr", NamePath: namepath.Identity},
+			},
+		}},
+	}))
+	require.NoError(err)
+
+	c, err := m.GetClient("foo/bar")
+	require.NoError(err)
+	_, ok := c.(*DualWriteClient)
+	require.True(ok)
+
+	c, err = m.GetClient("baz/bar")
+	require.NoError(err)
+	_, ok = c.(*DualWriteClient)
+	require.False(ok)
+}
@@ -0,0 +1,345 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package backend
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/uber/kraken/core"
+)
+
+// EncryptionConfig defines client-side encryption of blobs at the backend
+// boundary. Blobs are encrypted before upload and decrypted after download, so
+// stored objects are ciphertext while the rest of Kraken only sees plaintext.
+type EncryptionConfig struct {
+	Enable bool `yaml:"enable"`
+
+	// Keys maps key IDs to files containing hex-encoded 256-bit keys. Key IDs
+	// are stored in every object, and are at most 32 bytes.
+	Keys map[string]string `yaml:"keys"`
+
+	// ActiveKey is the ID of the key which encrypts uploads. Downloads are
+	// decrypted with the key the object was encrypted with, which thus must
+	// stay configured until all of its objects are rewritten.
+	ActiveKey string `yaml:"active_key"`
+}
+
+// Objects are encrypted as a header followed by chunks, each sealed with
+// AES-GCM, such that blobs are streamed rather than buffered in full. Chunk
+// nonces are derived from a random per-object nonce and the chunk index, and
+// the last chunk is sealed as such, which detects reordered and truncated
+// objects.
+const (
+	_encryptionMagic     = "KBE"
+	_encryptionVersion   = 1
+	_encryptionKeyIDSize = 32
+	_encryptionChunkSize = 64 * 1024
+	_encryptionTagSize   = 16
+	_encryptionNonceSize = 12
+
+	_encryptionHeaderSize = len(_encryptionMagic) + 1 + _encryptionKeyIDSize + _encryptionNonceSize
+	_encryptedChunkSize   = _encryptionChunkSize + _encryptionTagSize
+)
+
+var errNotEncrypted = errors.New("object is not encrypted")
+
+// EncryptedClient encrypts blobs uploaded to and decrypts blobs downloaded
+// from the wrapped Client. Only conditional writes and deletes of the wrapped
+// client are supported, since range reads, native copies and signed URLs would
+// operate on ciphertext.
+type EncryptedClient struct {
+	Client
+	active string
+	keys   map[string]cipher.AEAD
+}
+
+// NewEncryptedClient wraps c with encryption according to config.
+func NewEncryptedClient(c Client, config EncryptionConfig) (*EncryptedClient, error) {
+	if _, ok := config.Keys[config.ActiveKey]; !ok {
+		return nil, fmt.Errorf("active key %q not configured", config.ActiveKey)
+	}
+	keys := make(map[string]cipher.AEAD)
+	for id, path := range config.Keys {
+		if id == "" || len(id) > _encryptionKeyIDSize {
+			return nil, fmt.Errorf("key id %q must be 1 to %d bytes", id, _encryptionKeyIDSize)
+		}
+		aead, err := loadEncryptionKey(path)
+		if err != nil {
+			return nil, fmt.Errorf("load key %s: %s", id, err)
+		}
+		keys[id] = aead
+	}
+	return &EncryptedClient{c, config.ActiveKey, keys}, nil
+}
+
+// BindContext binds the wrapped client to ctx.
+func (c *EncryptedClient) BindContext(ctx context.Context) Client {
+	return &EncryptedClient{bindContext(ctx, c.Client), c.active, c.keys}
+}
+
+func loadEncryptionKey(path string) (cipher.AEAD, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	key, err := hex.DecodeString(strings.TrimSpace(string(b)))
+	if err != nil {
+		return nil, fmt.Errorf("decode hex: %s", err)
+	}
+	if len(key) != 32 {
+		return nil, fmt.Errorf("expected 32 byte key, got %d", len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Stat returns blob info for name, with the size of the plaintext.
+func (c *EncryptedClient) Stat(namespace, name string) (*core.BlobInfo, error) {
+	info, err := c.Client.Stat(namespace, name)
+	if err != nil {
+		return nil, err
+	}
+	size, err := plaintextSize(info.Size)
+	if err != nil {
+		return nil, err
+	}
+	return core.NewBlobInfo(size), nil
+}
+
+// plaintextSize returns the size of the plaintext of an object of size bytes.
+func plaintextSize(size int64) (int64, error) {
+	body := size - int64(_encryptionHeaderSize)
+	if body < _encryptionTagSize {
+		return 0, errNotEncrypted
+	}
+	chunks := (body + _encryptedChunkSize - 1) / _encryptedChunkSize
+	return body - chunks*_encryptionTagSize, nil
+}
+
+// Upload encrypts src into name with the active key.
+func (c *EncryptedClient) Upload(namespace, name string, src io.Reader) error {
+	r, err := c.newEncryptingReader(src)
+	if err != nil {
+		return err
+	}
+	return c.Client.Upload(namespace, name, r)
+}
+
+// Download decrypts name into dst. Plaintext is only written once it was
+// authenticated, however a failed download may have written a prefix of it.
+func (c *EncryptedClient) Download(namespace, name string, dst io.Writer) error {
+	w := &decryptingWriter{keys: c.keys, dst: dst}
+	if err := c.Client.Download(namespace, name, w); err != nil {
+		return err
+	}
+	return w.finish()
+}
+
+// UploadIfAbsent encrypts src into name with the active key, if name does not
+// exist.
+func (c *EncryptedClient) UploadIfAbsent(namespace, name string, src io.Reader) error {
+	r, err := c.newEncryptingReader(src)
+	if err != nil {
+		return err
+	}
+	return uploadIfAbsent(c.Client, namespace, name, r)
+}
+
+// Retryable defers to the wrapped client, such that retries classify errors of
+// the backend SDK instead of the encryption layer.
+func (c *EncryptedClient) Retryable(err error) bool {
+	if classifier, ok := c.Client.(ErrorClassifier); ok {
+		return classifier.Retryable(err)
+	}
+	return IsRetryable(err)
+}
+
+// Delete deletes name.
+func (c *EncryptedClient) Delete(namespace, name string) error {
+	return deleteBlob(c.Client, namespace, name)
+}
+
+// Capabilities returns the conditional writes, list filters and deletes of the
+// wrapped client.
+func (c *EncryptedClient) Capabilities() BackendCapabilities {
+	caps := c.Client.Capabilities()
+	return BackendCapabilities{
+		ConditionalWrites: caps.ConditionalWrites,
+		ListModifiedSince: caps.ListModifiedSince,
+		Deletes:           caps.Deletes,
+	}
+}
+
+func chunkNonce(base []byte, i uint64) []byte {
+	nonce := make([]byte, _encryptionNonceSize)
+	copy(nonce, base)
+	ctr := binary.BigEndian.Uint64(nonce[4:]) ^ i
+	binary.BigEndian.PutUint64(nonce[4:], ctr)
+	return nonce
+}
+
+// chunkAD binds every chunk to the object header, and marks the last chunk.
+func chunkAD(header []byte, last bool) []byte {
+	ad := make([]byte, len(header)+1)
+	copy(ad, header)
+	if last {
+		ad[len(header)] = 1
+	}
+	return ad
+}
+
+// encryptingReader reads the encrypted object of a plaintext reader.
+type encryptingReader struct {
+	aead   cipher.AEAD
+	header []byte
+	src    *bufio.Reader
+	chunk  []byte
+	i      uint64
+	buf    bytes.Buffer
+	done   bool
+}
+
+func (c *EncryptedClient) newEncryptingReader(src io.Reader) (*encryptingReader, error) {
+	header := make([]byte, _encryptionHeaderSize)
+	n := copy(header, _encryptionMagic)
+	header[n] = _encryptionVersion
+	copy(header[n+1:], c.active)
+	if _, err := rand.Read(header[n+1+_encryptionKeyIDSize:]); err != nil {
+		return nil, fmt.Errorf("nonce: %s", err)
+	}
+	r := &encryptingReader{
+		aead:   c.keys[c.active],
+		header: header,
+		src:    bufio.NewReaderSize(src, _encryptionChunkSize),
+		chunk:  make([]byte, _encryptionChunkSize),
+	}
+	r.buf.Write(header)
+	return r, nil
+}
+
+func (r *encryptingReader) Read(p []byte) (int, error) {
+	for r.buf.Len() == 0 {
+		if r.done {
+			return 0, io.EOF
+		}
+		if err := r.sealChunk(); err != nil {
+			return 0, err
+		}
+	}
+	return r.buf.Read(p)
+}
+
+func (r *encryptingReader) sealChunk() error {
+	n, err := io.ReadFull(r.src, r.chunk)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return err
+	}
+	last := n < len(r.chunk)
+	if !last {
+		// A full chunk is only the last one if nothing follows it.
+		if _, err := r.src.Peek(1); err == io.EOF {
+			last = true
+		} else if err != nil {
+			return err
+		}
+	}
+	nonce := chunkNonce(r.header[len(r.header)-_encryptionNonceSize:], r.i)
+	r.buf.Write(r.aead.Seal(nil, nonce, r.chunk[:n], chunkAD(r.header, last)))
+	r.i++
+	r.done = last
+	return nil
+}
+
+// decryptingWriter writes the plaintext of an encrypted object to dst. Since
+// a full chunk is only known to be the last once the object ends, the final
+// chunk is decrypted by finish.
+type decryptingWriter struct {
+	keys   map[string]cipher.AEAD
+	dst    io.Writer
+	aead   cipher.AEAD
+	header []byte
+	i      uint64
+	buf    []byte
+}
+
+func (w *decryptingWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	if w.header == nil {
+		if len(w.buf) < _encryptionHeaderSize {
+			return len(p), nil
+		}
+		if err := w.parseHeader(w.buf[:_encryptionHeaderSize]); err != nil {
+			return 0, err
+		}
+		w.buf = w.buf[_encryptionHeaderSize:]
+	}
+	for len(w.buf) > _encryptedChunkSize {
+		if err := w.openChunk(w.buf[:_encryptedChunkSize], false); err != nil {
+			return 0, err
+		}
+		w.buf = w.buf[_encryptedChunkSize:]
+	}
+	return len(p), nil
+}
+
+func (w *decryptingWriter) parseHeader(header []byte) error {
+	n := len(_encryptionMagic)
+	if string(header[:n]) != _encryptionMagic {
+		return errNotEncrypted
+	}
+	if header[n] != _encryptionVersion {
+		return fmt.Errorf("unsupported encryption version %d", header[n])
+	}
+	id := string(bytes.TrimRight(header[n+1:n+1+_encryptionKeyIDSize], "\x00"))
+	aead, ok := w.keys[id]
+	if !ok {
+		return fmt.Errorf("unknown encryption key %q", id)
+	}
+	w.aead = aead
+	w.header = append([]byte(nil), header...)
+	return nil
+}
+
+func (w *decryptingWriter) openChunk(chunk []byte, last bool) error {
+	nonce := chunkNonce(w.header[len(w.header)-_encryptionNonceSize:], w.i)
+	plaintext, err := w.aead.Open(nil, nonce, chunk, chunkAD(w.header, last))
+	if err != nil {
+		return fmt.Errorf("decrypt chunk %d: %s", w.i, err)
+	}
+	w.i++
+	_, err = w.dst.Write(plaintext)
+	return err
+}
+
+func (w *decryptingWriter) finish() error {
+	if w.header == nil {
+		return errNotEncrypted
+	}
+	return w.openChunk(w.buf, true)
+}
@@ -0,0 +1,247 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package backend_test
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/uber/kraken/core"
+	. "github.com/uber/kraken/lib/backend"
+	"github.com/uber/kraken/lib/backend/namepath"
+	"github.com/uber/kraken/lib/backend/testfs"
+	"github.com/uber/kraken/utils/randutil"
+	"github.com/uber/kraken/utils/testutil"
+
+	"github.com/stretchr/testify/require"
+	"github.com/uber-go/tally"
+)
+
+type encryptionFixture struct {
+	config EncryptionConfig
+	store  Client // Plain view of the stored objects.
+	addr   string
+}
+
+func newEncryptionFixture(t *testing.T) (*encryptionFixture, func()) {
+	var cleanup testutil.Cleanup
+
+	dir, err := ioutil.TempDir("", "keys")
+	require.NoError(t, err)
+	cleanup.Add(func() { os.RemoveAll(dir) })
+	keys := make(map[string]string)
+	for _, id := range []string{"k1", "k2"} {
+		b := make([]byte, 32)
+		_, err := rand.Read(b)
+		require.NoError(t, err)
+		keys[id] = filepath.Join(dir, id)
+		require.NoError(t, ioutil.WriteFile(keys[id], []byte(hex.EncodeToString(b)), 0600))
+	}
+
+	server := testfs.NewServer()
+	cleanup.Add(server.Cleanup)
+	addr, stop := testutil.StartServer(server.Handler())
+	cleanup.Add(stop)
+
+	store, err := testfs.NewClient(testfs.Config{Addr: addr, Root: "root", NamePath: namepath.Identity})
+	require.NoError(t, err)
+
+	return &encryptionFixture{
+		config: EncryptionConfig{Enable: true, Keys: keys, ActiveKey: "k1"},
+		store:  store,
+		addr:   addr,
+	}, cleanup.Run
+}
+
+func (f *encryptionFixture) client(t *testing.T) Client {
+	c, err := NewEncryptedClient(f.store, f.config)
+	require.NoError(t, err)
+	return c
+}
+
+func (f *encryptionFixture) stored(t *testing.T, name string) []byte {
+	var b bytes.Buffer
+	require.NoError(t, f.store.Download("ns", name, &b))
+	return b.Bytes()
+}
+
+func TestEncryptedClientRoundTrip(t *testing.T) {
+	for _, size := range []uint64{0, 1, 1000, 64 * 1024, 64*1024 + 1, 200 * 1024} {
+		t.Run(strconv.FormatUint(size, 10), func(t *testing.T) {
+			require := require.New(t)
+
+			f, cleanup := newEncryptionFixture(t)
+			defer cleanup()
+
+			c := f.client(t)
+			blob := core.SizedBlobFixture(size, 1)
+
+			require.NoError(c.Upload("ns", "blob", bytes.NewReader(blob.Content)))
+
+			// Stored object is ciphertext.
+			stored := f.stored(t, "blob")
+			require.True(len(stored) > len(blob.Content))
+			if size >= 16 {
+				require.False(bytes.Contains(stored, blob.Content[:16]))
+			}
+
+			info, err := c.Stat("ns", "blob")
+			require.NoError(err)
+			require.Equal(int64(size), info.Size)
+
+			var b bytes.Buffer
+			require.NoError(c.Download("ns", "blob", &b))
+			d, err := core.NewDigester().FromBytes(b.Bytes())
+			require.NoError(err)
+			require.Equal(blob.Digest, d)
+		})
+	}
+}
+
+func TestEncryptedClientDetectsTampering(t *testing.T) {
+	tests := []struct {
+		desc   string
+		tamper func([]byte) []byte
+	}{
+		{"flipped byte", func(b []byte) []byte {
+			b[len(b)/2] ^= 1
+			return b
+		}},
+		{"truncated", func(b []byte) []byte { return b[:64*1024+16+63] }},
+		{"plaintext", func(b []byte) []byte { return randutil.Blob(uint64(len(b))) }},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			require := require.New(t)
+
+			f, cleanup := newEncryptionFixture(t)
+			defer cleanup()
+
+			c := f.client(t)
+			blob := core.SizedBlobFixture(150*1024, 1)
+			require.NoError(c.Upload("ns", "blob", bytes.NewReader(blob.Content)))
+
+			tampered := test.tamper(f.stored(t, "blob"))
+			require.NoError(f.store.Upload("ns", "blob", bytes.NewReader(tampered)))
+
+			require.Error(c.Download("ns", "blob", ioutil.Discard))
+		})
+	}
+}
+
+func TestEncryptedClientDecryptsWithRotatedKeys(t *testing.T) {
+	require := require.New(t)
+
+	f, cleanup := newEncryptionFixture(t)
+	defer cleanup()
+
+	blob := core.SizedBlobFixture(1000, 1)
+	require.NoError(f.client(t).Upload("ns", "old", bytes.NewReader(blob.Content)))
+
+	f.config.ActiveKey = "k2"
+	c := f.client(t)
+	require.NoError(c.Upload("ns", "new", bytes.NewReader(blob.Content)))
+
+	for _, name := range []string{"old", "new"} {
+		var b bytes.Buffer
+		require.NoError(c.Download("ns", name, &b))
+		require.Equal(blob.Content, b.Bytes())
+	}
+
+	// Objects of removed keys cannot be decrypted.
+	delete(f.config.Keys, "k1")
+	require.Error(f.client(t).Download("ns", "old", ioutil.Discard))
+}
+
+// classifyingClient treats every error as retryable, like an SDK classifying
+// its own throttling errors.
+type classifyingClient struct {
+	Client
+}
+
+func (classifyingClient) Retryable(err error) bool { return true }
+
+func TestEncryptedClientDefersErrorClassification(t *testing.T) {
+	require := require.New(t)
+
+	f, cleanup := newEncryptionFixture(t)
+	defer cleanup()
+
+	c, err := NewEncryptedClient(classifyingClient{f.store}, f.config)
+	require.NoError(err)
+	require.True(c.Retryable(errors.New("slow down")))
+
+	c = f.client(t).(*EncryptedClient)
+	require.False(c.Retryable(errors.New("slow down")))
+}
+
+func TestManagerEncryption(t *testing.T) {
+	require := require.New(t)
+
+	f, cleanup := newEncryptionFixture(t)
+	defer cleanup()
+
+	m, err := NewManager([]Config{{
+		Namespace: ".*",
+		Backend: map[string]interface{}{
+			"testfs": testfs.Config{Addr: f.addr, Root: "root", NamePath: namepath.Identity},
+		},
+		Encryption: f.config,
+	}}, AuthConfig{}, tally.NoopScope)
+	require.NoError(err)
+
+	c, err := m.GetClient("ns")
+	require.NoError(err)
+
+	blob := core.NewBlobFixture()
+	require.NoError(c.Upload("ns", "blob", bytes.NewReader(blob.Content)))
+	require.NotEqual(blob.Content, f.stored(t, "blob"))
+
+	var b bytes.Buffer
+	require.NoError(c.Download("ns", "blob", &b))
+	require.Equal(blob.Content, b.Bytes())
+}
+
+func TestNewEncryptedClientErrors(t *testing.T) {
+	f, cleanup := newEncryptionFixture(t)
+	defer cleanup()
+
+	tests := []struct {
+		desc   string
+		config EncryptionConfig
+	}{
+		{"unknown active key", EncryptionConfig{Keys: f.config.Keys, ActiveKey: "k3"}},
+		{"key id too long", EncryptionConfig{
+			Keys:      map[string]string{string(make([]byte, 33)): f.config.Keys["k1"]},
+			ActiveKey: string(make([]byte, 33)),
+		}},
+		{"missing key file", EncryptionConfig{
+			Keys:      map[string]string{"k1": "/does/not/exist"},
+			ActiveKey: "k1",
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			_, err := NewEncryptedClient(f.store, test.config)
+			require.Error(t, err)
+		})
+	}
+}
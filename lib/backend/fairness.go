@@ -0,0 +1,261 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package backend
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/uber-go/tally"
+)
+
+// WriteFairnessConfig defines weighted fair queuing of uploads across
+// namespaces. When enabled, all backends of a Manager share a single budget of
+// concurrent uploads. Each namespace with queued uploads is guaranteed a share
+// of the budget proportional to its weight, and capacity left idle by some
+// namespaces is redistributed to the others. Namespaces are those of uploads,
+// not of configured backends, such that namespaces sharing a backend are
+// queued fairly too.
+type WriteFairnessConfig struct {
+	Enable bool `yaml:"enable"`
+
+	// Concurrency is the total number of concurrent uploads shared by all
+	// backends.
+	Concurrency int `yaml:"concurrency"`
+
+	// Weights maps regular expressions of namespaces to their weights. Each
+	// expression must match a namespace in full, and expressions are matched
+	// in sorted order. Namespaces which match no expression receive
+	// DefaultWeight.
+	Weights map[string]int `yaml:"weights"`
+
+	DefaultWeight int `yaml:"default_weight"`
+}
+
+func (c WriteFairnessConfig) applyDefaults() WriteFairnessConfig {
+	if c.Concurrency == 0 {
+		c.Concurrency = 16
+	}
+	if c.DefaultWeight == 0 {
+		c.DefaultWeight = 1
+	}
+	return c
+}
+
+// fairScheduler grants upload slots to namespaces. Whenever a slot is free, it
+// is granted to the waiting namespace with the fewest active uploads relative
+// to its weight.
+type fairScheduler struct {
+	config  WriteFairnessConfig
+	stats   tally.Scope
+	weights []namespaceWeight
+
+	mu      sync.Mutex
+	inuse   int
+	active  map[string]int
+	waiting map[string][]chan struct{}
+}
+
+// namespaceWeight is the weight of the namespaces matching an expression of
+// WriteFairnessConfig.Weights.
+type namespaceWeight struct {
+	pattern string
+	regexp  *regexp.Regexp
+	weight  int
+}
+
+func newFairScheduler(config WriteFairnessConfig, stats tally.Scope) (*fairScheduler, error) {
+	config = config.applyDefaults()
+	var weights []namespaceWeight
+	for pattern, w := range config.Weights {
+		re, err := regexp.Compile("^(?:" + pattern + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("weight of %q: %s", pattern, err)
+		}
+		if w <= 0 {
+			w = config.DefaultWeight
+		}
+		weights = append(weights, namespaceWeight{pattern, re, w})
+	}
+	sort.Slice(weights, func(i, j int) bool { return weights[i].pattern < weights[j].pattern })
+	return &fairScheduler{
+		config:  config,
+		stats:   stats,
+		weights: weights,
+		active:  make(map[string]int),
+		waiting: make(map[string][]chan struct{}),
+	}, nil
+}
+
+// class returns the expression of the weight of namespace, or "default", and
+// the weight. Classes bound the cardinality of per-namespace metrics.
+func (s *fairScheduler) class(namespace string) (string, int) {
+	for _, w := range s.weights {
+		if w.regexp.MatchString(namespace) {
+			return w.pattern, w.weight
+		}
+	}
+	return "default", s.config.DefaultWeight
+}
+
+func (s *fairScheduler) weight(namespace string) int {
+	_, w := s.class(namespace)
+	return w
+}
+
+// acquire blocks until namespace is granted an upload slot.
+func (s *fairScheduler) acquire(namespace string) {
+	start := time.Now()
+	defer func() {
+		class, _ := s.class(namespace)
+		s.stats.Tagged(map[string]string{
+			"namespace": class,
+		}).Timer("write_queue_wait").Record(time.Since(start))
+	}()
+
+	s.mu.Lock()
+	if s.inuse < s.config.Concurrency && len(s.waiting) == 0 {
+		s.inuse++
+		s.active[namespace]++
+		s.mu.Unlock()
+		return
+	}
+	c := make(chan struct{})
+	s.waiting[namespace] = append(s.waiting[namespace], c)
+	s.mu.Unlock()
+
+	<-c
+}
+
+// release returns an upload slot of namespace and grants free slots to waiters.
+func (s *fairScheduler) release(namespace string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.inuse--
+	if s.active[namespace]--; s.active[namespace] == 0 {
+		delete(s.active, namespace)
+	}
+	for s.inuse < s.config.Concurrency && len(s.waiting) > 0 {
+		next := s.next()
+		c := s.waiting[next][0]
+		if s.waiting[next] = s.waiting[next][1:]; len(s.waiting[next]) == 0 {
+			delete(s.waiting, next)
+		}
+		s.inuse++
+		s.active[next]++
+		close(c)
+	}
+}
+
+// next returns the waiting namespace with the lowest ratio of active uploads to
+// weight. Ties are broken by namespace for determinism.
+func (s *fairScheduler) next() string {
+	var best string
+	first := true
+	for ns := range s.waiting {
+		if first {
+			best, first = ns, false
+			continue
+		}
+		// Compare active[ns] / weight(ns) < active[best] / weight(best).
+		a := s.active[ns] * s.weight(best)
+		b := s.active[best] * s.weight(ns)
+		if a < b || (a == b && ns < best) {
+			best = ns
+		}
+	}
+	return best
+}
+
+// fairClient queues uploads of the wrapped client on a fairScheduler shared
+// with other backends, keyed by the namespace of each upload.
+type fairClient struct {
+	Client
+	scheduler *fairScheduler
+}
+
+func fair(client Client, scheduler *fairScheduler) *fairClient {
+	return &fairClient{client, scheduler}
+}
+
+// BindContext binds the wrapped client to ctx.
+func (c *fairClient) BindContext(ctx context.Context) Client {
+	return &fairClient{bindContext(ctx, c.Client), c.scheduler}
+}
+
+// Upload uploads src into name once the namespace is granted an upload slot.
+func (c *fairClient) Upload(namespace, name string, src io.Reader) error {
+	c.scheduler.acquire(namespace)
+	defer c.scheduler.release(namespace)
+
+	return c.Client.Upload(namespace, name, src)
+}
+
+// DownloadRange downloads length bytes of name, starting at offset, into dst.
+func (c *fairClient) DownloadRange(
+	namespace, name string, offset, length int64, dst io.Writer) error {
+
+	return downloadRange(c.Client, namespace, name, offset, length, dst)
+}
+
+// UploadIfAbsent uploads src into name if name does not exist, once the
+// namespace is granted an upload slot.
+func (c *fairClient) UploadIfAbsent(namespace, name string, src io.Reader) error {
+	c.scheduler.acquire(namespace)
+	defer c.scheduler.release(namespace)
+
+	return uploadIfAbsent(c.Client, namespace, name, src)
+}
+
+// CanCopyFrom returns true if the wrapped client can copy from src.
+func (c *fairClient) CanCopyFrom(src Client) bool {
+	return canCopyFrom(c.Client, src)
+}
+
+// CopyFrom copies name from src into name once the namespace is granted an
+// upload slot, since native copies are writes like any other.
+func (c *fairClient) CopyFrom(src Client, namespace, name string) error {
+	c.scheduler.acquire(namespace)
+	defer c.scheduler.release(namespace)
+
+	return copyFrom(c.Client, src, namespace, name)
+}
+
+// SignedURL returns a URL through which name may be downloaded until ttl
+// elapses.
+func (c *fairClient) SignedURL(namespace, name string, ttl time.Duration) (string, error) {
+	return signedURL(c.Client, namespace, name, ttl)
+}
+
+// Delete deletes name. Deletes are not queued, since they do not transfer
+// content.
+func (c *fairClient) Delete(namespace, name string) error {
+	return deleteBlob(c.Client, namespace, name)
+}
+
+// Capabilities returns the optional features of the wrapped client.
+func (c *fairClient) Capabilities() BackendCapabilities {
+	return c.Client.Capabilities()
+}
+
+// Unwrap returns the wrapped client.
+func (c *fairClient) Unwrap() Client {
+	return c.Client
+}
@@ -0,0 +1,179 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package backend_test
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+
+	. "github.com/uber/kraken/lib/backend"
+
+	"github.com/stretchr/testify/require"
+	"github.com/uber-go/tally"
+)
+
+// blockingClient holds uploads until they are released.
+type blockingClient struct {
+	NoopClient
+	started chan string
+	release chan struct{}
+}
+
+func (c *blockingClient) Upload(namespace, name string, src io.Reader) error {
+	c.started <- namespace
+	<-c.release
+	return nil
+}
+
+func fairnessFixture(
+	t *testing.T, config WriteFairnessConfig, namespaces ...string) (
+	*Manager, chan string, map[string]chan struct{}) {
+
+	m, err := NewManager(nil, AuthConfig{}, tally.NoopScope, WithWriteFairness(config))
+	require.NoError(t, err)
+
+	started := make(chan string, 100)
+	release := make(map[string]chan struct{})
+	for _, ns := range namespaces {
+		release[ns] = make(chan struct{})
+		require.NoError(t, m.Register(ns, &blockingClient{
+			started: started,
+			release: release[ns],
+		}))
+	}
+	return m, started, release
+}
+
+func upload(t *testing.T, m *Manager, namespace string, n int) {
+	c, err := m.GetClient(namespace)
+	require.NoError(t, err)
+	for i := 0; i < n; i++ {
+		go c.Upload(namespace, "blob", bytes.NewReader(nil))
+	}
+}
+
+func expectStarted(t *testing.T, started chan string) string {
+	select {
+	case ns := <-started:
+		return ns
+	case <-time.After(5 * time.Second):
+		require.FailNow(t, "timed out waiting for upload to start")
+		return ""
+	}
+}
+
+func expectNoneStarted(t *testing.T, started chan string) {
+	select {
+	case ns := <-started:
+		require.FailNow(t, "unexpected upload started", ns)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestWriteFairnessFloodDoesNotStarveOtherNamespace(t *testing.T) {
+	require := require.New(t)
+
+	m, started, release := fairnessFixture(t, WriteFairnessConfig{
+		Enable:      true,
+		Concurrency: 4,
+	}, "bulk", "interactive")
+
+	// Bulk import saturates all slots and queues many more uploads.
+	upload(t, m, "bulk", 4)
+	for i := 0; i < 4; i++ {
+		require.Equal("bulk", expectStarted(t, started))
+	}
+	upload(t, m, "bulk", 20)
+	expectNoneStarted(t, started)
+
+	upload(t, m, "interactive", 3)
+	expectNoneStarted(t, started)
+
+	// Interactive uploads are granted freed slots until reaching their equal
+	// share of the budget.
+	for i := 0; i < 2; i++ {
+		release["bulk"] <- struct{}{}
+		require.Equal("interactive", expectStarted(t, started))
+	}
+
+	// At equal shares, each namespace is granted the slots it frees.
+	release["bulk"] <- struct{}{}
+	require.Equal("bulk", expectStarted(t, started))
+	release["interactive"] <- struct{}{}
+	require.Equal("interactive", expectStarted(t, started))
+}
+
+func TestWriteFairnessQueuesNamespacesOfSameBackendFairly(t *testing.T) {
+	require := require.New(t)
+
+	m, started, release := fairnessFixture(t, WriteFairnessConfig{
+		Enable:      true,
+		Concurrency: 2,
+	}, "team/.*")
+
+	upload(t, m, "team/bulk", 2)
+	for i := 0; i < 2; i++ {
+		require.Equal("team/bulk", expectStarted(t, started))
+	}
+	upload(t, m, "team/bulk", 10)
+	expectNoneStarted(t, started)
+
+	upload(t, m, "team/interactive", 1)
+	expectNoneStarted(t, started)
+
+	release["team/.*"] <- struct{}{}
+	require.Equal("team/interactive", expectStarted(t, started))
+}
+
+func TestWriteFairnessWeights(t *testing.T) {
+	require := require.New(t)
+
+	m, started, release := fairnessFixture(t, WriteFairnessConfig{
+		Enable:      true,
+		Concurrency: 4,
+		Weights:     map[string]int{"interactive": 3},
+	}, "bulk", "interactive")
+
+	upload(t, m, "bulk", 4)
+	for i := 0; i < 4; i++ {
+		require.Equal("bulk", expectStarted(t, started))
+	}
+	upload(t, m, "bulk", 20)
+	upload(t, m, "interactive", 20)
+	expectNoneStarted(t, started)
+
+	// Interactive is granted slots until it holds 3 of 4.
+	for i := 0; i < 3; i++ {
+		release["bulk"] <- struct{}{}
+		require.Equal("interactive", expectStarted(t, started))
+	}
+}
+
+func TestWriteFairnessRedistributesIdleCapacity(t *testing.T) {
+	require := require.New(t)
+
+	m, started, _ := fairnessFixture(t, WriteFairnessConfig{
+		Enable:      true,
+		Concurrency: 4,
+	}, "bulk", "interactive")
+
+	// With interactive idle, bulk may use the entire budget.
+	upload(t, m, "bulk", 5)
+	for i := 0; i < 4; i++ {
+		require.Equal("bulk", expectStarted(t, started))
+	}
+	expectNoneStarted(t, started)
+}
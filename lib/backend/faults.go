@@ -0,0 +1,139 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package backend
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/faults"
+)
+
+// faultyClient injects faults into operations of the wrapped client. Operations
+// are named "backend.<op>", and keyed by namespace.
+type faultyClient struct {
+	Client
+	faults *faults.Injector
+}
+
+func injectFaults(client Client, f *faults.Injector) *faultyClient {
+	return &faultyClient{client, f}
+}
+
+// BindContext binds the wrapped client to ctx.
+func (c *faultyClient) BindContext(ctx context.Context) Client {
+	return &faultyClient{bindContext(ctx, c.Client), c.faults}
+}
+
+// Stat returns blob info for name, unless a fault is injected.
+func (c *faultyClient) Stat(namespace, name string) (*core.BlobInfo, error) {
+	if err := c.faults.Fault("backend.stat", namespace); err != nil {
+		return nil, err
+	}
+	return c.Client.Stat(namespace, name)
+}
+
+// Upload uploads src into name, unless a fault is injected.
+func (c *faultyClient) Upload(namespace, name string, src io.Reader) error {
+	if err := c.faults.Fault("backend.upload", namespace); err != nil {
+		return err
+	}
+	return c.Client.Upload(namespace, name, src)
+}
+
+// Download downloads name into dst, unless a fault is injected. Downloaded data
+// may be corrupted by corrupt rules.
+func (c *faultyClient) Download(namespace, name string, dst io.Writer) error {
+	if err := c.faults.Fault("backend.download", namespace); err != nil {
+		return err
+	}
+	return c.Client.Download(namespace, name, c.faults.Corrupt("backend.download", namespace, dst))
+}
+
+// List lists entries whose names start with prefix, unless a fault is injected.
+func (c *faultyClient) List(prefix string, opts ...ListOption) (*ListResult, error) {
+	if err := c.faults.Fault("backend.list", prefix); err != nil {
+		return nil, err
+	}
+	return c.Client.List(prefix, opts...)
+}
+
+// Retryable classifies injected faults like any other error, and defers to the
+// wrapped client otherwise.
+func (c *faultyClient) Retryable(err error) bool {
+	if classifier, ok := c.Client.(ErrorClassifier); ok && !faults.IsFault(err) {
+		return classifier.Retryable(err)
+	}
+	return IsRetryable(err)
+}
+
+// DownloadRange downloads length bytes of name, starting at offset, into dst,
+// subject to the faults of downloads.
+func (c *faultyClient) DownloadRange(
+	namespace, name string, offset, length int64, dst io.Writer) error {
+
+	if err := c.faults.Fault("backend.download", namespace); err != nil {
+		return err
+	}
+	return downloadRange(
+		c.Client, namespace, name, offset, length, c.faults.Corrupt("backend.download", namespace, dst))
+}
+
+// UploadIfAbsent uploads src into name if name does not exist, subject to the
+// faults of uploads.
+func (c *faultyClient) UploadIfAbsent(namespace, name string, src io.Reader) error {
+	if err := c.faults.Fault("backend.upload", namespace); err != nil {
+		return err
+	}
+	return uploadIfAbsent(c.Client, namespace, name, src)
+}
+
+// CanCopyFrom returns true if the wrapped client can copy from src.
+func (c *faultyClient) CanCopyFrom(src Client) bool {
+	return canCopyFrom(c.Client, src)
+}
+
+// CopyFrom copies name from src into name, subject to the faults of uploads.
+func (c *faultyClient) CopyFrom(src Client, namespace, name string) error {
+	if err := c.faults.Fault("backend.upload", namespace); err != nil {
+		return err
+	}
+	return copyFrom(c.Client, src, namespace, name)
+}
+
+// SignedURL returns a URL through which name may be downloaded until ttl
+// elapses.
+func (c *faultyClient) SignedURL(namespace, name string, ttl time.Duration) (string, error) {
+	return signedURL(c.Client, namespace, name, ttl)
+}
+
+// Delete deletes name, subject to the faults of uploads.
+func (c *faultyClient) Delete(namespace, name string) error {
+	if err := c.faults.Fault("backend.upload", namespace); err != nil {
+		return err
+	}
+	return deleteBlob(c.Client, namespace, name)
+}
+
+// Capabilities returns the optional features of the wrapped client.
+func (c *faultyClient) Capabilities() BackendCapabilities {
+	return c.Client.Capabilities()
+}
+
+// Unwrap returns the wrapped client.
+func (c *faultyClient) Unwrap() Client {
+	return c.Client
+}
@@ -0,0 +1,96 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package backend
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/uber/kraken/lib/faults"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/stretchr/testify/require"
+	"github.com/uber-go/tally"
+)
+
+func faultInjectorFixture(t *testing.T, rules ...faults.Rule) *faults.Injector {
+	f, err := faults.New(faults.Config{Enabled: true, Rules: rules}, tally.NoopScope)
+	require.NoError(t, err)
+	return f
+}
+
+func TestInjectedBackendFaultIsRetried(t *testing.T) {
+	require := require.New(t)
+
+	client := &scriptedClient{}
+	f := faultInjectorFixture(t, faults.Rule{
+		Target: "backend.download",
+		Action: faults.ActionFail,
+		Limit:  2,
+	})
+	c := withRetries(injectFaults(client, f), retryConfigFixture(), tally.NoopScope)
+
+	var b bytes.Buffer
+	require.NoError(c.Download("ns", "name", &b))
+	require.Equal("content", b.String())
+
+	// Both faults were consumed by retries, and the backend only saw the
+	// attempt which succeeded.
+	require.NoError(f.Fault("backend.download", "ns"))
+	require.Equal(1, client.calls)
+}
+
+func TestInjectedBackendFaultsTripBreaker(t *testing.T) {
+	require := require.New(t)
+
+	client := &scriptedClient{}
+	f := faultInjectorFixture(t, faults.Rule{
+		Target: "backend.stat",
+		Action: faults.ActionFail,
+	})
+	c := withBreakers(
+		withRetries(injectFaults(client, f), retryConfigFixture(), tally.NoopScope),
+		CircuitBreakerConfig{
+			Enable: true,
+			Read:   BreakerConfig{Failures: 2, Cooldown: time.Minute},
+		}, clock.NewMock(), tally.NoopScope)
+
+	for i := 0; i < 2; i++ {
+		_, err := c.Stat("ns", "name")
+		require.True(faults.IsFault(err))
+	}
+	_, err := c.Stat("ns", "name")
+	require.Equal(ErrCircuitOpen, err)
+	require.Equal(0, client.calls)
+}
+
+func TestInjectedFaultsBypassClientClassifier(t *testing.T) {
+	require := require.New(t)
+
+	f := faultInjectorFixture(t, faults.Rule{
+		Target: ".*",
+		Action: faults.ActionFail,
+		Status: http.StatusNotFound,
+	})
+	c := injectFaults(&classifyingClient{}, f)
+
+	require.True(c.Retryable(errors.New("throttled")))
+
+	_, err := c.Stat("ns", "name")
+	require.Error(err)
+	require.False(c.Retryable(err))
+}
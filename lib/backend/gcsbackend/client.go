@@ -18,6 +18,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"net/http"
 	"path"
 
 	"github.com/uber/kraken/core"
@@ -27,6 +28,8 @@ import (
 	"github.com/uber/kraken/utils/log"
 
 	"cloud.google.com/go/storage"
+	"golang.org/x/oauth2"
+	"google.golang.org/api/googleapi"
 	"google.golang.org/api/iterator"
 	"google.golang.org/api/option"
 	"gopkg.in/yaml.v2"
@@ -69,6 +72,11 @@ type Client struct {
 	config Config
 	pather namepath.Pather
 	gcs    GCS
+
+	tokens             *rotatingTokenSource
+	newTokenSource     func(ctx context.Context, blob string) (oauth2.TokenSource, error)
+	credentialProvider backend.CredentialProvider
+	rotator            *backend.CredentialRotator
 }
 
 // Option allows setting optional Client parameters.
@@ -79,6 +87,13 @@ func WithGCS(gcs GCS) Option {
 	return func(c *Client) { c.gcs = gcs }
 }
 
+// WithCredentialProvider configures a Client to refresh its credentials from
+// provider, instead of from the credential rotation file. The provider must
+// return credentials in the format of UserAuthConfig.
+func WithCredentialProvider(provider backend.CredentialProvider) Option {
+	return func(c *Client) { c.credentialProvider = provider }
+}
+
 // NewClient creates a new Client for GCS.
 func NewClient(
 	config Config, userAuth UserAuthConfig, opts ...Option) (*Client, error) {
@@ -104,26 +119,47 @@ func NewClient(
 		return nil, errors.New("auth not configured for username")
 	}
 
-	if len(opts) > 0 {
-		// For mock.
-		client := &Client{config, pather, nil}
-		for _, opt := range opts {
-			opt(client)
-		}
-		return client, nil
+	client := &Client{
+		config:         config,
+		pather:         pather,
+		newTokenSource: jsonTokenSource,
+	}
+	for _, opt := range opts {
+		opt(client)
 	}
 
 	ctx := context.Background()
-	sClient, err := storage.NewClient(ctx,
-		option.WithCredentialsJSON([]byte(auth.GCS.AccessBlob)))
-	if err != nil {
-		return nil, fmt.Errorf("invalid gcs credentials: %s", err)
+	credsOpt := option.WithCredentialsJSON([]byte(auth.GCS.AccessBlob))
+	rotation := config.CredentialRotation.Enable || client.credentialProvider != nil
+	if rotation {
+		// Tokens are issued by a rotating source, such that credentials can be
+		// swapped without recreating the storage client.
+		ts, err := client.newTokenSource(ctx, auth.GCS.AccessBlob)
+		if err != nil {
+			return nil, fmt.Errorf("invalid gcs credentials: %s", err)
+		}
+		client.tokens = &rotatingTokenSource{ts: ts}
+		credsOpt = option.WithTokenSource(client.tokens)
 	}
 
-	client := &Client{config, pather,
-		NewGCS(ctx, sClient.Bucket(config.Bucket), &config)}
+	if client.gcs == nil {
+		sClient, err := storage.NewClient(ctx, credsOpt)
+		if err != nil {
+			return nil, fmt.Errorf("invalid gcs credentials: %s", err)
+		}
+		client.gcs = NewGCS(ctx, sClient, &config)
+		log.Infof("Initalized GCS backend with config: %s", config)
+	}
 
-	log.Infof("Initalized GCS backend with config: %s", config)
+	if rotation {
+		rotator, err := backend.NewCredentialRotator(
+			config.CredentialRotation, client.credentialProvider, client.rotate)
+		if err != nil {
+			return nil, fmt.Errorf("credential rotation: %s", err)
+		}
+		client.rotator = rotator
+		rotator.Start()
+	}
 	return client, nil
 }
 
@@ -157,6 +193,19 @@ func (c *Client) Download(namespace, name string, dst io.Writer) error {
 	return err
 }
 
+// DownloadRange downloads length bytes of name, starting at offset, into dst.
+func (c *Client) DownloadRange(
+	namespace, name string, offset, length int64, dst io.Writer) error {
+
+	path, err := c.pather.BlobPath(name)
+	if err != nil {
+		return fmt.Errorf("blob path: %s", err)
+	}
+
+	_, err = c.gcs.DownloadRange(path, offset, length, dst)
+	return err
+}
+
 // Upload uploads src to a configured bucket.
 func (c *Client) Upload(namespace, name string, src io.Reader) error {
 	path, err := c.pather.BlobPath(name)
@@ -168,6 +217,58 @@ func (c *Client) Upload(namespace, name string, src io.Reader) error {
 	return err
 }
 
+// UploadIfAbsent uploads src to a configured bucket unless name already exists.
+func (c *Client) UploadIfAbsent(namespace, name string, src io.Reader) error {
+	path, err := c.pather.BlobPath(name)
+	if err != nil {
+		return fmt.Errorf("blob path: %s", err)
+	}
+
+	_, err = c.gcs.UploadIfAbsent(path, src)
+	return err
+}
+
+// Retryable returns true if err is a throttling or server-side GCS error, or a
+// transient network error.
+func (c *Client) Retryable(err error) bool {
+	if e, ok := err.(*googleapi.Error); ok {
+		return backend.IsRetryableStatus(e.Code)
+	}
+	return backend.IsRetryable(err)
+}
+
+// Capabilities returns support for ranged downloads, conditional writes and
+// server-side copies.
+func (c *Client) Capabilities() backend.BackendCapabilities {
+	return backend.BackendCapabilities{Ranges: true, ConditionalWrites: true, ServerSideCopy: true}
+}
+
+// CanCopyFrom returns true if src is a GCS Client using the same credentials.
+func (c *Client) CanCopyFrom(src backend.Client) bool {
+	other, ok := src.(*Client)
+	return ok && other.config.Username == c.config.Username
+}
+
+// CopyFrom copies name from the bucket of src into the configured bucket
+// without transferring content through the client.
+func (c *Client) CopyFrom(src backend.Client, namespace, name string) error {
+	other, ok := src.(*Client)
+	if !ok || !c.CanCopyFrom(src) {
+		return errors.New("source is not in the same store")
+	}
+	srcPath, err := other.pather.BlobPath(name)
+	if err != nil {
+		return fmt.Errorf("source blob path: %s", err)
+	}
+	path, err := c.pather.BlobPath(name)
+	if err != nil {
+		return fmt.Errorf("blob path: %s", err)
+	}
+
+	_, err = c.gcs.Copy(other.config.Bucket, srcPath, path)
+	return err
+}
+
 // List lists names that start with prefix.
 func (c *Client) List(prefix string, opts ...backend.ListOption) (*backend.ListResult, error) {
 	options := backend.DefaultListOptions()
@@ -211,6 +312,13 @@ func (c *Client) List(prefix string, opts ...backend.ListOption) (*backend.ListR
 	return result, nil
 }
 
+// isPreconditionFailed is helper function for identify failed conditional
+// operation error.
+func isPreconditionFailed(err error) bool {
+	e, ok := err.(*googleapi.Error)
+	return ok && e.Code == http.StatusPreconditionFailed
+}
+
 // isObjectNotFound is helper function for identify non-existing object error.
 func isObjectNotFound(err error) bool {
 	return err == storage.ErrObjectNotExist || err == storage.ErrBucketNotExist
@@ -219,14 +327,15 @@ func isObjectNotFound(err error) bool {
 // GCSImpl implements GCS interaface.
 type GCSImpl struct {
 	ctx    context.Context
+	client *storage.Client
 	bucket *storage.BucketHandle
 	config *Config
 }
 
-func NewGCS(ctx context.Context, bucket *storage.BucketHandle,
+func NewGCS(ctx context.Context, client *storage.Client,
 	config *Config) *GCSImpl {
 
-	return &GCSImpl{ctx, bucket, config}
+	return &GCSImpl{ctx, client, client.Bucket(config.Bucket), config}
 }
 
 func (g *GCSImpl) ObjectAttrs(objectName string) (*storage.ObjectAttrs, error) {
@@ -252,8 +361,52 @@ func (g *GCSImpl) Download(objectName string, w io.Writer) (int64, error) {
 	return r, nil
 }
 
+func (g *GCSImpl) DownloadRange(
+	objectName string, offset, length int64, w io.Writer) (int64, error) {
+
+	rc, err := g.bucket.Object(objectName).NewRangeReader(g.ctx, offset, length)
+	if err != nil {
+		if isObjectNotFound(err) {
+			return 0, backenderrors.ErrBlobNotFound
+		}
+		return 0, err
+	}
+	defer rc.Close()
+
+	return io.Copy(w, rc)
+}
+
 func (g *GCSImpl) Upload(objectName string, r io.Reader) (int64, error) {
-	wc := g.bucket.Object(objectName).NewWriter(g.ctx)
+	return g.upload(g.bucket.Object(objectName), r)
+}
+
+// UploadIfAbsent uploads r into objectName with a precondition that the object
+// does not exist yet.
+func (g *GCSImpl) UploadIfAbsent(objectName string, r io.Reader) (int64, error) {
+	obj := g.bucket.Object(objectName).If(storage.Conditions{DoesNotExist: true})
+	w, err := g.upload(obj, r)
+	if isPreconditionFailed(err) {
+		return 0, backenderrors.ErrBlobExists
+	}
+	return w, err
+}
+
+// Copy rewrites srcObjectName of srcBucket into objectName within the store,
+// without transferring content through the client.
+func (g *GCSImpl) Copy(srcBucket, srcObjectName, objectName string) (int64, error) {
+	src := g.client.Bucket(srcBucket).Object(srcObjectName)
+	attrs, err := g.bucket.Object(objectName).CopierFrom(src).Run(g.ctx)
+	if err != nil {
+		if isObjectNotFound(err) {
+			return 0, backenderrors.ErrBlobNotFound
+		}
+		return 0, err
+	}
+	return attrs.Size, nil
+}
+
+func (g *GCSImpl) upload(obj *storage.ObjectHandle, r io.Reader) (int64, error) {
+	wc := obj.NewWriter(g.ctx)
 	wc.ChunkSize = int(g.config.UploadChunkSize)
 
 	w, err := io.CopyN(wc, r, int64(g.config.UploadChunkSize))
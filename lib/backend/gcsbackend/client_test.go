@@ -15,21 +15,29 @@ package gcsbackend
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"math/rand"
+	"net/http"
 	"strconv"
 	"strings"
+	"sync"
 	"testing"
 
 	"github.com/uber/kraken/core"
 	"github.com/uber/kraken/lib/backend"
+	"github.com/uber/kraken/lib/backend/backenderrors"
 	"github.com/uber/kraken/mocks/lib/backend/gcsbackend"
 	"github.com/uber/kraken/utils/mockutil"
 	"github.com/uber/kraken/utils/randutil"
 	"github.com/uber/kraken/utils/rwutil"
 
 	"cloud.google.com/go/storage"
+	"golang.org/x/oauth2"
+	"google.golang.org/api/googleapi"
 	"google.golang.org/api/iterator"
+	"gopkg.in/yaml.v2"
 
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/require"
@@ -88,6 +96,29 @@ func TestClientFactory(t *testing.T) {
 	require.True(strings.Contains(err.Error(), "invalid gcs credentials"))
 }
 
+func TestClientRetryable(t *testing.T) {
+	mocks, cleanup := newClientMocks(t)
+	defer cleanup()
+
+	client := mocks.new()
+
+	tests := []struct {
+		desc     string
+		err      error
+		expected bool
+	}{
+		{"forbidden", &googleapi.Error{Code: http.StatusForbidden}, false},
+		{"too many requests", &googleapi.Error{Code: http.StatusTooManyRequests}, true},
+		{"service unavailable", &googleapi.Error{Code: http.StatusServiceUnavailable}, true},
+		{"not found", backenderrors.ErrBlobNotFound, false},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			require.Equal(t, test.expected, client.Retryable(test.err))
+		})
+	}
+}
+
 func TestClientStat(t *testing.T) {
 	require := require.New(t)
 
@@ -125,6 +156,27 @@ func TestClientDownload(t *testing.T) {
 	require.Equal(data, []byte(w))
 }
 
+func TestClientDownloadRange(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newClientMocks(t)
+	defer cleanup()
+
+	client := mocks.new()
+	data := randutil.Text(32)
+
+	mocks.gcs.EXPECT().DownloadRange(
+		"/root/test",
+		int64(8),
+		int64(16),
+		mockutil.MatchWriter(data[8:24]),
+	).Return(int64(16), nil)
+
+	w := make(rwutil.PlainWriter, 16)
+	require.NoError(client.DownloadRange(core.NamespaceFixture(), "test", 8, 16, w))
+	require.Equal(data[8:24], []byte(w))
+}
+
 func TestClientUpload(t *testing.T) {
 	require := require.New(t)
 
@@ -144,6 +196,67 @@ func TestClientUpload(t *testing.T) {
 	require.NoError(client.Upload(core.NamespaceFixture(), "test", dataReader))
 }
 
+func TestClientUploadIfAbsent(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newClientMocks(t)
+	defer cleanup()
+
+	client := mocks.new()
+
+	data := randutil.Text(32)
+
+	mocks.gcs.EXPECT().UploadIfAbsent(
+		"/root/test",
+		gomock.Any(),
+	).Return(int64(0), backenderrors.ErrBlobExists)
+
+	require.Equal(
+		backenderrors.ErrBlobExists,
+		client.UploadIfAbsent(core.NamespaceFixture(), "test", bytes.NewReader(data)))
+	require.True(client.Capabilities().ConditionalWrites)
+}
+
+func TestClientCopyFrom(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newClientMocks(t)
+	defer cleanup()
+
+	client := mocks.new()
+
+	srcMocks, srcCleanup := newClientMocks(t)
+	defer srcCleanup()
+	srcMocks.config.Bucket = "source-bucket"
+	srcMocks.config.RootDirectory = "/source"
+	src := srcMocks.new()
+
+	mocks.gcs.EXPECT().Copy("source-bucket", "/source/test", "/root/test").Return(int64(32), nil)
+
+	require.True(client.Capabilities().ServerSideCopy)
+	require.True(client.CanCopyFrom(src))
+	require.NoError(client.CopyFrom(src, core.NamespaceFixture(), "test"))
+}
+
+func TestClientCannotCopyFromOtherCredentials(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newClientMocks(t)
+	defer cleanup()
+
+	client := mocks.new()
+
+	srcMocks, srcCleanup := newClientMocks(t)
+	defer srcCleanup()
+	srcMocks.config.Username = "other-user"
+	srcMocks.userAuth["other-user"] = srcMocks.userAuth["test-user"]
+	src := srcMocks.new()
+
+	require.False(client.CanCopyFrom(src))
+	require.False(client.CanCopyFrom(backend.NoopClient{}))
+	require.Error(client.CopyFrom(src, core.NamespaceFixture(), "test"))
+}
+
 func Alphabets(t *testing.T, maxIterate int) *AlphaIterator {
 	it := &AlphaIterator{assert: require.New(t), maxIterate: maxIterate}
 	it.pageInfo, it.nextFunc = iterator.NewPageInfo(
@@ -223,3 +336,114 @@ func TestClientList(t *testing.T) {
 	}
 	require.Equal(contToken, "")
 }
+
+type staticTokenSource string
+
+func (s staticTokenSource) Token() (*oauth2.Token, error) {
+	return &oauth2.Token{AccessToken: string(s)}, nil
+}
+
+// withTokenSources configures a Client to issue blobs as tokens, rejecting
+// blobs listed in invalid.
+func withTokenSources(invalid ...string) Option {
+	return func(c *Client) {
+		c.newTokenSource = func(_ context.Context, blob string) (oauth2.TokenSource, error) {
+			for _, b := range invalid {
+				if blob == b {
+					return nil, errors.New("invalid blob")
+				}
+			}
+			return staticTokenSource(blob), nil
+		}
+	}
+}
+
+func gcsAuth(t *testing.T, blob string) []byte {
+	var auth AuthConfig
+	auth.GCS.AccessBlob = blob
+	b, err := yaml.Marshal(UserAuthConfig{"test-user": auth})
+	require.NoError(t, err)
+	return b
+}
+
+func TestClientRotatesCredentialsWithoutFailingConcurrentOperations(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newClientMocks(t)
+	defer cleanup()
+
+	var mu sync.Mutex
+	current := gcsAuth(t, "access_blob")
+	provider := func() ([]byte, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		return current, nil
+	}
+
+	client, err := NewClient(
+		mocks.config, mocks.userAuth,
+		WithGCS(mocks.gcs), withTokenSources(), WithCredentialProvider(provider))
+	require.NoError(err)
+	defer client.rotator.Stop()
+
+	stop := make(chan struct{})
+	errc := make(chan error, 8)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				token, err := client.tokens.Token()
+				if err == nil && token.AccessToken != "access_blob" && token.AccessToken != "new_blob" {
+					err = fmt.Errorf("unexpected token %q", token.AccessToken)
+				}
+				if err != nil {
+					errc <- err
+					return
+				}
+			}
+		}()
+	}
+
+	mu.Lock()
+	current = gcsAuth(t, "new_blob")
+	mu.Unlock()
+	require.NoError(client.rotator.Refresh())
+
+	token, err := client.tokens.Token()
+	require.NoError(err)
+	require.Equal("new_blob", token.AccessToken)
+
+	close(stop)
+	wg.Wait()
+	close(errc)
+	for err := range errc {
+		require.NoError(err)
+	}
+}
+
+func TestClientKeepsCredentialsWhichFailValidation(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newClientMocks(t)
+	defer cleanup()
+
+	client, err := NewClient(
+		mocks.config, mocks.userAuth,
+		WithGCS(mocks.gcs), withTokenSources("new_blob"),
+		WithCredentialProvider(func() ([]byte, error) { return nil, errors.New("unavailable") }))
+	require.NoError(err)
+	defer client.rotator.Stop()
+
+	require.Error(client.rotate(gcsAuth(t, "new_blob")))
+
+	token, err := client.tokens.Token()
+	require.NoError(err)
+	require.Equal("access_blob", token.AccessToken)
+}
@@ -38,6 +38,9 @@ type Config struct {
 
 	// NamePath identifies which namepath.Pather to use.
 	NamePath string `yaml:"name_path"`
+
+	// CredentialRotation refreshes the credentials of Username at runtime.
+	CredentialRotation backend.CredentialRotationConfig `yaml:"credential_rotation"`
 }
 
 // UserAuthConfig defines authentication configuration overlayed by Langley.
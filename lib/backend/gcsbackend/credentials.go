@@ -0,0 +1,78 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package gcsbackend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"cloud.google.com/go/storage"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+	"gopkg.in/yaml.v2"
+)
+
+// rotatingTokenSource is an oauth2.TokenSource whose underlying credentials can
+// be swapped at runtime. Requests which already hold a token keep using it.
+type rotatingTokenSource struct {
+	mu sync.RWMutex
+	ts oauth2.TokenSource
+}
+
+// Token returns a token of the current credentials.
+func (r *rotatingTokenSource) Token() (*oauth2.Token, error) {
+	r.mu.RLock()
+	ts := r.ts
+	r.mu.RUnlock()
+	return ts.Token()
+}
+
+func (r *rotatingTokenSource) swap(ts oauth2.TokenSource) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.ts = ts
+}
+
+// jsonTokenSource returns a TokenSource of the JSON credentials in blob.
+func jsonTokenSource(ctx context.Context, blob string) (oauth2.TokenSource, error) {
+	creds, err := google.CredentialsFromJSON(ctx, []byte(blob), storage.ScopeFullControl)
+	if err != nil {
+		return nil, err
+	}
+	return creds.TokenSource, nil
+}
+
+// rotate parses the credentials of the configured username from b, and swaps
+// them in once a token was successfully issued for them.
+func (c *Client) rotate(b []byte) error {
+	var userAuth UserAuthConfig
+	if err := yaml.Unmarshal(b, &userAuth); err != nil {
+		return fmt.Errorf("unmarshal gcs auth config: %s", err)
+	}
+	auth, ok := userAuth[c.config.Username]
+	if !ok {
+		return errors.New("auth not configured for username")
+	}
+	ts, err := c.newTokenSource(context.Background(), auth.GCS.AccessBlob)
+	if err != nil {
+		return fmt.Errorf("invalid gcs credentials: %s", err)
+	}
+	if _, err := ts.Token(); err != nil {
+		return fmt.Errorf("validate: %s", err)
+	}
+	c.tokens.swap(ts)
+	return nil
+}
@@ -166,6 +166,11 @@ func (c *Client) sendAll(done <-chan struct{}, dirs []string, listJobs chan<- st
 	}
 }
 
+// Capabilities returns no optional features.
+func (c *Client) Capabilities() backend.BackendCapabilities {
+	return backend.BackendCapabilities{}
+}
+
 // List lists names which start with prefix.
 func (c *Client) List(prefix string, opts ...backend.ListOption) (*backend.ListResult, error) {
 	options := backend.DefaultListOptions()
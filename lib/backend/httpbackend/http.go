@@ -15,9 +15,12 @@ package httpbackend
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io"
+	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/uber/kraken/core"
@@ -59,11 +62,16 @@ type Config struct {
 	DownloadURL     string                            `yaml:"download_url"` // http download get url
 	DownloadTimeout time.Duration                     `yaml:"download_timeout"`
 	DownloadBackOff httputil.ExponentialBackOffConfig `yaml:"download_backoff"`
+
+	// Ranges declares that the download url serves byte ranges and reports the
+	// size of blobs, such that blobs may be downloaded in concurrent ranges.
+	Ranges bool `yaml:"ranges"`
 }
 
 // Client implements downloading/uploading object from/to S3
 type Client struct {
 	config Config
+	ctx    context.Context
 }
 
 func (c Config) applyDefaults() Config {
@@ -75,27 +83,64 @@ func (c Config) applyDefaults() Config {
 
 // NewClient creates a new http Client.
 func NewClient(config Config) (*Client, error) {
-	return &Client{config: config.applyDefaults()}, nil
+	return &Client{config: config.applyDefaults(), ctx: context.Background()}, nil
+}
+
+// BindContext returns a Client whose requests are cancelled once ctx is done.
+func (c *Client) BindContext(ctx context.Context) backend.Client {
+	return &Client{c.config, ctx}
 }
 
-// Stat always succeeds.
+// Stat always succeeds, unless ranges are enabled, in which case the size of
+// name is read from the download url.
 // TODO(codyg): Support stat URL.
 func (c *Client) Stat(namespace, name string) (*core.BlobInfo, error) {
-	return core.NewBlobInfo(0), nil
+	if !c.config.Ranges {
+		return core.NewBlobInfo(0), nil
+	}
+	u, err := c.downloadURL(name)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := httputil.Head(
+		u,
+		httputil.SendTimeout(c.config.DownloadTimeout),
+		httputil.SendRetry(httputil.RetryBackoff(c.config.DownloadBackOff.Build())),
+		httputil.SendContext(c.ctx))
+	if err != nil {
+		if httputil.IsNotFound(err) {
+			return nil, backenderrors.ErrBlobNotFound
+		}
+		return nil, err
+	}
+	size, err := strconv.ParseInt(resp.Header.Get("Content-Length"), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("parse content length: %s", err)
+	}
+	return core.NewBlobInfo(size), nil
 }
 
-// Download downloads the content from a configured url and writes the data
-// to dst.
-func (c *Client) Download(namespace, name string, dst io.Writer) error {
+func (c *Client) downloadURL(name string) (string, error) {
 	// Use Fprintf instead of Sprintf to handle formatting errors.
 	var b bytes.Buffer
 	if _, err := fmt.Fprintf(&b, c.config.DownloadURL, name); err != nil {
-		return fmt.Errorf("format url: %s", err)
+		return "", fmt.Errorf("format url: %s", err)
+	}
+	return b.String(), nil
+}
+
+// Download downloads the content from a configured url and writes the data
+// to dst.
+func (c *Client) Download(namespace, name string, dst io.Writer) error {
+	u, err := c.downloadURL(name)
+	if err != nil {
+		return err
 	}
 	resp, err := httputil.Get(
-		b.String(),
+		u,
 		httputil.SendTimeout(c.config.DownloadTimeout),
-		httputil.SendRetry(httputil.RetryBackoff(c.config.DownloadBackOff.Build())))
+		httputil.SendRetry(httputil.RetryBackoff(c.config.DownloadBackOff.Build())),
+		httputil.SendContext(c.ctx))
 	if err != nil {
 		if httputil.IsNotFound(err) {
 			return backenderrors.ErrBlobNotFound
@@ -114,6 +159,43 @@ func (c *Client) Upload(namespace, name string, src io.Reader) error {
 	return errors.New("not supported")
 }
 
+// DownloadRange downloads length bytes of name, starting at offset, into dst.
+// Servers which ignore the range and respond with the whole blob fail the
+// download.
+func (c *Client) DownloadRange(
+	namespace, name string, offset, length int64, dst io.Writer) error {
+
+	u, err := c.downloadURL(name)
+	if err != nil {
+		return err
+	}
+	resp, err := httputil.Get(
+		u,
+		httputil.SendHeaders(map[string]string{
+			"Range": fmt.Sprintf("bytes=%d-%d", offset, offset+length-1),
+		}),
+		httputil.SendAcceptedCodes(http.StatusPartialContent),
+		httputil.SendTimeout(c.config.DownloadTimeout),
+		httputil.SendRetry(httputil.RetryBackoff(c.config.DownloadBackOff.Build())),
+		httputil.SendContext(c.ctx))
+	if err != nil {
+		if httputil.IsNotFound(err) {
+			return backenderrors.ErrBlobNotFound
+		}
+		return err
+	}
+	defer resp.Body.Close()
+	if _, err := io.Copy(dst, resp.Body); err != nil {
+		return fmt.Errorf("copy: %s", err)
+	}
+	return nil
+}
+
+// Capabilities returns support for ranged downloads if ranges are enabled.
+func (c *Client) Capabilities() backend.BackendCapabilities {
+	return backend.BackendCapabilities{Ranges: c.config.Ranges}
+}
+
 // List is not supported.
 func (c *Client) List(prefix string, opts ...backend.ListOption) (*backend.ListResult, error) {
 	return nil, errors.New("not supported")
@@ -18,6 +18,7 @@ import (
 	"io"
 	"net/http"
 	"testing"
+	"time"
 
 	"github.com/uber/kraken/core"
 	"github.com/uber/kraken/lib/backend/backenderrors"
@@ -93,3 +94,53 @@ func TestDownloadMalformedURLThrowsError(t *testing.T) {
 	var b bytes.Buffer
 	require.Error(client.Download(core.NamespaceFixture(), "data", &b))
 }
+
+func TestHttpDownloadRange(t *testing.T) {
+	require := require.New(t)
+
+	blob := randutil.Blob(32 * memsize.KB)
+
+	r := chi.NewRouter()
+	r.Get("/data/{blob}", func(w http.ResponseWriter, req *http.Request) {
+		http.ServeContent(w, req, "", time.Time{}, bytes.NewReader(blob))
+	})
+	r.Head("/data/{blob}", func(w http.ResponseWriter, req *http.Request) {
+		http.ServeContent(w, req, "", time.Time{}, bytes.NewReader(blob))
+	})
+	addr, stop := testutil.StartServer(r)
+	defer stop()
+
+	config := Config{DownloadURL: "http://" + addr + "/data/%s", Ranges: true}
+	client, err := NewClient(config)
+	require.NoError(err)
+	require.True(client.Capabilities().Ranges)
+
+	bi, err := client.Stat(core.NamespaceFixture(), "data")
+	require.NoError(err)
+	require.Equal(int64(len(blob)), bi.Size)
+
+	var b bytes.Buffer
+	require.NoError(client.DownloadRange(core.NamespaceFixture(), "data", 100, 200, &b))
+	require.Equal(blob[100:300], b.Bytes())
+}
+
+func TestHttpDownloadRangeFailsIfServerIgnoresRange(t *testing.T) {
+	require := require.New(t)
+
+	blob := randutil.Blob(32 * memsize.KB)
+
+	r := chi.NewRouter()
+	r.Get("/data/{blob}", func(w http.ResponseWriter, req *http.Request) {
+		_, err := io.Copy(w, bytes.NewReader(blob))
+		require.NoError(err)
+	})
+	addr, stop := testutil.StartServer(r)
+	defer stop()
+
+	config := Config{DownloadURL: "http://" + addr + "/data/%s", Ranges: true}
+	client, err := NewClient(config)
+	require.NoError(err)
+
+	var b bytes.Buffer
+	require.Error(client.DownloadRange(core.NamespaceFixture(), "data", 100, 200, &b))
+}
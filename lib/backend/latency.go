@@ -0,0 +1,273 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package backend
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/metrics"
+	"github.com/uber/kraken/utils/log"
+
+	"github.com/uber-go/tally"
+	"go.uber.org/atomic"
+)
+
+// LatencyConfig defines latency instrumentation of backend operations. When
+// enabled, latency histograms are emitted for each operation type, and any
+// operation exceeding the threshold for its type is logged.
+type LatencyConfig struct {
+	Enable bool `yaml:"enable"`
+
+	SlowUpload   time.Duration `yaml:"slow_upload"`
+	SlowDownload time.Duration `yaml:"slow_download"`
+	SlowStat     time.Duration `yaml:"slow_stat"`
+	SlowList     time.Duration `yaml:"slow_list"`
+}
+
+func (c LatencyConfig) applyDefaults() LatencyConfig {
+	if c.SlowUpload == 0 {
+		c.SlowUpload = time.Minute
+	}
+	if c.SlowDownload == 0 {
+		c.SlowDownload = time.Minute
+	}
+	if c.SlowStat == 0 {
+		c.SlowStat = 5 * time.Second
+	}
+	if c.SlowList == 0 {
+		c.SlowList = 30 * time.Second
+	}
+	return c
+}
+
+var _latencyBuckets = tally.MustMakeExponentialDurationBuckets(time.Millisecond, 2, 20)
+
+// instrumentedClient records the latency of every operation of the wrapped
+// client, and logs operations exceeding their slow threshold.
+type instrumentedClient struct {
+	Client
+	config    LatencyConfig
+	buckets   map[string]tally.Buckets
+	stats     tally.Scope
+	backend   string
+	namespace string
+}
+
+func instrument(
+	client Client,
+	config LatencyConfig,
+	histograms metrics.HistogramsConfig,
+	stats tally.Scope,
+	backend string,
+	namespace string) *instrumentedClient {
+
+	stats = stats.Tagged(map[string]string{
+		"backend": backend,
+	})
+	buckets := map[string]tally.Buckets{
+		"upload":   metrics.DurationBuckets(histograms.BackendUpload, _latencyBuckets),
+		"download": metrics.DurationBuckets(histograms.BackendDownload, _latencyBuckets),
+	}
+	return &instrumentedClient{client, config.applyDefaults(), buckets, stats, backend, namespace}
+}
+
+// BindContext binds the wrapped client to ctx.
+func (c *instrumentedClient) BindContext(ctx context.Context) Client {
+	bound := *c
+	bound.Client = bindContext(ctx, c.Client)
+	return &bound
+}
+
+func (c *instrumentedClient) observe(
+	op string, threshold time.Duration, start time.Time, name string, bytes int64, err error) {
+
+	t := time.Since(start)
+	buckets, ok := c.buckets[op]
+	if !ok {
+		buckets = _latencyBuckets
+	}
+	c.stats.Tagged(map[string]string{
+		"operation": op,
+	}).Histogram("latency", buckets).RecordDuration(t)
+
+	if t < threshold {
+		return
+	}
+	fields := []interface{}{
+		"operation", op,
+		"backend", c.backend,
+		"namespace", c.namespace,
+		"name", name,
+		"duration", t,
+	}
+	if bytes >= 0 {
+		fields = append(fields, "bytes", bytes)
+	}
+	if err != nil {
+		fields = append(fields, "error", err)
+	}
+	log.With(fields...).Warn("Slow backend operation")
+}
+
+// Stat returns blob info for name.
+func (c *instrumentedClient) Stat(namespace, name string) (*core.BlobInfo, error) {
+	start := time.Now()
+	info, err := c.Client.Stat(namespace, name)
+	var size int64
+	if info != nil {
+		size = info.Size
+	}
+	c.observe("stat", c.config.SlowStat, start, name, size, err)
+	return info, err
+}
+
+// Upload uploads src into name.
+func (c *instrumentedClient) Upload(namespace, name string, src io.Reader) error {
+	// Some clients upcast src (e.g. to io.ReadSeeker), so src cannot be wrapped
+	// to count bytes.
+	size := int64(-1)
+	switch r := src.(type) {
+	case sizer:
+		size = r.Size()
+	case interface{ Len() int }:
+		size = int64(r.Len())
+	}
+	start := time.Now()
+	err := c.Client.Upload(namespace, name, src)
+	c.observe("upload", c.config.SlowUpload, start, name, size, err)
+	return err
+}
+
+// Download downloads name into dst.
+func (c *instrumentedClient) Download(namespace, name string, dst io.Writer) error {
+	w := newCountingWriter(dst)
+	start := time.Now()
+	err := c.Client.Download(namespace, name, w)
+	c.observe("download", c.config.SlowDownload, start, name, w.count(), err)
+	return err
+}
+
+// List lists entries whose names start with prefix.
+func (c *instrumentedClient) List(prefix string, opts ...ListOption) (*ListResult, error) {
+	start := time.Now()
+	result, err := c.Client.List(prefix, opts...)
+	c.observe("list", c.config.SlowList, start, prefix, -1, err)
+	return result, err
+}
+
+// DownloadRange downloads length bytes of name, starting at offset, into dst.
+func (c *instrumentedClient) DownloadRange(
+	namespace, name string, offset, length int64, dst io.Writer) error {
+
+	w := newCountingWriter(dst)
+	start := time.Now()
+	err := downloadRange(c.Client, namespace, name, offset, length, w)
+	c.observe("download_range", c.config.SlowDownload, start, name, w.count(), err)
+	return err
+}
+
+// UploadIfAbsent uploads src into name if name does not exist.
+func (c *instrumentedClient) UploadIfAbsent(namespace, name string, src io.Reader) error {
+	start := time.Now()
+	err := uploadIfAbsent(c.Client, namespace, name, src)
+	c.observe("upload_if_absent", c.config.SlowUpload, start, name, -1, err)
+	return err
+}
+
+// CanCopyFrom returns true if the wrapped client can copy from src.
+func (c *instrumentedClient) CanCopyFrom(src Client) bool {
+	return canCopyFrom(c.Client, src)
+}
+
+// CopyFrom copies name from src into name.
+func (c *instrumentedClient) CopyFrom(src Client, namespace, name string) error {
+	start := time.Now()
+	err := copyFrom(c.Client, src, namespace, name)
+	c.observe("copy", c.config.SlowUpload, start, name, -1, err)
+	return err
+}
+
+// SignedURL returns a URL through which name may be downloaded until ttl
+// elapses.
+func (c *instrumentedClient) SignedURL(namespace, name string, ttl time.Duration) (string, error) {
+	return signedURL(c.Client, namespace, name, ttl)
+}
+
+// Delete deletes name.
+func (c *instrumentedClient) Delete(namespace, name string) error {
+	start := time.Now()
+	err := deleteBlob(c.Client, namespace, name)
+	c.observe("delete", c.config.SlowUpload, start, name, -1, err)
+	return err
+}
+
+// Capabilities returns the optional features of the wrapped client.
+func (c *instrumentedClient) Capabilities() BackendCapabilities {
+	return c.Client.Capabilities()
+}
+
+// Unwrap returns the wrapped client.
+func (c *instrumentedClient) Unwrap() Client {
+	return c.Client
+}
+
+type countingWriter interface {
+	io.Writer
+	count() int64
+}
+
+func newCountingWriter(dst io.Writer) countingWriter {
+	// Some clients upcast dst to io.WriterAt for concurrent chunked downloads,
+	// which must be preserved.
+	if wa, ok := dst.(io.WriterAt); ok {
+		return &countingWriterAt{w: dst, wa: wa, n: atomic.NewInt64(0)}
+	}
+	return &countingPlainWriter{w: dst, n: atomic.NewInt64(0)}
+}
+
+type countingPlainWriter struct {
+	w io.Writer
+	n *atomic.Int64
+}
+
+func (w *countingPlainWriter) Write(b []byte) (int, error) {
+	n, err := w.w.Write(b)
+	w.n.Add(int64(n))
+	return n, err
+}
+
+func (w *countingPlainWriter) count() int64 { return w.n.Load() }
+
+type countingWriterAt struct {
+	w  io.Writer
+	wa io.WriterAt
+	n  *atomic.Int64
+}
+
+func (w *countingWriterAt) Write(b []byte) (int, error) {
+	n, err := w.w.Write(b)
+	w.n.Add(int64(n))
+	return n, err
+}
+
+func (w *countingWriterAt) WriteAt(b []byte, off int64) (int, error) {
+	n, err := w.wa.WriteAt(b, off)
+	w.n.Add(int64(n))
+	return n, err
+}
+
+func (w *countingWriterAt) count() int64 { return w.n.Load() }
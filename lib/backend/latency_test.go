@@ -0,0 +1,145 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package backend_test
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/uber/kraken/lib/backend"
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/backend/namepath"
+	"github.com/uber/kraken/lib/backend/testfs"
+	"github.com/uber/kraken/metrics"
+	"github.com/uber/kraken/utils/log"
+	"github.com/uber/kraken/utils/testutil"
+
+	"github.com/stretchr/testify/require"
+	"github.com/uber-go/tally"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestManagerLatencySlowLog(t *testing.T) {
+	require := require.New(t)
+
+	obs, logs := observer.New(zapcore.WarnLevel)
+	defer log.SetGlobalLogger(log.Default())
+	log.SetGlobalLogger(zap.New(obs).Sugar())
+
+	s := testfs.NewServer()
+	defer s.Cleanup()
+
+	// Inject latency into downloads only.
+	h := s.Handler()
+	addr, stop := testutil.StartServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/files/") {
+			time.Sleep(100 * time.Millisecond)
+		}
+		h.ServeHTTP(w, r)
+	}))
+	defer stop()
+
+	stats := tally.NewTestScope("", nil)
+
+	m, err := NewManager([]Config{{
+		Namespace: ".*",
+		Latency: LatencyConfig{
+			Enable:       true,
+			SlowUpload:   time.Hour,
+			SlowDownload: 50 * time.Millisecond,
+		},
+		Backend: map[string]interface{}{
+			"testfs": testfs.Config{Addr: addr, NamePath: namepath.Identity},
+		},
+	}}, AuthConfig{}, stats)
+	require.NoError(err)
+
+	c, err := m.GetClient("foo")
+	require.NoError(err)
+
+	blob := core.NewBlobFixture()
+	require.NoError(c.Upload("foo", "bar", bytes.NewReader(blob.Content)))
+	require.Zero(logs.Len())
+
+	var b bytes.Buffer
+	require.NoError(c.Download("foo", "bar", &b))
+
+	entries := logs.FilterMessage("Slow backend operation").All()
+	require.Len(entries, 1)
+	fields := entries[0].ContextMap()
+	require.Equal("download", fields["operation"])
+	require.Equal("testfs", fields["backend"])
+	require.Equal(".*", fields["namespace"])
+	require.Equal("bar", fields["name"])
+	require.Equal(int64(len(blob.Content)), fields["bytes"])
+
+	var ops []string
+	for _, hist := range stats.Snapshot().Histograms() {
+		if hist.Name() == "latency" {
+			ops = append(ops, hist.Tags()["operation"])
+		}
+	}
+	require.ElementsMatch([]string{"upload", "download"}, ops)
+}
+
+func TestManagerLatencyConfiguredBuckets(t *testing.T) {
+	require := require.New(t)
+
+	s := testfs.NewServer()
+	defer s.Cleanup()
+
+	addr, stop := testutil.StartServer(s.Handler())
+	defer stop()
+
+	stats := tally.NewTestScope("", nil)
+
+	downloadBuckets := []time.Duration{time.Millisecond, 10 * time.Millisecond, time.Second}
+
+	m, err := NewManager([]Config{{
+		Namespace: ".*",
+		Latency:   LatencyConfig{Enable: true},
+		Backend: map[string]interface{}{
+			"testfs": testfs.Config{Addr: addr, NamePath: namepath.Identity},
+		},
+	}}, AuthConfig{}, stats, WithHistograms(metrics.HistogramsConfig{
+		BackendDownload: downloadBuckets,
+	}))
+	require.NoError(err)
+
+	c, err := m.GetClient("foo")
+	require.NoError(err)
+
+	blob := core.NewBlobFixture()
+	require.NoError(c.Upload("foo", "bar", bytes.NewReader(blob.Content)))
+	var b bytes.Buffer
+	require.NoError(c.Download("foo", "bar", &b))
+
+	buckets := make(map[string]map[time.Duration]int64)
+	for _, hist := range stats.Snapshot().Histograms() {
+		buckets[hist.Tags()["operation"]] = hist.Durations()
+	}
+	require.Len(buckets, 2)
+
+	// Downloads use the configured buckets, uploads keep the defaults.
+	require.Len(buckets["download"], len(downloadBuckets)+1)
+	for _, d := range downloadBuckets {
+		require.Contains(buckets["download"], d)
+	}
+	require.True(len(buckets["upload"]) > len(downloadBuckets)+1)
+}
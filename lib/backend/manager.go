@@ -18,8 +18,13 @@ import (
 	"fmt"
 	"regexp"
 
+	"github.com/uber/kraken/lib/faults"
+	"github.com/uber/kraken/metrics"
 	"github.com/uber/kraken/utils/bandwidth"
 	"github.com/uber/kraken/utils/log"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/uber-go/tally"
 )
 
 // Manager errors.
@@ -45,30 +50,101 @@ func newBackend(namespace string, c Client) (*backend, error) {
 
 // Manager manages backend clients for namespace regular expressions.
 type Manager struct {
-	backends []*backend
+	backends  []*backend
+	scheduler *fairScheduler
+
+	// Backends of the old store of a dual-write, if enabled.
+	old         *Manager
+	dualPrimary string
+}
+
+// ManagerOption allows setting optional Manager parameters.
+type ManagerOption func(*managerOptions)
+
+type managerOptions struct {
+	writeFairness WriteFairnessConfig
+	dualWrite     DualWriteConfig
+	faults        *faults.Injector
+	histograms    metrics.HistogramsConfig
+}
+
+// WithWriteFairness configures the Manager to share upload concurrency across
+// namespaces according to config.
+func WithWriteFairness(config WriteFairnessConfig) ManagerOption {
+	return func(o *managerOptions) { o.writeFairness = config }
+}
+
+// WithFaultInjector configures the Manager to inject faults of f into backend
+// operations, for chaos testing. Does nothing if f is nil.
+func WithFaultInjector(f *faults.Injector) ManagerOption {
+	return func(o *managerOptions) { o.faults = f }
+}
+
+// WithHistograms configures the buckets of the latency histograms of
+// instrumented backends.
+func WithHistograms(config metrics.HistogramsConfig) ManagerOption {
+	return func(o *managerOptions) { o.histograms = config }
 }
 
 // NewManager creates a new backend Manager.
-func NewManager(configs []Config, auth AuthConfig) (*Manager, error) {
-	var backends []*backend
-	for _, config := range configs {
-		config = config.applyDefaults()
-		var c Client
+func NewManager(
+	configs []Config, auth AuthConfig, stats tally.Scope, opts ...ManagerOption) (*Manager, error) {
 
-		if len(config.Backend) != 1 {
-			return nil, fmt.Errorf("no backend or more than one backend configured")
+	stats = stats.Tagged(map[string]string{
+		"module": "backend",
+	})
+
+	var o managerOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	m := &Manager{}
+	if o.writeFairness.Enable {
+		s, err := newFairScheduler(o.writeFairness, stats)
+		if err != nil {
+			return nil, fmt.Errorf("write fairness: %s", err)
 		}
-		var name string
-		var backendConfig interface{}
-		for name, backendConfig = range config.Backend { // Pull the only key/value out of map
+		m.scheduler = s
+	}
+	if o.dualWrite.Enable {
+		config := o.dualWrite.applyDefaults()
+		if config.Primary != PrimaryNew && config.Primary != PrimaryOld {
+			return nil, fmt.Errorf("invalid dual write primary: %s", config.Primary)
 		}
-		factory, err := getFactory(name)
+		old, err := NewManager(config.OldBackends, auth, stats, WithHistograms(o.histograms))
 		if err != nil {
-			return nil, fmt.Errorf("get backend client factory: %s", err)
+			return nil, fmt.Errorf("dual write old backends: %s", err)
 		}
-		c, err = factory.Create(backendConfig, auth[name])
+		m.old = old
+		m.dualPrimary = config.Primary
+	}
+
+	for _, config := range configs {
+		config = config.applyDefaults()
+		name, c, err := o.createStoreClient(config.Backend, config, auth, stats, "")
 		if err != nil {
-			return nil, fmt.Errorf("create backend client: %s", err)
+			return nil, err
+		}
+
+		if m.scheduler != nil {
+			// Queued within throttling, such that upload slots are not held
+			// while waiting on bandwidth reservations.
+			c = fair(c, m.scheduler)
+		}
+
+		if config.ReadReplica.Enable {
+			// Composed within throttling, such that replica reads share the
+			// bandwidth of the namespace. Replicas hold the same encrypted
+			// objects as the primary, and are retried and short-circuited
+			// like it.
+			_, replica, err := o.createStoreClient(
+				config.ReadReplica.Backend, config, auth, stats, "_replica")
+			if err != nil {
+				return nil, fmt.Errorf("read replica: %s", err)
+			}
+			c = NewReadReplicaClient(c, replica, config.ReadReplica, clock.New(), stats.Tagged(map[string]string{
+				"backend": name,
+			}))
 		}
 
 		if config.Bandwidth.Enable {
@@ -82,9 +158,87 @@ func NewManager(configs []Config, auth AuthConfig) (*Manager, error) {
 		if err != nil {
 			return nil, fmt.Errorf("new backend for namespace %s: %s", config.Namespace, err)
 		}
-		backends = append(backends, b)
+		m.backends = append(m.backends, b)
 	}
-	return &Manager{backends}, nil
+	return m, nil
+}
+
+// createStoreClient creates the client of the only backend configured in
+// backends, wrapped according to config. Metrics are tagged by the name of the
+// backend followed by suffix.
+func (o *managerOptions) createStoreClient(
+	backends map[string]interface{},
+	config Config,
+	auth AuthConfig,
+	stats tally.Scope,
+	suffix string) (string, Client, error) {
+
+	name, c, err := createClient(backends, auth)
+	if err != nil {
+		return "", nil, err
+	}
+	tag := name + suffix
+
+	if config.Encryption.Enable {
+		// Encrypted at the boundary of the store, such that every other
+		// wrapper operates on plaintext.
+		c, err = NewEncryptedClient(c, config.Encryption)
+		if err != nil {
+			return "", nil, fmt.Errorf("encryption: %s", err)
+		}
+	}
+
+	if o.faults != nil {
+		// Injected innermost, such that faults exercise retries and
+		// breakers like genuine backend failures.
+		c = injectFaults(c, o.faults)
+	}
+
+	if config.Retry.Enable {
+		if err := config.Retry.Jitter.Validate(); err != nil {
+			return "", nil, fmt.Errorf("retry: %s", err)
+		}
+		// Retried innermost, such that errors are classified by the
+		// backend client itself, and breakers only see final results.
+		c = withRetries(c, config.Retry, stats.Tagged(map[string]string{
+			"backend": tag,
+		}))
+	}
+
+	if config.Latency.Enable {
+		// Instrumented before throttling, such that time spent waiting on
+		// bandwidth reservations is not attributed to the backend.
+		c = instrument(c, config.Latency, o.histograms, stats, tag, config.Namespace)
+	}
+
+	if config.CircuitBreaker.Enable {
+		// Short-circuited ahead of fair queuing, such that operations
+		// which would be rejected do not wait for upload slots.
+		c = withBreakers(c, config.CircuitBreaker, clock.New(), stats.Tagged(map[string]string{
+			"backend": tag,
+		}))
+	}
+	return name, c, nil
+}
+
+// createClient creates the client of the only backend configured in backends.
+func createClient(backends map[string]interface{}, auth AuthConfig) (string, Client, error) {
+	if len(backends) != 1 {
+		return "", nil, fmt.Errorf("no backend or more than one backend configured")
+	}
+	var name string
+	var backendConfig interface{}
+	for name, backendConfig = range backends { // Pull the only key/value out of map
+	}
+	factory, err := getFactory(name)
+	if err != nil {
+		return "", nil, fmt.Errorf("get backend client factory: %s", err)
+	}
+	c, err := factory.Create(backendConfig, auth[name])
+	if err != nil {
+		return "", nil, fmt.Errorf("create backend client: %s", err)
+	}
+	return name, c, nil
 }
 
 // AdjustBandwidth adjusts bandwidth limits across all throttled clients to the
@@ -116,6 +270,9 @@ func (m *Manager) Register(namespace string, c Client) error {
 			return fmt.Errorf("namespace %s already exists", namespace)
 		}
 	}
+	if m.scheduler != nil {
+		c = fair(c, m.scheduler)
+	}
 	b, err := newBackend(namespace, c)
 	if err != nil {
 		return fmt.Errorf("new backend: %s", err)
@@ -124,14 +281,42 @@ func (m *Manager) Register(namespace string, c Client) error {
 	return nil
 }
 
+// Namespaces returns the namespace regular expressions of the configured
+// backends, in order of precedence.
+func (m *Manager) Namespaces() []string {
+	var namespaces []string
+	for _, b := range m.backends {
+		namespaces = append(namespaces, b.regexp.String())
+	}
+	return namespaces
+}
+
+// MatchNamespace returns the namespace regular expression of the backend which
+// GetClient resolves namespace to. Returns ErrNamespaceNotFound if no backends
+// match namespace.
+func (m *Manager) MatchNamespace(namespace string) (string, error) {
+	for _, b := range m.backends {
+		if b.regexp.MatchString(namespace) {
+			return b.regexp.String(), nil
+		}
+	}
+	return "", ErrNamespaceNotFound
+}
+
 // GetClient matches namespace to the configured Client. Returns ErrNamespaceNotFound
-// if no clients match namespace.
+// if no clients match namespace. If dual-writes are enabled, Clients of
+// namespaces which also match an old backend write to both.
 func (m *Manager) GetClient(namespace string) (Client, error) {
 	if namespace == NoopNamespace {
 		return NoopClient{}, nil
 	}
 	for _, b := range m.backends {
 		if b.regexp.MatchString(namespace) {
+			if m.old != nil {
+				if old, err := m.old.GetClient(namespace); err == nil {
+					return NewDualWriteClient(b.client, old, m.dualPrimary), nil
+				}
+			}
 			return b.client, nil
 		}
 	}
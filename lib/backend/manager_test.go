@@ -14,7 +14,9 @@
 package backend_test
 
 import (
+	"bytes"
 	"testing"
+	"time"
 
 	. "github.com/uber/kraken/lib/backend"
 	"github.com/uber/kraken/lib/backend/namepath"
@@ -22,9 +24,11 @@ import (
 	"github.com/uber/kraken/mocks/lib/backend"
 	"github.com/uber/kraken/utils/bandwidth"
 	"github.com/uber/kraken/utils/stringset"
+	"github.com/uber/kraken/utils/testutil"
 
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/require"
+	"github.com/uber-go/tally"
 	"gopkg.in/yaml.v2"
 )
 
@@ -103,7 +107,7 @@ func TestManagerNamespaceOrdering(t *testing.T) {
 	var configs []Config
 	require.NoError(yaml.Unmarshal([]byte(configStr), &configs))
 
-	m, err := NewManager(configs, AuthConfig{})
+	m, err := NewManager(configs, AuthConfig{}, tally.NoopScope)
 	require.NoError(err)
 
 	for ns, expected := range map[string]string{
@@ -121,6 +125,26 @@ func TestManagerNamespaceOrdering(t *testing.T) {
 	}
 }
 
+func TestManagerMatchNamespace(t *testing.T) {
+	require := require.New(t)
+
+	m := ManagerFixture()
+	require.NoError(m.Register("foo/.*", &NoopClient{}))
+	require.NoError(m.Register(".*", &NoopClient{}))
+
+	require.Equal([]string{"foo/.*", ".*"}, m.Namespaces())
+
+	for ns, expected := range map[string]string{
+		"foo/bar": "foo/.*",
+		"bar/baz": ".*",
+		"":        ".*",
+	} {
+		match, err := m.MatchNamespace(ns)
+		require.NoError(err)
+		require.Equal(expected, match, "Namespace: %s", ns)
+	}
+}
+
 func TestManagerBandwidth(t *testing.T) {
 	require := require.New(t)
 
@@ -135,7 +159,7 @@ func TestManagerBandwidth(t *testing.T) {
 		Backend: map[string]interface{}{
 			"testfs": testfs.Config{Addr: "test-addr", NamePath: namepath.Identity},
 		},
-	}}, AuthConfig{})
+	}}, AuthConfig{}, tally.NoopScope)
 	require.NoError(err)
 
 	checkBandwidth := func(egress, ingress int64) {
@@ -154,3 +178,45 @@ func TestManagerBandwidth(t *testing.T) {
 
 	checkBandwidth(5, 25)
 }
+
+func TestManagerWrappersForwardCapabilities(t *testing.T) {
+	require := require.New(t)
+
+	fs := testfs.NewServer()
+	defer fs.Cleanup()
+	addr, stop := testutil.StartServer(fs.Handler())
+	defer stop()
+
+	m, err := NewManager([]Config{{
+		Namespace:      ".*",
+		Retry:          RetryConfig{Enable: true},
+		Latency:        LatencyConfig{Enable: true},
+		CircuitBreaker: CircuitBreakerConfig{Enable: true},
+		Bandwidth: bandwidth.Config{
+			EgressBitsPerSec:  1 << 30,
+			IngressBitsPerSec: 1 << 30,
+			TokenSize:         1,
+			Enable:            true,
+		},
+		Backend: map[string]interface{}{
+			"testfs": testfs.Config{Addr: addr, NamePath: namepath.Identity},
+		},
+	}}, AuthConfig{}, tally.NoopScope, WithWriteFairness(WriteFairnessConfig{Enable: true}))
+	require.NoError(err)
+
+	c, err := m.GetClient("foo")
+	require.NoError(err)
+	require.True(c.Capabilities().Ranges)
+	require.IsType(&testfs.Client{}, Unwrap(c))
+
+	require.NoError(c.Upload("foo", "blob", bytes.NewReader([]byte("some content"))))
+
+	var b bytes.Buffer
+	require.NoError(c.(RangeClient).DownloadRange("foo", "blob", 5, 3, &b))
+	require.Equal("con", b.String())
+
+	// Unsupported optional operations of the wrapped client are not reachable.
+	require.False(c.Capabilities().SignedURLs)
+	_, err = c.(SignedURLClient).SignedURL("foo", "blob", time.Minute)
+	require.Equal(ErrUnsupported, err)
+}
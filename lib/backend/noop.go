@@ -44,6 +44,11 @@ func (c NoopClient) Download(namespace, name string, dst io.Writer) error {
 	return backenderrors.ErrBlobNotFound
 }
 
+// Capabilities returns no optional features.
+func (c NoopClient) Capabilities() BackendCapabilities {
+	return BackendCapabilities{}
+}
+
 // List always returns nil.
 func (c NoopClient) List(prefix string, opts ...ListOption) (*ListResult, error) {
 	return nil, nil
@@ -13,12 +13,18 @@
 // limitations under the License.
 package backend
 
+import "time"
+
 // ListOptions defines the options which can be specified
 // when listing names. It is used to enable pagination in list requests.
 type ListOptions struct {
 	Paginated bool
 	MaxKeys int
 	ContinuationToken string
+
+	// ModifiedSince, if set, filters out names last modified before it. Only
+	// honored by Clients which declare the ListModifiedSince capability.
+	ModifiedSince time.Time
 }
 
 // DefaultListOptions defines the defaults for list operations.
@@ -48,6 +54,14 @@ func ListWithMaxKeys(max int) ListOption {
 	}
 }
 
+// ListModifiedSince configures the list command to only return names modified
+// at or after t, if the Client supports it.
+func ListModifiedSince(t time.Time) ListOption {
+	return func(opt *ListOptions) {
+		opt.ModifiedSince = t
+	}
+}
+
 // ListWithContinuationToken configures the list command return
 // results starting at the continuation token if pagination is enabled.
 func ListWithContinuationToken(token string) ListOption {
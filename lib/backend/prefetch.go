@@ -0,0 +1,316 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package backend
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/c2h5oh/datasize"
+)
+
+// RangeClient is implemented by Clients which support ranged downloads.
+type RangeClient interface {
+	Client
+
+	// DownloadRange downloads length bytes of name, starting at offset, into dst.
+	DownloadRange(namespace, name string, offset, length int64, dst io.Writer) error
+}
+
+// PrefetchConfig defines read-ahead configuration for downloads from clients
+// which support ranged downloads.
+type PrefetchConfig struct {
+	Enabled bool `yaml:"enabled"`
+
+	// ChunkSize is the size of each range read. If Adaptive is enabled, it is
+	// only the size of the first range reads.
+	ChunkSize datasize.ByteSize `yaml:"chunk_size"`
+
+	// Window bounds the bytes which may be fetched ahead of the consumer, and
+	// thus the memory buffered per download.
+	Window datasize.ByteSize `yaml:"window"`
+
+	// Concurrency is the number of range reads issued in parallel.
+	Concurrency int `yaml:"concurrency"`
+
+	Adaptive AdaptiveChunkConfig `yaml:"adaptive"`
+}
+
+// AdaptiveChunkConfig defines resizing of range reads to the throughput
+// observed while downloading. Slow links use smaller chunks, such that failed
+// reads are retried at a finer granularity, and fast links use larger chunks,
+// such that fewer requests are issued.
+type AdaptiveChunkConfig struct {
+	Enabled bool `yaml:"enabled"`
+
+	MinChunkSize datasize.ByteSize `yaml:"min_chunk_size"`
+	MaxChunkSize datasize.ByteSize `yaml:"max_chunk_size"`
+
+	// TargetDuration is the duration each range read should take at the
+	// observed throughput.
+	TargetDuration time.Duration `yaml:"target_duration"`
+}
+
+func (c AdaptiveChunkConfig) applyDefaults() AdaptiveChunkConfig {
+	if c.MinChunkSize == 0 {
+		c.MinChunkSize = datasize.MB
+	}
+	if c.MaxChunkSize == 0 {
+		c.MaxChunkSize = 64 * datasize.MB
+	}
+	if c.MaxChunkSize < c.MinChunkSize {
+		c.MaxChunkSize = c.MinChunkSize
+	}
+	if c.TargetDuration == 0 {
+		c.TargetDuration = 2 * time.Second
+	}
+	return c
+}
+
+func (c PrefetchConfig) applyDefaults() PrefetchConfig {
+	if c.ChunkSize == 0 {
+		c.ChunkSize = 8 * datasize.MB
+	}
+	if c.Adaptive.Enabled {
+		c.Adaptive = c.Adaptive.applyDefaults()
+		if c.ChunkSize < c.Adaptive.MinChunkSize {
+			c.ChunkSize = c.Adaptive.MinChunkSize
+		}
+		if c.ChunkSize > c.Adaptive.MaxChunkSize {
+			c.ChunkSize = c.Adaptive.MaxChunkSize
+		}
+	}
+	if c.Window == 0 {
+		c.Window = 64 * datasize.MB
+	}
+	if c.Window < c.maxChunkSize() {
+		c.Window = c.maxChunkSize()
+	}
+	if c.Concurrency == 0 {
+		c.Concurrency = 4
+	}
+	return c
+}
+
+// maxChunkSize returns the largest range read which may be issued.
+func (c PrefetchConfig) maxChunkSize() datasize.ByteSize {
+	if c.Adaptive.Enabled {
+		return c.Adaptive.MaxChunkSize
+	}
+	return c.ChunkSize
+}
+
+// minChunkSize returns the smallest range read which may be issued, besides
+// the last range read of a blob.
+func (c PrefetchConfig) minChunkSize() datasize.ByteSize {
+	if c.Adaptive.Enabled {
+		return c.Adaptive.MinChunkSize
+	}
+	return c.ChunkSize
+}
+
+// byteBudget bounds the bytes of chunks which are in flight or buffered.
+type byteBudget struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	avail  int64
+	closed bool
+}
+
+func newByteBudget(n int64) *byteBudget {
+	b := &byteBudget{avail: n}
+	b.cond = sync.NewCond(&b.mu)
+	return b
+}
+
+// acquire blocks until n bytes are available, and returns false if b was
+// closed in the meantime.
+func (b *byteBudget) acquire(n int64) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for b.avail < n && !b.closed {
+		b.cond.Wait()
+	}
+	if b.closed {
+		return false
+	}
+	b.avail -= n
+	return true
+}
+
+func (b *byteBudget) release(n int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.avail += n
+	b.cond.Broadcast()
+}
+
+func (b *byteBudget) close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.closed = true
+	b.cond.Broadcast()
+}
+
+// chunkSizer determines the size of range reads. If adaptive sizing is
+// enabled, sizes follow the throughput of completed reads.
+type chunkSizer struct {
+	sync.Mutex
+	config AdaptiveChunkConfig
+	size   int64
+}
+
+func newChunkSizer(config PrefetchConfig) *chunkSizer {
+	return &chunkSizer{config: config.Adaptive, size: int64(config.ChunkSize)}
+}
+
+func (s *chunkSizer) next() int64 {
+	s.Lock()
+	defer s.Unlock()
+	return s.size
+}
+
+// observe records that a read of n bytes took elapsed. Sizes move halfway
+// towards the size which would take the target duration, which damps the
+// noise of individual reads.
+func (s *chunkSizer) observe(n int64, elapsed time.Duration) {
+	if !s.config.Enabled {
+		return
+	}
+	min := int64(s.config.MinChunkSize)
+	max := int64(s.config.MaxChunkSize)
+
+	ideal := max
+	if elapsed > 0 {
+		ideal = int64(float64(n) * float64(s.config.TargetDuration) / float64(elapsed))
+	}
+
+	s.Lock()
+	defer s.Unlock()
+	s.size = (s.size + ideal) / 2
+	if s.size < min {
+		s.size = min
+	}
+	if s.size > max {
+		s.size = max
+	}
+}
+
+type prefetchChunk struct {
+	offset int64
+	length int64
+	result chan prefetchResult
+}
+
+type prefetchResult struct {
+	b   *bytes.Buffer
+	err error
+}
+
+// Prefetch downloads the size bytes of name into dst by issuing concurrent
+// range reads for upcoming offsets and reassembling them in order. At most
+// config.Window bytes are buffered at any time. Range reads are sized to the
+// observed throughput if config.Adaptive is enabled.
+func Prefetch(
+	config PrefetchConfig,
+	client RangeClient,
+	namespace, name string,
+	size int64,
+	dst io.Writer) error {
+
+	config = config.applyDefaults()
+
+	if size == 0 {
+		return nil
+	}
+	sizer := newChunkSizer(config)
+
+	// Chunks hold their length of the window while in flight or buffered, until
+	// written to dst, which bounds memory by window regardless of chunk sizes.
+	budget := newByteBudget(int64(config.Window))
+
+	// Chunks are sent to ordered in offset order. Since every chunk but the last
+	// holds at least the min chunk size of the window, ordered never blocks.
+	ordered := make(chan *prefetchChunk, int(config.Window/config.minChunkSize())+1)
+	chunks := make(chan *prefetchChunk)
+	done := make(chan struct{})
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	defer budget.close()
+	defer close(done)
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer close(ordered)
+		defer close(chunks)
+		for offset := int64(0); offset < size; {
+			length := sizer.next()
+			if offset+length > size {
+				length = size - offset
+			}
+			if !budget.acquire(length) {
+				return
+			}
+			c := &prefetchChunk{offset, length, make(chan prefetchResult, 1)}
+			ordered <- c
+			select {
+			case chunks <- c:
+			case <-done:
+				return
+			}
+			offset += length
+		}
+	}()
+
+	for j := 0; j < config.Concurrency; j++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for c := range chunks {
+				start := time.Now()
+				b := bytes.NewBuffer(make([]byte, 0, c.length))
+				err := client.DownloadRange(namespace, name, c.offset, c.length, b)
+				if err == nil && int64(b.Len()) != c.length {
+					err = fmt.Errorf("expected %d bytes, got %d", c.length, b.Len())
+				}
+				if err == nil {
+					sizer.observe(c.length, time.Since(start))
+				}
+				c.result <- prefetchResult{b, err}
+			}
+		}()
+	}
+
+	var i int
+	for c := range ordered {
+		res := <-c.result
+		if res.err != nil {
+			return fmt.Errorf("download range %d: %s", i, res.err)
+		}
+		if _, err := io.Copy(dst, res.b); err != nil {
+			return fmt.Errorf("copy range %d: %s", i, err)
+		}
+		budget.release(c.length)
+		i++
+	}
+	return nil
+}
@@ -0,0 +1,279 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package backend
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/utils/randutil"
+
+	"github.com/c2h5oh/datasize"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/atomic"
+)
+
+// rangeClientFixture serves ranged reads of a blob from memory, simulating the
+// round-trip latency of a high-latency link.
+type rangeClientFixture struct {
+	NoopClient
+	blob    []byte
+	latency time.Duration
+	failAt  int64
+
+	inflight    *atomic.Int64
+	maxInflight *atomic.Int64
+
+	mu      sync.Mutex
+	lengths []int64
+}
+
+func newRangeClientFixture(blob []byte, latency time.Duration) *rangeClientFixture {
+	return &rangeClientFixture{
+		blob:        blob,
+		latency:     latency,
+		failAt:      -1,
+		inflight:    atomic.NewInt64(0),
+		maxInflight: atomic.NewInt64(0),
+	}
+}
+
+func (c *rangeClientFixture) DownloadRange(
+	namespace, name string, offset, length int64, dst io.Writer) error {
+
+	n := c.inflight.Inc()
+	defer c.inflight.Dec()
+	for {
+		max := c.maxInflight.Load()
+		if n <= max || c.maxInflight.CAS(max, n) {
+			break
+		}
+	}
+	c.mu.Lock()
+	c.lengths = append(c.lengths, length)
+	c.mu.Unlock()
+	time.Sleep(c.latency)
+	if offset == c.failAt {
+		return errors.New("some error")
+	}
+	_, err := dst.Write(c.blob[offset : offset+length])
+	return err
+}
+
+func (c *rangeClientFixture) Download(namespace, name string, dst io.Writer) error {
+	return c.DownloadRange(namespace, name, 0, int64(len(c.blob)), dst)
+}
+
+func TestPrefetch(t *testing.T) {
+	tests := []struct {
+		desc string
+		size int
+	}{
+		{"empty", 0},
+		{"smaller than chunk", 10},
+		{"multiple of chunk", 64},
+		{"partial last chunk", 71},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			require := require.New(t)
+
+			blob := randutil.Text(uint64(test.size))
+			client := newRangeClientFixture(blob, 0)
+			config := PrefetchConfig{ChunkSize: 8, Window: 32, Concurrency: 3}
+
+			var b bytes.Buffer
+			require.NoError(Prefetch(config, client, "ns", "name", int64(len(blob)), &b))
+			require.Equal(string(blob), b.String())
+		})
+	}
+}
+
+func TestPrefetchWindowBoundsInflightChunks(t *testing.T) {
+	require := require.New(t)
+
+	blob := randutil.Text(1024)
+	client := newRangeClientFixture(blob, time.Millisecond)
+	config := PrefetchConfig{ChunkSize: 8, Window: 16, Concurrency: 8}
+
+	var b bytes.Buffer
+	require.NoError(Prefetch(config, client, "ns", "name", int64(len(blob)), &b))
+	require.Equal(blob, b.Bytes())
+
+	// Only 2 chunks fit in the window, despite 8 workers.
+	require.True(client.maxInflight.Load() <= 2)
+}
+
+func TestPrefetchError(t *testing.T) {
+	require := require.New(t)
+
+	blob := randutil.Text(64)
+	client := newRangeClientFixture(blob, 0)
+	client.failAt = 16
+	config := PrefetchConfig{ChunkSize: 8, Window: 16, Concurrency: 2}
+
+	var b bytes.Buffer
+	require.Error(Prefetch(config, client, "ns", "name", int64(len(blob)), &b))
+	require.Equal(blob[:16], b.Bytes())
+}
+
+func TestChunkSizerAdaptsToThroughput(t *testing.T) {
+	config := PrefetchConfig{
+		ChunkSize: 8 * datasize.MB,
+		Adaptive: AdaptiveChunkConfig{
+			Enabled:        true,
+			MinChunkSize:   datasize.MB,
+			MaxChunkSize:   64 * datasize.MB,
+			TargetDuration: time.Second,
+		},
+	}.applyDefaults()
+
+	tests := []struct {
+		desc     string
+		rate     int64 // Bytes per second.
+		expected int64
+	}{
+		{"slow link shrinks to min", int64(100 * datasize.KB), int64(datasize.MB)},
+		{"fast link grows to max", int64(datasize.GB), int64(64 * datasize.MB)},
+		{"moderate link converges on target", int64(16 * datasize.MB), int64(16 * datasize.MB)},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			s := newChunkSizer(config)
+			for i := 0; i < 32; i++ {
+				n := s.next()
+				s.observe(n, time.Duration(float64(n)/float64(test.rate)*float64(time.Second)))
+			}
+			require.InEpsilon(t, test.expected, s.next(), 0.01)
+		})
+	}
+}
+
+func TestChunkSizerFixedWhenNotAdaptive(t *testing.T) {
+	s := newChunkSizer(PrefetchConfig{ChunkSize: 8}.applyDefaults())
+	s.observe(8, time.Hour)
+	require.Equal(t, int64(8), s.next())
+}
+
+func TestPrefetchAdaptiveChunkSize(t *testing.T) {
+	tests := []struct {
+		desc     string
+		latency  time.Duration
+		expected int64
+	}{
+		{"slow", 5 * time.Millisecond, 8},
+		{"fast", 0, 64},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			require := require.New(t)
+
+			blob := randutil.Text(512)
+			client := newRangeClientFixture(blob, test.latency)
+			config := PrefetchConfig{
+				ChunkSize:   16,
+				Window:      64,
+				Concurrency: 1,
+				Adaptive: AdaptiveChunkConfig{
+					Enabled:        true,
+					MinChunkSize:   8,
+					MaxChunkSize:   64,
+					TargetDuration: time.Millisecond,
+				},
+			}
+
+			var b bytes.Buffer
+			require.NoError(Prefetch(config, client, "ns", "name", int64(len(blob)), &b))
+			require.Equal(blob, b.Bytes())
+
+			// The first read uses the initial chunk size, later reads are sized
+			// by throughput.
+			require.Equal(int64(16), client.lengths[0])
+			require.Equal(test.expected, client.lengths[len(client.lengths)/2])
+		})
+	}
+}
+
+const (
+	_benchBlobSize = 4 * datasize.MB
+	_benchLatency  = 5 * time.Millisecond
+)
+
+func BenchmarkColdFetchSequential(b *testing.B) {
+	blob := core.SizedBlobFixture(uint64(_benchBlobSize), 1).Content
+	client := newRangeClientFixture(blob, _benchLatency)
+	chunkSize := int64(256 * datasize.KB)
+
+	b.SetBytes(int64(len(blob)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		// Without read-ahead, each chunk waits a full round-trip.
+		var dst bytes.Buffer
+		for offset := int64(0); offset < int64(len(blob)); offset += chunkSize {
+			if err := client.DownloadRange("ns", "name", offset, chunkSize, &dst); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+func BenchmarkColdFetchPrefetch(b *testing.B) {
+	blob := core.SizedBlobFixture(uint64(_benchBlobSize), 1).Content
+	client := newRangeClientFixture(blob, _benchLatency)
+	config := PrefetchConfig{
+		ChunkSize:   256 * datasize.KB,
+		Window:      2 * datasize.MB,
+		Concurrency: 8,
+	}
+
+	b.SetBytes(int64(len(blob)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var dst bytes.Buffer
+		if err := Prefetch(config, client, "ns", "name", int64(len(blob)), &dst); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestPrefetchWindowBudgetsBytesOfAdaptiveChunks(t *testing.T) {
+	require := require.New(t)
+
+	blob := randutil.Text(1024)
+	client := newRangeClientFixture(blob, time.Millisecond)
+	config := PrefetchConfig{
+		ChunkSize:   8,
+		Window:      64,
+		Concurrency: 4,
+		Adaptive: AdaptiveChunkConfig{
+			Enabled:        true,
+			MinChunkSize:   8,
+			MaxChunkSize:   64,
+			TargetDuration: time.Hour,
+		},
+	}
+
+	var b bytes.Buffer
+	require.NoError(Prefetch(config, client, "ns", "name", int64(len(blob)), &b))
+	require.Equal(blob, b.Bytes())
+
+	// The window only fits one chunk of the max size, but small chunks are
+	// still read concurrently.
+	require.True(client.maxInflight.Load() > 1)
+}
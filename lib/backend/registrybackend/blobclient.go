@@ -154,6 +154,11 @@ func (c *BlobClient) Upload(namespace, name string, src io.Reader) error {
 	return errors.New("not supported")
 }
 
+// Capabilities returns no optional features.
+func (c *BlobClient) Capabilities() backend.BackendCapabilities {
+	return backend.BackendCapabilities{}
+}
+
 // List is not supported for blobs.
 func (c *BlobClient) List(prefix string, opts ...backend.ListOption) (*backend.ListResult, error) {
 	return nil, errors.New("not supported")
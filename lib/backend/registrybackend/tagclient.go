@@ -156,6 +156,11 @@ func (c *TagClient) Upload(namespace, name string, src io.Reader) error {
 	return errors.New("not supported")
 }
 
+// Capabilities returns no optional features.
+func (c *TagClient) Capabilities() backend.BackendCapabilities {
+	return backend.BackendCapabilities{}
+}
+
 // List is not supported as users can list directly from registry.
 func (c *TagClient) List(prefix string, opts ...backend.ListOption) (*backend.ListResult, error) {
 	return nil, errors.New("not supported")
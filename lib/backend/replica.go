@@ -0,0 +1,299 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package backend
+
+import (
+	"container/list"
+	"context"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/backend/backenderrors"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/uber-go/tally"
+)
+
+// ReadReplicaConfig defines a read replica of the backend of a namespace, such
+// as a replicated bucket, which serves reads in place of the primary backend.
+// Writes still go to the primary backend.
+//
+// Replicas lag behind the primary, so reads which the replica fails, including
+// reads of names it does not have yet, are retried against the primary. Names
+// recently written by the same process are read from the primary directly.
+// Names overwritten by other processes may still be served stale by the replica
+// until it catches up, so replicas suit content-addressed namespaces best.
+type ReadReplicaConfig struct {
+	Enable bool `yaml:"enable"`
+
+	// Backend configures the replica client, like the backend of Config.
+	Backend map[string]interface{} `yaml:"backend"`
+
+	// FallbackWindow is how long after a write reads of the written name go
+	// to the primary. Should exceed the replication lag of the replica.
+	FallbackWindow time.Duration `yaml:"fallback_window"`
+
+	// MaxRecentWrites bounds the recent writes tracked. Beyond it, the oldest
+	// writes are read from the replica again.
+	MaxRecentWrites int `yaml:"max_recent_writes"`
+}
+
+func (c ReadReplicaConfig) applyDefaults() ReadReplicaConfig {
+	if c.FallbackWindow == 0 {
+		c.FallbackWindow = 5 * time.Minute
+	}
+	if c.MaxRecentWrites == 0 {
+		c.MaxRecentWrites = 100000
+	}
+	return c
+}
+
+type replicaWriteKey struct {
+	namespace string
+	name      string
+}
+
+type replicaWrite struct {
+	key replicaWriteKey
+	at  time.Time
+}
+
+// ReadReplicaClient reads from a replica of its primary Client, and writes to
+// the primary.
+type ReadReplicaClient struct {
+	primary Client
+	replica Client
+	config  ReadReplicaConfig
+	clk     clock.Clock
+	stats   tally.Scope
+	recent  *recentWrites
+}
+
+// recentWrites tracks the writes of a ReadReplicaClient, and is shared with the
+// clients bound from it.
+type recentWrites struct {
+	sync.Mutex
+	keys   map[replicaWriteKey]*list.Element // To element of writes.
+	writes *list.List                        // Of *replicaWrite, oldest first.
+}
+
+// NewReadReplicaClient returns a new ReadReplicaClient.
+func NewReadReplicaClient(
+	primary, replica Client,
+	config ReadReplicaConfig,
+	clk clock.Clock,
+	stats tally.Scope) *ReadReplicaClient {
+
+	return &ReadReplicaClient{
+		primary: primary,
+		replica: replica,
+		config:  config.applyDefaults(),
+		clk:     clk,
+		stats:   stats.SubScope("read_replica"),
+		recent: &recentWrites{
+			keys:   make(map[replicaWriteKey]*list.Element),
+			writes: list.New(),
+		},
+	}
+}
+
+// BindContext binds the primary and the replica to ctx. Recent writes are
+// shared with c.
+func (c *ReadReplicaClient) BindContext(ctx context.Context) Client {
+	bound := *c
+	bound.primary = bindContext(ctx, c.primary)
+	bound.replica = bindContext(ctx, c.replica)
+	return &bound
+}
+
+// Stat returns blob info for name from the replica, falling back to the
+// primary if the replica fails.
+func (c *ReadReplicaClient) Stat(namespace, name string) (*core.BlobInfo, error) {
+	if c.fromPrimary(namespace, name) {
+		return c.primary.Stat(namespace, name)
+	}
+	info, err := c.replica.Stat(namespace, name)
+	if c.fallback(err, true) {
+		return c.primary.Stat(namespace, name)
+	}
+	return info, err
+}
+
+// Upload uploads src into name in the primary.
+func (c *ReadReplicaClient) Upload(namespace, name string, src io.Reader) error {
+	if err := c.primary.Upload(namespace, name, src); err != nil {
+		return err
+	}
+	c.recordWrite(namespace, name)
+	return nil
+}
+
+// Download downloads name into dst from the replica, falling back to the
+// primary if the replica fails before writing to dst.
+func (c *ReadReplicaClient) Download(namespace, name string, dst io.Writer) error {
+	if c.fromPrimary(namespace, name) {
+		return c.primary.Download(namespace, name, dst)
+	}
+	w := newCountingWriter(dst)
+	err := c.replica.Download(namespace, name, w)
+	if c.fallback(err, w.count() == 0) {
+		return c.primary.Download(namespace, name, dst)
+	}
+	return err
+}
+
+// List lists names which start with prefix in the replica. Names written
+// recently may be missing.
+func (c *ReadReplicaClient) List(prefix string, opts ...ListOption) (*ListResult, error) {
+	c.stats.Counter("reads").Inc(1)
+	return c.replica.List(prefix, opts...)
+}
+
+// DownloadRange downloads length bytes of name, starting at offset, into dst
+// from the replica, falling back to the primary like Download.
+func (c *ReadReplicaClient) DownloadRange(
+	namespace, name string, offset, length int64, dst io.Writer) error {
+
+	if c.fromPrimary(namespace, name) {
+		return downloadRange(c.primary, namespace, name, offset, length, dst)
+	}
+	w := newCountingWriter(dst)
+	err := downloadRange(c.replica, namespace, name, offset, length, w)
+	if c.fallback(err, w.count() == 0) {
+		return downloadRange(c.primary, namespace, name, offset, length, dst)
+	}
+	return err
+}
+
+// UploadIfAbsent uploads src into name in the primary if name does not exist.
+func (c *ReadReplicaClient) UploadIfAbsent(namespace, name string, src io.Reader) error {
+	if err := uploadIfAbsent(c.primary, namespace, name, src); err != nil {
+		return err
+	}
+	c.recordWrite(namespace, name)
+	return nil
+}
+
+// CanCopyFrom returns true if the primary can copy from src.
+func (c *ReadReplicaClient) CanCopyFrom(src Client) bool {
+	return canCopyFrom(c.primary, src)
+}
+
+// CopyFrom copies name from src into name in the primary.
+func (c *ReadReplicaClient) CopyFrom(src Client, namespace, name string) error {
+	if err := copyFrom(c.primary, src, namespace, name); err != nil {
+		return err
+	}
+	c.recordWrite(namespace, name)
+	return nil
+}
+
+// SignedURL returns a URL of the primary through which name may be downloaded
+// until ttl elapses. URLs are signed against the primary, since the replica
+// may not have name yet.
+func (c *ReadReplicaClient) SignedURL(namespace, name string, ttl time.Duration) (string, error) {
+	return signedURL(c.primary, namespace, name, ttl)
+}
+
+// Delete deletes name from the primary. Reads of name go to the primary until
+// the replica caught up with the delete.
+func (c *ReadReplicaClient) Delete(namespace, name string) error {
+	if err := deleteBlob(c.primary, namespace, name); err != nil {
+		return err
+	}
+	c.recordWrite(namespace, name)
+	return nil
+}
+
+// Capabilities returns the optional features of the primary, except for range
+// reads, which are only supported if the replica supports them too.
+func (c *ReadReplicaClient) Capabilities() BackendCapabilities {
+	caps := c.primary.Capabilities()
+	caps.Ranges = caps.Ranges && c.replica.Capabilities().Ranges
+	return caps
+}
+
+// Unwrap returns the primary.
+func (c *ReadReplicaClient) Unwrap() Client {
+	return c.primary
+}
+
+// fromPrimary returns true if name was written recently by c, and must be read
+// from the primary since the replica may not have caught up yet.
+func (c *ReadReplicaClient) fromPrimary(namespace, name string) bool {
+	c.stats.Counter("reads").Inc(1)
+	if !c.writtenRecently(namespace, name) {
+		return false
+	}
+	c.stats.Counter("recent_write_reads").Inc(1)
+	return true
+}
+
+// fallback returns true if a replica read which failed with err must be
+// retried against the primary. Reads are only retried if resettable, i.e.
+// nothing was written to the destination yet.
+func (c *ReadReplicaClient) fallback(err error, resettable bool) bool {
+	if err == nil || !resettable {
+		return false
+	}
+	if err == backenderrors.ErrBlobNotFound {
+		c.stats.Counter("misses").Inc(1)
+	} else {
+		c.stats.Counter("errors").Inc(1)
+	}
+	c.stats.Counter("fallbacks").Inc(1)
+	return true
+}
+
+func (c *ReadReplicaClient) recordWrite(namespace, name string) {
+	r := c.recent
+	r.Lock()
+	defer r.Unlock()
+
+	now := c.clk.Now()
+	k := replicaWriteKey{namespace, name}
+	if el, ok := r.keys[k]; ok {
+		r.writes.Remove(el)
+	}
+	r.keys[k] = r.writes.PushBack(&replicaWrite{k, now})
+	c.prune(now)
+}
+
+func (c *ReadReplicaClient) writtenRecently(namespace, name string) bool {
+	r := c.recent
+	r.Lock()
+	defer r.Unlock()
+
+	now := c.clk.Now()
+	c.prune(now)
+	_, ok := r.keys[replicaWriteKey{namespace, name}]
+	return ok
+}
+
+// prune drops writes older than the fallback window, and the oldest writes
+// beyond the limit. Must be called with recent locked.
+func (c *ReadReplicaClient) prune(now time.Time) {
+	r := c.recent
+	for r.writes.Len() > 0 {
+		el := r.writes.Front()
+		w := el.Value.(*replicaWrite)
+		if r.writes.Len() <= c.config.MaxRecentWrites && now.Sub(w.at) < c.config.FallbackWindow {
+			return
+		}
+		r.writes.Remove(el)
+		delete(r.keys, w.key)
+	}
+}
@@ -0,0 +1,236 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package backend_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/uber/kraken/core"
+	. "github.com/uber/kraken/lib/backend"
+	"github.com/uber/kraken/lib/backend/backenderrors"
+	"github.com/uber/kraken/lib/backend/namepath"
+	"github.com/uber/kraken/lib/backend/testfs"
+	"github.com/uber/kraken/mocks/lib/backend"
+	"github.com/uber/kraken/utils/mockutil"
+	"github.com/uber/kraken/utils/testutil"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+	"github.com/uber-go/tally"
+)
+
+func TestReadReplicaClientReadsReplicaAndWritesPrimary(t *testing.T) {
+	require := require.New(t)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	primary := mockbackend.NewMockClient(ctrl)
+	replica := mockbackend.NewMockClient(ctrl)
+	client := NewReadReplicaClient(
+		primary, replica, ReadReplicaConfig{}, clock.NewMock(), tally.NoopScope)
+
+	blob := core.NewBlobFixture()
+	info := core.NewBlobInfo(int64(len(blob.Content)))
+
+	primary.EXPECT().Upload("ns", "written", mockutil.MatchReader(blob.Content)).Return(nil)
+	require.NoError(client.Upload("ns", "written", bytes.NewReader(blob.Content)))
+
+	replica.EXPECT().Stat("ns", "name").Return(info, nil)
+	result, err := client.Stat("ns", "name")
+	require.NoError(err)
+	require.Equal(info, result)
+
+	replica.EXPECT().Download("ns", "name", mockutil.MatchWriter(blob.Content)).Return(nil)
+	var b bytes.Buffer
+	require.NoError(client.Download("ns", "name", &b))
+	require.Equal(blob.Content, b.Bytes())
+
+	replica.EXPECT().List("prefix").Return(&ListResult{Names: []string{"name"}}, nil)
+	list, err := client.List("prefix")
+	require.NoError(err)
+	require.Equal([]string{"name"}, list.Names)
+}
+
+func TestReadReplicaClientReadsFreshWritesFromPrimary(t *testing.T) {
+	require := require.New(t)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	clk := clock.NewMock()
+	primary := mockbackend.NewMockClient(ctrl)
+	replica := mockbackend.NewMockClient(ctrl)
+	client := NewReadReplicaClient(
+		primary, replica, ReadReplicaConfig{FallbackWindow: time.Minute}, clk, tally.NoopScope)
+
+	blob := core.NewBlobFixture()
+	info := core.NewBlobInfo(int64(len(blob.Content)))
+
+	primary.EXPECT().Upload("ns", "fresh", gomock.Any()).Return(nil)
+	require.NoError(client.Upload("ns", "fresh", bytes.NewReader(blob.Content)))
+
+	// The replica may still hold a stale value of the write.
+	primary.EXPECT().Stat("ns", "fresh").Return(info, nil)
+	result, err := client.Stat("ns", "fresh")
+	require.NoError(err)
+	require.Equal(info, result)
+
+	primary.EXPECT().Download("ns", "fresh", mockutil.MatchWriter(blob.Content)).Return(nil)
+	var b bytes.Buffer
+	require.NoError(client.Download("ns", "fresh", &b))
+	require.Equal(blob.Content, b.Bytes())
+
+	// Fresh writes are read from the replica once the window passes.
+	clk.Add(time.Minute)
+	replica.EXPECT().Stat("ns", "fresh").Return(info, nil)
+	result, err = client.Stat("ns", "fresh")
+	require.NoError(err)
+	require.Equal(info, result)
+}
+
+func TestReadReplicaClientFallsBackOnReplicaFailures(t *testing.T) {
+	require := require.New(t)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	primary := mockbackend.NewMockClient(ctrl)
+	replica := mockbackend.NewMockClient(ctrl)
+	client := NewReadReplicaClient(
+		primary, replica, ReadReplicaConfig{}, clock.NewMock(), tally.NoopScope)
+
+	blob := core.NewBlobFixture()
+	info := core.NewBlobInfo(int64(len(blob.Content)))
+
+	// Names written by other processes may not have replicated yet.
+	gomock.InOrder(
+		replica.EXPECT().Stat("ns", "name").Return(nil, backenderrors.ErrBlobNotFound),
+		primary.EXPECT().Stat("ns", "name").Return(info, nil),
+	)
+	result, err := client.Stat("ns", "name")
+	require.NoError(err)
+	require.Equal(info, result)
+
+	gomock.InOrder(
+		replica.EXPECT().Download("ns", "name", gomock.Any()).Return(errors.New("some error")),
+		primary.EXPECT().Download("ns", "name", mockutil.MatchWriter(blob.Content)).Return(nil),
+	)
+	var b bytes.Buffer
+	require.NoError(client.Download("ns", "name", &b))
+	require.Equal(blob.Content, b.Bytes())
+
+	// Downloads which already wrote to the destination cannot fall back.
+	replica.EXPECT().Download("ns", "name", gomock.Any()).DoAndReturn(
+		func(namespace, name string, dst io.Writer) error {
+			dst.Write(blob.Content[:1])
+			return errors.New("some error")
+		})
+	require.Error(client.Download("ns", "name", &bytes.Buffer{}))
+
+	// Names missing from both are missing.
+	gomock.InOrder(
+		replica.EXPECT().Stat("ns", "other").Return(nil, backenderrors.ErrBlobNotFound),
+		primary.EXPECT().Stat("ns", "other").Return(nil, backenderrors.ErrBlobNotFound),
+	)
+	_, err = client.Stat("ns", "other")
+	require.Equal(backenderrors.ErrBlobNotFound, err)
+}
+
+func TestReadReplicaClientBoundsRecentWrites(t *testing.T) {
+	require := require.New(t)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	primary := mockbackend.NewMockClient(ctrl)
+	replica := mockbackend.NewMockClient(ctrl)
+	client := NewReadReplicaClient(
+		primary, replica, ReadReplicaConfig{MaxRecentWrites: 2}, clock.NewMock(), tally.NoopScope)
+
+	primary.EXPECT().Upload("ns", gomock.Any(), gomock.Any()).Return(nil).Times(3)
+	for _, name := range []string{"a", "b", "c"} {
+		require.NoError(client.Upload("ns", name, bytes.NewReader(nil)))
+	}
+
+	replica.EXPECT().Stat("ns", "a").Return(core.NewBlobInfo(0), nil)
+	_, err := client.Stat("ns", "a")
+	require.NoError(err)
+
+	primary.EXPECT().Stat("ns", "c").Return(core.NewBlobInfo(0), nil)
+	_, err = client.Stat("ns", "c")
+	require.NoError(err)
+}
+
+func TestManagerReadReplica(t *testing.T) {
+	require := require.New(t)
+
+	primaryServer := testfs.NewServer()
+	defer primaryServer.Cleanup()
+	primaryAddr, stop := testutil.StartServer(primaryServer.Handler())
+	defer stop()
+
+	replicaServer := testfs.NewServer()
+	defer replicaServer.Cleanup()
+	replicaAddr, stop := testutil.StartServer(replicaServer.Handler())
+	defer stop()
+
+	m, err := NewManager([]Config{{
+		Namespace: ".*",
+		Backend: map[string]interface{}{
+			"testfs": testfs.Config{Addr: primaryAddr, Root: "root", NamePath: namepath.Identity},
+		},
+		ReadReplica: ReadReplicaConfig{
+			Enable: true,
+			Backend: map[string]interface{}{
+				"testfs": testfs.Config{Addr: replicaAddr, Root: "root", NamePath: namepath.Identity},
+			},
+		},
+	}}, AuthConfig{}, tally.NoopScope)
+	require.NoError(err)
+
+	c, err := m.GetClient("ns")
+	require.NoError(err)
+
+	blob := core.NewBlobFixture()
+	require.NoError(c.Upload("ns", "name", bytes.NewReader(blob.Content)))
+
+	// Served by the primary until replicated.
+	var b bytes.Buffer
+	require.NoError(c.Download("ns", "name", &b))
+	require.Equal(blob.Content, b.Bytes())
+
+	// Lists are served by the replica.
+	replica, err := testfs.NewClient(testfs.Config{Addr: replicaAddr, Root: "root", NamePath: namepath.Identity})
+	require.NoError(err)
+	require.NoError(replica.Upload("ns", "repo/replicated", bytes.NewReader(blob.Content)))
+
+	list, err := c.List("repo")
+	require.NoError(err)
+	require.Equal([]string{"repo/replicated"}, list.Names)
+
+	// Names written by other hosts are served by the primary until replicated.
+	primary, err := testfs.NewClient(testfs.Config{Addr: primaryAddr, Root: "root", NamePath: namepath.Identity})
+	require.NoError(err)
+	require.NoError(primary.Upload("ns", "elsewhere", bytes.NewReader(blob.Content)))
+
+	b.Reset()
+	require.NoError(c.Download("ns", "elsewhere", &b))
+	require.Equal(blob.Content, b.Bytes())
+}
@@ -0,0 +1,302 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package backend
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/backend/backenderrors"
+	"github.com/uber/kraken/utils/backoffutil"
+	"github.com/uber/kraken/utils/httputil"
+
+	"github.com/cenkalti/backoff"
+	"github.com/uber-go/tally"
+)
+
+// RetryConfig defines retries of backend operations which failed with
+// retryable errors. Terminal errors, e.g. missing blobs or rejected
+// credentials, are returned immediately.
+type RetryConfig struct {
+	Enable bool `yaml:"enable"`
+
+	// MaxRetries is the number of retries after the initial attempt.
+	MaxRetries int `yaml:"max_retries"`
+
+	// InitialInterval is the backoff before the first retry, which doubles on
+	// every subsequent retry up to MaxInterval.
+	InitialInterval time.Duration `yaml:"initial_interval"`
+	MaxInterval     time.Duration `yaml:"max_interval"`
+
+	// Jitter selects how backoffs are randomized. If unset, backoffs are
+	// randomized by 5% either way.
+	Jitter backoffutil.Jitter `yaml:"jitter"`
+}
+
+func (c RetryConfig) applyDefaults() RetryConfig {
+	if c.MaxRetries == 0 {
+		c.MaxRetries = 3
+	}
+	if c.InitialInterval == 0 {
+		c.InitialInterval = 500 * time.Millisecond
+	}
+	if c.MaxInterval == 0 {
+		c.MaxInterval = 10 * time.Second
+	}
+	return c
+}
+
+// ErrorClassifier is implemented by Clients which can distinguish retryable
+// errors specific to their backend, e.g. throttling responses of an SDK.
+type ErrorClassifier interface {
+	Retryable(err error) bool
+}
+
+// IsRetryable returns true if err is a transient failure which may succeed
+// when retried, i.e. timeouts, connection resets, 429s and 5xxs. Missing blobs,
+// auth failures, bad requests and unclassified errors are terminal.
+func IsRetryable(err error) bool {
+	if err == nil ||
+		err == backenderrors.ErrBlobNotFound ||
+		err == backenderrors.ErrBlobExists ||
+		err == ErrCircuitOpen ||
+		errors.Is(err, context.Canceled) ||
+		errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	if statusErr, ok := err.(httputil.StatusError); ok {
+		return IsRetryableStatus(statusErr.Status)
+	}
+	if httputil.IsNetworkError(err) {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	return errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.EPIPE) ||
+		errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// IsRetryableStatus returns true if an HTTP status code indicates a transient
+// failure.
+func IsRetryableStatus(code int) bool {
+	return code == http.StatusTooManyRequests || code >= 500
+}
+
+// retryClient retries operations of the wrapped client which fail with
+// retryable errors.
+type retryClient struct {
+	Client
+	config RetryConfig
+	stats  tally.Scope
+	ctx    context.Context
+}
+
+func withRetries(client Client, config RetryConfig, stats tally.Scope) *retryClient {
+	return &retryClient{client, config.applyDefaults(), stats, context.Background()}
+}
+
+// BindContext returns a retryClient which stops retrying once ctx is done.
+func (c *retryClient) BindContext(ctx context.Context) Client {
+	return &retryClient{bindContext(ctx, c.Client), c.config, c.stats, ctx}
+}
+
+func (c *retryClient) retryable(err error) bool {
+	if classifier, ok := c.Client.(ErrorClassifier); ok {
+		return classifier.Retryable(err)
+	}
+	return IsRetryable(err)
+}
+
+// do runs f until it succeeds, fails with a terminal error, or retries are
+// exhausted, or until the context of c is done. resettable is checked before
+// every retry, such that operations which partially consumed their input are
+// not retried.
+func (c *retryClient) do(op string, resettable func() bool, f func() error) error {
+	b := c.backOff()
+	stats := c.stats.Tagged(map[string]string{"operation": op})
+	for retries := 0; ; retries++ {
+		err := f()
+		if err == nil {
+			return nil
+		}
+		if !c.retryable(err) {
+			if err != backenderrors.ErrBlobNotFound {
+				stats.Counter("terminal_errors").Inc(1)
+			}
+			return err
+		}
+		if retries == c.config.MaxRetries || !resettable() {
+			stats.Counter("retries_exhausted").Inc(1)
+			return err
+		}
+		if c.ctx.Err() != nil {
+			stats.Counter("retries_abandoned").Inc(1)
+			return err
+		}
+		stats.Counter("retries").Inc(1)
+		t := time.NewTimer(b.NextBackOff())
+		select {
+		case <-t.C:
+		case <-c.ctx.Done():
+			t.Stop()
+			stats.Counter("retries_abandoned").Inc(1)
+			return err
+		}
+	}
+}
+
+func (c *retryClient) backOff() backoff.BackOff {
+	if c.config.Jitter != "" {
+		return backoffutil.New(
+			c.config.Jitter, c.config.InitialInterval, c.config.MaxInterval, 2, nil)
+	}
+	b := &backoff.ExponentialBackOff{
+		InitialInterval:     c.config.InitialInterval,
+		RandomizationFactor: 0.05,
+		Multiplier:          2,
+		MaxInterval:         c.config.MaxInterval,
+		Clock:               backoff.SystemClock,
+	}
+	b.Reset()
+	return b
+}
+
+func always() bool { return true }
+
+// Stat returns blob info for name.
+func (c *retryClient) Stat(namespace, name string) (*core.BlobInfo, error) {
+	var info *core.BlobInfo
+	err := c.do("stat", always, func() error {
+		var err error
+		info, err = c.Client.Stat(namespace, name)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// Upload uploads src into name. Failed uploads are only retried if src can be
+// rewound.
+func (c *retryClient) Upload(namespace, name string, src io.Reader) error {
+	seeker, seekable := src.(io.Seeker)
+	resettable := func() bool {
+		if !seekable {
+			return false
+		}
+		_, err := seeker.Seek(0, io.SeekStart)
+		return err == nil
+	}
+	return c.do("upload", resettable, func() error {
+		return c.Client.Upload(namespace, name, src)
+	})
+}
+
+// Download downloads name into dst. Failed downloads are only retried if
+// nothing was written to dst yet.
+func (c *retryClient) Download(namespace, name string, dst io.Writer) error {
+	w := newCountingWriter(dst)
+	resettable := func() bool { return w.count() == 0 }
+	return c.do("download", resettable, func() error {
+		return c.Client.Download(namespace, name, w)
+	})
+}
+
+// List lists entries whose names start with prefix.
+func (c *retryClient) List(prefix string, opts ...ListOption) (*ListResult, error) {
+	var result *ListResult
+	err := c.do("list", always, func() error {
+		var err error
+		result, err = c.Client.List(prefix, opts...)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// DownloadRange downloads length bytes of name, starting at offset, into dst.
+// Failed range reads are only retried if nothing was written to dst yet.
+func (c *retryClient) DownloadRange(
+	namespace, name string, offset, length int64, dst io.Writer) error {
+
+	w := newCountingWriter(dst)
+	resettable := func() bool { return w.count() == 0 }
+	return c.do("download_range", resettable, func() error {
+		return downloadRange(c.Client, namespace, name, offset, length, w)
+	})
+}
+
+// UploadIfAbsent uploads src into name if name does not exist. Like uploads,
+// failed conditional uploads are only retried if src can be rewound.
+func (c *retryClient) UploadIfAbsent(namespace, name string, src io.Reader) error {
+	seeker, seekable := src.(io.Seeker)
+	resettable := func() bool {
+		if !seekable {
+			return false
+		}
+		_, err := seeker.Seek(0, io.SeekStart)
+		return err == nil
+	}
+	return c.do("upload_if_absent", resettable, func() error {
+		return uploadIfAbsent(c.Client, namespace, name, src)
+	})
+}
+
+// CanCopyFrom returns true if the wrapped client can copy from src.
+func (c *retryClient) CanCopyFrom(src Client) bool {
+	return canCopyFrom(c.Client, src)
+}
+
+// CopyFrom copies name from src into name.
+func (c *retryClient) CopyFrom(src Client, namespace, name string) error {
+	return c.do("copy", always, func() error {
+		return copyFrom(c.Client, src, namespace, name)
+	})
+}
+
+// SignedURL returns a URL through which name may be downloaded until ttl
+// elapses.
+func (c *retryClient) SignedURL(namespace, name string, ttl time.Duration) (string, error) {
+	return signedURL(c.Client, namespace, name, ttl)
+}
+
+// Delete deletes name.
+func (c *retryClient) Delete(namespace, name string) error {
+	return c.do("delete", always, func() error {
+		return deleteBlob(c.Client, namespace, name)
+	})
+}
+
+// Capabilities returns the optional features of the wrapped client.
+func (c *retryClient) Capabilities() BackendCapabilities {
+	return c.Client.Capabilities()
+}
+
+// Unwrap returns the wrapped client.
+func (c *retryClient) Unwrap() Client {
+	return c.Client
+}
@@ -0,0 +1,237 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package backend
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/backend/backenderrors"
+	"github.com/uber/kraken/utils/backoffutil"
+	"github.com/uber/kraken/utils/httputil"
+
+	"github.com/stretchr/testify/require"
+	"github.com/uber-go/tally"
+)
+
+// scriptedClient fails operations with errs in order, then succeeds.
+type scriptedClient struct {
+	NoopClient
+	errs  []error
+	calls int
+}
+
+func (c *scriptedClient) next() error {
+	c.calls++
+	if len(c.errs) == 0 {
+		return nil
+	}
+	err := c.errs[0]
+	c.errs = c.errs[1:]
+	return err
+}
+
+func (c *scriptedClient) Stat(namespace, name string) (*core.BlobInfo, error) {
+	if err := c.next(); err != nil {
+		return nil, err
+	}
+	return core.NewBlobInfo(1), nil
+}
+
+func (c *scriptedClient) Upload(namespace, name string, src io.Reader) error {
+	io.Copy(ioutil.Discard, src)
+	return c.next()
+}
+
+func (c *scriptedClient) Download(namespace, name string, dst io.Writer) error {
+	if err := c.next(); err != nil {
+		return err
+	}
+	_, err := dst.Write([]byte("content"))
+	return err
+}
+
+func retryConfigFixture() RetryConfig {
+	return RetryConfig{
+		Enable:          true,
+		MaxRetries:      3,
+		InitialInterval: time.Millisecond,
+		MaxInterval:     time.Millisecond,
+	}
+}
+
+func statusError(status int) error {
+	return httputil.StatusError{Method: "GET", URL: "http://backend/blob", Status: status}
+}
+
+func TestRetryClientFailsForbiddenImmediately(t *testing.T) {
+	require := require.New(t)
+
+	scripted := &scriptedClient{errs: []error{statusError(http.StatusForbidden)}}
+	stats := tally.NewTestScope("", nil)
+	c := withRetries(scripted, retryConfigFixture(), stats)
+
+	_, err := c.Stat("ns", "name")
+	require.True(httputil.IsForbidden(err))
+	require.Equal(1, scripted.calls)
+	require.Equal(int64(1), stats.Snapshot().Counters()["terminal_errors+operation=stat"].Value())
+}
+
+func TestRetryClientRetriesServiceUnavailable(t *testing.T) {
+	require := require.New(t)
+
+	unavailable := statusError(http.StatusServiceUnavailable)
+	scripted := &scriptedClient{errs: []error{unavailable, unavailable}}
+	stats := tally.NewTestScope("", nil)
+	c := withRetries(scripted, retryConfigFixture(), stats)
+
+	_, err := c.Stat("ns", "name")
+	require.NoError(err)
+	require.Equal(3, scripted.calls)
+	require.Equal(int64(2), stats.Snapshot().Counters()["retries+operation=stat"].Value())
+}
+
+func TestRetryClientJitterStrategies(t *testing.T) {
+	for _, jitter := range []backoffutil.Jitter{
+		backoffutil.JitterNone,
+		backoffutil.JitterEqual,
+		backoffutil.JitterFull,
+		backoffutil.JitterDecorrelated,
+	} {
+		t.Run(string(jitter), func(t *testing.T) {
+			require := require.New(t)
+
+			config := retryConfigFixture()
+			config.Jitter = jitter
+
+			unavailable := statusError(http.StatusServiceUnavailable)
+			scripted := &scriptedClient{errs: []error{unavailable, unavailable}}
+			c := withRetries(scripted, config, tally.NoopScope)
+
+			_, err := c.Stat("ns", "name")
+			require.NoError(err)
+			require.Equal(3, scripted.calls)
+		})
+	}
+}
+
+func TestRetryClientGivesUpAfterMaxRetries(t *testing.T) {
+	require := require.New(t)
+
+	unavailable := statusError(http.StatusServiceUnavailable)
+	scripted := &scriptedClient{errs: []error{unavailable, unavailable, unavailable, unavailable}}
+	c := withRetries(scripted, retryConfigFixture(), tally.NoopScope)
+
+	_, err := c.Stat("ns", "name")
+	require.Equal(unavailable, err)
+	require.Equal(4, scripted.calls)
+}
+
+func TestRetryClientNeverRetriesNotFound(t *testing.T) {
+	require := require.New(t)
+
+	scripted := &scriptedClient{errs: []error{backenderrors.ErrBlobNotFound}}
+	c := withRetries(scripted, retryConfigFixture(), tally.NoopScope)
+
+	require.Equal(backenderrors.ErrBlobNotFound, c.Download("ns", "name", ioutil.Discard))
+	require.Equal(1, scripted.calls)
+}
+
+func TestRetryClientUploadRewindsSeekableSource(t *testing.T) {
+	require := require.New(t)
+
+	scripted := &scriptedClient{errs: []error{statusError(http.StatusTooManyRequests)}}
+	c := withRetries(scripted, retryConfigFixture(), tally.NoopScope)
+
+	require.NoError(c.Upload("ns", "name", bytes.NewReader([]byte("content"))))
+	require.Equal(2, scripted.calls)
+}
+
+func TestRetryClientUploadDoesNotRetryUnseekableSource(t *testing.T) {
+	require := require.New(t)
+
+	unavailable := statusError(http.StatusServiceUnavailable)
+	scripted := &scriptedClient{errs: []error{unavailable}}
+	c := withRetries(scripted, retryConfigFixture(), tally.NoopScope)
+
+	src := ioutil.NopCloser(bytes.NewReader([]byte("content")))
+	require.Equal(unavailable, c.Upload("ns", "name", src))
+	require.Equal(1, scripted.calls)
+}
+
+func TestRetryClientStopsRetryingWhenContextDone(t *testing.T) {
+	require := require.New(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	unavailable := statusError(http.StatusServiceUnavailable)
+	scripted := &scriptedClient{errs: []error{unavailable, unavailable}}
+	stats := tally.NewTestScope("", nil)
+	c := withRetries(scripted, retryConfigFixture(), stats).BindContext(ctx)
+
+	_, err := c.Stat("ns", "name")
+	require.Equal(unavailable, err)
+	require.Equal(1, scripted.calls)
+	require.Equal(int64(1), stats.Snapshot().Counters()["retries_abandoned+operation=stat"].Value())
+}
+
+// classifyingClient classifies all errors as retryable.
+type classifyingClient struct {
+	scriptedClient
+}
+
+func (c *classifyingClient) Retryable(err error) bool { return true }
+
+func TestRetryClientUsesClientClassification(t *testing.T) {
+	require := require.New(t)
+
+	classifying := &classifyingClient{scriptedClient{errs: []error{errors.New("throttled")}}}
+	c := withRetries(classifying, retryConfigFixture(), tally.NoopScope)
+
+	_, err := c.Stat("ns", "name")
+	require.NoError(err)
+	require.Equal(2, classifying.calls)
+}
+
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		desc     string
+		err      error
+		expected bool
+	}{
+		{"not found", backenderrors.ErrBlobNotFound, false},
+		{"circuit open", ErrCircuitOpen, false},
+		{"bad request", statusError(http.StatusBadRequest), false},
+		{"unauthorized", statusError(http.StatusUnauthorized), false},
+		{"forbidden", statusError(http.StatusForbidden), false},
+		{"too many requests", statusError(http.StatusTooManyRequests), true},
+		{"internal server error", statusError(http.StatusInternalServerError), true},
+		{"service unavailable", statusError(http.StatusServiceUnavailable), true},
+		{"unexpected eof", io.ErrUnexpectedEOF, true},
+		{"unclassified", errors.New("some error"), false},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			require.Equal(t, test.expected, IsRetryable(test.err))
+		})
+	}
+}
@@ -0,0 +1,136 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package backend
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"sync"
+	"time"
+
+	"github.com/uber/kraken/utils/log"
+)
+
+// CredentialRotationConfig defines refreshing of backend credentials at
+// runtime, such that rotated credentials are picked up without restarts.
+type CredentialRotationConfig struct {
+	Enable bool `yaml:"enable"`
+
+	// File contains credentials in the format of the auth config of the
+	// backend, i.e. keyed by username. It is re-read every Interval.
+	File string `yaml:"file"`
+
+	Interval time.Duration `yaml:"interval"`
+}
+
+func (c CredentialRotationConfig) applyDefaults() CredentialRotationConfig {
+	if c.Interval == 0 {
+		c.Interval = time.Minute
+	}
+	return c
+}
+
+// CredentialProvider returns the latest credentials of a backend, in the
+// format of its auth config.
+type CredentialProvider func() ([]byte, error)
+
+// FileCredentialProvider returns a CredentialProvider which reads path.
+func FileCredentialProvider(path string) CredentialProvider {
+	return func() ([]byte, error) { return ioutil.ReadFile(path) }
+}
+
+// CredentialRotator polls a CredentialProvider and passes changed credentials
+// to a rotate function, which is expected to validate the credentials before
+// atomically swapping them in. Credentials which fail to rotate are retried on
+// the next refresh, while the previous credentials remain in use.
+type CredentialRotator struct {
+	config   CredentialRotationConfig
+	provider CredentialProvider
+	rotate   func([]byte) error
+
+	mu      sync.Mutex
+	current []byte
+
+	stopOnce sync.Once
+	done     chan struct{}
+}
+
+// NewCredentialRotator creates a new CredentialRotator. If provider is nil,
+// credentials are read from the file of config.
+func NewCredentialRotator(
+	config CredentialRotationConfig,
+	provider CredentialProvider,
+	rotate func([]byte) error) (*CredentialRotator, error) {
+
+	config = config.applyDefaults()
+	if provider == nil {
+		if config.File == "" {
+			return nil, errors.New("credential rotation requires a file or provider")
+		}
+		provider = FileCredentialProvider(config.File)
+	}
+	return &CredentialRotator{
+		config:   config,
+		provider: provider,
+		rotate:   rotate,
+		done:     make(chan struct{}),
+	}, nil
+}
+
+// Refresh fetches the latest credentials from the provider and rotates them
+// if they changed.
+func (r *CredentialRotator) Refresh() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	b, err := r.provider()
+	if err != nil {
+		return fmt.Errorf("provider: %s", err)
+	}
+	if bytes.Equal(b, r.current) {
+		return nil
+	}
+	if err := r.rotate(b); err != nil {
+		return fmt.Errorf("rotate: %s", err)
+	}
+	r.current = b
+	log.Info("Rotated backend credentials")
+	return nil
+}
+
+// Start refreshes credentials immediately, and then every interval in the
+// background until Stop is called.
+func (r *CredentialRotator) Start() {
+	go func() {
+		ticker := time.NewTicker(r.config.Interval)
+		defer ticker.Stop()
+		for {
+			if err := r.Refresh(); err != nil {
+				log.Errorf("Error refreshing backend credentials: %s", err)
+			}
+			select {
+			case <-r.done:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Stop stops background refreshes.
+func (r *CredentialRotator) Stop() {
+	r.stopOnce.Do(func() { close(r.done) })
+}
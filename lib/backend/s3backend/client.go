@@ -14,10 +14,13 @@
 package s3backend
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io"
+	"net/url"
 	"path"
+	"time"
 
 	"github.com/uber/kraken/core"
 	"github.com/uber/kraken/lib/backend"
@@ -29,6 +32,7 @@ import (
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/aws/aws-sdk-go/service/s3/s3manager"
@@ -72,6 +76,13 @@ type Client struct {
 	config Config
 	pather namepath.Pather
 	s3     S3
+
+	creds              *rotatingProvider
+	validate           func(AuthConfig) error
+	credentialProvider backend.CredentialProvider
+	rotator            *backend.CredentialRotator
+
+	ctx context.Context
 }
 
 // Option allows setting optional Client parameters.
@@ -82,6 +93,13 @@ func WithS3(s3 S3) Option {
 	return func(c *Client) { c.s3 = s3 }
 }
 
+// WithCredentialProvider configures a Client to refresh its credentials from
+// provider, instead of from the credential rotation file. The provider must
+// return credentials in the format of UserAuthConfig.
+func WithCredentialProvider(provider backend.CredentialProvider) Option {
+	return func(c *Client) { c.credentialProvider = provider }
+}
+
 // NewClient creates a new Client for S3.
 func NewClient(
 	config Config, userAuth UserAuthConfig, opts ...Option) (*Client, error) {
@@ -109,10 +127,11 @@ func NewClient(
 	if !ok {
 		return nil, errors.New("auth not configured for username")
 	}
-	creds := credentials.NewStaticCredentials(
-		auth.S3.AccessKeyID, auth.S3.AccessSecretKey, auth.S3.SessionToken)
+	// Credentials are served by a rotating provider, such that they can be
+	// swapped without recreating the client.
+	creds := newRotatingProvider(auth)
 
-	awsConfig := aws.NewConfig().WithRegion(config.Region).WithCredentials(creds)
+	awsConfig := aws.NewConfig().WithRegion(config.Region)
 
 	if config.Endpoint != "" {
 		awsConfig = awsConfig.WithEndpoint(config.Endpoint)
@@ -126,7 +145,7 @@ func NewClient(
 		awsConfig = awsConfig.WithS3ForcePathStyle(config.S3ForcePathStyle)
 	}
 
-	api := s3.New(session.New(), awsConfig)
+	api := s3.New(session.New(), awsConfig.Copy().WithCredentials(credentials.NewCredentials(creds)))
 
 	downloader := s3manager.NewDownloaderWithClient(api, func(d *s3manager.Downloader) {
 		d.PartSize = config.DownloadPartSize
@@ -138,20 +157,44 @@ func NewClient(
 		u.Concurrency = config.UploadConcurrency
 	})
 
-	client := &Client{config, pather, join{api, downloader, uploader}}
+	client := &Client{
+		config:   config,
+		pather:   pather,
+		s3:       join{api, downloader, uploader},
+		creds:    creds,
+		validate: validateWithHeadBucket(awsConfig, config.Bucket),
+		ctx:      context.Background(),
+	}
 	for _, opt := range opts {
 		opt(client)
 	}
+	if config.CredentialRotation.Enable || client.credentialProvider != nil {
+		rotator, err := backend.NewCredentialRotator(
+			config.CredentialRotation, client.credentialProvider, client.rotate)
+		if err != nil {
+			return nil, fmt.Errorf("credential rotation: %s", err)
+		}
+		client.rotator = rotator
+		rotator.Start()
+	}
 	return client, nil
 }
 
+// BindContext returns a Client whose requests are cancelled once ctx is done.
+// Credentials are shared with c.
+func (c *Client) BindContext(ctx context.Context) backend.Client {
+	bound := *c
+	bound.ctx = ctx
+	return &bound
+}
+
 // Stat returns blob info for name.
 func (c *Client) Stat(namespace, name string) (*core.BlobInfo, error) {
 	path, err := c.pather.BlobPath(name)
 	if err != nil {
 		return nil, fmt.Errorf("blob path: %s", err)
 	}
-	output, err := c.s3.HeadObject(&s3.HeadObjectInput{
+	output, err := c.s3.HeadObjectWithContext(c.ctx, &s3.HeadObjectInput{
 		Bucket: aws.String(c.config.Bucket),
 		Key:    aws.String(path),
 	})
@@ -188,7 +231,7 @@ func (c *Client) Download(namespace, name string, dst io.Writer) error {
 		Bucket: aws.String(c.config.Bucket),
 		Key:    aws.String(path),
 	}
-	if _, err := c.s3.Download(writerAt, input); err != nil {
+	if _, err := c.s3.DownloadWithContext(c.ctx, writerAt, input); err != nil {
 		if isNotFound(err) {
 			return backenderrors.ErrBlobNotFound
 		}
@@ -215,7 +258,7 @@ func (c *Client) Upload(namespace, name string, src io.Reader) error {
 		Key:    aws.String(path),
 		Body:   src,
 	}
-	_, err = c.s3.Upload(input, func(u *s3manager.Uploader) {
+	_, err = c.s3.UploadWithContext(c.ctx, input, func(u *s3manager.Uploader) {
 		u.LeavePartsOnError = false // Delete the parts if the upload fails.
 	})
 	return err
@@ -226,6 +269,137 @@ func isNotFound(err error) bool {
 	return ok && (awsErr.Code() == s3.ErrCodeNoSuchKey || awsErr.Code() == "NotFound")
 }
 
+// Retryable returns true if err is a throttling or server-side S3 error, or a
+// transient network error.
+func (c *Client) Retryable(err error) bool {
+	if reqErr, ok := err.(awserr.RequestFailure); ok {
+		return backend.IsRetryableStatus(reqErr.StatusCode())
+	}
+	if awsErr, ok := err.(awserr.Error); ok {
+		switch awsErr.Code() {
+		case "RequestTimeout", "SlowDown", "Throttling", "ThrottlingException",
+			"RequestError", request.ErrCodeRead, request.ErrCodeResponseTimeout:
+			return true
+		}
+		if awsErr.OrigErr() != nil {
+			return backend.IsRetryable(awsErr.OrigErr())
+		}
+		return false
+	}
+	return backend.IsRetryable(err)
+}
+
+// Delete deletes name from the configured bucket. Deleting a name which does
+// not exist succeeds, since S3 does not report missing keys on delete.
+func (c *Client) Delete(namespace, name string) error {
+	path, err := c.pather.BlobPath(name)
+	if err != nil {
+		return fmt.Errorf("blob path: %s", err)
+	}
+	_, err = c.s3.DeleteObjectWithContext(c.ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(c.config.Bucket),
+		Key:    aws.String(path),
+	})
+	return err
+}
+
+// Capabilities returns support for ranged downloads, server-side copies,
+// signed URLs and deletes.
+func (c *Client) Capabilities() backend.BackendCapabilities {
+	return backend.BackendCapabilities{
+		Ranges:            true,
+		ServerSideCopy:    true,
+		SignedURLs:        true,
+		ListModifiedSince: true,
+		Deletes:           true,
+	}
+}
+
+// DownloadRange downloads length bytes of name, starting at offset, into dst.
+func (c *Client) DownloadRange(
+	namespace, name string, offset, length int64, dst io.Writer) error {
+
+	path, err := c.pather.BlobPath(name)
+	if err != nil {
+		return fmt.Errorf("blob path: %s", err)
+	}
+	output, err := c.s3.GetObjectWithContext(c.ctx, &s3.GetObjectInput{
+		Bucket: aws.String(c.config.Bucket),
+		Key:    aws.String(path),
+		Range:  aws.String(fmt.Sprintf("bytes=%d-%d", offset, offset+length-1)),
+	})
+	if err != nil {
+		if isNotFound(err) {
+			return backenderrors.ErrBlobNotFound
+		}
+		return err
+	}
+	defer output.Body.Close()
+	if _, err := io.Copy(dst, output.Body); err != nil {
+		return fmt.Errorf("copy: %s", err)
+	}
+	return nil
+}
+
+// SignedURL returns a presigned URL through which name may be downloaded until
+// ttl elapses.
+func (c *Client) SignedURL(namespace, name string, ttl time.Duration) (string, error) {
+	path, err := c.pather.BlobPath(name)
+	if err != nil {
+		return "", fmt.Errorf("blob path: %s", err)
+	}
+	req, _ := c.s3.GetObjectRequest(&s3.GetObjectInput{
+		Bucket: aws.String(c.config.Bucket),
+		Key:    aws.String(path),
+	})
+	u, err := req.Presign(ttl)
+	if err != nil {
+		return "", fmt.Errorf("presign: %s", err)
+	}
+	return u, nil
+}
+
+// CanCopyFrom returns true if src is an S3 Client of the same endpoint and
+// region, using the same credentials.
+func (c *Client) CanCopyFrom(src backend.Client) bool {
+	other, ok := src.(*Client)
+	if !ok {
+		return false
+	}
+	return other.config.Endpoint == c.config.Endpoint &&
+		other.config.Region == c.config.Region &&
+		other.config.Username == c.config.Username
+}
+
+// CopyFrom copies name from the bucket of src into the configured bucket
+// without transferring content through the client.
+func (c *Client) CopyFrom(src backend.Client, namespace, name string) error {
+	other, ok := src.(*Client)
+	if !ok || !c.CanCopyFrom(src) {
+		return errors.New("source is not in the same store")
+	}
+	srcPath, err := other.pather.BlobPath(name)
+	if err != nil {
+		return fmt.Errorf("source blob path: %s", err)
+	}
+	path, err := c.pather.BlobPath(name)
+	if err != nil {
+		return fmt.Errorf("blob path: %s", err)
+	}
+	_, err = c.s3.CopyObjectWithContext(c.ctx, &s3.CopyObjectInput{
+		Bucket:     aws.String(c.config.Bucket),
+		Key:        aws.String(path),
+		CopySource: aws.String(url.PathEscape(other.config.Bucket + "/" + srcPath)),
+	})
+	if err != nil {
+		if isNotFound(err) {
+			return backenderrors.ErrBlobNotFound
+		}
+		return err
+	}
+	return nil
+}
+
 // List lists names with start with prefix.
 func (c *Client) List(prefix string, opts ...backend.ListOption) (*backend.ListResult, error) {
 	// For whatever reason, the S3 list API does not accept an absolute path
@@ -251,7 +425,7 @@ func (c *Client) List(prefix string, opts ...backend.ListOption) (*backend.ListR
 
 	var names []string
 	nextContinuationToken := ""
-	err := c.s3.ListObjectsV2Pages(&s3.ListObjectsV2Input{
+	err := c.s3.ListObjectsV2PagesWithContext(c.ctx, &s3.ListObjectsV2Input{
 		Bucket:            aws.String(c.config.Bucket),
 		MaxKeys:           aws.Int64(maxKeys),
 		Prefix:            aws.String(path.Join(c.pather.BasePath(), prefix)[1:]),
@@ -264,6 +438,10 @@ func (c *Client) List(prefix string, opts ...backend.ListOption) (*backend.ListR
 					"object", object).Error("List encountered nil S3 object key")
 				continue
 			}
+			if !options.ModifiedSince.IsZero() && object.LastModified != nil &&
+				object.LastModified.Before(options.ModifiedSince) {
+				continue
+			}
 			name, err := c.pather.NameFromBlobPath(path.Join("/", *object.Key))
 			if err != nil {
 				log.With("key", *object.Key).Errorf("Error converting blob path into name: %s", err)
@@ -15,20 +15,34 @@ package s3backend
 
 import (
 	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/uber/kraken/core"
 	"github.com/uber/kraken/lib/backend"
+	"github.com/uber/kraken/lib/backend/backenderrors"
 	"github.com/uber/kraken/mocks/lib/backend/s3backend"
 	"github.com/uber/kraken/utils/mockutil"
 	"github.com/uber/kraken/utils/randutil"
 	"github.com/uber/kraken/utils/rwutil"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/aws/aws-sdk-go/service/s3/s3manager"
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v2"
 )
 
 type clientMocks struct {
@@ -84,6 +98,103 @@ func TestClientFactory(t *testing.T) {
 	require.NoError(err)
 }
 
+func TestClientCopyFrom(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newClientMocks(t)
+	defer cleanup()
+
+	client := mocks.new()
+
+	srcMocks, srcCleanup := newClientMocks(t)
+	defer srcCleanup()
+	srcMocks.config.Bucket = "source-bucket"
+	srcMocks.config.RootDirectory = "/source"
+	src := srcMocks.new()
+
+	mocks.s3.EXPECT().CopyObjectWithContext(gomock.Any(), &s3.CopyObjectInput{
+		Bucket:     aws.String("test-bucket"),
+		Key:        aws.String("/root/test"),
+		CopySource: aws.String("source-bucket%2F%2Fsource%2Ftest"),
+	}).Return(&s3.CopyObjectOutput{}, nil)
+
+	require.True(client.Capabilities().ServerSideCopy)
+	require.True(client.CanCopyFrom(src))
+	require.NoError(client.CopyFrom(src, core.NamespaceFixture(), "test"))
+}
+
+func TestClientSignedURL(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newClientMocks(t)
+	defer cleanup()
+
+	client := mocks.new()
+
+	// Presigning happens locally, so a real S3 client is used to build the
+	// request.
+	sess := session.Must(session.NewSession(&aws.Config{
+		Region:      aws.String("test-region"),
+		Credentials: credentials.NewStaticCredentials("accesskey", "secret", ""),
+	}))
+	mocks.s3.EXPECT().GetObjectRequest(&s3.GetObjectInput{
+		Bucket: aws.String("test-bucket"),
+		Key:    aws.String("/root/test"),
+	}).DoAndReturn(s3.New(sess).GetObjectRequest)
+
+	require.True(client.Capabilities().SignedURLs)
+	u, err := client.SignedURL(core.NamespaceFixture(), "test", 15*time.Minute)
+	require.NoError(err)
+	require.Contains(u, "test-bucket")
+	require.Contains(u, "/root/test")
+	require.Contains(u, "X-Amz-Expires=900")
+	require.Contains(u, "X-Amz-Signature=")
+}
+
+func TestClientCannotCopyFromOtherRegion(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newClientMocks(t)
+	defer cleanup()
+
+	client := mocks.new()
+
+	srcMocks, srcCleanup := newClientMocks(t)
+	defer srcCleanup()
+	srcMocks.config.Region = "other-region"
+	src := srcMocks.new()
+
+	require.False(client.CanCopyFrom(src))
+	require.False(client.CanCopyFrom(backend.NoopClient{}))
+	require.Error(client.CopyFrom(src, core.NamespaceFixture(), "test"))
+}
+
+func TestClientRetryable(t *testing.T) {
+	mocks, cleanup := newClientMocks(t)
+	defer cleanup()
+
+	client := mocks.new()
+
+	tests := []struct {
+		desc     string
+		err      error
+		expected bool
+	}{
+		{"access denied", awserr.NewRequestFailure(
+			awserr.New("AccessDenied", "", nil), http.StatusForbidden, "id"), false},
+		{"service unavailable", awserr.NewRequestFailure(
+			awserr.New("ServiceUnavailable", "", nil), http.StatusServiceUnavailable, "id"), true},
+		{"slow down", awserr.New("SlowDown", "", nil), true},
+		{"invalid parameter", awserr.New("InvalidParameter", "", nil), false},
+		{"not found", backenderrors.ErrBlobNotFound, false},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			require.Equal(t, test.expected, client.Retryable(test.err))
+		})
+	}
+}
+
 func TestClientStat(t *testing.T) {
 	require := require.New(t)
 
@@ -94,7 +205,7 @@ func TestClientStat(t *testing.T) {
 
 	var length int64 = 100
 
-	mocks.s3.EXPECT().HeadObject(&s3.HeadObjectInput{
+	mocks.s3.EXPECT().HeadObjectWithContext(gomock.Any(), &s3.HeadObjectInput{
 		Bucket: aws.String("test-bucket"),
 		Key:    aws.String("/root/test"),
 	}).Return(&s3.HeadObjectOutput{ContentLength: &length}, nil)
@@ -114,7 +225,8 @@ func TestClientDownload(t *testing.T) {
 
 	data := randutil.Text(32)
 
-	mocks.s3.EXPECT().Download(
+	mocks.s3.EXPECT().DownloadWithContext(
+		gomock.Any(),
 		mockutil.MatchWriterAt(data),
 		&s3.GetObjectInput{
 			Bucket: aws.String("test-bucket"),
@@ -137,7 +249,8 @@ func TestClientDownloadWithBuffer(t *testing.T) {
 
 	data := randutil.Text(32)
 
-	mocks.s3.EXPECT().Download(
+	mocks.s3.EXPECT().DownloadWithContext(
+		gomock.Any(),
 		mockutil.MatchWriterAt(data),
 		&s3.GetObjectInput{
 			Bucket: aws.String("test-bucket"),
@@ -151,6 +264,29 @@ func TestClientDownloadWithBuffer(t *testing.T) {
 	require.Equal(data, []byte(w))
 }
 
+func TestClientDownloadRange(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newClientMocks(t)
+	defer cleanup()
+
+	client := mocks.new()
+
+	data := randutil.Text(32)
+
+	mocks.s3.EXPECT().GetObjectWithContext(gomock.Any(), &s3.GetObjectInput{
+		Bucket: aws.String("test-bucket"),
+		Key:    aws.String("/root/test"),
+		Range:  aws.String("bytes=8-23"),
+	}).Return(&s3.GetObjectOutput{
+		Body: ioutil.NopCloser(bytes.NewReader(data[8:24])),
+	}, nil)
+
+	var b bytes.Buffer
+	require.NoError(client.DownloadRange(core.NamespaceFixture(), "test", 8, 16, &b))
+	require.Equal(data[8:24], b.Bytes())
+}
+
 func TestClientUpload(t *testing.T) {
 	require := require.New(t)
 
@@ -161,7 +297,8 @@ func TestClientUpload(t *testing.T) {
 
 	data := bytes.NewReader(randutil.Text(32))
 
-	mocks.s3.EXPECT().Upload(
+	mocks.s3.EXPECT().UploadWithContext(
+		gomock.Any(),
 		&s3manager.UploadInput{
 			Bucket: aws.String("test-bucket"),
 			Key:    aws.String("/root/test"),
@@ -173,6 +310,22 @@ func TestClientUpload(t *testing.T) {
 	require.NoError(client.Upload(core.NamespaceFixture(), "test", data))
 }
 
+func TestClientDelete(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newClientMocks(t)
+	defer cleanup()
+
+	client := mocks.new()
+
+	mocks.s3.EXPECT().DeleteObjectWithContext(gomock.Any(), &s3.DeleteObjectInput{
+		Bucket: aws.String("test-bucket"),
+		Key:    aws.String("/root/test"),
+	}).Return(&s3.DeleteObjectOutput{}, nil)
+
+	require.NoError(client.Delete(core.NamespaceFixture(), "test"))
+}
+
 func TestClientList(t *testing.T) {
 	require := require.New(t)
 
@@ -181,7 +334,8 @@ func TestClientList(t *testing.T) {
 
 	client := mocks.new()
 
-	mocks.s3.EXPECT().ListObjectsV2Pages(
+	mocks.s3.EXPECT().ListObjectsV2PagesWithContext(
+		gomock.Any(),
 		&s3.ListObjectsV2Input{
 			Bucket:            aws.String("test-bucket"),
 			MaxKeys:           aws.Int64(250),
@@ -189,8 +343,10 @@ func TestClientList(t *testing.T) {
 		},
 		gomock.Any(),
 	).DoAndReturn(func(
+		ctx context.Context,
 		input *s3.ListObjectsV2Input,
-		f func(page *s3.ListObjectsV2Output, last bool) bool) error {
+		f func(page *s3.ListObjectsV2Output, last bool) bool,
+		opts ...request.Option) error {
 
 		shouldContinue := f(&s3.ListObjectsV2Output{
 			Contents: []*s3.Object{
@@ -216,6 +372,37 @@ func TestClientList(t *testing.T) {
 	require.Equal([]string{"test/a", "test/b", "test/c", "test/d"}, result.Names)
 }
 
+func TestClientListModifiedSince(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newClientMocks(t)
+	defer cleanup()
+
+	client := mocks.new()
+
+	since := time.Now()
+
+	mocks.s3.EXPECT().ListObjectsV2PagesWithContext(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(func(
+		ctx context.Context,
+		input *s3.ListObjectsV2Input,
+		f func(page *s3.ListObjectsV2Output, last bool) bool,
+		opts ...request.Option) error {
+
+		f(&s3.ListObjectsV2Output{
+			Contents: []*s3.Object{
+				{Key: aws.String("root/test/a"), LastModified: aws.Time(since.Add(-time.Second))},
+				{Key: aws.String("root/test/b"), LastModified: aws.Time(since)},
+				{Key: aws.String("root/test/c"), LastModified: aws.Time(since.Add(time.Second))},
+			},
+		}, true)
+		return nil
+	})
+
+	result, err := client.List("test", backend.ListModifiedSince(since))
+	require.NoError(err)
+	require.Equal([]string{"test/b", "test/c"}, result.Names)
+}
+
 func TestClientListPaginated(t *testing.T) {
 	require := require.New(t)
 
@@ -224,7 +411,8 @@ func TestClientListPaginated(t *testing.T) {
 
 	client := mocks.new()
 
-	mocks.s3.EXPECT().ListObjectsV2Pages(
+	mocks.s3.EXPECT().ListObjectsV2PagesWithContext(
+		gomock.Any(),
 		&s3.ListObjectsV2Input{
 			Bucket:            aws.String("test-bucket"),
 			MaxKeys:           aws.Int64(2),
@@ -232,8 +420,10 @@ func TestClientListPaginated(t *testing.T) {
 		},
 		gomock.Any(),
 	).DoAndReturn(func(
+		ctx context.Context,
 		input *s3.ListObjectsV2Input,
-		f func(page *s3.ListObjectsV2Output, last bool) bool) error {
+		f func(page *s3.ListObjectsV2Output, last bool) bool,
+		opts ...request.Option) error {
 
 		f(&s3.ListObjectsV2Output{
 			Contents: []*s3.Object{
@@ -247,7 +437,8 @@ func TestClientListPaginated(t *testing.T) {
 		return nil
 	})
 
-	mocks.s3.EXPECT().ListObjectsV2Pages(
+	mocks.s3.EXPECT().ListObjectsV2PagesWithContext(
+		gomock.Any(),
 		&s3.ListObjectsV2Input{
 			Bucket:            aws.String("test-bucket"),
 			MaxKeys:           aws.Int64(2),
@@ -256,8 +447,10 @@ func TestClientListPaginated(t *testing.T) {
 		},
 		gomock.Any(),
 	).DoAndReturn(func(
+		ctx context.Context,
 		input *s3.ListObjectsV2Input,
-		f func(page *s3.ListObjectsV2Output, last bool) bool) error {
+		f func(page *s3.ListObjectsV2Output, last bool) bool,
+		opts ...request.Option) error {
 
 		f(&s3.ListObjectsV2Output{
 			Contents: []*s3.Object{
@@ -287,3 +480,174 @@ func TestClientListPaginated(t *testing.T) {
 	require.Equal([]string{"test/c", "test/d"}, result.Names)
 	require.Equal("", result.ContinuationToken)
 }
+
+func TestClientSignsPathStyleRequestsToCustomEndpoint(t *testing.T) {
+	require := require.New(t)
+
+	var path, authorization string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		authorization = r.Header.Get("Authorization")
+		w.Header().Set("Content-Length", "100")
+	}))
+	defer server.Close()
+
+	var auth AuthConfig
+	auth.S3.AccessKeyID = "accesskey"
+	auth.S3.AccessSecretKey = "secret"
+
+	client, err := NewClient(Config{
+		Username:         "test-user",
+		Region:           "minio-region",
+		Bucket:           "test-bucket",
+		Endpoint:         server.URL,
+		DisableSSL:       true,
+		S3ForcePathStyle: true,
+		NamePath:         "identity",
+		RootDirectory:    "/root",
+	}, UserAuthConfig{"test-user": auth})
+	require.NoError(err)
+
+	info, err := client.Stat(core.NamespaceFixture(), "test")
+	require.NoError(err)
+	require.Equal(core.NewBlobInfo(100), info)
+
+	// The bucket is addressed in the path rather than the host, and requests
+	// are signed for the configured region rather than one derived from the
+	// endpoint.
+	require.Equal("/test-bucket/root/test", path)
+	require.True(strings.HasPrefix(authorization, "AWS4-HMAC-SHA256 Credential=accesskey/"))
+	require.Contains(authorization, "/minio-region/s3/aws4_request")
+}
+
+func TestClientRotatesCredentialsWithoutFailingConcurrentOperations(t *testing.T) {
+	require := require.New(t)
+
+	// The server accepts the old and new credentials, as stores do during a
+	// rotation, and rejects anything else.
+	var mu sync.Mutex
+	seen := make(map[string]int)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization := r.Header.Get("Authorization")
+		var key string
+		for _, k := range []string{"oldkey", "newkey"} {
+			if strings.HasPrefix(authorization, "AWS4-HMAC-SHA256 Credential="+k+"/") {
+				key = k
+			}
+		}
+		if key == "" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		mu.Lock()
+		seen[key]++
+		mu.Unlock()
+		w.Header().Set("Content-Length", "100")
+	}))
+	defer server.Close()
+
+	writeAuth := func(key string) []byte {
+		var auth AuthConfig
+		auth.S3.AccessKeyID = key
+		auth.S3.AccessSecretKey = "secret"
+		b, err := yaml.Marshal(UserAuthConfig{"test-user": auth})
+		require.NoError(err)
+		return b
+	}
+
+	var current []byte
+	var currentMu sync.Mutex
+	setCurrent := func(b []byte) {
+		currentMu.Lock()
+		current = b
+		currentMu.Unlock()
+	}
+	setCurrent(writeAuth("oldkey"))
+	provider := func() ([]byte, error) {
+		currentMu.Lock()
+		defer currentMu.Unlock()
+		return current, nil
+	}
+
+	var initial UserAuthConfig
+	require.NoError(yaml.Unmarshal(writeAuth("oldkey"), &initial))
+
+	client, err := NewClient(Config{
+		Username:         "test-user",
+		Region:           "minio-region",
+		Bucket:           "test-bucket",
+		Endpoint:         server.URL,
+		DisableSSL:       true,
+		S3ForcePathStyle: true,
+		NamePath:         "identity",
+		RootDirectory:    "/root",
+	}, initial, WithCredentialProvider(provider))
+	require.NoError(err)
+	defer client.rotator.Stop()
+
+	stop := make(chan struct{})
+	errc := make(chan error, 8)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				if _, err := client.Stat(core.NamespaceFixture(), "test"); err != nil {
+					errc <- err
+					return
+				}
+			}
+		}()
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	setCurrent(writeAuth("newkey"))
+	require.NoError(client.rotator.Refresh())
+
+	mu.Lock()
+	before := seen["oldkey"]
+	mu.Unlock()
+
+	time.Sleep(50 * time.Millisecond)
+	close(stop)
+	wg.Wait()
+	close(errc)
+	for err := range errc {
+		require.NoError(err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.True(before > 0)
+	require.True(seen["newkey"] > 0)
+	// Only requests signed before the swap may still use the old key.
+	require.True(seen["oldkey"]-before <= 8)
+}
+
+func TestClientKeepsCredentialsWhichFailValidation(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newClientMocks(t)
+	defer cleanup()
+
+	client := mocks.new()
+	client.validate = func(AuthConfig) error { return errors.New("access denied") }
+
+	var auth AuthConfig
+	auth.S3.AccessKeyID = "newkey"
+	auth.S3.AccessSecretKey = "secret"
+	b, err := yaml.Marshal(UserAuthConfig{"test-user": auth})
+	require.NoError(err)
+
+	require.Error(client.rotate(b))
+
+	value, err := client.creds.Retrieve()
+	require.NoError(err)
+	require.Equal("accesskey", value.AccessKeyID)
+}
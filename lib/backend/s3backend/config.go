@@ -23,11 +23,11 @@ import (
 // parameters and authetication credentials
 type Config struct {
 	Username         string `yaml:"username"`         // IAM username for selecting credentials.
-	Region           string `yaml:"region"`           // AWS S3 region
+	Region           string `yaml:"region"`           // AWS S3 region, also used for signing requests to Endpoint
 	Bucket           string `yaml:"bucket"`           // S3 bucket
-	Endpoint         string `yaml:"endpoint"`         // S3 endpoint
+	Endpoint         string `yaml:"endpoint"`         // S3 endpoint, for S3-compatible stores such as MinIO or Ceph RGW
 	DisableSSL       bool   `yaml:"disable_ssl"`      // use clear HTTP when talking to endpoint
-	S3ForcePathStyle bool   `yaml:"force_path_style"` // use path style instead of DNS style
+	S3ForcePathStyle bool   `yaml:"force_path_style"` // use path style instead of DNS style, required by most S3-compatible stores
 
 	RootDirectory    string `yaml:"root_directory"`     // S3 root directory for docker images
 	UploadPartSize   int64  `yaml:"upload_part_size"`   // part size s3 manager uses for upload
@@ -45,6 +45,9 @@ type Config struct {
 
 	// NamePath identifies which namepath.Pather to use.
 	NamePath string `yaml:"name_path"`
+
+	// CredentialRotation refreshes the credentials of Username at runtime.
+	CredentialRotation backend.CredentialRotationConfig `yaml:"credential_rotation"`
 }
 
 // UserAuthConfig defines authentication configuration overlayed by Langley.
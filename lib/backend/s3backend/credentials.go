@@ -0,0 +1,104 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package s3backend
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"gopkg.in/yaml.v2"
+)
+
+// rotatingProvider is a credentials.Provider whose credentials can be swapped
+// at runtime. Swapped credentials are reported as expired, such that the SDK
+// retrieves them before signing the next request. Requests which were already
+// signed keep using the previous credentials.
+type rotatingProvider struct {
+	mu      sync.Mutex
+	value   credentials.Value
+	swapped bool
+}
+
+func newRotatingProvider(auth AuthConfig) *rotatingProvider {
+	return &rotatingProvider{value: credentialsValue(auth)}
+}
+
+func credentialsValue(auth AuthConfig) credentials.Value {
+	return credentials.Value{
+		AccessKeyID:     auth.S3.AccessKeyID,
+		SecretAccessKey: auth.S3.AccessSecretKey,
+		SessionToken:    auth.S3.SessionToken,
+		ProviderName:    "KrakenRotatingProvider",
+	}
+}
+
+// Retrieve returns the current credentials.
+func (p *rotatingProvider) Retrieve() (credentials.Value, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.swapped = false
+	return p.value, nil
+}
+
+// IsExpired returns true if credentials were swapped since the last Retrieve.
+func (p *rotatingProvider) IsExpired() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.swapped
+}
+
+func (p *rotatingProvider) swap(auth AuthConfig) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.value = credentialsValue(auth)
+	p.swapped = true
+}
+
+// rotate parses the credentials of the configured username from b, and swaps
+// them in once validated.
+func (c *Client) rotate(b []byte) error {
+	var userAuth UserAuthConfig
+	if err := yaml.Unmarshal(b, &userAuth); err != nil {
+		return fmt.Errorf("unmarshal s3 auth config: %s", err)
+	}
+	auth, ok := userAuth[c.config.Username]
+	if !ok {
+		return errors.New("auth not configured for username")
+	}
+	if auth.S3.AccessKeyID == "" || auth.S3.AccessSecretKey == "" {
+		return errors.New("access key id and secret required")
+	}
+	if err := c.validate(auth); err != nil {
+		return fmt.Errorf("validate: %s", err)
+	}
+	c.creds.swap(auth)
+	return nil
+}
+
+// validateWithHeadBucket checks that auth may access the configured bucket.
+func validateWithHeadBucket(awsConfig *aws.Config, bucket string) func(AuthConfig) error {
+	return func(auth AuthConfig) error {
+		config := awsConfig.Copy().WithCredentials(credentials.NewStaticCredentials(
+			auth.S3.AccessKeyID, auth.S3.AccessSecretKey, auth.S3.SessionToken))
+		_, err := s3.New(session.New(), config).HeadBucket(&s3.HeadBucketInput{
+			Bucket: aws.String(bucket),
+		})
+		return err
+	}
+}
@@ -14,27 +14,57 @@
 package s3backend
 
 import (
+	"context"
 	"io"
 
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/aws/aws-sdk-go/service/s3/s3iface"
 	"github.com/aws/aws-sdk-go/service/s3/s3manager"
 )
 
 // S3 defines the operations we use in the s3 api. Useful for mocking.
+// Operations take a context, such that in-flight requests are cancelled once
+// the context of the Client is done.
 type S3 interface {
-	HeadObject(input *s3.HeadObjectInput) (*s3.HeadObjectOutput, error)
+	HeadObjectWithContext(
+		ctx context.Context,
+		input *s3.HeadObjectInput,
+		options ...request.Option) (*s3.HeadObjectOutput, error)
 
-	Download(
+	DownloadWithContext(
+		ctx context.Context,
 		w io.WriterAt,
 		input *s3.GetObjectInput,
 		options ...func(*s3manager.Downloader)) (n int64, err error)
 
-	Upload(
+	UploadWithContext(
+		ctx context.Context,
 		input *s3manager.UploadInput,
 		options ...func(*s3manager.Uploader)) (*s3manager.UploadOutput, error)
 
-	ListObjectsV2Pages(input *s3.ListObjectsV2Input, fn func(*s3.ListObjectsV2Output, bool) bool) error
+	CopyObjectWithContext(
+		ctx context.Context,
+		input *s3.CopyObjectInput,
+		options ...request.Option) (*s3.CopyObjectOutput, error)
+
+	GetObjectWithContext(
+		ctx context.Context,
+		input *s3.GetObjectInput,
+		options ...request.Option) (*s3.GetObjectOutput, error)
+
+	DeleteObjectWithContext(
+		ctx context.Context,
+		input *s3.DeleteObjectInput,
+		options ...request.Option) (*s3.DeleteObjectOutput, error)
+
+	GetObjectRequest(input *s3.GetObjectInput) (*request.Request, *s3.GetObjectOutput)
+
+	ListObjectsV2PagesWithContext(
+		ctx context.Context,
+		input *s3.ListObjectsV2Input,
+		fn func(*s3.ListObjectsV2Output, bool) bool,
+		options ...request.Option) error
 }
 
 type join struct {
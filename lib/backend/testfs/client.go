@@ -14,10 +14,12 @@
 package testfs
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"net/http"
 	"path"
 	"strconv"
 
@@ -58,6 +60,7 @@ func (f *factory) Create(
 type Client struct {
 	config Config
 	pather namepath.Pather
+	ctx    context.Context
 }
 
 // NewClient returns a new Client.
@@ -69,7 +72,12 @@ func NewClient(config Config) (*Client, error) {
 	if err != nil {
 		return nil, fmt.Errorf("namepath: %s", err)
 	}
-	return &Client{config, pather}, nil
+	return &Client{config, pather, context.Background()}, nil
+}
+
+// BindContext returns a Client whose requests are cancelled once ctx is done.
+func (c *Client) BindContext(ctx context.Context) backend.Client {
+	return &Client{c.config, c.pather, ctx}
 }
 
 // Addr returns the configured server address.
@@ -84,7 +92,8 @@ func (c *Client) Stat(namespace, name string) (*core.BlobInfo, error) {
 		return nil, fmt.Errorf("pather: %s", err)
 	}
 	resp, err := httputil.Head(
-		fmt.Sprintf("http://%s/files/%s", c.config.Addr, p))
+		fmt.Sprintf("http://%s/files/%s", c.config.Addr, p),
+		httputil.SendContext(c.ctx))
 	if err != nil {
 		if httputil.IsNotFound(err) {
 			return nil, backenderrors.ErrBlobNotFound
@@ -106,7 +115,8 @@ func (c *Client) Upload(namespace, name string, src io.Reader) error {
 	}
 	_, err = httputil.Post(
 		fmt.Sprintf("http://%s/files/%s", c.config.Addr, p),
-		httputil.SendBody(src))
+		httputil.SendBody(src),
+		httputil.SendContext(c.ctx))
 	return err
 }
 
@@ -117,7 +127,34 @@ func (c *Client) Download(namespace, name string, dst io.Writer) error {
 		return fmt.Errorf("pather: %s", err)
 	}
 	resp, err := httputil.Get(
-		fmt.Sprintf("http://%s/files/%s", c.config.Addr, p))
+		fmt.Sprintf("http://%s/files/%s", c.config.Addr, p),
+		httputil.SendContext(c.ctx))
+	if err != nil {
+		if httputil.IsNotFound(err) {
+			return backenderrors.ErrBlobNotFound
+		}
+		return err
+	}
+	defer resp.Body.Close()
+	if _, err := io.Copy(dst, resp.Body); err != nil {
+		return fmt.Errorf("copy: %s", err)
+	}
+	return nil
+}
+
+// DownloadRange downloads length bytes of name, starting at offset, to dst.
+func (c *Client) DownloadRange(namespace, name string, offset, length int64, dst io.Writer) error {
+	p, err := c.pather.BlobPath(name)
+	if err != nil {
+		return fmt.Errorf("pather: %s", err)
+	}
+	resp, err := httputil.Get(
+		fmt.Sprintf("http://%s/files/%s", c.config.Addr, p),
+		httputil.SendHeaders(map[string]string{
+			"Range": fmt.Sprintf("bytes=%d-%d", offset, offset+length-1),
+		}),
+		httputil.SendAcceptedCodes(http.StatusPartialContent),
+		httputil.SendContext(c.ctx))
 	if err != nil {
 		if httputil.IsNotFound(err) {
 			return backenderrors.ErrBlobNotFound
@@ -131,6 +168,26 @@ func (c *Client) Download(namespace, name string, dst io.Writer) error {
 	return nil
 }
 
+// Delete deletes name.
+func (c *Client) Delete(namespace, name string) error {
+	p, err := c.pather.BlobPath(name)
+	if err != nil {
+		return fmt.Errorf("pather: %s", err)
+	}
+	_, err = httputil.Delete(
+		fmt.Sprintf("http://%s/files/%s", c.config.Addr, p),
+		httputil.SendContext(c.ctx))
+	if err != nil && httputil.IsNotFound(err) {
+		return backenderrors.ErrBlobNotFound
+	}
+	return err
+}
+
+// Capabilities returns support for ranged downloads and deletes.
+func (c *Client) Capabilities() backend.BackendCapabilities {
+	return backend.BackendCapabilities{Ranges: true, Deletes: true}
+}
+
 // List lists names starting with prefix.
 func (c *Client) List(prefix string, opts ...backend.ListOption) (*backend.ListResult, error) {
 	options := backend.DefaultListOptions()
@@ -143,7 +200,8 @@ func (c *Client) List(prefix string, opts ...backend.ListOption) (*backend.ListR
 	}
 
 	resp, err := httputil.Get(
-		fmt.Sprintf("http://%s/list/%s", c.config.Addr, path.Join(c.pather.BasePath(), prefix)))
+		fmt.Sprintf("http://%s/list/%s", c.config.Addr, path.Join(c.pather.BasePath(), prefix)),
+		httputil.SendContext(c.ctx))
 	if err != nil {
 		return nil, err
 	}
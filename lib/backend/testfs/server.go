@@ -24,6 +24,7 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/uber/kraken/utils/handler"
 
@@ -52,6 +53,7 @@ func (s *Server) Handler() http.Handler {
 	r.Head("/files/*", handler.Wrap(s.statHandler))
 	r.Get("/files/*", handler.Wrap(s.downloadHandler))
 	r.Post("/files/*", handler.Wrap(s.uploadHandler))
+	r.Delete("/files/*", handler.Wrap(s.deleteHandler))
 	r.Get("/list/*", handler.Wrap(s.listHandler))
 	return r
 }
@@ -96,9 +98,10 @@ func (s *Server) downloadHandler(w http.ResponseWriter, r *http.Request) error {
 		}
 		return handler.Errorf("open: %s", err)
 	}
-	if _, err := io.Copy(w, f); err != nil {
-		return handler.Errorf("copy: %s", err)
-	}
+	defer f.Close()
+
+	// ServeContent handles Range requests.
+	http.ServeContent(w, r, name, time.Time{}, f)
 	return nil
 }
 
@@ -123,6 +126,21 @@ func (s *Server) uploadHandler(w http.ResponseWriter, r *http.Request) error {
 	return nil
 }
 
+func (s *Server) deleteHandler(w http.ResponseWriter, r *http.Request) error {
+	s.Lock()
+	defer s.Unlock()
+
+	name := r.URL.Path[len("/files/"):]
+
+	if err := os.Remove(s.path(name)); err != nil {
+		if os.IsNotExist(err) {
+			return handler.ErrorStatus(http.StatusNotFound)
+		}
+		return handler.Errorf("remove: %s", err)
+	}
+	return nil
+}
+
 func (s *Server) listHandler(w http.ResponseWriter, r *http.Request) error {
 	s.RLock()
 	defer s.RUnlock()
@@ -132,6 +150,10 @@ func (s *Server) listHandler(w http.ResponseWriter, r *http.Request) error {
 	var paths []string
 	err := filepath.Walk(prefix, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
+			if path == prefix && os.IsNotExist(err) {
+				// Like object stores, list missing prefixes as empty.
+				return nil
+			}
 			return err
 		}
 		if info.IsDir() {
@@ -54,6 +54,28 @@ func TestServerBlob(t *testing.T) {
 	require.Equal(int64(len(blob.Content)), info.Size)
 }
 
+func TestServerBlobRange(t *testing.T) {
+	require := require.New(t)
+
+	s := NewServer()
+	defer s.Cleanup()
+
+	addr, stop := testutil.StartServer(s.Handler())
+	defer stop()
+
+	c, err := NewClient(Config{Addr: addr, NamePath: namepath.Identity})
+	require.NoError(err)
+
+	blob := core.SizedBlobFixture(64, 8)
+	ns := core.NamespaceFixture()
+
+	require.NoError(c.Upload(ns, blob.Digest.Hex(), bytes.NewReader(blob.Content)))
+
+	var b bytes.Buffer
+	require.NoError(c.DownloadRange(ns, blob.Digest.Hex(), 10, 20, &b))
+	require.Equal(blob.Content[10:30], b.Bytes())
+}
+
 func TestServerTag(t *testing.T) {
 	require := require.New(t)
 
@@ -14,7 +14,9 @@
 package backend
 
 import (
+	"context"
 	"io"
+	"time"
 
 	"github.com/uber/kraken/lib/store"
 	"github.com/uber/kraken/utils/bandwidth"
@@ -33,6 +35,12 @@ func throttle(client Client, bandwidth *bandwidth.Limiter) *ThrottledClient {
 	return &ThrottledClient{client, bandwidth}
 }
 
+// BindContext binds the wrapped client to ctx. The bandwidth limits are shared
+// with c.
+func (c *ThrottledClient) BindContext(ctx context.Context) Client {
+	return &ThrottledClient{bindContext(ctx, c.Client), c.bandwidth}
+}
+
 type sizer interface {
 	Size() int64
 }
@@ -65,6 +73,60 @@ func (c *ThrottledClient) Download(namespace, name string, dst io.Writer) error
 	return c.Client.Download(namespace, name, dst)
 }
 
+// DownloadRange downloads length bytes of name, starting at offset, into dst.
+func (c *ThrottledClient) DownloadRange(
+	namespace, name string, offset, length int64, dst io.Writer) error {
+
+	if err := c.bandwidth.ReserveIngress(length); err != nil {
+		log.With("name", name).Errorf("Error reserving ingress: %s", err)
+		// Ignore error.
+	}
+	return downloadRange(c.Client, namespace, name, offset, length, dst)
+}
+
+// UploadIfAbsent uploads src into name if name does not exist.
+func (c *ThrottledClient) UploadIfAbsent(namespace, name string, src io.Reader) error {
+	if s, ok := src.(sizer); ok {
+		if err := c.bandwidth.ReserveEgress(s.Size()); err != nil {
+			log.With("name", name).Errorf("Error reserving egress: %s", err)
+			// Ignore error.
+		}
+	}
+	return uploadIfAbsent(c.Client, namespace, name, src)
+}
+
+// CanCopyFrom returns true if the wrapped client can copy from src.
+func (c *ThrottledClient) CanCopyFrom(src Client) bool {
+	return canCopyFrom(c.Client, src)
+}
+
+// CopyFrom copies name from src into name. Native copies do not transfer
+// content through the client, so they are not throttled.
+func (c *ThrottledClient) CopyFrom(src Client, namespace, name string) error {
+	return copyFrom(c.Client, src, namespace, name)
+}
+
+// SignedURL returns a URL through which name may be downloaded until ttl
+// elapses.
+func (c *ThrottledClient) SignedURL(namespace, name string, ttl time.Duration) (string, error) {
+	return signedURL(c.Client, namespace, name, ttl)
+}
+
+// Delete deletes name.
+func (c *ThrottledClient) Delete(namespace, name string) error {
+	return deleteBlob(c.Client, namespace, name)
+}
+
+// Capabilities returns the optional features of the wrapped client.
+func (c *ThrottledClient) Capabilities() BackendCapabilities {
+	return c.Client.Capabilities()
+}
+
+// Unwrap returns the wrapped client.
+func (c *ThrottledClient) Unwrap() Client {
+	return c.Client
+}
+
 func (c *ThrottledClient) adjustBandwidth(denominator int) error {
 	return c.bandwidth.Adjust(denominator)
 }
@@ -13,11 +13,19 @@
 // limitations under the License.
 package blobrefresh
 
-import "github.com/c2h5oh/datasize"
+import (
+	"github.com/uber/kraken/lib/backend"
+
+	"github.com/c2h5oh/datasize"
+)
 
 // Config defines Refresher configuration.
 type Config struct {
 	// Limits the size of blobs which origin will accept. A 0 size limit means
 	// blob size is unbounded.
 	SizeLimit datasize.ByteSize `yaml:"size_limit"`
+
+	// Prefetch enables concurrent read-ahead for backends which support ranged
+	// downloads, which speeds up cold downloads over high-latency links.
+	Prefetch backend.PrefetchConfig `yaml:"prefetch"`
 }
@@ -51,7 +51,7 @@ type Refresher struct {
 	config            Config
 	stats             tally.Scope
 	requests          *dedup.RequestCache
-	cas               *store.CAStore
+	cas               store.Driver
 	backends          *backend.Manager
 	metaInfoGenerator *metainfogen.Generator
 }
@@ -60,7 +60,7 @@ type Refresher struct {
 func New(
 	config Config,
 	stats tally.Scope,
-	cas *store.CAStore,
+	cas store.Driver,
 	backends *backend.Manager,
 	metaInfoGenerator *metainfogen.Generator) *Refresher {
 
@@ -100,10 +100,9 @@ func (r *Refresher) Refresh(namespace string, d core.Digest, hooks ...PostHook)
 		return fmt.Errorf("%s blob exceeds size limit of %s", size, r.config.SizeLimit)
 	}
 
-	id := namespace + ":" + d.Hex()
-	err = r.requests.Start(id, func() error {
+	err = r.requests.Start(requestID(namespace, d), func() error {
 		start := time.Now()
-		if err := r.download(client, namespace, d); err != nil {
+		if err := r.download(client, namespace, d, info.Size); err != nil {
 			return err
 		}
 		t := time.Since(start)
@@ -134,9 +133,25 @@ func (r *Refresher) Refresh(namespace string, d core.Digest, hooks ...PostHook)
 	}
 }
 
-func (r *Refresher) download(client backend.Client, namespace string, d core.Digest) error {
+// Pending returns true if a download of d from namespace's backend is running.
+func (r *Refresher) Pending(namespace string, d core.Digest) bool {
+	return r.requests.Pending(requestID(namespace, d))
+}
+
+func requestID(namespace string, d core.Digest) string {
+	return namespace + ":" + d.Hex()
+}
+
+func (r *Refresher) download(
+	client backend.Client, namespace string, d core.Digest, size int64) error {
+
 	name := d.Hex()
-	return r.cas.WriteCacheFile(name, func(w store.FileReadWriter) error {
+	return r.cas.WriteCacheFileInNamespace(namespace, name, func(w store.FileReadWriter) error {
+		// Blobs of unknown size are downloaded whole.
+		if r.config.Prefetch.Enabled && size > 0 && client.Capabilities().Ranges {
+			return backend.Prefetch(
+				r.config.Prefetch, client.(backend.RangeClient), namespace, name, size, w)
+		}
 		return client.Download(namespace, name, w)
 	})
 }
@@ -37,7 +37,7 @@ const _testPieceLength = 10
 
 type refresherMocks struct {
 	ctrl     *gomock.Controller
-	cas      *store.CAStore
+	cas      store.Driver
 	backends *backend.Manager
 	config   Config
 }
@@ -46,8 +46,7 @@ func newRefresherMocks(t *testing.T) (*refresherMocks, func()) {
 	var cleanup testutil.Cleanup
 	defer cleanup.Recover()
 
-	cas, c := store.CAStoreFixture()
-	cleanup.Add(c)
+	cas := store.NewMemoryDriver()
 
 	ctrl := gomock.NewController(t)
 	cleanup.Add(ctrl.Finish)
@@ -100,6 +99,34 @@ func TestRefresh(t *testing.T) {
 	require.Equal(blob.MetaInfo, tm.MetaInfo)
 }
 
+func TestRefreshPrefetchRequiresRangesCapability(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newRefresherMocks(t)
+	defer cleanup()
+
+	mocks.config.Prefetch.Enabled = true
+
+	refresher := mocks.new()
+
+	namespace := core.TagFixture()
+	client := mocks.newClient(namespace)
+
+	blob := core.SizedBlobFixture(100, uint64(_testPieceLength))
+
+	// Client does not support ranges, so refresher falls back to plain download.
+	client.EXPECT().Capabilities().Return(backend.BackendCapabilities{}).AnyTimes()
+	client.EXPECT().Stat(namespace, blob.Digest.Hex()).Return(core.NewBlobInfo(int64(len(blob.Content))), nil)
+	client.EXPECT().Download(namespace, blob.Digest.Hex(), mockutil.MatchWriter(blob.Content)).Return(nil)
+
+	require.NoError(refresher.Refresh(namespace, blob.Digest))
+
+	require.NoError(testutil.PollUntilTrue(5*time.Second, func() bool {
+		_, err := mocks.cas.GetCacheFileStat(blob.Digest.Hex())
+		return !os.IsNotExist(err)
+	}))
+}
+
 func TestRefreshSizeLimitError(t *testing.T) {
 	require := require.New(t)
 
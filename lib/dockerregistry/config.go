@@ -20,6 +20,11 @@ import (
 	"github.com/docker/distribution/context"
 	"github.com/docker/distribution/registry"
 	"github.com/uber-go/tally"
+
+	// Access controllers which may be configured under docker.auth, such that
+	// clients are challenged to authenticate against the registry.
+	_ "github.com/docker/distribution/registry/auth/htpasswd"
+	_ "github.com/docker/distribution/registry/auth/token"
 )
 
 const (
@@ -0,0 +1,142 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package dockerregistry
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/docker/distribution/configuration"
+	"github.com/docker/distribution/manifest/schema2"
+	"github.com/docker/distribution/registry/handlers"
+	"github.com/stretchr/testify/require"
+	"github.com/uber-go/tally"
+)
+
+// newTestRegistry serves the Registry v2 API backed by d, the same way agents
+// and proxies do through Config.Build.
+func newTestRegistry(d *testDriver, auth configuration.Auth) *httptest.Server {
+	var config Config
+	config.Docker.Auth = auth
+	config.Docker.Storage = configuration.Storage{
+		Name: config.ReadWriteParameters(d.transferer, d.cas, tally.NoopScope),
+		"redirect": configuration.Parameters{
+			"disable": true,
+		},
+	}
+	return httptest.NewServer(handlers.NewApp(context.Background(), &config.Docker))
+}
+
+func TestRegistryPing(t *testing.T) {
+	require := require.New(t)
+
+	td, cleanup := newTestDriver()
+	defer cleanup()
+
+	s := newTestRegistry(td, nil)
+	defer s.Close()
+
+	resp, err := http.Get(s.URL + "/v2/")
+	require.NoError(err)
+	defer resp.Body.Close()
+	require.Equal(http.StatusOK, resp.StatusCode)
+	require.Equal("registry/2.0", resp.Header.Get("Docker-Distribution-API-Version"))
+}
+
+func TestRegistryPingAuthChallenge(t *testing.T) {
+	require := require.New(t)
+
+	td, cleanup := newTestDriver()
+	defer cleanup()
+
+	dir, err := ioutil.TempDir("", "registry-auth")
+	require.NoError(err)
+	defer os.RemoveAll(dir)
+
+	s := newTestRegistry(td, configuration.Auth{
+		"htpasswd": configuration.Parameters{
+			"realm": "kraken",
+			"path":  filepath.Join(dir, "htpasswd"),
+		},
+	})
+	defer s.Close()
+
+	resp, err := http.Get(s.URL + "/v2/")
+	require.NoError(err)
+	defer resp.Body.Close()
+	require.Equal(http.StatusUnauthorized, resp.StatusCode)
+	require.Equal(`Basic realm="kraken"`, resp.Header.Get("WWW-Authenticate"))
+}
+
+func TestRegistryGetManifest(t *testing.T) {
+	require := require.New(t)
+
+	td, cleanup := newTestDriver()
+	defer cleanup()
+
+	_, bundle := td.setup()
+
+	s := newTestRegistry(td, nil)
+	defer s.Close()
+
+	req, err := http.NewRequest(
+		"GET", fmt.Sprintf("%s/v2/%s/manifests/%s", s.URL, bundle.repo, bundle.tag), nil)
+	require.NoError(err)
+	req.Header.Set("Accept", schema2.MediaTypeManifest)
+
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(err)
+	defer resp.Body.Close()
+	require.Equal(http.StatusOK, resp.StatusCode)
+	require.Equal(schema2.MediaTypeManifest, resp.Header.Get("Content-Type"))
+	require.Equal("sha256:"+bundle.manifest, resp.Header.Get("Docker-Content-Digest"))
+
+	b, err := ioutil.ReadAll(resp.Body)
+	require.NoError(err)
+	raw, err := td.cas.GetCacheFileReader(bundle.manifest)
+	require.NoError(err)
+	defer raw.Close()
+	expected, err := ioutil.ReadAll(raw)
+	require.NoError(err)
+	require.Equal(string(expected), string(b))
+}
+
+func TestRegistryGetBlob(t *testing.T) {
+	require := require.New(t)
+
+	td, cleanup := newTestDriver()
+	defer cleanup()
+
+	_, bundle := td.setup()
+
+	s := newTestRegistry(td, nil)
+	defer s.Close()
+
+	resp, err := http.Get(
+		fmt.Sprintf("%s/v2/%s/blobs/%s", s.URL, bundle.repo, bundle.layer1.Digest))
+	require.NoError(err)
+	defer resp.Body.Close()
+	require.Equal(http.StatusOK, resp.StatusCode)
+	require.Equal(bundle.layer1.Digest.String(), resp.Header.Get("Docker-Content-Digest"))
+
+	b, err := ioutil.ReadAll(resp.Body)
+	require.NoError(err)
+	require.Equal(bundle.layer1.Content, b)
+}
@@ -93,7 +93,7 @@ func (t *ReadWriteTransferer) Download(namespace string, d core.Digest) (store.F
 
 func (t *ReadWriteTransferer) downloadFromOrigin(namespace string, d core.Digest) (store.FileReader, error) {
 	tmp := fmt.Sprintf("%s.%s", d.Hex(), uuid.Generate().String())
-	if err := t.cas.CreateUploadFile(tmp, 0); err != nil {
+	if err := t.cas.CreateUploadFileInNamespace(namespace, tmp, 0); err != nil {
 		return nil, fmt.Errorf("create upload file: %s", err)
 	}
 	w, err := t.cas.GetUploadFileReadWriter(tmp)
@@ -0,0 +1,296 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package faults
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/uber/kraken/utils/handler"
+	"github.com/uber/kraken/utils/httputil"
+
+	"github.com/pressly/chi"
+	"github.com/uber-go/tally"
+)
+
+// Actions of fault injection rules.
+const (
+	ActionFail    = "fail"
+	ActionDelay   = "delay"
+	ActionCorrupt = "corrupt"
+)
+
+// Config defines fault injection configuration. Fault injection is meant for
+// chaos testing only, and is entirely inert unless enabled.
+type Config struct {
+	Enabled bool `yaml:"enabled"`
+
+	// Seed seeds the random source which decides whether rules apply, such that
+	// sequences of injected faults are reproducible.
+	Seed int64 `yaml:"seed"`
+
+	// Rules are the initial rules, which may be replaced at runtime via the
+	// admin endpoint.
+	Rules []Rule `yaml:"rules"`
+}
+
+// Rule injects a fault into operations matching Target and Key.
+type Rule struct {
+	// Target is a regular expression matching operation names, e.g.
+	// "backend.download" or "replication.dispatch".
+	Target string `yaml:"target" json:"target"`
+
+	// Key is an optional regular expression matching the operation key, e.g.
+	// the backend namespace or the replication destination.
+	Key string `yaml:"key" json:"key"`
+
+	// Action is one of "fail", "delay" or "corrupt".
+	Action string `yaml:"action" json:"action"`
+
+	// Probability of the rule applying to a matching operation. Defaults to 1.
+	Probability float64 `yaml:"probability" json:"probability"`
+
+	// Delay is the duration delayed operations are stalled for.
+	Delay time.Duration `yaml:"delay" json:"delay"`
+
+	// Status is the HTTP status failed operations report. Defaults to 503, such
+	// that injected failures are treated as transient.
+	Status int `yaml:"status" json:"status"`
+
+	// Limit bounds the number of times the rule applies, e.g. to fail only the
+	// first attempts of an operation. Unlimited if 0.
+	Limit int `yaml:"limit" json:"limit"`
+}
+
+func (r Rule) applyDefaults() Rule {
+	if r.Probability == 0 {
+		r.Probability = 1
+	}
+	if r.Status == 0 {
+		r.Status = http.StatusServiceUnavailable
+	}
+	return r
+}
+
+// _faultMethod marks the StatusErrors of injected failures.
+const _faultMethod = "FAULT"
+
+type rule struct {
+	Rule
+	target  *regexp.Regexp
+	key     *regexp.Regexp
+	applied int
+}
+
+func compile(r Rule) (*rule, error) {
+	r = r.applyDefaults()
+	switch r.Action {
+	case ActionFail, ActionDelay, ActionCorrupt:
+	default:
+		return nil, fmt.Errorf("invalid action: %q", r.Action)
+	}
+	if r.Probability < 0 || r.Probability > 1 {
+		return nil, fmt.Errorf("invalid probability: %f", r.Probability)
+	}
+	target, err := regexp.Compile(r.Target)
+	if err != nil {
+		return nil, fmt.Errorf("target: %s", err)
+	}
+	key, err := regexp.Compile(r.Key)
+	if err != nil {
+		return nil, fmt.Errorf("key: %s", err)
+	}
+	return &rule{Rule: r, target: target, key: key}, nil
+}
+
+// Injector injects faults into operations according to its rules. A nil
+// Injector never injects faults, such that hooks are no-ops unless fault
+// injection is enabled.
+type Injector struct {
+	stats tally.Scope
+
+	mu    sync.Mutex
+	rand  *rand.Rand
+	rules []*rule
+}
+
+// New creates a new Injector. Returns nil if fault injection is disabled.
+func New(config Config, stats tally.Scope) (*Injector, error) {
+	if !config.Enabled {
+		return nil, nil
+	}
+	i := &Injector{
+		stats: stats.Tagged(map[string]string{
+			"module": "faults",
+		}),
+		rand: rand.New(rand.NewSource(config.Seed)),
+	}
+	if err := i.SetRules(config.Rules); err != nil {
+		return nil, err
+	}
+	return i, nil
+}
+
+// Rules returns the current rules.
+func (i *Injector) Rules() []Rule {
+	if i == nil {
+		return nil
+	}
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	rules := []Rule{}
+	for _, r := range i.rules {
+		rules = append(rules, r.Rule)
+	}
+	return rules
+}
+
+// SetRules replaces the current rules.
+func (i *Injector) SetRules(rules []Rule) error {
+	var compiled []*rule
+	for j, r := range rules {
+		c, err := compile(r)
+		if err != nil {
+			return fmt.Errorf("rule %d: %s", j, err)
+		}
+		compiled = append(compiled, c)
+	}
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.rules = compiled
+	return nil
+}
+
+// triggered returns the rules of action which apply to an operation.
+func (i *Injector) triggered(action, target, key string) []Rule {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	var rules []Rule
+	for _, r := range i.rules {
+		if r.Action != action || !r.target.MatchString(target) || !r.key.MatchString(key) {
+			continue
+		}
+		if r.Limit > 0 && r.applied >= r.Limit {
+			continue
+		}
+		if i.rand.Float64() >= r.Probability {
+			continue
+		}
+		r.applied++
+		i.stats.Tagged(map[string]string{
+			"target": target,
+			"action": action,
+		}).Counter("injected_faults").Inc(1)
+		rules = append(rules, r.Rule)
+	}
+	return rules
+}
+
+// Fault stalls the operation named target if a delay rule applies, and returns
+// an error if a fail rule applies. Injected failures are httputil.StatusErrors.
+func (i *Injector) Fault(target, key string) error {
+	if i == nil {
+		return nil
+	}
+	for _, r := range i.triggered(ActionDelay, target, key) {
+		time.Sleep(r.Delay)
+	}
+	for _, r := range i.triggered(ActionFail, target, key) {
+		return httputil.StatusError{
+			Method: _faultMethod,
+			URL:    fmt.Sprintf("%s/%s", target, key),
+			Status: r.Status,
+		}
+	}
+	return nil
+}
+
+// IsFault returns true if err was injected by an Injector.
+func IsFault(err error) bool {
+	statusErr, ok := err.(httputil.StatusError)
+	return ok && statusErr.Method == _faultMethod
+}
+
+// Corrupt returns a writer which corrupts the data written by the operation
+// named target if a corrupt rule applies, else returns w.
+func (i *Injector) Corrupt(target, key string, w io.Writer) io.Writer {
+	if i == nil {
+		return w
+	}
+	if len(i.triggered(ActionCorrupt, target, key)) == 0 {
+		return w
+	}
+	return &corruptWriter{w: w}
+}
+
+// corruptWriter flips the bits of the first byte written to w.
+type corruptWriter struct {
+	w       io.Writer
+	flipped bool
+}
+
+func (w *corruptWriter) Write(b []byte) (int, error) {
+	if w.flipped || len(b) == 0 {
+		return w.w.Write(b)
+	}
+	w.flipped = true
+	c := make([]byte, len(b))
+	copy(c, b)
+	c[0] = ^c[0]
+	return w.w.Write(c)
+}
+
+// Handler returns an http handler which serves the current rules on GET, and
+// replaces them with the JSON-encoded rules of the request body on PUT.
+func (i *Injector) Handler() http.Handler {
+	r := chi.NewRouter()
+	r.Get("/", handler.Wrap(func(w http.ResponseWriter, r *http.Request) error {
+		if err := json.NewEncoder(w).Encode(i.Rules()); err != nil {
+			return handler.Errorf("json encode: %s", err)
+		}
+		return nil
+	}))
+	r.Put("/", handler.Wrap(func(w http.ResponseWriter, r *http.Request) error {
+		var rules []Rule
+		if err := json.NewDecoder(r.Body).Decode(&rules); err != nil {
+			return handler.Errorf("json decode: %s", err).Status(http.StatusBadRequest)
+		}
+		if err := i.SetRules(rules); err != nil {
+			return handler.Errorf("set rules: %s", err).Status(http.StatusBadRequest)
+		}
+		return nil
+	}))
+	return r
+}
+
+// Mount mounts the admin endpoint of i at /admin/faults in front of h. Returns
+// h as is if i is nil.
+func (i *Injector) Mount(h http.Handler) http.Handler {
+	if i == nil {
+		return h
+	}
+	r := chi.NewRouter()
+	r.Mount("/admin/faults", i.Handler())
+	r.Mount("/", h)
+	return r
+}
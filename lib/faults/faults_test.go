@@ -0,0 +1,151 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package faults
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/uber-go/tally"
+)
+
+func newInjector(t *testing.T, rules ...Rule) *Injector {
+	i, err := New(Config{Enabled: true, Rules: rules}, tally.NoopScope)
+	require.NoError(t, err)
+	return i
+}
+
+func TestDisabledInjectorIsInert(t *testing.T) {
+	require := require.New(t)
+
+	i, err := New(Config{Rules: []Rule{{Target: ".*", Action: ActionFail}}}, tally.NoopScope)
+	require.NoError(err)
+	require.Nil(i)
+
+	var b bytes.Buffer
+	require.NoError(i.Fault("backend.download", "ns"))
+	require.Equal(&b, i.Corrupt("backend.download", "ns", &b))
+	require.Empty(i.Rules())
+}
+
+func TestFaultMatchesTargetAndKey(t *testing.T) {
+	require := require.New(t)
+
+	i := newInjector(t, Rule{Target: "^backend.download$", Key: "^foo/", Action: ActionFail})
+
+	err := i.Fault("backend.download", "foo/bar")
+	require.Error(err)
+	require.True(IsFault(err))
+
+	require.NoError(i.Fault("backend.upload", "foo/bar"))
+	require.NoError(i.Fault("backend.download", "baz"))
+}
+
+func TestFaultLimit(t *testing.T) {
+	require := require.New(t)
+
+	i := newInjector(t, Rule{Target: ".*", Action: ActionFail, Limit: 2})
+
+	require.Error(i.Fault("op", ""))
+	require.Error(i.Fault("op", ""))
+	require.NoError(i.Fault("op", ""))
+}
+
+func TestFaultProbabilityIsDeterministicForSeed(t *testing.T) {
+	require := require.New(t)
+
+	results := func() []bool {
+		i, err := New(Config{
+			Enabled: true,
+			Seed:    7,
+			Rules:   []Rule{{Target: ".*", Action: ActionFail, Probability: 0.5}},
+		}, tally.NoopScope)
+		require.NoError(err)
+		var failed []bool
+		for j := 0; j < 20; j++ {
+			failed = append(failed, i.Fault("op", "") != nil)
+		}
+		return failed
+	}
+	first := results()
+	require.Equal(first, results())
+	require.Contains(first, true)
+	require.Contains(first, false)
+}
+
+func TestFaultDelay(t *testing.T) {
+	require := require.New(t)
+
+	i := newInjector(t, Rule{Target: ".*", Action: ActionDelay, Delay: 50 * time.Millisecond})
+
+	start := time.Now()
+	require.NoError(i.Fault("op", ""))
+	require.True(time.Since(start) >= 50*time.Millisecond)
+}
+
+func TestCorrupt(t *testing.T) {
+	require := require.New(t)
+
+	i := newInjector(t, Rule{Target: ".*", Action: ActionCorrupt})
+
+	var b bytes.Buffer
+	_, err := i.Corrupt("op", "", &b).Write([]byte("content"))
+	require.NoError(err)
+	require.NotEqual("content", b.String())
+	require.Equal("ontent", b.String()[1:])
+}
+
+func TestSetRulesRejectsInvalidRules(t *testing.T) {
+	require := require.New(t)
+
+	i := newInjector(t)
+
+	require.Error(i.SetRules([]Rule{{Target: ".*", Action: "explode"}}))
+	require.Error(i.SetRules([]Rule{{Target: "(", Action: ActionFail}}))
+	require.Error(i.SetRules([]Rule{{Target: ".*", Action: ActionFail, Probability: 2}}))
+}
+
+func TestHandlerReplacesRules(t *testing.T) {
+	require := require.New(t)
+
+	i := newInjector(t)
+	h := i.Mount(http.NotFoundHandler())
+
+	rules := []Rule{{Target: "replication.dispatch", Action: ActionFail}}
+	b, err := json.Marshal(rules)
+	require.NoError(err)
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("PUT", "/admin/faults", bytes.NewReader(b)))
+	require.Equal(http.StatusOK, w.Code)
+	require.Error(i.Fault("replication.dispatch", "remote"))
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/admin/faults", nil))
+	require.Equal(http.StatusOK, w.Code)
+	var result []Rule
+	require.NoError(json.NewDecoder(w.Body).Decode(&result))
+	require.Len(result, 1)
+	require.Equal(http.StatusServiceUnavailable, result[0].Status)
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("PUT", "/admin/faults", bytes.NewReader([]byte("[]"))))
+	require.Equal(http.StatusOK, w.Code)
+	require.NoError(i.Fault("replication.dispatch", "remote"))
+}
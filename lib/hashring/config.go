@@ -25,6 +25,12 @@ type Config struct {
 	// RefreshInterval is the interval at which membership / health information
 	// is refreshed during monitoring.
 	RefreshInterval time.Duration `yaml:"refresh_interval"`
+
+	// Weights scales the share of blobs owned by addresses, e.g. by their disk
+	// or bandwidth capacity, keyed by address. Addresses without weights
+	// default to 100. Every ring of the same cluster must be configured with
+	// the same weights, else rings disagree on which addresses own blobs.
+	Weights map[string]int `yaml:"weights"`
 }
 
 func (c *Config) applyDefaults() {
@@ -35,3 +41,10 @@ func (c *Config) applyDefaults() {
 		c.RefreshInterval = 10 * time.Second
 	}
 }
+
+func (c *Config) weight(addr string) int {
+	if w, ok := c.Weights[addr]; ok && w > 0 {
+		return w
+	}
+	return _defaultWeight
+}
@@ -149,7 +149,7 @@ func (r *ring) Refresh() {
 		// Membership has changed -- update hash nodes.
 		hash = hrw.NewRendezvousHash(hrw.Murmur3Hash, hrw.UInt64ToFloat64)
 		for addr := range latest {
-			hash.AddNode(addr, _defaultWeight)
+			hash.AddNode(addr, r.config.weight(addr))
 		}
 		// Notify watchers.
 		for _, w := range r.watchers {
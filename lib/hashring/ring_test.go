@@ -77,6 +77,32 @@ func TestRingLocationsDistribution(t *testing.T) {
 	}
 }
 
+func TestRingLocationsDistributionHonorsWeights(t *testing.T) {
+	require := require.New(t)
+
+	addrs := addrsFixture(3)
+
+	r := New(
+		Config{
+			MaxReplica: 1,
+			Weights:    map[string]int{addrs[0]: 300, addrs[1]: 100},
+		},
+		hostlist.Fixture(addrs...),
+		healthcheck.IdentityFilter{})
+
+	sampleSize := 5000
+
+	counts := make(map[string]int)
+	for i := 0; i < sampleSize; i++ {
+		counts[r.Locations(core.DigestFixture())[0]]++
+	}
+
+	// The unweighted address defaults to the same weight as addrs[1].
+	require.InDelta(0.6, float64(counts[addrs[0]])/float64(sampleSize), 0.03)
+	require.InDelta(0.2, float64(counts[addrs[1]])/float64(sampleSize), 0.03)
+	require.InDelta(0.2, float64(counts[addrs[2]])/float64(sampleSize), 0.03)
+}
+
 func TestRingLocationsFiltersOutUnhealthyHosts(t *testing.T) {
 	require := require.New(t)
 
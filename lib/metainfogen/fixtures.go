@@ -21,7 +21,7 @@ import (
 
 // Fixture returns a Generator which creates all metainfo with pieceLength for
 // testing purposes.
-func Fixture(cas *store.CAStore, pieceLength int) *Generator {
+func Fixture(cas store.Driver, pieceLength int) *Generator {
 	g, err := New(Config{
 		PieceLengths: map[datasize.ByteSize]datasize.ByteSize{0: datasize.ByteSize(pieceLength)},
 	}, cas)
@@ -25,11 +25,11 @@ import (
 // generate metainfo.
 type Generator struct {
 	pieceLengthConfig *pieceLengthConfig
-	cas               *store.CAStore
+	cas               store.Driver
 }
 
 // New creates a new Generator.
-func New(config Config, cas *store.CAStore) (*Generator, error) {
+func New(config Config, cas store.Driver) (*Generator, error) {
 	plConfig, err := newPieceLengthConfig(config.PieceLengths)
 	if err != nil {
 		return nil, fmt.Errorf("piece length config: %s", err)
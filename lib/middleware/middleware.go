@@ -14,11 +14,14 @@
 package middleware
 
 import (
+	"context"
 	"net/http"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/uber/kraken/utils/httputil"
+
 	"github.com/pressly/chi"
 	"github.com/uber-go/tally"
 )
@@ -40,6 +43,10 @@ import (
 //     tagEndpoint(stats, r).Counter("n").Inc(1)
 //
 func tagEndpoint(stats tally.Scope, r *http.Request) tally.Scope {
+	return stats.Tagged(endpointTags(r))
+}
+
+func endpointTags(r *http.Request) map[string]string {
 	ctx := chi.RouteContext(r.Context())
 	var staticParts []string
 	for _, part := range strings.Split(ctx.RoutePattern(), "/") {
@@ -48,10 +55,10 @@ func tagEndpoint(stats tally.Scope, r *http.Request) tally.Scope {
 		}
 		staticParts = append(staticParts, part)
 	}
-	return stats.Tagged(map[string]string{
+	return map[string]string{
 		"endpoint": strings.Join(staticParts, "."),
 		"method":   strings.ToUpper(r.Method),
-	})
+	}
 }
 
 // isPathVariable returns true if s is a path variable, e.g. "{foo}".
@@ -59,13 +66,36 @@ func isPathVariable(s string) bool {
 	return len(s) >= 2 && s[0] == '{' && s[len(s)-1] == '}'
 }
 
-// LatencyTimer measures endpoint latencies.
-func LatencyTimer(stats tally.Scope) func(next http.Handler) http.Handler {
+// EndpointHistogram records the latencies of an endpoint in a histogram with
+// Buckets, instead of a timer. Endpoint is the endpoint tag of the route, e.g.
+// "foo.bar" for "/foo/{foo}/bar".
+type EndpointHistogram struct {
+	Method   string
+	Endpoint string
+	Buckets  tally.Buckets
+}
+
+// LatencyTimer measures endpoint latencies. Endpoints of histograms are also
+// measured by a "latency_histogram" histogram, such that dashboards and alerts
+// on the timer keep working.
+func LatencyTimer(
+	stats tally.Scope, histograms ...EndpointHistogram) func(next http.Handler) http.Handler {
+
+	buckets := make(map[string]tally.Buckets)
+	for _, h := range histograms {
+		buckets[strings.ToUpper(h.Method)+" "+h.Endpoint] = h.Buckets
+	}
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			start := time.Now()
 			next.ServeHTTP(w, r)
-			tagEndpoint(stats, r).Timer("latency").Record(time.Since(start))
+			tags := endpointTags(r)
+			scope := stats.Tagged(tags)
+			t := time.Since(start)
+			scope.Timer("latency").Record(t)
+			if b, ok := buckets[tags["method"]+" "+tags["endpoint"]]; ok {
+				scope.Histogram("latency_histogram", b).RecordDuration(t)
+			}
 		})
 	}
 }
@@ -99,3 +129,21 @@ func StatusCounter(stats tally.Scope) func(next http.Handler) http.Handler {
 		})
 	}
 }
+
+// Deadline bounds the request context by the remaining time budget declared by
+// the client via httputil.DeadlineHeader, such that handlers can abandon work
+// once the client has given up. Requests without a valid header are unbounded.
+func Deadline() func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ms, err := strconv.ParseInt(r.Header.Get(httputil.DeadlineHeader), 10, 64)
+			if err != nil || ms < 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+			ctx, cancel := context.WithTimeout(r.Context(), time.Duration(ms)*time.Millisecond)
+			defer cancel()
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
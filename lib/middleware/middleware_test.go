@@ -101,6 +101,60 @@ func TestLatencyTimer(t *testing.T) {
 	}
 }
 
+func TestLatencyTimerRecordsConfiguredEndpointsInHistograms(t *testing.T) {
+	require := require.New(t)
+
+	stats := tally.NewTestScope("", nil)
+	buckets := tally.DurationBuckets{10 * time.Millisecond, 50 * time.Millisecond, time.Second}
+
+	r := chi.NewRouter()
+	r.Use(LatencyTimer(stats, EndpointHistogram{"GET", "foo", buckets}))
+	r.Get("/foo/{foo}", func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(20 * time.Millisecond)
+	})
+	r.Get("/bar", func(w http.ResponseWriter, r *http.Request) {})
+
+	addr, stop := testutil.StartServer(r)
+	defer stop()
+
+	_, err := httputil.Get(fmt.Sprintf("http://%s/foo/x", addr))
+	require.NoError(err)
+	_, err = httputil.Get(fmt.Sprintf("http://%s/bar", addr))
+	require.NoError(err)
+
+	// Latencies are recorded after responses are sent. Snapshots of histograms
+	// count buckets since the previous snapshot, so the last one is kept.
+	var snapshot tally.Snapshot
+	require.NoError(testutil.PollUntilTrue(time.Second, func() bool {
+		snapshot = stats.Snapshot()
+		var n int64
+		for _, v := range snapshot.Histograms() {
+			for _, c := range v.Durations() {
+				n += c
+			}
+		}
+		return n == 1 && len(snapshot.Histograms()) == 1 && len(snapshot.Timers()) == 2
+	}))
+
+	// Every endpoint is timed, including endpoints with histograms.
+	endpoints := make(map[string]bool)
+	for _, v := range snapshot.Timers() {
+		require.Equal("latency", v.Name())
+		endpoints[v.Tags()["endpoint"]] = true
+	}
+	require.Equal(map[string]bool{"foo": true, "bar": true}, endpoints)
+
+	for _, v := range snapshot.Histograms() {
+		require.Equal("latency_histogram", v.Name())
+		require.Equal("foo", v.Tags()["endpoint"])
+		counts := v.Durations()
+		for _, b := range buckets {
+			require.Contains(counts, b)
+		}
+		require.Equal(int64(1), counts[50*time.Millisecond]+counts[time.Second])
+	}
+}
+
 func TestStatusCounter(t *testing.T) {
 	tests := []struct {
 		desc           string
@@ -155,3 +209,42 @@ func TestStatusCounter(t *testing.T) {
 		})
 	}
 }
+
+func TestDeadline(t *testing.T) {
+	tests := []struct {
+		desc        string
+		header      string
+		hasDeadline bool
+	}{
+		{"no header", "", false},
+		{"invalid header", "foo", false},
+		{"valid header", "2000", true},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			require := require.New(t)
+
+			var deadline time.Time
+			var ok bool
+
+			r := chi.NewRouter()
+			r.Use(Deadline())
+			r.Get("/foo", func(w http.ResponseWriter, r *http.Request) {
+				deadline, ok = r.Context().Deadline()
+			})
+
+			addr, stop := testutil.StartServer(r)
+			defer stop()
+
+			_, err := httputil.Get(
+				fmt.Sprintf("http://%s/foo", addr),
+				httputil.SendHeaders(map[string]string{httputil.DeadlineHeader: test.header}))
+			require.NoError(err)
+
+			require.Equal(test.hasDeadline, ok)
+			if test.hasDeadline {
+				require.WithinDuration(time.Now().Add(2*time.Second), deadline, time.Second)
+			}
+		})
+	}
+}
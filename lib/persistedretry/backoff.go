@@ -0,0 +1,125 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package persistedretry
+
+import "sync"
+
+// BackoffResetConfig defines backoff state shared by groups of tasks, e.g. all
+// replications to the same remote. Tasks of a group back off with their own
+// failures, but at most with the failures of their group since its backoff
+// was last reset. A group's backoff is reset after Successes consecutive
+// successes, such that a recovered destination quickly returns to retrying at
+// the base interval, while a flaky one stays throttled.
+type BackoffResetConfig struct {
+	Enabled bool `yaml:"enabled"`
+
+	// GroupBy is the task tag whose value groups tasks, e.g. "dest" for tag
+	// replication.
+	GroupBy string `yaml:"group_by"`
+
+	// Successes is the number of consecutive successes of a group after which
+	// its backoff is reset.
+	Successes int `yaml:"successes"`
+}
+
+func (c BackoffResetConfig) applyDefaults() BackoffResetConfig {
+	if c.Successes == 0 {
+		c.Successes = 3
+	}
+	return c
+}
+
+type backoffGroup struct {
+	// Failures since the backoff of the group was reset. Until the first reset,
+	// e.g. after a restart, tasks back off with their own failures only.
+	failures  int
+	reset     bool
+	successes int
+}
+
+// groupBackoff tracks the backoff state of task groups. A nil groupBackoff
+// leaves backoff to the failures of each task.
+type groupBackoff struct {
+	config BackoffResetConfig
+
+	mu     sync.Mutex
+	groups map[string]*backoffGroup
+}
+
+func newGroupBackoff(config BackoffResetConfig) *groupBackoff {
+	if !config.Enabled {
+		return nil
+	}
+	return &groupBackoff{
+		config: config.applyDefaults(),
+		groups: make(map[string]*backoffGroup),
+	}
+}
+
+// group returns the state of the group of t. Must be called with mu held.
+func (b *groupBackoff) group(t Task) *backoffGroup {
+	key := t.Tags()[b.config.GroupBy]
+	g, ok := b.groups[key]
+	if !ok {
+		g = &backoffGroup{}
+		b.groups[key] = g
+	}
+	return g
+}
+
+// failure records a failed execution of t.
+func (b *groupBackoff) failure(t Task) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	g := b.group(t)
+	g.failures++
+	g.successes = 0
+}
+
+// success records a successful execution of t. Returns true if the backoff of
+// the group of t was reset.
+func (b *groupBackoff) success(t Task) bool {
+	if b == nil {
+		return false
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	g := b.group(t)
+	g.successes++
+	if g.successes < b.config.Successes || (g.reset && g.failures == 0) {
+		return false
+	}
+	g.failures = 0
+	g.reset = true
+	return true
+}
+
+// limit returns the failures which t backs off with, given failures of t.
+func (b *groupBackoff) limit(t Task, failures int) int {
+	if b == nil {
+		return failures
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if g := b.group(t); g.reset && g.failures < failures {
+		return g.failures
+	}
+	return failures
+}
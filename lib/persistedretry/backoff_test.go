@@ -0,0 +1,91 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package persistedretry
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/uber/kraken/utils/backoffutil"
+)
+
+type testTask struct {
+	dest     string
+	failures int
+}
+
+func (t *testTask) GetLastAttempt() time.Time { return time.Time{} }
+func (t *testTask) GetFailures() int          { return t.failures }
+func (t *testTask) Ready() bool               { return true }
+func (t *testTask) Tags() map[string]string   { return map[string]string{"dest": t.dest} }
+
+func TestBackoffResetAfterConsecutiveSuccesses(t *testing.T) {
+	require := require.New(t)
+
+	m := &manager{
+		config: Config{
+			RetryInterval:    30 * time.Second,
+			MaxRetryInterval: 10 * time.Minute,
+			RetryJitter:      backoffutil.JitterNone,
+		},
+		backoff: newGroupBackoff(BackoffResetConfig{Enabled: true, GroupBy: "dest", Successes: 3}),
+	}
+
+	task := &testTask{dest: "remote", failures: 4}
+	for i := 0; i < 4; i++ {
+		m.backoff.failure(task)
+	}
+	require.Equal(4*time.Minute, m.retryInterval(task, time.Time{}))
+
+	// Successes of other tasks to the same remote reset its backoff, including
+	// for tasks which failed many times.
+	other := &testTask{dest: "remote"}
+	require.False(m.backoff.success(other))
+	require.False(m.backoff.success(other))
+	require.Equal(4*time.Minute, m.retryInterval(task, time.Time{}))
+	require.True(m.backoff.success(other))
+	require.Equal(30*time.Second, m.retryInterval(task, time.Time{}))
+
+	// Backoff grows again with further failures.
+	m.backoff.failure(task)
+	m.backoff.failure(task)
+	require.Equal(time.Minute, m.retryInterval(task, time.Time{}))
+}
+
+func TestBackoffResetRequiresConsecutiveSuccesses(t *testing.T) {
+	require := require.New(t)
+
+	b := newGroupBackoff(BackoffResetConfig{Enabled: true, GroupBy: "dest", Successes: 2})
+
+	task := &testTask{dest: "remote", failures: 2}
+	b.failure(task)
+	b.failure(task)
+
+	require.False(b.success(task))
+	b.failure(task)
+	require.False(b.success(task))
+	require.Equal(2, b.limit(task, 2))
+	require.True(b.success(task))
+	require.Equal(0, b.limit(task, 2))
+
+	// Other remotes are unaffected.
+	require.Equal(5, b.limit(&testTask{dest: "other"}, 5))
+}
+
+func TestBackoffResetDisabled(t *testing.T) {
+	b := newGroupBackoff(BackoffResetConfig{})
+	require.Nil(t, b)
+	require.Equal(t, 4, b.limit(&testTask{}, 4))
+}
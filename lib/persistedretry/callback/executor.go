@@ -0,0 +1,106 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package callback
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/uber/kraken/lib/persistedretry"
+	"github.com/uber/kraken/utils/httputil"
+
+	"github.com/uber-go/tally"
+)
+
+// SignatureHeader holds the hex HMAC-SHA256 of the body of callbacks, keyed by
+// the configured secret and prefixed with "sha256=".
+const SignatureHeader = "X-Kraken-Signature"
+
+// Config defines callback delivery configuration.
+type Config struct {
+	// Secret signs callback bodies. If empty, callbacks are not signed.
+	Secret string `yaml:"secret"`
+
+	// Timeout bounds each delivery attempt.
+	Timeout time.Duration `yaml:"timeout"`
+
+	// Retry configures the manager which retries failed deliveries.
+	Retry persistedretry.Config `yaml:"retry"`
+
+	// NotifyFailureAfter is the number of failed attempts after which a
+	// replication reports failure, even if it keeps being retried. Defaults
+	// to 3.
+	NotifyFailureAfter int `yaml:"notify_failure_after"`
+}
+
+func (c Config) applyDefaults() Config {
+	if c.Timeout == 0 {
+		c.Timeout = 10 * time.Second
+	}
+	return c
+}
+
+// Executor executes callback tasks.
+type Executor struct {
+	config Config
+	stats  tally.Scope
+}
+
+// NewExecutor creates a new Executor.
+func NewExecutor(config Config, stats tally.Scope) *Executor {
+	stats = stats.Tagged(map[string]string{
+		"module": "callbackexecutor",
+	})
+	return &Executor{config.applyDefaults(), stats}
+}
+
+// Name returns the executor name.
+func (e *Executor) Name() string {
+	return "callback"
+}
+
+// Sign returns the signature of body under secret.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Exec posts the notification of the task to its url. Any non-2XX response
+// fails the task, such that it is retried.
+func (e *Executor) Exec(r persistedretry.Task) error {
+	t := r.(*Task)
+	headers := map[string]string{"Content-Type": "application/json"}
+	if e.config.Secret != "" {
+		headers[SignatureHeader] = Sign(e.config.Secret, t.Payload)
+	}
+	_, err := httputil.Post(
+		t.URL,
+		httputil.SendBody(bytes.NewReader(t.Payload)),
+		httputil.SendHeaders(headers),
+		httputil.SendTimeout(e.config.Timeout),
+		httputil.SendAcceptedCodes(
+			http.StatusOK, http.StatusCreated, http.StatusAccepted, http.StatusNoContent))
+	if err != nil {
+		e.stats.Counter("delivery_failures").Inc(1)
+		return fmt.Errorf("post callback: %s", err)
+	}
+	e.stats.Counter("delivered").Inc(1)
+	return nil
+}
@@ -0,0 +1,74 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package callback
+
+import (
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/uber-go/tally"
+
+	"github.com/uber/kraken/utils/testutil"
+)
+
+func TestExecutorSignsPayload(t *testing.T) {
+	require := require.New(t)
+
+	var body []byte
+	var signature string
+	addr, stop := testutil.StartServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = ioutil.ReadAll(r.Body)
+		signature = r.Header.Get(SignatureHeader)
+	}))
+	defer stop()
+
+	task, err := NewTask("http://"+addr, Notification{Tag: "repo:tag", Outcome: OutcomeSuccess})
+	require.NoError(err)
+
+	require.NoError(NewExecutor(Config{Secret: "secret"}, tally.NoopScope).Exec(task))
+	require.Equal(task.Payload, body)
+	require.Equal(Sign("secret", task.Payload), signature)
+}
+
+func TestExecutorUnsignedWithoutSecret(t *testing.T) {
+	require := require.New(t)
+
+	var signature string
+	addr, stop := testutil.StartServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		signature = r.Header.Get(SignatureHeader)
+	}))
+	defer stop()
+
+	task, err := NewTask("http://"+addr, Notification{Tag: "repo:tag", Outcome: OutcomeSuccess})
+	require.NoError(err)
+
+	require.NoError(NewExecutor(Config{}, tally.NoopScope).Exec(task))
+	require.Empty(signature)
+}
+
+func TestExecutorFailsOnErrorResponse(t *testing.T) {
+	require := require.New(t)
+
+	addr, stop := testutil.StartServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer stop()
+
+	task, err := NewTask("http://"+addr, Notification{Tag: "repo:tag", Outcome: OutcomeFailure})
+	require.NoError(err)
+
+	require.Error(NewExecutor(Config{}, tally.NoopScope).Exec(task))
+}
@@ -0,0 +1,92 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package callback
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Outcomes of replications reported by callbacks.
+const (
+	OutcomeSuccess = "success"
+	OutcomeFailure = "failure"
+)
+
+// Notification is the JSON body posted to callback URLs once replication of a
+// tag to a remote completes.
+type Notification struct {
+	Tag      string `json:"tag"`
+	Digest   string `json:"digest"`
+	Remote   string `json:"remote"`
+	Outcome  string `json:"outcome"`
+	Error    string `json:"error,omitempty"`
+	Failures int    `json:"failures"`
+}
+
+// Task contains information to post a notification to a callback URL.
+type Task struct {
+	ID          string    `db:"id"`
+	URL         string    `db:"url"`
+	Payload     []byte    `db:"payload"`
+	CreatedAt   time.Time `db:"created_at"`
+	LastAttempt time.Time `db:"last_attempt"`
+	Failures    int       `db:"failures"`
+}
+
+// NewTask creates a new Task which posts n to url. Tasks posting identical
+// notifications to the same url share an id.
+func NewTask(url string, n Notification) (*Task, error) {
+	payload, err := json.Marshal(n)
+	if err != nil {
+		return nil, fmt.Errorf("json marshal: %s", err)
+	}
+	h := sha256.New()
+	h.Write([]byte(url))
+	h.Write([]byte{0})
+	h.Write(payload)
+	return &Task{
+		ID:        hex.EncodeToString(h.Sum(nil)),
+		URL:       url,
+		Payload:   payload,
+		CreatedAt: time.Now(),
+	}, nil
+}
+
+func (t *Task) String() string {
+	return fmt.Sprintf("callback.Task(id=%s, url=%s)", t.ID, t.URL)
+}
+
+// GetLastAttempt returns when t was last attempted.
+func (t *Task) GetLastAttempt() time.Time {
+	return t.LastAttempt
+}
+
+// GetFailures returns the number of times t has failed.
+func (t *Task) GetFailures() int {
+	return t.Failures
+}
+
+// Ready returns whether t is ready to run.
+func (t *Task) Ready() bool {
+	return true
+}
+
+// Tags is unused.
+func (t *Task) Tags() map[string]string {
+	return nil
+}
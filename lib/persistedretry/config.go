@@ -13,7 +13,11 @@
 // limitations under the License.
 package persistedretry
 
-import "time"
+import (
+	"time"
+
+	"github.com/uber/kraken/utils/backoffutil"
+)
 
 // Config defines Manager configuration.
 type Config struct {
@@ -29,13 +33,43 @@ type Config struct {
 	// Interval at which failed tasks should be retried.
 	RetryInterval time.Duration `yaml:"retry_interval"`
 
+	// MaxRetryInterval, if greater than RetryInterval, is the limit up to which
+	// the interval doubles on every failure of a task.
+	MaxRetryInterval time.Duration `yaml:"max_retry_interval"`
+
+	// RetryJitter selects how retry intervals are randomized. Retry intervals
+	// are exact by default.
+	RetryJitter backoffutil.Jitter `yaml:"retry_jitter"`
+
 	// Interval at which retries should be polled from storage.
 	PollRetriesInterval time.Duration `yaml:"poll_retries_interval"`
 
+	// Drain configures dispatching of queued tasks on Close.
+	Drain DrainConfig `yaml:"drain"`
+
+	// MaxFailures is the number of failed executions after which a task is
+	// dropped as a dead letter. Zero retries tasks forever.
+	MaxFailures int `yaml:"max_failures"`
+
+	// BackoffReset configures backoff shared by groups of tasks.
+	BackoffReset BackoffResetConfig `yaml:"backoff_reset"`
+
+	// HookTimeout bounds how long workers wait on each lifecycle hook.
+	HookTimeout time.Duration `yaml:"hook_timeout"`
+
 	// Flags that zero-value channel sizes should not have defaults applied.
 	Testing bool
 }
 
+// DrainConfig defines how queued tasks are handled on Close. When enabled,
+// workers keep executing queued tasks for up to GracePeriod before exiting.
+// Tasks which are not dispatched in time remain persisted as pending, and are
+// retried once the manager is restarted.
+type DrainConfig struct {
+	Enabled     bool          `yaml:"enabled"`
+	GracePeriod time.Duration `yaml:"grace_period"`
+}
+
 func (c Config) applyDefaults() Config {
 	if c.NumIncomingWorkers == 0 {
 		c.NumIncomingWorkers = 4
@@ -52,6 +86,15 @@ func (c Config) applyDefaults() Config {
 	if c.RetryInterval == 0 {
 		c.RetryInterval = 30 * time.Second
 	}
+	if c.MaxRetryInterval < c.RetryInterval {
+		c.MaxRetryInterval = c.RetryInterval
+	}
+	if c.HookTimeout == 0 {
+		c.HookTimeout = time.Second
+	}
+	if c.Drain.GracePeriod == 0 {
+		c.Drain.GracePeriod = 10 * time.Second
+	}
 	if !c.Testing {
 		if c.IncomingBuffer == 0 {
 			c.IncomingBuffer = 1000
@@ -0,0 +1,119 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package persistedretry
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/uber/kraken/utils/log"
+)
+
+// Hooks observe the lifecycle of tasks, e.g. to send notifications or update
+// external state. Any hook may be nil. Hooks are invoked synchronously at each
+// transition, but are abandoned after the hook timeout of the Manager. Errors
+// returned by hooks are logged and never affect task processing.
+//
+// Hooks are not invoked for tasks executed via SyncExec, since such tasks are
+// never persisted.
+type Hooks struct {
+	// OnEnqueue is called once a task is added to the manager.
+	OnEnqueue func(Task) error
+
+	// OnAttempt is called before every execution of a task.
+	OnAttempt func(Task) error
+
+	// OnSuccess is called once a task executed successfully.
+	OnSuccess func(Task) error
+
+	// OnFailure is called after every failed execution of a task.
+	OnFailure func(Task, error) error
+
+	// OnDeadLetter is called once a task exhausted its max failures and is
+	// dropped from the manager.
+	OnDeadLetter func(Task, error) error
+}
+
+// WithHooks registers lifecycle hooks. May be supplied multiple times, in which
+// case hooks are invoked in registration order.
+func WithHooks(hooks Hooks) ManagerOption {
+	return func(m *manager) { m.hooks = append(m.hooks, hooks) }
+}
+
+func (m *manager) onEnqueue(t Task) {
+	for _, h := range m.hooks {
+		if h.OnEnqueue != nil {
+			m.callHook("enqueue", t, func() error { return h.OnEnqueue(t) })
+		}
+	}
+}
+
+func (m *manager) onAttempt(t Task) {
+	for _, h := range m.hooks {
+		if h.OnAttempt != nil {
+			m.callHook("attempt", t, func() error { return h.OnAttempt(t) })
+		}
+	}
+}
+
+func (m *manager) onSuccess(t Task) {
+	for _, h := range m.hooks {
+		if h.OnSuccess != nil {
+			m.callHook("success", t, func() error { return h.OnSuccess(t) })
+		}
+	}
+}
+
+func (m *manager) onFailure(t Task, err error) {
+	for _, h := range m.hooks {
+		if h.OnFailure != nil {
+			m.callHook("failure", t, func() error { return h.OnFailure(t, err) })
+		}
+	}
+}
+
+func (m *manager) onDeadLetter(t Task, err error) {
+	for _, h := range m.hooks {
+		if h.OnDeadLetter != nil {
+			m.callHook("dead_letter", t, func() error { return h.OnDeadLetter(t, err) })
+		}
+	}
+}
+
+// callHook runs f for up to the hook timeout. Slow hooks keep running in the
+// background, such that a stuck hook cannot stall workers.
+func (m *manager) callHook(name string, t Task, f func() error) {
+	stats := m.stats.Tagged(map[string]string{"hook": name})
+	errc := make(chan error, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				errc <- fmt.Errorf("panic: %v", r)
+			}
+		}()
+		errc <- f()
+	}()
+	timer := time.NewTimer(m.config.HookTimeout)
+	defer timer.Stop()
+	select {
+	case err := <-errc:
+		if err != nil {
+			stats.Counter("hook_failures").Inc(1)
+			log.With("task", t, "hook", name).Errorf("Error running task hook: %s", err)
+		}
+	case <-timer.C:
+		stats.Counter("hook_timeouts").Inc(1)
+		log.With("task", t, "hook", name).Errorf("Task hook timed out after %s", m.config.HookTimeout)
+	}
+}
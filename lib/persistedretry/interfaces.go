@@ -42,6 +42,11 @@ type Store interface {
 	// MarkFailed marks an existing task as failed.
 	MarkFailed(Task) error
 
+	// MarkPaused marks an existing task held back by a Pauser as failed,
+	// without counting a failure, such that it is retried by polling once no
+	// longer paused.
+	MarkPaused(Task) error
+
 	// GetPending returns all pending Tasks.
 	GetPending() ([]Task, error)
 
@@ -55,6 +60,17 @@ type Store interface {
 	Find(query interface{}) ([]Task, error)
 }
 
+// Shedder is implemented by Stores which drop tasks on their own, e.g. to make
+// room for other tasks. Managers register themselves with such stores on
+// creation.
+type Shedder interface {
+	// SetShedding configures the store to compact tasks which failed at least
+	// maxFailures times before dropping any other task, and to call shed with
+	// every dropped task and the reason it was dropped. Zero maxFailures
+	// disables compaction.
+	SetShedding(maxFailures int, shed func(Task, error))
+}
+
 // Executor executes tasks.
 type Executor interface {
 	Exec(Task) error
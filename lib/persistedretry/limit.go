@@ -0,0 +1,94 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package persistedretry
+
+// Limiter bounds the tasks of each group which execute at once, e.g. all
+// replications of the same namespace, such that a flood of tasks in one group
+// cannot occupy every worker.
+type Limiter interface {
+	// Acquire reserves an execution slot of the group of t, and returns false
+	// if the group has no free slot. Idle is the number of workers which would
+	// remain idle while t executes, such that limiters may lend slots of idle
+	// workers to groups without a free slot.
+	Acquire(t Task, idle int) bool
+
+	// Release returns the slot reserved by t.
+	Release(Task)
+}
+
+// WithLimiter configures l to bound the concurrent execution of task groups.
+// Tasks whose group has no free slot remain pending and are held back by the
+// manager, such that workers move on to tasks of other groups. Held back tasks
+// are dispatched in order as slots of their group are released.
+func WithLimiter(l Limiter) ManagerOption {
+	return func(m *manager) { m.limiter = l }
+}
+
+// admit reserves a slot for t, or holds back t until a slot of its group is
+// released.
+func (m *manager) admit(q *queue, t Task) bool {
+	if m.limiter == nil {
+		return true
+	}
+	m.throttledMu.Lock()
+	defer m.throttledMu.Unlock()
+
+	if m.limiter.Acquire(t, q.idle()) {
+		return true
+	}
+	m.throttled = append(m.throttled, t)
+	m.stats.Gauge("throttled_tasks").Update(float64(len(m.throttled)))
+	return false
+}
+
+// idle returns the number of workers of q which are waiting for a task. Since
+// held back tasks are dispatched from the queue they were received on, only
+// those workers are free for other groups.
+func (q *queue) idle() int {
+	if idle := q.workers - int(q.busy.Load()); idle > 0 {
+		return idle
+	}
+	return 0
+}
+
+// release returns the slot of t, and returns the oldest held back task which
+// acquired a slot in its place, if any. Held back tasks which were paused in
+// the meantime are parked.
+func (m *manager) release(q *queue, t Task) Task {
+	if m.limiter == nil {
+		return nil
+	}
+	m.throttledMu.Lock()
+	defer m.throttledMu.Unlock()
+
+	m.limiter.Release(t)
+
+	var next Task
+	throttled := m.throttled[:0]
+	for _, c := range m.throttled {
+		switch {
+		case next != nil:
+			throttled = append(throttled, c)
+		case m.paused(c):
+			m.park(c)
+		case m.limiter.Acquire(c, q.idle()):
+			next = c
+		default:
+			throttled = append(throttled, c)
+		}
+	}
+	m.throttled = throttled
+	m.stats.Gauge("throttled_tasks").Update(float64(len(m.throttled)))
+	return next
+}
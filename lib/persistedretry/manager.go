@@ -16,12 +16,15 @@ package persistedretry
 import (
 	"errors"
 	"fmt"
+	"math/rand"
 	"sync"
 	"time"
 
+	"github.com/andres-erbsen/clock"
 	"github.com/uber-go/tally"
 	"go.uber.org/atomic"
 
+	"github.com/uber/kraken/utils/backoffutil"
 	"github.com/uber/kraken/utils/log"
 )
 
@@ -39,10 +42,15 @@ type Manager interface {
 type queue struct {
 	tasks   chan Task
 	counter tally.Counter
+
+	// Number of workers of the queue, and number of those which are handling a
+	// task.
+	workers int
+	busy    atomic.Int64
 }
 
-func newQueue(size int, counter tally.Counter) *queue {
-	return &queue{make(chan Task, size), counter}
+func newQueue(size int, counter tally.Counter, workers int) *queue {
+	return &queue{tasks: make(chan Task, size), counter: counter, workers: workers}
 }
 
 type manager struct {
@@ -50,34 +58,77 @@ type manager struct {
 	stats    tally.Scope
 	store    Store
 	executor Executor
+	clk      clock.Clock
+	hooks    []Hooks
+	pausers  []Pauser
+	limiter  Limiter
+	backoff  *groupBackoff
 
 	wg sync.WaitGroup
 
 	incoming *queue
 	retries  *queue
 
+	// Number of tasks currently being executed by workers, and number of tasks
+	// executed since the manager was closed.
+	executing atomic.Int64
+	drained   atomic.Int64
+
+	// Signals that paused tasks may have been resumed.
+	resumed chan struct{}
+
+	// Tasks held back by limiter, which are pending in the store.
+	throttledMu sync.Mutex
+	throttled   []Task
+
 	closeOnce sync.Once
 	done      chan struct{}
 	closed    atomic.Bool
 }
 
+// ManagerOption allows setting optional Manager parameters.
+type ManagerOption func(*manager)
+
+// WithClock configures the clock which drives retry polling and backoff.
+func WithClock(clk clock.Clock) ManagerOption {
+	return func(m *manager) { m.clk = clk }
+}
+
 // NewManager creates a new Manager.
 func NewManager(
-	config Config, stats tally.Scope, store Store, executor Executor) (Manager, error) {
+	config Config,
+	stats tally.Scope,
+	store Store,
+	executor Executor,
+	opts ...ManagerOption) (Manager, error) {
 
 	stats = stats.Tagged(map[string]string{
 		"module":   "persistedretry",
 		"executor": executor.Name(),
 	})
 	config = config.applyDefaults()
+	if err := config.RetryJitter.Validate(); err != nil {
+		return nil, fmt.Errorf("config: %s", err)
+	}
 	m := &manager{
 		config:   config,
 		stats:    stats,
 		store:    store,
 		executor: executor,
-		incoming: newQueue(config.IncomingBuffer, stats.Counter("incoming")),
-		retries:  newQueue(config.RetryBuffer, stats.Counter("retries")),
-		done:     make(chan struct{}),
+		clk:      clock.New(),
+		incoming: newQueue(
+			config.IncomingBuffer, stats.Counter("incoming"), config.NumIncomingWorkers),
+		retries: newQueue(
+			config.RetryBuffer, stats.Counter("retries"), config.NumRetryWorkers),
+		backoff: newGroupBackoff(config.BackoffReset),
+		resumed: make(chan struct{}, 1),
+		done:    make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	if s, ok := store.(Shedder); ok {
+		s.SetShedding(config.MaxFailures, m.shed)
 	}
 	if err := m.markPendingTasksAsFailed(); err != nil {
 		return nil, fmt.Errorf("mark pending tasks as failed: %s", err)
@@ -119,8 +170,19 @@ func (m *manager) start() error {
 		go m.worker(m.retries, limit)
 	}
 
+	// Created before the loop starts, such that no ticks of a mock clock are
+	// missed.
+	pollRetriesTicker := m.clk.Ticker(m.config.PollRetriesInterval)
+
 	m.wg.Add(1)
-	go m.tickerLoop()
+	go m.tickerLoop(pollRetriesTicker)
+
+	for _, p := range m.pausers {
+		if n, ok := p.(ResumeNotifier); ok {
+			m.wg.Add(1)
+			go m.notifyResumed(n)
+		}
+	}
 
 	return nil
 }
@@ -142,8 +204,9 @@ func (m *manager) Add(t Task) error {
 			// No-op on duplicate tasks.
 			return nil
 		}
-		return fmt.Errorf("store: %s", err)
+		return fmt.Errorf("store: %w", err)
 	}
+	m.onEnqueue(t)
 	if ready {
 		if err := m.enqueue(t, m.incoming); err != nil {
 			return fmt.Errorf("enqueue: %s", err)
@@ -158,15 +221,50 @@ func (m *manager) SyncExec(t Task) error {
 	return m.executor.Exec(t)
 }
 
-// Close waits for all workers to exit current task.
+// Close waits for all workers to exit current task. If draining is enabled,
+// queued tasks are dispatched for up to the drain grace period first.
 func (m *manager) Close() {
 	m.closeOnce.Do(func() {
 		m.closed.Store(true)
+		var pending int
+		if m.config.Drain.Enabled {
+			pending = m.queued() + int(m.executing.Load())
+			m.drain()
+		}
 		close(m.done)
 		m.wg.Wait()
+		if m.config.Drain.Enabled {
+			drained := int(m.drained.Load())
+			m.stats.Counter("drained_tasks").Inc(int64(drained))
+			m.stats.Counter("drain_pending_tasks").Inc(int64(pending - drained))
+			log.With(
+				"drained", drained,
+				"pending", pending-drained).Info("Drained persisted retry manager")
+		}
 	})
 }
 
+// drain blocks until all queued tasks have been executed, or until the drain
+// grace period elapses. Must be called after the manager is marked as closed,
+// such that no new tasks are enqueued.
+func (m *manager) drain() {
+	deadline := m.clk.After(m.config.Drain.GracePeriod)
+	ticker := m.clk.Ticker(10 * time.Millisecond)
+	defer ticker.Stop()
+	for m.queued() > 0 || m.executing.Load() > 0 {
+		select {
+		case <-deadline:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// queued returns the number of tasks waiting for a worker.
+func (m *manager) queued() int {
+	return len(m.incoming.tasks) + len(m.retries.tasks)
+}
+
 func (m *manager) Find(query interface{}) ([]Task, error) {
 	return m.store.Find(query)
 }
@@ -204,30 +302,90 @@ func (m *manager) worker(q *queue, limit time.Duration) {
 			return
 		case t := <-q.tasks:
 			q.counter.Inc(-1)
-			if err := m.exec(t); err != nil {
-				m.stats.Counter("exec_failures").Inc(1)
-				log.With("task", t).Errorf("Failed to exec task: %s", err)
+			select {
+			case <-m.done:
+				// The task is left pending in the store and will be retried on
+				// restart.
+				return
+			default:
+			}
+			if !m.handle(q, t, limit) {
+				return
 			}
-			time.Sleep(limit)
 		}
 	}
 }
 
-func (m *manager) tickerLoop() {
+// handle executes t, followed by any held back tasks which acquire the slot
+// released by t. Returns false if the manager was closed in the meantime.
+func (m *manager) handle(q *queue, t Task, limit time.Duration) bool {
+	q.busy.Inc()
+	defer q.busy.Dec()
+
+	if m.paused(t) {
+		m.park(t)
+		return true
+	}
+	if !m.admit(q, t) {
+		return true
+	}
+	for t != nil {
+		m.execute(t)
+		t = m.release(q, t)
+		time.Sleep(limit)
+		if t != nil && m.isDone() {
+			// The held back task is left pending in the store and will be
+			// retried on restart.
+			m.limiter.Release(t)
+			return false
+		}
+	}
+	return true
+}
+
+func (m *manager) isDone() bool {
+	select {
+	case <-m.done:
+		return true
+	default:
+		return false
+	}
+}
+
+func (m *manager) execute(t Task) {
+	m.executing.Inc()
+	defer m.executing.Dec()
+
+	if err := m.exec(t); err != nil {
+		m.stats.Counter("exec_failures").Inc(1)
+		log.With("task", t).Errorf("Failed to exec task: %s", err)
+	}
+	if m.closed.Load() {
+		m.drained.Inc()
+	}
+}
+
+func (m *manager) tickerLoop(pollRetriesTicker *clock.Ticker) {
 	defer m.wg.Done()
+	defer pollRetriesTicker.Stop()
 
-	pollRetriesTicker := time.NewTicker(m.config.PollRetriesInterval)
 	for {
 		select {
 		case <-m.done:
 			return
 		case <-pollRetriesTicker.C:
 			m.pollRetries()
+		case <-m.resumed:
+			m.pollRetries()
 		}
 	}
 }
 
 func (m *manager) pollRetries() {
+	if m.closed.Load() {
+		// Retries are left in storage while draining.
+		return
+	}
 	tasks, err := m.store.GetFailed()
 	if err != nil {
 		m.stats.Counter("get_failed_failure").Inc(1)
@@ -235,27 +393,83 @@ func (m *manager) pollRetries() {
 		return
 	}
 	for _, t := range tasks {
-		if t.Ready() && time.Since(t.GetLastAttempt()) > m.config.RetryInterval {
-			if err := m.retry(t); err != nil {
-				log.With("task", t).Errorf("Error adding retry task: %s", err)
-			}
+		if !t.Ready() || m.paused(t) {
+			continue
+		}
+		lastAttempt := t.GetLastAttempt()
+		if m.clk.Now().Sub(lastAttempt) <= m.retryInterval(t, lastAttempt) {
+			continue
+		}
+		if err := m.retry(t); err != nil {
+			log.With("task", t).Errorf("Error adding retry task: %s", err)
 		}
 	}
 }
 
+// retryInterval returns how long after its last attempt t is retried. Intervals
+// are drawn from a source seeded by the last attempt, such that every poll
+// draws the same interval until t is attempted again.
+func (m *manager) retryInterval(t Task, lastAttempt time.Time) time.Duration {
+	jitter := m.config.RetryJitter
+	if (jitter == "" || jitter == backoffutil.JitterNone) &&
+		m.config.MaxRetryInterval == m.config.RetryInterval {
+		return m.config.RetryInterval
+	}
+	b := backoffutil.New(
+		jitter,
+		m.config.RetryInterval,
+		m.config.MaxRetryInterval,
+		2,
+		rand.New(rand.NewSource(lastAttempt.UnixNano())))
+	// Intervals reach the max long before this many failures, so replaying
+	// further failures would not change the distribution.
+	n := m.backoff.limit(t, t.GetFailures())
+	if n > 64 {
+		n = 64
+	}
+	d := b.NextBackOff()
+	for i := 1; i < n; i++ {
+		d = b.NextBackOff()
+	}
+	return d
+}
+
+// shed runs the dead letter hooks of t, which the store dropped on its own.
+func (m *manager) shed(t Task, err error) {
+	log.With("task", t).Warnf("Task dropped by store: %s", err)
+	m.stats.Counter("dead_letters").Inc(1)
+	m.onDeadLetter(t, err)
+}
+
 func (m *manager) exec(t Task) error {
-	if err := m.executor.Exec(t); err != nil {
+	m.onAttempt(t)
+	if execErr := m.executor.Exec(t); execErr != nil {
 		if err := m.store.MarkFailed(t); err != nil {
 			return fmt.Errorf("mark task as failed: %s", err)
 		}
+		failures := t.GetFailures()
 		log.With(
 			"task", t,
-			"failures", t.GetFailures()).Errorf("Task failed: %s", err)
+			"failures", failures).Errorf("Task failed: %s", execErr)
 		m.stats.Tagged(t.Tags()).Counter("task_failures").Inc(1)
+		m.backoff.failure(t)
+		m.onFailure(t, execErr)
+		if m.config.MaxFailures > 0 && failures >= m.config.MaxFailures {
+			if err := m.store.Remove(t); err != nil {
+				return fmt.Errorf("remove dead letter task: %s", err)
+			}
+			log.With("task", t, "failures", failures).Error("Dropped task after max failures")
+			m.stats.Counter("dead_letters").Inc(1)
+			m.onDeadLetter(t, execErr)
+		}
 		return nil
 	}
 	if err := m.store.Remove(t); err != nil {
 		return fmt.Errorf("remove task: %s", err)
 	}
+	if m.backoff.success(t) {
+		m.stats.Tagged(t.Tags()).Counter("backoff_resets").Inc(1)
+	}
+	m.onSuccess(t)
 	return nil
 }
@@ -19,12 +19,15 @@ import (
 	"testing"
 	"time"
 
+	"github.com/andres-erbsen/clock"
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/require"
 	"github.com/uber-go/tally"
+	"go.uber.org/atomic"
 
 	. "github.com/uber/kraken/lib/persistedretry"
 	"github.com/uber/kraken/mocks/lib/persistedretry"
+	"github.com/uber/kraken/utils/backoffutil"
 )
 
 func waitForWorkers() {
@@ -283,6 +286,104 @@ func TestManagerRetriesSkipsRecentlyAttemptedTasks(t *testing.T) {
 	time.Sleep(50 * time.Millisecond)
 }
 
+func TestManagerRetriesAfterRetryIntervalWithMockClock(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newManagerMocks(t)
+	defer cleanup()
+
+	mocks.config.PollRetriesInterval = time.Minute
+	mocks.config.RetryInterval = 90 * time.Second
+
+	clk := clock.NewMock()
+	lastAttempt := clk.Now()
+
+	task := mocks.task()
+
+	gomock.InOrder(
+		mocks.store.EXPECT().GetPending().Return(nil, nil).MinTimes(1),
+
+		// First poll is within the retry interval.
+		mocks.store.EXPECT().GetFailed().Return([]Task{task}, nil),
+		task.EXPECT().Ready().Return(true),
+		task.EXPECT().GetLastAttempt().Return(lastAttempt),
+
+		// Second poll is past the retry interval.
+		mocks.store.EXPECT().GetFailed().Return([]Task{task}, nil),
+		task.EXPECT().Ready().Return(true),
+		task.EXPECT().GetLastAttempt().Return(lastAttempt),
+		mocks.store.EXPECT().MarkPending(task),
+		mocks.executor.EXPECT().Exec(task).Return(nil),
+		mocks.store.EXPECT().Remove(task).Return(nil),
+	)
+
+	mocks.executor.EXPECT().Name().Return("mock executor")
+	m, err := NewManager(mocks.config, tally.NoopScope, mocks.store, mocks.executor, WithClock(clk))
+	require.NoError(err)
+	defer m.Close()
+
+	clk.Add(time.Minute)
+	waitForWorkers()
+
+	clk.Add(time.Minute)
+	waitForWorkers()
+}
+
+func TestManagerRetryIntervalBacksOffWithFailures(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newManagerMocks(t)
+	defer cleanup()
+
+	mocks.config.PollRetriesInterval = 3 * time.Minute
+	mocks.config.RetryInterval = 30 * time.Second
+	mocks.config.MaxRetryInterval = 10 * time.Minute
+	mocks.config.RetryJitter = backoffutil.JitterNone
+
+	clk := clock.NewMock()
+	lastAttempt := clk.Now()
+
+	task := mocks.task()
+	task.EXPECT().GetFailures().Return(4).AnyTimes()
+
+	gomock.InOrder(
+		mocks.store.EXPECT().GetPending().Return(nil, nil).MinTimes(1),
+
+		// After 4 failures, the retry interval is 30s * 2^3 = 4m.
+		mocks.store.EXPECT().GetFailed().Return([]Task{task}, nil),
+		task.EXPECT().Ready().Return(true),
+		task.EXPECT().GetLastAttempt().Return(lastAttempt),
+
+		mocks.store.EXPECT().GetFailed().Return([]Task{task}, nil),
+		task.EXPECT().Ready().Return(true),
+		task.EXPECT().GetLastAttempt().Return(lastAttempt),
+		mocks.store.EXPECT().MarkPending(task),
+		mocks.executor.EXPECT().Exec(task).Return(nil),
+		mocks.store.EXPECT().Remove(task).Return(nil),
+	)
+
+	mocks.executor.EXPECT().Name().Return("mock executor")
+	m, err := NewManager(mocks.config, tally.NoopScope, mocks.store, mocks.executor, WithClock(clk))
+	require.NoError(err)
+	defer m.Close()
+
+	clk.Add(3 * time.Minute)
+	waitForWorkers()
+
+	clk.Add(3 * time.Minute)
+	waitForWorkers()
+}
+
+func TestNewManagerInvalidRetryJitter(t *testing.T) {
+	mocks, cleanup := newManagerMocks(t)
+	defer cleanup()
+
+	mocks.config.RetryJitter = "random"
+
+	_, err := mocks.new()
+	require.Error(t, err)
+}
+
 func TestManagerAddNotReadyTaskMarksAsFailed(t *testing.T) {
 	require := require.New(t)
 
@@ -379,3 +480,401 @@ func TestManagerExec(t *testing.T) {
 
 	require.NoError(m.SyncExec(task))
 }
+
+// hookCounts counts invocations of each lifecycle hook.
+type hookCounts struct {
+	enqueue, attempt, success, failure, deadLetter atomic.Int64
+}
+
+func (c *hookCounts) hooks(err error) Hooks {
+	return Hooks{
+		OnEnqueue:    func(Task) error { c.enqueue.Inc(); return err },
+		OnAttempt:    func(Task) error { c.attempt.Inc(); return err },
+		OnSuccess:    func(Task) error { c.success.Inc(); return err },
+		OnFailure:    func(Task, error) error { c.failure.Inc(); return err },
+		OnDeadLetter: func(Task, error) error { c.deadLetter.Inc(); return err },
+	}
+}
+
+func TestManagerHooksOnSuccess(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newManagerMocks(t)
+	defer cleanup()
+
+	task := mocks.task()
+
+	mocks.store.EXPECT().GetFailed().Return(nil, nil).AnyTimes()
+
+	gomock.InOrder(
+		mocks.store.EXPECT().GetPending().Return(nil, nil),
+		task.EXPECT().Ready().Return(true),
+		mocks.store.EXPECT().AddPending(task).Return(nil),
+		mocks.executor.EXPECT().Exec(task).Return(nil),
+		mocks.store.EXPECT().Remove(task).Return(nil),
+	)
+
+	var counts hookCounts
+	mocks.executor.EXPECT().Name().Return("mock executor")
+	m, err := NewManager(
+		mocks.config, tally.NoopScope, mocks.store, mocks.executor, WithHooks(counts.hooks(nil)))
+	require.NoError(err)
+	defer m.Close()
+
+	waitForWorkers()
+
+	require.NoError(m.Add(task))
+
+	time.Sleep(50 * time.Millisecond)
+
+	require.Equal(int64(1), counts.enqueue.Load())
+	require.Equal(int64(1), counts.attempt.Load())
+	require.Equal(int64(1), counts.success.Load())
+	require.Equal(int64(0), counts.failure.Load())
+	require.Equal(int64(0), counts.deadLetter.Load())
+}
+
+// shedderStore is a Store which records the shedding configuration of its
+// manager.
+type shedderStore struct {
+	*mockpersistedretry.MockStore
+
+	maxFailures int
+	shed        func(Task, error)
+}
+
+func (s *shedderStore) SetShedding(maxFailures int, shed func(Task, error)) {
+	s.maxFailures = maxFailures
+	s.shed = shed
+}
+
+func TestManagerHooksOnDeadLetterOfTasksShedByStore(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newManagerMocks(t)
+	defer cleanup()
+
+	mocks.config.MaxFailures = 3
+
+	store := &shedderStore{MockStore: mocks.store}
+	mocks.store.EXPECT().GetPending().Return(nil, nil)
+	mocks.store.EXPECT().GetFailed().Return(nil, nil).AnyTimes()
+
+	var counts hookCounts
+	mocks.executor.EXPECT().Name().Return("mock executor")
+	m, err := NewManager(
+		mocks.config, tally.NoopScope, store, mocks.executor, WithHooks(counts.hooks(nil)))
+	require.NoError(err)
+	defer m.Close()
+
+	require.Equal(3, store.maxFailures)
+	require.NotNil(store.shed)
+
+	store.shed(mocks.task(), errors.New("shed"))
+
+	require.Equal(int64(1), counts.deadLetter.Load())
+	require.Equal(int64(0), counts.failure.Load())
+}
+
+func TestManagerHooksOnDeadLetter(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newManagerMocks(t)
+	defer cleanup()
+
+	mocks.config.MaxFailures = 1
+
+	task := mocks.task()
+
+	mocks.store.EXPECT().GetFailed().Return(nil, nil).AnyTimes()
+
+	gomock.InOrder(
+		mocks.store.EXPECT().GetPending().Return(nil, nil),
+		task.EXPECT().Ready().Return(true),
+		mocks.store.EXPECT().AddPending(task).Return(nil),
+		mocks.executor.EXPECT().Exec(task).Return(errors.New("task failed")),
+		mocks.store.EXPECT().MarkFailed(task).Return(nil),
+		task.EXPECT().GetFailures().Return(1),
+		task.EXPECT().Tags().Return(nil),
+		mocks.store.EXPECT().Remove(task).Return(nil),
+	)
+
+	// Hook errors are logged, but the task is still dropped.
+	var counts hookCounts
+	mocks.executor.EXPECT().Name().Return("mock executor")
+	m, err := NewManager(
+		mocks.config, tally.NoopScope, mocks.store, mocks.executor,
+		WithHooks(counts.hooks(errors.New("hook failed"))))
+	require.NoError(err)
+	defer m.Close()
+
+	waitForWorkers()
+
+	require.NoError(m.Add(task))
+
+	time.Sleep(50 * time.Millisecond)
+
+	require.Equal(int64(1), counts.enqueue.Load())
+	require.Equal(int64(1), counts.attempt.Load())
+	require.Equal(int64(0), counts.success.Load())
+	require.Equal(int64(1), counts.failure.Load())
+	require.Equal(int64(1), counts.deadLetter.Load())
+}
+
+func TestManagerSlowHookDoesNotStallTask(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newManagerMocks(t)
+	defer cleanup()
+
+	mocks.config.HookTimeout = 5 * time.Millisecond
+
+	task := mocks.task()
+
+	mocks.store.EXPECT().GetFailed().Return(nil, nil).AnyTimes()
+
+	gomock.InOrder(
+		mocks.store.EXPECT().GetPending().Return(nil, nil),
+		task.EXPECT().Ready().Return(true),
+		mocks.store.EXPECT().AddPending(task).Return(nil),
+		mocks.executor.EXPECT().Exec(task).Return(nil),
+		mocks.store.EXPECT().Remove(task).Return(nil),
+	)
+
+	unblock := make(chan struct{})
+	defer close(unblock)
+
+	mocks.executor.EXPECT().Name().Return("mock executor")
+	m, err := NewManager(
+		mocks.config, tally.NoopScope, mocks.store, mocks.executor, WithHooks(Hooks{
+			OnAttempt: func(Task) error {
+				<-unblock
+				return nil
+			},
+		}))
+	require.NoError(err)
+	defer m.Close()
+
+	waitForWorkers()
+
+	require.NoError(m.Add(task))
+
+	time.Sleep(50 * time.Millisecond)
+}
+
+func TestManagerCloseDrainsQueuedTasks(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newManagerMocks(t)
+	defer cleanup()
+
+	mocks.config.IncomingBuffer = 10
+	mocks.config.Drain = DrainConfig{Enabled: true, GracePeriod: 5 * time.Second}
+
+	mocks.store.EXPECT().GetPending().Return(nil, nil)
+	mocks.store.EXPECT().GetFailed().Return(nil, nil).AnyTimes()
+
+	var tasks []*mockpersistedretry.MockTask
+	for i := 0; i < 3; i++ {
+		task := mocks.task()
+		task.EXPECT().Ready().Return(true)
+		mocks.store.EXPECT().AddPending(task).Return(nil)
+		mocks.executor.EXPECT().Exec(task).DoAndReturn(func(Task) error {
+			time.Sleep(20 * time.Millisecond)
+			return nil
+		})
+		mocks.store.EXPECT().Remove(task).Return(nil)
+		tasks = append(tasks, task)
+	}
+
+	m, err := mocks.new()
+	require.NoError(err)
+
+	waitForWorkers()
+
+	for _, task := range tasks {
+		require.NoError(m.Add(task))
+	}
+
+	// All tasks must be executed before Close returns.
+	m.Close()
+}
+
+func TestManagerCloseDrainLeavesTasksPendingAfterGracePeriod(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newManagerMocks(t)
+	defer cleanup()
+
+	mocks.config.IncomingBuffer = 10
+	mocks.config.Drain = DrainConfig{Enabled: true, GracePeriod: 50 * time.Millisecond}
+
+	mocks.store.EXPECT().GetPending().Return(nil, nil)
+	mocks.store.EXPECT().GetFailed().Return(nil, nil).AnyTimes()
+
+	release := make(chan struct{})
+
+	task1 := mocks.task()
+	task1.EXPECT().Ready().Return(true)
+	mocks.store.EXPECT().AddPending(task1).Return(nil)
+	mocks.executor.EXPECT().Exec(task1).DoAndReturn(func(Task) error {
+		<-release
+		return nil
+	})
+	mocks.store.EXPECT().Remove(task1).Return(nil)
+
+	// task2 is stuck behind task1 for longer than the grace period, so it is
+	// never executed and remains pending in the store.
+	task2 := mocks.task()
+	task2.EXPECT().Ready().Return(true)
+	mocks.store.EXPECT().AddPending(task2).Return(nil)
+
+	m, err := mocks.new()
+	require.NoError(err)
+
+	waitForWorkers()
+
+	require.NoError(m.Add(task1))
+	waitForWorkers()
+	require.NoError(m.Add(task2))
+
+	time.AfterFunc(100*time.Millisecond, func() { close(release) })
+
+	start := time.Now()
+	m.Close()
+	require.True(time.Since(start) >= 100*time.Millisecond)
+}
+
+func TestManagerCloseDrainGracePeriodUsesClock(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newManagerMocks(t)
+	defer cleanup()
+
+	mocks.config.IncomingBuffer = 10
+	mocks.config.Drain = DrainConfig{Enabled: true, GracePeriod: time.Second}
+
+	mocks.store.EXPECT().GetPending().Return(nil, nil)
+	mocks.store.EXPECT().GetFailed().Return(nil, nil).AnyTimes()
+
+	release := make(chan struct{})
+
+	task1 := mocks.task()
+	task1.EXPECT().Ready().Return(true)
+	mocks.store.EXPECT().AddPending(task1).Return(nil)
+	mocks.executor.EXPECT().Exec(task1).DoAndReturn(func(Task) error {
+		<-release
+		return nil
+	})
+	mocks.store.EXPECT().Remove(task1).Return(nil)
+
+	task2 := mocks.task()
+	task2.EXPECT().Ready().Return(true)
+	mocks.store.EXPECT().AddPending(task2).Return(nil)
+
+	clk := clock.NewMock()
+	mocks.executor.EXPECT().Name().Return("mock executor")
+	m, err := NewManager(
+		mocks.config, tally.NoopScope, mocks.store, mocks.executor, WithClock(clk))
+	require.NoError(err)
+
+	waitForWorkers()
+
+	require.NoError(m.Add(task1))
+	waitForWorkers()
+	require.NoError(m.Add(task2))
+
+	closed := make(chan struct{})
+	go func() {
+		m.Close()
+		close(closed)
+	}()
+
+	// Drain waits on the clock, not on wall time.
+	waitForWorkers()
+	select {
+	case <-closed:
+		require.FailNow("closed before the grace period elapsed")
+	case <-time.After(50 * time.Millisecond):
+	}
+	clk.Add(time.Second)
+	close(release)
+
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		require.FailNow("close did not return after the grace period elapsed")
+	}
+}
+
+type testPauser struct {
+	paused  *atomic.Bool
+	resumed chan struct{}
+}
+
+func (p testPauser) Paused(Task) bool { return p.paused.Load() }
+
+func (p testPauser) Resumed() <-chan struct{} { return p.resumed }
+
+func TestManagerLeavesPausedTasksInStoreUntilResumed(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newManagerMocks(t)
+	defer cleanup()
+
+	// Resumed tasks are retried without waiting for a poll.
+	mocks.config.PollRetriesInterval = time.Hour
+
+	pauser := testPauser{atomic.NewBool(true), make(chan struct{})}
+
+	task := mocks.task()
+
+	mocks.store.EXPECT().GetPending().Return(nil, nil)
+
+	task.EXPECT().Ready().Return(true)
+	mocks.store.EXPECT().AddPending(task).Return(nil)
+
+	paused := make(chan struct{})
+	mocks.store.EXPECT().MarkPaused(task).DoAndReturn(func(Task) error {
+		close(paused)
+		return nil
+	})
+
+	mocks.executor.EXPECT().Name().Return("mock executor")
+	m, err := NewManager(
+		mocks.config, tally.NoopScope, mocks.store, mocks.executor, WithPauser(pauser))
+	require.NoError(err)
+	defer m.Close()
+
+	waitForWorkers()
+
+	require.NoError(m.Add(task))
+
+	select {
+	case <-paused:
+	case <-time.After(time.Second):
+		require.FailNow("task not marked as paused")
+	}
+
+	executed := make(chan struct{})
+	gomock.InOrder(
+		mocks.store.EXPECT().GetFailed().Return([]Task{task}, nil),
+		task.EXPECT().Ready().Return(true),
+		task.EXPECT().GetLastAttempt().Return(time.Time{}),
+		mocks.store.EXPECT().MarkPending(task).Return(nil),
+		mocks.executor.EXPECT().Exec(task).DoAndReturn(func(Task) error {
+			close(executed)
+			return nil
+		}),
+		mocks.store.EXPECT().Remove(task).Return(nil),
+	)
+
+	pauser.paused.Store(false)
+	pauser.resumed <- struct{}{}
+
+	select {
+	case <-executed:
+	case <-time.After(time.Second):
+		require.FailNow("task not executed after resume")
+	}
+}
@@ -0,0 +1,73 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package persistedretry
+
+import "github.com/uber/kraken/utils/log"
+
+// Pauser decides whether dispatch of a task is paused, e.g. while its
+// destination is under maintenance.
+type Pauser interface {
+	Paused(Task) bool
+}
+
+// WithPauser configures p to hold back dispatch of paused tasks. Paused tasks
+// are left in the store without being attempted, and are retried by polling
+// once p no longer pauses them. May be supplied multiple times,
+// in which case tasks are paused while any Pauser pauses them.
+func WithPauser(p Pauser) ManagerOption {
+	return func(m *manager) { m.pausers = append(m.pausers, p) }
+}
+
+func (m *manager) paused(t Task) bool {
+	for _, p := range m.pausers {
+		if p.Paused(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// ResumeNotifier is optionally implemented by Pausers which signal when tasks
+// may have been resumed, such that they are retried without waiting for the
+// next poll.
+type ResumeNotifier interface {
+	Resumed() <-chan struct{}
+}
+
+// park leaves t in the store until it is no longer paused, after which it is
+// retried by polling.
+func (m *manager) park(t Task) {
+	m.stats.Counter("paused_tasks").Inc(1)
+	if err := m.store.MarkPaused(t); err != nil {
+		log.With("task", t).Errorf("Error marking task as paused: %s", err)
+	}
+}
+
+// notifyResumed polls retries whenever a Pauser signals that tasks may have
+// been resumed.
+func (m *manager) notifyResumed(n ResumeNotifier) {
+	defer m.wg.Done()
+
+	for {
+		select {
+		case <-m.done:
+			return
+		case <-n.Resumed():
+			select {
+			case m.resumed <- struct{}{}:
+			default:
+			}
+		}
+	}
+}
@@ -0,0 +1,76 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package tagreplication
+
+import (
+	"fmt"
+
+	"github.com/uber/kraken/lib/persistedretry"
+	"github.com/uber/kraken/lib/persistedretry/callback"
+)
+
+// CallbackHooks returns hooks which notify the callbacks of tasks once they
+// succeed, and once they failed config.NotifyFailureAfter times or were dropped
+// after exhausting their max failures, whichever comes first. Failure is thus
+// reported even by managers without max failures, whose tasks may still succeed
+// and report success afterwards. Notifications are delivered via callbacks,
+// such that they are retried independently of replication.
+func CallbackHooks(callbacks persistedretry.Manager, config callback.Config) persistedretry.Hooks {
+	threshold := config.NotifyFailureAfter
+	if threshold == 0 {
+		threshold = 3
+	}
+	notify := func(r persistedretry.Task, outcome string, err error) error {
+		t := r.(*Task)
+		if t.Callback == "" {
+			return nil
+		}
+		n := callback.Notification{
+			Tag:      t.Tag,
+			Digest:   t.Digest.String(),
+			Remote:   t.Destination,
+			Outcome:  outcome,
+			Failures: t.Failures,
+		}
+		if err != nil {
+			n.Error = err.Error()
+		}
+		task, err := callback.NewTask(t.Callback, n)
+		if err != nil {
+			return err
+		}
+		if err := callbacks.Add(task); err != nil {
+			return fmt.Errorf("add callback task: %s", err)
+		}
+		return nil
+	}
+	return persistedretry.Hooks{
+		OnSuccess: func(t persistedretry.Task) error {
+			return notify(t, callback.OutcomeSuccess, nil)
+		},
+		OnFailure: func(t persistedretry.Task, err error) error {
+			if t.GetFailures() != threshold {
+				return nil
+			}
+			return notify(t, callback.OutcomeFailure, err)
+		},
+		OnDeadLetter: func(t persistedretry.Task, err error) error {
+			if t.GetFailures() >= threshold {
+				// Already reported once the threshold was reached.
+				return nil
+			}
+			return notify(t, callback.OutcomeFailure, err)
+		},
+	}
+}
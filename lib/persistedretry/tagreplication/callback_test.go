@@ -0,0 +1,193 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package tagreplication_test
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+	"github.com/uber-go/tally"
+
+	"github.com/uber/kraken/lib/persistedretry"
+	"github.com/uber/kraken/lib/persistedretry/callback"
+	. "github.com/uber/kraken/lib/persistedretry/tagreplication"
+	"github.com/uber/kraken/localdb"
+	mockpersistedretry "github.com/uber/kraken/mocks/lib/persistedretry"
+	mocktagreplication "github.com/uber/kraken/mocks/lib/persistedretry/tagreplication"
+	"github.com/uber/kraken/utils/testutil"
+)
+
+func startCallbackServer(t *testing.T) (string, <-chan callback.Notification, func()) {
+	received := make(chan callback.Notification, 10)
+	addr, stop := testutil.StartServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, err := ioutil.ReadAll(r.Body)
+		require.NoError(t, err)
+		var n callback.Notification
+		require.NoError(t, json.Unmarshal(b, &n))
+		require.Equal(t, callback.Sign("secret", b), r.Header.Get(callback.SignatureHeader))
+		received <- n
+	}))
+	return "http://" + addr + "/replicated", received, stop
+}
+
+func TestCallbackHooksNotifyOutcome(t *testing.T) {
+	tests := []struct {
+		desc     string
+		execErr  error
+		expected func(*Task) callback.Notification
+	}{
+		{
+			"success", nil,
+			func(task *Task) callback.Notification {
+				return callback.Notification{
+					Tag:     task.Tag,
+					Digest:  task.Digest.String(),
+					Remote:  task.Destination,
+					Outcome: callback.OutcomeSuccess,
+				}
+			},
+		}, {
+			"failure", errors.New("some error"),
+			func(task *Task) callback.Notification {
+				return callback.Notification{
+					Tag:      task.Tag,
+					Digest:   task.Digest.String(),
+					Remote:   task.Destination,
+					Outcome:  callback.OutcomeFailure,
+					Error:    "some error",
+					Failures: 1,
+				}
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			require := require.New(t)
+
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			db, cleanup := localdb.Fixture()
+			defer cleanup()
+
+			url, received, stop := startCallbackServer(t)
+			defer stop()
+
+			callbacks, err := persistedretry.NewManager(
+				persistedretry.Config{},
+				tally.NoopScope,
+				callback.NewStore(db),
+				callback.NewExecutor(callback.Config{Secret: "secret"}, tally.NoopScope))
+			require.NoError(err)
+			defer callbacks.Close()
+
+			store, err := NewStore(db, mocktagreplication.NewMockRemoteValidator(ctrl))
+			require.NoError(err)
+
+			executor := mockpersistedretry.NewMockExecutor(ctrl)
+			executor.EXPECT().Name().Return("tagreplication").AnyTimes()
+
+			replications, err := persistedretry.NewManager(
+				persistedretry.Config{MaxFailures: 1},
+				tally.NoopScope,
+				store,
+				executor,
+				persistedretry.WithHooks(CallbackHooks(callbacks, callback.Config{})))
+			require.NoError(err)
+			defer replications.Close()
+
+			task := TaskFixture()
+			task.Callback = url
+
+			executor.EXPECT().Exec(MatchTask(task)).Return(test.execErr)
+
+			require.NoError(replications.Add(task))
+
+			select {
+			case n := <-received:
+				require.Equal(test.expected(task), n)
+			case <-time.After(5 * time.Second):
+				require.FailNow("callback not received")
+			}
+		})
+	}
+}
+
+func TestCallbackHooksNotifyFailureOfTasksRetriedForever(t *testing.T) {
+	require := require.New(t)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	db, cleanup := localdb.Fixture()
+	defer cleanup()
+
+	url, received, stop := startCallbackServer(t)
+	defer stop()
+
+	config := callback.Config{Secret: "secret", NotifyFailureAfter: 2}
+
+	callbacks, err := persistedretry.NewManager(
+		persistedretry.Config{},
+		tally.NoopScope,
+		callback.NewStore(db),
+		callback.NewExecutor(config, tally.NoopScope))
+	require.NoError(err)
+	defer callbacks.Close()
+
+	store, err := NewStore(db, mocktagreplication.NewMockRemoteValidator(ctrl))
+	require.NoError(err)
+
+	executor := mockpersistedretry.NewMockExecutor(ctrl)
+	executor.EXPECT().Name().Return("tagreplication").AnyTimes()
+	executor.EXPECT().Exec(gomock.Any()).Return(errors.New("some error")).AnyTimes()
+
+	replications, err := persistedretry.NewManager(
+		persistedretry.Config{
+			RetryInterval:       10 * time.Millisecond,
+			PollRetriesInterval: 10 * time.Millisecond,
+		},
+		tally.NoopScope,
+		store,
+		executor,
+		persistedretry.WithHooks(CallbackHooks(callbacks, config)))
+	require.NoError(err)
+	defer replications.Close()
+
+	task := TaskFixture()
+	task.Callback = url
+
+	require.NoError(replications.Add(task))
+
+	select {
+	case n := <-received:
+		require.Equal(callback.OutcomeFailure, n.Outcome)
+		require.Equal(2, n.Failures)
+	case <-time.After(5 * time.Second):
+		require.FailNow("callback not received")
+	}
+
+	// Failure is reported once, even though the task keeps failing.
+	select {
+	case n := <-received:
+		require.FailNow("unexpected callback", "%+v", n)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
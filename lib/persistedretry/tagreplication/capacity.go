@@ -0,0 +1,238 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package tagreplication
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+
+	"github.com/uber-go/tally"
+
+	"github.com/uber/kraken/lib/persistedretry"
+	"github.com/uber/kraken/utils/log"
+)
+
+// ErrReplicationBacklogFull is returned when a task cannot be added because the
+// store is out of room.
+var ErrReplicationBacklogFull = errors.New("replication backlog full")
+
+var (
+	errCompacted = errors.New("compacted after exhausting max failures")
+	errShed      = errors.New("shed to make room for high priority task")
+)
+
+// CapacityConfig bounds the number of tasks held by a Store. Once utilization
+// reaches ShedThreshold, failed tasks which exhausted the max failures of the
+// manager are compacted first. If utilization remains at ShedThreshold, tasks
+// which are not high priority are rejected, such that the remaining room is
+// reserved for high priority tasks. Once the store is full, high priority tasks
+// displace the oldest failed tasks which are not high priority.
+type CapacityConfig struct {
+	// MaxTasks is the maximum number of tasks held. Zero is unbounded.
+	MaxTasks int `yaml:"max_tasks"`
+
+	// ShedThreshold is the fraction of MaxTasks from which tasks which are
+	// not high priority are shed.
+	ShedThreshold float64 `yaml:"shed_threshold"`
+
+	// HighPriorityTags are regular expressions of high priority tags.
+	HighPriorityTags []string `yaml:"high_priority_tags"`
+}
+
+func (c CapacityConfig) applyDefaults() CapacityConfig {
+	if c.ShedThreshold == 0 {
+		c.ShedThreshold = 0.9
+	}
+	return c
+}
+
+// StoreOption allows setting optional Store parameters.
+type StoreOption func(*Store)
+
+// WithCapacity bounds the tasks held by the Store, and emits its utilization
+// to stats.
+func WithCapacity(config CapacityConfig, stats tally.Scope) StoreOption {
+	return func(s *Store) {
+		s.capacity = config.applyDefaults()
+		s.stats = stats.Tagged(map[string]string{"module": "tagreplicationstore"})
+	}
+}
+
+// SetShedding implements persistedretry.Shedder.
+func (s *Store) SetShedding(maxFailures int, shed func(persistedretry.Task, error)) {
+	s.capacityMu.Lock()
+	defer s.capacityMu.Unlock()
+
+	s.maxFailures = maxFailures
+	s.onShed = shed
+}
+
+func (s *Store) compileHighPriorityTags() error {
+	for _, p := range s.capacity.HighPriorityTags {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return fmt.Errorf("regexp compile %s: %s", p, err)
+		}
+		s.highPriority = append(s.highPriority, re)
+	}
+	return nil
+}
+
+// isHighPriority returns whether t is of high priority, either inherited from
+// upstream or because its tag is configured as high priority.
+func (s *Store) isHighPriority(t *Task) bool {
+	return t.Priority >= PriorityHigh || s.matchesHighPriorityTags(t)
+}
+
+func (s *Store) matchesHighPriorityTags(t *Task) bool {
+	for _, re := range s.highPriority {
+		if re.MatchString(t.Tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// reserve makes room for t, compacting dead letters and shedding low priority
+// tasks if necessary. Returns persistedretry.ErrTaskExists if t is already in
+// the store, since it then needs no room, and ErrReplicationBacklogFull if
+// there is no room for t. Must be called with capacityMu held.
+func (s *Store) reserve(t *Task) error {
+	if s.capacity.MaxTasks == 0 {
+		return nil
+	}
+	var exists int
+	err := s.db.Get(&exists, `
+		SELECT COUNT(*) FROM replicate_tag_task WHERE tag=? AND destination=?`,
+		t.Tag, t.Destination)
+	if err != nil {
+		return fmt.Errorf("count existing: %s", err)
+	}
+	if exists > 0 {
+		return persistedretry.ErrTaskExists
+	}
+	n, err := s.count()
+	if err != nil {
+		return err
+	}
+	if s.aboveShedThreshold(n) {
+		compacted, err := s.compact()
+		if err != nil {
+			return fmt.Errorf("compact: %s", err)
+		}
+		n -= compacted
+	}
+	s.stats.Gauge("utilization").Update(float64(n) / float64(s.capacity.MaxTasks))
+
+	if !s.aboveShedThreshold(n) {
+		return nil
+	}
+	if !s.isHighPriority(t) {
+		s.stats.Counter("rejected_tasks").Inc(1)
+		return ErrReplicationBacklogFull
+	}
+	if n < s.capacity.MaxTasks {
+		return nil
+	}
+	shed, err := s.shedLowPriority(n - s.capacity.MaxTasks + 1)
+	if err != nil {
+		return fmt.Errorf("shed: %s", err)
+	}
+	if n-shed >= s.capacity.MaxTasks {
+		s.stats.Counter("rejected_tasks").Inc(1)
+		return ErrReplicationBacklogFull
+	}
+	return nil
+}
+
+func (s *Store) count() (int, error) {
+	var n int
+	if err := s.db.Get(&n, `SELECT COUNT(*) FROM replicate_tag_task`); err != nil {
+		return 0, fmt.Errorf("count tasks: %s", err)
+	}
+	return n, nil
+}
+
+func (s *Store) aboveShedThreshold(n int) bool {
+	return float64(n) >= s.capacity.ShedThreshold*float64(s.capacity.MaxTasks)
+}
+
+// compact deletes failed tasks which exhausted the max failures of the manager,
+// e.g. since the manager failed to remove them or its max failures were
+// lowered. Such tasks are never retried, so they only take up room.
+func (s *Store) compact() (int, error) {
+	if s.maxFailures == 0 {
+		return 0, nil
+	}
+	var tasks []*Task
+	err := s.db.Select(&tasks, `
+		SELECT tag, digest, dependencies, destination, created_at, last_attempt, failures, delay, callback,
+			after_tags, priority
+		FROM replicate_tag_task
+		WHERE status="failed" AND failures>=?`, s.maxFailures)
+	if err != nil {
+		return 0, err
+	}
+	for i, t := range tasks {
+		if err := s.drop(t, errCompacted); err != nil {
+			return i, err
+		}
+		s.stats.Counter("compacted_tasks").Inc(1)
+	}
+	return len(tasks), nil
+}
+
+// drop deletes t and notifies the manager, such that the dead letter hooks of t
+// run as if the manager dropped t itself.
+func (s *Store) drop(t *Task, reason error) error {
+	if err := s.delete(t); err != nil {
+		return err
+	}
+	if s.onShed != nil {
+		s.onShed(t, reason)
+	}
+	return nil
+}
+
+// shedLowPriority deletes up to limit of the oldest failed tasks which are not
+// high priority. Pending tasks are never shed, since they may be executing.
+func (s *Store) shedLowPriority(limit int) (int, error) {
+	var tasks []*Task
+	err := s.db.Select(&tasks, `
+		SELECT tag, digest, dependencies, destination, created_at, last_attempt, failures, delay, callback,
+			after_tags, priority
+		FROM replicate_tag_task
+		WHERE status="failed"
+		ORDER BY created_at`)
+	if err != nil {
+		return 0, err
+	}
+	var shed int
+	for _, t := range tasks {
+		if shed == limit {
+			break
+		}
+		if s.isHighPriority(t) {
+			continue
+		}
+		if err := s.drop(t, errShed); err != nil {
+			return shed, err
+		}
+		log.With("task", t).Warn("Shed replication task to make room for high priority task")
+		s.stats.Counter("shed_tasks").Inc(1)
+		shed++
+	}
+	return shed, nil
+}
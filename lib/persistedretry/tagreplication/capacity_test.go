@@ -0,0 +1,217 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package tagreplication_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/uber-go/tally"
+
+	"github.com/uber/kraken/lib/persistedretry"
+	. "github.com/uber/kraken/lib/persistedretry/tagreplication"
+)
+
+func TestStoreNearCapacityShedsLowPriorityTasks(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newStoreMocks(t)
+	defer cleanup()
+
+	stats := tally.NewTestScope("", nil)
+	store, err := NewStore(mocks.db, mocks.rv, WithCapacity(CapacityConfig{
+		MaxTasks:         4,
+		ShedThreshold:    0.5,
+		HighPriorityTags: []string{"-release$"},
+	}, stats))
+	require.NoError(err)
+
+	highPriority := func() *Task {
+		task := TaskFixture()
+		task.Tag += "-release"
+		return task
+	}
+
+	low1 := TaskFixture()
+	low2 := TaskFixture()
+	require.NoError(store.AddFailed(low1))
+	require.NoError(store.AddFailed(low2))
+
+	// Near capacity, low priority tasks are rejected while high priority tasks
+	// are accepted.
+	require.Equal(ErrReplicationBacklogFull, store.AddPending(TaskFixture()))
+	require.NoError(store.AddPending(highPriority()))
+	require.NoError(store.AddPending(highPriority()))
+
+	// Once full, high priority tasks displace the oldest low priority tasks.
+	require.NoError(store.AddPending(highPriority()))
+	require.NoError(store.AddPending(highPriority()))
+	failed, err := store.GetFailed()
+	require.NoError(err)
+	require.Empty(failed)
+
+	// Without low priority tasks to shed, the store is out of room.
+	require.Equal(ErrReplicationBacklogFull, store.AddPending(highPriority()))
+
+	snapshot := stats.Snapshot()
+	require.Equal(int64(2), snapshot.Counters()["shed_tasks+module=tagreplicationstore"].Value())
+	require.Equal(int64(2), snapshot.Counters()["rejected_tasks+module=tagreplicationstore"].Value())
+	require.Equal(float64(1), snapshot.Gauges()["utilization+module=tagreplicationstore"].Value())
+}
+
+func TestStoreKeepsInheritedPriority(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newStoreMocks(t)
+	defer cleanup()
+
+	// High priority tags are configured per cluster, thus downstream clusters
+	// may not configure the tags upstream clusters consider high priority.
+	store, err := NewStore(mocks.db, mocks.rv, WithCapacity(CapacityConfig{
+		MaxTasks:      2,
+		ShedThreshold: 0.5,
+	}, tally.NoopScope))
+	require.NoError(err)
+
+	require.NoError(store.AddFailed(TaskFixture()))
+
+	require.Equal(ErrReplicationBacklogFull, store.AddPending(TaskFixture()))
+	inherited := TaskFixture()
+	inherited.Priority = PriorityHigh
+	require.NoError(store.AddPending(inherited))
+
+	pending, err := store.GetPending()
+	require.NoError(err)
+	require.Len(pending, 1)
+	require.Equal(PriorityHigh, pending[0].(*Task).Priority)
+}
+
+func TestStoreStampsPriorityOfHighPriorityTags(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newStoreMocks(t)
+	defer cleanup()
+
+	store, err := NewStore(mocks.db, mocks.rv, WithCapacity(CapacityConfig{
+		HighPriorityTags: []string{"-release$"},
+	}, tally.NoopScope))
+	require.NoError(err)
+
+	task := TaskFixture()
+	task.Tag += "-release"
+	require.NoError(store.AddPending(task))
+	require.NoError(store.AddPending(TaskFixture()))
+
+	pending, err := store.GetPending()
+	require.NoError(err)
+	priorities := make(map[string]int)
+	for _, p := range pending {
+		priorities[p.(*Task).Tag] = p.(*Task).Priority
+	}
+	require.Equal(PriorityHigh, priorities[task.Tag])
+	require.Len(priorities, 2)
+}
+
+func TestStoreAtCapacityAcceptsExistingTasks(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newStoreMocks(t)
+	defer cleanup()
+
+	store, err := NewStore(mocks.db, mocks.rv, WithCapacity(CapacityConfig{
+		MaxTasks: 1,
+	}, tally.NoopScope))
+	require.NoError(err)
+
+	task := TaskFixture()
+	require.NoError(store.AddPending(task))
+
+	// Re-adding a task needs no room, so it is a duplicate rather than a full
+	// backlog.
+	require.Equal(persistedretry.ErrTaskExists, store.AddPending(task))
+	require.Equal(ErrReplicationBacklogFull, store.AddPending(TaskFixture()))
+}
+
+func TestStoreNearCapacityCompactsDeadLettersBeforeShedding(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newStoreMocks(t)
+	defer cleanup()
+
+	stats := tally.NewTestScope("", nil)
+	store, err := NewStore(mocks.db, mocks.rv, WithCapacity(CapacityConfig{
+		MaxTasks:      2,
+		ShedThreshold: 1,
+	}, stats))
+	require.NoError(err)
+
+	var dropped []persistedretry.Task
+	store.SetShedding(2, func(t persistedretry.Task, err error) {
+		dropped = append(dropped, t)
+	})
+
+	dead := TaskFixture()
+	require.NoError(store.AddPending(dead))
+	require.NoError(store.MarkFailed(dead))
+	require.NoError(store.MarkFailed(dead))
+
+	retrying := TaskFixture()
+	require.NoError(store.AddPending(retrying))
+	require.NoError(store.MarkFailed(retrying))
+
+	// The dead letter makes room for a low priority task, and the task which
+	// is still retried is kept.
+	require.NoError(store.AddPending(TaskFixture()))
+
+	require.Len(dropped, 1)
+	require.Equal(dead.Tag, dropped[0].(*Task).Tag)
+	require.Equal(dead.Digest, dropped[0].(*Task).Digest)
+
+	failed, err := store.GetFailed()
+	require.NoError(err)
+	require.Len(failed, 1)
+	require.Equal(retrying.Tag, failed[0].(*Task).Tag)
+
+	snapshot := stats.Snapshot()
+	require.Equal(int64(1), snapshot.Counters()["compacted_tasks+module=tagreplicationstore"].Value())
+}
+
+func TestStoreShedTasksAreReportedToManager(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newStoreMocks(t)
+	defer cleanup()
+
+	store, err := NewStore(mocks.db, mocks.rv, WithCapacity(CapacityConfig{
+		MaxTasks:         1,
+		HighPriorityTags: []string{"-release$"},
+	}, tally.NoopScope))
+	require.NoError(err)
+
+	var dropped []persistedretry.Task
+	store.SetShedding(0, func(t persistedretry.Task, err error) {
+		dropped = append(dropped, t)
+	})
+
+	low := TaskFixture()
+	require.NoError(store.AddFailed(low))
+
+	high := TaskFixture()
+	high.Tag += "-release"
+	require.NoError(store.AddPending(high))
+
+	require.Len(dropped, 1)
+	require.Equal(low.Tag, dropped[0].(*Task).Tag)
+	require.Equal(low.Callback, dropped[0].(*Task).Callback)
+}
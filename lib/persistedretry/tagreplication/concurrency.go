@@ -0,0 +1,192 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package tagreplication
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/uber-go/tally"
+
+	"github.com/uber/kraken/lib/persistedretry"
+)
+
+// ConcurrencyConfig bounds the replications of each namespace which execute at
+// once, where the namespace of a tag is its repository, e.g. "team/repo" of
+// "team/repo:latest". Namespaces with huge dependency sets thus cannot occupy
+// every replication worker, while workers left idle by one namespace are free
+// for any other. Namespaces at their limit borrow the slots of idle workers, as
+// long as IdleReserve workers remain idle for other namespaces.
+type ConcurrencyConfig struct {
+	Enabled bool `yaml:"enabled"`
+
+	// Default is the limit of each namespace without an override.
+	Default int `yaml:"default"`
+
+	// Overrides replace the default limit of specific namespaces.
+	Overrides []ConcurrencyOverride `yaml:"overrides"`
+
+	// IdleReserve is the number of workers which are never lent to namespaces
+	// at their limit.
+	IdleReserve int `yaml:"idle_reserve"`
+}
+
+// ConcurrencyOverride defines the limit of a single namespace.
+type ConcurrencyOverride struct {
+	Namespace string `yaml:"namespace"`
+	Limit     int    `yaml:"limit"`
+}
+
+func (c ConcurrencyConfig) applyDefaults() ConcurrencyConfig {
+	if c.Default == 0 {
+		c.Default = 2
+	}
+	if c.IdleReserve == 0 {
+		c.IdleReserve = 1
+	}
+	return c
+}
+
+// NamespaceLimiter implements persistedretry.Limiter by bounding the in-flight
+// replications of each namespace. A nil NamespaceLimiter does not limit.
+type NamespaceLimiter struct {
+	config    ConcurrencyConfig
+	stats     tally.Scope
+	overrides map[string]int
+
+	mu       sync.Mutex
+	inflight map[string]int
+
+	// In-flight replications per metric group, see group.
+	groups map[string]int
+}
+
+// NewNamespaceLimiter returns a new NamespaceLimiter, or nil if config is not
+// enabled.
+func NewNamespaceLimiter(config ConcurrencyConfig, stats tally.Scope) *NamespaceLimiter {
+	if !config.Enabled {
+		return nil
+	}
+	config = config.applyDefaults()
+	overrides := make(map[string]int)
+	for _, o := range config.Overrides {
+		overrides[o.Namespace] = o.Limit
+	}
+	return &NamespaceLimiter{
+		config:    config,
+		stats:     stats.Tagged(map[string]string{"module": "tagreplication"}),
+		overrides: overrides,
+		inflight:  make(map[string]int),
+		groups:    make(map[string]int),
+	}
+}
+
+func (l *NamespaceLimiter) limit(namespace string) int {
+	if n, ok := l.overrides[namespace]; ok {
+		return n
+	}
+	return l.config.Default
+}
+
+// group returns the metric group of namespace, which is namespace itself if it
+// has an override and "default" otherwise, such that metrics are not tagged by
+// arbitrary namespaces.
+func (l *NamespaceLimiter) group(namespace string) string {
+	if _, ok := l.overrides[namespace]; ok {
+		return namespace
+	}
+	return "default"
+}
+
+// Acquire implements persistedretry.Limiter.
+func (l *NamespaceLimiter) Acquire(t persistedretry.Task, idle int) bool {
+	if l == nil {
+		return true
+	}
+	namespace, ok := taskNamespace(t)
+	if !ok {
+		return true
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.inflight[namespace] >= l.limit(namespace) {
+		if idle < l.config.IdleReserve {
+			return false
+		}
+		l.stats.Counter("lent_replication_slots").Inc(1)
+	}
+	l.inflight[namespace]++
+	l.groups[l.group(namespace)]++
+	l.update(namespace)
+	return true
+}
+
+// Release implements persistedretry.Limiter.
+func (l *NamespaceLimiter) Release(t persistedretry.Task) {
+	if l == nil {
+		return
+	}
+	namespace, ok := taskNamespace(t)
+	if !ok {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.inflight[namespace]--; l.inflight[namespace] <= 0 {
+		delete(l.inflight, namespace)
+	}
+	g := l.group(namespace)
+	if l.groups[g]--; l.groups[g] <= 0 {
+		delete(l.groups, g)
+	}
+	l.update(namespace)
+}
+
+// update emits the in-flight replications of the metric group of namespace.
+// Must be called with mu held.
+func (l *NamespaceLimiter) update(namespace string) {
+	g := l.group(namespace)
+	l.stats.Tagged(map[string]string{
+		"namespace": g,
+	}).Gauge("inflight_replications").Update(float64(l.groups[g]))
+}
+
+// InFlight returns the number of in-flight replications of each namespace with
+// replications in flight.
+func (l *NamespaceLimiter) InFlight() map[string]int {
+	inflight := make(map[string]int)
+	if l == nil {
+		return inflight
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for ns, n := range l.inflight {
+		inflight[ns] = n
+	}
+	return inflight
+}
+
+func taskNamespace(t persistedretry.Task) (string, bool) {
+	task, ok := t.(*Task)
+	if !ok {
+		return "", false
+	}
+	if i := strings.LastIndex(task.Tag, ":"); i >= 0 {
+		return task.Tag[:i], true
+	}
+	return task.Tag, true
+}
@@ -0,0 +1,211 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package tagreplication_test
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+	"github.com/uber-go/tally"
+	"go.uber.org/atomic"
+
+	"github.com/uber/kraken/lib/persistedretry"
+	. "github.com/uber/kraken/lib/persistedretry/tagreplication"
+	"github.com/uber/kraken/localdb"
+	mockpersistedretry "github.com/uber/kraken/mocks/lib/persistedretry"
+	mocktagreplication "github.com/uber/kraken/mocks/lib/persistedretry/tagreplication"
+	"github.com/uber/kraken/utils/testutil"
+)
+
+func TestNamespaceFloodDoesNotBlockOtherNamespaces(t *testing.T) {
+	require := require.New(t)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	db, cleanup := localdb.Fixture()
+	defer cleanup()
+
+	store, err := NewStore(db, mocktagreplication.NewMockRemoteValidator(ctrl))
+	require.NoError(err)
+
+	limiter := NewNamespaceLimiter(ConcurrencyConfig{Enabled: true, Default: 2}, tally.NoopScope)
+
+	executor := mockpersistedretry.NewMockExecutor(ctrl)
+	executor.EXPECT().Name().Return("tagreplication").AnyTimes()
+
+	unblock := make(chan struct{})
+	heavyDone := atomic.NewInt64(0)
+	lightDone := make(chan struct{})
+	executor.EXPECT().Exec(gomock.Any()).DoAndReturn(func(t persistedretry.Task) error {
+		if strings.HasPrefix(t.(*Task).Tag, "heavy/") {
+			<-unblock
+			heavyDone.Inc()
+		} else {
+			close(lightDone)
+		}
+		return nil
+	}).AnyTimes()
+
+	m, err := persistedretry.NewManager(
+		persistedretry.Config{NumIncomingWorkers: 3, NumRetryWorkers: 1},
+		tally.NoopScope,
+		store,
+		executor,
+		persistedretry.WithLimiter(limiter))
+	require.NoError(err)
+	defer m.Close()
+
+	var unblockOnce sync.Once
+	release := func() { unblockOnce.Do(func() { close(unblock) }) }
+	defer release()
+
+	for i := 0; i < 10; i++ {
+		task := TaskFixture()
+		task.Tag = fmt.Sprintf("heavy/repo:%d", i)
+		require.NoError(m.Add(task))
+	}
+	light := TaskFixture()
+	light.Tag = "light/repo:latest"
+	require.NoError(m.Add(light))
+
+	select {
+	case <-lightDone:
+	case <-time.After(5 * time.Second):
+		require.FailNow("light namespace blocked by heavy namespace")
+	}
+	require.NoError(testutil.PollUntilTrue(time.Second, func() bool {
+		return reflect.DeepEqual(map[string]int{"heavy/repo": 2}, limiter.InFlight())
+	}))
+
+	release()
+
+	require.NoError(testutil.PollUntilTrue(5*time.Second, func() bool {
+		return heavyDone.Load() == 10
+	}))
+	require.NoError(testutil.PollUntilTrue(time.Second, func() bool {
+		return len(limiter.InFlight()) == 0
+	}))
+}
+
+func TestNamespaceBorrowsIdleWorkers(t *testing.T) {
+	require := require.New(t)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	db, cleanup := localdb.Fixture()
+	defer cleanup()
+
+	store, err := NewStore(db, mocktagreplication.NewMockRemoteValidator(ctrl))
+	require.NoError(err)
+
+	limiter := NewNamespaceLimiter(ConcurrencyConfig{Enabled: true, Default: 1}, tally.NoopScope)
+
+	executor := mockpersistedretry.NewMockExecutor(ctrl)
+	executor.EXPECT().Name().Return("tagreplication").AnyTimes()
+
+	unblock := make(chan struct{})
+	done := atomic.NewInt64(0)
+	executor.EXPECT().Exec(gomock.Any()).DoAndReturn(func(persistedretry.Task) error {
+		<-unblock
+		done.Inc()
+		return nil
+	}).AnyTimes()
+
+	m, err := persistedretry.NewManager(
+		persistedretry.Config{NumIncomingWorkers: 3, NumRetryWorkers: 1},
+		tally.NoopScope,
+		store,
+		executor,
+		persistedretry.WithLimiter(limiter))
+	require.NoError(err)
+	defer m.Close()
+
+	var unblockOnce sync.Once
+	release := func() { unblockOnce.Do(func() { close(unblock) }) }
+	defer release()
+
+	for i := 0; i < 5; i++ {
+		task := TaskFixture()
+		task.Tag = fmt.Sprintf("only/repo:%d", i)
+		require.NoError(m.Add(task))
+	}
+
+	// The namespace borrows one worker beyond its limit, and leaves the last
+	// one idle for other namespaces.
+	require.NoError(testutil.PollUntilTrue(time.Second, func() bool {
+		return reflect.DeepEqual(map[string]int{"only/repo": 2}, limiter.InFlight())
+	}))
+
+	release()
+
+	require.NoError(testutil.PollUntilTrue(5*time.Second, func() bool {
+		return done.Load() == 5
+	}))
+}
+
+func TestNamespaceLimiterOverrides(t *testing.T) {
+	require := require.New(t)
+
+	limiter := NewNamespaceLimiter(ConcurrencyConfig{
+		Enabled:   true,
+		Default:   1,
+		Overrides: []ConcurrencyOverride{{Namespace: "big/repo", Limit: 2}},
+	}, tally.NoopScope)
+
+	small := TaskFixture()
+	small.Tag = "small/repo:a"
+	big := TaskFixture()
+	big.Tag = "big/repo:a"
+
+	require.True(limiter.Acquire(small, 0))
+	require.False(limiter.Acquire(small, 0))
+	require.True(limiter.Acquire(big, 0))
+	require.True(limiter.Acquire(big, 0))
+	require.False(limiter.Acquire(big, 0))
+
+	limiter.Release(small)
+	require.True(limiter.Acquire(small, 0))
+}
+
+func TestNamespaceLimiterLendsIdleSlots(t *testing.T) {
+	require := require.New(t)
+
+	limiter := NewNamespaceLimiter(ConcurrencyConfig{
+		Enabled:     true,
+		Default:     1,
+		IdleReserve: 2,
+	}, tally.NoopScope)
+
+	task := TaskFixture()
+
+	require.True(limiter.Acquire(task, 0))
+	require.False(limiter.Acquire(task, 1))
+	require.True(limiter.Acquire(task, 2))
+	require.Equal(map[string]int{task.Tag[:strings.LastIndex(task.Tag, ":")]: 2}, limiter.InFlight())
+}
+
+func TestNilNamespaceLimiterDoesNotLimit(t *testing.T) {
+	limiter := NewNamespaceLimiter(ConcurrencyConfig{}, tally.NoopScope)
+	require.True(t, limiter.Acquire(TaskFixture(), 0))
+	limiter.Release(TaskFixture())
+	require.Empty(t, limiter.InFlight())
+}
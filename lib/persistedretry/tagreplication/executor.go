@@ -14,11 +14,17 @@
 package tagreplication
 
 import (
+	"bytes"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/uber/kraken/build-index/tagclient"
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/backend"
+	"github.com/uber/kraken/lib/faults"
 	"github.com/uber/kraken/lib/persistedretry"
+	"github.com/uber/kraken/metrics"
 	"github.com/uber/kraken/origin/blobclient"
 
 	"github.com/uber-go/tally"
@@ -29,19 +35,106 @@ type Executor struct {
 	stats             tally.Scope
 	originCluster     blobclient.ClusterClient
 	tagClientProvider tagclient.Provider
+
+	// Preferred digest algorithms of remotes, keyed by remote address.
+	remoteDigestAlgos map[string]string
+
+	// Provides clients of remote origins, if replicated dependencies should be
+	// verified.
+	remoteOrigins blobclient.Provider
+
+	// Whether tags are only committed to remotes once their dependencies are
+	// verified, rather than verified after the fact.
+	ordered bool
+
+	// Backends of mirror destinations, keyed by mirror name.
+	mirrors map[string]*backend.Manager
+
+	// Backends in which origins persist blobs, from which blobs are copied
+	// server-side into mirrors of the same store, if configured.
+	mirrorSource *backend.Manager
+
+	// Injects faults into replication dispatch, for chaos testing.
+	faults *faults.Injector
+
+	// Buckets of the replicate latency histogram. Latencies are timed instead
+	// if empty.
+	buckets []time.Duration
+
+	// Bounds the namespaces which replication cost is tagged with.
+	namespaces *metrics.NamespaceTagger
+}
+
+// ExecutorOption allows overriding Executor defaults.
+type ExecutorOption func(*Executor)
+
+// WithRemoteDigestAlgorithms configures the preferred digest algorithm of
+// remotes, keyed by remote address. Tags replicated to a remote whose preferred
+// algorithm differs from the tag digest carry a translated digest. Remotes which
+// are not configured accept the tag digest as is.
+func WithRemoteDigestAlgorithms(algos map[string]string) ExecutorOption {
+	return func(e *Executor) { e.remoteDigestAlgos = algos }
+}
+
+// WithDependencyVerification configures an Executor to only succeed once every
+// dependency is available on the remote origin cluster, using p to create clients
+// of remote origins. Missing dependencies are replicated again, and the task
+// fails such that it is retried.
+func WithDependencyVerification(p blobclient.Provider) ExecutorOption {
+	return func(e *Executor) { e.remoteOrigins = p }
+}
+
+// WithOrderedCommit configures an Executor to only commit a tag to the remote
+// build-index once every dependency is available on the remote origin cluster,
+// using p to create clients of remote origins. Until then, the tag is staged in
+// its task, and missing dependencies are replicated again and the task retried.
+// Remote tags thus never resolve to blobs which cannot be pulled yet.
+func WithOrderedCommit(p blobclient.Provider) ExecutorOption {
+	return func(e *Executor) {
+		e.remoteOrigins = p
+		e.ordered = true
+	}
+}
+
+// WithFaultInjector configures an Executor to inject faults of f into the
+// dispatch of tasks, named "replication.dispatch" and keyed by destination.
+func WithFaultInjector(f *faults.Injector) ExecutorOption {
+	return func(e *Executor) { e.faults = f }
+}
+
+// WithHistograms configures the Executor to also record replication latencies
+// in a histogram with the buckets of config, if any.
+func WithHistograms(config metrics.HistogramsConfig) ExecutorOption {
+	return func(e *Executor) { e.buckets = config.Replication }
+}
+
+// WithNamespaceTags configures the Executor to tag replication cost with the
+// namespace patterns of t which repositories match. Otherwise, all cost is
+// tagged with metrics.OtherNamespace.
+func WithNamespaceTags(t *metrics.NamespaceTagger) ExecutorOption {
+	return func(e *Executor) { e.namespaces = t }
 }
 
 // NewExecutor creates a new Executor.
 func NewExecutor(
 	stats tally.Scope,
 	originCluster blobclient.ClusterClient,
-	tagClientProvider tagclient.Provider) *Executor {
+	tagClientProvider tagclient.Provider,
+	opts ...ExecutorOption) *Executor {
 
 	stats = stats.Tagged(map[string]string{
 		"module": "tagreplicationexecutor",
 	})
 
-	return &Executor{stats, originCluster, tagClientProvider}
+	e := &Executor{
+		stats:             stats,
+		originCluster:     originCluster,
+		tagClientProvider: tagClientProvider,
+	}
+	for _, opt := range opts {
+		opt(e)
+	}
+	return e
 }
 
 // Name returns the executor name.
@@ -50,16 +143,56 @@ func (e *Executor) Name() string {
 }
 
 // Exec replicates a tag's blob dependencies to the task's remote origin
-// cluster, then replicates the tag to the remote build-index.
+// cluster, then replicates the tag to the remote build-index. If the task's
+// destination is a mirror, the dependencies are copied into the mirror instead.
 func (e *Executor) Exec(r persistedretry.Task) error {
 	t := r.(*Task)
+	if err := e.faults.Fault("replication.dispatch", t.Destination); err != nil {
+		return err
+	}
 	start := time.Now()
+	if name, ok := parseMirrorDestination(t.Destination); ok {
+		if err := e.mirror(t, name); err != nil {
+			return err
+		}
+		e.stats.Timer("mirror").Record(time.Since(start))
+		return nil
+	}
 	remoteTagClient := e.tagClientProvider.Provide(t.Destination)
 
-	if ok, err := remoteTagClient.Has(t.Tag); err == nil && ok {
+	remoteDigest, err := remoteTagClient.Get(t.Tag)
+	remoteHas := err == nil
+
+	var translated *core.Digest
+	if algo, ok := e.remoteDigestAlgos[t.Destination]; ok && algo != t.Digest.Algo() {
+		d, err := e.translate(t.Tag, t.Digest, algo)
+		if err != nil {
+			e.stats.Counter("translate_failures").Inc(1)
+			return fmt.Errorf("translate digest %s to %s: %s", t.Digest, algo, err)
+		}
+		translated = &d
+	}
+
+	expected := t.Digest
+	if translated != nil {
+		expected = *translated
+	}
+	if remoteHas && remoteDigest == expected {
 		// Remote index already has the tag, therefore dependencies have already
-		// been replicated, and the remote has also replicated the tag. No-op.
-		return nil
+		// been replicated, and the remote has also replicated the tag. No-op,
+		// unless a previous attempt is still waiting on dependencies to arrive.
+		if e.remoteOrigins == nil || e.ordered {
+			return nil
+		}
+		remoteOrigin, err := remoteTagClient.Origin()
+		if err != nil {
+			return fmt.Errorf("lookup remote origin cluster: %s", err)
+		}
+		return e.verify(t, remoteOrigin)
+	}
+	if remoteHas {
+		// Remote index holds an older digest of the tag, which t replaces.
+		e.stats.Counter("stale_remote_tags").Inc(1)
 	}
 
 	remoteOrigin, err := remoteTagClient.Origin()
@@ -67,21 +200,130 @@ func (e *Executor) Exec(r persistedretry.Task) error {
 		return fmt.Errorf("lookup remote origin cluster: %s", err)
 	}
 	for _, d := range t.Dependencies {
-		if err := e.originCluster.ReplicateToRemote(t.Tag, d, remoteOrigin); err != nil {
-			return fmt.Errorf("origin cluster replicate: %s", err)
+		if err := e.replicateBlob(t, d, remoteOrigin); err != nil {
+			return err
+		}
+	}
+
+	if e.ordered {
+		// Keep the tag staged in t until the remote origin has every dependency.
+		if err := e.verify(t, remoteOrigin); err != nil {
+			e.stats.Counter("staged_tags").Inc(1)
+			return err
 		}
 	}
 
 	// Put tag and triggers replication on the remote client.
 	// Replication will call Exec n^2 times but some will return early
 	// if remote has the tag already.
-	if err := remoteTagClient.PutAndReplicate(t.Tag, t.Digest); err != nil {
+	// The remote inherits the priority of t, such that it stays ahead of
+	// routine replications at every hop of a cascade.
+	if translated != nil || t.Priority != 0 {
+		opts := tagclient.PutAndReplicateOptions{Translated: translated, Priority: t.Priority}
+		if err := remoteTagClient.PutAndReplicateWithOptions(t.Tag, t.Digest, opts); err != nil {
+			return fmt.Errorf("put and replicate tag: %s", err)
+		}
+	} else if err := remoteTagClient.PutAndReplicate(t.Tag, t.Digest); err != nil {
 		return fmt.Errorf("put and replicate tag: %s", err)
 	}
 
+	if e.remoteOrigins != nil && !e.ordered {
+		if err := e.verify(t, remoteOrigin); err != nil {
+			return err
+		}
+	}
+
 	// We don't want to time noops nor errors.
-	e.stats.Timer("replicate").Record(time.Since(start))
+	elapsed := time.Since(start)
+	e.stats.Timer("replicate").Record(elapsed)
+	if len(e.buckets) > 0 {
+		e.stats.Histogram("replicate_histogram", tally.DurationBuckets(e.buckets)).RecordDuration(elapsed)
+	}
 	e.stats.Timer("lifetime").Record(time.Since(t.CreatedAt))
+	e.remoteStats(t).Counter("replicated_tags").Inc(1)
 
 	return nil
 }
+
+// replicateBlob replicates d to remoteOrigin and accounts the bytes transferred
+// to the remote of t. Blobs which the remote already had are not accounted.
+func (e *Executor) replicateBlob(t *Task, d core.Digest, remoteOrigin string) error {
+	transferred, err := e.originCluster.ReplicateToRemote(t.Tag, d, remoteOrigin)
+	if err != nil {
+		return fmt.Errorf("origin cluster replicate: %s", err)
+	}
+	if !transferred {
+		return nil
+	}
+	// Accounting is best-effort and never fails the replication.
+	info, err := e.originCluster.Stat(t.Tag, d)
+	if err != nil {
+		e.stats.Counter("byte_accounting_failures").Inc(1)
+		return nil
+	}
+	e.remoteStats(t).Counter("replicated_bytes").Inc(info.Size)
+	return nil
+}
+
+// remoteStats returns stats tagged with the remote and namespace pattern of the
+// repository of t, such that replication cost may be broken down per remote and
+// per namespace without tagging every repository.
+func (e *Executor) remoteStats(t *Task) tally.Scope {
+	repo := t.Tag
+	if i := strings.LastIndex(repo, ":"); i >= 0 {
+		repo = repo[:i]
+	}
+	return e.stats.Tagged(map[string]string{
+		"remote":    t.Destination,
+		"namespace": e.namespaces.Tag(repo),
+	})
+}
+
+// verify checks that every dependency of t is available on remoteOrigin.
+// Missing dependencies are replicated again, and an error is returned such that
+// t is retried.
+func (e *Executor) verify(t *Task, remoteOrigin string) error {
+	client := e.remoteOrigins.Provide(remoteOrigin)
+	var missing []core.Digest
+	for _, d := range t.Dependencies {
+		if _, err := client.Stat(t.Tag, d); err == blobclient.ErrBlobNotFound {
+			missing = append(missing, d)
+		} else if err != nil {
+			return fmt.Errorf("stat remote dependency %s: %s", d, err)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	e.stats.Counter("missing_remote_dependencies").Inc(int64(len(missing)))
+	for _, d := range missing {
+		if err := e.replicateBlob(t, d, remoteOrigin); err != nil {
+			return err
+		}
+	}
+	return fmt.Errorf("%d dependencies not yet available on remote origin", len(missing))
+}
+
+// translate re-hashes the blob of d using algo. The blob is downloaded from the
+// local origin cluster and verified against d first, such that the translation
+// is never computed from corrupt content.
+func (e *Executor) translate(namespace string, d core.Digest, algo string) (core.Digest, error) {
+	var b bytes.Buffer
+	if err := e.originCluster.DownloadBlob(namespace, d, &b); err != nil {
+		return core.Digest{}, fmt.Errorf("download blob: %s", err)
+	}
+	verifier, err := core.NewDigesterWithAlgo(d.Algo())
+	if err != nil {
+		return core.Digest{}, fmt.Errorf("source digester: %s", err)
+	}
+	if actual, err := verifier.FromBytes(b.Bytes()); err != nil {
+		return core.Digest{}, fmt.Errorf("verify blob: %s", err)
+	} else if actual != d {
+		return core.Digest{}, fmt.Errorf("verify blob: computed digest %s", actual)
+	}
+	translator, err := core.NewDigesterWithAlgo(algo)
+	if err != nil {
+		return core.Digest{}, fmt.Errorf("remote digester: %s", err)
+	}
+	return translator.FromBytes(b.Bytes())
+}
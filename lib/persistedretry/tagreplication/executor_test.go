@@ -14,10 +14,21 @@
 package tagreplication
 
 import (
+	"errors"
+	"io"
 	"testing"
 
+	"github.com/uber/kraken/build-index/tagclient"
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/backend"
+	"github.com/uber/kraken/lib/backend/backenderrors"
+	"github.com/uber/kraken/lib/faults"
+	"github.com/uber/kraken/metrics"
 	"github.com/uber/kraken/mocks/build-index/tagclient"
+	"github.com/uber/kraken/mocks/lib/backend"
 	"github.com/uber/kraken/mocks/origin/blobclient"
+	"github.com/uber/kraken/origin/blobclient"
+	"github.com/uber/kraken/utils/mockutil"
 
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/require"
@@ -61,22 +72,51 @@ func TestExecutor(t *testing.T) {
 	tagClient := mocks.newTagClient()
 	task := TaskFixture()
 
+	// Replicated bytes are accounted from the local origin cluster.
+	mocks.originCluster.EXPECT().Stat(task.Tag, gomock.Any()).Return(core.NewBlobInfo(1), nil).AnyTimes()
+
 	gomock.InOrder(
 		mocks.tagClientProvider.EXPECT().Provide(task.Destination).Return(tagClient),
-		tagClient.EXPECT().Has(task.Tag).Return(false, nil),
+		tagClient.EXPECT().Get(task.Tag).Return(core.Digest{}, tagclient.ErrTagNotFound),
 		tagClient.EXPECT().Origin().Return(_testRemoteOrigin, nil),
 		mocks.originCluster.EXPECT().ReplicateToRemote(
-			task.Tag, task.Dependencies[0], _testRemoteOrigin).Return(nil),
+			task.Tag, task.Dependencies[0], _testRemoteOrigin).Return(true, nil),
 		mocks.originCluster.EXPECT().ReplicateToRemote(
-			task.Tag, task.Dependencies[1], _testRemoteOrigin).Return(nil),
+			task.Tag, task.Dependencies[1], _testRemoteOrigin).Return(true, nil),
 		mocks.originCluster.EXPECT().ReplicateToRemote(
-			task.Tag, task.Dependencies[2], _testRemoteOrigin).Return(nil),
+			task.Tag, task.Dependencies[2], _testRemoteOrigin).Return(true, nil),
 		tagClient.EXPECT().PutAndReplicate(task.Tag, task.Digest).Return(nil),
 	)
 
 	require.NoError(executor.Exec(task))
 }
 
+func TestExecutorRemoteInheritsPriority(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newExecutorMocks(t)
+	defer cleanup()
+
+	executor := mocks.new()
+	tagClient := mocks.newTagClient()
+	task := TaskFixture()
+	task.Priority = PriorityHigh
+
+	mocks.originCluster.EXPECT().Stat(task.Tag, gomock.Any()).Return(core.NewBlobInfo(1), nil).AnyTimes()
+	mocks.originCluster.EXPECT().ReplicateToRemote(
+		task.Tag, gomock.Any(), _testRemoteOrigin).Return(true, nil).Times(len(task.Dependencies))
+
+	gomock.InOrder(
+		mocks.tagClientProvider.EXPECT().Provide(task.Destination).Return(tagClient),
+		tagClient.EXPECT().Get(task.Tag).Return(core.Digest{}, tagclient.ErrTagNotFound),
+		tagClient.EXPECT().Origin().Return(_testRemoteOrigin, nil),
+		tagClient.EXPECT().PutAndReplicateWithOptions(
+			task.Tag, task.Digest, tagclient.PutAndReplicateOptions{Priority: PriorityHigh}).Return(nil),
+	)
+
+	require.NoError(executor.Exec(task))
+}
+
 func TestExecutorNoopsWhenTagAlreadyReplicated(t *testing.T) {
 	require := require.New(t)
 
@@ -89,7 +129,478 @@ func TestExecutorNoopsWhenTagAlreadyReplicated(t *testing.T) {
 
 	gomock.InOrder(
 		mocks.tagClientProvider.EXPECT().Provide(task.Destination).Return(tagClient),
-		tagClient.EXPECT().Has(task.Tag).Return(true, nil),
+		tagClient.EXPECT().Get(task.Tag).Return(task.Digest, nil),
+	)
+
+	require.NoError(executor.Exec(task))
+}
+
+func TestExecutorReplicatesTagWhenRemoteHasOlderDigest(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newExecutorMocks(t)
+	defer cleanup()
+
+	executor := mocks.new()
+	tagClient := mocks.newTagClient()
+	task := TaskFixture()
+
+	mocks.originCluster.EXPECT().Stat(task.Tag, gomock.Any()).Return(core.NewBlobInfo(1), nil).AnyTimes()
+
+	gomock.InOrder(
+		mocks.tagClientProvider.EXPECT().Provide(task.Destination).Return(tagClient),
+		tagClient.EXPECT().Get(task.Tag).Return(core.DigestFixture(), nil),
+		tagClient.EXPECT().Origin().Return(_testRemoteOrigin, nil),
+		mocks.originCluster.EXPECT().ReplicateToRemote(
+			task.Tag, task.Dependencies[0], _testRemoteOrigin).Return(true, nil),
+		mocks.originCluster.EXPECT().ReplicateToRemote(
+			task.Tag, task.Dependencies[1], _testRemoteOrigin).Return(true, nil),
+		mocks.originCluster.EXPECT().ReplicateToRemote(
+			task.Tag, task.Dependencies[2], _testRemoteOrigin).Return(true, nil),
+		tagClient.EXPECT().PutAndReplicate(task.Tag, task.Digest).Return(nil),
+	)
+
+	require.NoError(executor.Exec(task))
+}
+
+func TestExecutorTranslatesDigestForRemotePreferringOtherAlgo(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newExecutorMocks(t)
+	defer cleanup()
+
+	blob := core.NewBlobFixture()
+	task := TaskFixture()
+	task.Digest = blob.Digest
+
+	digester, err := core.NewDigesterWithAlgo(core.SHA512)
+	require.NoError(err)
+	translated, err := digester.FromBytes(blob.Content)
+	require.NoError(err)
+
+	executor := NewExecutor(
+		tally.NoopScope, mocks.originCluster, mocks.tagClientProvider,
+		WithRemoteDigestAlgorithms(map[string]string{task.Destination: core.SHA512}))
+	tagClient := mocks.newTagClient()
+
+	// Replicated bytes are accounted from the local origin cluster.
+	mocks.originCluster.EXPECT().Stat(task.Tag, gomock.Any()).Return(core.NewBlobInfo(1), nil).AnyTimes()
+
+	gomock.InOrder(
+		mocks.tagClientProvider.EXPECT().Provide(task.Destination).Return(tagClient),
+		tagClient.EXPECT().Get(task.Tag).Return(core.Digest{}, tagclient.ErrTagNotFound),
+		mocks.originCluster.EXPECT().DownloadBlob(task.Tag, task.Digest, gomock.Any()).DoAndReturn(
+			func(namespace string, d core.Digest, dst io.Writer) error {
+				_, err := dst.Write(blob.Content)
+				return err
+			}),
+		tagClient.EXPECT().Origin().Return(_testRemoteOrigin, nil),
+		mocks.originCluster.EXPECT().ReplicateToRemote(
+			task.Tag, task.Dependencies[0], _testRemoteOrigin).Return(true, nil),
+		mocks.originCluster.EXPECT().ReplicateToRemote(
+			task.Tag, task.Dependencies[1], _testRemoteOrigin).Return(true, nil),
+		mocks.originCluster.EXPECT().ReplicateToRemote(
+			task.Tag, task.Dependencies[2], _testRemoteOrigin).Return(true, nil),
+		tagClient.EXPECT().PutAndReplicateWithOptions(
+			task.Tag, task.Digest, tagclient.PutAndReplicateOptions{Translated: &translated}).Return(nil),
+	)
+
+	require.NoError(executor.Exec(task))
+}
+
+func TestExecutorFailsWhenDigestCannotBeTranslated(t *testing.T) {
+	tests := []struct {
+		desc     string
+		download func(namespace string, d core.Digest, dst io.Writer) error
+	}{
+		{
+			"blob unavailable",
+			func(string, core.Digest, io.Writer) error { return errors.New("some error") },
+		}, {
+			"blob does not match digest",
+			func(namespace string, d core.Digest, dst io.Writer) error {
+				_, err := dst.Write([]byte("corrupt"))
+				return err
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			require := require.New(t)
+
+			mocks, cleanup := newExecutorMocks(t)
+			defer cleanup()
+
+			task := TaskFixture()
+
+			executor := NewExecutor(
+				tally.NoopScope, mocks.originCluster, mocks.tagClientProvider,
+				WithRemoteDigestAlgorithms(map[string]string{task.Destination: core.SHA512}))
+			tagClient := mocks.newTagClient()
+
+			gomock.InOrder(
+				mocks.tagClientProvider.EXPECT().Provide(task.Destination).Return(tagClient),
+				tagClient.EXPECT().Get(task.Tag).Return(core.Digest{}, tagclient.ErrTagNotFound),
+				mocks.originCluster.EXPECT().DownloadBlob(
+					task.Tag, task.Digest, gomock.Any()).DoAndReturn(test.download),
+			)
+
+			err := executor.Exec(task)
+			require.Error(err)
+			require.Contains(err.Error(), "translate digest")
+		})
+	}
+}
+
+func TestExecutorWaitsForMissingDependencyOnRemoteOrigin(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newExecutorMocks(t)
+	defer cleanup()
+
+	remoteOrigins := mockblobclient.NewMockProvider(mocks.ctrl)
+	remoteOrigin := mockblobclient.NewMockClient(mocks.ctrl)
+
+	executor := NewExecutor(
+		tally.NoopScope, mocks.originCluster, mocks.tagClientProvider,
+		WithDependencyVerification(remoteOrigins))
+	tagClient := mocks.newTagClient()
+	task := TaskFixture()
+	deps := task.Dependencies
+
+	remoteOrigins.EXPECT().Provide(_testRemoteOrigin).Return(remoteOrigin).AnyTimes()
+	mocks.tagClientProvider.EXPECT().Provide(task.Destination).Return(tagClient).AnyTimes()
+	tagClient.EXPECT().Origin().Return(_testRemoteOrigin, nil).AnyTimes()
+
+	// Replicated bytes are accounted from the local origin cluster.
+	mocks.originCluster.EXPECT().Stat(task.Tag, gomock.Any()).Return(core.NewBlobInfo(1), nil).AnyTimes()
+
+	// The last dependency has not arrived on the remote origin after the tag is
+	// stored, so it is replicated again and the task fails.
+	gomock.InOrder(
+		tagClient.EXPECT().Get(task.Tag).Return(core.Digest{}, tagclient.ErrTagNotFound),
+		mocks.originCluster.EXPECT().ReplicateToRemote(task.Tag, deps[0], _testRemoteOrigin).Return(true, nil),
+		mocks.originCluster.EXPECT().ReplicateToRemote(task.Tag, deps[1], _testRemoteOrigin).Return(true, nil),
+		mocks.originCluster.EXPECT().ReplicateToRemote(task.Tag, deps[2], _testRemoteOrigin).Return(true, nil),
+		tagClient.EXPECT().PutAndReplicate(task.Tag, task.Digest).Return(nil),
+		remoteOrigin.EXPECT().Stat(task.Tag, deps[0]).Return(core.NewBlobInfo(1), nil),
+		remoteOrigin.EXPECT().Stat(task.Tag, deps[1]).Return(core.NewBlobInfo(1), nil),
+		remoteOrigin.EXPECT().Stat(task.Tag, deps[2]).Return(nil, blobclient.ErrBlobNotFound),
+		mocks.originCluster.EXPECT().ReplicateToRemote(task.Tag, deps[2], _testRemoteOrigin).Return(true, nil),
+	)
+
+	require.Error(executor.Exec(task))
+
+	// Once the dependency appears, the retried task succeeds even though the
+	// remote already has the tag.
+	gomock.InOrder(
+		tagClient.EXPECT().Get(task.Tag).Return(task.Digest, nil),
+		remoteOrigin.EXPECT().Stat(task.Tag, deps[0]).Return(core.NewBlobInfo(1), nil),
+		remoteOrigin.EXPECT().Stat(task.Tag, deps[1]).Return(core.NewBlobInfo(1), nil),
+		remoteOrigin.EXPECT().Stat(task.Tag, deps[2]).Return(core.NewBlobInfo(1), nil),
+	)
+
+	require.NoError(executor.Exec(task))
+}
+
+func TestExecutorOrderedCommitStagesTagUntilDependenciesArePresent(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newExecutorMocks(t)
+	defer cleanup()
+
+	remoteOrigins := mockblobclient.NewMockProvider(mocks.ctrl)
+	remoteOrigin := mockblobclient.NewMockClient(mocks.ctrl)
+
+	executor := NewExecutor(
+		tally.NoopScope, mocks.originCluster, mocks.tagClientProvider,
+		WithOrderedCommit(remoteOrigins))
+	tagClient := mocks.newTagClient()
+	task := TaskFixture()
+	deps := task.Dependencies
+
+	remoteOrigins.EXPECT().Provide(_testRemoteOrigin).Return(remoteOrigin).AnyTimes()
+	mocks.tagClientProvider.EXPECT().Provide(task.Destination).Return(tagClient).AnyTimes()
+	tagClient.EXPECT().Origin().Return(_testRemoteOrigin, nil).AnyTimes()
+	mocks.originCluster.EXPECT().Stat(task.Tag, gomock.Any()).Return(core.NewBlobInfo(1), nil).AnyTimes()
+
+	// The last dependency has not arrived on the remote origin, so the tag is
+	// not put to the remote, and hence not readable there.
+	gomock.InOrder(
+		tagClient.EXPECT().Get(task.Tag).Return(core.Digest{}, tagclient.ErrTagNotFound),
+		mocks.originCluster.EXPECT().ReplicateToRemote(task.Tag, deps[0], _testRemoteOrigin).Return(true, nil),
+		mocks.originCluster.EXPECT().ReplicateToRemote(task.Tag, deps[1], _testRemoteOrigin).Return(true, nil),
+		mocks.originCluster.EXPECT().ReplicateToRemote(task.Tag, deps[2], _testRemoteOrigin).Return(true, nil),
+		remoteOrigin.EXPECT().Stat(task.Tag, deps[0]).Return(core.NewBlobInfo(1), nil),
+		remoteOrigin.EXPECT().Stat(task.Tag, deps[1]).Return(core.NewBlobInfo(1), nil),
+		remoteOrigin.EXPECT().Stat(task.Tag, deps[2]).Return(nil, blobclient.ErrBlobNotFound),
+		mocks.originCluster.EXPECT().ReplicateToRemote(task.Tag, deps[2], _testRemoteOrigin).Return(true, nil),
+	)
+
+	require.Error(executor.Exec(task))
+
+	// Once every dependency is confirmed present, the tag is committed.
+	gomock.InOrder(
+		tagClient.EXPECT().Get(task.Tag).Return(core.Digest{}, tagclient.ErrTagNotFound),
+		mocks.originCluster.EXPECT().ReplicateToRemote(task.Tag, deps[0], _testRemoteOrigin).Return(true, nil),
+		mocks.originCluster.EXPECT().ReplicateToRemote(task.Tag, deps[1], _testRemoteOrigin).Return(true, nil),
+		mocks.originCluster.EXPECT().ReplicateToRemote(task.Tag, deps[2], _testRemoteOrigin).Return(true, nil),
+		remoteOrigin.EXPECT().Stat(task.Tag, deps[0]).Return(core.NewBlobInfo(1), nil),
+		remoteOrigin.EXPECT().Stat(task.Tag, deps[1]).Return(core.NewBlobInfo(1), nil),
+		remoteOrigin.EXPECT().Stat(task.Tag, deps[2]).Return(core.NewBlobInfo(1), nil),
+		tagClient.EXPECT().PutAndReplicate(task.Tag, task.Digest).Return(nil),
+	)
+
+	require.NoError(executor.Exec(task))
+
+	// Committed tags are not verified again.
+	tagClient.EXPECT().Get(task.Tag).Return(task.Digest, nil)
+
+	require.NoError(executor.Exec(task))
+}
+
+func TestExecutorAccountsReplicatedBytesPerRemote(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newExecutorMocks(t)
+	defer cleanup()
+
+	namespaces, err := metrics.NamespacesConfig{Patterns: []string{"namespace-foo/.*"}}.Build()
+	require.NoError(err)
+
+	stats := tally.NewTestScope("", nil)
+	executor := NewExecutor(
+		stats, mocks.originCluster, mocks.tagClientProvider, WithNamespaceTags(namespaces))
+	tagClient := mocks.newTagClient()
+	task := TaskFixture()
+
+	mocks.tagClientProvider.EXPECT().Provide(task.Destination).Return(tagClient)
+	tagClient.EXPECT().Get(task.Tag).Return(core.Digest{}, tagclient.ErrTagNotFound)
+	tagClient.EXPECT().Origin().Return(_testRemoteOrigin, nil)
+	for i, d := range task.Dependencies {
+		mocks.originCluster.EXPECT().ReplicateToRemote(task.Tag, d, _testRemoteOrigin).Return(true, nil)
+		mocks.originCluster.EXPECT().Stat(task.Tag, d).Return(core.NewBlobInfo(int64(100*(i+1))), nil)
+	}
+	tagClient.EXPECT().PutAndReplicate(task.Tag, task.Digest).Return(nil)
+
+	require.NoError(executor.Exec(task))
+
+	counts := make(map[string]int64)
+	for _, c := range stats.Snapshot().Counters() {
+		require.Equal(task.Destination, c.Tags()["remote"])
+		require.Equal("namespace-foo/.*", c.Tags()["namespace"])
+		counts[c.Name()] = c.Value()
+	}
+	require.Equal(map[string]int64{
+		"replicated_bytes": 600,
+		"replicated_tags":  1,
+	}, counts)
+}
+
+func TestExecutorSkipsBytesOfBlobsWhichRemoteHad(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newExecutorMocks(t)
+	defer cleanup()
+
+	stats := tally.NewTestScope("", nil)
+	executor := NewExecutor(stats, mocks.originCluster, mocks.tagClientProvider)
+	tagClient := mocks.newTagClient()
+	task := TaskFixture()
+
+	mocks.tagClientProvider.EXPECT().Provide(task.Destination).Return(tagClient)
+	tagClient.EXPECT().Get(task.Tag).Return(core.Digest{}, tagclient.ErrTagNotFound)
+	tagClient.EXPECT().Origin().Return(_testRemoteOrigin, nil)
+	for _, d := range task.Dependencies {
+		mocks.originCluster.EXPECT().ReplicateToRemote(task.Tag, d, _testRemoteOrigin).Return(false, nil)
+	}
+	tagClient.EXPECT().PutAndReplicate(task.Tag, task.Digest).Return(nil)
+
+	require.NoError(executor.Exec(task))
+
+	counts := make(map[string]int64)
+	for _, c := range stats.Snapshot().Counters() {
+		require.Equal(metrics.OtherNamespace, c.Tags()["namespace"])
+		counts[c.Name()] = c.Value()
+	}
+	require.Equal(map[string]int64{"replicated_tags": 1}, counts)
+}
+
+func TestExecutorCopiesDependenciesIntoMirror(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newExecutorMocks(t)
+	defer cleanup()
+
+	mirrorClient := mockbackend.NewMockClient(mocks.ctrl)
+	mirror := backend.ManagerFixture()
+	require.NoError(mirror.Register(".*", mirrorClient))
+
+	executor := NewExecutor(
+		tally.NoopScope, mocks.originCluster, mocks.tagClientProvider,
+		WithMirrors(map[string]*backend.Manager{"dr": mirror}))
+
+	existing := core.NewBlobFixture()
+	missing := core.NewBlobFixture()
+	task := TaskFixture()
+	task.Destination = MirrorDestination("dr")
+	task.Dependencies = core.DigestList{existing.Digest, missing.Digest}
+
+	gomock.InOrder(
+		mirrorClient.EXPECT().Stat(task.Tag, existing.Digest.Hex()).Return(core.NewBlobInfo(1), nil),
+		mirrorClient.EXPECT().Stat(task.Tag, missing.Digest.Hex()).Return(nil, backenderrors.ErrBlobNotFound),
+		mocks.originCluster.EXPECT().DownloadBlob(task.Tag, missing.Digest, gomock.Any()).DoAndReturn(
+			func(namespace string, d core.Digest, dst io.Writer) error {
+				_, err := dst.Write(missing.Content)
+				return err
+			}),
+		mirrorClient.EXPECT().Upload(
+			task.Tag, missing.Digest.Hex(), mockutil.MatchReader(missing.Content)).Return(nil),
+	)
+
+	require.NoError(executor.Exec(task))
+}
+
+func TestExecutorCopiesServerSideIntoMirrorOfSameStore(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newExecutorMocks(t)
+	defer cleanup()
+
+	mirrorClient := mockbackend.NewMockCopyClient(mocks.ctrl)
+	mirror := backend.ManagerFixture()
+	require.NoError(mirror.Register(".*", mirrorClient))
+
+	sourceClient := mockbackend.NewMockClient(mocks.ctrl)
+	source := backend.ManagerFixture()
+	require.NoError(source.Register(".*", sourceClient))
+
+	stats := tally.NewTestScope("", nil)
+
+	executor := NewExecutor(
+		stats, mocks.originCluster, mocks.tagClientProvider,
+		WithMirrors(map[string]*backend.Manager{"dr": mirror}),
+		WithMirrorSource(source))
+
+	blob := core.NewBlobFixture()
+	task := TaskFixture()
+	task.Destination = MirrorDestination("dr")
+	task.Dependencies = core.DigestList{blob.Digest}
+
+	gomock.InOrder(
+		mirrorClient.EXPECT().Stat(task.Tag, blob.Digest.Hex()).Return(nil, backenderrors.ErrBlobNotFound),
+		mirrorClient.EXPECT().Capabilities().Return(backend.BackendCapabilities{ServerSideCopy: true}),
+		mirrorClient.EXPECT().CanCopyFrom(sourceClient).Return(true),
+		mirrorClient.EXPECT().CopyFrom(sourceClient, task.Tag, blob.Digest.Hex()).Return(nil),
+	)
+
+	require.NoError(executor.Exec(task))
+
+	counts := make(map[string]int64)
+	for _, c := range stats.Snapshot().Counters() {
+		counts[c.Name()] = c.Value()
+	}
+	require.Equal(int64(1), counts["server_side_copies"])
+}
+
+func TestExecutorStreamsIntoMirrorOfOtherStore(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newExecutorMocks(t)
+	defer cleanup()
+
+	mirrorClient := mockbackend.NewMockCopyClient(mocks.ctrl)
+	mirror := backend.ManagerFixture()
+	require.NoError(mirror.Register(".*", mirrorClient))
+
+	sourceClient := mockbackend.NewMockClient(mocks.ctrl)
+	source := backend.ManagerFixture()
+	require.NoError(source.Register(".*", sourceClient))
+
+	executor := NewExecutor(
+		tally.NoopScope, mocks.originCluster, mocks.tagClientProvider,
+		WithMirrors(map[string]*backend.Manager{"dr": mirror}),
+		WithMirrorSource(source))
+
+	blob := core.NewBlobFixture()
+	task := TaskFixture()
+	task.Destination = MirrorDestination("dr")
+	task.Dependencies = core.DigestList{blob.Digest}
+
+	gomock.InOrder(
+		mirrorClient.EXPECT().Stat(task.Tag, blob.Digest.Hex()).Return(nil, backenderrors.ErrBlobNotFound),
+		mirrorClient.EXPECT().Capabilities().Return(backend.BackendCapabilities{ServerSideCopy: true}),
+		mirrorClient.EXPECT().CanCopyFrom(sourceClient).Return(false),
+		mocks.originCluster.EXPECT().DownloadBlob(task.Tag, blob.Digest, gomock.Any()).DoAndReturn(
+			func(namespace string, d core.Digest, dst io.Writer) error {
+				_, err := dst.Write(blob.Content)
+				return err
+			}),
+		mirrorClient.EXPECT().Upload(
+			task.Tag, blob.Digest.Hex(), mockutil.MatchReader(blob.Content)).Return(nil),
+	)
+
+	require.NoError(executor.Exec(task))
+}
+
+func TestExecutorRejectsCorruptBlobForMirror(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newExecutorMocks(t)
+	defer cleanup()
+
+	mirrorClient := mockbackend.NewMockClient(mocks.ctrl)
+	mirror := backend.ManagerFixture()
+	require.NoError(mirror.Register(".*", mirrorClient))
+
+	executor := NewExecutor(
+		tally.NoopScope, mocks.originCluster, mocks.tagClientProvider,
+		WithMirrors(map[string]*backend.Manager{"dr": mirror}))
+
+	blob := core.NewBlobFixture()
+	task := TaskFixture()
+	task.Destination = MirrorDestination("dr")
+	task.Dependencies = core.DigestList{blob.Digest}
+
+	mirrorClient.EXPECT().Stat(task.Tag, blob.Digest.Hex()).Return(nil, backenderrors.ErrBlobNotFound)
+	mocks.originCluster.EXPECT().DownloadBlob(task.Tag, blob.Digest, gomock.Any()).DoAndReturn(
+		func(namespace string, d core.Digest, dst io.Writer) error {
+			_, err := dst.Write([]byte("corrupt"))
+			return err
+		})
+
+	require.Error(executor.Exec(task))
+}
+
+func TestExecutorFailsDispatchOnInjectedFault(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newExecutorMocks(t)
+	defer cleanup()
+
+	task := TaskFixture()
+
+	f, err := faults.New(faults.Config{
+		Enabled: true,
+		Rules: []faults.Rule{{
+			Target: "replication.dispatch",
+			Key:    task.Destination,
+			Action: faults.ActionFail,
+			Limit:  1,
+		}},
+	}, tally.NoopScope)
+	require.NoError(err)
+
+	executor := NewExecutor(
+		tally.NoopScope, mocks.originCluster, mocks.tagClientProvider, WithFaultInjector(f))
+	tagClient := mocks.newTagClient()
+
+	// The injected fault fails the first attempt before anything is dispatched.
+	require.True(faults.IsFault(executor.Exec(task)))
+
+	gomock.InOrder(
+		mocks.tagClientProvider.EXPECT().Provide(task.Destination).Return(tagClient),
+		tagClient.EXPECT().Get(task.Tag).Return(task.Digest, nil),
 	)
 
 	require.NoError(executor.Exec(task))
@@ -0,0 +1,211 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package tagreplication
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/backend"
+	"github.com/uber/kraken/lib/backend/backenderrors"
+	"github.com/uber/kraken/utils/log"
+
+	"github.com/uber-go/tally"
+)
+
+// _mirrorPrefix distinguishes mirror destinations from remote build-indexes.
+const _mirrorPrefix = "mirror:"
+
+// MirrorDestination returns the task destination of the mirror name.
+func MirrorDestination(name string) string {
+	return _mirrorPrefix + name
+}
+
+// IsMirrorDestination returns true if dest is the task destination of a mirror.
+func IsMirrorDestination(dest string) bool {
+	_, ok := parseMirrorDestination(dest)
+	return ok
+}
+
+// parseMirrorDestination returns the mirror name of dest, if dest is a mirror.
+func parseMirrorDestination(dest string) (string, bool) {
+	if !strings.HasPrefix(dest, _mirrorPrefix) {
+		return "", false
+	}
+	return strings.TrimPrefix(dest, _mirrorPrefix), true
+}
+
+// MirrorConfig defines an object-store mirror, into which the dependency blobs
+// of matching tags are copied. Tags are matched like those of remotes. Backend
+// is the storage backend of the mirror, for which Namespace defaults to all.
+type MirrorConfig struct {
+	Namespaces  []string       `yaml:"namespaces"`
+	IncludeTags []string       `yaml:"include_tags"`
+	ExcludeTags []string       `yaml:"exclude_tags"`
+	Backend     backend.Config `yaml:"backend"`
+}
+
+// MirrorsConfig defines object-store mirrors keyed by name.
+//
+// For example, given the configuration:
+//
+//   gcs-dr:
+//     namespaces:
+//     - namespace_foo/.*
+//     backend:
+//       backend:
+//         gcs: <omitted>
+//
+// The blobs of any builds matching the namespace_foo/.* namespace are copied
+// into the gcs-dr bucket.
+type MirrorsConfig map[string]MirrorConfig
+
+// Build builds configuration into Remotes whose addresses are mirror
+// destinations, such that mirrored tags are matched alongside remotes.
+func (c MirrorsConfig) Build() (Remotes, error) {
+	rc := make(RemotesConfig, len(c))
+	for name, mc := range c {
+		rc[MirrorDestination(name)] = RemoteConfig{
+			Namespaces:  mc.Namespaces,
+			IncludeTags: mc.IncludeTags,
+			ExcludeTags: mc.ExcludeTags,
+		}
+	}
+	return rc.Build()
+}
+
+// Backends creates the backend clients of all mirrors, keyed by name.
+func (c MirrorsConfig) Backends(
+	auth backend.AuthConfig, stats tally.Scope) (map[string]*backend.Manager, error) {
+
+	mirrors := make(map[string]*backend.Manager, len(c))
+	for name, mc := range c {
+		config := mc.Backend
+		if config.Namespace == "" {
+			config.Namespace = ".*"
+		}
+		m, err := backend.NewManager([]backend.Config{config}, auth, stats)
+		if err != nil {
+			return nil, fmt.Errorf("mirror %s: %s", name, err)
+		}
+		mirrors[name] = m
+	}
+	return mirrors, nil
+}
+
+// WithMirrors configures the backends of mirror destinations, keyed by mirror
+// name.
+func WithMirrors(mirrors map[string]*backend.Manager) ExecutorOption {
+	return func(e *Executor) { e.mirrors = mirrors }
+}
+
+// WithMirrorSource configures the backends in which origins persist blobs.
+// Dependencies are copied server-side from source into mirrors which belong to
+// the same store, instead of being streamed through the build-index.
+func WithMirrorSource(source *backend.Manager) ExecutorOption {
+	return func(e *Executor) { e.mirrorSource = source }
+}
+
+// mirror copies the dependencies of t into the backend of the mirror name.
+// Blobs are verified against their digest before being uploaded, such that
+// corrupt content never reaches the mirror.
+func (e *Executor) mirror(t *Task, name string) error {
+	m, ok := e.mirrors[name]
+	if !ok {
+		return fmt.Errorf("mirror %s not configured", name)
+	}
+	client, err := m.GetClient(t.Tag)
+	if err != nil {
+		return fmt.Errorf("mirror %s backend: %s", name, err)
+	}
+	for _, d := range t.Dependencies {
+		if _, err := client.Stat(t.Tag, d.Hex()); err == nil {
+			continue
+		} else if err != backenderrors.ErrBlobNotFound {
+			return fmt.Errorf("stat mirrored blob %s: %s", d, err)
+		}
+		if e.copyServerSide(client, t.Tag, d) {
+			e.stats.Counter("mirrored_blobs").Inc(1)
+			e.stats.Counter("server_side_copies").Inc(1)
+			continue
+		}
+		if err := e.copyToMirror(client, t.Tag, d); err != nil {
+			return fmt.Errorf("mirror blob %s: %s", d, err)
+		}
+		e.stats.Counter("mirrored_blobs").Inc(1)
+	}
+	return nil
+}
+
+// copyServerSide attempts to copy d into client natively from the mirror
+// source, returning false if the caller must stream the blob instead. Blobs in
+// the source were verified by origins before being persisted.
+func (e *Executor) copyServerSide(client backend.Client, namespace string, d core.Digest) bool {
+	if e.mirrorSource == nil || !client.Capabilities().ServerSideCopy {
+		return false
+	}
+	cc, ok := client.(backend.CopyClient)
+	if !ok {
+		return false
+	}
+	src, err := e.mirrorSource.GetClient(namespace)
+	if err != nil || !cc.CanCopyFrom(src) {
+		return false
+	}
+	if err := cc.CopyFrom(src, namespace, d.Hex()); err != nil {
+		if err != backenderrors.ErrBlobNotFound {
+			log.With("namespace", namespace, "digest", d).Errorf(
+				"Error copying blob server-side, falling back to streaming: %s", err)
+			e.stats.Counter("server_side_copy_failures").Inc(1)
+		}
+		return false
+	}
+	return true
+}
+
+func (e *Executor) copyToMirror(client backend.Client, namespace string, d core.Digest) error {
+	f, err := ioutil.TempFile("", "kraken-mirror-")
+	if err != nil {
+		return fmt.Errorf("create temp file: %s", err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	if err := e.originCluster.DownloadBlob(namespace, d, f); err != nil {
+		return fmt.Errorf("download blob: %s", err)
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("seek: %s", err)
+	}
+	digester, err := core.NewDigesterWithAlgo(d.Algo())
+	if err != nil {
+		return fmt.Errorf("digester: %s", err)
+	}
+	if actual, err := digester.FromReader(f); err != nil {
+		return fmt.Errorf("verify blob: %s", err)
+	} else if actual != d {
+		return fmt.Errorf("verify blob: computed digest %s", actual)
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("seek: %s", err)
+	}
+	if err := client.Upload(namespace, d.Hex(), f); err != nil {
+		return fmt.Errorf("upload: %s", err)
+	}
+	return nil
+}
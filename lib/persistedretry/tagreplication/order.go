@@ -0,0 +1,67 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package tagreplication
+
+import (
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/uber/kraken/lib/persistedretry"
+	"github.com/uber/kraken/utils/log"
+)
+
+// OrderGate implements persistedretry.Pauser by holding back tasks until the
+// replications listed in their After have completed, i.e. were removed from
+// the store after succeeding or being dropped.
+type OrderGate struct {
+	store *Store
+}
+
+// NewOrderGate returns a new OrderGate for the tasks of store.
+func NewOrderGate(store *Store) *OrderGate {
+	return &OrderGate{store}
+}
+
+// Paused implements persistedretry.Pauser. Tasks are dispatched if the store
+// cannot be queried, since holding them back indefinitely is worse than
+// replicating out of order.
+func (g *OrderGate) Paused(t persistedretry.Task) bool {
+	task, ok := t.(*Task)
+	if !ok || len(task.After) == 0 {
+		return false
+	}
+	held, err := g.store.hasTasks(task.After, task.Destination)
+	if err != nil {
+		log.With("task", task).Errorf("Error checking replication order: %s", err)
+		return false
+	}
+	return held
+}
+
+// hasTasks returns true if a replication of any of tags to destination is
+// stored.
+func (s *Store) hasTasks(tags []string, destination string) (bool, error) {
+	query, args, err := sqlx.In(`
+		SELECT COUNT(*) FROM replicate_tag_task
+		WHERE destination=? AND tag IN (?)`, destination, tags)
+	if err != nil {
+		return false, fmt.Errorf("build query: %s", err)
+	}
+	var n int
+	if err := s.db.Get(&n, s.db.Rebind(query), args...); err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
@@ -0,0 +1,58 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package tagreplication_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	. "github.com/uber/kraken/lib/persistedretry/tagreplication"
+)
+
+func TestOrderGateHoldsBackTasksUntilPriorTasksComplete(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newStoreMocks(t)
+	defer cleanup()
+
+	store := mocks.new()
+	gate := NewOrderGate(store)
+
+	base := TaskFixture()
+	dependent := TaskFixture()
+	dependent.Destination = base.Destination
+	dependent.After = TagList{base.Tag}
+	other := TaskFixture()
+	other.After = TagList{base.Tag}
+
+	require.NoError(store.AddPending(base))
+	require.NoError(store.AddPending(dependent))
+
+	pending, err := store.GetPending()
+	require.NoError(err)
+	require.Len(pending, 2)
+	for _, p := range pending {
+		checkTask(t, map[string]*Task{base.Tag: base, dependent.Tag: dependent}[p.(*Task).Tag], p)
+	}
+
+	require.False(gate.Paused(base))
+	require.True(gate.Paused(dependent))
+
+	// Only replications to the same destination are ordered.
+	require.False(gate.Paused(other))
+
+	require.NoError(store.Remove(base))
+	require.False(gate.Paused(dependent))
+}
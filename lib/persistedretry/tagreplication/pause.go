@@ -0,0 +1,114 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package tagreplication
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/uber/kraken/lib/persistedretry"
+)
+
+// PausedRemotes tracks remotes to which replication is paused, e.g. during a
+// maintenance window of the remote cluster. Paused remotes are persisted, such
+// that pauses survive restarts, and tasks for paused remotes are left in the
+// store rather than attempted and failed.
+type PausedRemotes struct {
+	db *sqlx.DB
+
+	mu      sync.RWMutex
+	remotes map[string]bool
+
+	resumed chan struct{}
+}
+
+// NewPausedRemotes returns a PausedRemotes with the remotes persisted in db
+// paused.
+func NewPausedRemotes(db *sqlx.DB) (*PausedRemotes, error) {
+	var remotes []string
+	if err := db.Select(&remotes, `SELECT remote FROM paused_remote`); err != nil {
+		return nil, fmt.Errorf("select paused remotes: %s", err)
+	}
+	p := &PausedRemotes{
+		db:      db,
+		remotes: make(map[string]bool),
+		resumed: make(chan struct{}, 1),
+	}
+	for _, r := range remotes {
+		p.remotes[r] = true
+	}
+	return p, nil
+}
+
+// PauseRemote stops dispatch of replication tasks to remote.
+func (p *PausedRemotes) PauseRemote(remote string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if _, err := p.db.Exec(
+		`INSERT OR IGNORE INTO paused_remote (remote) VALUES (?)`, remote); err != nil {
+		return err
+	}
+	p.remotes[remote] = true
+	return nil
+}
+
+// ResumeRemote resumes dispatch of replication tasks to remote.
+func (p *PausedRemotes) ResumeRemote(remote string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if _, err := p.db.Exec(`DELETE FROM paused_remote WHERE remote=?`, remote); err != nil {
+		return err
+	}
+	delete(p.remotes, remote)
+	select {
+	case p.resumed <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// List returns all paused remotes in sorted order.
+func (p *PausedRemotes) List() []string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	remotes := []string{}
+	for r := range p.remotes {
+		remotes = append(remotes, r)
+	}
+	sort.Strings(remotes)
+	return remotes
+}
+
+// Paused implements persistedretry.Pauser.
+func (p *PausedRemotes) Paused(t persistedretry.Task) bool {
+	task, ok := t.(*Task)
+	if !ok {
+		return false
+	}
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	return p.remotes[task.Destination]
+}
+
+// Resumed implements persistedretry.ResumeNotifier.
+func (p *PausedRemotes) Resumed() <-chan struct{} {
+	return p.resumed
+}
@@ -16,6 +16,8 @@ package tagreplication
 import (
 	"fmt"
 	"regexp"
+
+	"github.com/uber/kraken/utils/log"
 )
 
 // RemoteValidator validates remotes.
@@ -25,19 +27,45 @@ type RemoteValidator interface {
 
 // Remote represents a remote build-index.
 type Remote struct {
-	regexp *regexp.Regexp
-	addr   string
+	regexp  *regexp.Regexp
+	addr    string
+	include []*regexp.Regexp
+	exclude []*regexp.Regexp
+}
+
+// accepts returns true if tag passes the include / exclude tag filters of r.
+func (r *Remote) accepts(tag string) bool {
+	for _, re := range r.exclude {
+		if re.MatchString(tag) {
+			return false
+		}
+	}
+	if len(r.include) == 0 {
+		return true
+	}
+	for _, re := range r.include {
+		if re.MatchString(tag) {
+			return true
+		}
+	}
+	return false
 }
 
 // Remotes represents all namespaces and their configured remote build-indexes.
 type Remotes []*Remote
 
-// Match returns all matched remotes for a tag.
+// Match returns all matched remotes for a tag. Remotes whose namespace matches
+// but whose tag filters reject tag are skipped.
 func (rs Remotes) Match(tag string) (addrs []string) {
 	for _, r := range rs {
-		if r.regexp.MatchString(tag) {
-			addrs = append(addrs, r.addr)
+		if !r.regexp.MatchString(tag) {
+			continue
 		}
+		if !r.accepts(tag) {
+			log.With("tag", tag, "remote", r.addr).Debug("Skipping remote due to tag filters")
+			continue
+		}
+		addrs = append(addrs, r.addr)
 	}
 	return addrs
 }
@@ -52,6 +80,38 @@ func (rs Remotes) Valid(tag, addr string) bool {
 	return false
 }
 
+// Contains returns true if addr is a configured remote, regardless of tag.
+func (rs Remotes) Contains(addr string) bool {
+	for _, r := range rs {
+		if r.addr == addr {
+			return true
+		}
+	}
+	return false
+}
+
+// RemoteConfig defines which tags should be replicated to a single remote
+// build-index. Tags must match one of Namespaces. If IncludeTags is set, tags
+// must also match one of IncludeTags. Tags matching any of ExcludeTags are never
+// replicated. All patterns are regular expressions matched against the tag.
+type RemoteConfig struct {
+	Namespaces  []string `yaml:"namespaces"`
+	IncludeTags []string `yaml:"include_tags"`
+	ExcludeTags []string `yaml:"exclude_tags"`
+}
+
+// UnmarshalYAML also accepts a plain list of namespaces, for backwards
+// compatibility with configurations which predate tag filters.
+func (c *RemoteConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var namespaces []string
+	if err := unmarshal(&namespaces); err == nil {
+		*c = RemoteConfig{Namespaces: namespaces}
+		return nil
+	}
+	type plain RemoteConfig
+	return unmarshal((*plain)(c))
+}
+
 // RemotesConfig defines remote replication configuration which specifies which
 // namespaces should be replicated to certain build-indexes.
 //
@@ -61,23 +121,46 @@ func (rs Remotes) Valid(tag, addr string) bool {
 //   - namespace_foo/.*
 //
 //   build-index-zone2:
-//   - namespace_foo/.*
+//     namespaces:
+//     - namespace_foo/.*
+//     include_tags:
+//     - .*-release$
 //
 // Any builds matching the namespace_foo/.* namespace should be replicated to
-// zone1 and zone2 build-indexes.
-type RemotesConfig map[string][]string
+// zone1 build-indexes, however only release tags are replicated to zone2.
+type RemotesConfig map[string]RemoteConfig
 
 // Build builds configuration into Remotes.
 func (c RemotesConfig) Build() (Remotes, error) {
 	var remotes Remotes
-	for addr, namespaces := range c {
-		for _, ns := range namespaces {
+	for addr, rc := range c {
+		include, err := compileAll(rc.IncludeTags)
+		if err != nil {
+			return nil, fmt.Errorf("include tags of %s: %s", addr, err)
+		}
+		exclude, err := compileAll(rc.ExcludeTags)
+		if err != nil {
+			return nil, fmt.Errorf("exclude tags of %s: %s", addr, err)
+		}
+		for _, ns := range rc.Namespaces {
 			re, err := regexp.Compile(ns)
 			if err != nil {
 				return nil, fmt.Errorf("regexp compile namespace %s: %s", ns, err)
 			}
-			remotes = append(remotes, &Remote{re, addr})
+			remotes = append(remotes, &Remote{re, addr, include, exclude})
 		}
 	}
 	return remotes, nil
 }
+
+func compileAll(patterns []string) ([]*regexp.Regexp, error) {
+	var res []*regexp.Regexp
+	for _, p := range patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("regexp compile %s: %s", p, err)
+		}
+		res = append(res, re)
+	}
+	return res, nil
+}
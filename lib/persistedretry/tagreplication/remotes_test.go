@@ -17,14 +17,15 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v2"
 )
 
 func TestRemotesMatch(t *testing.T) {
 	require := require.New(t)
 
 	remotes, err := RemotesConfig{
-		"a": []string{"foo/.*", "bar/.*"},
-		"b": []string{"foo/.*"},
+		"a": {Namespaces: []string{"foo/.*", "bar/.*"}},
+		"b": {Namespaces: []string{"foo/.*"}},
 	}.Build()
 	require.NoError(err)
 
@@ -42,10 +43,10 @@ func TestRemotesValid(t *testing.T) {
 	require := require.New(t)
 
 	remotes, err := RemotesConfig{
-		"a": []string{"foo/.*"},
-		"b": []string{"foo/.*"},
-		"c": []string{"foo/.*"},
-		"d": []string{"bar/.*"},
+		"a": {Namespaces: []string{"foo/.*"}},
+		"b": {Namespaces: []string{"foo/.*"}},
+		"c": {Namespaces: []string{"foo/.*"}},
+		"d": {Namespaces: []string{"bar/.*"}},
 	}.Build()
 	require.NoError(err)
 
@@ -68,3 +69,62 @@ func TestRemotesValid(t *testing.T) {
 			"Tag: %s, Addr: %s", test.tag, test.addr)
 	}
 }
+
+func TestRemotesMatchTagFilters(t *testing.T) {
+	require := require.New(t)
+
+	remotes, err := RemotesConfig{
+		"prod": {Namespaces: []string{"foo/.*"}},
+		"dr": {
+			Namespaces:  []string{"foo/.*"},
+			IncludeTags: []string{".*-release$"},
+			ExcludeTags: []string{".*:broken-.*"},
+		},
+	}.Build()
+	require.NoError(err)
+
+	for tag, expected := range map[string][]string{
+		"foo/app:1.0-release":        {"prod", "dr"},
+		"foo/app:1.0-dev":            {"prod"},
+		"foo/app:broken-1.0-release": {"prod"},
+		"bar/app:1.0-release":        nil,
+	} {
+		require.ElementsMatch(expected, remotes.Match(tag), "Tag: %s", tag)
+	}
+
+	require.True(remotes.Valid("foo/app:1.0-release", "dr"))
+	require.False(remotes.Valid("foo/app:1.0-dev", "dr"))
+}
+
+func TestRemotesConfigBuildInvalidTagFilter(t *testing.T) {
+	_, err := RemotesConfig{
+		"a": {Namespaces: []string{"foo/.*"}, IncludeTags: []string{"("}},
+	}.Build()
+	require.Error(t, err)
+}
+
+func TestRemotesConfigUnmarshalYAML(t *testing.T) {
+	require := require.New(t)
+
+	var c RemotesConfig
+	require.NoError(yaml.Unmarshal([]byte(`
+a:
+- foo/.*
+b:
+  namespaces:
+  - foo/.*
+  include_tags:
+  - .*-release$
+  exclude_tags:
+  - .*-rc.*
+`), &c))
+
+	require.Equal(RemotesConfig{
+		"a": {Namespaces: []string{"foo/.*"}},
+		"b": {
+			Namespaces:  []string{"foo/.*"},
+			IncludeTags: []string{".*-release$"},
+			ExcludeTags: []string{".*-rc.*"},
+		},
+	}, c)
+}
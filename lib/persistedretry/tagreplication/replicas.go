@@ -0,0 +1,77 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package tagreplication
+
+import (
+	"time"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/persistedretry"
+)
+
+// Replica records the last digest of a tag which a remote acknowledged.
+type Replica struct {
+	Tag          string      `db:"tag"`
+	Destination  string      `db:"destination"`
+	Digest       core.Digest `db:"digest"`
+	ReplicatedAt time.Time   `db:"replicated_at"`
+}
+
+// AddReplica records that the destination of t acknowledged the digest of t,
+// replacing any digest it previously acknowledged for the tag.
+func (s *Store) AddReplica(t *Task) error {
+	_, err := s.db.NamedExec(`
+		INSERT OR REPLACE INTO replicated_tag (
+			tag,
+			destination,
+			digest,
+			replicated_at
+		) VALUES (
+			:tag,
+			:destination,
+			:digest,
+			CURRENT_TIMESTAMP
+		)
+	`, t)
+	return err
+}
+
+// GetReplicas returns the replicas of tag acknowledged by remotes.
+func (s *Store) GetReplicas(tag string) ([]*Replica, error) {
+	var replicas []*Replica
+	err := s.db.Select(&replicas, `
+		SELECT tag, destination, digest, replicated_at
+		FROM replicated_tag
+		WHERE tag=?
+		ORDER BY destination`, tag)
+	if err != nil {
+		return nil, err
+	}
+	return replicas, nil
+}
+
+// ReplicaHooks returns hooks which record the replicas of tasks in s once
+// remotes acknowledge them. Tasks which are pending, failed or dropped are not
+// recorded, nor are tasks of mirrors, which are not build-indexes.
+func ReplicaHooks(s *Store) persistedretry.Hooks {
+	return persistedretry.Hooks{
+		OnSuccess: func(t persistedretry.Task) error {
+			task := t.(*Task)
+			if IsMirrorDestination(task.Destination) {
+				return nil
+			}
+			return s.AddReplica(task)
+		},
+	}
+}
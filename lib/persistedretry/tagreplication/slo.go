@@ -0,0 +1,108 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package tagreplication
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/andres-erbsen/clock"
+
+	"github.com/uber/kraken/lib/slo"
+)
+
+// SLOConfig defines the thresholds of replication service level indicators.
+type SLOConfig struct {
+	// MaxLag is the age of the oldest unreplicated task beyond which
+	// replication is over budget.
+	MaxLag time.Duration `yaml:"max_lag"`
+
+	// MaxBacklog is the number of unreplicated tasks beyond which replication
+	// is over budget.
+	MaxBacklog int `yaml:"max_backlog"`
+
+	// EmitInterval is the interval at which indicators are emitted as gauges.
+	EmitInterval time.Duration `yaml:"emit_interval"`
+}
+
+func (c SLOConfig) applyDefaults() SLOConfig {
+	if c.MaxLag == 0 {
+		c.MaxLag = 10 * time.Minute
+	}
+	if c.MaxBacklog == 0 {
+		c.MaxBacklog = 1000
+	}
+	if c.EmitInterval == 0 {
+		c.EmitInterval = time.Minute
+	}
+	return c
+}
+
+// Backlog returns the number of tasks which are yet to be replicated, and when
+// the oldest of them was created. The creation time is zero if there are no
+// tasks. Tasks of paused remotes are excluded, since they are held back on
+// purpose rather than lagging.
+func (s *Store) Backlog() (int, time.Time, error) {
+	var n int
+	err := s.db.Get(&n, `
+		SELECT COUNT(*) FROM replicate_tag_task
+		WHERE destination NOT IN (SELECT remote FROM paused_remote)`)
+	if err != nil {
+		return 0, time.Time{}, fmt.Errorf("count: %s", err)
+	}
+	var oldest time.Time
+	err = s.db.Get(&oldest, `
+		SELECT created_at FROM replicate_tag_task
+		WHERE destination NOT IN (SELECT remote FROM paused_remote)
+		ORDER BY created_at LIMIT 1`)
+	if err != nil && err != sql.ErrNoRows {
+		return 0, time.Time{}, fmt.Errorf("select oldest: %s", err)
+	}
+	return n, oldest, nil
+}
+
+// EmitIndicators reports r every EmitInterval of config, such that the gauges
+// of indicators stay current even if the report is never requested. Never
+// returns.
+func EmitIndicators(config SLOConfig, r *slo.Registry, clk clock.Clock) {
+	config = config.applyDefaults()
+	r.Emit(clk, config.EmitInterval)
+}
+
+// Indicators returns the replication service level indicators of s:
+//
+//   replication_lag_seconds: age of the oldest unreplicated task.
+//   replication_backlog: number of unreplicated tasks.
+func Indicators(config SLOConfig, s *Store, clk clock.Clock) []slo.Indicator {
+	config = config.applyDefaults()
+	return []slo.Indicator{{
+		Name:      "replication_lag_seconds",
+		Threshold: config.MaxLag.Seconds(),
+		Value: func() (float64, error) {
+			_, oldest, err := s.Backlog()
+			if err != nil || oldest.IsZero() {
+				return 0, err
+			}
+			return clk.Now().Sub(oldest).Seconds(), nil
+		},
+	}, {
+		Name:      "replication_backlog",
+		Threshold: float64(config.MaxBacklog),
+		Value: func() (float64, error) {
+			n, _, err := s.Backlog()
+			return float64(n), err
+		},
+	}}
+}
@@ -0,0 +1,101 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package tagreplication_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/stretchr/testify/require"
+	"github.com/uber-go/tally"
+
+	. "github.com/uber/kraken/lib/persistedretry/tagreplication"
+	"github.com/uber/kraken/lib/slo"
+)
+
+func TestIndicatorsReportOverBudgetLagAsBreached(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newStoreMocks(t)
+	defer cleanup()
+
+	store := mocks.new()
+
+	clk := clock.NewMock()
+	clk.Set(time.Now())
+
+	registry := slo.NewRegistry(tally.NoopScope)
+	registry.Register(Indicators(SLOConfig{MaxLag: 10 * time.Minute}, store, clk)...)
+
+	report := registry.Report()
+	require.False(report.Breached)
+
+	require.NoError(store.AddPending(TaskFixture()))
+
+	// Replication is stuck for longer than the lag budget.
+	clk.Add(time.Hour)
+
+	report = registry.Report()
+	require.True(report.Breached)
+	require.Len(report.Indicators, 2)
+
+	lag := report.Indicators[0]
+	require.Equal("replication_lag_seconds", lag.Name)
+	require.True(lag.Breached)
+	require.InDelta(time.Hour.Seconds(), lag.Value, 5)
+	require.Equal((10 * time.Minute).Seconds(), lag.Threshold)
+
+	backlog := report.Indicators[1]
+	require.Equal("replication_backlog", backlog.Name)
+	require.Equal(float64(1), backlog.Value)
+	require.False(backlog.Breached)
+}
+
+func TestBacklogExcludesTasksOfPausedRemotes(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newStoreMocks(t)
+	defer cleanup()
+
+	store := mocks.new()
+
+	paused := TaskFixture()
+	paused.Destination = "paused-remote"
+	require.NoError(store.AddPending(paused))
+
+	// The paused task is the oldest.
+	_, err := mocks.db.Exec(
+		`UPDATE replicate_tag_task SET created_at=? WHERE destination=?`,
+		time.Now().Add(-time.Hour), paused.Destination)
+	require.NoError(err)
+
+	active := TaskFixture()
+	require.NoError(store.AddPending(active))
+
+	remotes, err := NewPausedRemotes(mocks.db)
+	require.NoError(err)
+	require.NoError(remotes.PauseRemote(paused.Destination))
+
+	n, oldest, err := store.Backlog()
+	require.NoError(err)
+	require.Equal(1, n)
+	require.InDelta(active.CreatedAt.Unix(), oldest.Unix(), 1)
+
+	require.NoError(remotes.ResumeRemote(paused.Destination))
+
+	n, _, err = store.Backlog()
+	require.NoError(err)
+	require.Equal(2, n)
+}
@@ -16,10 +16,13 @@ package tagreplication
 import (
 	"errors"
 	"fmt"
+	"regexp"
+	"sync"
 	"time"
 
 	"github.com/jmoiron/sqlx"
 	"github.com/mattn/go-sqlite3"
+	"github.com/uber-go/tally"
 
 	"github.com/uber/kraken/lib/persistedretry"
 )
@@ -27,11 +30,26 @@ import (
 // Store stores tags to be replicated asynchronously.
 type Store struct {
 	db *sqlx.DB
+
+	capacity     CapacityConfig
+	highPriority []*regexp.Regexp
+	stats        tally.Scope
+
+	// Serializes adds, such that concurrent adds cannot exceed capacity.
+	capacityMu  sync.Mutex
+	maxFailures int
+	onShed      func(persistedretry.Task, error)
 }
 
 // NewStore creates a new Store.
-func NewStore(db *sqlx.DB, rv RemoteValidator) (*Store, error) {
-	s := &Store{db}
+func NewStore(db *sqlx.DB, rv RemoteValidator, opts ...StoreOption) (*Store, error) {
+	s := &Store{db: db, stats: tally.NoopScope}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if err := s.compileHighPriorityTags(); err != nil {
+		return nil, fmt.Errorf("high priority tags: %s", err)
+	}
 	if err := s.deleteInvalidTasks(rv); err != nil {
 		return nil, fmt.Errorf("delete invalid tasks: %s", err)
 	}
@@ -43,9 +61,23 @@ func (s *Store) GetPending() ([]persistedretry.Task, error) {
 	return s.selectStatus("pending")
 }
 
-// GetFailed returns all failed tasks.
+// GetFailed returns all failed tasks, except for tasks to paused remotes,
+// which are left in the store until their remote is resumed.
 func (s *Store) GetFailed() ([]persistedretry.Task, error) {
-	return s.selectStatus("failed")
+	var tasks []*Task
+	err := s.db.Select(&tasks, `
+		SELECT tag, digest, dependencies, destination, created_at, last_attempt, failures, delay, callback,
+			after_tags, priority
+		FROM replicate_tag_task
+		WHERE status="failed" AND destination NOT IN (SELECT remote FROM paused_remote)`)
+	if err != nil {
+		return nil, err
+	}
+	var result []persistedretry.Task
+	for _, t := range tasks {
+		result = append(result, t)
+	}
+	return result, nil
 }
 
 // AddPending adds r as pending.
@@ -76,6 +108,25 @@ func (s *Store) MarkPending(r persistedretry.Task) error {
 	return nil
 }
 
+// MarkPaused marks r as failed without counting a failure, such that it is
+// returned by GetFailed once its remote is no longer paused.
+func (s *Store) MarkPaused(r persistedretry.Task) error {
+	res, err := s.db.NamedExec(`
+		UPDATE replicate_tag_task
+		SET status = "failed"
+		WHERE tag=:tag AND destination=:destination
+	`, r.(*Task))
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		panic("driver does not support RowsAffected")
+	} else if n == 0 {
+		return persistedretry.ErrTaskNotFound
+	}
+	return nil
+}
+
 // MarkFailed marks r as failed.
 func (s *Store) MarkFailed(r persistedretry.Task) error {
 	t := r.(*Task)
@@ -110,6 +161,17 @@ func (s *Store) Find(query interface{}) ([]persistedretry.Task, error) {
 }
 
 func (s *Store) addWithStatus(r persistedretry.Task, status string) error {
+	s.capacityMu.Lock()
+	defer s.capacityMu.Unlock()
+
+	t := r.(*Task)
+	if t.Priority == 0 && s.matchesHighPriorityTags(t) {
+		// Stamp the priority into t, such that it is inherited downstream.
+		t.Priority = PriorityHigh
+	}
+	if err := s.reserve(t); err != nil {
+		return err
+	}
 	query := fmt.Sprintf(`
 		INSERT INTO replicate_tag_task (
 			tag,
@@ -119,6 +181,9 @@ func (s *Store) addWithStatus(r persistedretry.Task, status string) error {
 			last_attempt,
 			failures,
 			delay,
+			callback,
+			after_tags,
+			priority,
 			status
 		) VALUES (
 			:tag,
@@ -128,14 +193,20 @@ func (s *Store) addWithStatus(r persistedretry.Task, status string) error {
 			:last_attempt,
 			:failures,
 			:delay,
+			:callback,
+			:after_tags,
+			:priority,
 			%q
 		)
 	`, status)
-	_, err := s.db.NamedExec(query, r.(*Task))
+	_, err := s.db.NamedExec(query, t)
 	if se, ok := err.(sqlite3.Error); ok {
 		if se.ExtendedCode == sqlite3.ErrConstraintPrimaryKey {
 			return persistedretry.ErrTaskExists
 		}
+		if se.Code == sqlite3.ErrFull {
+			return ErrReplicationBacklogFull
+		}
 	}
 	return err
 }
@@ -143,7 +214,8 @@ func (s *Store) addWithStatus(r persistedretry.Task, status string) error {
 func (s *Store) selectStatus(status string) ([]persistedretry.Task, error) {
 	var tasks []*Task
 	err := s.db.Select(&tasks, `
-		SELECT tag, digest, dependencies, destination, created_at, last_attempt, failures, delay
+		SELECT tag, digest, dependencies, destination, created_at, last_attempt, failures, delay, callback,
+			after_tags, priority
 		FROM replicate_tag_task
 		WHERE status=?`, status)
 	if err != nil {
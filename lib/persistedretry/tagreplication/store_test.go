@@ -288,3 +288,32 @@ func TestDelay(t *testing.T) {
 	require.False(pending[0].Ready())
 	require.True(pending[1].Ready())
 }
+
+func TestStoreGetFailedSkipsPausedRemotes(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newStoreMocks(t)
+	defer cleanup()
+
+	store := mocks.new()
+
+	paused, err := NewPausedRemotes(mocks.db)
+	require.NoError(err)
+
+	task := TaskFixture()
+	require.NoError(store.AddPending(task))
+	require.NoError(store.MarkPaused(task))
+
+	require.NoError(paused.PauseRemote(task.Destination))
+
+	failed, err := store.GetFailed()
+	require.NoError(err)
+	require.Empty(failed)
+
+	require.NoError(paused.ResumeRemote(task.Destination))
+
+	failed, err = store.GetFailed()
+	require.NoError(err)
+	checkTasks(t, []*Task{task}, failed)
+	require.Equal(0, failed[0].GetFailures())
+}
@@ -14,6 +14,8 @@
 package tagreplication
 
 import (
+	"database/sql/driver"
+	"encoding/json"
 	"fmt"
 	"time"
 
@@ -31,6 +33,57 @@ type Task struct {
 	LastAttempt  time.Time       `db:"last_attempt"`
 	Failures     int             `db:"failures"`
 	Delay        time.Duration   `db:"delay"`
+
+	// Callback is notified once the task succeeds or is dropped, if set.
+	Callback string `db:"callback"`
+
+	// After lists the tags whose replications to the same destination must
+	// complete before the task is dispatched.
+	After TagList `db:"after_tags"`
+
+	// Priority is inherited by the tasks the destination enqueues in turn, such
+	// that urgent replications stay ahead of routine ones at every hop of a
+	// cascade. Tasks of PriorityHigh or above are high priority.
+	Priority int `db:"priority"`
+}
+
+// PriorityHigh is the priority of tasks of high priority tags, which are kept
+// when a full store sheds tasks.
+const PriorityHigh = 1
+
+// TagList is a list of tags, stored as JSON.
+type TagList []string
+
+// Value marshals l to JSON.
+func (l TagList) Value() (driver.Value, error) {
+	if l == nil {
+		l = TagList{}
+	}
+	b, err := json.Marshal(l)
+	if err != nil {
+		return driver.Value([]byte{}), err
+	}
+	return driver.Value(b), nil
+}
+
+// Scan unmarshals l from JSON.
+func (l *TagList) Scan(src interface{}) error {
+	var b []byte
+	switch s := src.(type) {
+	case []byte:
+		b = s
+	case string:
+		b = []byte(s)
+	default:
+		return fmt.Errorf("unsupported tag list type %T", src)
+	}
+	if err := json.Unmarshal(b, l); err != nil {
+		return err
+	}
+	if len(*l) == 0 {
+		*l = nil
+	}
+	return nil
 }
 
 // NewTask creates a new Task.
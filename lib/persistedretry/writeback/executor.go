@@ -20,6 +20,7 @@ import (
 
 	"github.com/uber-go/tally"
 	"github.com/uber/kraken/lib/backend"
+	"github.com/uber/kraken/lib/backend/backenderrors"
 	"github.com/uber/kraken/lib/persistedretry"
 	"github.com/uber/kraken/lib/store"
 	"github.com/uber/kraken/lib/store/metadata"
@@ -85,9 +86,13 @@ func (e *Executor) upload(t *Task) error {
 		return fmt.Errorf("get client: %s", err)
 	}
 
-	if _, err := client.Stat(t.Namespace, t.Name); err == nil {
-		// File already uploaded, no-op.
-		return nil
+	// Without conditional writes, we must check for existing uploads upfront.
+	conditional := client.Capabilities().ConditionalWrites
+	if !conditional {
+		if _, err := client.Stat(t.Namespace, t.Name); err == nil {
+			// File already uploaded, no-op.
+			return nil
+		}
 	}
 
 	f, err := e.fs.GetCacheFileReader(t.Name)
@@ -102,8 +107,17 @@ func (e *Executor) upload(t *Task) error {
 	}
 	defer f.Close()
 
-	if err := client.Upload(t.Namespace, t.Name, f); err != nil {
-		return fmt.Errorf("upload: %s", err)
+	if conditional {
+		err = client.(backend.ConditionalClient).UploadIfAbsent(t.Namespace, t.Name, f)
+		if err == backenderrors.ErrBlobExists {
+			// File already uploaded, no-op.
+			return nil
+		}
+	} else {
+		err = client.Upload(t.Namespace, t.Name, f)
+	}
+	if err != nil {
+		return fmt.Errorf("upload: %w", err)
 	}
 
 	// We don't want to time noops nor errors.
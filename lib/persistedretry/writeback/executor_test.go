@@ -61,6 +61,17 @@ func (m *executorMocks) new() *Executor {
 
 func (m *executorMocks) client(namespace string) *mockbackend.MockClient {
 	client := mockbackend.NewMockClient(m.ctrl)
+	client.EXPECT().Capabilities().Return(backend.BackendCapabilities{}).AnyTimes()
+	if err := m.backends.Register(namespace, client); err != nil {
+		panic(err)
+	}
+	return client
+}
+
+func (m *executorMocks) conditionalClient(namespace string) *mockbackend.MockConditionalClient {
+	client := mockbackend.NewMockConditionalClient(m.ctrl)
+	client.EXPECT().Capabilities().Return(
+		backend.BackendCapabilities{ConditionalWrites: true}).AnyTimes()
 	if err := m.backends.Register(namespace, client); err != nil {
 		panic(err)
 	}
@@ -188,3 +199,46 @@ func TestExecUploadFailure(t *testing.T) {
 	// metadata is still present.
 	require.Error(mocks.cas.DeleteCacheFile(blob.Digest.Hex()))
 }
+
+func TestExecConditionalUpload(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newExecutorMocks(t)
+	defer cleanup()
+
+	blob := core.NewBlobFixture()
+
+	setupBlob(t, mocks.cas, blob)
+
+	task := NewTask(core.TagFixture(), blob.Digest.Hex(), 0)
+
+	// No Stat is expected, since the client supports conditional writes.
+	client := mocks.conditionalClient(task.Namespace)
+	client.EXPECT().UploadIfAbsent(
+		task.Namespace, blob.Digest.Hex(), mockutil.MatchReader(blob.Content)).Return(nil)
+
+	executor := mocks.new()
+
+	require.NoError(executor.Exec(task))
+}
+
+func TestExecConditionalUploadNoopWhenFileAlreadyUploaded(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newExecutorMocks(t)
+	defer cleanup()
+
+	blob := core.NewBlobFixture()
+
+	setupBlob(t, mocks.cas, blob)
+
+	task := NewTask(core.TagFixture(), blob.Digest.Hex(), 0)
+
+	client := mocks.conditionalClient(task.Namespace)
+	client.EXPECT().UploadIfAbsent(
+		task.Namespace, blob.Digest.Hex(), gomock.Any()).Return(backenderrors.ErrBlobExists)
+
+	executor := mocks.new()
+
+	require.NoError(executor.Exec(task))
+}
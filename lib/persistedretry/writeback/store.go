@@ -72,6 +72,24 @@ func (s *Store) MarkPending(r persistedretry.Task) error {
 	return nil
 }
 
+// MarkPaused marks r as failed without counting a failure.
+func (s *Store) MarkPaused(r persistedretry.Task) error {
+	res, err := s.db.NamedExec(`
+		UPDATE writeback_task
+		SET status = "failed"
+		WHERE namespace=:namespace AND name=:name
+	`, r.(*Task))
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		panic("driver does not support RowsAffected")
+	} else if n == 0 {
+		return persistedretry.ErrTaskNotFound
+	}
+	return nil
+}
+
 // MarkFailed marks r as failed.
 func (s *Store) MarkFailed(r persistedretry.Task) error {
 	t := r.(*Task)
@@ -0,0 +1,133 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+// Package slo reports service level indicators along with the thresholds
+// beyond which they breach their objectives, such that alerting may consume
+// them directly rather than re-deriving thresholds from raw metrics.
+package slo
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/uber-go/tally"
+
+	"github.com/uber/kraken/utils/handler"
+	"github.com/uber/kraken/utils/log"
+)
+
+// Indicator defines a service level indicator, which breaches its objective
+// while its value exceeds Threshold.
+type Indicator struct {
+	Name      string
+	Threshold float64
+	Value     func() (float64, error)
+}
+
+// IndicatorStatus is the current status of an Indicator.
+type IndicatorStatus struct {
+	Name      string  `json:"name"`
+	Value     float64 `json:"value"`
+	Threshold float64 `json:"threshold"`
+	Breached  bool    `json:"breached"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// Report is the status of all indicators of a Registry. Breached is set if any
+// indicator breached its objective.
+type Report struct {
+	Indicators []IndicatorStatus `json:"indicators"`
+	Breached   bool              `json:"breached"`
+}
+
+// Registry holds indicators. Every report also emits the value, threshold and
+// breach status of each indicator as gauges, tagged with the indicator name.
+type Registry struct {
+	stats tally.Scope
+
+	mu         sync.Mutex
+	indicators []Indicator
+}
+
+// NewRegistry creates a new Registry.
+func NewRegistry(stats tally.Scope) *Registry {
+	return &Registry{stats: stats.SubScope("slo")}
+}
+
+// Register adds indicators to r.
+func (r *Registry) Register(indicators ...Indicator) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.indicators = append(r.indicators, indicators...)
+}
+
+// Report evaluates all indicators in registration order. Indicators whose
+// value cannot be determined are reported as breached, since their objective
+// cannot be verified.
+func (r *Registry) Report() Report {
+	r.mu.Lock()
+	indicators := append([]Indicator(nil), r.indicators...)
+	r.mu.Unlock()
+
+	report := Report{Indicators: []IndicatorStatus{}}
+	for _, i := range indicators {
+		status := IndicatorStatus{Name: i.Name, Threshold: i.Threshold}
+		v, err := i.Value()
+		if err != nil {
+			log.With("indicator", i.Name).Errorf("Error evaluating indicator: %s", err)
+			status.Error = err.Error()
+			status.Breached = true
+		} else {
+			status.Value = v
+			status.Breached = v > i.Threshold
+		}
+		report.Indicators = append(report.Indicators, status)
+		report.Breached = report.Breached || status.Breached
+		r.emit(status)
+	}
+	return report
+}
+
+func (r *Registry) emit(status IndicatorStatus) {
+	scope := r.stats.Tagged(map[string]string{"indicator": status.Name})
+	scope.Gauge("value").Update(status.Value)
+	scope.Gauge("threshold").Update(status.Threshold)
+	var breached float64
+	if status.Breached {
+		breached = 1
+	}
+	scope.Gauge("breached").Update(breached)
+}
+
+// Emit reports r every interval, such that the gauges of indicators are
+// emitted even if the report is never requested. Never returns.
+func (r *Registry) Emit(clk clock.Clock, interval time.Duration) {
+	ticker := clk.Ticker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		r.Report()
+	}
+}
+
+// Handler serves the report of r as JSON.
+func (r *Registry) Handler(w http.ResponseWriter, req *http.Request) error {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(r.Report()); err != nil {
+		return handler.Errorf("json encode: %s", err)
+	}
+	return nil
+}
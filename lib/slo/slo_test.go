@@ -0,0 +1,103 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package slo
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/stretchr/testify/require"
+	"github.com/uber-go/tally"
+
+	"github.com/uber/kraken/utils/handler"
+	"github.com/uber/kraken/utils/testutil"
+)
+
+func constant(v float64) func() (float64, error) {
+	return func() (float64, error) { return v, nil }
+}
+
+func TestRegistryReport(t *testing.T) {
+	require := require.New(t)
+
+	stats := tally.NewTestScope("", nil)
+	r := NewRegistry(stats)
+	r.Register(
+		Indicator{Name: "ok", Threshold: 10, Value: constant(5)},
+		Indicator{Name: "over", Threshold: 10, Value: constant(11)})
+
+	report := r.Report()
+	require.Equal([]IndicatorStatus{
+		{Name: "ok", Value: 5, Threshold: 10},
+		{Name: "over", Value: 11, Threshold: 10, Breached: true},
+	}, report.Indicators)
+	require.True(report.Breached)
+
+	gauges := stats.Snapshot().Gauges()
+	require.Equal(float64(1), gauges["slo.breached+indicator=over"].Value())
+	require.Equal(float64(0), gauges["slo.breached+indicator=ok"].Value())
+}
+
+func TestRegistryReportsFailedIndicatorsAsBreached(t *testing.T) {
+	require := require.New(t)
+
+	r := NewRegistry(tally.NoopScope)
+	r.Register(Indicator{Name: "broken", Threshold: 1, Value: func() (float64, error) {
+		return 0, errors.New("some error")
+	}})
+
+	report := r.Report()
+	require.Len(report.Indicators, 1)
+	require.True(report.Indicators[0].Breached)
+	require.Equal("some error", report.Indicators[0].Error)
+	require.True(report.Breached)
+}
+
+func TestRegistryHandler(t *testing.T) {
+	require := require.New(t)
+
+	r := NewRegistry(tally.NoopScope)
+	r.Register(Indicator{Name: "ok", Threshold: 1, Value: constant(0)})
+
+	rec := httptest.NewRecorder()
+	handler.Wrap(r.Handler)(rec, httptest.NewRequest(http.MethodGet, "/status/slo", nil))
+	require.Equal(http.StatusOK, rec.Code)
+
+	var report Report
+	require.NoError(json.NewDecoder(rec.Body).Decode(&report))
+	require.False(report.Breached)
+	require.Equal("ok", report.Indicators[0].Name)
+}
+
+func TestRegistryEmitUpdatesGaugesWithoutReports(t *testing.T) {
+	require := require.New(t)
+
+	stats := tally.NewTestScope("", nil)
+	r := NewRegistry(stats)
+	r.Register(Indicator{Name: "over", Threshold: 10, Value: constant(11)})
+
+	clk := clock.NewMock()
+	go r.Emit(clk, time.Minute)
+
+	require.NoError(testutil.PollUntilTrue(5*time.Second, func() bool {
+		clk.Add(time.Minute)
+		g, ok := stats.Snapshot().Gauges()["slo.breached+indicator=over"]
+		return ok && g.Value() == 1
+	}))
+}
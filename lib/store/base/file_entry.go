@@ -17,6 +17,7 @@ import (
 	"bytes"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
@@ -86,6 +87,7 @@ type FileEntry interface {
 
 	GetMetadata(md metadata.Metadata) error
 	SetMetadata(md metadata.Metadata) (bool, error)
+	GetMetadataAt(md metadata.Metadata, b []byte, offset int64) (int, error)
 	SetMetadataAt(md metadata.Metadata, b []byte, offset int64) (updated bool, err error)
 	GetOrSetMetadata(md metadata.Metadata) error
 	DeleteMetadata(md metadata.Metadata) error
@@ -357,8 +359,50 @@ func (entry *localFileEntry) MoveFrom(targetState FileState, sourcePath string)
 		return err
 	}
 
+	// If the source is a data file of another store, copy its movable metadata
+	// first, such that the data never appears without it.
+	if filepath.Base(sourcePath) == DefaultDataFileName {
+		if err := entry.copyMovableMetadataFrom(filepath.Dir(sourcePath)); err != nil {
+			return fmt.Errorf("copy metadata: %s", err)
+		}
+	}
+
 	// Move data.
-	return os.Rename(sourcePath, targetPath)
+	if err := os.Rename(sourcePath, targetPath); err != nil {
+		entry.RangeMetadata(func(md metadata.Metadata) error {
+			os.Remove(entry.getMetadataPath(md))
+			return nil
+		})
+		return err
+	}
+	return nil
+}
+
+// copyMovableMetadataFrom copies all movable metadata files in sourceDir to
+// entry.
+func (entry *localFileEntry) copyMovableMetadataFrom(sourceDir string) error {
+	files, err := ioutil.ReadDir(sourceDir)
+	if err != nil {
+		return err
+	}
+	for _, currFile := range files {
+		if currFile.Name() == DefaultDataFileName {
+			continue
+		}
+		md := metadata.CreateFromSuffix(currFile.Name())
+		if md == nil || !md.Movable() {
+			continue
+		}
+		b, err := ioutil.ReadFile(filepath.Join(sourceDir, currFile.Name()))
+		if err != nil {
+			return err
+		}
+		if _, err := compareAndWriteFile(entry.getMetadataPath(md), b); err != nil {
+			return err
+		}
+		entry.metadata.Add(md.GetSuffix())
+	}
+	return nil
 }
 
 // Move moves file to target dir under the same name, moves all metadata that's `movable`, and
@@ -506,8 +550,21 @@ func (entry *localFileEntry) SetMetadata(md metadata.Metadata) (bool, error) {
 	return updated, err
 }
 
+// GetMetadataAt reads len(b) bytes of metadata starting at offset into b.
+// Returns io.EOF if fewer bytes are available.
+func (entry *localFileEntry) GetMetadataAt(
+	md metadata.Metadata, b []byte, offset int64) (int, error) {
+
+	f, err := os.Open(entry.getMetadataPath(md))
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	return f.ReadAt(b, offset)
+}
+
 // SetMetadataAt overwrites a single byte of metadata. Returns true if the byte
-// was overwritten.
+// was overwritten. Writing beyond the end of the metadata extends it.
 func (entry *localFileEntry) SetMetadataAt(
 	md metadata.Metadata, b []byte, offset int64) (updated bool, err error) {
 
@@ -519,7 +576,7 @@ func (entry *localFileEntry) SetMetadataAt(
 	defer f.Close()
 
 	prev := make([]byte, len(b))
-	if _, err := f.ReadAt(prev, offset); err != nil {
+	if _, err := f.ReadAt(prev, offset); err != nil && err != io.EOF {
 		return false, err
 	}
 	if bytes.Compare(prev, b) == 0 {
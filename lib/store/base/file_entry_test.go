@@ -15,6 +15,7 @@ package base
 
 import (
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
@@ -172,6 +173,7 @@ func TestFileEntry(t *testing.T) {
 		testMoveFromExisting,
 		testMoveFromWrongState,
 		testMoveFromWrongSourcePath,
+		testMoveFromCopiesMovableMetadata,
 		testMove,
 		testLinkTo,
 		testDelete,
@@ -179,6 +181,8 @@ func TestFileEntry(t *testing.T) {
 		testGetMetadataAndSetMetadata,
 		testGetMetadataFail,
 		testSetMetadataAt,
+		testSetMetadataAtExtends,
+		testGetMetadataAt,
 		testGetOrSetMetadata,
 		testDeleteMetadata,
 		testRangeMetadata,
@@ -325,6 +329,40 @@ func testMoveFromWrongSourcePath(require *require.Assertions, bundle *fileEntryT
 	require.True(os.IsNotExist(err))
 }
 
+func testMoveFromCopiesMovableMetadata(require *require.Assertions, bundle *fileEntryTestBundle) {
+	fe := bundle.entry
+	s1 := bundle.state1
+	s3 := bundle.state3
+
+	m := getMockMetadataOne()
+	m.content = randutil.Blob(8)
+	mm := getMockMetadataMovable()
+	mm.content = randutil.Blob(8)
+
+	// Source is the data file of another store, with metadata next to it.
+	sourceDir, err := ioutil.TempDir(s3.GetDirectory(), "")
+	require.NoError(err)
+	sourcePath := filepath.Join(sourceDir, DefaultDataFileName)
+	require.NoError(ioutil.WriteFile(sourcePath, randutil.Blob(32), 0775))
+	require.NoError(ioutil.WriteFile(filepath.Join(sourceDir, m.GetSuffix()), m.content, 0775))
+	require.NoError(ioutil.WriteFile(filepath.Join(sourceDir, mm.GetSuffix()), mm.content, 0775))
+
+	require.NoError(fe.MoveFrom(s1, sourcePath))
+
+	// Only movable metadata is carried over.
+	mmresult := getMockMetadataMovable()
+	require.NoError(fe.GetMetadata(mmresult))
+	require.Equal(mm.content, mmresult.content)
+	require.True(os.IsNotExist(fe.GetMetadata(getMockMetadataOne())))
+
+	var suffixes []string
+	require.NoError(fe.RangeMetadata(func(md metadata.Metadata) error {
+		suffixes = append(suffixes, md.GetSuffix())
+		return nil
+	}))
+	require.Equal([]string{mm.GetSuffix()}, suffixes)
+}
+
 func testMove(require *require.Assertions, bundle *fileEntryTestBundle) {
 	fe := bundle.entry
 	s1 := bundle.state1
@@ -538,6 +576,44 @@ func testSetMetadataAt(require *require.Assertions, bundle *fileEntryTestBundle)
 	require.Equal([]byte{1, 5, 5, 4}, result.content)
 }
 
+func testSetMetadataAtExtends(require *require.Assertions, bundle *fileEntryTestBundle) {
+	fe := bundle.entry
+
+	m := getMockMetadataOne()
+	m.content = []byte{1, 2}
+
+	_, err := fe.SetMetadata(m)
+	require.NoError(err)
+
+	updated, err := fe.SetMetadataAt(m, []byte{5, 5}, 3)
+	require.NoError(err)
+	require.True(updated)
+
+	result := getMockMetadataOne()
+	require.NoError(fe.GetMetadata(result))
+	require.Equal([]byte{1, 2, 0, 5, 5}, result.content)
+}
+
+func testGetMetadataAt(require *require.Assertions, bundle *fileEntryTestBundle) {
+	fe := bundle.entry
+
+	m := getMockMetadataOne()
+	m.content = []byte{1, 2, 3, 4}
+
+	_, err := fe.SetMetadata(m)
+	require.NoError(err)
+
+	b := make([]byte, 2)
+	n, err := fe.GetMetadataAt(m, b, 1)
+	require.NoError(err)
+	require.Equal(2, n)
+	require.Equal([]byte{2, 3}, b)
+
+	n, err = fe.GetMetadataAt(m, b, 3)
+	require.Equal(io.EOF, err)
+	require.Equal(1, n)
+}
+
 func testGetOrSetMetadata(require *require.Assertions, bundle *fileEntryTestBundle) {
 	fe := bundle.entry
 
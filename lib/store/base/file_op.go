@@ -52,6 +52,7 @@ type FileOp interface {
 
 	GetFileMetadata(name string, md metadata.Metadata) error
 	SetFileMetadata(name string, md metadata.Metadata) (bool, error)
+	GetFileMetadataAt(name string, md metadata.Metadata, b []byte, offset int64) (int, error)
 	SetFileMetadataAt(name string, md metadata.Metadata, b []byte, offset int64) (bool, error)
 	GetOrSetFileMetadata(name string, md metadata.Metadata) error
 	DeleteFileMetadata(name string, md metadata.Metadata) error
@@ -397,6 +398,18 @@ func (op *localFileOp) SetFileMetadata(name string, md metadata.Metadata) (updat
 	return updated, err
 }
 
+// GetFileMetadataAt reads metadata assocciated with the file starting at offset.
+func (op *localFileOp) GetFileMetadataAt(
+	name string, md metadata.Metadata, b []byte, offset int64) (n int, err error) {
+
+	if loadErr := op.lockHelper(name, _lockLevelPeek, func(name string, entry FileEntry) {
+		n, err = entry.GetMetadataAt(md, b, offset)
+	}); loadErr != nil {
+		return 0, loadErr
+	}
+	return n, err
+}
+
 // SetFileMetadataAt overwrites metadata assocciate with the file with content.
 func (op *localFileOp) SetFileMetadataAt(
 	name string, md metadata.Metadata, b []byte, offset int64) (updated bool, err error) {
@@ -16,6 +16,7 @@ package store
 import (
 	"fmt"
 	"os"
+	"sync"
 
 	"github.com/uber/kraken/lib/store/base"
 	"github.com/uber/kraken/lib/store/metadata"
@@ -30,6 +31,11 @@ type CADownloadStore struct {
 	downloadState base.FileState
 	cacheState    base.FileState
 	cleanup       *cleanupManager
+	fsync         *fsyncer
+	encrypt       *encryptor
+
+	stopOnce sync.Once
+	stopc    chan struct{}
 }
 
 // NewCADownloadStore creates a new CADownloadStore.
@@ -38,6 +44,16 @@ func NewCADownloadStore(config CADownloadStoreConfig, stats tally.Scope) (*CADow
 		"module": "cadownloadstore",
 	})
 
+	fsync, err := newFsyncer(config.FsyncPolicy, stats)
+	if err != nil {
+		return nil, err
+	}
+
+	encrypt, err := newEncryptor(config.Encryption, stats)
+	if err != nil {
+		return nil, fmt.Errorf("new encryptor: %s", err)
+	}
+
 	for _, dir := range []string{config.DownloadDir, config.CacheDir} {
 		if err := os.MkdirAll(dir, 0775); err != nil {
 			return nil, fmt.Errorf("mkdir %s: %s", dir, err)
@@ -61,32 +77,78 @@ func NewCADownloadStore(config CADownloadStoreConfig, stats tally.Scope) (*CADow
 		config.CacheCleanup,
 		backend.NewFileOp().AcceptState(cacheState))
 
-	return &CADownloadStore{
+	s := &CADownloadStore{
 		backend:       backend,
 		downloadState: downloadState,
 		cacheState:    cacheState,
 		cleanup:       cleanup,
-	}, nil
+		fsync:         fsync,
+		encrypt:       encrypt,
+		stopc:         make(chan struct{}),
+	}
+	go encrypt.rewrapKeys(s.Any().op, s.stopc)
+
+	return s, nil
 }
 
 // Close terminates all goroutines started by s.
 func (s *CADownloadStore) Close() {
 	s.cleanup.stop()
+	s.stopOnce.Do(func() { close(s.stopc) })
 }
 
 // CreateDownloadFile creates an empty download file initialized with length.
 func (s *CADownloadStore) CreateDownloadFile(name string, length int64) error {
-	return s.backend.NewFileOp().CreateFile(name, s.downloadState, length)
+	return s.CreateDownloadFileInNamespace("", name, length)
+}
+
+// CreateDownloadFileInNamespace creates an empty download file initialized with
+// length for a blob of namespace, which selects how the file is encrypted.
+func (s *CADownloadStore) CreateDownloadFileInNamespace(namespace, name string, length int64) error {
+	if err := s.backend.NewFileOp().CreateFile(name, s.downloadState, length); err != nil {
+		return err
+	}
+	if err := s.encrypt.initFile(s.Download().op, namespace, name); err != nil {
+		s.Download().DeleteFile(name)
+		return err
+	}
+	return nil
 }
 
 // GetDownloadFileReadWriter returns a FileReadWriter for name.
 func (s *CADownloadStore) GetDownloadFileReadWriter(name string) (FileReadWriter, error) {
-	return s.backend.NewFileOp().AcceptState(s.downloadState).GetFileReadWriter(name)
+	op := s.backend.NewFileOp().AcceptState(s.downloadState)
+	rw, err := op.GetFileReadWriter(name)
+	if err != nil {
+		return nil, err
+	}
+	return s.encrypt.wrapReadWriter(op, name, s.fsync.wrap(rw))
 }
 
 // MoveDownloadFileToCache moves a download file to the cache.
 func (s *CADownloadStore) MoveDownloadFileToCache(name string) error {
-	return s.backend.NewFileOp().AcceptState(s.downloadState).MoveFile(name, s.cacheState)
+	op := s.backend.NewFileOp().AcceptState(s.downloadState)
+	if s.fsync.policy != FsyncNever {
+		// Files which cannot be moved are left to MoveFile to report.
+		if path, err := op.GetFilePath(name); err == nil {
+			if err := s.fsync.beforeCommit(path); err != nil {
+				return fmt.Errorf("sync %s: %s", name, err)
+			}
+		}
+	}
+	if err := op.MoveFile(name, s.cacheState); err != nil {
+		return err
+	}
+	if s.fsync.policy != FsyncNever {
+		path, err := s.Cache().op.GetFilePath(name)
+		if err != nil {
+			return fmt.Errorf("get file path: %s", err)
+		}
+		if err := s.fsync.afterCommit(path); err != nil {
+			return fmt.Errorf("sync commit of %s: %s", name, err)
+		}
+	}
+	return nil
 }
 
 // GetCacheFileReader gets a cache file reader. Implemented for compatibility with
@@ -157,7 +219,11 @@ func (s *CADownloadStore) Any() *CADownloadStoreScope {
 
 // GetFileReader returns a reader for name.
 func (a *CADownloadStoreScope) GetFileReader(name string) (FileReader, error) {
-	return a.op.GetFileReader(name)
+	r, err := a.op.GetFileReader(name)
+	if err != nil {
+		return nil, err
+	}
+	return a.store.encrypt.wrapReader(a.op, name, r)
 }
 
 // GetFileStat returns file info for name.
@@ -19,6 +19,7 @@ import (
 	"io"
 	"os"
 	"path"
+	"sync"
 
 	"github.com/andres-erbsen/clock"
 	"github.com/docker/distribution/uuid"
@@ -36,6 +37,9 @@ type CAStore struct {
 	*uploadStore
 	*cacheStore
 	cleanup *cleanupManager
+
+	stopOnce sync.Once
+	stopc    chan struct{}
 }
 
 // NewCAStore creates a new CAStore.
@@ -46,13 +50,23 @@ func NewCAStore(config CAStoreConfig, stats tally.Scope) (*CAStore, error) {
 		"module": "castore",
 	})
 
-	uploadStore, err := newUploadStore(config.UploadDir)
+	fsync, err := newFsyncer(config.FsyncPolicy, stats)
+	if err != nil {
+		return nil, err
+	}
+
+	encrypt, err := newEncryptor(config.Encryption, stats)
+	if err != nil {
+		return nil, fmt.Errorf("new encryptor: %s", err)
+	}
+
+	uploadStore, err := newUploadStore(config.UploadDir, fsync, encrypt)
 	if err != nil {
 		return nil, fmt.Errorf("new upload store: %s", err)
 	}
 
 	cacheBackend := base.NewCASFileStoreWithLRUMap(config.Capacity, clock.New())
-	cacheStore, err := newCacheStore(config.CacheDir, cacheBackend)
+	cacheStore, err := newCacheStore(config.CacheDir, cacheBackend, encrypt)
 	if err != nil {
 		return nil, fmt.Errorf("new cache store: %s", err)
 	}
@@ -68,12 +82,22 @@ func NewCAStore(config CAStoreConfig, stats tally.Scope) (*CAStore, error) {
 	cleanup.addJob("upload", config.UploadCleanup, uploadStore.newFileOp())
 	cleanup.addJob("cache", config.CacheCleanup, cacheStore.newFileOp())
 
-	return &CAStore{config, uploadStore, cacheStore, cleanup}, nil
+	s := &CAStore{
+		config:      config,
+		uploadStore: uploadStore,
+		cacheStore:  cacheStore,
+		cleanup:     cleanup,
+		stopc:       make(chan struct{}),
+	}
+	go encrypt.rewrapKeys(cacheStore.newFileOp(), s.stopc)
+
+	return s, nil
 }
 
 // Close terminates any goroutines started by s.
 func (s *CAStore) Close() {
 	s.cleanup.stop()
+	s.stopOnce.Do(func() { close(s.stopc) })
 }
 
 // MoveUploadFileToCache commits uploadName as cacheName. Clients are expected
@@ -85,7 +109,7 @@ func (s *CAStore) MoveUploadFileToCache(uploadName, cacheName string) error {
 	}
 	defer s.DeleteUploadFile(uploadName)
 
-	f, err := s.uploadStore.newFileOp().GetFileReader(uploadName)
+	f, err := s.GetUploadFileReader(uploadName)
 	if err != nil {
 		return fmt.Errorf("get file reader %s: %s", uploadName, err)
 	}
@@ -94,7 +118,7 @@ func (s *CAStore) MoveUploadFileToCache(uploadName, cacheName string) error {
 		return fmt.Errorf("verify digest: %s", err)
 	}
 
-	return s.cacheStore.newFileOp().MoveFileFrom(cacheName, s.cacheStore.state, uploadPath)
+	return s.cacheStore.moveFileFrom(cacheName, uploadPath, s.uploadStore.fsync)
 }
 
 // CreateCacheFile initializes a cache file for name from r. name should be a raw
@@ -109,8 +133,15 @@ func (s *CAStore) CreateCacheFile(name string, r io.Reader) error {
 // WriteCacheFile initializes a cache file for name by passing a temporary
 // upload file writer to the write function.
 func (s *CAStore) WriteCacheFile(name string, write func(w FileReadWriter) error) error {
+	return s.WriteCacheFileInNamespace("", name, write)
+}
+
+// WriteCacheFileInNamespace is like WriteCacheFile, for a blob of namespace.
+func (s *CAStore) WriteCacheFileInNamespace(
+	namespace, name string, write func(w FileReadWriter) error) error {
+
 	tmp := fmt.Sprintf("%s.%s", name, uuid.Generate().String())
-	if err := s.CreateUploadFile(tmp, 0); err != nil {
+	if err := s.CreateUploadFileInNamespace(namespace, tmp, 0); err != nil {
 		return fmt.Errorf("create upload file: %s", err)
 	}
 	defer s.DeleteUploadFile(tmp)
@@ -133,13 +164,17 @@ func (s *CAStore) WriteCacheFile(name string, write func(w FileReadWriter) error
 // verify verifies that name is a valid SHA256 digest, and checks if the given
 // blob content matches the digset unless explicitly skipped.
 func (s *CAStore) verify(r io.Reader, name string) error {
+	return verifyDigest(r, name, s.config.SkipHashVerification)
+}
+
+func verifyDigest(r io.Reader, name string, skipHashVerification bool) error {
 	// Verify that expected name is a valid SHA256 digest.
 	expected, err := core.NewSHA256DigestFromHex(name)
 	if err != nil {
 		return fmt.Errorf("new digest from file name: %s", err)
 	}
 
-	if !s.config.SkipHashVerification {
+	if !skipHashVerification {
 		digester := core.NewDigester()
 		computed, err := digester.FromReader(r)
 		if err != nil {
@@ -26,18 +26,23 @@ import (
 type cacheStore struct {
 	state   base.FileState
 	backend base.FileStore
+	encrypt *encryptor
 }
 
-func newCacheStore(dir string, backend base.FileStore) (*cacheStore, error) {
+func newCacheStore(dir string, backend base.FileStore, encrypt *encryptor) (*cacheStore, error) {
 	if err := os.MkdirAll(dir, 0775); err != nil {
 		return nil, fmt.Errorf("mkdir: %s", err)
 	}
 	state := base.NewFileState(dir)
-	return &cacheStore{state, backend}, nil
+	return &cacheStore{state, backend, encrypt}, nil
 }
 
 func (s *cacheStore) GetCacheFileReader(name string) (FileReader, error) {
-	return s.newFileOp().GetFileReader(name)
+	r, err := s.newFileOp().GetFileReader(name)
+	if err != nil {
+		return nil, err
+	}
+	return s.encrypt.wrapReader(s.newFileOp(), name, r)
 }
 
 func (s *cacheStore) GetCacheFileStat(name string) (os.FileInfo, error) {
@@ -68,6 +73,25 @@ func (s *cacheStore) ListCacheFiles() ([]string, error) {
 	return s.newFileOp().ListNames()
 }
 
+// moveFileFrom commits the unmanaged file at sourcePath as name, flushing the
+// file and the commit as required by fsync.
+func (s *cacheStore) moveFileFrom(name, sourcePath string, fsync *fsyncer) error {
+	if err := fsync.beforeCommit(sourcePath); err != nil {
+		return fmt.Errorf("sync %s: %s", sourcePath, err)
+	}
+	if err := s.newFileOp().MoveFileFrom(name, s.state, sourcePath); err != nil {
+		return err
+	}
+	path, err := s.newFileOp().GetFilePath(name)
+	if err != nil {
+		return fmt.Errorf("get file path: %s", err)
+	}
+	if err := fsync.afterCommit(path); err != nil {
+		return fmt.Errorf("sync commit of %s: %s", name, err)
+	}
+	return nil
+}
+
 func (s *cacheStore) newFileOp() base.FileOp {
 	return s.backend.NewFileOp().AcceptState(s.state)
 }
@@ -31,6 +31,12 @@ type CAStoreConfig struct {
 	CacheCleanup  CleanupConfig `yaml:"cache_cleanup"`
 
 	SkipHashVerification bool `yaml:"skip_hash_verification"`
+
+	// FsyncPolicy defines when writes are flushed to stable storage. Defaults
+	// to never.
+	FsyncPolicy FsyncPolicy `yaml:"fsync_policy"`
+
+	Encryption EncryptionConfig `yaml:"encryption"`
 }
 
 func (c CAStoreConfig) applyDefaults() CAStoreConfig {
@@ -46,6 +52,10 @@ type SimpleStoreConfig struct {
 	CacheDir      string        `yaml:"cache_dir"`
 	UploadCleanup CleanupConfig `yaml:"upload_cleanup"`
 	CacheCleanup  CleanupConfig `yaml:"cache_cleanup"`
+
+	// FsyncPolicy defines when writes are flushed to stable storage. Defaults
+	// to never.
+	FsyncPolicy FsyncPolicy `yaml:"fsync_policy"`
 }
 
 // CADownloadStoreConfig defines CADownloadStore configuration.
@@ -55,4 +65,10 @@ type CADownloadStoreConfig struct {
 	CacheDir        string        `yaml:"cache_dir"`
 	DownloadCleanup CleanupConfig `yaml:"download_cleanup"`
 	CacheCleanup    CleanupConfig `yaml:"cache_cleanup"`
+
+	// FsyncPolicy defines when writes are flushed to stable storage. Defaults
+	// to never.
+	FsyncPolicy FsyncPolicy `yaml:"fsync_policy"`
+
+	Encryption EncryptionConfig `yaml:"encryption"`
 }
@@ -0,0 +1,81 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package store
+
+import (
+	"io"
+	"os"
+
+	"github.com/uber/kraken/lib/store/metadata"
+)
+
+// Driver defines the storage of content-addressable blobs which origins depend
+// on. Blobs are committed into the cache either directly (put), or by uploading
+// them piece by piece into upload files which are then moved into the cache.
+// Missing files are reported via errors satisfying os.IsNotExist, and conflicts
+// via errors satisfying os.IsExist.
+//
+// CAStore is the default, filesystem-backed Driver.
+type Driver interface {
+	// CreateCacheFile puts the contents of r into the cache as name. The
+	// contents must hash to name.
+	CreateCacheFile(name string, r io.Reader) error
+
+	// WriteCacheFile puts name into the cache by passing a temporary writer to
+	// write. The written contents must hash to name.
+	WriteCacheFile(name string, write func(w FileReadWriter) error) error
+
+	// WriteCacheFileInNamespace is like WriteCacheFile, for a blob of
+	// namespace.
+	WriteCacheFileInNamespace(namespace, name string, write func(w FileReadWriter) error) error
+
+	// GetCacheFileReader gets a reader of cached name, which supports reading
+	// pieces at arbitrary offsets.
+	GetCacheFileReader(name string) (FileReader, error)
+
+	// GetCacheFileStat stats cached name.
+	GetCacheFileStat(name string) (os.FileInfo, error)
+
+	// DeleteCacheFile deletes cached name and its metadata. Persisted files
+	// are not deleted, and base.ErrFilePersisted is returned.
+	DeleteCacheFile(name string) error
+
+	// ListCacheFiles lists the names of all cached files.
+	ListCacheFiles() ([]string, error)
+
+	GetCacheFileMetadata(name string, md metadata.Metadata) error
+	SetCacheFileMetadata(name string, md metadata.Metadata) (bool, error)
+	GetOrSetCacheFileMetadata(name string, md metadata.Metadata) error
+	DeleteCacheFileMetadata(name string, md metadata.Metadata) error
+
+	// CreateUploadFile creates an upload file of length bytes.
+	CreateUploadFile(name string, length int64) error
+
+	// CreateUploadFileInNamespace is like CreateUploadFile, for a blob of
+	// namespace.
+	CreateUploadFileInNamespace(namespace, name string, length int64) error
+
+	// GetUploadFileReadWriter gets a read-writer of upload file name, which
+	// supports writing pieces at arbitrary offsets.
+	GetUploadFileReadWriter(name string) (FileReadWriter, error)
+
+	// MoveUploadFileToCache verifies that the contents of upload file
+	// uploadName hash to cacheName, and commits it into the cache as cacheName.
+	MoveUploadFileToCache(uploadName, cacheName string) error
+
+	// DeleteUploadFile deletes upload file name.
+	DeleteUploadFile(name string) error
+}
+
+var _ Driver = (*CAStore)(nil)
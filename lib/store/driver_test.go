@@ -0,0 +1,290 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package store
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/store/base"
+	"github.com/uber/kraken/lib/store/metadata"
+
+	"github.com/stretchr/testify/require"
+)
+
+// driverFactories are the Drivers under test by the conformance suite.
+var driverFactories = []struct {
+	name   string
+	create func() (Driver, func())
+}{
+	{"filesystem", func() (Driver, func()) { return CAStoreFixture() }},
+	{"memory", func() (Driver, func()) { return NewMemoryDriver(), func() {} }},
+}
+
+func testDrivers(t *testing.T, f func(t *testing.T, d Driver)) {
+	for _, factory := range driverFactories {
+		t.Run(factory.name, func(t *testing.T) {
+			d, cleanup := factory.create()
+			defer cleanup()
+			f(t, d)
+		})
+	}
+}
+
+func TestDriverPutGetStatList(t *testing.T) {
+	testDrivers(t, func(t *testing.T, d Driver) {
+		require := require.New(t)
+
+		blob := core.SizedBlobFixture(64, 8)
+		require.NoError(d.CreateCacheFile(blob.Digest.Hex(), bytes.NewReader(blob.Content)))
+
+		// Putting an existing blob is a no-op.
+		require.NoError(d.CreateCacheFile(blob.Digest.Hex(), bytes.NewReader(blob.Content)))
+
+		info, err := d.GetCacheFileStat(blob.Digest.Hex())
+		require.NoError(err)
+		require.Equal(int64(len(blob.Content)), info.Size())
+
+		r, err := d.GetCacheFileReader(blob.Digest.Hex())
+		require.NoError(err)
+		defer r.Close()
+		require.Equal(int64(len(blob.Content)), r.Size())
+		result, err := ioutil.ReadAll(r)
+		require.NoError(err)
+		require.Equal(blob.Content, result)
+
+		piece := make([]byte, 8)
+		_, err = r.ReadAt(piece, 16)
+		require.NoError(err)
+		require.Equal(blob.Content[16:24], piece)
+
+		names, err := d.ListCacheFiles()
+		require.NoError(err)
+		require.Equal([]string{blob.Digest.Hex()}, names)
+	})
+}
+
+func TestDriverPutRejectsDigestMismatch(t *testing.T) {
+	testDrivers(t, func(t *testing.T, d Driver) {
+		require := require.New(t)
+
+		blob := core.SizedBlobFixture(64, 8)
+		require.Error(d.CreateCacheFile(blob.Digest.Hex(), bytes.NewReader([]byte("corrupt"))))
+
+		_, err := d.GetCacheFileStat(blob.Digest.Hex())
+		require.True(os.IsNotExist(err))
+	})
+}
+
+func TestDriverMissingFiles(t *testing.T) {
+	testDrivers(t, func(t *testing.T, d Driver) {
+		require := require.New(t)
+
+		name := core.DigestFixture().Hex()
+
+		_, err := d.GetCacheFileStat(name)
+		require.True(os.IsNotExist(err))
+
+		_, err = d.GetCacheFileReader(name)
+		require.True(os.IsNotExist(err))
+
+		require.True(os.IsNotExist(d.DeleteCacheFile(name)))
+
+		require.True(os.IsNotExist(d.GetCacheFileMetadata(name, metadata.NewPersist(true))))
+
+		_, err = d.GetUploadFileReadWriter(name)
+		require.True(os.IsNotExist(err))
+
+		require.True(os.IsNotExist(d.MoveUploadFileToCache(name, name)))
+	})
+}
+
+func TestDriverDelete(t *testing.T) {
+	testDrivers(t, func(t *testing.T, d Driver) {
+		require := require.New(t)
+
+		blob := core.SizedBlobFixture(64, 8)
+		require.NoError(d.CreateCacheFile(blob.Digest.Hex(), bytes.NewReader(blob.Content)))
+		require.NoError(d.DeleteCacheFile(blob.Digest.Hex()))
+
+		_, err := d.GetCacheFileStat(blob.Digest.Hex())
+		require.True(os.IsNotExist(err))
+
+		names, err := d.ListCacheFiles()
+		require.NoError(err)
+		require.Empty(names)
+	})
+}
+
+func TestDriverDeletePersistedFile(t *testing.T) {
+	testDrivers(t, func(t *testing.T, d Driver) {
+		require := require.New(t)
+
+		blob := core.SizedBlobFixture(64, 8)
+		require.NoError(d.CreateCacheFile(blob.Digest.Hex(), bytes.NewReader(blob.Content)))
+		_, err := d.SetCacheFileMetadata(blob.Digest.Hex(), metadata.NewPersist(true))
+		require.NoError(err)
+
+		require.Equal(base.ErrFilePersisted, d.DeleteCacheFile(blob.Digest.Hex()))
+
+		_, err = d.SetCacheFileMetadata(blob.Digest.Hex(), metadata.NewPersist(false))
+		require.NoError(err)
+		require.NoError(d.DeleteCacheFile(blob.Digest.Hex()))
+	})
+}
+
+func TestDriverMetadata(t *testing.T) {
+	testDrivers(t, func(t *testing.T, d Driver) {
+		require := require.New(t)
+
+		blob := core.SizedBlobFixture(64, 8)
+		name := blob.Digest.Hex()
+		require.NoError(d.CreateCacheFile(name, bytes.NewReader(blob.Content)))
+
+		var p metadata.Persist
+		require.True(os.IsNotExist(d.GetCacheFileMetadata(name, &p)))
+
+		updated, err := d.SetCacheFileMetadata(name, metadata.NewPersist(true))
+		require.NoError(err)
+		require.True(updated)
+
+		updated, err = d.SetCacheFileMetadata(name, metadata.NewPersist(true))
+		require.NoError(err)
+		require.False(updated)
+
+		require.NoError(d.GetCacheFileMetadata(name, &p))
+		require.True(p.Value)
+
+		// GetOrSet loads existing metadata instead of overwriting it.
+		existing := metadata.NewPersist(false)
+		require.NoError(d.GetOrSetCacheFileMetadata(name, existing))
+		require.True(existing.Value)
+
+		require.NoError(d.DeleteCacheFileMetadata(name, &p))
+		require.True(os.IsNotExist(d.GetCacheFileMetadata(name, &p)))
+
+		// Deleting missing metadata is a no-op.
+		require.NoError(d.DeleteCacheFileMetadata(name, &p))
+
+		require.NoError(d.GetOrSetCacheFileMetadata(name, metadata.NewPersist(false)))
+		require.NoError(d.GetCacheFileMetadata(name, &p))
+		require.False(p.Value)
+	})
+}
+
+func TestDriverUploadPiecesOutOfOrder(t *testing.T) {
+	testDrivers(t, func(t *testing.T, d Driver) {
+		require := require.New(t)
+
+		blob := core.SizedBlobFixture(64, 8)
+		uid := "upload"
+		require.NoError(d.CreateUploadFile(uid, 0))
+
+		w, err := d.GetUploadFileReadWriter(uid)
+		require.NoError(err)
+		for _, offset := range []int64{32, 0, 48, 16} {
+			_, err := w.WriteAt(blob.Content[offset:offset+16], offset)
+			require.NoError(err)
+		}
+		require.Equal(int64(len(blob.Content)), w.Size())
+
+		piece := make([]byte, 16)
+		_, err = w.ReadAt(piece, 16)
+		require.NoError(err)
+		require.Equal(blob.Content[16:32], piece)
+		require.NoError(w.Close())
+
+		require.NoError(d.MoveUploadFileToCache(uid, blob.Digest.Hex()))
+
+		_, err = d.GetUploadFileReadWriter(uid)
+		require.True(os.IsNotExist(err))
+
+		r, err := d.GetCacheFileReader(blob.Digest.Hex())
+		require.NoError(err)
+		defer r.Close()
+		result, err := ioutil.ReadAll(r)
+		require.NoError(err)
+		require.Equal(blob.Content, result)
+	})
+}
+
+func TestDriverUploadSequentialWrites(t *testing.T) {
+	testDrivers(t, func(t *testing.T, d Driver) {
+		require := require.New(t)
+
+		blob := core.SizedBlobFixture(64, 8)
+		uid := "upload"
+		require.NoError(d.CreateUploadFile(uid, 0))
+
+		w, err := d.GetUploadFileReadWriter(uid)
+		require.NoError(err)
+		_, err = w.Seek(32, 0)
+		require.NoError(err)
+		_, err = w.Write(blob.Content[32:])
+		require.NoError(err)
+		_, err = w.Seek(0, 0)
+		require.NoError(err)
+		_, err = w.Write(blob.Content[:32])
+		require.NoError(err)
+		require.NoError(w.Close())
+
+		require.NoError(d.MoveUploadFileToCache(uid, blob.Digest.Hex()))
+
+		info, err := d.GetCacheFileStat(blob.Digest.Hex())
+		require.NoError(err)
+		require.Equal(int64(len(blob.Content)), info.Size())
+	})
+}
+
+func TestDriverMoveUploadFileToExistingCacheFile(t *testing.T) {
+	testDrivers(t, func(t *testing.T, d Driver) {
+		require := require.New(t)
+
+		blob := core.SizedBlobFixture(64, 8)
+		require.NoError(d.CreateCacheFile(blob.Digest.Hex(), bytes.NewReader(blob.Content)))
+
+		uid := "upload"
+		require.NoError(d.CreateUploadFile(uid, 0))
+		w, err := d.GetUploadFileReadWriter(uid)
+		require.NoError(err)
+		_, err = w.Write(blob.Content)
+		require.NoError(err)
+		require.NoError(w.Close())
+
+		require.True(os.IsExist(d.MoveUploadFileToCache(uid, blob.Digest.Hex())))
+	})
+}
+
+func TestDriverMoveUploadFileRejectsDigestMismatch(t *testing.T) {
+	testDrivers(t, func(t *testing.T, d Driver) {
+		require := require.New(t)
+
+		blob := core.SizedBlobFixture(64, 8)
+		uid := "upload"
+		require.NoError(d.CreateUploadFile(uid, 0))
+		w, err := d.GetUploadFileReadWriter(uid)
+		require.NoError(err)
+		_, err = w.Write([]byte("corrupt"))
+		require.NoError(err)
+		require.NoError(w.Close())
+
+		require.Error(d.MoveUploadFileToCache(uid, blob.Digest.Hex()))
+
+		_, err = d.GetCacheFileStat(blob.Digest.Hex())
+		require.True(os.IsNotExist(err))
+	})
+}
@@ -0,0 +1,577 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package store
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/uber-go/tally"
+	"github.com/uber/kraken/lib/store/base"
+	"github.com/uber/kraken/lib/store/metadata"
+	"github.com/uber/kraken/utils/log"
+)
+
+// EncryptionConfig defines envelope encryption of store files at rest.
+//
+// Every file is encrypted with its own random data key, which is stored next
+// to the file wrapped by a key encryption key (KEK). The KEK is selected by the
+// namespace the file is created for. Readers transparently decrypt, so served
+// and seeded content still matches its digest. Rotating a KEK only re-wraps
+// data keys and never re-encrypts file content.
+//
+// Content is sealed with AES-GCM in fixed-size chunks, such that pieces can be
+// written and read at any offset. Every write of a chunk seals it under a
+// fresh nonce, so rewritten chunks never reuse a keystream, and chunks which
+// were modified on disk fail to read.
+type EncryptionConfig struct {
+	Enabled bool `yaml:"enabled"`
+
+	// Keys maps key IDs to files containing hex-encoded 256-bit KEKs. Keys
+	// which no longer wrap any data key may be removed once rotated out.
+	Keys map[string]string `yaml:"keys"`
+
+	// ActiveKey is the ID of the KEK which wraps data keys of new files of
+	// namespaces which no entry of Namespaces matches, and of files created
+	// without a namespace. If empty, such files are not encrypted.
+	ActiveKey string `yaml:"active_key"`
+
+	// Namespaces selects KEKs by namespace. The first entry which matches the
+	// namespace of a new file applies.
+	Namespaces []NamespaceEncryptionConfig `yaml:"namespaces"`
+}
+
+// NamespaceEncryptionConfig selects the KEK of files created for namespaces
+// matching a regular expression.
+type NamespaceEncryptionConfig struct {
+	Namespace string `yaml:"namespace"`
+
+	// ActiveKey is the ID of the KEK which wraps data keys of new files of the
+	// namespace. Data keys of files of the namespace wrapped by any other KEK
+	// are re-wrapped by ActiveKey on startup. If empty, new files of the
+	// namespace are not encrypted.
+	ActiveKey string `yaml:"active_key"`
+}
+
+const (
+	_dataKeySize = 32
+	_kekSize     = 32
+
+	// _chunkSize is the size of the chunks new files are sealed in. Writes
+	// which cover chunks partially re-seal them whole, so chunks are kept
+	// close to the size of typical writes.
+	_chunkSize = 64 * 1024
+
+	// _sealSize is the size of the seal of a chunk: a 12 byte nonce, a 16 byte
+	// authentication tag and the 4 byte length of the sealed content. Chunks
+	// with a zero length were never written.
+	_sealSize = 32
+
+	// _chunkLocks is the number of locks which serialize access to chunks.
+	_chunkLocks = 256
+)
+
+var (
+	// errEncryptionDisabled is returned when reading an encrypted file from a
+	// store with encryption disabled, instead of serving the ciphertext.
+	errEncryptionDisabled = errors.New("file is encrypted but encryption is disabled")
+
+	// errChunkCorrupt is returned when reading a chunk whose content or seal
+	// does not authenticate.
+	errChunkCorrupt = errors.New("encrypted chunk failed authentication")
+)
+
+// namespaceKey is the KEK of files of namespaces matching regexp.
+type namespaceKey struct {
+	regexp *regexp.Regexp
+	key    string
+}
+
+// encryptor applies an EncryptionConfig to store files. A nil encryptor
+// leaves new files in plaintext.
+type encryptor struct {
+	active     string
+	namespaces []namespaceKey
+	keks       map[string]cipher.AEAD
+	chunkSize  int64
+	locks      [_chunkLocks]sync.Mutex
+	rewrapped  tally.Counter
+	errors     tally.Counter
+}
+
+func newEncryptor(config EncryptionConfig, stats tally.Scope) (*encryptor, error) {
+	if !config.Enabled {
+		return nil, nil
+	}
+	if config.ActiveKey != "" {
+		if _, ok := config.Keys[config.ActiveKey]; !ok {
+			return nil, fmt.Errorf("active key %q not configured", config.ActiveKey)
+		}
+	}
+	var namespaces []namespaceKey
+	for _, ns := range config.Namespaces {
+		re, err := regexp.Compile(ns.Namespace)
+		if err != nil {
+			return nil, fmt.Errorf("namespace %s: %s", ns.Namespace, err)
+		}
+		if ns.ActiveKey != "" {
+			if _, ok := config.Keys[ns.ActiveKey]; !ok {
+				return nil, fmt.Errorf(
+					"active key %q of namespace %s not configured", ns.ActiveKey, ns.Namespace)
+			}
+		}
+		namespaces = append(namespaces, namespaceKey{re, ns.ActiveKey})
+	}
+	keks := make(map[string]cipher.AEAD)
+	for id, path := range config.Keys {
+		aead, err := loadKEK(path)
+		if err != nil {
+			return nil, fmt.Errorf("load key %s: %s", id, err)
+		}
+		keks[id] = aead
+	}
+	stats = stats.SubScope("encryption")
+	return &encryptor{
+		active:     config.ActiveKey,
+		namespaces: namespaces,
+		keks:       keks,
+		chunkSize:  _chunkSize,
+		rewrapped:  stats.Counter("rewrapped"),
+		errors:     stats.Counter("rewrap_errors"),
+	}, nil
+}
+
+func loadKEK(path string) (cipher.AEAD, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	key, err := hex.DecodeString(strings.TrimSpace(string(b)))
+	if err != nil {
+		return nil, fmt.Errorf("decode hex: %s", err)
+	}
+	if len(key) != _kekSize {
+		return nil, fmt.Errorf("expected %d byte key, got %d", _kekSize, len(key))
+	}
+	return newGCM(key)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// activeKey returns the ID of the KEK which wraps data keys of new files of
+// namespace, or "" if they are not encrypted.
+func (e *encryptor) activeKey(namespace string) string {
+	if namespace != "" {
+		for _, ns := range e.namespaces {
+			if ns.regexp.MatchString(namespace) {
+				return ns.key
+			}
+		}
+	}
+	return e.active
+}
+
+// wrapKey seals dataKey with KEK id, bound to id.
+func (e *encryptor) wrapKey(id string, dataKey []byte) ([]byte, error) {
+	aead := e.keks[id]
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("nonce: %s", err)
+	}
+	return aead.Seal(nonce, nonce, dataKey, []byte(id)), nil
+}
+
+func (e *encryptor) unwrapKey(md *metadata.Encryption) ([]byte, error) {
+	aead, ok := e.keks[md.KeyID]
+	if !ok {
+		return nil, fmt.Errorf("unknown key %q", md.KeyID)
+	}
+	if len(md.WrappedKey) < aead.NonceSize() {
+		return nil, errors.New("wrapped key too short")
+	}
+	nonce, sealed := md.WrappedKey[:aead.NonceSize()], md.WrappedKey[aead.NonceSize():]
+	dataKey, err := aead.Open(nil, nonce, sealed, []byte(md.KeyID))
+	if err != nil {
+		return nil, fmt.Errorf("unwrap key: %s", err)
+	}
+	return dataKey, nil
+}
+
+// initFile generates and stores a data key for the newly created file name of
+// namespace, which must still be empty. No-op if e is nil or files of namespace
+// are not encrypted.
+func (e *encryptor) initFile(op base.FileOp, namespace, name string) error {
+	if e == nil {
+		return nil
+	}
+	id := e.activeKey(namespace)
+	if id == "" {
+		return nil
+	}
+	dataKey := make([]byte, _dataKeySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return fmt.Errorf("data key: %s", err)
+	}
+	wrapped, err := e.wrapKey(id, dataKey)
+	if err != nil {
+		return err
+	}
+	if _, err := op.SetFileMetadata(name, &metadata.Seals{}); err != nil {
+		return fmt.Errorf("set seals metadata: %s", err)
+	}
+	md := metadata.NewEncryption(id, namespace, wrapped, e.chunkSize)
+	if _, err := op.SetFileMetadata(name, md); err != nil {
+		return fmt.Errorf("set encryption metadata: %s", err)
+	}
+	return nil
+}
+
+// cipherFor returns the chunkCipher of name, or nil if name is plaintext.
+func (e *encryptor) cipherFor(op base.FileOp, name string) (*chunkCipher, error) {
+	var md metadata.Encryption
+	if err := op.GetFileMetadata(name, &md); err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("get encryption metadata: %s", err)
+	}
+	if e == nil {
+		return nil, errEncryptionDisabled
+	}
+	if md.ChunkSize <= 0 {
+		return nil, fmt.Errorf("invalid chunk size %d", md.ChunkSize)
+	}
+	dataKey, err := e.unwrapKey(&md)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newGCM(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	return &chunkCipher{e, op, name, aead, md.ChunkSize}, nil
+}
+
+// wrapReader returns a FileReader which decrypts r, if name is encrypted. Closes
+// r on error.
+func (e *encryptor) wrapReader(op base.FileOp, name string, r FileReader) (FileReader, error) {
+	c, err := e.cipherFor(op, name)
+	if err != nil {
+		r.Close()
+		return nil, err
+	}
+	if c == nil {
+		return r, nil
+	}
+	return &cipherReader{r, c}, nil
+}
+
+// wrapReadWriter returns a FileReadWriter which decrypts reads from and
+// encrypts writes to rw, if name is encrypted. Closes rw on error.
+func (e *encryptor) wrapReadWriter(
+	op base.FileOp, name string, rw FileReadWriter) (FileReadWriter, error) {
+
+	c, err := e.cipherFor(op, name)
+	if err != nil {
+		rw.Close()
+		return nil, err
+	}
+	if c == nil {
+		return rw, nil
+	}
+	return &cipherReadWriter{rw, &cipherReader{rw, c}}, nil
+}
+
+// lock locks chunk i of name, and returns a function which unlocks it.
+func (e *encryptor) lock(name string, i int64) func() {
+	h := fnv.New32a()
+	io.WriteString(h, name)
+	binary.Write(h, binary.BigEndian, i)
+	l := &e.locks[h.Sum32()%_chunkLocks]
+	l.Lock()
+	return l.Unlock
+}
+
+// rewrapKeys re-wraps data keys of all files in op which are not wrapped by the
+// active KEK of their namespace. Stops early once stop is closed. No-op if e is
+// nil.
+func (e *encryptor) rewrapKeys(op base.FileOp, stop <-chan struct{}) {
+	if e == nil {
+		return
+	}
+	names, err := op.ListNames()
+	if err != nil {
+		log.Errorf("Error listing files to re-wrap data keys: %s", err)
+		return
+	}
+	for _, name := range names {
+		select {
+		case <-stop:
+			return
+		default:
+		}
+		if err := e.rewrapFile(op, name); err != nil {
+			log.With("name", name).Errorf("Error re-wrapping data key: %s", err)
+			e.errors.Inc(1)
+		}
+	}
+}
+
+func (e *encryptor) rewrapFile(op base.FileOp, name string) error {
+	var md metadata.Encryption
+	if err := op.GetFileMetadata(name, &md); err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	// Files of namespaces which are no longer encrypted keep their KEK, since
+	// their content stays encrypted.
+	id := e.activeKey(md.Namespace)
+	if id == "" || md.KeyID == id {
+		return nil
+	}
+	dataKey, err := e.unwrapKey(&md)
+	if err != nil {
+		return err
+	}
+	wrapped, err := e.wrapKey(id, dataKey)
+	if err != nil {
+		return err
+	}
+	rewrapped := metadata.NewEncryption(id, md.Namespace, wrapped, md.ChunkSize)
+	if _, err := op.SetFileMetadata(name, rewrapped); err != nil {
+		return err
+	}
+	e.rewrapped.Inc(1)
+	return nil
+}
+
+// chunkCipher seals and opens the chunks of an encrypted file. Ciphertext is
+// stored at the offsets of the plaintext, and seals are stored as metadata, so
+// file sizes are unchanged.
+type chunkCipher struct {
+	e         *encryptor
+	op        base.FileOp
+	name      string
+	aead      cipher.AEAD
+	chunkSize int64
+}
+
+// chunkAD binds the seal of chunk i to its position in the file.
+func chunkAD(i int64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, uint64(i))
+	return b
+}
+
+// open returns the content of chunk i from r, which is empty if the chunk was
+// never written, and the length of the sealed content. The chunk must be
+// locked.
+func (c *chunkCipher) open(r io.ReaderAt, i int64) ([]byte, int64, error) {
+	seal := make([]byte, _sealSize)
+	_, err := c.op.GetFileMetadataAt(c.name, &metadata.Seals{}, seal, i*_sealSize)
+	if err != nil && err != io.EOF {
+		return nil, 0, fmt.Errorf("get seal: %s", err)
+	}
+	n := int64(binary.BigEndian.Uint32(seal[28:]))
+	if n == 0 {
+		return nil, 0, nil
+	}
+	if n > c.chunkSize {
+		return nil, n, errChunkCorrupt
+	}
+	b := make([]byte, n, n+16)
+	if _, err := r.ReadAt(b, i*c.chunkSize); err != nil && err != io.EOF {
+		return nil, n, err
+	}
+	b = append(b, seal[12:28]...)
+	plaintext, err := c.aead.Open(b[:0], seal[:12], b, chunkAD(i))
+	if err != nil {
+		return nil, n, errChunkCorrupt
+	}
+	return plaintext, n, nil
+}
+
+// seal encrypts plaintext as the content of chunk i into w under a fresh
+// nonce. The chunk must be locked.
+func (c *chunkCipher) seal(w io.WriterAt, i int64, plaintext []byte) error {
+	seal := make([]byte, _sealSize)
+	if _, err := rand.Read(seal[:12]); err != nil {
+		return fmt.Errorf("nonce: %s", err)
+	}
+	b := c.aead.Seal(nil, seal[:12], plaintext, chunkAD(i))
+	n := len(plaintext)
+	copy(seal[12:28], b[n:])
+	binary.BigEndian.PutUint32(seal[28:], uint32(n))
+	if _, err := w.WriteAt(b[:n], i*c.chunkSize); err != nil {
+		return err
+	}
+	if _, err := c.op.SetFileMetadataAt(c.name, &metadata.Seals{}, seal, i*_sealSize); err != nil {
+		return fmt.Errorf("set seal: %s", err)
+	}
+	return nil
+}
+
+// readAt decrypts len(p) bytes of r starting at offset into p. Bytes of chunks
+// which were never written read as zeros.
+func (c *chunkCipher) readAt(r FileReader, p []byte, offset int64) (int, error) {
+	size := r.Size()
+	if offset >= size {
+		return 0, io.EOF
+	}
+	end := offset + int64(len(p))
+	if end > size {
+		end = size
+	}
+	for i := offset / c.chunkSize; i*c.chunkSize < end; i++ {
+		unlock := c.e.lock(c.name, i)
+		plaintext, _, err := c.open(r, i)
+		unlock()
+		if err != nil {
+			return 0, fmt.Errorf("chunk %d: %s", i, err)
+		}
+		start := i * c.chunkSize
+		from, to := max64(offset, start), min64(end, start+c.chunkSize)
+		dst := p[from-offset : to-offset]
+		m := copy(dst, plaintext[min64(from-start, int64(len(plaintext))):])
+		for j := m; j < len(dst); j++ {
+			dst[j] = 0
+		}
+	}
+	n := int(end - offset)
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// writeAt encrypts p into rw starting at offset. Chunks which p covers only
+// partially are decrypted, updated and sealed again.
+func (c *chunkCipher) writeAt(rw FileReadWriter, p []byte, offset int64) (int, error) {
+	end := offset + int64(len(p))
+	for i := offset / c.chunkSize; i*c.chunkSize < end; i++ {
+		start := i * c.chunkSize
+		from, to := max64(offset, start), min64(end, start+c.chunkSize)
+		if err := c.writeChunk(rw, i, p[from-offset:to-offset], from-start); err != nil {
+			return int(from - offset), fmt.Errorf("chunk %d: %s", i, err)
+		}
+	}
+	return len(p), nil
+}
+
+// writeChunk writes b at offset within chunk i.
+func (c *chunkCipher) writeChunk(rw FileReadWriter, i int64, b []byte, offset int64) error {
+	defer c.e.lock(c.name, i)()
+
+	plaintext, n, err := c.open(rw, i)
+	if err == errChunkCorrupt && offset == 0 && int64(len(b)) >= n {
+		// A chunk which was left inconsistent by an interrupted write can
+		// still be overwritten whole.
+		plaintext, err = nil, nil
+	}
+	if err != nil {
+		return err
+	}
+	if end := offset + int64(len(b)); end > int64(len(plaintext)) {
+		plaintext = append(plaintext, make([]byte, end-int64(len(plaintext)))...)
+	}
+	copy(plaintext[offset:], b)
+	return c.seal(rw, i, plaintext)
+}
+
+func min64(a, b int64) int64 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func max64(a, b int64) int64 {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// cipherReader decrypts reads from an encrypted FileReader.
+type cipherReader struct {
+	FileReader
+	c *chunkCipher
+}
+
+func (r *cipherReader) Read(p []byte) (int, error) {
+	offset, err := r.FileReader.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0, err
+	}
+	n, err := r.c.readAt(r.FileReader, p, offset)
+	if _, serr := r.FileReader.Seek(offset+int64(n), io.SeekStart); serr != nil && err == nil {
+		err = serr
+	}
+	return n, err
+}
+
+func (r *cipherReader) ReadAt(p []byte, offset int64) (int, error) {
+	return r.c.readAt(r.FileReader, p, offset)
+}
+
+// cipherReadWriter encrypts writes to and decrypts reads from an encrypted
+// FileReadWriter.
+type cipherReadWriter struct {
+	FileReadWriter
+	r *cipherReader
+}
+
+func (rw *cipherReadWriter) Read(p []byte) (int, error) {
+	return rw.r.Read(p)
+}
+
+func (rw *cipherReadWriter) ReadAt(p []byte, offset int64) (int, error) {
+	return rw.r.ReadAt(p, offset)
+}
+
+func (rw *cipherReadWriter) Write(p []byte) (int, error) {
+	offset, err := rw.FileReadWriter.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0, err
+	}
+	n, err := rw.r.c.writeAt(rw.FileReadWriter, p, offset)
+	if _, serr := rw.FileReadWriter.Seek(offset+int64(n), io.SeekStart); serr != nil && err == nil {
+		err = serr
+	}
+	return n, err
+}
+
+func (rw *cipherReadWriter) WriteAt(p []byte, offset int64) (int, error) {
+	return rw.r.c.writeAt(rw.FileReadWriter, p, offset)
+}
@@ -0,0 +1,438 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package store
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/uber-go/tally"
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/store/metadata"
+	"github.com/uber/kraken/utils/randutil"
+	"github.com/uber/kraken/utils/testutil"
+)
+
+// writeKeys writes a random KEK file for each id under dir.
+func writeKeys(t *testing.T, dir string, ids ...string) map[string]string {
+	keys := make(map[string]string)
+	for _, id := range ids {
+		b := make([]byte, _kekSize)
+		_, err := rand.Read(b)
+		require.NoError(t, err)
+		path := filepath.Join(dir, id)
+		require.NoError(t, ioutil.WriteFile(path, []byte(hex.EncodeToString(b)+"\n"), 0600))
+		keys[id] = path
+	}
+	return keys
+}
+
+func encryptedCAStoreConfigFixture(t *testing.T) (CAStoreConfig, func()) {
+	cleanup := &testutil.Cleanup{}
+	config, c := CAStoreConfigFixture()
+	cleanup.Add(c)
+	config.Encryption = EncryptionConfig{
+		Enabled:   true,
+		Keys:      writeKeys(t, tempdir(cleanup, "keys"), "k1", "k2"),
+		ActiveKey: "k1",
+	}
+	return config, cleanup.Run
+}
+
+func readRawCacheFile(t *testing.T, s *cacheStore, name string) []byte {
+	path, err := s.newFileOp().GetFilePath(name)
+	require.NoError(t, err)
+	b, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	return b
+}
+
+func readCacheFile(t *testing.T, s *CAStore, name string) []byte {
+	r, err := s.GetCacheFileReader(name)
+	require.NoError(t, err)
+	defer r.Close()
+	b, err := ioutil.ReadAll(r)
+	require.NoError(t, err)
+	return b
+}
+
+func TestCAStoreEncryptsFilesAtRest(t *testing.T) {
+	require := require.New(t)
+
+	config, cleanup := encryptedCAStoreConfigFixture(t)
+	defer cleanup()
+
+	s, err := NewCAStore(config, tally.NoopScope)
+	require.NoError(err)
+	defer s.Close()
+
+	blob := core.SizedBlobFixture(4096, 1)
+
+	// Committing to the cache verifies the digest of the decrypted content.
+	require.NoError(s.CreateCacheFile(blob.Digest.Hex(), bytes.NewReader(blob.Content)))
+
+	raw := readRawCacheFile(t, s.cacheStore, blob.Digest.Hex())
+	require.Len(raw, len(blob.Content))
+	require.NotEqual(blob.Content, raw)
+	require.False(bytes.Contains(raw, blob.Content[:64]))
+
+	require.Equal(blob.Content, readCacheFile(t, s, blob.Digest.Hex()))
+
+	r, err := s.GetCacheFileReader(blob.Digest.Hex())
+	require.NoError(err)
+	defer r.Close()
+	d, err := core.NewDigester().FromReader(r)
+	require.NoError(err)
+	require.Equal(blob.Digest, d)
+
+	b := make([]byte, 100)
+	_, err = r.ReadAt(b, 1003)
+	require.NoError(err)
+	require.Equal(blob.Content[1003:1103], b)
+}
+
+func TestCAStoreEncryptionRejectsCorruptCiphertext(t *testing.T) {
+	require := require.New(t)
+
+	config, cleanup := encryptedCAStoreConfigFixture(t)
+	defer cleanup()
+
+	s, err := NewCAStore(config, tally.NoopScope)
+	require.NoError(err)
+	defer s.Close()
+
+	blob := core.SizedBlobFixture(256, 1)
+
+	// Content written behind the store's back is not encrypted, and thus fails
+	// verification after decryption.
+	require.NoError(s.CreateUploadFile("u", 0))
+	path, err := s.uploadStore.newFileOp().GetFilePath("u")
+	require.NoError(err)
+	require.NoError(ioutil.WriteFile(path, blob.Content, 0600))
+
+	require.Error(s.MoveUploadFileToCache("u", blob.Digest.Hex()))
+}
+
+func TestCAStoreEncryptionRejectsTamperedChunks(t *testing.T) {
+	require := require.New(t)
+
+	config, cleanup := encryptedCAStoreConfigFixture(t)
+	defer cleanup()
+
+	s, err := NewCAStore(config, tally.NoopScope)
+	require.NoError(err)
+	defer s.Close()
+	s.cacheStore.encrypt.chunkSize = 1024
+
+	blob := core.SizedBlobFixture(4096, 1)
+	require.NoError(s.CreateCacheFile(blob.Digest.Hex(), bytes.NewReader(blob.Content)))
+
+	path, err := s.cacheStore.newFileOp().GetFilePath(blob.Digest.Hex())
+	require.NoError(err)
+	raw := readRawCacheFile(t, s.cacheStore, blob.Digest.Hex())
+	raw[2500] ^= 1
+	require.NoError(ioutil.WriteFile(path, raw, 0600))
+
+	r, err := s.GetCacheFileReader(blob.Digest.Hex())
+	require.NoError(err)
+	defer r.Close()
+
+	// Chunks other than the tampered one still read.
+	b := make([]byte, 1024)
+	_, err = r.ReadAt(b, 1024)
+	require.NoError(err)
+	require.Equal(blob.Content[1024:2048], b)
+
+	_, err = r.ReadAt(b, 2048)
+	require.Error(err)
+}
+
+func TestCAStoreEncryptionSelectsKeysByNamespace(t *testing.T) {
+	require := require.New(t)
+
+	config, cleanup := encryptedCAStoreConfigFixture(t)
+	defer cleanup()
+
+	config.Encryption.Namespaces = []NamespaceEncryptionConfig{
+		{Namespace: "secret/.*", ActiveKey: "k2"},
+		{Namespace: "public/.*"},
+	}
+
+	s, err := NewCAStore(config, tally.NoopScope)
+	require.NoError(err)
+	defer s.Close()
+
+	for _, test := range []struct {
+		namespace string
+		key       string
+	}{
+		{"secret/repo", "k2"},
+		{"other/repo", "k1"},
+		{"", "k1"},
+		{"public/repo", ""},
+	} {
+		blob := core.SizedBlobFixture(256, 1)
+		require.NoError(s.WriteCacheFileInNamespace(test.namespace, blob.Digest.Hex(),
+			func(w FileReadWriter) error {
+				_, err := w.Write(blob.Content)
+				return err
+			}))
+
+		raw := readRawCacheFile(t, s.cacheStore, blob.Digest.Hex())
+		var md metadata.Encryption
+		err := s.GetCacheFileMetadata(blob.Digest.Hex(), &md)
+		if test.key == "" {
+			require.True(os.IsNotExist(err), "Namespace: %s", test.namespace)
+			require.Equal(blob.Content, raw)
+		} else {
+			require.NoError(err)
+			require.Equal(test.key, md.KeyID, "Namespace: %s", test.namespace)
+			require.Equal(test.namespace, md.Namespace)
+			require.NotEqual(blob.Content, raw)
+		}
+		require.Equal(blob.Content, readCacheFile(t, s, blob.Digest.Hex()))
+	}
+}
+
+func TestCAStoreEncryptionReadsPlaintextFiles(t *testing.T) {
+	require := require.New(t)
+
+	c := &testutil.Cleanup{}
+	defer c.Run()
+
+	config, cleanup := CAStoreConfigFixture()
+	c.Add(cleanup)
+
+	s, err := NewCAStore(config, tally.NoopScope)
+	require.NoError(err)
+	blob := core.SizedBlobFixture(256, 1)
+	require.NoError(s.CreateCacheFile(blob.Digest.Hex(), bytes.NewReader(blob.Content)))
+	s.Close()
+
+	config.Encryption = EncryptionConfig{
+		Enabled:   true,
+		Keys:      writeKeys(t, tempdir(c, "keys"), "k1"),
+		ActiveKey: "k1",
+	}
+	s, err = NewCAStore(config, tally.NoopScope)
+	require.NoError(err)
+	defer s.Close()
+
+	require.Equal(blob.Content, readCacheFile(t, s, blob.Digest.Hex()))
+}
+
+func TestCAStoreEncryptionDisabledRejectsEncryptedFiles(t *testing.T) {
+	require := require.New(t)
+
+	config, cleanup := encryptedCAStoreConfigFixture(t)
+	defer cleanup()
+
+	s, err := NewCAStore(config, tally.NoopScope)
+	require.NoError(err)
+	blob := core.SizedBlobFixture(256, 1)
+	require.NoError(s.CreateCacheFile(blob.Digest.Hex(), bytes.NewReader(blob.Content)))
+	s.Close()
+
+	config.Encryption.Enabled = false
+	s, err = NewCAStore(config, tally.NoopScope)
+	require.NoError(err)
+	defer s.Close()
+
+	_, err = s.GetCacheFileReader(blob.Digest.Hex())
+	require.Equal(errEncryptionDisabled, err)
+}
+
+func TestCAStoreKeyRotationRewrapsDataKeys(t *testing.T) {
+	require := require.New(t)
+
+	config, cleanup := encryptedCAStoreConfigFixture(t)
+	defer cleanup()
+
+	s, err := NewCAStore(config, tally.NoopScope)
+	require.NoError(err)
+	blob := core.SizedBlobFixture(4096, 1)
+	require.NoError(s.CreateCacheFile(blob.Digest.Hex(), bytes.NewReader(blob.Content)))
+	raw := readRawCacheFile(t, s.cacheStore, blob.Digest.Hex())
+	s.Close()
+
+	config.Encryption.ActiveKey = "k2"
+	s, err = NewCAStore(config, tally.NoopScope)
+	require.NoError(err)
+	s.cacheStore.encrypt.rewrapKeys(s.cacheStore.newFileOp(), nil)
+	s.Close()
+
+	var md metadata.Encryption
+	require.NoError(s.GetCacheFileMetadata(blob.Digest.Hex(), &md))
+	require.Equal("k2", md.KeyID)
+
+	// Content is not re-encrypted.
+	require.Equal(raw, readRawCacheFile(t, s.cacheStore, blob.Digest.Hex()))
+
+	// The old key is no longer needed.
+	delete(config.Encryption.Keys, "k1")
+	s, err = NewCAStore(config, tally.NoopScope)
+	require.NoError(err)
+	defer s.Close()
+
+	require.Equal(blob.Content, readCacheFile(t, s, blob.Digest.Hex()))
+}
+
+func TestNewCAStoreEncryptionErrors(t *testing.T) {
+	tests := []struct {
+		desc   string
+		mutate func(*CAStoreConfig)
+	}{
+		{"unknown active key", func(c *CAStoreConfig) { c.Encryption.ActiveKey = "k3" }},
+		{"unknown namespace key", func(c *CAStoreConfig) {
+			c.Encryption.Namespaces = []NamespaceEncryptionConfig{{Namespace: ".*", ActiveKey: "k3"}}
+		}},
+		{"invalid namespace", func(c *CAStoreConfig) {
+			c.Encryption.Namespaces = []NamespaceEncryptionConfig{{Namespace: "[a-z", ActiveKey: "k1"}}
+		}},
+		{"missing key file", func(c *CAStoreConfig) { c.Encryption.Keys["k2"] = "/does/not/exist" }},
+		{"invalid key", func(c *CAStoreConfig) {
+			require.NoError(t, ioutil.WriteFile(c.Encryption.Keys["k2"], []byte("abcd"), 0600))
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			config, cleanup := encryptedCAStoreConfigFixture(t)
+			defer cleanup()
+
+			test.mutate(&config)
+
+			_, err := NewCAStore(config, tally.NoopScope)
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestCADownloadStoreEncryptsFilesAtRest(t *testing.T) {
+	require := require.New(t)
+
+	cleanup := &testutil.Cleanup{}
+	defer cleanup.Run()
+
+	config := CADownloadStoreConfig{
+		DownloadDir: tempdir(cleanup, "download"),
+		CacheDir:    tempdir(cleanup, "cache"),
+		Encryption: EncryptionConfig{
+			Enabled:   true,
+			Keys:      writeKeys(t, tempdir(cleanup, "keys"), "k1"),
+			ActiveKey: "k1",
+		},
+	}
+
+	s, err := NewCADownloadStore(config, tally.NoopScope)
+	require.NoError(err)
+	defer s.Close()
+	// Pieces share chunks.
+	s.encrypt.chunkSize = 128
+
+	blob := core.SizedBlobFixture(1000, 1)
+	name := blob.Digest.Hex()
+	require.NoError(s.CreateDownloadFile(name, int64(len(blob.Content))))
+
+	// Write pieces out of order at offsets which are not block aligned.
+	w, err := s.GetDownloadFileReadWriter(name)
+	require.NoError(err)
+	pieces := []int64{0, 333, 666, 1000}
+	order := []int{0, 1, 2}
+	randutil.ShuffleInts(order)
+	for _, i := range order {
+		start, end := pieces[i], pieces[i+1]
+		_, err := w.WriteAt(blob.Content[start:end], start)
+		require.NoError(err)
+	}
+	require.NoError(w.Close())
+
+	require.NoError(s.MoveDownloadFileToCache(name))
+
+	path, err := s.Cache().op.GetFilePath(name)
+	require.NoError(err)
+	raw, err := ioutil.ReadFile(path)
+	require.NoError(err)
+	require.Len(raw, len(blob.Content))
+	require.NotEqual(blob.Content, raw)
+
+	r, err := s.Cache().GetFileReader(name)
+	require.NoError(err)
+	defer r.Close()
+	b, err := ioutil.ReadAll(r)
+	require.NoError(err)
+	require.Equal(blob.Content, b)
+}
+
+func TestCADownloadStoreEncryptionRewritesChunksUnderFreshNonces(t *testing.T) {
+	require := require.New(t)
+
+	cleanup := &testutil.Cleanup{}
+	defer cleanup.Run()
+
+	config := CADownloadStoreConfig{
+		DownloadDir: tempdir(cleanup, "download"),
+		CacheDir:    tempdir(cleanup, "cache"),
+		Encryption: EncryptionConfig{
+			Enabled:   true,
+			Keys:      writeKeys(t, tempdir(cleanup, "keys"), "k1"),
+			ActiveKey: "k1",
+		},
+	}
+
+	s, err := NewCADownloadStore(config, tally.NoopScope)
+	require.NoError(err)
+	defer s.Close()
+	s.encrypt.chunkSize = 128
+
+	blob := core.SizedBlobFixture(512, 1)
+	name := blob.Digest.Hex()
+	require.NoError(s.CreateDownloadFile(name, int64(len(blob.Content))))
+
+	path, err := s.Download().op.GetFilePath(name)
+	require.NoError(err)
+
+	keystream := func(plaintext []byte) []byte {
+		raw, err := ioutil.ReadFile(path)
+		require.NoError(err)
+		b := make([]byte, 100)
+		for i := range b {
+			b[i] = raw[200+i] ^ plaintext[i]
+		}
+		return b
+	}
+
+	// A corrupt piece is written first, and then rewritten with the content.
+	corrupt := randutil.Text(100)
+	w, err := s.GetDownloadFileReadWriter(name)
+	require.NoError(err)
+	defer w.Close()
+	_, err = w.WriteAt(corrupt, 200)
+	require.NoError(err)
+	first := keystream(corrupt)
+
+	_, err = w.WriteAt(blob.Content[200:300], 200)
+	require.NoError(err)
+	require.NotEqual(first, keystream(blob.Content[200:300]))
+
+	b := make([]byte, 100)
+	_, err = w.ReadAt(b, 200)
+	require.NoError(err)
+	require.Equal(blob.Content[200:300], b)
+}
@@ -0,0 +1,151 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package store
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/uber-go/tally"
+)
+
+// FsyncPolicy defines when writes to store files are flushed to stable
+// storage.
+//
+// Files which are not fsynced may be lost or truncated if the host crashes,
+// even after they were committed to the cache. Since store content is
+// content-addressable and re-fetchable from origins or backends, this is only
+// a loss of work, and stores verify content on commit. Files which are fsynced
+// survive crashes at the cost of write throughput.
+type FsyncPolicy string
+
+const (
+	// FsyncNever leaves flushing of writes to the OS. Fastest, and safe only
+	// because content can be re-fetched.
+	FsyncNever FsyncPolicy = "never"
+
+	// FsyncOnCommit flushes a file once before it is committed to the cache,
+	// such that every cache file survives crashes. In-progress files may
+	// still lose writes.
+	FsyncOnCommit FsyncPolicy = "on_commit"
+
+	// FsyncAlways additionally flushes every write, such that no acknowledged
+	// write is lost. Slowest.
+	FsyncAlways FsyncPolicy = "always"
+)
+
+func (p FsyncPolicy) validate() error {
+	switch p {
+	case FsyncNever, FsyncOnCommit, FsyncAlways:
+		return nil
+	}
+	return fmt.Errorf("invalid fsync policy %q", p)
+}
+
+// syncer is implemented by FileReadWriters backed by a local file.
+type syncer interface {
+	Sync() error
+}
+
+// fsyncer applies an FsyncPolicy to store writes.
+type fsyncer struct {
+	policy FsyncPolicy
+	syncs  tally.Counter
+}
+
+func newFsyncer(policy FsyncPolicy, stats tally.Scope) (*fsyncer, error) {
+	if policy == "" {
+		policy = FsyncNever
+	}
+	if err := policy.validate(); err != nil {
+		return nil, err
+	}
+	return &fsyncer{policy, stats.Counter("fsyncs")}, nil
+}
+
+// wrap returns a FileReadWriter which flushes every write to rw, if required
+// by the policy.
+func (f *fsyncer) wrap(rw FileReadWriter) FileReadWriter {
+	if f.policy != FsyncAlways {
+		return rw
+	}
+	s, ok := rw.(syncer)
+	if !ok {
+		return rw
+	}
+	return &syncingReadWriter{rw, s, f}
+}
+
+// beforeCommit flushes the file at path before it is committed to the cache,
+// if required by the policy.
+func (f *fsyncer) beforeCommit(path string) error {
+	if f.policy == FsyncNever {
+		return nil
+	}
+	return f.syncPath(path)
+}
+
+// afterCommit flushes the directory of the committed file at path, such that
+// the commit itself survives crashes, if required by the policy.
+func (f *fsyncer) afterCommit(path string) error {
+	if f.policy == FsyncNever {
+		return nil
+	}
+	return f.syncPath(filepath.Dir(path))
+}
+
+func (f *fsyncer) syncPath(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("open: %s", err)
+	}
+	defer file.Close()
+	if err := file.Sync(); err != nil {
+		return fmt.Errorf("fsync: %s", err)
+	}
+	f.syncs.Inc(1)
+	return nil
+}
+
+// syncingReadWriter flushes every write to stable storage before returning.
+type syncingReadWriter struct {
+	FileReadWriter
+	s syncer
+	f *fsyncer
+}
+
+func (rw *syncingReadWriter) Write(p []byte) (int, error) {
+	n, err := rw.FileReadWriter.Write(p)
+	if err != nil {
+		return n, err
+	}
+	return n, rw.sync()
+}
+
+func (rw *syncingReadWriter) WriteAt(p []byte, offset int64) (int, error) {
+	n, err := rw.FileReadWriter.WriteAt(p, offset)
+	if err != nil {
+		return n, err
+	}
+	return n, rw.sync()
+}
+
+func (rw *syncingReadWriter) sync() error {
+	if err := rw.s.Sync(); err != nil {
+		return fmt.Errorf("fsync: %s", err)
+	}
+	rw.f.syncs.Inc(1)
+	return nil
+}
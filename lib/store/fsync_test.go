@@ -0,0 +1,185 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package store
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/utils/randutil"
+	"github.com/uber/kraken/utils/testutil"
+
+	"github.com/stretchr/testify/require"
+	"github.com/uber-go/tally"
+)
+
+func fsyncCount(stats tally.TestScope) int64 {
+	var n int64
+	for _, c := range stats.Snapshot().Counters() {
+		if c.Name() == "fsyncs" {
+			n += c.Value()
+		}
+	}
+	return n
+}
+
+func TestCAStoreAppliesFsyncPolicy(t *testing.T) {
+	tests := []struct {
+		policy   FsyncPolicy
+		expected int64
+	}{
+		{"", 0},
+		{FsyncNever, 0},
+		// The file before the commit and its directory after.
+		{FsyncOnCommit, 2},
+		// Additionally every write.
+		{FsyncAlways, 5},
+	}
+	for _, test := range tests {
+		t.Run(fmt.Sprintf("policy=%q", test.policy), func(t *testing.T) {
+			require := require.New(t)
+
+			config, cleanup := CAStoreConfigFixture()
+			defer cleanup()
+
+			config.FsyncPolicy = test.policy
+			stats := tally.NewTestScope("", nil)
+
+			s, err := NewCAStore(config, stats)
+			require.NoError(err)
+			defer s.Close()
+
+			blob := core.SizedBlobFixture(9, 3)
+			require.NoError(s.CreateUploadFile("upload", 0))
+			w, err := s.GetUploadFileReadWriter("upload")
+			require.NoError(err)
+			for i := 0; i < 3; i++ {
+				_, err := w.Write(blob.Content[i*3 : (i+1)*3])
+				require.NoError(err)
+			}
+			require.NoError(w.Close())
+
+			require.NoError(s.MoveUploadFileToCache("upload", blob.Digest.Hex()))
+
+			require.Equal(test.expected, fsyncCount(stats))
+
+			r, err := s.GetCacheFileReader(blob.Digest.Hex())
+			require.NoError(err)
+			defer r.Close()
+			var b bytes.Buffer
+			_, err = b.ReadFrom(r)
+			require.NoError(err)
+			require.Equal(blob.Content, b.Bytes())
+		})
+	}
+}
+
+func TestCADownloadStoreAppliesFsyncPolicy(t *testing.T) {
+	require := require.New(t)
+
+	cleanup := &testutil.Cleanup{}
+	defer cleanup.Run()
+
+	config := CADownloadStoreConfig{
+		DownloadDir: tempdir(cleanup, "download"),
+		CacheDir:    tempdir(cleanup, "cache"),
+		FsyncPolicy: FsyncAlways,
+	}
+	stats := tally.NewTestScope("", nil)
+
+	s, err := NewCADownloadStore(config, stats)
+	require.NoError(err)
+	defer s.Close()
+
+	name := core.DigestFixture().Hex()
+	require.NoError(s.CreateDownloadFile(name, 4))
+	w, err := s.GetDownloadFileReadWriter(name)
+	require.NoError(err)
+	_, err = w.WriteAt([]byte("ab"), 0)
+	require.NoError(err)
+	_, err = w.WriteAt([]byte("cd"), 2)
+	require.NoError(err)
+	require.NoError(w.Close())
+	require.Equal(int64(2), fsyncCount(stats))
+
+	require.NoError(s.MoveDownloadFileToCache(name))
+	require.Equal(int64(4), fsyncCount(stats))
+}
+
+func TestInvalidFsyncPolicy(t *testing.T) {
+	require := require.New(t)
+
+	config, cleanup := CAStoreConfigFixture()
+	defer cleanup()
+
+	config.FsyncPolicy = "sometimes"
+	_, err := NewCAStore(config, tally.NoopScope)
+	require.Error(err)
+}
+
+func BenchmarkCAStoreFsyncPolicy(b *testing.B) {
+	chunk := randutil.Text(64 * 1024)
+	for _, policy := range []FsyncPolicy{FsyncNever, FsyncOnCommit, FsyncAlways} {
+		b.Run(string(policy), func(b *testing.B) {
+			config, cleanup := CAStoreConfigFixture()
+			defer cleanup()
+
+			config.FsyncPolicy = policy
+			s, err := NewCAStore(config, tally.NoopScope)
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer s.Close()
+
+			b.SetBytes(int64(16 * len(chunk)))
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				// Each blob is distinct, such that every commit writes a new file.
+				name := fmt.Sprintf("upload-%d", i)
+				b.StopTimer()
+				content := []byte(name)
+				for j := 0; j < 16; j++ {
+					content = append(content, chunk...)
+				}
+				d, err := core.NewDigester().FromBytes(content)
+				if err != nil {
+					b.Fatal(err)
+				}
+				b.StartTimer()
+
+				if err := s.CreateUploadFile(name, 0); err != nil {
+					b.Fatal(err)
+				}
+				w, err := s.GetUploadFileReadWriter(name)
+				if err != nil {
+					b.Fatal(err)
+				}
+				if _, err := w.Write([]byte(name)); err != nil {
+					b.Fatal(err)
+				}
+				for j := 0; j < 16; j++ {
+					if _, err := w.Write(chunk); err != nil {
+						b.Fatal(err)
+					}
+				}
+				w.Close()
+				if err := s.MoveUploadFileToCache(name, d.Hex()); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
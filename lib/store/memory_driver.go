@@ -0,0 +1,429 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package store
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/docker/distribution/uuid"
+	"github.com/uber/kraken/lib/store/base"
+	"github.com/uber/kraken/lib/store/metadata"
+)
+
+type memFile struct {
+	data     []byte
+	modTime  time.Time
+	metadata map[string][]byte
+}
+
+// MemoryDriver is a Driver which keeps blobs in memory. It does not bound the
+// memory used, and is primarily intended for testing.
+type MemoryDriver struct {
+	sync.Mutex
+	clk     clock.Clock
+	cache   map[string]*memFile
+	uploads map[string]*memFile
+}
+
+// NewMemoryDriver creates a new MemoryDriver.
+func NewMemoryDriver() *MemoryDriver {
+	return &MemoryDriver{
+		clk:     clock.New(),
+		cache:   make(map[string]*memFile),
+		uploads: make(map[string]*memFile),
+	}
+}
+
+var _ Driver = (*MemoryDriver)(nil)
+
+func notExist(op, name string) error {
+	return &os.PathError{Op: op, Path: name, Err: os.ErrNotExist}
+}
+
+func exist(op, name string) error {
+	return &os.PathError{Op: op, Path: name, Err: os.ErrExist}
+}
+
+// CreateCacheFile puts the contents of r into the cache as name.
+func (d *MemoryDriver) CreateCacheFile(name string, r io.Reader) error {
+	return d.WriteCacheFile(name, func(w FileReadWriter) error {
+		_, err := io.Copy(w, r)
+		return err
+	})
+}
+
+// WriteCacheFile puts name into the cache by passing a temporary writer to
+// write.
+func (d *MemoryDriver) WriteCacheFile(name string, write func(w FileReadWriter) error) error {
+	tmp := fmt.Sprintf("%s.%s", name, uuid.Generate().String())
+	if err := d.CreateUploadFile(tmp, 0); err != nil {
+		return fmt.Errorf("create upload file: %s", err)
+	}
+	defer d.DeleteUploadFile(tmp)
+
+	w, err := d.GetUploadFileReadWriter(tmp)
+	if err != nil {
+		return fmt.Errorf("get upload writer: %s", err)
+	}
+	defer w.Close()
+
+	if err := write(w); err != nil {
+		return err
+	}
+	if err := d.MoveUploadFileToCache(tmp, name); err != nil && !os.IsExist(err) {
+		return fmt.Errorf("move upload file to cache: %s", err)
+	}
+	return nil
+}
+
+// GetCacheFileReader gets a reader of cached name.
+func (d *MemoryDriver) GetCacheFileReader(name string) (FileReader, error) {
+	d.Lock()
+	defer d.Unlock()
+
+	f, ok := d.cache[name]
+	if !ok {
+		return nil, notExist("open", name)
+	}
+	return memReader{bytes.NewReader(f.data)}, nil
+}
+
+// GetCacheFileStat stats cached name.
+func (d *MemoryDriver) GetCacheFileStat(name string) (os.FileInfo, error) {
+	d.Lock()
+	defer d.Unlock()
+
+	f, ok := d.cache[name]
+	if !ok {
+		return nil, notExist("stat", name)
+	}
+	return memFileInfo{name, int64(len(f.data)), f.modTime}, nil
+}
+
+// DeleteCacheFile deletes cached name and its metadata. Returns
+// base.ErrFilePersisted if name is persisted.
+func (d *MemoryDriver) DeleteCacheFile(name string) error {
+	d.Lock()
+	defer d.Unlock()
+
+	f, ok := d.cache[name]
+	if !ok {
+		return notExist("delete", name)
+	}
+	var persist metadata.Persist
+	if b, ok := f.metadata[persist.GetSuffix()]; ok {
+		if err := persist.Deserialize(b); err != nil {
+			return fmt.Errorf("get persist metadata: %s", err)
+		}
+		if persist.Value {
+			return base.ErrFilePersisted
+		}
+	}
+	delete(d.cache, name)
+	return nil
+}
+
+// ListCacheFiles lists the names of all cached files.
+func (d *MemoryDriver) ListCacheFiles() ([]string, error) {
+	d.Lock()
+	defer d.Unlock()
+
+	names := make([]string, 0, len(d.cache))
+	for name := range d.cache {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// GetCacheFileMetadata loads the metadata of cached name into md.
+func (d *MemoryDriver) GetCacheFileMetadata(name string, md metadata.Metadata) error {
+	d.Lock()
+	defer d.Unlock()
+
+	f, ok := d.cache[name]
+	if !ok {
+		return notExist("get metadata", name)
+	}
+	b, ok := f.metadata[md.GetSuffix()]
+	if !ok {
+		return notExist("get metadata", name+md.GetSuffix())
+	}
+	return md.Deserialize(b)
+}
+
+// SetCacheFileMetadata sets md on cached name. Returns false if md was
+// already set to the same value.
+func (d *MemoryDriver) SetCacheFileMetadata(name string, md metadata.Metadata) (bool, error) {
+	d.Lock()
+	defer d.Unlock()
+
+	f, ok := d.cache[name]
+	if !ok {
+		return false, notExist("set metadata", name)
+	}
+	return f.setMetadata(md)
+}
+
+// GetOrSetCacheFileMetadata loads the metadata of cached name into md if set,
+// else sets md.
+func (d *MemoryDriver) GetOrSetCacheFileMetadata(name string, md metadata.Metadata) error {
+	d.Lock()
+	defer d.Unlock()
+
+	f, ok := d.cache[name]
+	if !ok {
+		return notExist("get or set metadata", name)
+	}
+	if b, ok := f.metadata[md.GetSuffix()]; ok {
+		return md.Deserialize(b)
+	}
+	_, err := f.setMetadata(md)
+	return err
+}
+
+// DeleteCacheFileMetadata deletes md from cached name. Deleting metadata which
+// is not set is a no-op.
+func (d *MemoryDriver) DeleteCacheFileMetadata(name string, md metadata.Metadata) error {
+	d.Lock()
+	defer d.Unlock()
+
+	f, ok := d.cache[name]
+	if !ok {
+		return notExist("delete metadata", name)
+	}
+	delete(f.metadata, md.GetSuffix())
+	return nil
+}
+
+// WriteCacheFileInNamespace is like WriteCacheFile. Memory drivers do not
+// encrypt blobs, so namespace is ignored.
+func (d *MemoryDriver) WriteCacheFileInNamespace(
+	namespace, name string, write func(w FileReadWriter) error) error {
+
+	return d.WriteCacheFile(name, write)
+}
+
+// CreateUploadFileInNamespace is like CreateUploadFile. Memory drivers do not
+// encrypt blobs, so namespace is ignored.
+func (d *MemoryDriver) CreateUploadFileInNamespace(namespace, name string, length int64) error {
+	return d.CreateUploadFile(name, length)
+}
+
+// CreateUploadFile creates an upload file of length bytes.
+func (d *MemoryDriver) CreateUploadFile(name string, length int64) error {
+	d.Lock()
+	defer d.Unlock()
+
+	if _, ok := d.uploads[name]; ok {
+		return exist("create", name)
+	}
+	d.uploads[name] = &memFile{
+		data:     make([]byte, length),
+		modTime:  d.clk.Now(),
+		metadata: make(map[string][]byte),
+	}
+	return nil
+}
+
+// GetUploadFileReadWriter gets a read-writer of upload file name.
+func (d *MemoryDriver) GetUploadFileReadWriter(name string) (FileReadWriter, error) {
+	d.Lock()
+	defer d.Unlock()
+
+	f, ok := d.uploads[name]
+	if !ok {
+		return nil, notExist("open", name)
+	}
+	return &memReadWriter{d: d, f: f}, nil
+}
+
+// MoveUploadFileToCache verifies upload file uploadName and commits it into
+// the cache as cacheName. The upload file is deleted regardless of success.
+func (d *MemoryDriver) MoveUploadFileToCache(uploadName, cacheName string) error {
+	d.Lock()
+	f, ok := d.uploads[uploadName]
+	delete(d.uploads, uploadName)
+	d.Unlock()
+
+	if !ok {
+		return notExist("move", uploadName)
+	}
+	// Verified without holding the lock, since the upload file is no longer
+	// reachable by other callers.
+	if err := verifyDigest(bytes.NewReader(f.data), cacheName, false); err != nil {
+		return fmt.Errorf("verify digest: %s", err)
+	}
+
+	d.Lock()
+	defer d.Unlock()
+
+	if _, ok := d.cache[cacheName]; ok {
+		return exist("move", cacheName)
+	}
+	f.modTime = d.clk.Now()
+	f.metadata = make(map[string][]byte)
+	d.cache[cacheName] = f
+	return nil
+}
+
+// Corrupt overwrites the contents of cached name with data without
+// verification, which simulates disk corruption in tests.
+func (d *MemoryDriver) Corrupt(name string, data []byte) error {
+	d.Lock()
+	defer d.Unlock()
+
+	f, ok := d.cache[name]
+	if !ok {
+		return notExist("corrupt", name)
+	}
+	f.data = append([]byte(nil), data...)
+	return nil
+}
+
+// DeleteUploadFile deletes upload file name.
+func (d *MemoryDriver) DeleteUploadFile(name string) error {
+	d.Lock()
+	defer d.Unlock()
+
+	if _, ok := d.uploads[name]; !ok {
+		return notExist("delete", name)
+	}
+	delete(d.uploads, name)
+	return nil
+}
+
+func (f *memFile) setMetadata(md metadata.Metadata) (bool, error) {
+	b, err := md.Serialize()
+	if err != nil {
+		return false, fmt.Errorf("serialize metadata: %s", err)
+	}
+	if prev, ok := f.metadata[md.GetSuffix()]; ok && bytes.Equal(prev, b) {
+		return false, nil
+	}
+	f.metadata[md.GetSuffix()] = b
+	return true, nil
+}
+
+type memReader struct {
+	*bytes.Reader
+}
+
+func (r memReader) Close() error { return nil }
+
+// memReadWriter reads and writes an upload file in memory. Reads and writes
+// are serialized by the lock of the driver.
+type memReadWriter struct {
+	d   *MemoryDriver
+	f   *memFile
+	off int64
+}
+
+func (rw *memReadWriter) Read(p []byte) (int, error) {
+	n, err := rw.ReadAt(p, rw.off)
+	rw.off += int64(n)
+	if err == io.EOF && n > 0 {
+		err = nil
+	}
+	return n, err
+}
+
+func (rw *memReadWriter) ReadAt(p []byte, off int64) (int, error) {
+	rw.d.Lock()
+	defer rw.d.Unlock()
+
+	if off < 0 {
+		return 0, errors.New("negative offset")
+	}
+	if off >= int64(len(rw.f.data)) {
+		return 0, io.EOF
+	}
+	n := copy(p, rw.f.data[off:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (rw *memReadWriter) Write(p []byte) (int, error) {
+	n, err := rw.WriteAt(p, rw.off)
+	rw.off += int64(n)
+	return n, err
+}
+
+func (rw *memReadWriter) WriteAt(p []byte, off int64) (int, error) {
+	rw.d.Lock()
+	defer rw.d.Unlock()
+
+	if off < 0 {
+		return 0, errors.New("negative offset")
+	}
+	if end := off + int64(len(p)); end > int64(len(rw.f.data)) {
+		data := make([]byte, end)
+		copy(data, rw.f.data)
+		rw.f.data = data
+	}
+	return copy(rw.f.data[off:], p), nil
+}
+
+func (rw *memReadWriter) Seek(offset int64, whence int) (int64, error) {
+	var abs int64
+	switch whence {
+	case io.SeekStart:
+		abs = offset
+	case io.SeekCurrent:
+		abs = rw.off + offset
+	case io.SeekEnd:
+		abs = rw.Size() + offset
+	default:
+		return 0, errors.New("invalid whence")
+	}
+	if abs < 0 {
+		return 0, errors.New("negative position")
+	}
+	rw.off = abs
+	return abs, nil
+}
+
+func (rw *memReadWriter) Size() int64 {
+	rw.d.Lock()
+	defer rw.d.Unlock()
+
+	return int64(len(rw.f.data))
+}
+
+func (rw *memReadWriter) Close() error  { return nil }
+func (rw *memReadWriter) Cancel() error { return nil }
+func (rw *memReadWriter) Commit() error { return nil }
+
+type memFileInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+}
+
+func (i memFileInfo) Name() string       { return i.name }
+func (i memFileInfo) Size() int64        { return i.size }
+func (i memFileInfo) Mode() os.FileMode  { return 0644 }
+func (i memFileInfo) ModTime() time.Time { return i.modTime }
+func (i memFileInfo) IsDir() bool        { return false }
+func (i memFileInfo) Sys() interface{}   { return nil }
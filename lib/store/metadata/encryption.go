@@ -0,0 +1,105 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package metadata
+
+import (
+	"encoding/json"
+	"regexp"
+)
+
+const (
+	_encryptionSuffix = "_encryption"
+	_sealsSuffix      = "_seals"
+)
+
+func init() {
+	Register(regexp.MustCompile(_encryptionSuffix), &encryptionFactory{})
+	Register(regexp.MustCompile(_sealsSuffix), &sealsFactory{})
+}
+
+type encryptionFactory struct{}
+
+func (f encryptionFactory) Create(suffix string) Metadata {
+	return &Encryption{}
+}
+
+// Encryption describes how a file is encrypted at rest. The data key of the
+// file is only ever stored wrapped by the key encryption key KeyID, which was
+// selected by the namespace the file was created for. Content is sealed in
+// chunks of ChunkSize bytes, whose seals are stored as Seals.
+type Encryption struct {
+	KeyID      string `json:"key_id"`
+	Namespace  string `json:"namespace,omitempty"`
+	WrappedKey []byte `json:"wrapped_key"`
+	ChunkSize  int64  `json:"chunk_size"`
+}
+
+// NewEncryption creates a new Encryption.
+func NewEncryption(keyID, namespace string, wrappedKey []byte, chunkSize int64) *Encryption {
+	return &Encryption{keyID, namespace, wrappedKey, chunkSize}
+}
+
+// GetSuffix returns a static suffix.
+func (m *Encryption) GetSuffix() string {
+	return _encryptionSuffix
+}
+
+// Movable is true.
+func (m *Encryption) Movable() bool {
+	return true
+}
+
+// Serialize converts m to bytes.
+func (m *Encryption) Serialize() ([]byte, error) {
+	return json.Marshal(m)
+}
+
+// Deserialize loads b into m.
+func (m *Encryption) Deserialize(b []byte) error {
+	return json.Unmarshal(b, m)
+}
+
+type sealsFactory struct{}
+
+func (f sealsFactory) Create(suffix string) Metadata {
+	return &Seals{}
+}
+
+// Seals holds the nonces and authentication tags of the chunks of an encrypted
+// file. Seals of chunks are stored at fixed offsets, such that they can be
+// updated individually as chunks are written.
+type Seals struct {
+	b []byte
+}
+
+// GetSuffix returns a static suffix.
+func (m *Seals) GetSuffix() string {
+	return _sealsSuffix
+}
+
+// Movable is true.
+func (m *Seals) Movable() bool {
+	return true
+}
+
+// Serialize converts m to bytes.
+func (m *Seals) Serialize() ([]byte, error) {
+	return m.b, nil
+}
+
+// Deserialize loads b into m.
+func (m *Seals) Deserialize(b []byte) error {
+	m.b = b
+	return nil
+}
@@ -0,0 +1,46 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package metadata
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncryptionMetadataSerialization(t *testing.T) {
+	require := require.New(t)
+
+	e := NewEncryption("k1", "namespace-foo", []byte("wrapped"), 1024)
+	b, err := e.Serialize()
+	require.NoError(err)
+
+	result := CreateFromSuffix(e.GetSuffix())
+	require.NotNil(result)
+	require.NoError(result.Deserialize(b))
+	require.Equal(e, result)
+}
+
+func TestSealsMetadataSerialization(t *testing.T) {
+	require := require.New(t)
+
+	s := &Seals{[]byte("seals")}
+	b, err := s.Serialize()
+	require.NoError(err)
+
+	result := CreateFromSuffix(s.GetSuffix())
+	require.NotNil(result)
+	require.NoError(result.Deserialize(b))
+	require.Equal(s, result)
+}
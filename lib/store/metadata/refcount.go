@@ -0,0 +1,66 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package metadata
+
+import (
+	"regexp"
+	"strconv"
+)
+
+const _refCountSuffix = "_refcount"
+
+func init() {
+	Register(regexp.MustCompile(_refCountSuffix), &refCountFactory{})
+}
+
+type refCountFactory struct{}
+
+func (f refCountFactory) Create(suffix string) Metadata {
+	return &RefCount{}
+}
+
+// RefCount tracks the number of references to a shared file.
+type RefCount struct {
+	Value int64
+}
+
+// NewRefCount creates a new RefCount.
+func NewRefCount(v int64) *RefCount {
+	return &RefCount{v}
+}
+
+// GetSuffix returns a static suffix.
+func (m *RefCount) GetSuffix() string {
+	return _refCountSuffix
+}
+
+// Movable is true.
+func (m *RefCount) Movable() bool {
+	return true
+}
+
+// Serialize converts m to bytes.
+func (m *RefCount) Serialize() ([]byte, error) {
+	return []byte(strconv.FormatInt(m.Value, 10)), nil
+}
+
+// Deserialize loads b into m.
+func (m *RefCount) Deserialize(b []byte) error {
+	v, err := strconv.ParseInt(string(b), 10, 64)
+	if err != nil {
+		return err
+	}
+	m.Value = v
+	return nil
+}
@@ -0,0 +1,70 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package metadata
+
+import (
+	"encoding/binary"
+	"fmt"
+	"regexp"
+	"time"
+)
+
+var _verifiedAtSuffix = "_verified_at"
+
+func init() {
+	Register(regexp.MustCompile(_verifiedAtSuffix), &verifiedAtFactory{})
+}
+
+type verifiedAtFactory struct{}
+
+func (f verifiedAtFactory) Create(suffix string) Metadata {
+	return &VerifiedAt{}
+}
+
+// VerifiedAt tracks when a file last passed digest verification.
+type VerifiedAt struct {
+	Time time.Time
+}
+
+// NewVerifiedAt creates a VerifiedAt from t.
+func NewVerifiedAt(t time.Time) *VerifiedAt {
+	return &VerifiedAt{t}
+}
+
+// GetSuffix returns the metadata suffix.
+func (v *VerifiedAt) GetSuffix() string {
+	return _verifiedAtSuffix
+}
+
+// Movable is true.
+func (v *VerifiedAt) Movable() bool {
+	return true
+}
+
+// Serialize converts v to bytes.
+func (v *VerifiedAt) Serialize() ([]byte, error) {
+	b := make([]byte, 8)
+	binary.PutVarint(b, v.Time.Unix())
+	return b, nil
+}
+
+// Deserialize loads b into v.
+func (v *VerifiedAt) Deserialize(b []byte) error {
+	i, n := binary.Varint(b)
+	if n <= 0 {
+		return fmt.Errorf("unmarshal verified at: %s", b)
+	}
+	v.Time = time.Unix(int64(i), 0)
+	return nil
+}
@@ -37,13 +37,18 @@ func NewSimpleStore(config SimpleStoreConfig, stats tally.Scope) (*SimpleStore,
 		"module": "simplestore",
 	})
 
-	uploadStore, err := newUploadStore(config.UploadDir)
+	fsync, err := newFsyncer(config.FsyncPolicy, stats)
+	if err != nil {
+		return nil, err
+	}
+
+	uploadStore, err := newUploadStore(config.UploadDir, fsync, nil)
 	if err != nil {
 		return nil, fmt.Errorf("new upload store: %s", err)
 	}
 
 	cacheBackend := base.NewLocalFileStore(clock.New())
-	cacheStore, err := newCacheStore(config.CacheDir, cacheBackend)
+	cacheStore, err := newCacheStore(config.CacheDir, cacheBackend, nil)
 	if err != nil {
 		return nil, fmt.Errorf("new cache store: %s", err)
 	}
@@ -70,7 +75,7 @@ func (s *SimpleStore) MoveUploadFileToCache(uploadName, cacheName string) error
 		return err
 	}
 	defer s.DeleteUploadFile(uploadName)
-	return s.cacheStore.newFileOp().MoveFileFrom(cacheName, s.cacheStore.state, uploadPath)
+	return s.cacheStore.moveFileFrom(cacheName, uploadPath, s.uploadStore.fsync)
 }
 
 // CreateCacheFile initializes a cache file for name from r.
@@ -27,9 +27,11 @@ import (
 type uploadStore struct {
 	state   base.FileState
 	backend base.FileStore
+	fsync   *fsyncer
+	encrypt *encryptor
 }
 
-func newUploadStore(dir string) (*uploadStore, error) {
+func newUploadStore(dir string, fsync *fsyncer, encrypt *encryptor) (*uploadStore, error) {
 	// Always wipe upload directory on startup.
 	os.RemoveAll(dir)
 
@@ -38,11 +40,24 @@ func newUploadStore(dir string) (*uploadStore, error) {
 	}
 	state := base.NewFileState(dir)
 	backend := base.NewLocalFileStore(clock.New())
-	return &uploadStore{state, backend}, nil
+	return &uploadStore{state, backend, fsync, encrypt}, nil
 }
 
 func (s *uploadStore) CreateUploadFile(name string, length int64) error {
-	return s.backend.NewFileOp().CreateFile(name, s.state, length)
+	return s.CreateUploadFileInNamespace("", name, length)
+}
+
+// CreateUploadFileInNamespace creates an upload file of length bytes for a blob
+// of namespace, which selects how the file is encrypted.
+func (s *uploadStore) CreateUploadFileInNamespace(namespace, name string, length int64) error {
+	if err := s.backend.NewFileOp().CreateFile(name, s.state, length); err != nil {
+		return err
+	}
+	if err := s.encrypt.initFile(s.newFileOp(), namespace, name); err != nil {
+		s.DeleteUploadFile(name)
+		return err
+	}
+	return nil
 }
 
 func (s *uploadStore) GetUploadFileStat(name string) (os.FileInfo, error) {
@@ -50,11 +65,19 @@ func (s *uploadStore) GetUploadFileStat(name string) (os.FileInfo, error) {
 }
 
 func (s *uploadStore) GetUploadFileReader(name string) (FileReader, error) {
-	return s.newFileOp().GetFileReader(name)
+	r, err := s.newFileOp().GetFileReader(name)
+	if err != nil {
+		return nil, err
+	}
+	return s.encrypt.wrapReader(s.newFileOp(), name, r)
 }
 
 func (s *uploadStore) GetUploadFileReadWriter(name string) (FileReadWriter, error) {
-	return s.newFileOp().GetFileReadWriter(name)
+	rw, err := s.newFileOp().GetFileReadWriter(name)
+	if err != nil {
+		return nil, err
+	}
+	return s.encrypt.wrapReadWriter(s.newFileOp(), name, s.fsync.wrap(rw))
 }
 
 func (s *uploadStore) GetUploadFileMetadata(name string, md metadata.Metadata) error {
@@ -17,4 +17,7 @@ package networkevent
 type Config struct {
 	LogPath string `yaml:"log_path"`
 	Enabled bool   `yaml:"enabled"`
+
+	// PieceTrace traces the flow of pieces of downloads in memory.
+	PieceTrace PieceTraceConfig `yaml:"piece_trace"`
 }
@@ -36,6 +36,10 @@ const (
 	ReceivePiece     Name = "receive_piece"
 	TorrentComplete  Name = "torrent_complete"
 	TorrentCancelled Name = "torrent_cancelled"
+
+	// Only produced if piece tracing is enabled.
+	VerifyPiece Name = "verify_piece"
+	SharePiece  Name = "share_piece"
 )
 
 // Event consolidates all possible event fields.
@@ -51,6 +55,10 @@ type Event struct {
 	Bitfield     []bool `json:"bitfield,omitempty"`
 	DurationMS   int64  `json:"duration_ms,omitempty"`
 	ConnCapacity int    `json:"conn_capacity,omitempty"`
+
+	// Set on piece events if piece tracing is enabled.
+	TraceID string `json:"trace_id,omitempty"`
+	Digest  string `json:"digest,omitempty"`
 }
 
 func baseEvent(name Name, h core.InfoHash, self core.PeerID) *Event {
@@ -122,6 +130,23 @@ func ReceivePieceEvent(h core.InfoHash, self core.PeerID, peer core.PeerID, piec
 	return e
 }
 
+// VerifyPieceEvent returns an event for a piece received from a peer which
+// passed verification.
+func VerifyPieceEvent(h core.InfoHash, self core.PeerID, peer core.PeerID, piece int) *Event {
+	e := baseEvent(VerifyPiece, h, self)
+	e.Peer = peer.String()
+	e.Piece = piece
+	return e
+}
+
+// SharePieceEvent returns an event for a piece sent to a peer.
+func SharePieceEvent(h core.InfoHash, self core.PeerID, peer core.PeerID, piece int) *Event {
+	e := baseEvent(SharePiece, h, self)
+	e.Peer = peer.String()
+	e.Piece = piece
+	return e
+}
+
 // TorrentCompleteEvent returns an event for a completed torrent.
 func TorrentCompleteEvent(h core.InfoHash, self core.PeerID) *Event {
 	return baseEvent(TorrentComplete, h, self)
@@ -57,7 +57,11 @@ func NewProducer(config Config) (Producer, error) {
 	} else {
 		log.Warn("Kafka network events disabled")
 	}
-	return &producer{f}, nil
+	var p Producer = &producer{f}
+	if config.PieceTrace.Enabled {
+		p = newTracingProducer(p, config.PieceTrace)
+	}
+	return p, nil
 }
 
 // Produce emits a network event.
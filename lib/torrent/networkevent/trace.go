@@ -0,0 +1,130 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package networkevent
+
+import (
+	"container/list"
+	"sync"
+
+	"github.com/uber/kraken/core"
+)
+
+// PieceTraceConfig defines tracing of the flow of pieces of downloads. Every
+// piece requested, received, verified and shared is traced with an ID shared
+// by the download, so tracing is disabled by default due to volume.
+type PieceTraceConfig struct {
+	Enabled bool `yaml:"enabled"`
+
+	// MaxTraces bounds the downloads whose traces are kept in memory. Traces
+	// of the least recently active downloads are dropped first.
+	MaxTraces int `yaml:"max_traces"`
+
+	// MaxEventsPerTrace bounds the events kept per trace. Further events are
+	// still produced, but are not kept in memory.
+	MaxEventsPerTrace int `yaml:"max_events_per_trace"`
+}
+
+func (c PieceTraceConfig) applyDefaults() PieceTraceConfig {
+	if c.MaxTraces == 0 {
+		c.MaxTraces = 64
+	}
+	if c.MaxEventsPerTrace == 0 {
+		c.MaxEventsPerTrace = 10000
+	}
+	return c
+}
+
+// PieceTracer is implemented by Producers which trace the flow of pieces.
+type PieceTracer interface {
+	Producer
+
+	// PieceTrace returns the trace events of the most recent download of d in
+	// the order they were produced. Returns false if d has no trace.
+	PieceTrace(d core.Digest) ([]*Event, bool)
+}
+
+type pieceTrace struct {
+	digest string
+	id     string
+	events []*Event
+}
+
+// tracingProducer keeps the trace events of recent downloads in memory before
+// passing all events to the underlying Producer.
+type tracingProducer struct {
+	Producer
+	config PieceTraceConfig
+
+	mu     sync.Mutex
+	traces map[string]*list.Element // Digest to *pieceTrace.
+	lru    *list.List
+}
+
+func newTracingProducer(p Producer, config PieceTraceConfig) *tracingProducer {
+	return &tracingProducer{
+		Producer: p,
+		config:   config.applyDefaults(),
+		traces:   make(map[string]*list.Element),
+		lru:      list.New(),
+	}
+}
+
+// Produce records e if it is part of a trace, and emits e.
+func (p *tracingProducer) Produce(e *Event) {
+	if e.TraceID != "" && e.Digest != "" {
+		p.record(e)
+	}
+	p.Producer.Produce(e)
+}
+
+func (p *tracingProducer) record(e *Event) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var t *pieceTrace
+	if el, ok := p.traces[e.Digest]; ok {
+		t = el.Value.(*pieceTrace)
+		p.lru.MoveToFront(el)
+	} else {
+		t = &pieceTrace{digest: e.Digest}
+		p.traces[e.Digest] = p.lru.PushFront(t)
+		if p.lru.Len() > p.config.MaxTraces {
+			oldest := p.lru.Remove(p.lru.Back()).(*pieceTrace)
+			delete(p.traces, oldest.digest)
+		}
+	}
+	if t.id != e.TraceID {
+		// A new download of the digest replaces the trace of the prior one.
+		t.id = e.TraceID
+		t.events = nil
+	}
+	if len(t.events) < p.config.MaxEventsPerTrace {
+		t.events = append(t.events, e)
+	}
+}
+
+// PieceTrace returns the trace events of the most recent download of d.
+func (p *tracingProducer) PieceTrace(d core.Digest) ([]*Event, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	el, ok := p.traces[d.String()]
+	if !ok {
+		return nil, false
+	}
+	t := el.Value.(*pieceTrace)
+	events := make([]*Event, len(t.events))
+	copy(events, t.events)
+	return events, true
+}
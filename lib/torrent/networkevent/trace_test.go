@@ -0,0 +1,101 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package networkevent
+
+import (
+	"testing"
+
+	"github.com/uber/kraken/core"
+
+	"github.com/stretchr/testify/require"
+)
+
+func tracedEvent(d core.Digest, traceID string, piece int) *Event {
+	e := ReceivePieceEvent(core.InfoHashFixture(), core.PeerIDFixture(), core.PeerIDFixture(), piece)
+	e.TraceID = traceID
+	e.Digest = d.String()
+	return e
+}
+
+func TestTracingProducerRecordsOnlyTracedEvents(t *testing.T) {
+	require := require.New(t)
+
+	underlying := NewTestProducer()
+	p := newTracingProducer(underlying, PieceTraceConfig{Enabled: true})
+
+	d := core.DigestFixture()
+	traced := tracedEvent(d, "a", 0)
+	untraced := ReceivePieceEvent(core.InfoHashFixture(), core.PeerIDFixture(), core.PeerIDFixture(), 1)
+
+	p.Produce(traced)
+	p.Produce(untraced)
+
+	events, ok := p.PieceTrace(d)
+	require.True(ok)
+	require.Equal([]*Event{traced}, events)
+
+	// All events are still emitted.
+	require.Equal([]*Event{traced, untraced}, underlying.Events())
+}
+
+func TestTracingProducerNewTraceReplacesPrior(t *testing.T) {
+	require := require.New(t)
+
+	p := newTracingProducer(NewTestProducer(), PieceTraceConfig{Enabled: true})
+
+	d := core.DigestFixture()
+	p.Produce(tracedEvent(d, "a", 0))
+	p.Produce(tracedEvent(d, "a", 1))
+
+	e := tracedEvent(d, "b", 0)
+	p.Produce(e)
+
+	events, ok := p.PieceTrace(d)
+	require.True(ok)
+	require.Equal([]*Event{e}, events)
+}
+
+func TestTracingProducerBoundsMemory(t *testing.T) {
+	require := require.New(t)
+
+	p := newTracingProducer(NewTestProducer(), PieceTraceConfig{
+		Enabled:           true,
+		MaxTraces:         2,
+		MaxEventsPerTrace: 2,
+	})
+
+	d1 := core.DigestFixture()
+	d2 := core.DigestFixture()
+	d3 := core.DigestFixture()
+
+	for i := 0; i < 3; i++ {
+		p.Produce(tracedEvent(d1, "a", i))
+	}
+	p.Produce(tracedEvent(d2, "b", 0))
+
+	events, ok := p.PieceTrace(d1)
+	require.True(ok)
+	require.Len(events, 2)
+
+	// Touch d1 such that d2 is the least recently active.
+	p.Produce(tracedEvent(d1, "a", 3))
+	p.Produce(tracedEvent(d3, "c", 0))
+
+	_, ok = p.PieceTrace(d2)
+	require.False(ok)
+	_, ok = p.PieceTrace(d1)
+	require.True(ok)
+	_, ok = p.PieceTrace(d3)
+	require.True(ok)
+}
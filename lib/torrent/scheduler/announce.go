@@ -0,0 +1,81 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package scheduler
+
+import (
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/tracker/announceclient"
+)
+
+// AnnounceBatchConfig defines batching of announces, where each announce tick
+// announces several torrents to the tracker in a single request instead of
+// one. Agents with many active torrents thus refresh their peers more often
+// without increasing the number of requests to the tracker.
+type AnnounceBatchConfig struct {
+	Enabled bool `yaml:"enabled"`
+
+	// MaxSize bounds the number of torrents announced per tick.
+	MaxSize int `yaml:"max_size"`
+}
+
+func (c AnnounceBatchConfig) applyDefaults() AnnounceBatchConfig {
+	if c.MaxSize == 0 {
+		c.MaxSize = 16
+	}
+	return c
+}
+
+// announceBatch announces every torrent of announces and communicates the
+// result of each via events.
+func (s *scheduler) announceBatch(announces []announceclient.BatchAnnounce) {
+	results := s.announcer.AnnounceBatch(announces)
+	for i, r := range results {
+		h := announces[i].InfoHash
+		if r.Err != nil {
+			if r.Err != announceclient.ErrDisabled {
+				s.eventLoop.send(announceErrEvent{h, r.Err})
+			}
+			continue
+		}
+		s.eventLoop.send(announceResultEvent{h, r.Response.Peers, r.Response.PieceOffset})
+	}
+}
+
+// nextAnnounceBatch pulls up to max announceable torrents off the announce
+// queue. Saturated torrents are skipped and returned separately, such that they
+// may be re-enqueued.
+func (s *state) nextAnnounceBatch(max int) (batch []announceclient.BatchAnnounce, skipped []core.InfoHash) {
+	for len(batch) < max {
+		h, ok := s.announceQueue.Next()
+		if !ok {
+			break
+		}
+		if s.conns.Saturated(h) {
+			s.log("hash", h).Debug("Skipping announce for fully saturated torrent")
+			skipped = append(skipped, h)
+			continue
+		}
+		ctrl, ok := s.torrentControls[h]
+		if !ok {
+			s.log("hash", h).Error("Pulled unknown torrent off announce queue")
+			continue
+		}
+		batch = append(batch, announceclient.BatchAnnounce{
+			Digest:   ctrl.dispatcher.Digest(),
+			InfoHash: ctrl.dispatcher.InfoHash(),
+			Complete: ctrl.dispatcher.Complete(),
+		})
+	}
+	return batch, skipped
+}
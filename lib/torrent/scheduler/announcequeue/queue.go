@@ -25,6 +25,7 @@ type Queue interface {
 	Add(core.InfoHash)
 	Ready(core.InfoHash)
 	Eject(core.InfoHash)
+	Len() int
 }
 
 // QueueImpl is the primary implementation of Queue. QueueImpl is not thread
@@ -87,6 +88,11 @@ func (q *QueueImpl) Eject(h core.InfoHash) {
 	}
 }
 
+// Len returns the number of torrents ready to announce.
+func (q *QueueImpl) Len() int {
+	return q.readyQueue.Len()
+}
+
 // DisabledQueue is a Queue which ignores all input and constantly returns that
 // there are no torrents in the queue. Suitable for origin peers which want to
 // disable announcing.
@@ -108,3 +114,6 @@ func (q DisabledQueue) Ready(core.InfoHash) {}
 
 // Eject noops.
 func (q DisabledQueue) Eject(core.InfoHash) {}
+
+// Len always returns 0.
+func (q DisabledQueue) Len() int { return 0 }
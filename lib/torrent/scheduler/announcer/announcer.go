@@ -85,14 +85,46 @@ func Default(
 }
 
 // Announce announces through the underlying client and returns the resulting
-// peer handout. Updates the announce interval if it has changed.
+// peer handout and hints. Updates the announce interval if it has changed.
 func (a *Announcer) Announce(
-	d core.Digest, h core.InfoHash, complete bool) ([]*core.PeerInfo, error) {
+	d core.Digest, h core.InfoHash, complete bool) (*announceclient.Response, error) {
 
-	peers, interval, err := a.client.Announce(d, h, complete, announceclient.V2)
+	resp, err := a.client.Announce(d, h, complete, announceclient.V2)
 	if err != nil {
 		return nil, err
 	}
+	a.updateInterval(resp)
+	return resp, nil
+}
+
+// AnnounceBatch announces every torrent of announces, in a single request per
+// tracker if the underlying client supports batching, and one by one
+// otherwise. Returns one result per announce in the same order. Updates the
+// announce interval if it has changed.
+func (a *Announcer) AnnounceBatch(
+	announces []announceclient.BatchAnnounce) []announceclient.BatchAnnounceResult {
+
+	var results []announceclient.BatchAnnounceResult
+	if bc, ok := a.client.(announceclient.BatchClient); ok {
+		results = bc.AnnounceBatch(announces)
+	} else {
+		results = make([]announceclient.BatchAnnounceResult, len(announces))
+		for i, an := range announces {
+			resp, err := a.client.Announce(an.Digest, an.InfoHash, an.Complete, announceclient.V2)
+			results[i] = announceclient.BatchAnnounceResult{Response: resp, Err: err}
+		}
+	}
+	for _, r := range results {
+		if r.Err == nil {
+			a.updateInterval(r.Response)
+			break
+		}
+	}
+	return results
+}
+
+func (a *Announcer) updateInterval(resp *announceclient.Response) {
+	interval := resp.Interval
 	if interval == 0 {
 		// Protect against unset intervals.
 		interval = a.config.DefaultInterval
@@ -107,7 +139,6 @@ func (a *Announcer) Announce(
 		// Note: updated interval will take effect after next tick.
 		a.logger.Infof("Announce interval updated to %s", interval)
 	}
-	return peers, nil
 }
 
 // Ticker emits AnnounceTick events at the current announce interval, which may be
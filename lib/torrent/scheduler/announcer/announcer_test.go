@@ -97,11 +97,12 @@ func TestAnnouncerAnnounceUpdatesInterval(t *testing.T) {
 	interval := 10 * time.Second
 	peers := []*core.PeerInfo{core.PeerInfoFixture()}
 
-	mocks.client.EXPECT().Announce(d, hash, false, announceclient.V2).Return(peers, interval, nil)
+	mocks.client.EXPECT().Announce(d, hash, false, announceclient.V2).Return(
+		&announceclient.Response{Peers: peers, Interval: interval}, nil)
 
 	result, err := announcer.Announce(d, hash, false)
 	require.NoError(err)
-	require.Equal(peers, result)
+	require.Equal(peers, result.Peers)
 
 	mocks.clk.Add(config.DefaultInterval)
 	mocks.events.expectTick(t)
@@ -129,8 +130,37 @@ func TestAnnouncerAnnounceErr(t *testing.T) {
 	hash := core.InfoHashFixture()
 	err := errors.New("some error")
 
-	mocks.client.EXPECT().Announce(d, hash, false, announceclient.V2).Return(nil, time.Duration(0), err)
+	mocks.client.EXPECT().Announce(d, hash, false, announceclient.V2).Return(nil, err)
 
 	_, aErr := announcer.Announce(d, hash, false)
 	require.Equal(err, aErr)
 }
+
+func TestAnnouncerAnnounceBatchFallsBackToSingleAnnounces(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newAnnouncerMocks(t)
+	defer cleanup()
+
+	announcer := mocks.newAnnouncer(Config{})
+
+	d1 := core.DigestFixture()
+	h1 := core.InfoHashFixture()
+	d2 := core.DigestFixture()
+	h2 := core.InfoHashFixture()
+	peers := []*core.PeerInfo{core.PeerInfoFixture()}
+	err := errors.New("some error")
+
+	mocks.client.EXPECT().Announce(d1, h1, false, announceclient.V2).Return(nil, err)
+	mocks.client.EXPECT().Announce(d2, h2, true, announceclient.V2).Return(
+		&announceclient.Response{Peers: peers, Interval: time.Second}, nil)
+
+	results := announcer.AnnounceBatch([]announceclient.BatchAnnounce{
+		{Digest: d1, InfoHash: h1, Complete: false},
+		{Digest: d2, InfoHash: h2, Complete: true},
+	})
+	require.Len(results, 2)
+	require.Equal(err, results[0].Err)
+	require.NoError(results[1].Err)
+	require.Equal(peers, results[1].Response.Peers)
+}
@@ -60,6 +60,14 @@ type Config struct {
 
 	Dispatch dispatch.Config `yaml:"dispatch"`
 
+	PeerExchange PeerExchangeConfig `yaml:"peer_exchange"`
+
+	SourcePolicy SourcePolicyConfig `yaml:"source_policy"`
+
+	NetworkPolicy NetworkPolicyConfig `yaml:"network_policy"`
+
+	AnnounceBatch AnnounceBatchConfig `yaml:"announce_batch"`
+
 	TorrentLog log.Config `yaml:"torrentlog"`
 	Log        log.Config `yaml:"log"`
 }
@@ -86,5 +94,7 @@ func (c Config) applyDefaults() Config {
 	if c.ProbeTimeout == 0 {
 		c.ProbeTimeout = 3 * time.Second
 	}
+	c.PeerExchange = c.PeerExchange.applyDefaults()
+	c.AnnounceBatch = c.AnnounceBatch.applyDefaults()
 	return c
 }
@@ -20,6 +20,7 @@ import (
 
 	"github.com/uber/kraken/core"
 	"github.com/uber/kraken/gen/go/proto/p2p"
+	"github.com/uber/kraken/lib/faults"
 	"github.com/uber/kraken/lib/torrent/networkevent"
 	"github.com/uber/kraken/lib/torrent/storage"
 	"github.com/uber/kraken/utils/bandwidth"
@@ -192,6 +193,16 @@ type Handshaker struct {
 	networkEvents networkevent.Producer
 	peerID        core.PeerID
 	events        Events
+	faults        *faults.Injector
+}
+
+// HandshakerOption allows setting optional Handshaker parameters.
+type HandshakerOption func(*Handshaker)
+
+// WithFaultInjector configures f to fail or delay connections. Dials are named
+// "conn.dial" and accepts "conn.accept", both keyed by the remote address.
+func WithFaultInjector(f *faults.Injector) HandshakerOption {
+	return func(h *Handshaker) { h.faults = f }
 }
 
 // NewHandshaker creates a new Handshaker.
@@ -202,7 +213,8 @@ func NewHandshaker(
 	networkEvents networkevent.Producer,
 	peerID core.PeerID,
 	events Events,
-	logger *zap.SugaredLogger) (*Handshaker, error) {
+	logger *zap.SugaredLogger,
+	opts ...HandshakerOption) (*Handshaker, error) {
 
 	config = config.applyDefaults()
 
@@ -215,7 +227,7 @@ func NewHandshaker(
 		return nil, fmt.Errorf("bandwidth: %s", err)
 	}
 
-	return &Handshaker{
+	h := &Handshaker{
 		config:        config,
 		stats:         stats,
 		clk:           clk,
@@ -223,12 +235,19 @@ func NewHandshaker(
 		networkEvents: networkEvents,
 		peerID:        peerID,
 		events:        events,
-	}, nil
+	}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h, nil
 }
 
 // Accept upgrades a raw network connection opened by a remote peer into a
 // PendingConn.
 func (h *Handshaker) Accept(nc net.Conn) (*PendingConn, error) {
+	if err := h.faults.Fault("conn.accept", nc.RemoteAddr().String()); err != nil {
+		return nil, err
+	}
 	hs, err := h.readHandshake(nc)
 	if err != nil {
 		return nil, fmt.Errorf("read handshake: %s", err)
@@ -265,6 +284,9 @@ func (h *Handshaker) Initialize(
 	remoteBitfields RemoteBitfields,
 	namespace string) (*HandshakeResult, error) {
 
+	if err := h.faults.Fault("conn.dial", addr); err != nil {
+		return nil, err
+	}
 	nc, err := net.DialTimeout("tcp", addr, h.config.HandshakeTimeout)
 	if err != nil {
 		return nil, fmt.Errorf("dial: %s", err)
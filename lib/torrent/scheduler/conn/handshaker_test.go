@@ -19,10 +19,15 @@ import (
 	"testing"
 	"time"
 
+	"github.com/andres-erbsen/clock"
 	"github.com/stretchr/testify/require"
+	"github.com/uber-go/tally"
+	"go.uber.org/zap"
 
 	"github.com/uber/kraken/core"
 	"github.com/uber/kraken/gen/go/proto/p2p"
+	"github.com/uber/kraken/lib/faults"
+	"github.com/uber/kraken/lib/torrent/networkevent"
 	"github.com/uber/kraken/lib/torrent/storage"
 	"github.com/uber/kraken/utils/bitsetutil"
 )
@@ -125,3 +130,39 @@ func TestHandshakerHandlesEmptyBitfield(t *testing.T) {
 
 	wg.Wait()
 }
+
+func TestHandshakerInjectsDialFaults(t *testing.T) {
+	require := require.New(t)
+
+	l, err := net.Listen("tcp", "localhost:0")
+	require.NoError(err)
+	defer l.Close()
+
+	f, err := faults.New(faults.Config{
+		Enabled: true,
+		Rules: []faults.Rule{{
+			Target: "conn.dial",
+			Key:    l.Addr().String(),
+			Action: faults.ActionFail,
+			Limit:  1,
+		}},
+	}, tally.NoopScope)
+	require.NoError(err)
+
+	h, err := NewHandshaker(
+		ConfigFixture(),
+		tally.NoopScope,
+		clock.New(),
+		networkevent.NewTestProducer(),
+		core.PeerIDFixture(),
+		noopEvents{},
+		zap.NewNop().Sugar(),
+		WithFaultInjector(f))
+	require.NoError(err)
+
+	info := storage.TorrentInfoFixture(4, 1)
+
+	_, err = h.Initialize(core.PeerIDFixture(), l.Addr().String(), info, nil, core.TagFixture())
+	require.Error(err)
+	require.True(faults.IsFault(err))
+}
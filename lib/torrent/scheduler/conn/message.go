@@ -21,6 +21,7 @@ import (
 	"time"
 
 	"github.com/golang/protobuf/proto"
+	"github.com/uber/kraken/core"
 	"github.com/uber/kraken/gen/go/proto/p2p"
 	"github.com/uber/kraken/lib/torrent/storage"
 )
@@ -96,6 +97,28 @@ func NewCompleteMessage() *Message {
 	}
 }
 
+// NewPeerExchangeMessage returns a Message for gossiping peers.
+func NewPeerExchangeMessage(peers []*core.PeerInfo) *Message {
+	addrs := make([]*p2p.PeerAddress, len(peers))
+	for i, p := range peers {
+		addrs[i] = &p2p.PeerAddress{
+			PeerID:   p.PeerID.String(),
+			Ip:       p.IP,
+			Port:     int32(p.Port),
+			Origin:   p.Origin,
+			Complete: p.Complete,
+		}
+	}
+	return &Message{
+		Message: &p2p.Message{
+			Type: p2p.Message_PEER_EXCHANGE,
+			PeerExchange: &p2p.PeerExchangeMessage{
+				Peers: addrs,
+			},
+		},
+	}
+}
+
 func sendMessage(nc net.Conn, msg *p2p.Message) error {
 	data, err := proto.Marshal(msg)
 	if err != nil {
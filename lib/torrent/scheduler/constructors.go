@@ -39,7 +39,8 @@ func NewAgentScheduler(
 	cads *store.CADownloadStore,
 	netevents networkevent.Producer,
 	trackers hashring.PassiveRing,
-	tls *tls.Config) (ReloadableScheduler, error) {
+	tls *tls.Config,
+	opts ...Option) (ReloadableScheduler, error) {
 
 	s, err := newScheduler(
 		config,
@@ -47,7 +48,8 @@ func NewAgentScheduler(
 		stats,
 		pctx,
 		announceclient.New(pctx, trackers, tls),
-		netevents)
+		netevents,
+		opts...)
 	if err != nil {
 		return nil, fmt.Errorf("new scheduler: %s", err)
 	}
@@ -66,17 +68,28 @@ func NewOriginScheduler(
 	config Config,
 	stats tally.Scope,
 	pctx core.PeerContext,
-	cas *store.CAStore,
+	cas store.Driver,
 	netevents networkevent.Producer,
-	blobRefresher *blobrefresh.Refresher) (ReloadableScheduler, error) {
+	blobRefresher *blobrefresh.Refresher,
+	opts ...Option) (ReloadableScheduler, error) {
+
+	var o schedOverrides
+	for _, opt := range opts {
+		opt(&o)
+	}
+	var archiveOpts []originstorage.Option
+	if o.onSeed != nil {
+		archiveOpts = append(archiveOpts, originstorage.WithSeedHook(o.onSeed))
+	}
 
 	s, err := newScheduler(
 		config,
-		originstorage.NewTorrentArchive(cas, blobRefresher),
+		originstorage.NewTorrentArchive(cas, blobRefresher, archiveOpts...),
 		stats,
 		pctx,
 		announceclient.Disabled(),
-		netevents)
+		netevents,
+		opts...)
 	if err != nil {
 		return nil, err
 	}
@@ -41,6 +41,10 @@ type Config struct {
 	// at the same time.
 	PipelineLimit int `yaml:"pipeline_limit"`
 
+	// AdaptiveDepth adjusts the pipeline limit of each peer to its observed
+	// round-trip times and failures, starting at PipelineLimit.
+	AdaptiveDepth piecerequest.AdaptiveDepthConfig `yaml:"adaptive_depth"`
+
 	// EndgameThreshold is the number pieces required to complete the torrent
 	// before the torrent enters "endgame", where we start overloading piece
 	// requests to multiple peers.
@@ -29,6 +29,7 @@ import (
 	"github.com/uber/kraken/utils/syncutil"
 
 	"github.com/andres-erbsen/clock"
+	"github.com/docker/distribution/uuid"
 	"github.com/uber-go/tally"
 	"github.com/willf/bitset"
 	"go.uber.org/zap"
@@ -42,10 +43,14 @@ var (
 	errRepeatedBitfieldMessage = errors.New("received repeated bitfield message")
 )
 
+// ErrInvalidRange is wrapped by errors of ranges which are not within the blob.
+var ErrInvalidRange = errors.New("invalid range")
+
 // Events defines Dispatcher events.
 type Events interface {
 	DispatcherComplete(*Dispatcher)
 	PeerRemoved(core.PeerID, core.InfoHash)
+	PeerExchangeReceived(core.PeerID, core.InfoHash, *p2p.PeerExchangeMessage)
 }
 
 // Messages defines a subset of conn.Conn methods which Dispatcher requires to
@@ -69,7 +74,9 @@ type Dispatcher struct {
 	peers                 syncmap.Map // core.PeerID -> *peer
 	peerStats             syncmap.Map // core.PeerID -> *peerStats, persists on peer removal.
 	numPeersByPiece       syncutil.Counters
+	replicatedPieces      *syncBitfield // Pieces which any peer was observed to hold.
 	netevents             networkevent.Producer
+	traceID               string // Set if the producer traces pieces.
 	pieceRequestTimeout   time.Duration
 	pieceRequestManager   *piecerequest.Manager
 	pendingPiecesDoneOnce sync.Once
@@ -127,11 +134,19 @@ func newDispatcher(
 
 	pieceRequestTimeout := config.calcPieceRequestTimeout(t.MaxPieceLength())
 	pieceRequestManager, err := piecerequest.NewManager(
-		clk, pieceRequestTimeout, config.PieceRequestPolicy, config.PipelineLimit)
+		clk, pieceRequestTimeout, config.PieceRequestPolicy, config.PipelineLimit,
+		piecerequest.WithAdaptiveDepth(config.AdaptiveDepth))
 	if err != nil {
 		return nil, fmt.Errorf("piece request manager: %s", err)
 	}
 
+	// Pieces are traced if the producer keeps traces, which it only does if
+	// piece tracing is enabled.
+	var traceID string
+	if _, ok := netevents.(networkevent.PieceTracer); ok {
+		traceID = uuid.Generate().String()
+	}
+
 	return &Dispatcher{
 		config:              config,
 		stats:               stats,
@@ -140,7 +155,9 @@ func newDispatcher(
 		localPeerID:         peerID,
 		torrent:             newTorrentAccessWatcher(t, clk),
 		numPeersByPiece:     syncutil.NewCounters(t.NumPieces()),
+		replicatedPieces:    newSyncBitfield(bitset.New(uint(t.NumPieces()))),
 		netevents:           netevents,
+		traceID:             traceID,
 		pieceRequestTimeout: pieceRequestTimeout,
 		pieceRequestManager: pieceRequestManager,
 		pendingPiecesDone:   make(chan struct{}),
@@ -230,6 +247,12 @@ func (d *Dispatcher) RemoteBitfields() conn.RemoteBitfields {
 	return remoteBitfields
 }
 
+// ReplicatedPieces returns the pieces which any peer has been observed to hold,
+// including peers which have since disconnected.
+func (d *Dispatcher) ReplicatedPieces() *bitset.BitSet {
+	return d.replicatedPieces.Copy()
+}
+
 // AddPeer registers a new peer with the Dispatcher.
 func (d *Dispatcher) AddPeer(
 	peerID core.PeerID, b *bitset.BitSet, messages Messages) error {
@@ -260,6 +283,7 @@ func (d *Dispatcher) addPeer(
 
 	for _, i := range p.bitfield.GetAllSet() {
 		d.numPeersByPiece.Increment(int(i))
+		d.replicatedPieces.Set(i, true)
 	}
 	return p, nil
 }
@@ -274,6 +298,43 @@ func (d *Dispatcher) removePeer(p *peer) error {
 	return nil
 }
 
+// PrioritizeRange hints that the length bytes of the blob starting at offset
+// are needed first, such that pieces covering the range are requested ahead of
+// all others. Replaces any previous hint, thus consumers may move the range
+// forward as they read.
+func (d *Dispatcher) PrioritizeRange(offset, length int64) error {
+	if offset < 0 || length <= 0 || offset+length > d.torrent.Length() {
+		return fmt.Errorf(
+			"%w [%d, %d) for blob of length %d", ErrInvalidRange, offset, offset+length, d.torrent.Length())
+	}
+	first := offset / d.torrent.MaxPieceLength()
+	last := (offset + length - 1) / d.torrent.MaxPieceLength()
+	priority := bitset.New(uint(d.torrent.NumPieces()))
+	for i := first; i <= last; i++ {
+		priority.Set(uint(i))
+	}
+	d.pieceRequestManager.SetPriority(priority)
+
+	// Request prioritized pieces from peers with spare pipeline capacity now,
+	// rather than waiting for in-flight requests to complete.
+	d.peers.Range(func(k, v interface{}) bool {
+		go d.maybeRequestMorePieces(v.(*peer))
+		return true
+	})
+	return nil
+}
+
+// SetInitialPiece hints that the first pieces should be requested starting at
+// piece offset, wrapped around the number of pieces, rather than as selected by
+// the piece selection policy. Only applies to the first reservation of pieces:
+// hints arriving once pieces were requested are ignored.
+func (d *Dispatcher) SetInitialPiece(offset int) {
+	if offset < 0 || d.torrent.NumPieces() == 0 {
+		return
+	}
+	d.pieceRequestManager.SetInitialPiece(offset % d.torrent.NumPieces())
+}
+
 // TearDown closes all Dispatcher connections.
 func (d *Dispatcher) TearDown() {
 	d.pendingPiecesDoneOnce.Do(func() {
@@ -382,7 +443,7 @@ func (d *Dispatcher) maybeSendPieceRequests(p *peer, candidates *bitset.BitSet)
 			d.pieceRequestManager.MarkUnsent(p.id, i)
 			return false, err
 		}
-		d.netevents.Produce(
+		d.produce(
 			networkevent.RequestPieceEvent(d.torrent.InfoHash(), d.localPeerID, p.id, i))
 			p.pstats.incrementPieceRequestsSent()
 		}
@@ -463,6 +524,8 @@ func (d *Dispatcher) dispatch(p *peer, msg *conn.Message) error {
 		d.handleBitfield(p, msg.Message.Bitfield)
 	case p2p.Message_COMPLETE:
 		d.handleComplete(p)
+	case p2p.Message_PEER_EXCHANGE:
+		d.events.PeerExchangeReceived(p.id, d.torrent.InfoHash(), msg.Message.PeerExchange)
 	default:
 		return fmt.Errorf("unknown message type: %d", msg.Message.Type)
 	}
@@ -485,6 +548,7 @@ func (d *Dispatcher) handleAnnouncePiece(p *peer, msg *p2p.AnnouncePieceMessage)
 	i := int(msg.Index)
 	p.bitfield.Set(uint(i), true)
 	d.numPeersByPiece.Increment(int(i))
+	d.replicatedPieces.Set(uint(i), true)
 
 	d.maybeRequestMorePieces(p)
 }
@@ -516,9 +580,13 @@ func (d *Dispatcher) handlePieceRequest(p *peer, msg *p2p.PieceRequestMessage) {
 
 	p.touchLastPieceSent()
 	p.pstats.incrementPiecesSent()
+	if d.tracing() {
+		d.produce(networkevent.SharePieceEvent(d.torrent.InfoHash(), d.localPeerID, p.id, i))
+	}
 
 	// Assume that the peer successfully received the piece.
 	p.bitfield.Set(uint(i), true)
+	d.replicatedPieces.Set(uint(i), true)
 }
 
 func (d *Dispatcher) handlePiecePayload(
@@ -533,6 +601,12 @@ func (d *Dispatcher) handlePiecePayload(
 		return
 	}
 
+	// Traces distinguish receiving a piece from verifying it, such that pieces
+	// which fail verification are visible.
+	if d.tracing() {
+		d.produce(networkevent.ReceivePieceEvent(d.torrent.InfoHash(), d.localPeerID, p.id, i))
+	}
+
 	if err := d.torrent.WritePiece(payload, i); err != nil {
 		if err != storage.ErrPieceComplete {
 			d.log("peer", p, "piece", i).Errorf("Error writing piece payload: %s", err)
@@ -543,9 +617,13 @@ func (d *Dispatcher) handlePiecePayload(
 		return
 	}
 
-	d.netevents.Produce(
-		networkevent.ReceivePieceEvent(d.torrent.InfoHash(), d.localPeerID, p.id, i))
+	if d.tracing() {
+		d.produce(networkevent.VerifyPieceEvent(d.torrent.InfoHash(), d.localPeerID, p.id, i))
+	} else {
+		d.produce(networkevent.ReceivePieceEvent(d.torrent.InfoHash(), d.localPeerID, p.id, i))
+	}
 
+	d.pieceRequestManager.MarkReceived(p.id, i)
 	p.pstats.incrementGoodPiecesReceived()
 	p.touchLastGoodPieceReceived()
 	if d.torrent.Complete() {
@@ -579,6 +657,7 @@ func (d *Dispatcher) handleBitfield(p *peer, msg *p2p.BitfieldMessage) {
 }
 
 func (d *Dispatcher) handleComplete(p *peer) {
+	d.replicatedPieces.SetAll(true)
 	if d.Complete() {
 		d.log("peer", p).Info("Closing connection to completed peer")
 		p.messages.Close()
@@ -588,6 +667,20 @@ func (d *Dispatcher) handleComplete(p *peer) {
 	}
 }
 
+// tracing returns true if the pieces of d are traced.
+func (d *Dispatcher) tracing() bool {
+	return d.traceID != ""
+}
+
+// produce emits e, attaching the trace of d if its pieces are traced.
+func (d *Dispatcher) produce(e *networkevent.Event) {
+	if d.tracing() {
+		e.TraceID = d.traceID
+		e.Digest = d.torrent.Digest().String()
+	}
+	d.netevents.Produce(e)
+}
+
 func (d *Dispatcher) log(args ...interface{}) *zap.SugaredLogger {
 	args = append(args, "torrent", d.torrent)
 	return d.logger.With(args...)
@@ -104,6 +104,8 @@ func (e noopEvents) DispatcherComplete(*Dispatcher) {}
 
 func (e noopEvents) PeerRemoved(core.PeerID, core.InfoHash) {}
 
+func (e noopEvents) PeerExchangeReceived(core.PeerID, core.InfoHash, *p2p.PeerExchangeMessage) {}
+
 func testDispatcher(config Config, clk clock.Clock, t storage.Torrent) *Dispatcher {
 	d, err := newDispatcher(
 		config,
@@ -472,3 +474,107 @@ func TestDispatcherPeerPieceCounts(t *testing.T) {
 	require.Equal(1, d.numPeersByPiece.Get(1))
 	require.Equal(2, d.numPeersByPiece.Get(2))
 }
+
+func TestDispatcherRequestsPrioritizedRangeFirst(t *testing.T) {
+	require := require.New(t)
+
+	// 10 pieces of 4 bytes each.
+	blob := core.SizedBlobFixture(40, 4)
+
+	torrent, cleanup := agentstorage.TorrentFixture(blob.MetaInfo)
+	defer cleanup()
+
+	d := testDispatcher(Config{PipelineLimit: 3}, clock.NewMock(), torrent)
+
+	// Bytes [22, 31) are covered by pieces 5, 6 and 7.
+	require.NoError(d.PrioritizeRange(22, 9))
+
+	p, err := d.addPeer(core.PeerIDFixture(), bitset.New(10).Complement(), newMockMessages())
+	require.NoError(err)
+
+	sent, err := d.maybeRequestMorePieces(p)
+	require.NoError(err)
+	require.True(sent)
+
+	var requested []int
+	for _, msg := range p.messages.(*mockMessages).sent {
+		requested = append(requested, int(msg.Message.PieceRequest.Index))
+	}
+	require.Equal([]int{5, 6, 7}, requested)
+}
+
+func TestDispatcherPrioritizeRangeInvalid(t *testing.T) {
+	require := require.New(t)
+
+	blob := core.SizedBlobFixture(40, 4)
+
+	torrent, cleanup := agentstorage.TorrentFixture(blob.MetaInfo)
+	defer cleanup()
+
+	d := testDispatcher(Config{}, clock.NewMock(), torrent)
+
+	require.True(errors.Is(d.PrioritizeRange(-1, 4), ErrInvalidRange))
+	require.True(errors.Is(d.PrioritizeRange(0, 0), ErrInvalidRange))
+	require.True(errors.Is(d.PrioritizeRange(36, 5), ErrInvalidRange))
+}
+
+func TestDispatcherTracesPieceFlow(t *testing.T) {
+	require := require.New(t)
+
+	blob := core.SizedBlobFixture(4, 1)
+
+	torrent, cleanup := agentstorage.TorrentFixture(blob.MetaInfo)
+	defer cleanup()
+
+	producer, err := networkevent.NewProducer(networkevent.Config{
+		PieceTrace: networkevent.PieceTraceConfig{Enabled: true},
+	})
+	require.NoError(err)
+	tracer := producer.(networkevent.PieceTracer)
+
+	d, err := newDispatcher(
+		Config{PipelineLimit: 4},
+		tally.NoopScope,
+		clock.NewMock(),
+		producer,
+		noopEvents{},
+		core.PeerIDFixture(),
+		torrent,
+		zap.NewNop().Sugar(),
+		torrentlog.NewNopLogger())
+	require.NoError(err)
+
+	p, err := d.addPeer(core.PeerIDFixture(), bitsetutil.FromBools(true, true, true, true), newMockMessages())
+	require.NoError(err)
+
+	d.maybeRequestMorePieces(p)
+	require.Len(numRequestsPerPiece(p.messages), 4)
+
+	for i := 0; i < 4; i++ {
+		msg := conn.NewPiecePayloadMessage(i, piecereader.NewBuffer(blob.Content[i:i+1]))
+		require.NoError(d.dispatch(p, msg))
+	}
+	require.True(torrent.Complete())
+
+	events, ok := tracer.PieceTrace(blob.Digest)
+	require.True(ok)
+
+	flows := make(map[int][]networkevent.Name)
+	traceIDs := make(map[string]bool)
+	for _, e := range events {
+		require.Equal(blob.Digest.String(), e.Digest)
+		traceIDs[e.TraceID] = true
+		flows[e.Piece] = append(flows[e.Piece], e.Name)
+	}
+	require.Len(traceIDs, 1)
+	for i := 0; i < 4; i++ {
+		require.Equal([]networkevent.Name{
+			networkevent.RequestPiece,
+			networkevent.ReceivePiece,
+			networkevent.VerifyPiece,
+		}, flows[i], "piece %d", i)
+	}
+
+	_, ok = tracer.PieceTrace(core.DigestFixture())
+	require.False(ok)
+}
@@ -0,0 +1,112 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package piecerequest
+
+import (
+	"time"
+)
+
+// AdaptiveDepthConfig defines adjustment of the number of outstanding piece
+// requests per peer. Depth grows additively while pieces are received and is
+// cut multiplicatively once a peer rejects requests, lets them expire, or
+// responds much slower than usual.
+type AdaptiveDepthConfig struct {
+	Enabled bool `yaml:"enabled"`
+
+	// MinDepth and MaxDepth bound the outstanding requests per peer.
+	MinDepth int `yaml:"min_depth"`
+	MaxDepth int `yaml:"max_depth"`
+
+	// Backoff is the factor depth is multiplied with on congestion.
+	Backoff float64 `yaml:"backoff"`
+
+	// SlowRTTFactor is the multiple of a peer's smoothed round-trip time above
+	// which a response is treated as congestion.
+	SlowRTTFactor float64 `yaml:"slow_rtt_factor"`
+}
+
+func (c AdaptiveDepthConfig) applyDefaults() AdaptiveDepthConfig {
+	if c.MinDepth == 0 {
+		c.MinDepth = 1
+	}
+	if c.MaxDepth == 0 {
+		c.MaxDepth = 32
+	}
+	if c.MaxDepth < c.MinDepth {
+		c.MaxDepth = c.MinDepth
+	}
+	if c.Backoff == 0 {
+		c.Backoff = 0.5
+	}
+	if c.SlowRTTFactor == 0 {
+		c.SlowRTTFactor = 3
+	}
+	return c
+}
+
+// depthController is an AIMD controller of the request depth of a single peer.
+// Not thread-safe.
+type depthController struct {
+	config      AdaptiveDepthConfig
+	depth       float64
+	srtt        time.Duration
+	lastBackoff time.Time
+}
+
+func newDepthController(config AdaptiveDepthConfig, initial int) *depthController {
+	c := &depthController{config: config, depth: float64(initial)}
+	c.clamp()
+	return c
+}
+
+// limit returns the current number of requests which may be outstanding.
+func (c *depthController) limit() int {
+	return int(c.depth)
+}
+
+// onSuccess records a piece received rtt after it was requested. Depth grows
+// by one per round trip of successful requests.
+func (c *depthController) onSuccess(now time.Time, rtt time.Duration) {
+	if c.srtt > 0 && float64(rtt) > c.config.SlowRTTFactor*float64(c.srtt) {
+		c.onCongestion(now)
+	} else {
+		c.depth += 1 / c.depth
+		c.clamp()
+	}
+	if c.srtt == 0 {
+		c.srtt = rtt
+	} else {
+		c.srtt = (7*c.srtt + rtt) / 8
+	}
+}
+
+// onCongestion cuts depth. Signals within a round trip of the last cut are
+// ignored, since they usually stem from the same burst of requests.
+func (c *depthController) onCongestion(now time.Time) {
+	if !c.lastBackoff.IsZero() && now.Sub(c.lastBackoff) < c.srtt {
+		return
+	}
+	c.lastBackoff = now
+	c.depth *= c.config.Backoff
+	c.clamp()
+}
+
+func (c *depthController) clamp() {
+	if c.depth < float64(c.config.MinDepth) {
+		c.depth = float64(c.config.MinDepth)
+	}
+	if c.depth > float64(c.config.MaxDepth) {
+		c.depth = float64(c.config.MaxDepth)
+	}
+}
@@ -0,0 +1,218 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package piecerequest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/stretchr/testify/require"
+	"github.com/willf/bitset"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/utils/bitsetutil"
+	"github.com/uber/kraken/utils/syncutil"
+)
+
+func TestDepthControllerAIMD(t *testing.T) {
+	require := require.New(t)
+
+	config := AdaptiveDepthConfig{MinDepth: 1, MaxDepth: 8}.applyDefaults()
+	c := newDepthController(config, 2)
+	now := time.Now()
+
+	// Depth grows by about one per round trip of successes.
+	for i := 0; i < 3; i++ {
+		c.onSuccess(now, 10*time.Millisecond)
+	}
+	require.Equal(3, c.limit())
+
+	// Growth is bounded by MaxDepth.
+	for i := 0; i < 100; i++ {
+		c.onSuccess(now, 10*time.Millisecond)
+	}
+	require.Equal(8, c.limit())
+
+	// Congestion halves depth, at most once per round trip.
+	now = now.Add(time.Second)
+	c.onCongestion(now)
+	require.Equal(4, c.limit())
+	c.onCongestion(now.Add(time.Millisecond))
+	require.Equal(4, c.limit())
+
+	// Responses much slower than the smoothed round trip are congestion.
+	now = now.Add(time.Second)
+	c.onSuccess(now, time.Second)
+	require.Equal(2, c.limit())
+
+	// Depth never drops below MinDepth.
+	for i := 0; i < 10; i++ {
+		now = now.Add(time.Hour)
+		c.onCongestion(now)
+	}
+	require.Equal(1, c.limit())
+}
+
+func TestManagerAdaptiveDepthBacksOffOnInvalidRequest(t *testing.T) {
+	require := require.New(t)
+
+	clk := clock.NewMock()
+	m, err := NewManager(clk, 5*time.Second, DefaultPolicy, 4,
+		WithAdaptiveDepth(AdaptiveDepthConfig{Enabled: true}))
+	require.NoError(err)
+
+	peerID := core.PeerIDFixture()
+	all := bitsetutil.FromBools(true, true, true, true, true, true, true, true)
+	counts := syncutil.NewCounters(8)
+
+	pieces, err := m.ReservePieces(peerID, all, counts, false)
+	require.NoError(err)
+	require.Len(pieces, 4)
+
+	m.MarkInvalid(peerID, pieces[0])
+	for _, i := range pieces {
+		m.Clear(i)
+	}
+
+	pieces, err = m.ReservePieces(peerID, all, counts, false)
+	require.NoError(err)
+	require.Len(pieces, 2)
+}
+
+// simulatedClock is a clock whose time only moves when set, without yielding
+// to other goroutines like clock.Mock does.
+type simulatedClock struct {
+	clock.Clock
+	now time.Time
+}
+
+func (c *simulatedClock) Now() time.Time { return c.now }
+
+// simulatedPeer serves piece requests in order at a fixed rate, behind a link
+// whose round-trip time varies over time. Requests arriving while the queue
+// of the peer is full are rejected.
+type simulatedPeer struct {
+	service  time.Duration
+	maxQueue int
+	rtt      func(elapsed time.Duration) time.Duration
+
+	free   time.Time
+	events []simulatedResponse
+}
+
+type simulatedResponse struct {
+	piece    int
+	at       time.Time
+	rejected bool
+}
+
+func (p *simulatedPeer) request(now time.Time, elapsed time.Duration, piece int) {
+	rtt := p.rtt(elapsed)
+	arrival := now.Add(rtt / 2)
+	var queued int
+	if p.free.After(arrival) {
+		queued = int(p.free.Sub(arrival) / p.service)
+	}
+	if queued >= p.maxQueue {
+		p.events = append(p.events, simulatedResponse{piece, now.Add(rtt), true})
+		return
+	}
+	start := arrival
+	if p.free.After(start) {
+		start = p.free
+	}
+	p.free = start.Add(p.service)
+	p.events = append(p.events, simulatedResponse{piece, p.free.Add(rtt / 2), false})
+}
+
+// simulateUtilization downloads pieces from a simulated peer and returns the
+// fraction of the peer's capacity which was used.
+func simulateUtilization(t *testing.T, opts ...Option) float64 {
+	const (
+		numPieces = 256
+		service   = 2 * time.Millisecond
+		duration  = 6 * time.Second
+	)
+
+	start := time.Now()
+	clk := &simulatedClock{clock.New(), start}
+
+	m, err := NewManager(clk, 5*time.Second, DefaultPolicy, 3, opts...)
+	require.NoError(t, err)
+
+	peer := &simulatedPeer{
+		service:  service,
+		maxQueue: 16,
+		rtt: func(elapsed time.Duration) time.Duration {
+			switch {
+			case elapsed < 2*time.Second:
+				return 20 * time.Millisecond
+			case elapsed < 4*time.Second:
+				return 120 * time.Millisecond
+			default:
+				return 40 * time.Millisecond
+			}
+		},
+	}
+	peerID := core.PeerIDFixture()
+	candidates := bitset.New(numPieces).Complement()
+	counts := syncutil.NewCounters(numPieces)
+
+	var received int
+	for elapsed := time.Duration(0); elapsed < duration; elapsed += time.Millisecond {
+		now := clk.Now()
+
+		var pending []simulatedResponse
+		for _, e := range peer.events {
+			if e.at.After(now) {
+				pending = append(pending, e)
+				continue
+			}
+			if e.rejected {
+				m.MarkInvalid(peerID, e.piece)
+			} else {
+				m.MarkReceived(peerID, e.piece)
+				received++
+			}
+			m.Clear(e.piece)
+		}
+		peer.events = pending
+
+		m.GetFailedRequests()
+
+		pieces, err := m.ReservePieces(peerID, candidates, counts, false)
+		require.NoError(t, err)
+		for _, i := range pieces {
+			peer.request(now, elapsed, i)
+		}
+
+		clk.now = start.Add(elapsed + time.Millisecond)
+	}
+	return float64(received) / float64(duration/service)
+}
+
+func TestAdaptiveDepthConvergesToHigherUtilizationThanFixedDepth(t *testing.T) {
+	require := require.New(t)
+
+	fixed := simulateUtilization(t)
+	adaptive := simulateUtilization(t, WithAdaptiveDepth(AdaptiveDepthConfig{
+		Enabled:  true,
+		MaxDepth: 64,
+	}))
+
+	t.Logf("Utilization with fixed depth: %.2f, adaptive depth: %.2f", fixed, adaptive)
+	require.True(adaptive > 2*fixed)
+	require.True(adaptive > 0.5)
+}
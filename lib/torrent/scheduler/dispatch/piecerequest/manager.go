@@ -50,6 +50,9 @@ type Request struct {
 	Status Status
 
 	sentAt time.Time
+
+	// congested is set once an expired request was reported as congestion.
+	congested bool
 }
 
 // Manager encapsulates thread-safe piece request bookkeeping. It is not responsible
@@ -66,6 +69,33 @@ type Manager struct {
 
 	policy        pieceSelectionPolicy
 	pipelineLimit int
+
+	// priority holds pieces which are reserved ahead of all other candidates.
+	priority *bitset.BitSet
+
+	// initial is the piece from which the first reservation is selected in
+	// order, if set. reserved is set once any piece was reserved.
+	initial  *int
+	reserved bool
+
+	// If set, the pipeline limit of each peer is adjusted by a controller,
+	// starting at pipelineLimit.
+	adaptive *AdaptiveDepthConfig
+	depths   map[core.PeerID]*depthController
+}
+
+// Option allows setting optional Manager parameters.
+type Option func(*Manager)
+
+// WithAdaptiveDepth adjusts the pipeline limit of each peer to its observed
+// round-trip times and failures. Does nothing if config is disabled.
+func WithAdaptiveDepth(config AdaptiveDepthConfig) Option {
+	return func(m *Manager) {
+		if config.Enabled {
+			config = config.applyDefaults()
+			m.adaptive = &config
+		}
+	}
 }
 
 // NewManager creates a new Manager.
@@ -73,7 +103,8 @@ func NewManager(
 	clk clock.Clock,
 	timeout time.Duration,
 	policy string,
-	pipelineLimit int) (*Manager, error) {
+	pipelineLimit int,
+	opts ...Option) (*Manager, error) {
 
 	m := &Manager{
 		requests:       make(map[int][]*Request),
@@ -81,6 +112,10 @@ func NewManager(
 		clock:          clk,
 		timeout:        timeout,
 		pipelineLimit:  pipelineLimit,
+		depths:         make(map[core.PeerID]*depthController),
+	}
+	for _, opt := range opts {
+		opt(m)
 	}
 
 	switch policy {
@@ -113,10 +148,47 @@ func (m *Manager) ReservePieces(
 	}
 
 	valid := func(i int) bool { return m.validRequest(peerID, i, allowDuplicates) }
-	pieces, err := m.policy.selectPieces(quota, valid, candidates, numPeersByPiece)
+
+	// Prioritized pieces are selected in order, since consumers hinting a
+	// range typically read it sequentially. The selection policy applies to
+	// the remaining quota.
+	var pieces []int
+	if m.priority != nil {
+		prioritized := candidates.Intersection(m.priority)
+		for i, e := prioritized.NextSet(0); e && len(pieces) < quota; i, e = prioritized.NextSet(i + 1) {
+			if valid(int(i)) {
+				pieces = append(pieces, int(i))
+			}
+		}
+		candidates = candidates.Difference(m.priority)
+	}
+	if m.initial != nil && !m.reserved {
+		// Select candidates in order from the initial piece, wrapping around.
+		n := int(candidates.Len())
+		var selected []int
+		for j := 0; j < n && len(pieces)+len(selected) < quota; j++ {
+			i := (*m.initial + j) % n
+			if candidates.Test(uint(i)) && valid(i) {
+				selected = append(selected, i)
+			}
+		}
+		if len(selected) > 0 {
+			candidates = candidates.Clone()
+			for _, i := range selected {
+				candidates.Clear(uint(i))
+			}
+			pieces = append(pieces, selected...)
+		}
+	}
+	rest, err := m.policy.selectPieces(quota-len(pieces), valid, candidates, numPeersByPiece)
 	if err != nil {
 		return nil, err
 	}
+	pieces = append(pieces, rest...)
+	if len(pieces) > 0 {
+		m.reserved = true
+		m.initial = nil
+	}
 
 	// Set as pending in requests map.
 	for _, i := range pieces {
@@ -136,6 +208,32 @@ func (m *Manager) ReservePieces(
 	return pieces, nil
 }
 
+// SetPriority sets pieces which are reserved ahead of all other candidates,
+// replacing any previous priority. A nil or empty set clears the priority.
+func (m *Manager) SetPriority(pieces *bitset.BitSet) {
+	m.Lock()
+	defer m.Unlock()
+
+	if pieces == nil || pieces.None() {
+		m.priority = nil
+		return
+	}
+	m.priority = pieces.Clone()
+}
+
+// SetInitialPiece sets the piece from which the first reservation is selected
+// in order, ahead of the selection policy. Has no effect once any piece was
+// reserved.
+func (m *Manager) SetInitialPiece(i int) {
+	m.Lock()
+	defer m.Unlock()
+
+	if m.reserved {
+		return
+	}
+	m.initial = &i
+}
+
 // MarkUnsent marks the piece request for piece i as unsent.
 func (m *Manager) MarkUnsent(peerID core.PeerID, i int) {
 	m.markStatus(peerID, i, StatusUnsent)
@@ -144,6 +242,31 @@ func (m *Manager) MarkUnsent(peerID core.PeerID, i int) {
 // MarkInvalid marks the piece request for piece i as invalid.
 func (m *Manager) MarkInvalid(peerID core.PeerID, i int) {
 	m.markStatus(peerID, i, StatusInvalid)
+
+	if m.adaptive != nil {
+		m.Lock()
+		m.depth(peerID).onCongestion(m.clock.Now())
+		m.Unlock()
+	}
+}
+
+// MarkReceived records that piece i was received from peerID, such that the
+// round-trip time of the request adjusts the pipeline limit of peerID. Should
+// be called before the request is cleared.
+func (m *Manager) MarkReceived(peerID core.PeerID, i int) {
+	if m.adaptive == nil {
+		return
+	}
+
+	m.Lock()
+	defer m.Unlock()
+
+	r, ok := m.requestsByPeer[peerID][i]
+	if !ok || r.Status != StatusPending {
+		return
+	}
+	now := m.clock.Now()
+	m.depth(peerID).onSuccess(now, now.Sub(r.sentAt))
 }
 
 // Clear deletes the piece request for piece i. Should be used for freeing up
@@ -184,6 +307,7 @@ func (m *Manager) ClearPeer(peerID core.PeerID) {
 	defer m.Unlock()
 
 	delete(m.requestsByPeer, peerID)
+	delete(m.depths, peerID)
 
 	for i, rs := range m.requests {
 		for j, r := range rs {
@@ -197,10 +321,11 @@ func (m *Manager) ClearPeer(peerID core.PeerID) {
 	}
 }
 
-// GetFailedRequests returns a copy of all failed piece requests.
+// GetFailedRequests returns a copy of all failed piece requests. With adaptive
+// depth, newly expired requests cut the pipeline limit of their peer.
 func (m *Manager) GetFailedRequests() []Request {
-	m.RLock()
-	defer m.RUnlock()
+	m.Lock()
+	defer m.Unlock()
 
 	var failed []Request
 	for _, rs := range m.requests {
@@ -208,6 +333,10 @@ func (m *Manager) GetFailedRequests() []Request {
 			status := r.Status
 			if status == StatusPending && m.expired(r) {
 				status = StatusExpired
+				if m.adaptive != nil && !r.congested {
+					r.congested = true
+					m.depth(r.PeerID).onCongestion(m.clock.Now())
+				}
 			}
 			if status != StatusPending {
 				failed = append(failed, Request{
@@ -237,6 +366,9 @@ func (m *Manager) validRequest(peerID core.PeerID, i int, allowDuplicates bool)
 
 func (m *Manager) requestQuota(peerID core.PeerID) int {
 	quota := m.pipelineLimit
+	if m.adaptive != nil {
+		quota = m.depth(peerID).limit()
+	}
 	pm, ok := m.requestsByPeer[peerID]
 	if !ok {
 		return quota
@@ -254,6 +386,17 @@ func (m *Manager) requestQuota(peerID core.PeerID) int {
 	return quota
 }
 
+// depth returns the depth controller of peerID. Must be called with the lock
+// held.
+func (m *Manager) depth(peerID core.PeerID) *depthController {
+	c, ok := m.depths[peerID]
+	if !ok {
+		c = newDepthController(*m.adaptive, m.pipelineLimit)
+		m.depths[peerID] = c
+	}
+	return c
+}
+
 func (m *Manager) expired(r *Request) bool {
 	expiresAt := r.sentAt.Add(m.timeout)
 	return m.clock.Now().After(expiresAt)
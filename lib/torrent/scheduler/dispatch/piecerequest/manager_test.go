@@ -406,3 +406,65 @@ func TestRarestFirstPolicy(t *testing.T) {
 	require.NoError(err)
 	require.Empty(pieces)
 }
+
+func TestManagerReservesPrioritizedPiecesFirst(t *testing.T) {
+	require := require.New(t)
+
+	m := newManager(clock.NewMock(), 5*time.Second, RarestFirstPolicy, 2)
+
+	p1 := core.PeerIDFixture()
+	p2 := core.PeerIDFixture()
+	p3 := core.PeerIDFixture()
+
+	candidates := bitsetutil.FromBools(true, true, true, true, true)
+	counts := countsFromInts(0, 1, 3, 3, 3)
+
+	// Prioritized pieces are reserved in order, ahead of rarer pieces.
+	m.SetPriority(bitsetutil.FromBools(false, false, true, true, true))
+
+	pieces, err := m.ReservePieces(p1, candidates, counts, false)
+	require.NoError(err)
+	require.Equal([]int{2, 3}, pieces)
+
+	// Once prioritized pieces are exhausted, the remaining quota falls back to
+	// the selection policy.
+	pieces, err = m.ReservePieces(p2, candidates, counts, false)
+	require.NoError(err)
+	require.Equal([]int{4, 0}, pieces)
+
+	// Clearing the priority restores the selection policy.
+	m.SetPriority(nil)
+	m.MarkUnsent(p1, 2)
+
+	pieces, err = m.ReservePieces(p3, candidates, counts, false)
+	require.NoError(err)
+	require.Equal([]int{1, 2}, pieces)
+}
+
+func TestManagerReservesFromInitialPieceFirst(t *testing.T) {
+	require := require.New(t)
+
+	m := newManager(clock.NewMock(), 5*time.Second, RarestFirstPolicy, 3)
+
+	p1 := core.PeerIDFixture()
+	p2 := core.PeerIDFixture()
+
+	candidates := bitsetutil.FromBools(true, true, true, true, true)
+	counts := countsFromInts(0, 1, 2, 3, 4)
+
+	// The first reservation starts at the initial piece and wraps around,
+	// rather than selecting the rarest pieces.
+	m.SetInitialPiece(3)
+
+	pieces, err := m.ReservePieces(p1, candidates, counts, false)
+	require.NoError(err)
+	require.Equal([]int{3, 4, 0}, pieces)
+
+	// Later reservations revert to the selection policy, and later hints are
+	// ignored.
+	m.SetInitialPiece(4)
+
+	pieces, err = m.ReservePieces(p2, candidates, counts, false)
+	require.NoError(err)
+	require.Equal([]int{1, 2}, pieces)
+}
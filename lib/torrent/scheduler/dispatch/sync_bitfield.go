@@ -35,9 +35,7 @@ func (s *syncBitfield) Copy() *bitset.BitSet {
 	s.RLock()
 	defer s.RUnlock()
 
-	b := &bitset.BitSet{}
-	s.b.Copy(b)
-	return b
+	return s.b.Clone()
 }
 
 func (s *syncBitfield) Intersection(other *bitset.BitSet) *bitset.BitSet {
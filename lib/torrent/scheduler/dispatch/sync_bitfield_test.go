@@ -57,3 +57,15 @@ func TestSyncBitfieldString(t *testing.T) {
 	b := newSyncBitfield(bitsetutil.FromBools(true, false, true, false))
 	require.Equal("1010", b.String())
 }
+
+func TestSyncBitfieldCopy(t *testing.T) {
+	require := require.New(t)
+
+	b := newSyncBitfield(bitsetutil.FromBools(true, false, true))
+	c := b.Copy()
+	require.Equal(bitsetutil.FromBools(true, false, true), c)
+
+	// Copies are independent of the original.
+	c.Set(1)
+	require.False(b.Has(1))
+}
@@ -17,6 +17,7 @@ import (
 	"time"
 
 	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/gen/go/proto/p2p"
 	"github.com/uber/kraken/lib/torrent/networkevent"
 	"github.com/uber/kraken/lib/torrent/scheduler/conn"
 	"github.com/uber/kraken/lib/torrent/scheduler/connstate"
@@ -116,6 +117,12 @@ func (l *liftedEventLoop) PeerRemoved(peerID core.PeerID, h core.InfoHash) {
 	l.send(peerRemovedEvent{peerID, h})
 }
 
+func (l *liftedEventLoop) PeerExchangeReceived(
+	peerID core.PeerID, h core.InfoHash, msg *p2p.PeerExchangeMessage) {
+
+	l.send(peerExchangeEvent{peerID, h, msg})
+}
+
 func (l *liftedEventLoop) AnnounceTick() {
 	l.send(announceTickEvent{})
 }
@@ -128,6 +135,8 @@ type connClosedEvent struct {
 // apply ejects the conn from the scheduler's active connections.
 func (e connClosedEvent) apply(s *state) {
 	s.conns.DeleteActive(e.c)
+	delete(s.pexPeers[e.c.InfoHash()], e.c.PeerID())
+	delete(s.pexReceived, pexKey{e.c.PeerID(), e.c.InfoHash()})
 	if err := s.conns.Blacklist(e.c.PeerID(), e.c.InfoHash()); err != nil {
 		s.log("conn", e.c).Infof("Cannot blacklist active conn: %s", err)
 	}
@@ -211,11 +220,12 @@ type outgoingConnEvent struct {
 	c        *conn.Conn
 	bitfield *bitset.BitSet
 	info     *storage.TorrentInfo
+	peer     *core.PeerInfo
 }
 
 // apply transitions a fully-handshaked outgoing conn from pending to active.
 func (e outgoingConnEvent) apply(s *state) {
-	if err := s.addOutgoingConn(e.c, e.bitfield, e.info); err != nil {
+	if err := s.addOutgoingConn(e.c, e.bitfield, e.info, e.peer); err != nil {
 		s.log("conn", e.c).Errorf("Error adding outgoing conn: %s", err)
 		e.c.Close()
 		return
@@ -227,28 +237,35 @@ func (e outgoingConnEvent) apply(s *state) {
 type announceTickEvent struct{}
 
 // apply pulls the next dispatcher from the announce queue and asynchronously
-// makes an announce request to the tracker.
+// makes an announce request to the tracker. If announce batching is enabled,
+// ticks are instead accumulated until they cover a full batch, or every ready
+// dispatcher, such that each torrent announces at the same rate as without
+// batching.
 func (e announceTickEvent) apply(s *state) {
-	var skipped []core.InfoHash
-	for {
-		h, ok := s.announceQueue.Next()
-		if !ok {
-			s.log().Debug("No torrents in announce queue")
-			break
-		}
-		if s.conns.Saturated(h) {
-			s.log("hash", h).Debug("Skipping announce for fully saturated torrent")
-			skipped = append(skipped, h)
-			continue
-		}
-		ctrl, ok := s.torrentControls[h]
-		if !ok {
-			s.log("hash", h).Error("Pulled unknown torrent off announce queue")
-			continue
-		}
-		go s.sched.announce(
-			ctrl.dispatcher.Digest(), ctrl.dispatcher.InfoHash(), ctrl.dispatcher.Complete())
-		break
+	max := 1
+	if s.sched.config.AnnounceBatch.Enabled {
+		max = s.sched.config.AnnounceBatch.MaxSize
+	}
+	if s.announceCredits < max {
+		s.announceCredits++
+	}
+	size := s.announceQueue.Len()
+	if size > max {
+		size = max
+	}
+	if size > 0 && s.announceCredits < size {
+		return
+	}
+	batch, skipped := s.nextAnnounceBatch(s.announceCredits)
+	s.announceCredits -= len(batch)
+	switch len(batch) {
+	case 0:
+		s.log().Debug("No torrents in announce queue")
+	case 1:
+		a := batch[0]
+		go s.sched.announce(a.Digest, a.InfoHash, a.Complete)
+	default:
+		go s.sched.announceBatch(batch)
 	}
 	// Re-enqueue any torrents we pulled off and ignored, else we would never
 	// announce them again.
@@ -260,8 +277,9 @@ func (e announceTickEvent) apply(s *state) {
 // announceResultEvent occurs when a successfully announced response was received
 // from the tracker.
 type announceResultEvent struct {
-	infoHash core.InfoHash
-	peers    []*core.PeerInfo
+	infoHash    core.InfoHash
+	peers       []*core.PeerInfo
+	pieceOffset *int
 }
 
 // apply selects new peers returned via an announce response to open connections to
@@ -276,27 +294,110 @@ func (e announceResultEvent) apply(s *state) {
 		return
 	}
 	s.announceQueue.Ready(e.infoHash)
+	s.seeded[e.infoHash] = false
+	for _, p := range e.peers {
+		if p.PeerID != s.sched.pctx.PeerID && (p.Complete || p.Origin) {
+			s.seeded[e.infoHash] = true
+			break
+		}
+	}
 	if ctrl.dispatcher.Complete() {
+		if s.sched.draining.Load() && !s.seeded[e.infoHash] {
+			// Hand off seeding before leaving the swarm: no other peer is
+			// complete, so connect to the incomplete peers such that they
+			// download the pieces only we hold.
+			s.sched.stats.Counter("drain_handoffs").Inc(1)
+			s.addPendingPeers(e.infoHash, ctrl, e.peers)
+		}
 		// Torrent is already complete, don't open any new connections.
 		return
 	}
-	for _, p := range e.peers {
-		if p.PeerID == s.sched.pctx.PeerID {
-			// Tracker may return our own peer.
-			continue
+	if e.pieceOffset != nil {
+		ctrl.dispatcher.SetInitialPiece(*e.pieceOffset)
+	}
+	s.addPendingPeers(e.infoHash, ctrl, e.peers)
+}
+
+// peerExchangeTickEvent occurs when it is time to gossip peers to connected
+// peers.
+type peerExchangeTickEvent struct{}
+
+// apply sends every active conn a sample of the known-good peers of its torrent,
+// excluding the receiving peer.
+//
+// If the addresses of both the receiver and a gossiped peer are known, both
+// would learn about each other at once and dial simultaneously, which causes
+// both handshakes to be rejected. Such pairs are only gossiped to the peer with
+// the lower peer id, so that exactly one side dials.
+func (e peerExchangeTickEvent) apply(s *state) {
+	for _, c := range s.conns.ActiveConns() {
+		known := s.pexPeers[c.InfoHash()]
+		_, receiverKnown := known[c.PeerID()]
+		var peers []*core.PeerInfo
+		for peerID, p := range known { // Loops in random order.
+			if peerID == c.PeerID() {
+				continue
+			}
+			if receiverKnown && peerID.LessThan(c.PeerID()) {
+				continue
+			}
+			peers = append(peers, p)
+			if len(peers) == s.sched.config.PeerExchange.MaxPeers {
+				break
+			}
 		}
-		if s.conns.Blacklisted(p.PeerID, e.infoHash) {
+		if len(peers) == 0 {
 			continue
 		}
-		if err := s.conns.AddPending(p.PeerID, e.infoHash, nil); err != nil {
-			if err == connstate.ErrTorrentAtCapacity {
-				break
-			}
+		if err := c.Send(conn.NewPeerExchangeMessage(peers)); err != nil {
+			s.log("conn", c).Infof("Error sending peer exchange: %s", err)
+		}
+	}
+}
+
+// peerExchangeEvent occurs when a connected peer gossips peers to us.
+type peerExchangeEvent struct {
+	peerID   core.PeerID
+	infoHash core.InfoHash
+	msg      *p2p.PeerExchangeMessage
+}
+
+// apply validates the gossiped peers and opens connections to them if there is
+// capacity, exactly like peers returned by an announce.
+func (e peerExchangeEvent) apply(s *state) {
+	config := s.sched.config.PeerExchange
+	if !config.Enabled {
+		return
+	}
+	ctrl, ok := s.torrentControls[e.infoHash]
+	if !ok {
+		return
+	}
+	key := pexKey{e.peerID, e.infoHash}
+	now := s.sched.clock.Now()
+	if last, ok := s.pexReceived[key]; ok && now.Sub(last) < config.MinReceiveInterval {
+		s.sched.stats.Counter("peer_exchange_dropped").Inc(1)
+		return
+	}
+	s.pexReceived[key] = now
+	if ctrl.dispatcher.Complete() {
+		return
+	}
+	addrs := e.msg.GetPeers()
+	if len(addrs) > config.MaxPeers {
+		addrs = addrs[:config.MaxPeers]
+	}
+	var peers []*core.PeerInfo
+	for _, addr := range addrs {
+		p, err := parsePeerAddress(addr)
+		if err != nil {
+			s.log("peer", e.peerID, "hash", e.infoHash).Infof(
+				"Ignoring invalid peer exchange address: %s", err)
 			continue
 		}
-		go s.sched.initializeOutgoingHandshake(
-			p, ctrl.dispatcher.Stat(), ctrl.dispatcher.RemoteBitfields(), ctrl.namespace)
+		peers = append(peers, p)
 	}
+	s.addPendingPeers(e.infoHash, ctrl, peers)
 }
 
 // announceErrEvent occurs when an announce request fails.
@@ -322,6 +423,10 @@ type newTorrentEvent struct {
 func (e newTorrentEvent) apply(s *state) {
 	ctrl, ok := s.torrentControls[e.torrent.InfoHash()]
 	if !ok {
+		if s.sched.draining.Load() {
+			e.errc <- ErrSchedulerDraining
+			return
+		}
 		var err error
 		ctrl, err = s.addTorrent(e.namespace, e.torrent, true)
 		if err != nil {
@@ -452,6 +557,32 @@ func (e blacklistSnapshotEvent) apply(s *state) {
 	e.result <- s.conns.BlacklistSnapshot()
 }
 
+// drainEvent occurs when the drain status is requested via scheduler API.
+type drainEvent struct {
+	result chan DrainStatus
+}
+
+// apply computes the drain status. A torrent is a sole seed if it has pieces
+// which no peer has been observed to hold, and the tracker has not returned any
+// other complete peer or origin for it.
+func (e drainEvent) apply(s *state) {
+	var status DrainStatus
+	for h, ctrl := range s.torrentControls {
+		if !ctrl.dispatcher.Complete() {
+			status.InflightDownloads++
+		}
+		if s.seeded[h] {
+			continue
+		}
+		unique := ctrl.dispatcher.Stat().Bitfield().Difference(ctrl.dispatcher.ReplicatedPieces())
+		if unique.Any() {
+			status.SoleSeeds = append(status.SoleSeeds, ctrl.dispatcher.Digest())
+		}
+	}
+	status.Safe = status.InflightDownloads == 0 && len(status.SoleSeeds) == 0
+	e.result <- status
+}
+
 // removeTorrentEvent occurs when a torrent is manually removed via scheduler API.
 type removeTorrentEvent struct {
 	digest core.Digest
@@ -470,6 +601,29 @@ func (e removeTorrentEvent) apply(s *state) {
 	e.errc <- s.sched.torrentArchive.DeleteTorrent(e.digest)
 }
 
+// prioritizeRangeEvent occurs when a consumer hints a priority byte range of a
+// torrent via scheduler API.
+type prioritizeRangeEvent struct {
+	digest core.Digest
+	offset int64
+	length int64
+	errc   chan error
+}
+
+func (e prioritizeRangeEvent) apply(s *state) {
+	for _, ctrl := range s.torrentControls {
+		if ctrl.dispatcher.Digest() == e.digest {
+			if ctrl.dispatcher.Complete() {
+				e.errc <- nil
+				return
+			}
+			e.errc <- ctrl.dispatcher.PrioritizeRange(e.offset, e.length)
+			return
+		}
+	}
+	e.errc <- ErrTorrentNotFound
+}
+
 // probeEvent occurs when a probe is manually requested via scheduler API.
 // The event loop is unbuffered, so if a probe can be successfully sent, then
 // the event loop is healthy.
@@ -143,7 +143,7 @@ func TestAnnounceTickEvent(t *testing.T) {
 			ctrls[0].dispatcher.InfoHash(),
 			false,
 			announceclient.V2).
-		Return(nil, time.Second, nil)
+		Return(&announceclient.Response{Interval: time.Second}, nil)
 
 	announceTickEvent{}.apply(state)
 
@@ -152,6 +152,43 @@ func TestAnnounceTickEvent(t *testing.T) {
 	})
 }
 
+func TestAnnounceTickEventBatchesNoMoreTorrentsThanTicks(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newStateMocks(t)
+	defer cleanup()
+
+	config := Config{AnnounceBatch: AnnounceBatchConfig{Enabled: true, MaxSize: 4}}
+	state := mocks.newState(config)
+
+	var ctrls []*torrentControl
+	for i := 0; i < 5; i++ {
+		c, err := state.addTorrent(_testNamespace, mocks.newTorrent(), true)
+		require.NoError(err)
+		ctrls = append(ctrls, c)
+	}
+
+	// Ticks accumulate until they cover a full batch.
+	for i := 0; i < 3; i++ {
+		announceTickEvent{}.apply(state)
+	}
+
+	for _, c := range ctrls[:4] {
+		mocks.announceClient.EXPECT().
+			Announce(c.dispatcher.Digest(), c.dispatcher.InfoHash(), false, announceclient.V2).
+			Return(&announceclient.Response{Interval: time.Second}, nil)
+	}
+
+	announceTickEvent{}.apply(state)
+
+	for _, c := range ctrls[:4] {
+		mocks.eventLoop.expect(announceResultEvent{
+			infoHash: c.dispatcher.InfoHash(),
+		})
+	}
+	require.Equal(0, state.announceCredits)
+}
+
 func TestAnnounceTickEventSkipsFullTorrents(t *testing.T) {
 	require := require.New(t)
 
@@ -174,7 +211,7 @@ func TestAnnounceTickEventSkipsFullTorrents(t *testing.T) {
 		defer cleanup()
 
 		require.NoError(state.conns.AddPending(c.PeerID(), c.InfoHash(), nil))
-		require.NoError(state.addOutgoingConn(c, info.Bitfield(), info))
+		require.NoError(state.addOutgoingConn(c, info.Bitfield(), info, core.PeerInfoFixture()))
 	}
 
 	empty, err := state.addTorrent(_testNamespace, mocks.newTorrent(), true)
@@ -188,7 +225,7 @@ func TestAnnounceTickEventSkipsFullTorrents(t *testing.T) {
 			empty.dispatcher.InfoHash(),
 			false,
 			announceclient.V2).
-		Return(nil, time.Second, nil)
+		Return(&announceclient.Response{Interval: time.Second}, nil)
 
 	announceTickEvent{}.apply(state)
 
@@ -220,7 +257,7 @@ func TestAnnounceTickEventSkipsFullTorrents(t *testing.T) {
 			full.dispatcher.InfoHash(),
 			false,
 			announceclient.V2).
-		Return(nil, time.Second, nil)
+		Return(&announceclient.Response{Interval: time.Second}, nil)
 
 	announceTickEvent{}.apply(state)
 
@@ -0,0 +1,95 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package scheduler
+
+import (
+	"fmt"
+	"net"
+)
+
+// NetworkPolicyConfig restricts which peer addresses may be connected to, both
+// when dialing peers handed out by announces or peer exchange, and when
+// accepting incoming connections. Entries are CIDRs, e.g. "10.0.0.0/8". If
+// Allow is empty, all addresses not denied are allowed. Deny takes precedence
+// over Allow.
+//
+// Once any entry is set, addresses which are not IP literals are rejected.
+type NetworkPolicyConfig struct {
+	Allow []string `yaml:"allow"`
+	Deny  []string `yaml:"deny"`
+}
+
+// networkPolicy decides whether peer addresses are within policy. The zero
+// value allows all addresses.
+type networkPolicy struct {
+	allow []*net.IPNet
+	deny  []*net.IPNet
+}
+
+func parseCIDRs(cidrs []string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, s := range cidrs {
+		_, n, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, err
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+func (c NetworkPolicyConfig) build() (*networkPolicy, error) {
+	allow, err := parseCIDRs(c.Allow)
+	if err != nil {
+		return nil, fmt.Errorf("allow: %s", err)
+	}
+	deny, err := parseCIDRs(c.Deny)
+	if err != nil {
+		return nil, fmt.Errorf("deny: %s", err)
+	}
+	return &networkPolicy{allow, deny}, nil
+}
+
+func containsIP(nets []*net.IPNet, ip net.IP) bool {
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// allows returns whether the peer at host is within policy.
+func (p *networkPolicy) allows(host string) bool {
+	if len(p.allow) == 0 && len(p.deny) == 0 {
+		return true
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	if containsIP(p.deny, ip) {
+		return false
+	}
+	return len(p.allow) == 0 || containsIP(p.allow, ip)
+}
+
+// allowsAddr returns whether the peer at the host:port addr is within policy.
+func (p *networkPolicy) allowsAddr(addr net.Addr) bool {
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return p.allows(addr.String())
+	}
+	return p.allows(host)
+}
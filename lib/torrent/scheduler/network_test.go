@@ -0,0 +1,63 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package scheduler
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNetworkPolicyAllows(t *testing.T) {
+	tests := []struct {
+		desc     string
+		config   NetworkPolicyConfig
+		host     string
+		expected bool
+	}{
+		{"empty allows all", NetworkPolicyConfig{}, "10.1.2.3", true},
+		{"empty allows hostnames", NetworkPolicyConfig{}, "localhost", true},
+		{"inside allowlist", NetworkPolicyConfig{Allow: []string{"10.0.0.0/8"}}, "10.1.2.3", true},
+		{"outside allowlist", NetworkPolicyConfig{Allow: []string{"10.0.0.0/8"}}, "192.168.0.1", false},
+		{"denied", NetworkPolicyConfig{Deny: []string{"10.1.0.0/16"}}, "10.1.2.3", false},
+		{"not denied", NetworkPolicyConfig{Deny: []string{"10.1.0.0/16"}}, "10.2.0.1", true},
+		{
+			"deny takes precedence",
+			NetworkPolicyConfig{Allow: []string{"10.0.0.0/8"}, Deny: []string{"10.1.0.0/16"}},
+			"10.1.2.3",
+			false,
+		},
+		{"ipv6", NetworkPolicyConfig{Allow: []string{"fd00::/8"}}, "fd00::1", true},
+		{"hostname rejected", NetworkPolicyConfig{Allow: []string{"10.0.0.0/8"}}, "localhost", false},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			require := require.New(t)
+
+			p, err := test.config.build()
+			require.NoError(err)
+			require.Equal(test.expected, p.allows(test.host))
+		})
+	}
+}
+
+func TestNetworkPolicyInvalidConfig(t *testing.T) {
+	for _, config := range []NetworkPolicyConfig{
+		{Allow: []string{"10.0.0.0"}},
+		{Deny: []string{"not-a-cidr"}},
+	} {
+		_, err := config.build()
+		require.Error(t, err)
+	}
+}
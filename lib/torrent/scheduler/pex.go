@@ -0,0 +1,88 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package scheduler
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+	"time"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/gen/go/proto/p2p"
+)
+
+// PeerExchangeConfig defines peer exchange, where connected peers gossip the
+// addresses of other peers in the same torrent to each other. Tracker announces
+// remain the authoritative source of peers, however peer exchange reduces
+// tracker load and speeds up discovery in large swarms.
+type PeerExchangeConfig struct {
+	Enabled bool `yaml:"enabled"`
+
+	// Interval is how often peers are gossiped to each connected peer.
+	Interval time.Duration `yaml:"interval"`
+
+	// MaxPeers bounds the number of peers gossiped per message. Received
+	// messages with more peers are truncated.
+	MaxPeers int `yaml:"max_peers"`
+
+	// MinReceiveInterval is the minimum time between messages accepted from
+	// the same peer for the same torrent. Messages received more often are
+	// dropped.
+	MinReceiveInterval time.Duration `yaml:"min_receive_interval"`
+}
+
+func (c PeerExchangeConfig) applyDefaults() PeerExchangeConfig {
+	if c.Interval == 0 {
+		c.Interval = 30 * time.Second
+	}
+	if c.MaxPeers == 0 {
+		c.MaxPeers = 20
+	}
+	if c.MinReceiveInterval == 0 {
+		c.MinReceiveInterval = c.Interval / 2
+	}
+	return c
+}
+
+// pexKey identifies the connection a peer exchange message was received on.
+type pexKey struct {
+	peerID   core.PeerID
+	infoHash core.InfoHash
+}
+
+var _hostnameRegexp = regexp.MustCompile(`^[a-zA-Z0-9]([a-zA-Z0-9.-]{0,251}[a-zA-Z0-9])?$`)
+
+// parsePeerAddress validates a gossiped peer address before it is dialed.
+func parsePeerAddress(addr *p2p.PeerAddress) (*core.PeerInfo, error) {
+	if addr == nil {
+		return nil, errors.New("empty address")
+	}
+	peerID, err := core.NewPeerID(addr.PeerID)
+	if err != nil {
+		return nil, fmt.Errorf("peer id: %s", err)
+	}
+	if ip := net.ParseIP(addr.Ip); ip != nil {
+		if ip.IsUnspecified() || ip.IsMulticast() {
+			return nil, fmt.Errorf("invalid ip %s", addr.Ip)
+		}
+	} else if !_hostnameRegexp.MatchString(addr.Ip) {
+		return nil, fmt.Errorf("invalid host %q", addr.Ip)
+	}
+	if addr.Port <= 0 || addr.Port > 65535 {
+		return nil, fmt.Errorf("invalid port %d", addr.Port)
+	}
+	return core.NewPeerInfo(peerID, addr.Ip, int(addr.Port), addr.Origin, addr.Complete), nil
+}
@@ -59,6 +59,7 @@ func (rs *reloadableScheduler) reload(config Config) error {
 	if err != nil {
 		return fmt.Errorf("create new scheduler: %s", err)
 	}
+	n.draining.Store(s.draining.Load())
 	rs.scheduler = n
 
 	if err := rs.scheduler.start(rs.aq()); err != nil {
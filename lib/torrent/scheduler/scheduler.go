@@ -22,14 +22,17 @@ import (
 
 	"github.com/andres-erbsen/clock"
 	"github.com/uber-go/tally"
+	"go.uber.org/atomic"
 	"go.uber.org/zap"
 
 	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/faults"
 	"github.com/uber/kraken/lib/torrent/networkevent"
 	"github.com/uber/kraken/lib/torrent/scheduler/announcequeue"
 	"github.com/uber/kraken/lib/torrent/scheduler/announcer"
 	"github.com/uber/kraken/lib/torrent/scheduler/conn"
 	"github.com/uber/kraken/lib/torrent/scheduler/connstate"
+	"github.com/uber/kraken/lib/torrent/scheduler/dispatch"
 	"github.com/uber/kraken/lib/torrent/scheduler/torrentlog"
 	"github.com/uber/kraken/lib/torrent/storage"
 	"github.com/uber/kraken/tracker/announceclient"
@@ -43,6 +46,11 @@ var (
 	ErrTorrentTimeout    = errors.New("torrent timed out")
 	ErrTorrentRemoved    = errors.New("torrent manually removed")
 	ErrSendEventTimedOut = errors.New("event loop send timed out")
+	ErrSchedulerDraining = errors.New("scheduler is draining")
+
+	// ErrInvalidRange is wrapped by PrioritizeRange errors of ranges which
+	// are not within the blob.
+	ErrInvalidRange = dispatch.ErrInvalidRange
 )
 
 // Scheduler defines operations for scheduler.
@@ -51,7 +59,22 @@ type Scheduler interface {
 	Download(namespace string, d core.Digest) error
 	BlacklistSnapshot() ([]connstate.BlacklistedConn, error)
 	RemoveTorrent(d core.Digest) error
+	PrioritizeRange(d core.Digest, offset, length int64) error
 	Probe() error
+	Drain() (DrainStatus, error)
+}
+
+// DrainStatus describes the progress of draining a Scheduler.
+type DrainStatus struct {
+	// InflightDownloads is the number of torrents still being downloaded.
+	InflightDownloads int `json:"inflight_downloads"`
+
+	// SoleSeeds lists torrents with pieces which no other known peer holds.
+	SoleSeeds []core.Digest `json:"sole_seeds"`
+
+	// Safe indicates that the Scheduler may be terminated without interrupting
+	// downloads or losing the last seed of any piece.
+	Safe bool `json:"safe"`
 }
 
 // scheduler manages global state for the peer. This includes:
@@ -74,8 +97,9 @@ type scheduler struct {
 
 	listener net.Listener
 
-	preemptionTick <-chan time.Time
-	emitStatsTick  <-chan time.Time
+	preemptionTick   <-chan time.Time
+	emitStatsTick    <-chan time.Time
+	peerExchangeTick <-chan time.Time
 
 	// TODO(codyg): We only need this hold on this reference for reloading the scheduler...
 	announceClient announceclient.Client
@@ -86,28 +110,49 @@ type scheduler struct {
 
 	torrentlog *torrentlog.Logger
 
+	sources *sourcePolicy
+
+	network *networkPolicy
+
 	logger *zap.SugaredLogger
 
+	// Once draining, new downloads are rejected.
+	draining atomic.Bool
+
 	// The following fields orchestrate the stopping of the scheduler.
 	stopOnce sync.Once      // Ensures the stop sequence is executed only once.
 	done     chan struct{}  // Signals all goroutines to exit.
 	wg       sync.WaitGroup // Waits for eventLoop and listenLoop to exit.
 }
 
-// schedOverrides defines scheduler fields which may be overrided for testing
-// purposes.
+// schedOverrides defines optional scheduler fields, some of which may only be
+// overrided for testing purposes.
 type schedOverrides struct {
 	clock     clock.Clock
 	eventLoop eventLoop
+	faults    *faults.Injector
+	onSeed    func(namespace string, d core.Digest, size int64)
 }
 
-type option func(*schedOverrides)
+// Option allows setting optional scheduler parameters.
+type Option func(*schedOverrides)
 
-func withClock(c clock.Clock) option {
+// WithFaultInjector configures f to fail or delay peer connections.
+func WithFaultInjector(f *faults.Injector) Option {
+	return func(o *schedOverrides) { o.faults = f }
+}
+
+// WithSeedHook configures f to be called whenever an origin opens a torrent
+// for seeding. Ignored by agents.
+func WithSeedHook(f func(namespace string, d core.Digest, size int64)) Option {
+	return func(o *schedOverrides) { o.onSeed = f }
+}
+
+func withClock(c clock.Clock) Option {
 	return func(o *schedOverrides) { o.clock = c }
 }
 
-func withEventLoop(l eventLoop) option {
+func withEventLoop(l eventLoop) Option {
 	return func(o *schedOverrides) { o.eventLoop = l }
 }
 
@@ -119,7 +164,7 @@ func newScheduler(
 	pctx core.PeerContext,
 	announceClient announceclient.Client,
 	netevents networkevent.Producer,
-	options ...option) (*scheduler, error) {
+	options ...Option) (*scheduler, error) {
 
 	config = config.applyDefaults()
 
@@ -150,8 +195,14 @@ func newScheduler(
 		preemptionTick = overrides.clock.Tick(config.PreemptionInterval)
 	}
 
+	var peerExchangeTick <-chan time.Time
+	if config.PeerExchange.Enabled {
+		peerExchangeTick = overrides.clock.Tick(config.PeerExchange.Interval)
+	}
+
 	handshaker, err := conn.NewHandshaker(
-		config.Conn, stats, overrides.clock, netevents, pctx.PeerID, eventLoop, slogger)
+		config.Conn, stats, overrides.clock, netevents, pctx.PeerID, eventLoop, slogger,
+		conn.WithFaultInjector(overrides.faults))
 	if err != nil {
 		return nil, fmt.Errorf("conn: %s", err)
 	}
@@ -161,22 +212,35 @@ func newScheduler(
 		return nil, fmt.Errorf("torrentlog: %s", err)
 	}
 
+	sources, err := config.SourcePolicy.build()
+	if err != nil {
+		return nil, fmt.Errorf("source policy: %s", err)
+	}
+
+	network, err := config.NetworkPolicy.build()
+	if err != nil {
+		return nil, fmt.Errorf("network policy: %s", err)
+	}
+
 	s := &scheduler{
-		pctx:           pctx,
-		config:         config,
-		clock:          overrides.clock,
-		torrentArchive: ta,
-		stats:          stats,
-		handshaker:     handshaker,
-		eventLoop:      eventLoop,
-		preemptionTick: preemptionTick,
-		emitStatsTick:  overrides.clock.Tick(config.EmitStatsInterval),
-		announceClient: announceClient,
-		announcer:      announcer.Default(announceClient, eventLoop, overrides.clock, slogger),
-		netevents:      netevents,
-		torrentlog:     tlog,
-		logger:         slogger,
-		done:           done,
+		pctx:             pctx,
+		config:           config,
+		clock:            overrides.clock,
+		torrentArchive:   ta,
+		stats:            stats,
+		handshaker:       handshaker,
+		eventLoop:        eventLoop,
+		preemptionTick:   preemptionTick,
+		emitStatsTick:    overrides.clock.Tick(config.EmitStatsInterval),
+		peerExchangeTick: peerExchangeTick,
+		announceClient:   announceClient,
+		announcer:        announcer.Default(announceClient, eventLoop, overrides.clock, slogger),
+		netevents:        netevents,
+		torrentlog:       tlog,
+		sources:          sources,
+		network:          network,
+		logger:           slogger,
+		done:             done,
 	}
 
 	if config.DisablePreemption {
@@ -264,6 +328,8 @@ func (s *scheduler) Download(namespace string, d core.Digest) error {
 			errTag = "scheduler_stopped"
 		case ErrTorrentRemoved:
 			errTag = "removed"
+		case ErrSchedulerDraining:
+			errTag = "draining"
 		default:
 			errTag = "unknown"
 		}
@@ -299,6 +365,34 @@ func (s *scheduler) RemoveTorrent(d core.Digest) error {
 	return <-errc
 }
 
+// PrioritizeRange hints that the length bytes of d starting at offset are
+// needed first by a consumer of an in-progress download, such that pieces
+// covering the range are requested ahead of all others. Hints may be updated
+// as the consumer reads further.
+func (s *scheduler) PrioritizeRange(d core.Digest, offset, length int64) error {
+	// Buffer size of 1 so sends do not block.
+	errc := make(chan error, 1)
+	if !s.eventLoop.send(prioritizeRangeEvent{d, offset, length, errc}) {
+		return ErrSchedulerStopped
+	}
+	return <-errc
+}
+
+// Drain stops the scheduler from accepting new downloads, while in-flight
+// downloads and seeding continue. Torrents which the scheduler solely seeds are
+// handed off by connecting to the incomplete peers returned by announces, which
+// download the pieces only the scheduler holds. Returns whether it is safe to
+// terminate the scheduler yet, thus callers should poll Drain until the status
+// is safe.
+func (s *scheduler) Drain() (DrainStatus, error) {
+	s.draining.Store(true)
+	result := make(chan DrainStatus)
+	if !s.eventLoop.send(drainEvent{result}) {
+		return DrainStatus{}, ErrSchedulerStopped
+	}
+	return <-result, nil
+}
+
 // Probe verifies that the scheduler event loop is running and unblocked.
 func (s *scheduler) Probe() error {
 	return s.eventLoop.sendTimeout(probeEvent{}, s.config.ProbeTimeout)
@@ -322,6 +416,14 @@ func (s *scheduler) listenLoop() {
 			s.log().Infof("Error accepting new conn, exiting listen loop: %s", err)
 			return
 		}
+		if !s.network.allowsAddr(nc.RemoteAddr()) {
+			s.log("addr", nc.RemoteAddr()).Info("Rejecting conn from peer outside network policy")
+			s.stats.Tagged(map[string]string{
+				"direction": "incoming",
+			}).Counter("network_policy_rejects").Inc(1)
+			nc.Close()
+			continue
+		}
 		go func() {
 			pc, err := s.handshaker.Accept(nc)
 			if err != nil {
@@ -344,6 +446,8 @@ func (s *scheduler) tickerLoop() {
 			s.eventLoop.send(preemptionTickEvent{})
 		case <-s.emitStatsTick:
 			s.eventLoop.send(emitStatsEvent{})
+		case <-s.peerExchangeTick:
+			s.eventLoop.send(peerExchangeTickEvent{})
 		case <-s.done:
 			return
 		}
@@ -358,14 +462,14 @@ func (s *scheduler) announceLoop() {
 }
 
 func (s *scheduler) announce(d core.Digest, h core.InfoHash, complete bool) {
-	peers, err := s.announcer.Announce(d, h, complete)
+	resp, err := s.announcer.Announce(d, h, complete)
 	if err != nil {
 		if err != announceclient.ErrDisabled {
 			s.eventLoop.send(announceErrEvent{h, err})
 		}
 		return
 	}
-	s.eventLoop.send(announceResultEvent{h, peers})
+	s.eventLoop.send(announceResultEvent{h, resp.Peers, resp.PieceOffset})
 }
 
 func (s *scheduler) failIncomingHandshake(pc *conn.PendingConn, err error) {
@@ -410,7 +514,7 @@ func (s *scheduler) initializeOutgoingHandshake(
 		return
 	}
 	s.torrentlog.OutgoingConnectionAccept(info.Digest(), info.InfoHash(), p.PeerID)
-	s.eventLoop.send(outgoingConnEvent{result.Conn, result.Bitfield, info})
+	s.eventLoop.send(outgoingConnEvent{result.Conn, result.Bitfield, info, p})
 }
 
 func (s *scheduler) log(args ...interface{}) *zap.SugaredLogger {
@@ -14,12 +14,14 @@
 package scheduler
 
 import (
+	"net"
 	"os"
 	"sync"
 	"testing"
 	"time"
 
 	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/gen/go/proto/p2p"
 	"github.com/uber/kraken/lib/hashring"
 	"github.com/uber/kraken/lib/hostlist"
 	"github.com/uber/kraken/lib/torrent/networkevent"
@@ -27,6 +29,7 @@ import (
 	"github.com/uber/kraken/lib/torrent/storage/piecereader"
 	"github.com/uber/kraken/tracker/announceclient"
 	"github.com/uber/kraken/utils/bitsetutil"
+	"github.com/uber/kraken/utils/testutil"
 
 	"github.com/andres-erbsen/clock"
 	"github.com/stretchr/testify/require"
@@ -503,3 +506,312 @@ func TestSchedulerProbeTimeoutsIfDeadlocked(t *testing.T) {
 
 	close(release)
 }
+
+func TestDrainNotSafeWhileSoleSeed(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newTestMocks(t)
+	defer cleanup()
+
+	config := configFixture()
+
+	seeder := mocks.newPeer(config)
+	leecher := mocks.newPeer(config)
+
+	blob := core.NewBlobFixture()
+	namespace := core.TagFixture()
+
+	mocks.metaInfoClient.EXPECT().Download(
+		namespace, blob.Digest).Return(blob.MetaInfo, nil).Times(2)
+
+	seeder.writeTorrent(namespace, blob)
+	require.NoError(seeder.scheduler.Download(namespace, blob.Digest))
+
+	// No other peer has any piece of the torrent.
+	status, err := seeder.scheduler.Drain()
+	require.NoError(err)
+	require.False(status.Safe)
+	require.Equal([]core.Digest{blob.Digest}, status.SoleSeeds)
+
+	// Draining schedulers accept no new downloads.
+	other := core.NewBlobFixture()
+	mocks.metaInfoClient.EXPECT().Download(namespace, other.Digest).Return(other.MetaInfo, nil)
+	require.Equal(ErrSchedulerDraining, seeder.scheduler.Download(namespace, other.Digest))
+
+	// Once another peer holds every piece, draining completes.
+	require.NoError(leecher.scheduler.Download(namespace, blob.Digest))
+	leecher.checkTorrent(t, namespace, blob)
+
+	require.NoError(testutil.PollUntilTrue(5*time.Second, func() bool {
+		status, err := seeder.scheduler.Drain()
+		require.NoError(err)
+		return status.Safe
+	}))
+}
+
+func TestDrainHandsOffSoleSeedToIncompletePeers(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newTestMocks(t)
+	defer cleanup()
+
+	seeder := mocks.newPeer(configFixture())
+
+	blob := core.NewBlobFixture()
+	namespace := core.TagFixture()
+
+	mocks.metaInfoClient.EXPECT().Download(namespace, blob.Digest).Return(blob.MetaInfo, nil)
+
+	seeder.writeTorrent(namespace, blob)
+	require.NoError(seeder.scheduler.Download(namespace, blob.Digest))
+
+	_, err := seeder.scheduler.Drain()
+	require.NoError(err)
+
+	// An incomplete peer which never dials the seeder itself.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(err)
+	defer l.Close()
+	leecher := core.NewPeerInfo(
+		core.PeerIDFixture(), "127.0.0.1", l.Addr().(*net.TCPAddr).Port, false, false)
+
+	accepted := make(chan struct{})
+	go func() {
+		if nc, err := l.Accept(); err == nil {
+			nc.Close()
+			close(accepted)
+		}
+	}()
+
+	require.True(seeder.scheduler.eventLoop.send(announceResultEvent{
+		infoHash: blob.MetaInfo.InfoHash(),
+		peers:    []*core.PeerInfo{leecher},
+	}))
+
+	select {
+	case <-accepted:
+	case <-time.After(5 * time.Second):
+		require.FailNow("draining sole seed did not connect to incomplete peer")
+	}
+}
+
+func TestPeerExchangeDiscoversPeerUnknownToTracker(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newTestMocks(t)
+	defer cleanup()
+
+	config := configFixture()
+	config.PeerExchange = PeerExchangeConfig{
+		Enabled:  true,
+		Interval: 100 * time.Millisecond,
+	}.applyDefaults()
+
+	a := mocks.newPeer(config)
+	b := mocks.newPeer(config)
+	hidden := mocks.newPeer(config)
+
+	blob := core.NewBlobFixture()
+	namespace := core.TagFixture()
+	h := blob.MetaInfo.InfoHash()
+
+	mocks.metaInfoClient.EXPECT().Download(
+		namespace, blob.Digest).Return(blob.MetaInfo, nil).AnyTimes()
+
+	// The hidden peer has the torrent but never announces it, so the tracker
+	// cannot hand it out.
+	_, err := hidden.torrentArchive.CreateTorrent(namespace, blob.Digest)
+	require.NoError(err)
+
+	// Neither leecher can complete, so the downloads run until cleanup.
+	go a.scheduler.Download(namespace, blob.Digest)
+	go b.scheduler.Download(namespace, blob.Digest)
+
+	waitForConnEstablished(t, a.scheduler, b.pctx.PeerID, h)
+
+	// Only b is told about the hidden peer.
+	b.scheduler.eventLoop.send(announceResultEvent{
+		infoHash: h,
+		peers:    []*core.PeerInfo{core.PeerInfoFromContext(hidden.pctx, false)},
+	})
+	waitForConnEstablished(t, b.scheduler, hidden.pctx.PeerID, h)
+
+	// a learns about the hidden peer from b well before its next announce.
+	require.NoError(testutil.PollUntilTrue(2*time.Second, func() bool {
+		return hasConn(a.scheduler, hidden.pctx.PeerID, h)
+	}))
+}
+
+func TestSourcePolicyOriginFirstFetchesFromOriginWhenPeersExist(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newTestMocks(t)
+	defer cleanup()
+
+	config := configFixture()
+	config.ConnState.MaxOpenConnectionsPerTorrent = 1
+
+	leecherConfig := config
+	leecherConfig.SourcePolicy = SourcePolicyConfig{
+		Rules: []SourceRule{{Order: []string{SourceOrigin, SourcePeer}}},
+	}
+
+	seeder := mocks.newPeer(config)
+	origin := mocks.newPeer(config)
+	leecher := mocks.newPeer(leecherConfig)
+
+	blob := core.NewBlobFixture()
+	namespace := core.TagFixture()
+	h := blob.MetaInfo.InfoHash()
+
+	mocks.metaInfoClient.EXPECT().Download(
+		namespace, blob.Digest).Return(blob.MetaInfo, nil).AnyTimes()
+
+	// Neither seeder announces, such that the leecher only learns about them
+	// from the announce result below.
+	seeder.writeTorrent(namespace, blob)
+	origin.writeTorrent(namespace, blob)
+
+	errc := make(chan error, 1)
+	go func() { errc <- leecher.scheduler.Download(namespace, blob.Digest) }()
+
+	waitForTorrentAdded(t, leecher.scheduler, h)
+
+	// The peer is handed out ahead of the origin, but the single connection
+	// slot is claimed by the origin.
+	originInfo := core.PeerInfoFromContext(origin.pctx, true)
+	originInfo.Origin = true
+	leecher.scheduler.eventLoop.send(announceResultEvent{
+		infoHash: h,
+		peers:    []*core.PeerInfo{core.PeerInfoFromContext(seeder.pctx, true), originInfo},
+	})
+
+	require.NoError(<-errc)
+	leecher.checkTorrent(t, namespace, blob)
+
+	var connected []string
+	for _, e := range leecher.testProducer.Events() {
+		if e.Name == networkevent.AddActiveConn {
+			connected = append(connected, e.Peer)
+		}
+	}
+	require.Equal([]string{origin.pctx.PeerID.String()}, connected)
+}
+
+func TestNetworkPolicyOnlyDialsPeersInsideAllowlist(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newTestMocks(t)
+	defer cleanup()
+
+	config := configFixture()
+
+	leecherConfig := config
+	leecherConfig.NetworkPolicy = NetworkPolicyConfig{Allow: []string{"127.0.0.1/32"}}
+
+	inside := mocks.newPeer(config)
+	outside := mocks.newPeer(config)
+	leecher := mocks.newPeer(leecherConfig)
+
+	blob := core.NewBlobFixture()
+	namespace := core.TagFixture()
+	h := blob.MetaInfo.InfoHash()
+
+	mocks.metaInfoClient.EXPECT().Download(
+		namespace, blob.Digest).Return(blob.MetaInfo, nil).AnyTimes()
+
+	inside.writeTorrent(namespace, blob)
+	outside.writeTorrent(namespace, blob)
+
+	errc := make(chan error, 1)
+	go func() { errc <- leecher.scheduler.Download(namespace, blob.Digest) }()
+
+	waitForTorrentAdded(t, leecher.scheduler, h)
+
+	// Both seeders listen on all loopback addresses, however only the one
+	// handed out at 127.0.0.1 is within the allowlist.
+	insideInfo := core.PeerInfoFromContext(inside.pctx, true)
+	insideInfo.IP = "127.0.0.1"
+	outsideInfo := core.PeerInfoFromContext(outside.pctx, true)
+	outsideInfo.IP = "127.0.0.2"
+	leecher.scheduler.eventLoop.send(announceResultEvent{
+		infoHash: h,
+		peers:    []*core.PeerInfo{outsideInfo, insideInfo},
+	})
+
+	require.NoError(<-errc)
+	leecher.checkTorrent(t, namespace, blob)
+
+	var connected []string
+	for _, e := range leecher.testProducer.Events() {
+		if e.Name == networkevent.AddActiveConn {
+			connected = append(connected, e.Peer)
+		}
+	}
+	require.Equal([]string{inside.pctx.PeerID.String()}, connected)
+	require.Empty(outside.testProducer.Events())
+}
+
+func TestDownloadManyTorrentsWithAnnounceBatching(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newTestMocks(t)
+	defer cleanup()
+
+	config := configFixture()
+	config.AnnounceBatch = AnnounceBatchConfig{Enabled: true, MaxSize: 4}.applyDefaults()
+	namespace := core.TagFixture()
+
+	seeder := mocks.newPeer(config)
+	leecher := mocks.newPeer(config)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		blob := core.NewBlobFixture()
+
+		mocks.metaInfoClient.EXPECT().Download(
+			namespace, blob.Digest).Return(blob.MetaInfo, nil).Times(2)
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			seeder.writeTorrent(namespace, blob)
+			require.NoError(seeder.scheduler.Download(namespace, blob.Digest))
+
+			require.NoError(leecher.scheduler.Download(namespace, blob.Digest))
+			leecher.checkTorrent(t, namespace, blob)
+		}()
+	}
+	wg.Wait()
+}
+
+func TestParsePeerAddress(t *testing.T) {
+	peerID := core.PeerIDFixture()
+
+	tests := []struct {
+		desc  string
+		addr  *p2p.PeerAddress
+		valid bool
+	}{
+		{"ip", &p2p.PeerAddress{PeerID: peerID.String(), Ip: "10.0.0.1", Port: 8000}, true},
+		{"hostname", &p2p.PeerAddress{PeerID: peerID.String(), Ip: "host-1.example", Port: 8000}, true},
+		{"nil", nil, false},
+		{"invalid peer id", &p2p.PeerAddress{PeerID: "foo", Ip: "10.0.0.1", Port: 8000}, false},
+		{"empty ip", &p2p.PeerAddress{PeerID: peerID.String(), Port: 8000}, false},
+		{"unspecified ip", &p2p.PeerAddress{PeerID: peerID.String(), Ip: "0.0.0.0", Port: 8000}, false},
+		{"invalid host", &p2p.PeerAddress{PeerID: peerID.String(), Ip: "host:80/x", Port: 8000}, false},
+		{"invalid port", &p2p.PeerAddress{PeerID: peerID.String(), Ip: "10.0.0.1", Port: 70000}, false},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			p, err := parsePeerAddress(test.addr)
+			if test.valid {
+				require.NoError(t, err)
+				require.Equal(t, peerID, p.PeerID)
+			} else {
+				require.Error(t, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,149 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package scheduler
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+
+	"github.com/uber/kraken/core"
+
+	"github.com/c2h5oh/datasize"
+)
+
+// Sources which torrents may be downloaded from.
+const (
+	SourcePeer   = "peer"
+	SourceOrigin = "origin"
+)
+
+// SourceRule defines the source preference for the downloads it matches. All
+// set conditions must match. Swarm size is the number of known non-origin
+// peers of the torrent. Minimums are inclusive, maximums are exclusive, and
+// zero values are unbounded, e.g. a max swarm size of 1 matches first-of-kind
+// downloads which no other peer has announced yet.
+type SourceRule struct {
+	Namespace    string            `yaml:"namespace"`
+	MinSwarmSize int               `yaml:"min_swarm_size"`
+	MaxSwarmSize int               `yaml:"max_swarm_size"`
+	MinBlobSize  datasize.ByteSize `yaml:"min_blob_size"`
+	MaxBlobSize  datasize.ByteSize `yaml:"max_blob_size"`
+
+	// Order lists sources by preference. Connections are opened to peers of
+	// preferred sources first, such that they claim connection capacity.
+	// Sources not listed are tried last.
+	Order []string `yaml:"order"`
+}
+
+// SourcePolicyConfig defines per-download source preferences. The first
+// matching rule applies. If no rule matches, peers are connected to in the
+// order handed out by the tracker.
+type SourcePolicyConfig struct {
+	Rules []SourceRule `yaml:"rules"`
+}
+
+type sourceRule struct {
+	SourceRule
+	namespace *regexp.Regexp
+	rank      map[string]int
+}
+
+func (r *sourceRule) matches(namespace string, swarmSize int, blobSize int64) bool {
+	if r.namespace != nil && !r.namespace.MatchString(namespace) {
+		return false
+	}
+	if swarmSize < r.MinSwarmSize {
+		return false
+	}
+	if r.MaxSwarmSize > 0 && swarmSize >= r.MaxSwarmSize {
+		return false
+	}
+	if blobSize < int64(r.MinBlobSize) {
+		return false
+	}
+	if r.MaxBlobSize > 0 && blobSize >= int64(r.MaxBlobSize) {
+		return false
+	}
+	return true
+}
+
+// sourcePolicy orders the peers of downloads by source preference.
+type sourcePolicy struct {
+	rules []*sourceRule
+}
+
+func (c SourcePolicyConfig) build() (*sourcePolicy, error) {
+	p := &sourcePolicy{}
+	for i, r := range c.Rules {
+		rule := &sourceRule{SourceRule: r, rank: make(map[string]int)}
+		if r.Namespace != "" {
+			re, err := regexp.Compile(r.Namespace)
+			if err != nil {
+				return nil, fmt.Errorf("rule %d: namespace: %s", i, err)
+			}
+			rule.namespace = re
+		}
+		if len(r.Order) == 0 {
+			return nil, fmt.Errorf("rule %d: order required", i)
+		}
+		for j, source := range r.Order {
+			if source != SourcePeer && source != SourceOrigin {
+				return nil, fmt.Errorf("rule %d: invalid source %q", i, source)
+			}
+			rule.rank[source] = j
+		}
+		p.rules = append(p.rules, rule)
+	}
+	return p, nil
+}
+
+func sourceOf(p *core.PeerInfo) string {
+	if p.Origin {
+		return SourceOrigin
+	}
+	return SourcePeer
+}
+
+// order returns peers sorted by the source preference of the first rule
+// matching the download. Peers of the same source keep their relative order.
+func (p *sourcePolicy) order(namespace string, blobSize int64, peers []*core.PeerInfo) []*core.PeerInfo {
+	if len(p.rules) == 0 {
+		return peers
+	}
+	var swarmSize int
+	for _, peer := range peers {
+		if !peer.Origin {
+			swarmSize++
+		}
+	}
+	for _, r := range p.rules {
+		if !r.matches(namespace, swarmSize, blobSize) {
+			continue
+		}
+		rank := func(peer *core.PeerInfo) int {
+			if i, ok := r.rank[sourceOf(peer)]; ok {
+				return i
+			}
+			return len(r.rank)
+		}
+		sorted := make([]*core.PeerInfo, len(peers))
+		copy(sorted, peers)
+		sort.SliceStable(sorted, func(i, j int) bool {
+			return rank(sorted[i]) < rank(sorted[j])
+		})
+		return sorted
+	}
+	return peers
+}
@@ -0,0 +1,103 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package scheduler
+
+import (
+	"testing"
+
+	"github.com/uber/kraken/core"
+
+	"github.com/c2h5oh/datasize"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSourcePolicyOrder(t *testing.T) {
+	peer1 := core.PeerInfoFixture()
+	peer2 := core.PeerInfoFixture()
+	origin := core.OriginPeerInfoFixture()
+	peers := []*core.PeerInfo{peer1, origin, peer2}
+
+	config := SourcePolicyConfig{
+		Rules: []SourceRule{{
+			Namespace:   "^large/",
+			MinBlobSize: datasize.GB,
+			Order:       []string{SourceOrigin, SourcePeer},
+		}, {
+			MinSwarmSize: 2,
+			Order:        []string{SourcePeer, SourceOrigin},
+		}, {
+			Order: []string{SourceOrigin},
+		}},
+	}
+
+	tests := []struct {
+		desc      string
+		namespace string
+		blobSize  int64
+		peers     []*core.PeerInfo
+		expected  []*core.PeerInfo
+	}{
+		{
+			"large blob prefers origin",
+			"large/repo", int64(2 * datasize.GB), peers,
+			[]*core.PeerInfo{origin, peer1, peer2},
+		}, {
+			"popular blob prefers peers",
+			"small/repo", 1, peers,
+			[]*core.PeerInfo{peer1, peer2, origin},
+		}, {
+			"first of kind prefers origin",
+			"small/repo", 1, []*core.PeerInfo{peer1, origin},
+			[]*core.PeerInfo{origin, peer1},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			require := require.New(t)
+
+			p, err := config.build()
+			require.NoError(err)
+			require.Equal(test.expected, p.order(test.namespace, test.blobSize, test.peers))
+		})
+	}
+}
+
+func TestSourcePolicyNoRulesPreservesOrder(t *testing.T) {
+	require := require.New(t)
+
+	peers := []*core.PeerInfo{
+		core.OriginPeerInfoFixture(), core.PeerInfoFixture(), core.OriginPeerInfoFixture(),
+	}
+
+	p, err := SourcePolicyConfig{}.build()
+	require.NoError(err)
+	require.Equal(peers, p.order("ns", 1, peers))
+}
+
+func TestSourcePolicyInvalidConfig(t *testing.T) {
+	tests := []struct {
+		desc string
+		rule SourceRule
+	}{
+		{"invalid namespace", SourceRule{Namespace: "(", Order: []string{SourcePeer}}},
+		{"empty order", SourceRule{}},
+		{"invalid source", SourceRule{Order: []string{"backend"}}},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			_, err := SourcePolicyConfig{Rules: []SourceRule{test.rule}}.build()
+			require.Error(t, err)
+		})
+	}
+}
@@ -16,6 +16,7 @@ package scheduler
 import (
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/uber/kraken/core"
 	"github.com/uber/kraken/lib/torrent/networkevent"
@@ -52,6 +53,21 @@ type state struct {
 	torrentControls map[core.InfoHash]*torrentControl
 	conns           *connstate.State
 	announceQueue   announcequeue.Queue
+
+	// pexPeers holds the addresses of peers we have active outgoing conns to,
+	// which are known to be reachable and thus safe to gossip.
+	pexPeers map[core.InfoHash]map[core.PeerID]*core.PeerInfo
+
+	// pexReceived tracks when peer exchange messages were last accepted per conn.
+	pexReceived map[pexKey]time.Time
+
+	// seeded tracks torrents for which the last announce returned another
+	// complete peer or an origin.
+	seeded map[core.InfoHash]bool
+
+	// announceCredits counts the announce ticks not yet spent on an announce,
+	// such that batches announce no more torrents than the ticks they span.
+	announceCredits int
 }
 
 func newState(s *scheduler, aq announcequeue.Queue) *state {
@@ -61,6 +77,9 @@ func newState(s *scheduler, aq announcequeue.Queue) *state {
 		conns: connstate.New(
 			s.config.ConnState, s.clock, s.pctx.PeerID, s.netevents, s.logger),
 		announceQueue: aq,
+		pexPeers:      make(map[core.InfoHash]map[core.PeerID]*core.PeerInfo),
+		pexReceived:   make(map[pexKey]time.Time),
+		seeded:        make(map[core.InfoHash]bool),
 	}
 }
 
@@ -114,11 +133,46 @@ func (s *state) removeTorrent(h core.InfoHash, err error) {
 		s.sched.torrentArchive.DeleteTorrent(ctrl.dispatcher.Digest())
 	}
 	delete(s.torrentControls, h)
+	delete(s.pexPeers, h)
+	delete(s.seeded, h)
+}
+
+// addPendingPeers adds peers to the pending conns of the torrent of h, in order
+// of source preference, and asynchronously handshakes them, until the torrent
+// is at capacity. Peers outside the network policy are never dialed.
+func (s *state) addPendingPeers(h core.InfoHash, ctrl *torrentControl, peers []*core.PeerInfo) {
+	peers = s.sched.sources.order(ctrl.namespace, ctrl.dispatcher.Length(), peers)
+	for _, p := range peers {
+		if p.PeerID == s.sched.pctx.PeerID {
+			// Tracker may return our own peer.
+			continue
+		}
+		if s.conns.Blacklisted(p.PeerID, h) {
+			continue
+		}
+		if !s.sched.network.allows(p.IP) {
+			s.sched.stats.Tagged(map[string]string{
+				"direction": "outgoing",
+			}).Counter("network_policy_rejects").Inc(1)
+			continue
+		}
+		if err := s.conns.AddPending(p.PeerID, h, nil); err != nil {
+			if err == connstate.ErrTorrentAtCapacity {
+				break
+			}
+			continue
+		}
+		go s.sched.initializeOutgoingHandshake(
+			p, ctrl.dispatcher.Stat(), ctrl.dispatcher.RemoteBitfields(), ctrl.namespace)
+	}
 }
 
-// addOutgoingConn adds a conn, initialized by us, to state. The conn must already
-// be in a pending state, and the torrent control must already be initialized.
-func (s *state) addOutgoingConn(c *conn.Conn, b *bitset.BitSet, info *storage.TorrentInfo) error {
+// addOutgoingConn adds a conn to p, initialized by us, to state. The conn must
+// already be in a pending state, and the torrent control must already be
+// initialized.
+func (s *state) addOutgoingConn(
+	c *conn.Conn, b *bitset.BitSet, info *storage.TorrentInfo, p *core.PeerInfo) error {
+
 	if err := s.conns.MovePendingToActive(c); err != nil {
 		return fmt.Errorf("move pending to active: %s", err)
 	}
@@ -130,6 +184,12 @@ func (s *state) addOutgoingConn(c *conn.Conn, b *bitset.BitSet, info *storage.To
 	if err := ctrl.dispatcher.AddPeer(c.PeerID(), b, c); err != nil {
 		return fmt.Errorf("add conn to dispatcher: %s", err)
 	}
+	peers, ok := s.pexPeers[info.InfoHash()]
+	if !ok {
+		peers = make(map[core.PeerID]*core.PeerInfo)
+		s.pexPeers[info.InfoHash()] = peers
+	}
+	peers[c.PeerID()] = p
 	return nil
 }
 
@@ -115,7 +115,7 @@ type testPeer struct {
 	cleanup        *testutil.Cleanup
 }
 
-func (m *testMocks) newPeer(config Config, options ...option) *testPeer {
+func (m *testMocks) newPeer(config Config, options ...Option) *testPeer {
 	var cleanup testutil.Cleanup
 	m.cleanup.Add(cleanup.Run)
 
@@ -35,12 +35,12 @@ var (
 // pieces.
 type Torrent struct {
 	metaInfo    *core.MetaInfo
-	cas         *store.CAStore
+	cas         store.Driver
 	numComplete *atomic.Int32
 }
 
 // NewTorrent creates a new Torrent.
-func NewTorrent(cas *store.CAStore, mi *core.MetaInfo) (*Torrent, error) {
+func NewTorrent(cas store.Driver, mi *core.MetaInfo) (*Torrent, error) {
 	return &Torrent{
 		cas:         cas,
 		metaInfo:    mi,
@@ -30,15 +30,33 @@ import (
 // TorrentArchive is a TorrentArchive for origin peers. It assumes that
 // all files (including metainfo) are already downloaded and in the cache directory.
 type TorrentArchive struct {
-	cas           *store.CAStore
+	cas           store.Driver
 	blobRefresher *blobrefresh.Refresher
+	onSeed        func(namespace string, d core.Digest, size int64)
+}
+
+// Option allows setting optional TorrentArchive parameters.
+type Option func(*TorrentArchive)
+
+// WithSeedHook configures f to be called whenever a torrent of an existing
+// file is opened for seeding.
+func WithSeedHook(f func(namespace string, d core.Digest, size int64)) Option {
+	return func(a *TorrentArchive) { a.onSeed = f }
 }
 
 // NewTorrentArchive creates a new TorrentArchive.
 func NewTorrentArchive(
-	cas *store.CAStore, blobRefresher *blobrefresh.Refresher) *TorrentArchive {
+	cas store.Driver, blobRefresher *blobrefresh.Refresher, opts ...Option) *TorrentArchive {
 
-	return &TorrentArchive{cas, blobRefresher}
+	a := &TorrentArchive{
+		cas:           cas,
+		blobRefresher: blobRefresher,
+		onSeed:        func(string, core.Digest, int64) {},
+	}
+	for _, opt := range opts {
+		opt(a)
+	}
+	return a
 }
 
 func (a *TorrentArchive) getMetaInfo(namespace string, d core.Digest) (*core.MetaInfo, error) {
@@ -85,6 +103,7 @@ func (a *TorrentArchive) GetTorrent(namespace string, d core.Digest) (storage.To
 	if err != nil {
 		return nil, fmt.Errorf("initialize torrent: %s", err)
 	}
+	a.onSeed(namespace, d, mi.Length())
 	return t, nil
 }
 
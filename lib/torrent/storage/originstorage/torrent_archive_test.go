@@ -35,7 +35,7 @@ import (
 const pieceLength = 4
 
 type archiveMocks struct {
-	cas           *store.CAStore
+	cas           store.Driver
 	backendClient *mockbackend.MockClient
 	blobRefresher *blobrefresh.Refresher
 }
@@ -44,8 +44,7 @@ func newArchiveMocks(t *testing.T, namespace string) (*archiveMocks, func()) {
 	var cleanup testutil.Cleanup
 	defer cleanup.Recover()
 
-	cas, c := store.CAStoreFixture()
-	cleanup.Add(c)
+	cas := store.NewMemoryDriver()
 
 	ctrl := gomock.NewController(t)
 	cleanup.Add(ctrl.Finish)
@@ -118,6 +117,34 @@ func TestTorrentArchiveGetTorrentNoExistTriggersRefresh(t *testing.T) {
 	require.True(tor.Complete())
 }
 
+func TestTorrentArchiveGetTorrentCallsSeedHook(t *testing.T) {
+	require := require.New(t)
+
+	namespace := core.TagFixture()
+	mocks, cleanup := newArchiveMocks(t, namespace)
+	defer cleanup()
+
+	var seeded []core.Digest
+	archive := NewTorrentArchive(mocks.cas, mocks.blobRefresher, WithSeedHook(
+		func(ns string, d core.Digest, size int64) {
+			require.Equal(namespace, ns)
+			require.Equal(int64(100), size)
+			seeded = append(seeded, d)
+		}))
+
+	blob := core.SizedBlobFixture(100, pieceLength)
+
+	mocks.backendClient.EXPECT().Stat(namespace,
+		blob.Digest.Hex()).Return(core.NewBlobInfo(int64(len(blob.Content))), nil)
+	mocks.backendClient.EXPECT().Download(namespace, blob.Digest.Hex(), mockutil.MatchWriter(blob.Content))
+
+	require.NoError(testutil.PollUntilTrue(5*time.Second, func() bool {
+		_, err := archive.GetTorrent(namespace, blob.Digest)
+		return err == nil
+	}))
+	require.Equal([]core.Digest{blob.Digest}, seeded)
+}
+
 func TestTorrentArchiveDeleteTorrent(t *testing.T) {
 	require := require.New(t)
 
@@ -30,8 +30,7 @@ import (
 func TestTorrentCreate(t *testing.T) {
 	require := require.New(t)
 
-	cas, cleanup := store.CAStoreFixture()
-	defer cleanup()
+	cas := store.NewMemoryDriver()
 
 	blob := core.SizedBlobFixture(7, 2)
 	mi := blob.MetaInfo
@@ -58,8 +57,7 @@ func TestTorrentCreate(t *testing.T) {
 func TestTorrentGetPieceReaderConcurrent(t *testing.T) {
 	require := require.New(t)
 
-	cas, cleanup := store.CAStoreFixture()
-	defer cleanup()
+	cas := store.NewMemoryDriver()
 
 	blob := core.SizedBlobFixture(7, 2)
 	mi := blob.MetaInfo
@@ -91,8 +89,7 @@ func TestTorrentGetPieceReaderConcurrent(t *testing.T) {
 func TestTorrentWritePieceError(t *testing.T) {
 	require := require.New(t)
 
-	cas, cleanup := store.CAStoreFixture()
-	defer cleanup()
+	cas := store.NewMemoryDriver()
 
 	blob := core.SizedBlobFixture(7, 2)
 	mi := blob.MetaInfo
@@ -0,0 +1,52 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package migrations
+
+import (
+	"database/sql"
+
+	"github.com/pressly/goose"
+)
+
+func init() {
+	goose.AddMigration(up00005, down00005)
+}
+
+func up00005(tx *sql.Tx) error {
+	if _, err := tx.Exec(`
+		CREATE TABLE IF NOT EXISTS tag_reference (
+			tag          text NOT NULL,
+			dependencies blob NOT NULL,
+			PRIMARY KEY(tag)
+		);
+	`); err != nil {
+		return err
+	}
+	_, err := tx.Exec(`
+		CREATE TABLE IF NOT EXISTS blob_reference (
+			digest blob    NOT NULL,
+			count  integer NOT NULL,
+			PRIMARY KEY(digest)
+		);
+	`)
+	return err
+}
+
+func down00005(tx *sql.Tx) error {
+	if _, err := tx.Exec(`DROP TABLE tag_reference;`); err != nil {
+		return err
+	}
+	_, err := tx.Exec(`DROP TABLE blob_reference;`)
+	return err
+}
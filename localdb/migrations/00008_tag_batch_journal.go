@@ -0,0 +1,43 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package migrations
+
+import (
+	"database/sql"
+
+	"github.com/pressly/goose"
+)
+
+func init() {
+	goose.AddMigration(up00008, down00008)
+}
+
+func up00008(tx *sql.Tx) error {
+	_, err := tx.Exec(`
+		CREATE TABLE IF NOT EXISTS tag_batch_journal (
+			batch_id  integer NOT NULL,
+			tag       text    NOT NULL,
+			prior     blob    NOT NULL,
+			value     blob    NOT NULL,
+			committed integer NOT NULL DEFAULT 0,
+			PRIMARY KEY(batch_id, tag)
+		);
+	`)
+	return err
+}
+
+func down00008(tx *sql.Tx) error {
+	_, err := tx.Exec(`DROP TABLE tag_batch_journal;`)
+	return err
+}
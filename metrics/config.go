@@ -18,6 +18,12 @@ type Config struct {
 	Backend string       `yaml:"backend"`
 	Statsd  StatsdConfig `yaml:"statsd"`
 	M3      M3Config     `yaml:"m3"`
+
+	Histograms HistogramsConfig `yaml:"histograms"`
+
+	// Namespaces bounds the namespaces which per-namespace metrics are broken
+	// down by.
+	Namespaces NamespacesConfig `yaml:"namespaces"`
 }
 
 // StatsdConfig defines statsd configuration.
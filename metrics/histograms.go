@@ -0,0 +1,63 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package metrics
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/uber-go/tally"
+)
+
+// HistogramsConfig defines the bucket boundaries of latency histograms per
+// operation type, such that buckets can be aligned to latency objectives.
+// Operations without configured buckets keep their default instrumentation.
+// Metric names are the same either way.
+type HistogramsConfig struct {
+	TagGet          []time.Duration `yaml:"tag_get"`
+	TagPut          []time.Duration `yaml:"tag_put"`
+	BackendDownload []time.Duration `yaml:"backend_download"`
+	BackendUpload   []time.Duration `yaml:"backend_upload"`
+	Replication     []time.Duration `yaml:"replication"`
+}
+
+// Validate returns an error if the buckets of any operation are not positive
+// and strictly increasing.
+func (c HistogramsConfig) Validate() error {
+	for op, b := range map[string][]time.Duration{
+		"tag_get":          c.TagGet,
+		"tag_put":          c.TagPut,
+		"backend_download": c.BackendDownload,
+		"backend_upload":   c.BackendUpload,
+		"replication":      c.Replication,
+	} {
+		for i, d := range b {
+			if d <= 0 {
+				return fmt.Errorf("%s: bucket %s is not positive", op, d)
+			}
+			if i > 0 && d <= b[i-1] {
+				return fmt.Errorf("%s: bucket %s does not exceed previous bucket %s", op, d, b[i-1])
+			}
+		}
+	}
+	return nil
+}
+
+// DurationBuckets returns b as histogram buckets, or fallback if b is empty.
+func DurationBuckets(b []time.Duration, fallback tally.Buckets) tally.Buckets {
+	if len(b) == 0 {
+		return fallback
+	}
+	return tally.DurationBuckets(b)
+}
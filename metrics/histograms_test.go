@@ -0,0 +1,52 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package metrics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHistogramsConfigValidate(t *testing.T) {
+	tests := []struct {
+		desc   string
+		config HistogramsConfig
+		valid  bool
+	}{
+		{"empty", HistogramsConfig{}, true},
+		{"increasing", HistogramsConfig{TagGet: []time.Duration{time.Millisecond, time.Second}}, true},
+		{"decreasing", HistogramsConfig{TagPut: []time.Duration{time.Second, time.Millisecond}}, false},
+		{"duplicate", HistogramsConfig{Replication: []time.Duration{time.Second, time.Second}}, false},
+		{"zero", HistogramsConfig{BackendUpload: []time.Duration{0, time.Second}}, false},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			err := test.config.Validate()
+			if test.valid {
+				require.NoError(t, err)
+			} else {
+				require.Error(t, err)
+			}
+		})
+	}
+}
+
+func TestNewRejectsInvalidHistograms(t *testing.T) {
+	_, _, err := New(Config{
+		Histograms: HistogramsConfig{TagGet: []time.Duration{time.Second, time.Millisecond}},
+	}, "")
+	require.Error(t, err)
+}
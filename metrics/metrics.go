@@ -48,6 +48,9 @@ func New(config Config, cluster string) (tally.Scope, io.Closer, error) {
 	if config.Backend == "" {
 		config.Backend = "disabled"
 	}
+	if err := config.Histograms.Validate(); err != nil {
+		return nil, nil, fmt.Errorf("histograms: %s", err)
+	}
 	f, ok := _scopeFactories[config.Backend]
 	if !ok || f == nil {
 		return nil, nil, fmt.Errorf("metrics backend %q not registered", config.Backend)
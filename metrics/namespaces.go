@@ -0,0 +1,66 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package metrics
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// OtherNamespace is the tag of namespaces which match no configured namespace.
+const OtherNamespace = "other"
+
+// NamespacesConfig defines the namespaces which per-namespace metrics are
+// broken down by. Since namespaces are chosen by clients, tagging metrics with
+// every namespace would grow their cardinality without bound.
+type NamespacesConfig struct {
+	// Patterns are regular expressions, each matching namespaces in full.
+	// Metrics of a namespace are tagged with the first pattern it matches, and
+	// with OtherNamespace if it matches none.
+	Patterns []string `yaml:"patterns"`
+}
+
+// NamespaceTagger maps namespaces to a bounded set of metric tags.
+type NamespaceTagger struct {
+	patterns []string
+	regexps  []*regexp.Regexp
+}
+
+// Build validates c and returns a NamespaceTagger.
+func (c NamespacesConfig) Build() (*NamespaceTagger, error) {
+	t := &NamespaceTagger{}
+	for _, p := range c.Patterns {
+		re, err := regexp.Compile("^(?:" + p + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("pattern %q: %s", p, err)
+		}
+		t.patterns = append(t.patterns, p)
+		t.regexps = append(t.regexps, re)
+	}
+	return t, nil
+}
+
+// Tag returns the metric tag of namespace. Nil taggers tag every namespace as
+// OtherNamespace.
+func (t *NamespaceTagger) Tag(namespace string) string {
+	if t == nil {
+		return OtherNamespace
+	}
+	for i, re := range t.regexps {
+		if re.MatchString(namespace) {
+			return t.patterns[i]
+		}
+	}
+	return OtherNamespace
+}
@@ -0,0 +1,50 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package metrics
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNamespaceTaggerTag(t *testing.T) {
+	tagger, err := NamespacesConfig{Patterns: []string{"library/.*", "ci/.*"}}.Build()
+	require.NoError(t, err)
+
+	tests := []struct {
+		namespace string
+		expected  string
+	}{
+		{"library/ubuntu", "library/.*"},
+		{"ci/builds/foo", "ci/.*"},
+		{"team/library/ubuntu", OtherNamespace},
+		{"", OtherNamespace},
+	}
+	for _, test := range tests {
+		t.Run(test.namespace, func(t *testing.T) {
+			require.Equal(t, test.expected, tagger.Tag(test.namespace))
+		})
+	}
+}
+
+func TestNilNamespaceTaggerTagsOther(t *testing.T) {
+	var tagger *NamespaceTagger
+	require.Equal(t, OtherNamespace, tagger.Tag("library/ubuntu"))
+}
+
+func TestNamespacesConfigBuildRejectsInvalidPattern(t *testing.T) {
+	_, err := NamespacesConfig{Patterns: []string{"library/("}}.Build()
+	require.Error(t, err)
+}
@@ -63,3 +63,17 @@ func (mr *MockClientMockRecorder) GetTag(arg0 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetTag", reflect.TypeOf((*MockClient)(nil).GetTag), arg0)
 }
+
+// PrioritizeRange mocks base method
+func (m *MockClient) PrioritizeRange(arg0 core.Digest, arg1, arg2 int64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PrioritizeRange", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// PrioritizeRange indicates an expected call of PrioritizeRange
+func (mr *MockClientMockRecorder) PrioritizeRange(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PrioritizeRange", reflect.TypeOf((*MockClient)(nil).PrioritizeRange), arg0, arg1, arg2)
+}
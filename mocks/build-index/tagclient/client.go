@@ -9,6 +9,7 @@ import (
 	tagclient "github.com/uber/kraken/build-index/tagclient"
 	tagmodels "github.com/uber/kraken/build-index/tagmodels"
 	core "github.com/uber/kraken/core"
+	io "io"
 	reflect "reflect"
 	time "time"
 )
@@ -36,6 +37,34 @@ func (m *MockClient) EXPECT() *MockClientMockRecorder {
 	return m.recorder
 }
 
+// Delete mocks base method
+func (m *MockClient) Delete(arg0 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Delete", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Delete indicates an expected call of Delete
+func (mr *MockClientMockRecorder) Delete(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Delete", reflect.TypeOf((*MockClient)(nil).Delete), arg0)
+}
+
+// DuplicatePauseRemote mocks base method
+func (m *MockClient) DuplicatePauseRemote(arg0 string, arg1 bool) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DuplicatePauseRemote", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DuplicatePauseRemote indicates an expected call of DuplicatePauseRemote
+func (mr *MockClientMockRecorder) DuplicatePauseRemote(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DuplicatePauseRemote", reflect.TypeOf((*MockClient)(nil).DuplicatePauseRemote), arg0, arg1)
+}
+
 // DuplicatePut mocks base method
 func (m *MockClient) DuplicatePut(arg0 string, arg1 core.Digest, arg2 time.Duration) error {
 	m.ctrl.T.Helper()
@@ -51,17 +80,22 @@ func (mr *MockClientMockRecorder) DuplicatePut(arg0, arg1, arg2 interface{}) *go
 }
 
 // DuplicateReplicate mocks base method
-func (m *MockClient) DuplicateReplicate(arg0 string, arg1 core.Digest, arg2 core.DigestList, arg3 time.Duration) error {
+func (m *MockClient) DuplicateReplicate(arg0 string, arg1 core.Digest, arg2 core.DigestList, arg3 time.Duration, arg4 int, arg5 ...string) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "DuplicateReplicate", arg0, arg1, arg2, arg3)
+	varargs := []interface{}{arg0, arg1, arg2, arg3, arg4}
+	for _, a := range arg5 {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "DuplicateReplicate", varargs...)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // DuplicateReplicate indicates an expected call of DuplicateReplicate
-func (mr *MockClientMockRecorder) DuplicateReplicate(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+func (mr *MockClientMockRecorder) DuplicateReplicate(arg0, arg1, arg2, arg3, arg4 interface{}, arg5 ...interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DuplicateReplicate", reflect.TypeOf((*MockClient)(nil).DuplicateReplicate), arg0, arg1, arg2, arg3)
+	varargs := append([]interface{}{arg0, arg1, arg2, arg3, arg4}, arg5...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DuplicateReplicate", reflect.TypeOf((*MockClient)(nil).DuplicateReplicate), varargs...)
 }
 
 // Get mocks base method
@@ -79,6 +113,20 @@ func (mr *MockClientMockRecorder) Get(arg0 interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Get", reflect.TypeOf((*MockClient)(nil).Get), arg0)
 }
 
+// GetStream mocks base method
+func (m *MockClient) GetStream(arg0 string, arg1 io.Writer) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetStream", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// GetStream indicates an expected call of GetStream
+func (mr *MockClientMockRecorder) GetStream(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetStream", reflect.TypeOf((*MockClient)(nil).GetStream), arg0, arg1)
+}
+
 // Has mocks base method
 func (m *MockClient) Has(arg0 string) (bool, error) {
 	m.ctrl.T.Helper()
@@ -94,6 +142,20 @@ func (mr *MockClientMockRecorder) Has(arg0 interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Has", reflect.TypeOf((*MockClient)(nil).Has), arg0)
 }
 
+// InvalidateCache mocks base method
+func (m *MockClient) InvalidateCache(arg0 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "InvalidateCache", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// InvalidateCache indicates an expected call of InvalidateCache
+func (mr *MockClientMockRecorder) InvalidateCache(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "InvalidateCache", reflect.TypeOf((*MockClient)(nil).InvalidateCache), arg0)
+}
+
 // List mocks base method
 func (m *MockClient) List(arg0 string) ([]string, error) {
 	m.ctrl.T.Helper()
@@ -197,16 +259,149 @@ func (mr *MockClientMockRecorder) PutAndReplicate(arg0, arg1 interface{}) *gomoc
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PutAndReplicate", reflect.TypeOf((*MockClient)(nil).PutAndReplicate), arg0, arg1)
 }
 
+// PutAndReplicateTranslated mocks base method
+func (m *MockClient) PutAndReplicateTranslated(arg0 string, arg1, arg2 core.Digest) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PutAndReplicateTranslated", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// PutAndReplicateTranslated indicates an expected call of PutAndReplicateTranslated
+func (mr *MockClientMockRecorder) PutAndReplicateTranslated(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PutAndReplicateTranslated", reflect.TypeOf((*MockClient)(nil).PutAndReplicateTranslated), arg0, arg1, arg2)
+}
+
+// PutAndReplicateWithOptions mocks base method
+func (m *MockClient) PutAndReplicateWithOptions(arg0 string, arg1 core.Digest, arg2 tagclient.PutAndReplicateOptions) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PutAndReplicateWithOptions", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// PutAndReplicateWithOptions indicates an expected call of PutAndReplicateWithOptions
+func (mr *MockClientMockRecorder) PutAndReplicateWithOptions(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PutAndReplicateWithOptions", reflect.TypeOf((*MockClient)(nil).PutAndReplicateWithOptions), arg0, arg1, arg2)
+}
+
+// ReplicaRemotes mocks base method
+func (m *MockClient) ReplicaRemotes(arg0 string) ([]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReplicaRemotes", arg0)
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ReplicaRemotes indicates an expected call of ReplicaRemotes
+func (mr *MockClientMockRecorder) ReplicaRemotes(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReplicaRemotes", reflect.TypeOf((*MockClient)(nil).ReplicaRemotes), arg0)
+}
+
 // Replicate mocks base method
-func (m *MockClient) Replicate(arg0 string) error {
+func (m *MockClient) Replicate(arg0 string, arg1 ...string) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "Replicate", arg0)
+	varargs := []interface{}{arg0}
+	for _, a := range arg1 {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "Replicate", varargs...)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // Replicate indicates an expected call of Replicate
-func (mr *MockClientMockRecorder) Replicate(arg0 interface{}) *gomock.Call {
+func (mr *MockClientMockRecorder) Replicate(arg0 interface{}, arg1 ...interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]interface{}{arg0}, arg1...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Replicate", reflect.TypeOf((*MockClient)(nil).Replicate), varargs...)
+}
+
+// ReplicateBatch mocks base method
+func (m *MockClient) ReplicateBatch(arg0 []string, arg1 bool) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReplicateBatch", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ReplicateBatch indicates an expected call of ReplicateBatch
+func (mr *MockClientMockRecorder) ReplicateBatch(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReplicateBatch", reflect.TypeOf((*MockClient)(nil).ReplicateBatch), arg0, arg1)
+}
+
+// ReplicateTo mocks base method
+func (m *MockClient) ReplicateTo(arg0 string, arg1 ...string) error {
+	m.ctrl.T.Helper()
+	varargs := []interface{}{arg0}
+	for _, a := range arg1 {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "ReplicateTo", varargs...)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ReplicateTo indicates an expected call of ReplicateTo
+func (mr *MockClientMockRecorder) ReplicateTo(arg0 interface{}, arg1 ...interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]interface{}{arg0}, arg1...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReplicateTo", reflect.TypeOf((*MockClient)(nil).ReplicateTo), varargs...)
+}
+
+// ReplicateWithCallback mocks base method
+func (m *MockClient) ReplicateWithCallback(arg0 string, arg1 core.DigestList, arg2 string, arg3 ...string) error {
+	m.ctrl.T.Helper()
+	varargs := []interface{}{arg0, arg1, arg2}
+	for _, a := range arg3 {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "ReplicateWithCallback", varargs...)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ReplicateWithCallback indicates an expected call of ReplicateWithCallback
+func (mr *MockClientMockRecorder) ReplicateWithCallback(arg0, arg1, arg2 interface{}, arg3 ...interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]interface{}{arg0, arg1, arg2}, arg3...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReplicateWithCallback", reflect.TypeOf((*MockClient)(nil).ReplicateWithCallback), varargs...)
+}
+
+// ReplicateWithDependencies mocks base method
+func (m *MockClient) ReplicateWithDependencies(arg0 string, arg1 core.DigestList, arg2 ...string) error {
+	m.ctrl.T.Helper()
+	varargs := []interface{}{arg0, arg1}
+	for _, a := range arg2 {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "ReplicateWithDependencies", varargs...)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ReplicateWithDependencies indicates an expected call of ReplicateWithDependencies
+func (mr *MockClientMockRecorder) ReplicateWithDependencies(arg0, arg1 interface{}, arg2 ...interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]interface{}{arg0, arg1}, arg2...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReplicateWithDependencies", reflect.TypeOf((*MockClient)(nil).ReplicateWithDependencies), varargs...)
+}
+
+// Undelete mocks base method
+func (m *MockClient) Undelete(arg0 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Undelete", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Undelete indicates an expected call of Undelete
+func (mr *MockClientMockRecorder) Undelete(arg0 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Replicate", reflect.TypeOf((*MockClient)(nil).Replicate), arg0)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Undelete", reflect.TypeOf((*MockClient)(nil).Undelete), arg0)
 }
@@ -9,6 +9,7 @@ import (
 	base "github.com/uber/kraken/lib/store/base"
 	metadata "github.com/uber/kraken/lib/store/metadata"
 	io "io"
+	fs "io/fs"
 	reflect "reflect"
 )
 
@@ -49,6 +50,48 @@ func (mr *MockFileStoreMockRecorder) CreateCacheFile(arg0, arg1 interface{}) *go
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateCacheFile", reflect.TypeOf((*MockFileStore)(nil).CreateCacheFile), arg0, arg1)
 }
 
+// DeleteCacheFile mocks base method
+func (m *MockFileStore) DeleteCacheFile(arg0 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteCacheFile", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteCacheFile indicates an expected call of DeleteCacheFile
+func (mr *MockFileStoreMockRecorder) DeleteCacheFile(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteCacheFile", reflect.TypeOf((*MockFileStore)(nil).DeleteCacheFile), arg0)
+}
+
+// DeleteCacheFileMetadata mocks base method
+func (m *MockFileStore) DeleteCacheFileMetadata(arg0 string, arg1 metadata.Metadata) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteCacheFileMetadata", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteCacheFileMetadata indicates an expected call of DeleteCacheFileMetadata
+func (mr *MockFileStoreMockRecorder) DeleteCacheFileMetadata(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteCacheFileMetadata", reflect.TypeOf((*MockFileStore)(nil).DeleteCacheFileMetadata), arg0, arg1)
+}
+
+// GetCacheFileMetadata mocks base method
+func (m *MockFileStore) GetCacheFileMetadata(arg0 string, arg1 metadata.Metadata) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetCacheFileMetadata", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// GetCacheFileMetadata indicates an expected call of GetCacheFileMetadata
+func (mr *MockFileStoreMockRecorder) GetCacheFileMetadata(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetCacheFileMetadata", reflect.TypeOf((*MockFileStore)(nil).GetCacheFileMetadata), arg0, arg1)
+}
+
 // GetCacheFileReader mocks base method
 func (m *MockFileStore) GetCacheFileReader(arg0 string) (base.FileReader, error) {
 	m.ctrl.T.Helper()
@@ -64,6 +107,36 @@ func (mr *MockFileStoreMockRecorder) GetCacheFileReader(arg0 interface{}) *gomoc
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetCacheFileReader", reflect.TypeOf((*MockFileStore)(nil).GetCacheFileReader), arg0)
 }
 
+// GetCacheFileStat mocks base method
+func (m *MockFileStore) GetCacheFileStat(arg0 string) (fs.FileInfo, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetCacheFileStat", arg0)
+	ret0, _ := ret[0].(fs.FileInfo)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetCacheFileStat indicates an expected call of GetCacheFileStat
+func (mr *MockFileStoreMockRecorder) GetCacheFileStat(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetCacheFileStat", reflect.TypeOf((*MockFileStore)(nil).GetCacheFileStat), arg0)
+}
+
+// ListCacheFiles mocks base method
+func (m *MockFileStore) ListCacheFiles() ([]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListCacheFiles")
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListCacheFiles indicates an expected call of ListCacheFiles
+func (mr *MockFileStoreMockRecorder) ListCacheFiles() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListCacheFiles", reflect.TypeOf((*MockFileStore)(nil).ListCacheFiles))
+}
+
 // SetCacheFileMetadata mocks base method
 func (m *MockFileStore) SetCacheFileMetadata(arg0 string, arg1 metadata.Metadata) (bool, error) {
 	m.ctrl.T.Helper()
@@ -5,7 +5,9 @@
 package mocktagstore
 
 import (
+	context "context"
 	gomock "github.com/golang/mock/gomock"
+	tagstore "github.com/uber/kraken/build-index/tagstore"
 	core "github.com/uber/kraken/core"
 	reflect "reflect"
 	time "time"
@@ -34,6 +36,32 @@ func (m *MockStore) EXPECT() *MockStoreMockRecorder {
 	return m.recorder
 }
 
+// Close mocks base method
+func (m *MockStore) Close() {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "Close")
+}
+
+// Close indicates an expected call of Close
+func (mr *MockStoreMockRecorder) Close() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Close", reflect.TypeOf((*MockStore)(nil).Close))
+}
+
+// Delete mocks base method
+func (m *MockStore) Delete(arg0 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Delete", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Delete indicates an expected call of Delete
+func (mr *MockStoreMockRecorder) Delete(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Delete", reflect.TypeOf((*MockStore)(nil).Delete), arg0)
+}
+
 // Get mocks base method
 func (m *MockStore) Get(arg0 string) (core.Digest, error) {
 	m.ctrl.T.Helper()
@@ -49,6 +77,50 @@ func (mr *MockStoreMockRecorder) Get(arg0 interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Get", reflect.TypeOf((*MockStore)(nil).Get), arg0)
 }
 
+// GetContext mocks base method
+func (m *MockStore) GetContext(arg0 context.Context, arg1 string) (core.Digest, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetContext", arg0, arg1)
+	ret0, _ := ret[0].(core.Digest)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetContext indicates an expected call of GetContext
+func (mr *MockStoreMockRecorder) GetContext(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetContext", reflect.TypeOf((*MockStore)(nil).GetContext), arg0, arg1)
+}
+
+// Invalidate mocks base method
+func (m *MockStore) Invalidate(arg0 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Invalidate", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Invalidate indicates an expected call of Invalidate
+func (mr *MockStoreMockRecorder) Invalidate(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Invalidate", reflect.TypeOf((*MockStore)(nil).Invalidate), arg0)
+}
+
+// Preload mocks base method
+func (m *MockStore) Preload(arg0 string) (core.Digest, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Preload", arg0)
+	ret0, _ := ret[0].(core.Digest)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Preload indicates an expected call of Preload
+func (mr *MockStoreMockRecorder) Preload(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Preload", reflect.TypeOf((*MockStore)(nil).Preload), arg0)
+}
+
 // Put mocks base method
 func (m *MockStore) Put(arg0 string, arg1 core.Digest, arg2 time.Duration) error {
 	m.ctrl.T.Helper()
@@ -62,3 +134,31 @@ func (mr *MockStoreMockRecorder) Put(arg0, arg1, arg2 interface{}) *gomock.Call
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Put", reflect.TypeOf((*MockStore)(nil).Put), arg0, arg1, arg2)
 }
+
+// PutBatch mocks base method
+func (m *MockStore) PutBatch(arg0 []tagstore.PutOp) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PutBatch", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// PutBatch indicates an expected call of PutBatch
+func (mr *MockStoreMockRecorder) PutBatch(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PutBatch", reflect.TypeOf((*MockStore)(nil).PutBatch), arg0)
+}
+
+// Undelete mocks base method
+func (m *MockStore) Undelete(arg0 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Undelete", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Undelete indicates an expected call of Undelete
+func (mr *MockStoreMockRecorder) Undelete(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Undelete", reflect.TypeOf((*MockStore)(nil).Undelete), arg0)
+}
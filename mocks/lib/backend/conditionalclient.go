@@ -0,0 +1,127 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: github.com/uber/kraken/lib/backend (interfaces: ConditionalClient)
+
+// Package mockbackend is a generated GoMock package.
+package mockbackend
+
+import (
+	gomock "github.com/golang/mock/gomock"
+	core "github.com/uber/kraken/core"
+	backend "github.com/uber/kraken/lib/backend"
+	io "io"
+	reflect "reflect"
+)
+
+// MockConditionalClient is a mock of ConditionalClient interface
+type MockConditionalClient struct {
+	ctrl     *gomock.Controller
+	recorder *MockConditionalClientMockRecorder
+}
+
+// MockConditionalClientMockRecorder is the mock recorder for MockConditionalClient
+type MockConditionalClientMockRecorder struct {
+	mock *MockConditionalClient
+}
+
+// NewMockConditionalClient creates a new mock instance
+func NewMockConditionalClient(ctrl *gomock.Controller) *MockConditionalClient {
+	mock := &MockConditionalClient{ctrl: ctrl}
+	mock.recorder = &MockConditionalClientMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockConditionalClient) EXPECT() *MockConditionalClientMockRecorder {
+	return m.recorder
+}
+
+// Capabilities mocks base method
+func (m *MockConditionalClient) Capabilities() backend.BackendCapabilities {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Capabilities")
+	ret0, _ := ret[0].(backend.BackendCapabilities)
+	return ret0
+}
+
+// Capabilities indicates an expected call of Capabilities
+func (mr *MockConditionalClientMockRecorder) Capabilities() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Capabilities", reflect.TypeOf((*MockConditionalClient)(nil).Capabilities))
+}
+
+// Download mocks base method
+func (m *MockConditionalClient) Download(arg0, arg1 string, arg2 io.Writer) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Download", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Download indicates an expected call of Download
+func (mr *MockConditionalClientMockRecorder) Download(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Download", reflect.TypeOf((*MockConditionalClient)(nil).Download), arg0, arg1, arg2)
+}
+
+// List mocks base method
+func (m *MockConditionalClient) List(arg0 string, arg1 ...backend.ListOption) (*backend.ListResult, error) {
+	m.ctrl.T.Helper()
+	varargs := []interface{}{arg0}
+	for _, a := range arg1 {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "List", varargs...)
+	ret0, _ := ret[0].(*backend.ListResult)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// List indicates an expected call of List
+func (mr *MockConditionalClientMockRecorder) List(arg0 interface{}, arg1 ...interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]interface{}{arg0}, arg1...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "List", reflect.TypeOf((*MockConditionalClient)(nil).List), varargs...)
+}
+
+// Stat mocks base method
+func (m *MockConditionalClient) Stat(arg0, arg1 string) (*core.BlobInfo, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Stat", arg0, arg1)
+	ret0, _ := ret[0].(*core.BlobInfo)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Stat indicates an expected call of Stat
+func (mr *MockConditionalClientMockRecorder) Stat(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Stat", reflect.TypeOf((*MockConditionalClient)(nil).Stat), arg0, arg1)
+}
+
+// Upload mocks base method
+func (m *MockConditionalClient) Upload(arg0, arg1 string, arg2 io.Reader) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Upload", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Upload indicates an expected call of Upload
+func (mr *MockConditionalClientMockRecorder) Upload(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Upload", reflect.TypeOf((*MockConditionalClient)(nil).Upload), arg0, arg1, arg2)
+}
+
+// UploadIfAbsent mocks base method
+func (m *MockConditionalClient) UploadIfAbsent(arg0, arg1 string, arg2 io.Reader) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UploadIfAbsent", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UploadIfAbsent indicates an expected call of UploadIfAbsent
+func (mr *MockConditionalClientMockRecorder) UploadIfAbsent(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UploadIfAbsent", reflect.TypeOf((*MockConditionalClient)(nil).UploadIfAbsent), arg0, arg1, arg2)
+}
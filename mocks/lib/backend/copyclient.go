@@ -0,0 +1,141 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: github.com/uber/kraken/lib/backend (interfaces: CopyClient)
+
+// Package mockbackend is a generated GoMock package.
+package mockbackend
+
+import (
+	gomock "github.com/golang/mock/gomock"
+	core "github.com/uber/kraken/core"
+	backend "github.com/uber/kraken/lib/backend"
+	io "io"
+	reflect "reflect"
+)
+
+// MockCopyClient is a mock of CopyClient interface
+type MockCopyClient struct {
+	ctrl     *gomock.Controller
+	recorder *MockCopyClientMockRecorder
+}
+
+// MockCopyClientMockRecorder is the mock recorder for MockCopyClient
+type MockCopyClientMockRecorder struct {
+	mock *MockCopyClient
+}
+
+// NewMockCopyClient creates a new mock instance
+func NewMockCopyClient(ctrl *gomock.Controller) *MockCopyClient {
+	mock := &MockCopyClient{ctrl: ctrl}
+	mock.recorder = &MockCopyClientMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockCopyClient) EXPECT() *MockCopyClientMockRecorder {
+	return m.recorder
+}
+
+// CanCopyFrom mocks base method
+func (m *MockCopyClient) CanCopyFrom(arg0 backend.Client) bool {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CanCopyFrom", arg0)
+	ret0, _ := ret[0].(bool)
+	return ret0
+}
+
+// CanCopyFrom indicates an expected call of CanCopyFrom
+func (mr *MockCopyClientMockRecorder) CanCopyFrom(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CanCopyFrom", reflect.TypeOf((*MockCopyClient)(nil).CanCopyFrom), arg0)
+}
+
+// Capabilities mocks base method
+func (m *MockCopyClient) Capabilities() backend.BackendCapabilities {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Capabilities")
+	ret0, _ := ret[0].(backend.BackendCapabilities)
+	return ret0
+}
+
+// Capabilities indicates an expected call of Capabilities
+func (mr *MockCopyClientMockRecorder) Capabilities() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Capabilities", reflect.TypeOf((*MockCopyClient)(nil).Capabilities))
+}
+
+// CopyFrom mocks base method
+func (m *MockCopyClient) CopyFrom(arg0 backend.Client, arg1, arg2 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CopyFrom", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CopyFrom indicates an expected call of CopyFrom
+func (mr *MockCopyClientMockRecorder) CopyFrom(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CopyFrom", reflect.TypeOf((*MockCopyClient)(nil).CopyFrom), arg0, arg1, arg2)
+}
+
+// Download mocks base method
+func (m *MockCopyClient) Download(arg0, arg1 string, arg2 io.Writer) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Download", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Download indicates an expected call of Download
+func (mr *MockCopyClientMockRecorder) Download(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Download", reflect.TypeOf((*MockCopyClient)(nil).Download), arg0, arg1, arg2)
+}
+
+// List mocks base method
+func (m *MockCopyClient) List(arg0 string, arg1 ...backend.ListOption) (*backend.ListResult, error) {
+	m.ctrl.T.Helper()
+	varargs := []interface{}{arg0}
+	for _, a := range arg1 {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "List", varargs...)
+	ret0, _ := ret[0].(*backend.ListResult)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// List indicates an expected call of List
+func (mr *MockCopyClientMockRecorder) List(arg0 interface{}, arg1 ...interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]interface{}{arg0}, arg1...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "List", reflect.TypeOf((*MockCopyClient)(nil).List), varargs...)
+}
+
+// Stat mocks base method
+func (m *MockCopyClient) Stat(arg0, arg1 string) (*core.BlobInfo, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Stat", arg0, arg1)
+	ret0, _ := ret[0].(*core.BlobInfo)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Stat indicates an expected call of Stat
+func (mr *MockCopyClientMockRecorder) Stat(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Stat", reflect.TypeOf((*MockCopyClient)(nil).Stat), arg0, arg1)
+}
+
+// Upload mocks base method
+func (m *MockCopyClient) Upload(arg0, arg1 string, arg2 io.Reader) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Upload", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Upload indicates an expected call of Upload
+func (mr *MockCopyClientMockRecorder) Upload(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Upload", reflect.TypeOf((*MockCopyClient)(nil).Upload), arg0, arg1, arg2)
+}
@@ -0,0 +1,127 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: github.com/uber/kraken/lib/backend (interfaces: DeleteClient)
+
+// Package mockbackend is a generated GoMock package.
+package mockbackend
+
+import (
+	gomock "github.com/golang/mock/gomock"
+	core "github.com/uber/kraken/core"
+	backend "github.com/uber/kraken/lib/backend"
+	io "io"
+	reflect "reflect"
+)
+
+// MockDeleteClient is a mock of DeleteClient interface
+type MockDeleteClient struct {
+	ctrl     *gomock.Controller
+	recorder *MockDeleteClientMockRecorder
+}
+
+// MockDeleteClientMockRecorder is the mock recorder for MockDeleteClient
+type MockDeleteClientMockRecorder struct {
+	mock *MockDeleteClient
+}
+
+// NewMockDeleteClient creates a new mock instance
+func NewMockDeleteClient(ctrl *gomock.Controller) *MockDeleteClient {
+	mock := &MockDeleteClient{ctrl: ctrl}
+	mock.recorder = &MockDeleteClientMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockDeleteClient) EXPECT() *MockDeleteClientMockRecorder {
+	return m.recorder
+}
+
+// Capabilities mocks base method
+func (m *MockDeleteClient) Capabilities() backend.BackendCapabilities {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Capabilities")
+	ret0, _ := ret[0].(backend.BackendCapabilities)
+	return ret0
+}
+
+// Capabilities indicates an expected call of Capabilities
+func (mr *MockDeleteClientMockRecorder) Capabilities() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Capabilities", reflect.TypeOf((*MockDeleteClient)(nil).Capabilities))
+}
+
+// Delete mocks base method
+func (m *MockDeleteClient) Delete(arg0, arg1 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Delete", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Delete indicates an expected call of Delete
+func (mr *MockDeleteClientMockRecorder) Delete(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Delete", reflect.TypeOf((*MockDeleteClient)(nil).Delete), arg0, arg1)
+}
+
+// Download mocks base method
+func (m *MockDeleteClient) Download(arg0, arg1 string, arg2 io.Writer) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Download", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Download indicates an expected call of Download
+func (mr *MockDeleteClientMockRecorder) Download(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Download", reflect.TypeOf((*MockDeleteClient)(nil).Download), arg0, arg1, arg2)
+}
+
+// List mocks base method
+func (m *MockDeleteClient) List(arg0 string, arg1 ...backend.ListOption) (*backend.ListResult, error) {
+	m.ctrl.T.Helper()
+	varargs := []interface{}{arg0}
+	for _, a := range arg1 {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "List", varargs...)
+	ret0, _ := ret[0].(*backend.ListResult)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// List indicates an expected call of List
+func (mr *MockDeleteClientMockRecorder) List(arg0 interface{}, arg1 ...interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]interface{}{arg0}, arg1...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "List", reflect.TypeOf((*MockDeleteClient)(nil).List), varargs...)
+}
+
+// Stat mocks base method
+func (m *MockDeleteClient) Stat(arg0, arg1 string) (*core.BlobInfo, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Stat", arg0, arg1)
+	ret0, _ := ret[0].(*core.BlobInfo)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Stat indicates an expected call of Stat
+func (mr *MockDeleteClientMockRecorder) Stat(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Stat", reflect.TypeOf((*MockDeleteClient)(nil).Stat), arg0, arg1)
+}
+
+// Upload mocks base method
+func (m *MockDeleteClient) Upload(arg0, arg1 string, arg2 io.Reader) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Upload", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Upload indicates an expected call of Upload
+func (mr *MockDeleteClientMockRecorder) Upload(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Upload", reflect.TypeOf((*MockDeleteClient)(nil).Upload), arg0, arg1, arg2)
+}
@@ -35,6 +35,21 @@ func (m *MockGCS) EXPECT() *MockGCSMockRecorder {
 	return m.recorder
 }
 
+// Copy mocks base method
+func (m *MockGCS) Copy(arg0, arg1, arg2 string) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Copy", arg0, arg1, arg2)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Copy indicates an expected call of Copy
+func (mr *MockGCSMockRecorder) Copy(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Copy", reflect.TypeOf((*MockGCS)(nil).Copy), arg0, arg1, arg2)
+}
+
 // Download mocks base method
 func (m *MockGCS) Download(arg0 string, arg1 io.Writer) (int64, error) {
 	m.ctrl.T.Helper()
@@ -50,6 +65,21 @@ func (mr *MockGCSMockRecorder) Download(arg0, arg1 interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Download", reflect.TypeOf((*MockGCS)(nil).Download), arg0, arg1)
 }
 
+// DownloadRange mocks base method
+func (m *MockGCS) DownloadRange(arg0 string, arg1, arg2 int64, arg3 io.Writer) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DownloadRange", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DownloadRange indicates an expected call of DownloadRange
+func (mr *MockGCSMockRecorder) DownloadRange(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DownloadRange", reflect.TypeOf((*MockGCS)(nil).DownloadRange), arg0, arg1, arg2, arg3)
+}
+
 // GetObjectIterator mocks base method
 func (m *MockGCS) GetObjectIterator(arg0 string) iterator.Pageable {
 	m.ctrl.T.Helper()
@@ -109,3 +139,18 @@ func (mr *MockGCSMockRecorder) Upload(arg0, arg1 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Upload", reflect.TypeOf((*MockGCS)(nil).Upload), arg0, arg1)
 }
+
+// UploadIfAbsent mocks base method
+func (m *MockGCS) UploadIfAbsent(arg0 string, arg1 io.Reader) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UploadIfAbsent", arg0, arg1)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UploadIfAbsent indicates an expected call of UploadIfAbsent
+func (mr *MockGCSMockRecorder) UploadIfAbsent(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UploadIfAbsent", reflect.TypeOf((*MockGCS)(nil).UploadIfAbsent), arg0, arg1)
+}
@@ -0,0 +1,129 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: github.com/uber/kraken/lib/backend (interfaces: SignedURLClient)
+
+// Package mockbackend is a generated GoMock package.
+package mockbackend
+
+import (
+	gomock "github.com/golang/mock/gomock"
+	core "github.com/uber/kraken/core"
+	backend "github.com/uber/kraken/lib/backend"
+	io "io"
+	reflect "reflect"
+	time "time"
+)
+
+// MockSignedURLClient is a mock of SignedURLClient interface
+type MockSignedURLClient struct {
+	ctrl     *gomock.Controller
+	recorder *MockSignedURLClientMockRecorder
+}
+
+// MockSignedURLClientMockRecorder is the mock recorder for MockSignedURLClient
+type MockSignedURLClientMockRecorder struct {
+	mock *MockSignedURLClient
+}
+
+// NewMockSignedURLClient creates a new mock instance
+func NewMockSignedURLClient(ctrl *gomock.Controller) *MockSignedURLClient {
+	mock := &MockSignedURLClient{ctrl: ctrl}
+	mock.recorder = &MockSignedURLClientMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockSignedURLClient) EXPECT() *MockSignedURLClientMockRecorder {
+	return m.recorder
+}
+
+// Capabilities mocks base method
+func (m *MockSignedURLClient) Capabilities() backend.BackendCapabilities {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Capabilities")
+	ret0, _ := ret[0].(backend.BackendCapabilities)
+	return ret0
+}
+
+// Capabilities indicates an expected call of Capabilities
+func (mr *MockSignedURLClientMockRecorder) Capabilities() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Capabilities", reflect.TypeOf((*MockSignedURLClient)(nil).Capabilities))
+}
+
+// Download mocks base method
+func (m *MockSignedURLClient) Download(arg0, arg1 string, arg2 io.Writer) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Download", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Download indicates an expected call of Download
+func (mr *MockSignedURLClientMockRecorder) Download(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Download", reflect.TypeOf((*MockSignedURLClient)(nil).Download), arg0, arg1, arg2)
+}
+
+// List mocks base method
+func (m *MockSignedURLClient) List(arg0 string, arg1 ...backend.ListOption) (*backend.ListResult, error) {
+	m.ctrl.T.Helper()
+	varargs := []interface{}{arg0}
+	for _, a := range arg1 {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "List", varargs...)
+	ret0, _ := ret[0].(*backend.ListResult)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// List indicates an expected call of List
+func (mr *MockSignedURLClientMockRecorder) List(arg0 interface{}, arg1 ...interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]interface{}{arg0}, arg1...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "List", reflect.TypeOf((*MockSignedURLClient)(nil).List), varargs...)
+}
+
+// SignedURL mocks base method
+func (m *MockSignedURLClient) SignedURL(arg0, arg1 string, arg2 time.Duration) (string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SignedURL", arg0, arg1, arg2)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SignedURL indicates an expected call of SignedURL
+func (mr *MockSignedURLClientMockRecorder) SignedURL(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SignedURL", reflect.TypeOf((*MockSignedURLClient)(nil).SignedURL), arg0, arg1, arg2)
+}
+
+// Stat mocks base method
+func (m *MockSignedURLClient) Stat(arg0, arg1 string) (*core.BlobInfo, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Stat", arg0, arg1)
+	ret0, _ := ret[0].(*core.BlobInfo)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Stat indicates an expected call of Stat
+func (mr *MockSignedURLClientMockRecorder) Stat(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Stat", reflect.TypeOf((*MockSignedURLClient)(nil).Stat), arg0, arg1)
+}
+
+// Upload mocks base method
+func (m *MockSignedURLClient) Upload(arg0, arg1 string, arg2 io.Reader) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Upload", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Upload indicates an expected call of Upload
+func (mr *MockSignedURLClientMockRecorder) Upload(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Upload", reflect.TypeOf((*MockSignedURLClient)(nil).Upload), arg0, arg1, arg2)
+}
@@ -120,6 +120,20 @@ func (mr *MockStoreMockRecorder) MarkFailed(arg0 interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MarkFailed", reflect.TypeOf((*MockStore)(nil).MarkFailed), arg0)
 }
 
+// MarkPaused mocks base method
+func (m *MockStore) MarkPaused(arg0 persistedretry.Task) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "MarkPaused", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// MarkPaused indicates an expected call of MarkPaused
+func (mr *MockStoreMockRecorder) MarkPaused(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MarkPaused", reflect.TypeOf((*MockStore)(nil).MarkPaused), arg0)
+}
+
 // MarkPending mocks base method
 func (m *MockStore) MarkPending(arg0 persistedretry.Task) error {
 	m.ctrl.T.Helper()
@@ -64,6 +64,35 @@ func (mr *MockReloadableSchedulerMockRecorder) Download(arg0, arg1 interface{})
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Download", reflect.TypeOf((*MockReloadableScheduler)(nil).Download), arg0, arg1)
 }
 
+// Drain mocks base method
+func (m *MockReloadableScheduler) Drain() (scheduler.DrainStatus, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Drain")
+	ret0, _ := ret[0].(scheduler.DrainStatus)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Drain indicates an expected call of Drain
+func (mr *MockReloadableSchedulerMockRecorder) Drain() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Drain", reflect.TypeOf((*MockReloadableScheduler)(nil).Drain))
+}
+
+// PrioritizeRange mocks base method
+func (m *MockReloadableScheduler) PrioritizeRange(arg0 core.Digest, arg1, arg2 int64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PrioritizeRange", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// PrioritizeRange indicates an expected call of PrioritizeRange
+func (mr *MockReloadableSchedulerMockRecorder) PrioritizeRange(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PrioritizeRange", reflect.TypeOf((*MockReloadableScheduler)(nil).PrioritizeRange), arg0, arg1, arg2)
+}
+
 // Probe mocks base method
 func (m *MockReloadableScheduler) Probe() error {
 	m.ctrl.T.Helper()
@@ -7,6 +7,7 @@ package mockscheduler
 import (
 	gomock "github.com/golang/mock/gomock"
 	core "github.com/uber/kraken/core"
+	scheduler "github.com/uber/kraken/lib/torrent/scheduler"
 	connstate "github.com/uber/kraken/lib/torrent/scheduler/connstate"
 	reflect "reflect"
 )
@@ -63,6 +64,35 @@ func (mr *MockSchedulerMockRecorder) Download(arg0, arg1 interface{}) *gomock.Ca
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Download", reflect.TypeOf((*MockScheduler)(nil).Download), arg0, arg1)
 }
 
+// Drain mocks base method
+func (m *MockScheduler) Drain() (scheduler.DrainStatus, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Drain")
+	ret0, _ := ret[0].(scheduler.DrainStatus)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Drain indicates an expected call of Drain
+func (mr *MockSchedulerMockRecorder) Drain() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Drain", reflect.TypeOf((*MockScheduler)(nil).Drain))
+}
+
+// PrioritizeRange mocks base method
+func (m *MockScheduler) PrioritizeRange(arg0 core.Digest, arg1, arg2 int64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PrioritizeRange", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// PrioritizeRange indicates an expected call of PrioritizeRange
+func (mr *MockSchedulerMockRecorder) PrioritizeRange(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PrioritizeRange", reflect.TypeOf((*MockScheduler)(nil).PrioritizeRange), arg0, arg1, arg2)
+}
+
 // Probe mocks base method
 func (m *MockScheduler) Probe() error {
 	m.ctrl.T.Helper()
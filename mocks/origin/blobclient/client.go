@@ -7,6 +7,7 @@ package mockblobclient
 import (
 	gomock "github.com/golang/mock/gomock"
 	core "github.com/uber/kraken/core"
+	blobclient "github.com/uber/kraken/origin/blobclient"
 	io "io"
 	reflect "reflect"
 	time "time"
@@ -49,6 +50,21 @@ func (mr *MockClientMockRecorder) Addr() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Addr", reflect.TypeOf((*MockClient)(nil).Addr))
 }
 
+// CheckAvailability mocks base method
+func (m *MockClient) CheckAvailability(arg0 string, arg1 core.Digest) (blobclient.BlobAvailability, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CheckAvailability", arg0, arg1)
+	ret0, _ := ret[0].(blobclient.BlobAvailability)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CheckAvailability indicates an expected call of CheckAvailability
+func (mr *MockClientMockRecorder) CheckAvailability(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CheckAvailability", reflect.TypeOf((*MockClient)(nil).CheckAvailability), arg0, arg1)
+}
+
 // DeleteBlob mocks base method
 func (m *MockClient) DeleteBlob(arg0 core.Digest) error {
 	m.ctrl.T.Helper()
@@ -150,6 +166,20 @@ func (mr *MockClientMockRecorder) Locations(arg0 interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Locations", reflect.TypeOf((*MockClient)(nil).Locations), arg0)
 }
 
+// MarkEvictionCandidate mocks base method
+func (m *MockClient) MarkEvictionCandidate(arg0 core.Digest) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "MarkEvictionCandidate", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// MarkEvictionCandidate indicates an expected call of MarkEvictionCandidate
+func (mr *MockClientMockRecorder) MarkEvictionCandidate(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MarkEvictionCandidate", reflect.TypeOf((*MockClient)(nil).MarkEvictionCandidate), arg0)
+}
+
 // OverwriteMetaInfo mocks base method
 func (m *MockClient) OverwriteMetaInfo(arg0 core.Digest, arg1 int64) error {
 	m.ctrl.T.Helper()
@@ -164,14 +194,29 @@ func (mr *MockClientMockRecorder) OverwriteMetaInfo(arg0, arg1 interface{}) *gom
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "OverwriteMetaInfo", reflect.TypeOf((*MockClient)(nil).OverwriteMetaInfo), arg0, arg1)
 }
 
-// ReplicateToRemote mocks base method
-func (m *MockClient) ReplicateToRemote(arg0 string, arg1 core.Digest, arg2 string) error {
+// PullBlob mocks base method
+func (m *MockClient) PullBlob(arg0 string, arg1 core.Digest, arg2 string) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "ReplicateToRemote", arg0, arg1, arg2)
+	ret := m.ctrl.Call(m, "PullBlob", arg0, arg1, arg2)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
+// PullBlob indicates an expected call of PullBlob
+func (mr *MockClientMockRecorder) PullBlob(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PullBlob", reflect.TypeOf((*MockClient)(nil).PullBlob), arg0, arg1, arg2)
+}
+
+// ReplicateToRemote mocks base method
+func (m *MockClient) ReplicateToRemote(arg0 string, arg1 core.Digest, arg2 string) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReplicateToRemote", arg0, arg1, arg2)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
 // ReplicateToRemote indicates an expected call of ReplicateToRemote
 func (mr *MockClientMockRecorder) ReplicateToRemote(arg0, arg1, arg2 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
@@ -208,6 +253,21 @@ func (mr *MockClientMockRecorder) StatLocal(arg0, arg1 interface{}) *gomock.Call
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "StatLocal", reflect.TypeOf((*MockClient)(nil).StatLocal), arg0, arg1)
 }
 
+// StreamUploadBlob mocks base method
+func (m *MockClient) StreamUploadBlob(arg0 string, arg1 io.Reader) (core.Digest, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "StreamUploadBlob", arg0, arg1)
+	ret0, _ := ret[0].(core.Digest)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// StreamUploadBlob indicates an expected call of StreamUploadBlob
+func (mr *MockClientMockRecorder) StreamUploadBlob(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "StreamUploadBlob", reflect.TypeOf((*MockClient)(nil).StreamUploadBlob), arg0, arg1)
+}
+
 // TransferBlob mocks base method
 func (m *MockClient) TransferBlob(arg0 core.Digest, arg1 io.Reader) error {
 	m.ctrl.T.Helper()
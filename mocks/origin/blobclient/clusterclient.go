@@ -63,6 +63,20 @@ func (mr *MockClusterClientMockRecorder) GetMetaInfo(arg0, arg1 interface{}) *go
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetMetaInfo", reflect.TypeOf((*MockClusterClient)(nil).GetMetaInfo), arg0, arg1)
 }
 
+// MarkEvictionCandidate mocks base method
+func (m *MockClusterClient) MarkEvictionCandidate(arg0 core.Digest) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "MarkEvictionCandidate", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// MarkEvictionCandidate indicates an expected call of MarkEvictionCandidate
+func (mr *MockClusterClientMockRecorder) MarkEvictionCandidate(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MarkEvictionCandidate", reflect.TypeOf((*MockClusterClient)(nil).MarkEvictionCandidate), arg0)
+}
+
 // OverwriteMetaInfo mocks base method
 func (m *MockClusterClient) OverwriteMetaInfo(arg0 core.Digest, arg1 int64) error {
 	m.ctrl.T.Helper()
@@ -92,12 +106,29 @@ func (mr *MockClusterClientMockRecorder) Owners(arg0 interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Owners", reflect.TypeOf((*MockClusterClient)(nil).Owners), arg0)
 }
 
+// PullableOrigins mocks base method
+func (m *MockClusterClient) PullableOrigins(arg0 string, arg1 core.Digest) ([]string, bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PullableOrigins", arg0, arg1)
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(bool)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// PullableOrigins indicates an expected call of PullableOrigins
+func (mr *MockClusterClientMockRecorder) PullableOrigins(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PullableOrigins", reflect.TypeOf((*MockClusterClient)(nil).PullableOrigins), arg0, arg1)
+}
+
 // ReplicateToRemote mocks base method
-func (m *MockClusterClient) ReplicateToRemote(arg0 string, arg1 core.Digest, arg2 string) error {
+func (m *MockClusterClient) ReplicateToRemote(arg0 string, arg1 core.Digest, arg2 string) (bool, error) {
 	m.ctrl.T.Helper()
 	ret := m.ctrl.Call(m, "ReplicateToRemote", arg0, arg1, arg2)
-	ret0, _ := ret[0].(error)
-	return ret0
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
 }
 
 // ReplicateToRemote indicates an expected call of ReplicateToRemote
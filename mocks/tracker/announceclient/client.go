@@ -7,8 +7,8 @@ package mockannounceclient
 import (
 	gomock "github.com/golang/mock/gomock"
 	core "github.com/uber/kraken/core"
+	announceclient "github.com/uber/kraken/tracker/announceclient"
 	reflect "reflect"
-	time "time"
 )
 
 // MockClient is a mock of Client interface
@@ -35,13 +35,12 @@ func (m *MockClient) EXPECT() *MockClientMockRecorder {
 }
 
 // Announce mocks base method
-func (m *MockClient) Announce(arg0 core.Digest, arg1 core.InfoHash, arg2 bool, arg3 int) ([]*core.PeerInfo, time.Duration, error) {
+func (m *MockClient) Announce(arg0 core.Digest, arg1 core.InfoHash, arg2 bool, arg3 int) (*announceclient.Response, error) {
 	m.ctrl.T.Helper()
 	ret := m.ctrl.Call(m, "Announce", arg0, arg1, arg2, arg3)
-	ret0, _ := ret[0].([]*core.PeerInfo)
-	ret1, _ := ret[1].(time.Duration)
-	ret2, _ := ret[2].(error)
-	return ret0, ret1, ret2
+	ret0, _ := ret[0].(*announceclient.Response)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
 }
 
 // Announce indicates an expected call of Announce
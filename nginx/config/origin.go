@@ -31,5 +31,14 @@ server {
   location / {
     proxy_pass http://{{.server}};
   }
+
+  # Streamed uploads declare their digest in a trailer, which is only sent once
+  # the whole body was received. The body must be forwarded as it arrives, over
+  # HTTP/1.1 since HTTP/1.0 has no chunked encoding.
+  location ~ ^/namespace/.+/blobs/uploads$ {
+    proxy_pass http://{{.server}};
+    proxy_http_version 1.1;
+    proxy_request_buffering off;
+  }
 }
 `
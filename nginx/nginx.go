@@ -15,6 +15,7 @@ package nginx
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io/ioutil"
@@ -22,6 +23,7 @@ import (
 	"os/exec"
 	"path"
 	"path/filepath"
+	"syscall"
 	"text/template"
 
 	"github.com/uber/kraken/nginx/config"
@@ -57,6 +59,7 @@ type Config struct {
 	ErrorLogPath  string `yaml:"error_log_path"`
 
 	tls httputil.TLSConfig
+	ctx context.Context
 }
 
 func (c *Config) applyDefaults() error {
@@ -153,7 +156,14 @@ func WithTLS(tls httputil.TLSConfig) Option {
 	return func(c *Config) { c.tls = tls }
 }
 
-// Run injects params into an nginx configuration template and runs it.
+// WithContext gracefully stops nginx once ctx is done, such that in-flight
+// requests complete before Run returns.
+func WithContext(ctx context.Context) Option {
+	return func(c *Config) { c.ctx = ctx }
+}
+
+// Run injects params into an nginx configuration template and runs it. Run
+// returns nil if nginx was stopped via WithContext.
 func Run(config Config, params map[string]interface{}, opts ...Option) error {
 	if err := config.applyDefaults(); err != nil {
 		return fmt.Errorf("invalid config: %s", err)
@@ -227,7 +237,26 @@ func Run(config Config, params map[string]interface{}, opts ...Option) error {
 	cmd := exec.Command(args[0], args[1:]...)
 	cmd.Stdout = stdout
 	cmd.Stderr = stdout
-	return cmd.Run()
+	if config.ctx == nil {
+		return cmd.Run()
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	errc := make(chan error, 1)
+	go func() { errc <- cmd.Wait() }()
+	select {
+	case err := <-errc:
+		return err
+	case <-config.ctx.Done():
+	}
+	// SIGQUIT gracefully shuts down nginx. Sudo relays the signal when nginx
+	// runs as root.
+	if err := cmd.Process.Signal(syscall.SIGQUIT); err != nil {
+		return fmt.Errorf("signal nginx: %s", err)
+	}
+	<-errc
+	return nil
 }
 
 func populateTemplate(tmpl string, args map[string]interface{}) ([]byte, error) {
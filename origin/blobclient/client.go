@@ -14,6 +14,8 @@
 package blobclient
 
 import (
+	"compress/gzip"
+	"context"
 	"crypto/tls"
 	"encoding/json"
 	"errors"
@@ -38,31 +40,56 @@ type Client interface {
 
 	Locations(d core.Digest) ([]string, error)
 	DeleteBlob(d core.Digest) error
+	MarkEvictionCandidate(d core.Digest) error
 	TransferBlob(d core.Digest, blob io.Reader) error
 
 	Stat(namespace string, d core.Digest) (*core.BlobInfo, error)
 	StatLocal(namespace string, d core.Digest) (*core.BlobInfo, error)
+	CheckAvailability(namespace string, d core.Digest) (BlobAvailability, error)
 
 	GetMetaInfo(namespace string, d core.Digest) (*core.MetaInfo, error)
 	OverwriteMetaInfo(d core.Digest, pieceLength int64) error
 
 	UploadBlob(namespace string, d core.Digest, blob io.Reader) error
+	StreamUploadBlob(namespace string, blob io.Reader) (core.Digest, error)
 	DuplicateUploadBlob(namespace string, d core.Digest, blob io.Reader, delay time.Duration) error
 
 	DownloadBlob(namespace string, d core.Digest, dst io.Writer) error
 
-	ReplicateToRemote(namespace string, d core.Digest, remoteDNS string) error
+	ReplicateToRemote(namespace string, d core.Digest, remoteDNS string) (transferred bool, err error)
+	PullBlob(namespace string, d core.Digest, source string) error
 
 	GetPeerContext() (core.PeerContext, error)
 
 	ForceCleanup(ttl time.Duration) error
 }
 
+// BlobAvailability describes whether an origin can serve a blob without first
+// fetching it from the backend.
+type BlobAvailability int
+
+const (
+	// BlobCold indicates the origin neither has the blob nor is fetching it.
+	BlobCold BlobAvailability = iota
+
+	// BlobWarming indicates the origin is fetching the blob from the backend.
+	BlobWarming
+
+	// BlobAvailable indicates the origin has the blob on disk.
+	BlobAvailable
+)
+
 // HTTPClient defines the Client implementation.
 type HTTPClient struct {
-	addr      string
-	chunkSize uint64
-	tls       *tls.Config
+	addr        string
+	chunkSize   uint64
+	tls         *tls.Config
+	compression bool
+	cache       *httputil.ResponseCache
+
+	// Cancels lookups and downloads, such that hedged or abandoned requests can
+	// be cancelled.
+	ctx context.Context
 }
 
 // Option allows setting optional HTTPClient parameters.
@@ -78,11 +105,25 @@ func WithTLS(tls *tls.Config) Option {
 	return func(c *HTTPClient) { c.tls = tls }
 }
 
+// WithCompression configures an HTTPClient to request gzip transfer compression
+// of blob downloads. Blobs are decompressed before being written to dst.
+func WithCompression() Option {
+	return func(c *HTTPClient) { c.compression = true }
+}
+
+// WithResponseCache configures an HTTPClient to cache metainfo responses in
+// cache, revalidating them with their ETags. Since Providers create a new
+// HTTPClient per address, cache should be shared by all HTTPClients.
+func WithResponseCache(cache *httputil.ResponseCache) Option {
+	return func(c *HTTPClient) { c.cache = cache }
+}
+
 // New returns a new HTTPClient scoped to addr.
 func New(addr string, opts ...Option) *HTTPClient {
 	c := &HTTPClient{
 		addr:      addr,
 		chunkSize: 32 * memsize.MB,
+		ctx:       context.Background(),
 	}
 	for _, opt := range opts {
 		opt(c)
@@ -90,6 +131,13 @@ func New(addr string, opts ...Option) *HTTPClient {
 	return c
 }
 
+// withContext returns a copy of c whose lookups and downloads are cancelled with ctx.
+func (c *HTTPClient) withContext(ctx context.Context) Client {
+	cc := *c
+	cc.ctx = ctx
+	return &cc
+}
+
 // Addr returns the address of the server the client is provisioned for.
 func (c *HTTPClient) Addr() string {
 	return c.addr
@@ -123,6 +171,30 @@ func (c *HTTPClient) StatLocal(namespace string, d core.Digest) (*core.BlobInfo,
 	return c.stat(namespace, d, true)
 }
 
+// CheckAvailability returns whether the origin has a blob for d locally, is
+// currently fetching it from the backend, or neither.
+func (c *HTTPClient) CheckAvailability(namespace string, d core.Digest) (BlobAvailability, error) {
+	r, err := httputil.Head(
+		fmt.Sprintf(
+			"http://%s/internal/namespace/%s/blobs/%s?local=true&warming=true",
+			c.addr,
+			url.PathEscape(namespace),
+			d),
+		httputil.SendTimeout(15*time.Second),
+		httputil.SendAcceptedCodes(http.StatusOK, http.StatusAccepted),
+		httputil.SendTLS(c.tls))
+	if err != nil {
+		if httputil.IsNotFound(err) {
+			return BlobCold, nil
+		}
+		return BlobCold, err
+	}
+	if r.StatusCode == http.StatusAccepted {
+		return BlobWarming, nil
+	}
+	return BlobAvailable, nil
+}
+
 func (c *HTTPClient) stat(namespace string, d core.Digest, local bool) (*core.BlobInfo, error) {
 	u := fmt.Sprintf(
 		"http://%s/internal/namespace/%s/blobs/%s",
@@ -136,7 +208,8 @@ func (c *HTTPClient) stat(namespace string, d core.Digest, local bool) (*core.Bl
 	r, err := httputil.Head(
 		u,
 		httputil.SendTimeout(15*time.Second),
-		httputil.SendTLS(c.tls))
+		httputil.SendTLS(c.tls),
+		httputil.SendContext(c.ctx))
 	if err != nil {
 		if httputil.IsNotFound(err) {
 			return nil, ErrBlobNotFound
@@ -163,6 +236,16 @@ func (c *HTTPClient) DeleteBlob(d core.Digest) error {
 	return err
 }
 
+// MarkEvictionCandidate schedules the blob corresponding to d for eviction,
+// once it is no longer referenced by any tag.
+func (c *HTTPClient) MarkEvictionCandidate(d core.Digest) error {
+	_, err := httputil.Post(
+		fmt.Sprintf("http://%s/internal/blobs/%s/evict", c.addr, d),
+		httputil.SendAcceptedCodes(http.StatusAccepted),
+		httputil.SendTLS(c.tls))
+	return err
+}
+
 // TransferBlob uploads a blob to a single origin server. Unlike its cousin UploadBlob,
 // TransferBlob is an internal API which does not replicate the blob.
 func (c *HTTPClient) TransferBlob(d core.Digest, blob io.Reader) error {
@@ -177,6 +260,48 @@ func (c *HTTPClient) UploadBlob(namespace string, d core.Digest, blob io.Reader)
 	return runChunkedUpload(uc, d, blob, int64(c.chunkSize))
 }
 
+// StreamUploadBlob uploads blob in a single streamed request, computing its
+// digest while sending it, and declaring it as a trailer once blob is sent.
+// Returns the digest of blob. Blobs are forwarded to the origins owning them,
+// and backed up to the remote storage configured for namespace.
+func (c *HTTPClient) StreamUploadBlob(namespace string, blob io.Reader) (core.Digest, error) {
+	digester := core.NewDigester()
+	trailer := http.Header{BlobDigestTrailer: nil}
+	body := &eofHookReader{r: digester.Tee(blob), onEOF: func() {
+		trailer.Set(BlobDigestTrailer, digester.Digest().String())
+	}}
+	_, err := httputil.Put(
+		fmt.Sprintf("http://%s/namespace/%s/blobs/uploads", c.addr, url.PathEscape(namespace)),
+		httputil.SendBody(body),
+		httputil.SendRequestHooks(func(req *http.Request) error {
+			// Trailers require a chunked body of unknown length.
+			req.ContentLength = -1
+			req.Trailer = trailer
+			return nil
+		}),
+		httputil.SendTLS(c.tls))
+	if err != nil {
+		return core.Digest{}, err
+	}
+	return digester.Digest(), nil
+}
+
+// eofHookReader calls onEOF once r is read to EOF, and before EOF is returned.
+type eofHookReader struct {
+	r     io.Reader
+	onEOF func()
+	done  bool
+}
+
+func (r *eofHookReader) Read(b []byte) (int, error) {
+	n, err := r.r.Read(b)
+	if err == io.EOF && !r.done {
+		r.done = true
+		r.onEOF()
+	}
+	return n, err
+}
+
 // DuplicateUploadBlob duplicates an blob upload request, which will attempt to
 // write-back at the given delay.
 func (c *HTTPClient) DuplicateUploadBlob(
@@ -189,29 +314,108 @@ func (c *HTTPClient) DuplicateUploadBlob(
 // DownloadBlob downloads blob for d. If the blob of d is not available yet
 // (i.e. still downloading), returns 202 httputil.StatusError, indicating that
 // the request shoudl be retried later. If not blob exists for d, returns a 404
-// httputil.StatusError.
+// httputil.StatusError. If the origin redirects to a signed backend URL, the
+// blob is downloaded from the backend and verified against d.
 func (c *HTTPClient) DownloadBlob(namespace string, d core.Digest, dst io.Writer) error {
+	options := []httputil.SendOption{
+		httputil.SendTLS(c.tls),
+		httputil.SendRedirect(func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		}),
+		httputil.SendAcceptedCodes(http.StatusOK, http.StatusTemporaryRedirect),
+		httputil.SendContext(c.ctx),
+	}
+	if c.compression {
+		// Setting Accept-Encoding explicitly disables transparent
+		// decompression by the transport.
+		options = append(options, httputil.SendHeaders(map[string]string{
+			"Accept-Encoding": "gzip",
+		}))
+	}
 	r, err := httputil.Get(
 		fmt.Sprintf("http://%s/namespace/%s/blobs/%s", c.addr, url.PathEscape(namespace), d),
-		httputil.SendTLS(c.tls))
+		options...)
 	if err != nil {
 		return err
 	}
 	defer r.Body.Close()
-	if _, err := io.Copy(dst, r.Body); err != nil {
+	if r.StatusCode == http.StatusTemporaryRedirect {
+		return downloadRedirectedBlob(c.ctx, r.Header.Get("Location"), d, dst)
+	}
+	var body io.Reader = r.Body
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		gr, err := gzip.NewReader(r.Body)
+		if err != nil {
+			return fmt.Errorf("gzip reader: %s", err)
+		}
+		defer gr.Close()
+		body = gr
+	}
+	if _, err := io.Copy(dst, body); err != nil {
 		return fmt.Errorf("copy body: %s", err)
 	}
 	return nil
 }
 
-// ReplicateToRemote replicates the blob of d to a remote origin cluster. If the
-// blob of d is not available yet, returns 202 httputil.StatusError, indicating
-// that the request should be retried later.
-func (c *HTTPClient) ReplicateToRemote(namespace string, d core.Digest, remoteDNS string) error {
-	_, err := httputil.Post(
+// downloadRedirectedBlob downloads the blob of d from the signed backend URL u.
+// Since the backend is not trusted to serve the blob of d, the digest of the
+// downloaded content is verified.
+func downloadRedirectedBlob(ctx context.Context, u string, d core.Digest, dst io.Writer) error {
+	if u == "" {
+		return errors.New("redirect without location")
+	}
+	// The signed URL carries its own credentials, so no TLS config is sent.
+	r, err := httputil.Get(u, httputil.SendContext(ctx))
+	if err != nil {
+		return fmt.Errorf("get redirected blob: %s", err)
+	}
+	defer r.Body.Close()
+	digester, err := core.NewDigesterWithAlgo(d.Algo())
+	if err != nil {
+		return fmt.Errorf("new digester: %s", err)
+	}
+	if _, err := io.Copy(dst, digester.Tee(r.Body)); err != nil {
+		return fmt.Errorf("copy redirected body: %s", err)
+	}
+	if actual := digester.Digest(); actual != d {
+		return fmt.Errorf("redirected blob digest mismatch: expected %s, got %s", d, actual)
+	}
+	return nil
+}
+
+// ReplicatedHeader is the response header of replications to remotes, which
+// is "false" if the remote already had the blob.
+const ReplicatedHeader = "X-Blob-Transferred"
+
+// ReplicateToRemote replicates the blob of d to a remote origin cluster, and
+// returns false if the remote already had the blob, such that nothing was
+// transferred. If the blob of d is not available yet, returns 202
+// httputil.StatusError, indicating that the request should be retried later.
+func (c *HTTPClient) ReplicateToRemote(
+	namespace string, d core.Digest, remoteDNS string) (transferred bool, err error) {
+
+	r, err := httputil.Post(
 		fmt.Sprintf("http://%s/namespace/%s/blobs/%s/remote/%s",
 			c.addr, url.PathEscape(namespace), d, remoteDNS),
 		httputil.SendTLS(c.tls))
+	if err != nil {
+		return false, err
+	}
+	defer r.Body.Close()
+	// Origins which predate the header always transfer the blob.
+	return r.Header.Get(ReplicatedHeader) != "false", nil
+}
+
+// PullBlob asks the origin to asynchronously pull the blob of d from the source
+// origin, if it does not already have it.
+func (c *HTTPClient) PullBlob(namespace string, d core.Digest, source string) error {
+	v := url.Values{}
+	v.Add("source", source)
+	_, err := httputil.Post(
+		fmt.Sprintf("http://%s/internal/namespace/%s/blobs/%s/pull?%s",
+			c.addr, url.PathEscape(namespace), d, v.Encode()),
+		httputil.SendAcceptedCodes(http.StatusOK, http.StatusAccepted),
+		httputil.SendTLS(c.tls))
 	return err
 }
 
@@ -220,18 +424,31 @@ func (c *HTTPClient) ReplicateToRemote(namespace string, d core.Digest, remoteDN
 // the request should be retried later. If no blob exists for d, returns a 404
 // httputil.StatusError.
 func (c *HTTPClient) GetMetaInfo(namespace string, d core.Digest) (*core.MetaInfo, error) {
-	r, err := httputil.Get(
-		fmt.Sprintf("http://%s/internal/namespace/%s/blobs/%s/metainfo",
-			c.addr, url.PathEscape(namespace), d),
-		httputil.SendTimeout(15*time.Second),
-		httputil.SendTLS(c.tls))
-	if err != nil {
-		return nil, err
+	rawurl := fmt.Sprintf("http://%s/internal/namespace/%s/blobs/%s/metainfo",
+		c.addr, url.PathEscape(namespace), d)
+	get := func(options ...httputil.SendOption) (*http.Response, error) {
+		return httputil.Get(rawurl, append(options,
+			httputil.SendTimeout(15*time.Second),
+			httputil.SendTLS(c.tls),
+			httputil.SendContext(c.ctx))...)
 	}
-	defer r.Body.Close()
-	raw, err := ioutil.ReadAll(r.Body)
-	if err != nil {
-		return nil, fmt.Errorf("read body: %s", err)
+	var raw []byte
+	if c.cache != nil {
+		b, err := c.cache.Get(rawurl, get)
+		if err != nil {
+			return nil, err
+		}
+		raw = b
+	} else {
+		r, err := get()
+		if err != nil {
+			return nil, err
+		}
+		defer r.Body.Close()
+		raw, err = ioutil.ReadAll(r.Body)
+		if err != nil {
+			return nil, fmt.Errorf("read body: %s", err)
+		}
 	}
 	mi, err := core.DeserializeMetaInfo(raw)
 	if err != nil {
@@ -29,6 +29,7 @@ import (
 	"github.com/uber/kraken/utils/errutil"
 	"github.com/uber/kraken/utils/httputil"
 	"github.com/uber/kraken/utils/log"
+	"github.com/uber/kraken/utils/syncutil"
 )
 
 // Locations queries cluster for the locations of d.
@@ -83,17 +84,40 @@ type ClusterClient interface {
 	GetMetaInfo(namespace string, d core.Digest) (*core.MetaInfo, error)
 	Stat(namespace string, d core.Digest) (*core.BlobInfo, error)
 	OverwriteMetaInfo(d core.Digest, pieceLength int64) error
+	MarkEvictionCandidate(d core.Digest) error
 	Owners(d core.Digest) ([]core.PeerContext, error)
-	ReplicateToRemote(namespace string, d core.Digest, remoteDNS string) error
+	PullableOrigins(namespace string, d core.Digest) (addrs []string, backendFetch bool, err error)
+	ReplicateToRemote(namespace string, d core.Digest, remoteDNS string) (transferred bool, err error)
 }
 
 type clusterClient struct {
-	resolver ClientResolver
+	resolver   ClientResolver
+	hedger     *hedger
+	health     *healthTracker
+	fanout     *syncutil.FanoutPool
+	readPolicy *ReadPolicy
+	weights    originWeights
+}
+
+// WithFanoutPool configures a ClusterClient to query origins on the workers of
+// p, such that concurrent lookups share a bounded number of goroutines.
+func WithFanoutPool(p *syncutil.FanoutPool) ClusterClientOption {
+	return func(c *clusterClient) { c.fanout = p }
 }
 
 // NewClusterClient returns a new ClusterClient.
-func NewClusterClient(r ClientResolver) ClusterClient {
-	return &clusterClient{r}
+func NewClusterClient(r ClientResolver, opts ...ClusterClientOption) ClusterClient {
+	c := &clusterClient{resolver: r}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.weights != nil {
+		c.resolver = &weightResolver{c.resolver, c.weights}
+	}
+	if c.health != nil {
+		c.resolver = &healthResolver{c.resolver, c.health}
+	}
+	return c
 }
 
 // defaultPollBackOff returns the default backoff used on Poll operations.
@@ -136,14 +160,13 @@ func (c *clusterClient) GetMetaInfo(namespace string, d core.Digest) (mi *core.M
 	if err != nil {
 		return nil, fmt.Errorf("resolve clients: %s", err)
 	}
-	for _, client := range clients {
-		mi, err = client.GetMetaInfo(namespace, d)
+	v, err := c.hedger.try(clients, func(client Client) (interface{}, error) {
+		return client.GetMetaInfo(namespace, d)
+	}, func(err error) bool {
 		// Do not try the next replica on 202 errors.
-		if err != nil && !httputil.IsAccepted(err) {
-			continue
-		}
-		break
-	}
+		return err != nil && !httputil.IsAccepted(err)
+	})
+	mi, _ = v.(*core.MetaInfo)
 	return mi, err
 }
 
@@ -154,15 +177,20 @@ func (c *clusterClient) Stat(namespace string, d core.Digest) (bi *core.BlobInfo
 		return nil, fmt.Errorf("resolve clients: %s", err)
 	}
 
-	shuffle(clients)
-	for _, client := range clients {
-		bi, err = client.Stat(namespace, d)
-		if err != nil {
-			continue
-		}
-		break
+	if c.weights != nil {
+		c.weights.shuffle(clients)
+	} else {
+		shuffle(clients)
 	}
-
+	if c.health != nil {
+		c.health.order(clients)
+	}
+	v, err := c.hedger.try(clients, func(client Client) (interface{}, error) {
+		return client.Stat(namespace, d)
+	}, func(err error) bool {
+		return err != nil
+	})
+	bi, _ = v.(*core.BlobInfo)
 	return bi, err
 }
 
@@ -183,8 +211,29 @@ func (c *clusterClient) OverwriteMetaInfo(d core.Digest, pieceLength int64) erro
 	return errutil.Join(errs)
 }
 
-// DownloadBlob pulls a blob from the origin cluster.
+// MarkEvictionCandidate schedules d for eviction on all origins which own it.
+// Origins which do not hold d are skipped.
+func (c *clusterClient) MarkEvictionCandidate(d core.Digest) error {
+	clients, err := c.resolver.Resolve(d)
+	if err != nil {
+		return fmt.Errorf("resolve clients: %s", err)
+	}
+	var errs []error
+	for _, client := range clients {
+		err := client.MarkEvictionCandidate(d)
+		if err != nil && !httputil.IsNotFound(err) {
+			errs = append(errs, fmt.Errorf("origin %s: %s", client.Addr(), err))
+		}
+	}
+	return errutil.Join(errs)
+}
+
+// DownloadBlob pulls a blob from the origin cluster. Downloads of namespaces
+// matched by the read policy are routed by the matching rule.
 func (c *clusterClient) DownloadBlob(namespace string, d core.Digest, dst io.Writer) error {
+	if r := c.readPolicy.match(namespace); r != nil {
+		return c.downloadBlobWithRule(r, namespace, d, dst)
+	}
 	err := Poll(c.resolver, c.defaultPollBackOff(), d, func(client Client) error {
 		return client.DownloadBlob(namespace, d, dst)
 	})
@@ -205,22 +254,16 @@ func (c *clusterClient) Owners(d core.Digest) ([]core.PeerContext, error) {
 	var peers []core.PeerContext
 	var errs []error
 
-	var wg sync.WaitGroup
-	for _, client := range clients {
-		wg.Add(1)
-		go func(client Client) {
-			defer wg.Done()
-			pctx, err := client.GetPeerContext()
-			mu.Lock()
-			if err != nil {
-				errs = append(errs, err)
-			} else {
-				peers = append(peers, pctx)
-			}
-			mu.Unlock()
-		}(client)
-	}
-	wg.Wait()
+	c.fanout.Run(len(clients), func(i int) {
+		pctx, err := clients[i].GetPeerContext()
+		mu.Lock()
+		if err != nil {
+			errs = append(errs, err)
+		} else {
+			peers = append(peers, pctx)
+		}
+		mu.Unlock()
+	})
 
 	err = errutil.Join(errs)
 
@@ -237,12 +280,60 @@ func (c *clusterClient) Owners(d core.Digest) ([]core.PeerContext, error) {
 	return peers, nil
 }
 
+// PullableOrigins returns the addresses of origins owning d which have the blob
+// or are warming it, in order of preference. Origins which fail to respond are
+// excluded. If no origin has the blob, backendFetch is true and every responsive
+// owner is returned, as any of them will fetch the blob from the backend.
+func (c *clusterClient) PullableOrigins(
+	namespace string, d core.Digest) (addrs []string, backendFetch bool, err error) {
+
+	clients, err := c.resolver.Resolve(d)
+	if err != nil {
+		return nil, false, fmt.Errorf("resolve clients: %s", err)
+	}
+
+	availability := make([]BlobAvailability, len(clients))
+	errs := make([]error, len(clients))
+
+	c.fanout.Run(len(clients), func(i int) {
+		availability[i], errs[i] = clients[i].CheckAvailability(namespace, d)
+	})
+
+	var responsive []string
+	var failures []error
+	for i, client := range clients {
+		if errs[i] != nil {
+			failures = append(failures, fmt.Errorf("origin %s: %s", client.Addr(), errs[i]))
+			continue
+		}
+		responsive = append(responsive, client.Addr())
+		if availability[i] != BlobCold {
+			addrs = append(addrs, client.Addr())
+		}
+	}
+	if len(responsive) == 0 {
+		return nil, false, errutil.Join(failures)
+	}
+	if len(failures) > 0 {
+		log.With("blob", d.Hex()).Errorf("Error checking origin availability: %s", errutil.Join(failures))
+	}
+	if len(addrs) == 0 {
+		return responsive, true, nil
+	}
+	return addrs, false, nil
+}
+
 // ReplicateToRemote replicates d to a remote origin cluster.
-func (c *clusterClient) ReplicateToRemote(namespace string, d core.Digest, remoteDNS string) error {
+func (c *clusterClient) ReplicateToRemote(
+	namespace string, d core.Digest, remoteDNS string) (transferred bool, err error) {
+
 	// Re-use download backoff since replicate may download blobs.
-	return Poll(c.resolver, c.defaultPollBackOff(), d, func(client Client) error {
-		return client.ReplicateToRemote(namespace, d, remoteDNS)
+	err = Poll(c.resolver, c.defaultPollBackOff(), d, func(client Client) error {
+		var err error
+		transferred, err = client.ReplicateToRemote(namespace, d, remoteDNS)
+		return err
 	})
+	return transferred, err
 }
 
 func shuffle(cs []Client) {
@@ -0,0 +1,274 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package blobclient
+
+import (
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/andres-erbsen/clock"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/utils/httputil"
+	"github.com/uber/kraken/utils/log"
+)
+
+// HealthConfig defines passive health tracking of origins by ClusterClients.
+// When enabled, the error rate and lookup latency of each origin are tracked
+// over a rolling window, and origins which exceed either threshold are demoted
+// behind healthy origins until Cooldown elapses, after which they are probed
+// again. Demoted origins are still tried once healthy origins are exhausted.
+type HealthConfig struct {
+	Enabled bool `yaml:"enabled"`
+
+	// Window is the duration over which requests to an origin are tracked.
+	Window time.Duration `yaml:"window"`
+
+	// MinRequests is the number of requests within the window required before
+	// an origin may be demoted.
+	MinRequests int `yaml:"min_requests"`
+
+	// MaxErrorRate is the fraction of failed requests within the window above
+	// which an origin is demoted. Only network errors and 5XX responses count
+	// as failures.
+	MaxErrorRate float64 `yaml:"max_error_rate"`
+
+	// MaxLatency is the mean latency of lookups within the window above which
+	// an origin is demoted. Transfers are excluded since their latency depends
+	// on blob size. Disabled if zero.
+	MaxLatency time.Duration `yaml:"max_latency"`
+
+	// Cooldown is the duration for which an origin is demoted.
+	Cooldown time.Duration `yaml:"cooldown"`
+}
+
+func (c HealthConfig) applyDefaults() HealthConfig {
+	if c.Window == 0 {
+		c.Window = 30 * time.Second
+	}
+	if c.MinRequests == 0 {
+		c.MinRequests = 10
+	}
+	if c.MaxErrorRate == 0 {
+		c.MaxErrorRate = 0.5
+	}
+	if c.Cooldown == 0 {
+		c.Cooldown = 30 * time.Second
+	}
+	return c
+}
+
+// WithHealthTracking configures a ClusterClient to demote unhealthy origins.
+func WithHealthTracking(config HealthConfig, clk clock.Clock) ClusterClientOption {
+	return func(c *clusterClient) {
+		if config.Enabled {
+			c.health = newHealthTracker(config, clk)
+		}
+	}
+}
+
+type originHealth struct {
+	windowStart  time.Time
+	requests     int
+	errors       int
+	lookups      int
+	latency      time.Duration
+	demotedUntil time.Time
+}
+
+type healthTracker struct {
+	sync.Mutex
+	config  HealthConfig
+	clk     clock.Clock
+	origins map[string]*originHealth
+}
+
+func newHealthTracker(config HealthConfig, clk clock.Clock) *healthTracker {
+	return &healthTracker{
+		config:  config.applyDefaults(),
+		clk:     clk,
+		origins: make(map[string]*originHealth),
+	}
+}
+
+// healthy returns false if addr is demoted. Origins whose cooldown elapsed
+// are reset, such that they are probed again.
+func (h *healthTracker) healthy(addr string) bool {
+	h.Lock()
+	defer h.Unlock()
+
+	o, ok := h.origins[addr]
+	if !ok || o.demotedUntil.IsZero() {
+		return true
+	}
+	if h.clk.Now().Before(o.demotedUntil) {
+		return false
+	}
+	delete(h.origins, addr)
+	return true
+}
+
+// record tracks the result of a request to addr. If lookup is set, the latency
+// of the request counts towards the mean lookup latency.
+func (h *healthTracker) record(addr string, lookup bool, latency time.Duration, err error) {
+	h.Lock()
+	defer h.Unlock()
+
+	now := h.clk.Now()
+	o, ok := h.origins[addr]
+	if !ok {
+		o = &originHealth{windowStart: now}
+		h.origins[addr] = o
+	}
+	if !o.demotedUntil.IsZero() {
+		return
+	}
+	if now.Sub(o.windowStart) > h.config.Window {
+		*o = originHealth{windowStart: now}
+	}
+	o.requests++
+	if isOriginFailure(err) {
+		o.errors++
+	}
+	if lookup {
+		o.lookups++
+		o.latency += latency
+	}
+	if o.requests < h.config.MinRequests {
+		return
+	}
+	errorRate := float64(o.errors) / float64(o.requests)
+	var meanLatency time.Duration
+	if o.lookups > 0 {
+		meanLatency = o.latency / time.Duration(o.lookups)
+	}
+	if errorRate > h.config.MaxErrorRate ||
+		(h.config.MaxLatency > 0 && meanLatency > h.config.MaxLatency) {
+
+		log.With(
+			"origin", addr,
+			"error_rate", errorRate,
+			"latency", meanLatency).Info("Demoting unhealthy origin")
+		*o = originHealth{demotedUntil: now.Add(h.config.Cooldown)}
+	}
+}
+
+// order stably moves demoted clients behind healthy clients.
+func (h *healthTracker) order(clients []Client) {
+	healthy := make(map[string]bool, len(clients))
+	for _, client := range clients {
+		healthy[client.Addr()] = h.healthy(client.Addr())
+	}
+	sort.SliceStable(clients, func(i, j int) bool {
+		return healthy[clients[i].Addr()] && !healthy[clients[j].Addr()]
+	})
+}
+
+func isOriginFailure(err error) bool {
+	if err == nil {
+		return false
+	}
+	if serr, ok := err.(httputil.StatusError); ok {
+		return serr.Status >= 500
+	}
+	return httputil.IsNetworkError(err)
+}
+
+// healthResolver orders resolved clients by health, and wraps them such that
+// the results of requests are tracked.
+type healthResolver struct {
+	resolver ClientResolver
+	health   *healthTracker
+}
+
+func (r *healthResolver) Resolve(d core.Digest) ([]Client, error) {
+	clients, err := r.resolver.Resolve(d)
+	if err != nil {
+		return nil, err
+	}
+	tracked := make([]Client, len(clients))
+	for i, client := range clients {
+		tracked[i] = &trackedClient{client, r.health}
+	}
+	r.health.order(tracked)
+	return tracked, nil
+}
+
+// trackedClient records the results of the requests issued by ClusterClients.
+type trackedClient struct {
+	Client
+	health *healthTracker
+}
+
+func (c *trackedClient) track(lookup bool, f func() error) error {
+	start := c.health.clk.Now()
+	err := f()
+	c.health.record(c.Addr(), lookup, c.health.clk.Now().Sub(start), err)
+	return err
+}
+
+func (c *trackedClient) Stat(namespace string, d core.Digest) (bi *core.BlobInfo, err error) {
+	err = c.track(true, func() error {
+		bi, err = c.Client.Stat(namespace, d)
+		return err
+	})
+	return bi, err
+}
+
+func (c *trackedClient) CheckAvailability(
+	namespace string, d core.Digest) (a BlobAvailability, err error) {
+
+	err = c.track(true, func() error {
+		a, err = c.Client.CheckAvailability(namespace, d)
+		return err
+	})
+	return a, err
+}
+
+func (c *trackedClient) GetMetaInfo(namespace string, d core.Digest) (mi *core.MetaInfo, err error) {
+	err = c.track(true, func() error {
+		mi, err = c.Client.GetMetaInfo(namespace, d)
+		return err
+	})
+	return mi, err
+}
+
+func (c *trackedClient) GetPeerContext() (pctx core.PeerContext, err error) {
+	err = c.track(true, func() error {
+		pctx, err = c.Client.GetPeerContext()
+		return err
+	})
+	return pctx, err
+}
+
+func (c *trackedClient) UploadBlob(namespace string, d core.Digest, blob io.Reader) error {
+	return c.track(false, func() error { return c.Client.UploadBlob(namespace, d, blob) })
+}
+
+func (c *trackedClient) DownloadBlob(namespace string, d core.Digest, dst io.Writer) error {
+	return c.track(false, func() error { return c.Client.DownloadBlob(namespace, d, dst) })
+}
+
+func (c *trackedClient) ReplicateToRemote(
+	namespace string, d core.Digest, remoteDNS string) (transferred bool, err error) {
+
+	err = c.track(false, func() error {
+		var err error
+		transferred, err = c.Client.ReplicateToRemote(namespace, d, remoteDNS)
+		return err
+	})
+	return transferred, err
+}
@@ -0,0 +1,164 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package blobclient
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/atomic"
+)
+
+// HedgeConfig defines hedging of lookups (i.e. Stat and GetMetaInfo) issued by
+// ClusterClients. When enabled, if the first origin does not respond within
+// Delay, the lookup is duplicated to the next owning origin and the first
+// response is returned. The slower request is cancelled.
+type HedgeConfig struct {
+	Enabled bool `yaml:"enabled"`
+
+	Delay time.Duration `yaml:"delay"`
+
+	// MaxInflight caps the number of hedged requests in flight at any time,
+	// such that hedging cannot amplify load on origins which are slow due to
+	// load. Lookups exceeding the cap are not hedged.
+	MaxInflight int `yaml:"max_inflight"`
+}
+
+func (c HedgeConfig) applyDefaults() HedgeConfig {
+	if c.Delay == 0 {
+		c.Delay = 100 * time.Millisecond
+	}
+	if c.MaxInflight == 0 {
+		c.MaxInflight = 16
+	}
+	return c
+}
+
+// ClusterClientOption allows setting optional ClusterClient parameters.
+type ClusterClientOption func(*clusterClient)
+
+// WithHedging configures a ClusterClient to hedge lookups.
+func WithHedging(config HedgeConfig) ClusterClientOption {
+	return func(c *clusterClient) {
+		if config.Enabled {
+			c.hedger = newHedger(config)
+		}
+	}
+}
+
+type hedger struct {
+	config   HedgeConfig
+	inflight *atomic.Int64
+}
+
+func newHedger(config HedgeConfig) *hedger {
+	return &hedger{config.applyDefaults(), atomic.NewInt64(0)}
+}
+
+// contextClient is implemented by Clients whose lookups can be cancelled.
+type contextClient interface {
+	withContext(ctx context.Context) Client
+}
+
+// acquire reserves one of the slots for hedged requests, and returns false if
+// h is nil or all slots are taken.
+func (h *hedger) acquire() bool {
+	if h == nil {
+		return false
+	}
+	if h.inflight.Inc() > int64(h.config.MaxInflight) {
+		h.inflight.Dec()
+		return false
+	}
+	return true
+}
+
+func (h *hedger) release() {
+	h.inflight.Dec()
+}
+
+type hedgeResult struct {
+	v   interface{}
+	err error
+}
+
+// try runs f against clients until it returns an error which should not be
+// retried. If h is not nil and the running request does not finish within the
+// hedge delay, f is also run against the next client, and the first result
+// which should not be retried is returned, cancelling the other request.
+func (h *hedger) try(
+	clients []Client,
+	f func(Client) (interface{}, error),
+	retry func(error) bool) (interface{}, error) {
+
+	var last hedgeResult
+	if h == nil || len(clients) < 2 {
+		for _, client := range clients {
+			last.v, last.err = f(client)
+			if !retry(last.err) {
+				break
+			}
+		}
+		return last.v, last.err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Buffered such that cancelled requests do not block.
+	results := make(chan hedgeResult, len(clients))
+	run := func(client Client, hedged bool) {
+		if c, ok := client.(contextClient); ok {
+			client = c.withContext(ctx)
+		}
+		go func() {
+			if hedged {
+				defer h.release()
+			}
+			v, err := f(client)
+			results <- hedgeResult{v, err}
+		}()
+	}
+
+	run(clients[0], false)
+	next, pending := 1, 1
+
+	timer := time.NewTimer(h.config.Delay)
+	defer timer.Stop()
+	hedge := timer.C
+
+	for pending > 0 {
+		select {
+		case last = <-results:
+			pending--
+			if !retry(last.err) {
+				return last.v, last.err
+			}
+			if pending == 0 && next < len(clients) {
+				run(clients[next], false)
+				next++
+				pending++
+			}
+		case <-hedge:
+			hedge = nil
+			if next == len(clients) || !h.acquire() {
+				break
+			}
+			run(clients[next], true)
+			next++
+			pending++
+		}
+	}
+	return last.v, last.err
+}
@@ -0,0 +1,405 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package blobclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/utils/errutil"
+	"github.com/uber/kraken/utils/httputil"
+
+	"github.com/cenkalti/backoff"
+)
+
+// Sources which blob downloads may be served from.
+const (
+	// ReadSourceCached are the owning origins which have the blob on disk.
+	ReadSourceCached = "cached"
+
+	// ReadSourcePrimary is the first owning origin, which fetches the blob from
+	// the backend if it does not have it.
+	ReadSourcePrimary = "primary"
+
+	// ReadSourceReplica are the remaining owning origins, in location order.
+	ReadSourceReplica = "replica"
+)
+
+// errBudgetExceeded occurs when a source does not start serving a download
+// within its budget.
+var errBudgetExceeded = errors.New("read budget exceeded")
+
+// errReadSuperseded occurs when another origin started serving a download
+// first.
+var errReadSuperseded = errors.New("read served by another origin")
+
+// ReadSource is a source of a ReadRule.
+type ReadSource struct {
+	Source string `yaml:"source"`
+
+	// Budget bounds the time until an origin of the source starts serving the
+	// download, including polling while it fetches the blob from the backend.
+	// Origins which do not start within budget are abandoned, or raced against
+	// the next origin if hedging is enabled and a slot is free. Zero is
+	// unbounded.
+	Budget time.Duration `yaml:"budget"`
+}
+
+// ReadRule defines the sources, and the order in which they are tried, of
+// downloads from the namespaces it matches. Sources not listed are not tried,
+// and origins already tried by a previous source are not tried again.
+type ReadRule struct {
+	Namespace string       `yaml:"namespace"`
+	Sources   []ReadSource `yaml:"sources"`
+}
+
+// ReadPolicyConfig defines per-namespace routing of blob downloads, such that
+// namespaces with strict read-latency SLOs skip slow origins and fallbacks,
+// while best-effort namespaces tolerate them. The first matching rule applies.
+// Downloads of namespaces no rule matches try every owning origin in order,
+// polling each while it fetches the blob from the backend.
+type ReadPolicyConfig struct {
+	Rules []ReadRule `yaml:"rules"`
+}
+
+type readRule struct {
+	namespace *regexp.Regexp
+	sources   []ReadSource
+}
+
+// ReadPolicy routes blob downloads by namespace.
+type ReadPolicy struct {
+	rules []*readRule
+}
+
+// Build validates c and returns a ReadPolicy.
+func (c ReadPolicyConfig) Build() (*ReadPolicy, error) {
+	p := &ReadPolicy{}
+	for i, r := range c.Rules {
+		re, err := regexp.Compile(r.Namespace)
+		if err != nil {
+			return nil, fmt.Errorf("rule %d: namespace: %s", i, err)
+		}
+		if len(r.Sources) == 0 {
+			return nil, fmt.Errorf("rule %d: sources required", i)
+		}
+		for _, s := range r.Sources {
+			switch s.Source {
+			case ReadSourceCached, ReadSourcePrimary, ReadSourceReplica:
+			default:
+				return nil, fmt.Errorf("rule %d: invalid source %q", i, s.Source)
+			}
+		}
+		p.rules = append(p.rules, &readRule{re, r.Sources})
+	}
+	return p, nil
+}
+
+// WithReadPolicy configures a ClusterClient to route downloads by p.
+func WithReadPolicy(p *ReadPolicy) ClusterClientOption {
+	return func(c *clusterClient) { c.readPolicy = p }
+}
+
+// match returns the first rule matching namespace, or nil.
+func (p *ReadPolicy) match(namespace string) *readRule {
+	if p == nil {
+		return nil
+	}
+	for _, r := range p.rules {
+		if r.namespace.MatchString(namespace) {
+			return r
+		}
+	}
+	return nil
+}
+
+// downloadBlobWithRule downloads the blob of d from the sources of r, in order.
+// When an origin does not start serving within the budget of its source, it
+// keeps racing the next origin if a hedge slot is available, and is otherwise
+// abandoned. Whichever origin writes first owns dst, and all others are
+// cancelled.
+func (c *clusterClient) downloadBlobWithRule(
+	r *readRule, namespace string, d core.Digest, dst io.Writer) error {
+
+	clients, err := c.resolver.Resolve(d)
+	if err != nil {
+		return fmt.Errorf("resolve clients: %s", err)
+	}
+
+	// Clients of a source are resolved only once the previous sources are
+	// exhausted, since resolving cached origins checks every owning origin.
+	sources := r.sources
+	var source ReadSource
+	var pending []Client
+	tried := make(map[string]bool)
+	next := func() (Client, ReadSource, bool) {
+		for {
+			for len(pending) > 0 {
+				client := pending[0]
+				pending = pending[1:]
+				if !tried[client.Addr()] {
+					tried[client.Addr()] = true
+					return client, source, true
+				}
+			}
+			if len(sources) == 0 {
+				return nil, ReadSource{}, false
+			}
+			source, sources = sources[0], sources[1:]
+			pending = c.sourceClients(source.Source, namespace, d, clients)
+		}
+	}
+
+	claim := &readClaim{dst: dst, abandoned: make(map[*readAttempt]bool)}
+	results := make(chan readResult, len(clients))
+	running := make(map[*readAttempt]bool)
+	defer func() {
+		for a := range running {
+			a.cancel()
+		}
+	}()
+
+	// Only the budget of the latest attempt is timed.
+	var latest *readAttempt
+	var timer *time.Timer
+	var budget <-chan time.Time
+	defer func() {
+		if timer != nil {
+			timer.Stop()
+		}
+	}()
+	start := func(hedged bool) bool {
+		client, source, ok := next()
+		if !ok {
+			return false
+		}
+		latest = c.startReadAttempt(client, source, namespace, d, claim, hedged, results)
+		running[latest] = true
+		if timer != nil {
+			timer.Stop()
+		}
+		timer, budget = nil, nil
+		if source.Budget > 0 {
+			timer = time.NewTimer(source.Budget)
+			budget = timer.C
+		}
+		return true
+	}
+
+	var errs []error
+	for {
+		if len(running) == 0 && !start(false) {
+			return fmt.Errorf("all read sources unavailable: %s", errutil.Join(errs))
+		}
+		select {
+		case res := <-results:
+			a := res.attempt
+			if !running[a] {
+				// Already abandoned.
+				continue
+			}
+			delete(running, a)
+			if a == latest {
+				budget = nil
+			}
+			if res.err == nil {
+				return nil
+			}
+			if claim.owns(a) {
+				// dst is partially written, so no other origin may take over.
+				return res.err
+			}
+			if serr, ok := res.err.(httputil.StatusError); ok && serr.Status < 500 {
+				if serr.Status == http.StatusNotFound {
+					return ErrBlobNotFound
+				}
+				return res.err
+			}
+			errs = append(errs, fmt.Errorf("%s origin %s: %s", a.source.Source, a.client.Addr(), res.err))
+		case <-budget:
+			budget = nil
+			if claim.owned() {
+				// The blob is being written, so the download is committed.
+				continue
+			}
+			if c.hedger.acquire() {
+				if start(true) {
+					continue
+				}
+				c.hedger.release()
+			}
+			a := latest
+			if claim.abandon(a) {
+				a.cancel()
+				delete(running, a)
+				errs = append(errs, fmt.Errorf(
+					"%s origin %s: %s", a.source.Source, a.client.Addr(), errBudgetExceeded))
+				start(false)
+			}
+		}
+	}
+}
+
+// sourceClients returns the clients of the owning origins of d which belong to
+// source.
+func (c *clusterClient) sourceClients(
+	source, namespace string, d core.Digest, clients []Client) []Client {
+
+	switch source {
+	case ReadSourcePrimary:
+		if len(clients) > 0 {
+			return clients[:1]
+		}
+	case ReadSourceReplica:
+		if len(clients) > 1 {
+			return clients[1:]
+		}
+	case ReadSourceCached:
+		available := make([]bool, len(clients))
+		c.fanout.Run(len(clients), func(i int) {
+			a, err := clients[i].CheckAvailability(namespace, d)
+			available[i] = err == nil && a == BlobAvailable
+		})
+		var cached []Client
+		for i, client := range clients {
+			if available[i] {
+				cached = append(cached, client)
+			}
+		}
+		return cached
+	}
+	return nil
+}
+
+// readAttempt is a download of a blob from a single origin.
+type readAttempt struct {
+	client Client
+	source ReadSource
+	cancel context.CancelFunc
+}
+
+type readResult struct {
+	attempt *readAttempt
+	err     error
+}
+
+// startReadAttempt downloads the blob of d from client in the background, and
+// sends the result to results. If hedged, the attempt releases its hedge slot
+// once done.
+func (c *clusterClient) startReadAttempt(
+	client Client,
+	source ReadSource,
+	namespace string,
+	d core.Digest,
+	claim *readClaim,
+	hedged bool,
+	results chan<- readResult) *readAttempt {
+
+	ctx, cancel := context.WithCancel(context.Background())
+	a := &readAttempt{client: client, source: source, cancel: cancel}
+	if cc, ok := client.(contextClient); ok {
+		client = cc.withContext(ctx)
+	}
+	w := &claimWriter{claim, a}
+	go func() {
+		if hedged {
+			defer c.hedger.release()
+		}
+		defer cancel()
+		results <- readResult{a, c.pollDownload(ctx, client, namespace, d, w)}
+	}()
+	return a
+}
+
+// pollDownload downloads the blob of d from client into dst, polling while
+// client fetches the blob from the backend, until ctx is cancelled.
+func (c *clusterClient) pollDownload(
+	ctx context.Context, client Client, namespace string, d core.Digest, dst io.Writer) error {
+
+	b := c.defaultPollBackOff()
+	for {
+		err := client.DownloadBlob(namespace, d, dst)
+		if !httputil.IsAccepted(err) {
+			return err
+		}
+		delay := b.NextBackOff()
+		if delay == backoff.Stop {
+			return errors.New("backoff timed out on 202 responses")
+		}
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// readClaim hands dst to the first attempt which writes to it, and cuts off
+// all other attempts.
+type readClaim struct {
+	sync.Mutex
+	dst       io.Writer
+	owner     *readAttempt
+	abandoned map[*readAttempt]bool
+}
+
+func (c *readClaim) owned() bool {
+	c.Lock()
+	defer c.Unlock()
+	return c.owner != nil
+}
+
+func (c *readClaim) owns(a *readAttempt) bool {
+	c.Lock()
+	defer c.Unlock()
+	return c.owner == a
+}
+
+// abandon cuts off a, and returns false if a already writes to dst.
+func (c *readClaim) abandon(a *readAttempt) bool {
+	c.Lock()
+	defer c.Unlock()
+	if c.owner == a {
+		return false
+	}
+	c.abandoned[a] = true
+	return true
+}
+
+// claimWriter writes to the dst of claim on behalf of attempt.
+type claimWriter struct {
+	claim   *readClaim
+	attempt *readAttempt
+}
+
+func (w *claimWriter) Write(b []byte) (int, error) {
+	c := w.claim
+	c.Lock()
+	if c.owner == nil && !c.abandoned[w.attempt] {
+		c.owner = w.attempt
+	}
+	if c.owner != w.attempt {
+		c.Unlock()
+		return 0, errReadSuperseded
+	}
+	c.Unlock()
+	return c.dst.Write(b)
+}
@@ -20,6 +20,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"net/http"
 	"net/url"
 	"time"
 
@@ -27,10 +28,22 @@ import (
 	"github.com/uber/kraken/utils/httputil"
 )
 
+// ChunkDigestHeader is the header which carries the digest of an upload chunk,
+// allowing origins to verify each chunk as it is received.
+const ChunkDigestHeader = "X-Chunk-Digest"
+
+// BlobDigestTrailer is the trailer which carries the digest of a streamed
+// upload, allowing clients to compute the digest while sending the blob.
+const BlobDigestTrailer = "X-Blob-Digest"
+
+// _maxChunkAttempts is the number of times a chunk is sent before giving up if
+// the origin keeps receiving it corrupted.
+const _maxChunkAttempts = 3
+
 // uploader provides methods for executing a chunked upload.
 type uploader interface {
 	start(d core.Digest) (uid string, err error)
-	patch(d core.Digest, uid string, start, stop int64, chunk io.Reader) error
+	patch(d core.Digest, uid string, start, stop int64, chunk io.Reader, chunkDigest core.Digest) error
 	commit(d core.Digest, uid string) error
 }
 
@@ -56,9 +69,8 @@ func runChunkedUploadHelper(u uploader, d core.Digest, blob io.Reader, chunkSize
 			}
 			return fmt.Errorf("read blob: %s", err)
 		}
-		chunk := bytes.NewReader(buf[:n])
 		stop := pos + int64(n)
-		if err := u.patch(d, uid, pos, stop, chunk); err != nil {
+		if err := patchChunk(u, d, uid, pos, stop, buf[:n]); err != nil {
 			return err
 		}
 		pos = stop
@@ -66,6 +78,25 @@ func runChunkedUploadHelper(u uploader, d core.Digest, blob io.Reader, chunkSize
 	return u.commit(d, uid)
 }
 
+// patchChunk uploads chunk, re-sending it if the origin detects it was corrupted
+// in transit.
+func patchChunk(u uploader, d core.Digest, uid string, start, stop int64, chunk []byte) error {
+	chunkDigest, err := core.NewDigester().FromBytes(chunk)
+	if err != nil {
+		return fmt.Errorf("chunk digest: %s", err)
+	}
+	for attempt := 1; ; attempt++ {
+		err := u.patch(d, uid, start, stop, bytes.NewReader(chunk), chunkDigest)
+		if err == nil || !isChunkCorrupted(err) || attempt == _maxChunkAttempts {
+			return err
+		}
+	}
+}
+
+func isChunkCorrupted(err error) bool {
+	return httputil.IsStatus(err, http.StatusUnprocessableEntity)
+}
+
 // transferClient executes chunked uploads for internal blob transfers.
 type transferClient struct {
 	addr string
@@ -91,13 +122,14 @@ func (c *transferClient) start(d core.Digest) (uid string, err error) {
 }
 
 func (c *transferClient) patch(
-	d core.Digest, uid string, start, stop int64, chunk io.Reader) error {
+	d core.Digest, uid string, start, stop int64, chunk io.Reader, chunkDigest core.Digest) error {
 
 	_, err := httputil.Patch(
 		fmt.Sprintf("http://%s/internal/blobs/%s/uploads/%s", c.addr, d, uid),
 		httputil.SendBody(chunk),
 		httputil.SendHeaders(map[string]string{
-			"Content-Range": fmt.Sprintf("%d-%d", start, stop),
+			"Content-Range":   fmt.Sprintf("%d-%d", start, stop),
+			ChunkDigestHeader: chunkDigest.String(),
 		}),
 		httputil.SendTLS(c.tls))
 	return err
@@ -149,14 +181,15 @@ func (c *uploadClient) start(d core.Digest) (uid string, err error) {
 }
 
 func (c *uploadClient) patch(
-	d core.Digest, uid string, start, stop int64, chunk io.Reader) error {
+	d core.Digest, uid string, start, stop int64, chunk io.Reader, chunkDigest core.Digest) error {
 
 	_, err := httputil.Patch(
 		fmt.Sprintf("http://%s/namespace/%s/blobs/%s/uploads/%s",
 			c.addr, url.PathEscape(c.namespace), d, uid),
 		httputil.SendBody(chunk),
 		httputil.SendHeaders(map[string]string{
-			"Content-Range": fmt.Sprintf("%d-%d", start, stop),
+			"Content-Range":   fmt.Sprintf("%d-%d", start, stop),
+			ChunkDigestHeader: chunkDigest.String(),
 		}),
 		httputil.SendTLS(c.tls))
 	return err
@@ -0,0 +1,75 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package blobclient
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+
+	"github.com/uber/kraken/core"
+)
+
+// _defaultWeight matches the default weight of hash ring addresses.
+const _defaultWeight = 100
+
+// WithOriginWeights configures a ClusterClient to prefer origins with higher
+// weights, keyed by address. Weights should match those of the origin hash
+// ring, such that origins serve reads in proportion to the blobs they own.
+func WithOriginWeights(weights map[string]int) ClusterClientOption {
+	return func(c *clusterClient) {
+		if len(weights) > 0 {
+			c.weights = originWeights(weights)
+		}
+	}
+}
+
+// originWeights maps origin addresses to their weights.
+type originWeights map[string]int
+
+func (w originWeights) of(addr string) int {
+	if v, ok := w[addr]; ok && v > 0 {
+		return v
+	}
+	return _defaultWeight
+}
+
+// shuffle randomly orders cs, such that the probability of each client being
+// ordered first is proportional to its weight.
+func (w originWeights) shuffle(cs []Client) {
+	keys := make(map[Client]float64, len(cs))
+	for _, c := range cs {
+		keys[c] = -math.Log(1-rand.Float64()) / float64(w.of(c.Addr()))
+	}
+	sort.SliceStable(cs, func(i, j int) bool { return keys[cs[i]] < keys[cs[j]] })
+}
+
+// weightResolver orders resolved clients by descending weight. Clients of
+// equal weight keep their ring order, such that the order remains stable and
+// polls keep preferring the same origin.
+type weightResolver struct {
+	resolver ClientResolver
+	weights  originWeights
+}
+
+func (r *weightResolver) Resolve(d core.Digest) ([]Client, error) {
+	clients, err := r.resolver.Resolve(d)
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(clients, func(i, j int) bool {
+		return r.weights.of(clients[i].Addr()) > r.weights.of(clients[j].Addr())
+	})
+	return clients, nil
+}
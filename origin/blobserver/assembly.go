@@ -0,0 +1,207 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package blobserver
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/store"
+	"github.com/uber/kraken/utils/handler"
+	"github.com/uber/kraken/utils/httputil"
+
+	"github.com/c2h5oh/datasize"
+)
+
+// AssemblyConfig defines serving of chunked blobs, which are stored as a chunk
+// manifest blob referencing an ordered list of chunk blobs. When enabled,
+// fetching the assembled blob of a manifest streams the concatenated chunks.
+type AssemblyConfig struct {
+	Enabled bool `yaml:"enabled"`
+
+	// MaxManifestSize bounds the size of manifests, which are read into memory.
+	MaxManifestSize datasize.ByteSize `yaml:"max_manifest_size"`
+}
+
+func (c AssemblyConfig) applyDefaults() AssemblyConfig {
+	if c.MaxManifestSize == 0 {
+		c.MaxManifestSize = datasize.MB
+	}
+	return c
+}
+
+// downloadAssembledBlobHandler streams the blob assembled from the chunks of
+// the chunk manifest blob of the digest param. Every chunk, and the assembled
+// blob as a whole, is verified before any data is sent, unless verified within
+// the reverify interval of the verification cache. If the manifest or any
+// chunk is not cached yet, it is fetched from the backend and 202 is returned,
+// like for regular downloads.
+func (s *Server) downloadAssembledBlobHandler(w http.ResponseWriter, r *http.Request) error {
+	namespace, err := httputil.ParseParam(r, "namespace")
+	if err != nil {
+		return err
+	}
+	d, err := httputil.ParseDigest(r, "digest")
+	if err != nil {
+		return err
+	}
+	m, err := s.getChunkManifest(namespace, d)
+	if err != nil {
+		return err
+	}
+
+	// Chunks are held open from verification until they are served, such that
+	// chunks evicted in between are still served in full.
+	chunks, err := s.openChunks(namespace, m)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		for _, f := range chunks {
+			f.Close()
+		}
+	}()
+
+	if !s.verifications.fresh(d.Hex()) {
+		if err := verifyChunks(m, chunks); err != nil {
+			s.stats.Counter("assembly_verification_failures").Inc(1)
+			return handler.Errorf("verify chunks of %s: %s", d, err)
+		}
+		s.verifications.record(d.Hex())
+	}
+
+	setOctetStreamContentType(w)
+	setContentLength(w, int(m.Size))
+	for i, c := range m.Chunks {
+		if err := copyChunk(w, c, chunks[i]); err != nil {
+			return handler.Errorf("copy chunk %s: %s", c.Digest, err)
+		}
+	}
+	s.stats.Counter("assembled_downloads").Inc(1)
+	return nil
+}
+
+// getChunkManifest returns the chunk manifest stored in the blob of d.
+func (s *Server) getChunkManifest(namespace string, d core.Digest) (*core.ChunkManifest, error) {
+	f, err := s.cas.GetCacheFileReader(d.Hex())
+	if os.IsNotExist(err) {
+		return nil, s.startRemoteBlobDownload(namespace, d, true)
+	} else if err != nil {
+		return nil, handler.Errorf("get cache file: %s", err)
+	}
+	defer f.Close()
+
+	max := int64(s.config.Assembly.MaxManifestSize)
+	b, err := ioutil.ReadAll(io.LimitReader(f, max+1))
+	if err != nil {
+		return nil, handler.Errorf("read manifest: %s", err)
+	}
+	if int64(len(b)) > max {
+		return nil, handler.Errorf("manifest exceeds %d bytes", max).Status(http.StatusBadRequest)
+	}
+	m, err := core.ParseChunkManifest(b)
+	if err != nil {
+		return nil, handler.Errorf("blob %s is not a chunk manifest: %s", d, err).Status(http.StatusBadRequest)
+	}
+	return m, nil
+}
+
+// openChunks opens every chunk of m, in order. If any chunk is not cached yet,
+// the missing chunks are fetched from the backend and 202 is returned.
+func (s *Server) openChunks(namespace string, m *core.ChunkManifest) ([]store.FileReader, error) {
+	var chunks []store.FileReader
+	closeAll := func() {
+		for _, f := range chunks {
+			f.Close()
+		}
+	}
+	var missing bool
+	for _, c := range m.Chunks {
+		f, err := s.cas.GetCacheFileReader(c.Digest.Hex())
+		if err == nil {
+			chunks = append(chunks, f)
+			continue
+		} else if !os.IsNotExist(err) {
+			closeAll()
+			return nil, handler.Errorf("open chunk %s: %s", c.Digest, err)
+		}
+		missing = true
+		if err := s.startRemoteBlobDownload(namespace, c.Digest, true); !isAccepted(err) {
+			closeAll()
+			return nil, err
+		}
+	}
+	if missing {
+		closeAll()
+		return nil, handler.ErrorStatus(http.StatusAccepted)
+	}
+	return chunks, nil
+}
+
+// verifyChunks checks that every chunk of m matches its digest and size, and
+// that the concatenated chunks match the digest of m.
+func verifyChunks(m *core.ChunkManifest, chunks []store.FileReader) error {
+	whole, err := core.NewDigesterWithAlgo(m.Digest.Algo())
+	if err != nil {
+		return err
+	}
+	for i, c := range m.Chunks {
+		if err := verifyChunk(c, chunks[i], whole); err != nil {
+			return fmt.Errorf("chunk %s: %s", c.Digest, err)
+		}
+	}
+	if actual := whole.Digest(); actual != m.Digest {
+		return fmt.Errorf("assembled digest %s does not match %s", actual, m.Digest)
+	}
+	return nil
+}
+
+func verifyChunk(c core.Chunk, f store.FileReader, whole *core.Digester) error {
+	digester, err := core.NewDigesterWithAlgo(c.Digest.Algo())
+	if err != nil {
+		return err
+	}
+	r := io.NewSectionReader(f, 0, f.Size())
+	n, err := io.Copy(ioutil.Discard, digester.Tee(whole.Tee(r)))
+	if err != nil {
+		return fmt.Errorf("read: %s", err)
+	}
+	if n != c.Size {
+		return fmt.Errorf("size %d does not match %d", n, c.Size)
+	}
+	if actual := digester.Digest(); actual != c.Digest {
+		return fmt.Errorf("digest %s does not match", actual)
+	}
+	return nil
+}
+
+func copyChunk(w io.Writer, c core.Chunk, f store.FileReader) error {
+	n, err := io.Copy(w, io.NewSectionReader(f, 0, f.Size()))
+	if err != nil {
+		return err
+	}
+	if n != c.Size {
+		return fmt.Errorf("copied %d bytes, expected %d", n, c.Size)
+	}
+	return nil
+}
+
+func isAccepted(err error) bool {
+	herr, ok := err.(*handler.Error)
+	return ok && herr.GetStatus() == http.StatusAccepted
+}
@@ -0,0 +1,166 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package blobserver
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/backend/namepath"
+	"github.com/uber/kraken/lib/backend/testfs"
+	"github.com/uber/kraken/lib/hashring"
+	"github.com/uber/kraken/lib/healthcheck"
+	"github.com/uber/kraken/lib/hostlist"
+	"github.com/uber/kraken/utils/testutil"
+
+	"github.com/stretchr/testify/require"
+)
+
+// chunkedBlobFixture splits a random blob into n chunks, and returns the chunks
+// along with the manifest of the blob.
+func chunkedBlobFixture(t *testing.T, n int) ([]*core.BlobFixture, *core.BlobFixture, []byte) {
+	var chunks []*core.BlobFixture
+	var refs []core.Chunk
+	var whole []byte
+	for i := 0; i < n; i++ {
+		c := core.SizedBlobFixture(uint64(100+i), 16)
+		chunks = append(chunks, c)
+		refs = append(refs, core.Chunk{Digest: c.Digest, Size: c.Length()})
+		whole = append(whole, c.Content...)
+	}
+	d, err := core.NewDigester().FromBytes(whole)
+	require.NoError(t, err)
+	b, err := core.NewChunkManifest(d, refs).Serialize()
+	require.NoError(t, err)
+	md, err := core.NewDigester().FromBytes(b)
+	require.NoError(t, err)
+	return chunks, core.CustomBlobFixture(b, md, nil), whole
+}
+
+func getAssembled(t *testing.T, addr, namespace string, d core.Digest) (int, []byte) {
+	resp, err := http.Get(fmt.Sprintf("http://%s/namespace/%s/blobs/%s/assembled", addr, namespace, d))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return resp.StatusCode, b
+}
+
+func TestAssembledBlobConcatenatesVerifiedChunks(t *testing.T) {
+	require := require.New(t)
+
+	config := Config{Assembly: AssemblyConfig{Enabled: true}}
+	s := newTestServerWithConfig(t, config, master1, hashRingNoReplica(), newTestClientProvider())
+	defer s.cleanup()
+
+	chunks, manifest, whole := chunkedBlobFixture(t, 3)
+	for _, c := range append(chunks, manifest) {
+		require.NoError(s.cas.CreateCacheFile(c.Digest.Hex(), bytes.NewReader(c.Content)))
+	}
+
+	status, body := getAssembled(t, s.addr, "ns", manifest.Digest)
+	require.Equal(http.StatusOK, status)
+	require.Equal(whole, body)
+
+	d, err := core.NewDigester().FromBytes(body)
+	require.NoError(err)
+	m, err := core.ParseChunkManifest(manifest.Content)
+	require.NoError(err)
+	require.Equal(m.Digest, d)
+}
+
+func TestAssembledBlobFetchesMissingChunksFromBackend(t *testing.T) {
+	require := require.New(t)
+
+	fs := testfs.NewServer()
+	defer fs.Cleanup()
+	fsAddr, stop := testutil.StartServer(fs.Handler())
+	defer stop()
+
+	client, err := testfs.NewClient(testfs.Config{Addr: fsAddr, NamePath: namepath.Identity})
+	require.NoError(err)
+
+	// Chunks are owned by the fetching origin, such that they need not be
+	// replicated to other origins.
+	ring := hashring.New(
+		hashring.Config{MaxReplica: 1},
+		hostlist.Fixture(master1),
+		healthcheck.IdentityFilter{})
+
+	config := Config{Assembly: AssemblyConfig{Enabled: true}}
+	s := newTestServerWithConfig(t, config, master1, ring, newTestClientProvider())
+	defer s.cleanup()
+
+	namespace := "chunked"
+	require.NoError(s.backendManager.Register(namespace, client))
+
+	chunks, manifest, whole := chunkedBlobFixture(t, 3)
+	for _, c := range append(chunks, manifest) {
+		require.NoError(client.Upload(namespace, c.Digest.Hex(), bytes.NewReader(c.Content)))
+	}
+
+	status, _ := getAssembled(t, s.addr, namespace, manifest.Digest)
+	require.Equal(http.StatusAccepted, status)
+
+	var body []byte
+	require.NoError(testutil.PollUntilTrue(5*time.Second, func() bool {
+		status, body = getAssembled(t, s.addr, namespace, manifest.Digest)
+		return status == http.StatusOK
+	}))
+	require.Equal(whole, body)
+}
+
+func TestAssembledBlobRejectsMismatchedAssembledDigest(t *testing.T) {
+	require := require.New(t)
+
+	config := Config{Assembly: AssemblyConfig{Enabled: true}}
+	s := newTestServerWithConfig(t, config, master1, hashRingNoReplica(), newTestClientProvider())
+	defer s.cleanup()
+
+	chunks, _, _ := chunkedBlobFixture(t, 2)
+	var refs []core.Chunk
+	for _, c := range chunks {
+		require.NoError(s.cas.CreateCacheFile(c.Digest.Hex(), bytes.NewReader(c.Content)))
+		refs = append(refs, core.Chunk{Digest: c.Digest, Size: c.Length()})
+	}
+
+	// The manifest claims the chunks assemble into some other blob.
+	b, err := core.NewChunkManifest(core.DigestFixture(), refs).Serialize()
+	require.NoError(err)
+	md, err := core.NewDigester().FromBytes(b)
+	require.NoError(err)
+	require.NoError(s.cas.CreateCacheFile(md.Hex(), bytes.NewReader(b)))
+
+	status, _ := getAssembled(t, s.addr, "ns", md)
+	require.Equal(http.StatusInternalServerError, status)
+}
+
+func TestAssembledBlobRejectsNonManifests(t *testing.T) {
+	require := require.New(t)
+
+	config := Config{Assembly: AssemblyConfig{Enabled: true}}
+	s := newTestServerWithConfig(t, config, master1, hashRingNoReplica(), newTestClientProvider())
+	defer s.cleanup()
+
+	blob := core.NewBlobFixture()
+	require.NoError(s.cas.CreateCacheFile(blob.Digest.Hex(), bytes.NewReader(blob.Content)))
+
+	status, _ := getAssembled(t, s.addr, "ns", blob.Digest)
+	require.Equal(http.StatusBadRequest, status)
+}
@@ -0,0 +1,127 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package blobserver
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/origin/blobclient"
+	"github.com/uber/kraken/utils/handler"
+	"github.com/uber/kraken/utils/httputil"
+	"github.com/uber/kraken/utils/log"
+	"github.com/uber/kraken/utils/stringset"
+)
+
+// broadcastHook notifies the other owners of a blob fetched from the backend,
+// such that they pull it from this origin.
+type broadcastHook struct {
+	server    *Server
+	namespace string
+}
+
+func (h *broadcastHook) Run(d core.Digest) {
+	s := h.server
+	// Notifications run in the background, such that the refresh is not held
+	// up by slow or unavailable siblings.
+	go s.applyToReplicas(d, func(i int, client blobclient.Client) error {
+		if err := client.PullBlob(h.namespace, d, s.addr); err != nil {
+			log.With("blob", d.Hex(), "replica", client.Addr()).Infof("Error broadcasting blob: %s", err)
+			s.stats.Counter("broadcast_errors").Inc(1)
+			return err
+		}
+		s.stats.Counter("broadcasts").Inc(1)
+		return nil
+	})
+}
+
+// pullBlobHandler starts a pull of a blob from the sibling origin which
+// broadcast it.
+func (s *Server) pullBlobHandler(w http.ResponseWriter, r *http.Request) error {
+	namespace, err := httputil.ParseParam(r, "namespace")
+	if err != nil {
+		return err
+	}
+	d, err := httputil.ParseDigest(r, "digest")
+	if err != nil {
+		return err
+	}
+	source := httputil.GetQueryArg(r, "source", "")
+	owners := stringset.FromSlice(s.hashRing.Locations(d))
+	if !owners.Has(source) || source == s.addr {
+		return handler.Errorf("source %q is not a sibling owner of blob", source).
+			Status(http.StatusBadRequest)
+	}
+	if !owners.Has(s.addr) {
+		return handler.Errorf("not an owner of blob").Status(http.StatusBadRequest)
+	}
+	if ok, err := blobExists(s.cas, d); err != nil {
+		return handler.Errorf("check blob: %s", err)
+	} else if ok {
+		w.WriteHeader(http.StatusOK)
+		return nil
+	}
+	if _, loaded := s.pulls.LoadOrStore(d, struct{}{}); loaded {
+		w.WriteHeader(http.StatusAccepted)
+		return nil
+	}
+	if !s.pullLimiter.Allow() {
+		s.pulls.Delete(d)
+		s.stats.Counter("pull_rate_limited").Inc(1)
+		return handler.ErrorStatus(http.StatusTooManyRequests)
+	}
+	go func() {
+		defer s.pulls.Delete(d)
+		timer := s.stats.Timer("pull_blob").Start()
+		if err := s.pullBlob(namespace, d, source); err != nil {
+			log.With("blob", d.Hex(), "source", source).Errorf("Error pulling blob: %s", err)
+			s.stats.Counter("pull_blob_errors").Inc(1)
+			return
+		}
+		timer.Stop()
+	}()
+	w.WriteHeader(http.StatusAccepted)
+	return nil
+}
+
+// pullBlob downloads the blob of d from source into the local cache.
+func (s *Server) pullBlob(namespace string, d core.Digest, source string) error {
+	uid, err := s.uploader.start(namespace, d)
+	if err != nil {
+		if herr, ok := err.(*handler.Error); ok && herr.GetStatus() == http.StatusConflict {
+			return nil
+		}
+		return fmt.Errorf("start upload: %s", err)
+	}
+	f, err := s.cas.GetUploadFileReadWriter(uid)
+	if err != nil {
+		return fmt.Errorf("get upload file: %s", err)
+	}
+	defer f.Close()
+	if err := s.clientProvider.Provide(source).DownloadBlob(namespace, d, f); err != nil {
+		s.cas.DeleteUploadFile(uid)
+		return fmt.Errorf("download from source: %s", err)
+	}
+	if err := s.uploader.commit(namespace, d, uid); err != nil {
+		if herr, ok := err.(*handler.Error); ok && herr.GetStatus() == http.StatusConflict {
+			return nil
+		}
+		return fmt.Errorf("commit: %s", err)
+	}
+	if err := s.metaInfoGenerator.Generate(d); err != nil {
+		return fmt.Errorf("generate metainfo: %s", err)
+	}
+	return nil
+}
@@ -0,0 +1,249 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package blobserver
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/uber/kraken/utils/handler"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/uber-go/tally"
+)
+
+// ClientLimitConfig defines limiting of the concurrent downloads of a single
+// client, such that a client stuck in a download loop cannot monopolize the
+// origin. Requests beyond the limit of their client wait up to QueueTimeout
+// for a slot, and are otherwise rejected with 429. Other clients are
+// unaffected.
+type ClientLimitConfig struct {
+	Enabled bool `yaml:"enabled"`
+
+	// MaxConcurrent is the number of concurrent requests of a single client.
+	MaxConcurrent int `yaml:"max_concurrent"`
+
+	// QueueTimeout is how long requests beyond the limit wait for a slot. If
+	// zero, they are rejected immediately.
+	QueueTimeout time.Duration `yaml:"queue_timeout"`
+
+	// ClientHeader is a request header identifying the client, such as a peer
+	// ID. Clients which do not set it are identified by IP. Behind nginx, the IP
+	// is taken from the X-Real-IP header nginx sets.
+	ClientHeader string `yaml:"client_header"`
+
+	// TopClients is the number of clients reported by the admin endpoint.
+	TopClients int `yaml:"top_clients"`
+}
+
+func (c ClientLimitConfig) applyDefaults() ClientLimitConfig {
+	if c.MaxConcurrent == 0 {
+		c.MaxConcurrent = 32
+	}
+	if c.TopClients == 0 {
+		c.TopClients = 10
+	}
+	return c
+}
+
+// ClientInflight is a snapshot of the in-flight requests of a single client.
+type ClientInflight struct {
+	Client   string `json:"client"`
+	Inflight int    `json:"inflight"`
+	Waiting  int    `json:"waiting"`
+}
+
+// clientLimiter grants request slots to clients. Only clients with in-flight
+// requests are tracked.
+type clientLimiter struct {
+	config ClientLimitConfig
+	clk    clock.Clock
+	stats  tally.Scope
+
+	mu       sync.Mutex
+	inflight map[string]int
+	waiting  map[string][]chan struct{}
+}
+
+func newClientLimiter(config ClientLimitConfig, stats tally.Scope, clk clock.Clock) *clientLimiter {
+	if !config.Enabled {
+		return nil
+	}
+	return &clientLimiter{
+		config:   config.applyDefaults(),
+		clk:      clk,
+		stats:    stats.SubScope("client_limit"),
+		inflight: make(map[string]int),
+		waiting:  make(map[string][]chan struct{}),
+	}
+}
+
+// acquire takes a slot of client, waiting up to the queue timeout for one.
+// Returns false if no slot was granted.
+func (l *clientLimiter) acquire(ctx context.Context, client string) bool {
+	l.mu.Lock()
+	if l.inflight[client] < l.config.MaxConcurrent {
+		l.inflight[client]++
+		l.mu.Unlock()
+		return true
+	}
+	if l.config.QueueTimeout == 0 {
+		l.mu.Unlock()
+		return false
+	}
+	c := make(chan struct{})
+	l.waiting[client] = append(l.waiting[client], c)
+	l.mu.Unlock()
+
+	timer := l.clk.Timer(l.config.QueueTimeout)
+	defer timer.Stop()
+
+	select {
+	case <-c:
+		return true
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for i, w := range l.waiting[client] {
+		if w == c {
+			l.removeWaiter(client, i)
+			return false
+		}
+	}
+	// Granted a slot while giving up.
+	return true
+}
+
+// release returns a slot of client, handing it to the next waiter of client if
+// any.
+func (l *clientLimiter) release(client string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if len(l.waiting[client]) > 0 {
+		c := l.waiting[client][0]
+		l.removeWaiter(client, 0)
+		close(c)
+		return
+	}
+	if l.inflight[client]--; l.inflight[client] == 0 {
+		delete(l.inflight, client)
+	}
+}
+
+// removeWaiter removes the i-th waiter of client. Must be called with mu held.
+func (l *clientLimiter) removeWaiter(client string, i int) {
+	w := l.waiting[client]
+	if w = append(w[:i], w[i+1:]...); len(w) == 0 {
+		delete(l.waiting, client)
+	} else {
+		l.waiting[client] = w
+	}
+}
+
+// top returns the n clients with the most in-flight requests.
+func (l *clientLimiter) top(n int) []ClientInflight {
+	l.mu.Lock()
+	clients := make([]ClientInflight, 0, len(l.inflight))
+	for client, inflight := range l.inflight {
+		clients = append(clients, ClientInflight{client, inflight, len(l.waiting[client])})
+	}
+	l.mu.Unlock()
+
+	sort.Slice(clients, func(i, j int) bool {
+		if clients[i].Inflight != clients[j].Inflight {
+			return clients[i].Inflight > clients[j].Inflight
+		}
+		return clients[i].Client < clients[j].Client
+	})
+	if len(clients) > n {
+		clients = clients[:n]
+	}
+	return clients
+}
+
+// realIPHeader is set by nginx to the IP of the client it proxies for.
+const realIPHeader = "X-Real-IP"
+
+// clientID identifies the client of r.
+func (l *clientLimiter) clientID(r *http.Request) string {
+	if l.config.ClientHeader != "" {
+		if id := r.Header.Get(l.config.ClientHeader); id != "" {
+			return id
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if fromLocalProxy(host, err) {
+		if ip := r.Header.Get(realIPHeader); ip != "" {
+			return ip
+		}
+	}
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// fromLocalProxy returns true if the peer with the given host, as split from
+// the remote address of a request with error err, is the local nginx. Origins
+// serve nginx over a unix socket, whose peers have no host and port, or over
+// loopback. Requests from any other peer may spoof the X-Real-IP header.
+func fromLocalProxy(host string, err error) bool {
+	if err != nil {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// limitClients is a middleware which bounds the concurrent requests of each
+// client.
+func (s *Server) limitClients(next http.Handler) http.Handler {
+	if s.clientLimiter == nil {
+		return next
+	}
+	return handler.Wrap(func(w http.ResponseWriter, r *http.Request) error {
+		client := s.clientLimiter.clientID(r)
+		if !s.clientLimiter.acquire(r.Context(), client) {
+			s.clientLimiter.stats.Counter("rejected").Inc(1)
+			return handler.Errorf("client %s exceeded concurrency limit", client).
+				Status(http.StatusTooManyRequests).
+				Header("Retry-After", "1")
+		}
+		defer s.clientLimiter.release(client)
+
+		next.ServeHTTP(w, r)
+		return nil
+	})
+}
+
+// clientsHandler returns the clients with the most in-flight requests.
+func (s *Server) clientsHandler(w http.ResponseWriter, r *http.Request) error {
+	clients := []ClientInflight{}
+	if s.clientLimiter != nil {
+		clients = s.clientLimiter.top(s.clientLimiter.config.TopClients)
+	}
+	if err := json.NewEncoder(w).Encode(clients); err != nil {
+		return handler.Errorf("json encode: %s", err)
+	}
+	return nil
+}
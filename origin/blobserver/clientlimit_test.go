@@ -0,0 +1,190 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package blobserver
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/stretchr/testify/require"
+	"github.com/uber-go/tally"
+)
+
+func TestLimitClientsCapsExcessConcurrencyOfOneClient(t *testing.T) {
+	require := require.New(t)
+
+	s := &Server{
+		clientLimiter: newClientLimiter(ClientLimitConfig{
+			Enabled:       true,
+			MaxConcurrent: 2,
+			ClientHeader:  "X-Client",
+		}, tally.NoopScope, clock.New()),
+	}
+
+	unblock := make(chan struct{})
+	started := make(chan struct{}, 10)
+	h := s.limitClients(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-unblock
+	}))
+
+	request := func(client string) int {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("X-Client", client)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	// Saturate the limit of the looping client.
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			require.Equal(http.StatusOK, request("looping"))
+		}()
+	}
+	<-started
+	<-started
+
+	require.Equal(http.StatusTooManyRequests, request("looping"))
+
+	// Other clients are unaffected.
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		require.Equal(http.StatusOK, request("other"))
+	}()
+	<-started
+
+	require.Equal([]ClientInflight{
+		{Client: "looping", Inflight: 2},
+		{Client: "other", Inflight: 1},
+	}, s.clientLimiter.top(10))
+
+	close(unblock)
+	wg.Wait()
+
+	require.Empty(s.clientLimiter.top(10))
+}
+
+func TestClientLimiterQueuesUpToTimeout(t *testing.T) {
+	require := require.New(t)
+
+	clk := clock.NewMock()
+	l := newClientLimiter(ClientLimitConfig{
+		Enabled:       true,
+		MaxConcurrent: 1,
+		QueueTimeout:  time.Second,
+	}, tally.NoopScope, clk)
+
+	require.True(l.acquire(context.Background(), "a"))
+
+	// Waiters are granted released slots.
+	granted := make(chan bool)
+	go func() { granted <- l.acquire(context.Background(), "a") }()
+	waitForWaiters(t, l, "a", 1)
+	l.release("a")
+	require.True(<-granted)
+
+	// And give up after the queue timeout.
+	go func() { granted <- l.acquire(context.Background(), "a") }()
+	waitForWaiters(t, l, "a", 1)
+	clk.Add(time.Second)
+	require.False(<-granted)
+
+	l.release("a")
+	require.Empty(l.top(10))
+}
+
+func waitForWaiters(t *testing.T, l *clientLimiter, client string, n int) {
+	for i := 0; i < 1000; i++ {
+		l.mu.Lock()
+		w := len(l.waiting[client])
+		l.mu.Unlock()
+		if w == n {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("timed out waiting for %d waiters of %s", n, client)
+}
+
+func TestClientLimiterIdentifiesClientsByIP(t *testing.T) {
+	require := require.New(t)
+
+	l := newClientLimiter(
+		ClientLimitConfig{Enabled: true, ClientHeader: "X-Client"}, tally.NoopScope, clock.New())
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.RemoteAddr = "10.0.0.1:1234"
+	require.Equal("10.0.0.1", l.clientID(r))
+
+	r.Header.Set("X-Client", "peer")
+	require.Equal("peer", l.clientID(r))
+}
+
+func TestClientLimiterTrustsRealIPOnlyFromLocalProxy(t *testing.T) {
+	require := require.New(t)
+
+	l := newClientLimiter(ClientLimitConfig{Enabled: true}, tally.NoopScope, clock.New())
+
+	tests := []struct {
+		remoteAddr string
+		expected   string
+	}{
+		{"@", "10.0.0.2"},
+		{"", "10.0.0.2"},
+		{"127.0.0.1:1234", "10.0.0.2"},
+		{"10.0.0.1:1234", "10.0.0.1"},
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = test.remoteAddr
+		r.Header.Set("X-Real-IP", "10.0.0.2")
+		require.Equal(test.expected, l.clientID(r), "remote addr %q", test.remoteAddr)
+	}
+}
+
+func TestClientsHandler(t *testing.T) {
+	require := require.New(t)
+
+	s := &Server{
+		clientLimiter: newClientLimiter(
+			ClientLimitConfig{Enabled: true, TopClients: 2}, tally.NoopScope, clock.New()),
+	}
+	for i := 0; i < 3; i++ {
+		for j := 0; j <= i; j++ {
+			require.True(s.clientLimiter.acquire(context.Background(), fmt.Sprintf("client-%d", i)))
+		}
+	}
+
+	w := httptest.NewRecorder()
+	require.NoError(s.clientsHandler(w, httptest.NewRequest("GET", "/x/clients", nil)))
+
+	var clients []ClientInflight
+	require.NoError(json.NewDecoder(w.Body).Decode(&clients))
+	require.Equal([]ClientInflight{
+		{Client: "client-2", Inflight: 3},
+		{Client: "client-1", Inflight: 2},
+	}, clients)
+}
@@ -15,8 +15,13 @@ package blobserver
 
 import (
 	"bytes"
+	"errors"
+	"io"
 	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
 	"sort"
+	"strings"
 	"testing"
 	"time"
 
@@ -28,6 +33,7 @@ import (
 	"github.com/uber/kraken/origin/blobclient"
 	"github.com/uber/kraken/utils/httputil"
 
+	"github.com/andres-erbsen/clock"
 	"github.com/cenkalti/backoff"
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/require"
@@ -240,6 +246,73 @@ func TestClusterClientOverwriteMetainfo(t *testing.T) {
 	require.NoError(err)
 }
 
+func TestClusterClientDownloadPrefersHigherWeightedOrigin(t *testing.T) {
+	require := require.New(t)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockResolver := mockblobclient.NewMockClientResolver(ctrl)
+
+	cc := blobclient.NewClusterClient(
+		mockResolver, blobclient.WithOriginWeights(map[string]int{"origin2": 200}))
+
+	blob := core.NewBlobFixture()
+	namespace := core.TagFixture()
+
+	mockClient1 := mockblobclient.NewMockClient(ctrl)
+	mockClient1.EXPECT().Addr().Return("origin1").AnyTimes()
+	mockClient2 := mockblobclient.NewMockClient(ctrl)
+	mockClient2.EXPECT().Addr().Return("origin2").AnyTimes()
+
+	mockResolver.EXPECT().Resolve(blob.Digest).Return(
+		[]blobclient.Client{mockClient1, mockClient2}, nil)
+	mockClient2.EXPECT().DownloadBlob(namespace, blob.Digest, gomock.Any()).Return(nil)
+
+	require.NoError(cc.DownloadBlob(namespace, blob.Digest, ioutil.Discard))
+}
+
+func TestClusterClientStatPrefersOriginsInProportionToWeight(t *testing.T) {
+	require := require.New(t)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockResolver := mockblobclient.NewMockClientResolver(ctrl)
+
+	cc := blobclient.NewClusterClient(
+		mockResolver, blobclient.WithOriginWeights(map[string]int{"origin2": 300}))
+
+	blob := core.NewBlobFixture()
+	namespace := core.TagFixture()
+
+	counts := make(map[string]int)
+	var clients []blobclient.Client
+	for _, addr := range []string{"origin1", "origin2"} {
+		addr := addr
+		client := mockblobclient.NewMockClient(ctrl)
+		client.EXPECT().Addr().Return(addr).AnyTimes()
+		client.EXPECT().Stat(namespace, blob.Digest).DoAndReturn(
+			func(string, core.Digest) (*core.BlobInfo, error) {
+				counts[addr]++
+				return core.NewBlobInfo(256), nil
+			}).AnyTimes()
+		clients = append(clients, client)
+	}
+	mockResolver.EXPECT().Resolve(blob.Digest).DoAndReturn(
+		func(core.Digest) ([]blobclient.Client, error) {
+			return append([]blobclient.Client(nil), clients...), nil
+		}).AnyTimes()
+
+	n := 2000
+	for i := 0; i < n; i++ {
+		_, err := cc.Stat(namespace, blob.Digest)
+		require.NoError(err)
+	}
+	// origin2 has three times the weight of origin1, so should serve 75%.
+	require.InDelta(0.75, float64(counts["origin2"])/float64(n), 0.05)
+}
+
 func TestClusterClientStatContinueWhenNotFound(t *testing.T) {
 	require := require.New(t)
 
@@ -267,3 +340,531 @@ func TestClusterClientStatContinueWhenNotFound(t *testing.T) {
 	require.NotNil(bi)
 	require.Equal(int64(256), bi.Size)
 }
+
+func TestClusterClientGetMetaInfoHedgesSlowOrigin(t *testing.T) {
+	require := require.New(t)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockResolver := mockblobclient.NewMockClientResolver(ctrl)
+
+	cc := blobclient.NewClusterClient(mockResolver, blobclient.WithHedging(blobclient.HedgeConfig{
+		Enabled: true,
+		Delay:   10 * time.Millisecond,
+	}))
+
+	blob := core.SizedBlobFixture(256, 8)
+	namespace := core.TagFixture()
+
+	slowClient := mockblobclient.NewMockClient(ctrl)
+	fastClient := mockblobclient.NewMockClient(ctrl)
+	mockResolver.EXPECT().Resolve(blob.Digest).Return(
+		[]blobclient.Client{slowClient, fastClient}, nil)
+
+	release := make(chan struct{})
+	defer close(release)
+
+	slowClient.EXPECT().GetMetaInfo(namespace, blob.Digest).DoAndReturn(
+		func(namespace string, d core.Digest) (*core.MetaInfo, error) {
+			<-release
+			return nil, errors.New("slow origin should have been abandoned")
+		})
+	fastClient.EXPECT().GetMetaInfo(namespace, blob.Digest).Return(blob.MetaInfo, nil)
+
+	mi, err := cc.GetMetaInfo(namespace, blob.Digest)
+	require.NoError(err)
+	require.Equal(blob.MetaInfo, mi)
+}
+
+func TestClusterClientGetMetaInfoCancelsSlowerOrigin(t *testing.T) {
+	require := require.New(t)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockResolver := mockblobclient.NewMockClientResolver(ctrl)
+
+	cc := blobclient.NewClusterClient(mockResolver, blobclient.WithHedging(blobclient.HedgeConfig{
+		Enabled: true,
+		Delay:   10 * time.Millisecond,
+	}))
+
+	blob := core.SizedBlobFixture(256, 8)
+	namespace := core.TagFixture()
+
+	cancelled := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+			close(cancelled)
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	defer slow.Close()
+
+	raw, err := blob.MetaInfo.Serialize()
+	require.NoError(err)
+	fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(raw)
+	}))
+	defer fast.Close()
+
+	mockResolver.EXPECT().Resolve(blob.Digest).Return([]blobclient.Client{
+		blobclient.New(strings.TrimPrefix(slow.URL, "http://")),
+		blobclient.New(strings.TrimPrefix(fast.URL, "http://")),
+	}, nil)
+
+	mi, err := cc.GetMetaInfo(namespace, blob.Digest)
+	require.NoError(err)
+	require.Equal(blob.MetaInfo.Digest(), mi.Digest())
+
+	select {
+	case <-cancelled:
+	case <-time.After(time.Second):
+		require.FailNow("slower lookup not cancelled")
+	}
+}
+
+func TestClusterClientGetMetaInfoDoesNotHedgeFastOrigin(t *testing.T) {
+	require := require.New(t)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockResolver := mockblobclient.NewMockClientResolver(ctrl)
+
+	cc := blobclient.NewClusterClient(mockResolver, blobclient.WithHedging(blobclient.HedgeConfig{
+		Enabled: true,
+		Delay:   time.Minute,
+	}))
+
+	blob := core.SizedBlobFixture(256, 8)
+	namespace := core.TagFixture()
+
+	mockClient1 := mockblobclient.NewMockClient(ctrl)
+	mockClient2 := mockblobclient.NewMockClient(ctrl)
+	mockResolver.EXPECT().Resolve(blob.Digest).Return(
+		[]blobclient.Client{mockClient1, mockClient2}, nil)
+
+	mockClient1.EXPECT().GetMetaInfo(namespace, blob.Digest).Return(blob.MetaInfo, nil)
+
+	mi, err := cc.GetMetaInfo(namespace, blob.Digest)
+	require.NoError(err)
+	require.Equal(blob.MetaInfo, mi)
+}
+
+func TestClusterClientHedgingCappedByMaxInflight(t *testing.T) {
+	require := require.New(t)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockResolver := mockblobclient.NewMockClientResolver(ctrl)
+
+	cc := blobclient.NewClusterClient(mockResolver, blobclient.WithHedging(blobclient.HedgeConfig{
+		Enabled:     true,
+		Delay:       10 * time.Millisecond,
+		MaxInflight: 1,
+	}))
+
+	blob1 := core.SizedBlobFixture(256, 8)
+	blob2 := core.SizedBlobFixture(256, 8)
+	namespace := core.TagFixture()
+
+	slowClient := mockblobclient.NewMockClient(ctrl)
+	hedgeClient := mockblobclient.NewMockClient(ctrl)
+	mockResolver.EXPECT().Resolve(gomock.Any()).Return(
+		[]blobclient.Client{slowClient, hedgeClient}, nil).Times(2)
+
+	release := make(chan struct{})
+	slowClient.EXPECT().GetMetaInfo(namespace, gomock.Any()).DoAndReturn(
+		func(namespace string, d core.Digest) (*core.MetaInfo, error) {
+			<-release
+			if d == blob1.Digest {
+				return blob1.MetaInfo, nil
+			}
+			return blob2.MetaInfo, nil
+		}).Times(2)
+
+	// The first lookup is hedged, and the hedge is held in flight.
+	hedgeClient.EXPECT().GetMetaInfo(namespace, blob1.Digest).DoAndReturn(
+		func(namespace string, d core.Digest) (*core.MetaInfo, error) {
+			<-release
+			return blob1.MetaInfo, nil
+		})
+
+	errc := make(chan error, 1)
+	go func() {
+		_, err := cc.GetMetaInfo(namespace, blob1.Digest)
+		errc <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	// The second lookup exceeds the cap, so it waits on the slow origin.
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		close(release)
+	}()
+	mi, err := cc.GetMetaInfo(namespace, blob2.Digest)
+	require.NoError(err)
+	require.Equal(blob2.MetaInfo, mi)
+	require.NoError(<-errc)
+}
+
+func TestClusterClientSkipsUnhealthyOriginUntilCooldown(t *testing.T) {
+	require := require.New(t)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	clk := clock.NewMock()
+	mockResolver := mockblobclient.NewMockClientResolver(ctrl)
+
+	cc := blobclient.NewClusterClient(mockResolver, blobclient.WithHealthTracking(blobclient.HealthConfig{
+		Enabled:      true,
+		Window:       time.Minute,
+		MinRequests:  3,
+		MaxErrorRate: 0.5,
+		Cooldown:     30 * time.Second,
+	}, clk))
+
+	blob := core.SizedBlobFixture(256, 8)
+	namespace := core.TagFixture()
+
+	badClient := mockblobclient.NewMockClient(ctrl)
+	goodClient := mockblobclient.NewMockClient(ctrl)
+	badClient.EXPECT().Addr().Return("bad:80").AnyTimes()
+	goodClient.EXPECT().Addr().Return("good:80").AnyTimes()
+	mockResolver.EXPECT().Resolve(blob.Digest).Return(
+		[]blobclient.Client{badClient, goodClient}, nil).AnyTimes()
+
+	// Failures on the preferred origin are retried on the next origin until the
+	// preferred origin is demoted.
+	badClient.EXPECT().GetMetaInfo(namespace, blob.Digest).Return(
+		nil, httputil.StatusError{Status: 500}).Times(3)
+	goodClient.EXPECT().GetMetaInfo(namespace, blob.Digest).Return(blob.MetaInfo, nil).Times(3)
+	for i := 0; i < 3; i++ {
+		_, err := cc.GetMetaInfo(namespace, blob.Digest)
+		require.NoError(err)
+	}
+
+	// The demoted origin is skipped in favor of the healthy one.
+	goodClient.EXPECT().GetMetaInfo(namespace, blob.Digest).Return(blob.MetaInfo, nil).Times(2)
+	for i := 0; i < 2; i++ {
+		mi, err := cc.GetMetaInfo(namespace, blob.Digest)
+		require.NoError(err)
+		require.Equal(blob.MetaInfo, mi)
+	}
+
+	// Once the cooldown elapses, the demoted origin is probed again.
+	clk.Add(31 * time.Second)
+	badClient.EXPECT().GetMetaInfo(namespace, blob.Digest).Return(blob.MetaInfo, nil)
+	mi, err := cc.GetMetaInfo(namespace, blob.Digest)
+	require.NoError(err)
+	require.Equal(blob.MetaInfo, mi)
+}
+
+func TestClusterClientPullableOriginsExcludesColdOrigins(t *testing.T) {
+	require := require.New(t)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockResolver := mockblobclient.NewMockClientResolver(ctrl)
+
+	cc := blobclient.NewClusterClient(mockResolver)
+
+	d := core.DigestFixture()
+	namespace := core.TagFixture()
+
+	var clients []blobclient.Client
+	for _, test := range []struct {
+		addr         string
+		availability blobclient.BlobAvailability
+		err          error
+	}{
+		{master1, blobclient.BlobCold, nil},
+		{master2, blobclient.BlobAvailable, nil},
+		{master3, blobclient.BlobWarming, nil},
+		{"unavailable-origin:80", blobclient.BlobCold, errors.New("some error")},
+	} {
+		c := mockblobclient.NewMockClient(ctrl)
+		c.EXPECT().Addr().Return(test.addr).AnyTimes()
+		c.EXPECT().CheckAvailability(namespace, d).Return(test.availability, test.err)
+		clients = append(clients, c)
+	}
+	mockResolver.EXPECT().Resolve(d).Return(clients, nil)
+
+	addrs, backendFetch, err := cc.PullableOrigins(namespace, d)
+	require.NoError(err)
+	require.False(backendFetch)
+	require.Equal([]string{master2, master3}, addrs)
+}
+
+func TestClusterClientPullableOriginsRequiresBackendFetchWhenAllCold(t *testing.T) {
+	require := require.New(t)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockResolver := mockblobclient.NewMockClientResolver(ctrl)
+
+	cc := blobclient.NewClusterClient(mockResolver)
+
+	d := core.DigestFixture()
+	namespace := core.TagFixture()
+
+	var clients []blobclient.Client
+	for _, addr := range []string{master1, master2} {
+		c := mockblobclient.NewMockClient(ctrl)
+		c.EXPECT().Addr().Return(addr).AnyTimes()
+		c.EXPECT().CheckAvailability(namespace, d).Return(blobclient.BlobCold, nil)
+		clients = append(clients, c)
+	}
+	mockResolver.EXPECT().Resolve(d).Return(clients, nil)
+
+	addrs, backendFetch, err := cc.PullableOrigins(namespace, d)
+	require.NoError(err)
+	require.True(backendFetch)
+	require.Equal([]string{master1, master2}, addrs)
+}
+
+func strictReadPolicy(t *testing.T) *blobclient.ReadPolicy {
+	p, err := blobclient.ReadPolicyConfig{
+		Rules: []blobclient.ReadRule{{
+			Namespace: "^strict/",
+			Sources: []blobclient.ReadSource{
+				{Source: blobclient.ReadSourceCached, Budget: 50 * time.Millisecond},
+				{Source: blobclient.ReadSourcePrimary, Budget: 50 * time.Millisecond},
+				{Source: blobclient.ReadSourceReplica, Budget: time.Second},
+			},
+		}},
+	}.Build()
+	require.NoError(t, err)
+	return p
+}
+
+func TestClusterClientStrictReadPolicyAbandonsSlowOrigin(t *testing.T) {
+	require := require.New(t)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockResolver := mockblobclient.NewMockClientResolver(ctrl)
+
+	cc := blobclient.NewClusterClient(mockResolver, blobclient.WithReadPolicy(strictReadPolicy(t)))
+
+	blob := core.SizedBlobFixture(256, 8)
+	namespace := "strict/repo"
+
+	slowClient := mockblobclient.NewMockClient(ctrl)
+	fastClient := mockblobclient.NewMockClient(ctrl)
+	mockResolver.EXPECT().Resolve(blob.Digest).Return(
+		[]blobclient.Client{slowClient, fastClient}, nil)
+
+	release := make(chan struct{})
+	defer close(release)
+
+	slowClient.EXPECT().Addr().Return("slow").AnyTimes()
+	fastClient.EXPECT().Addr().Return("fast").AnyTimes()
+	slowClient.EXPECT().CheckAvailability(namespace, blob.Digest).Return(blobclient.BlobCold, nil)
+	fastClient.EXPECT().CheckAvailability(namespace, blob.Digest).Return(blobclient.BlobCold, nil)
+	slowClient.EXPECT().DownloadBlob(namespace, blob.Digest, gomock.Any()).DoAndReturn(
+		func(namespace string, d core.Digest, dst io.Writer) error {
+			<-release
+			_, err := dst.Write([]byte("slow origin should have been abandoned"))
+			return err
+		})
+	fastClient.EXPECT().DownloadBlob(namespace, blob.Digest, gomock.Any()).DoAndReturn(
+		func(namespace string, d core.Digest, dst io.Writer) error {
+			_, err := dst.Write(blob.Content)
+			return err
+		})
+
+	start := time.Now()
+	var b bytes.Buffer
+	require.NoError(cc.DownloadBlob(namespace, blob.Digest, &b))
+	require.True(time.Since(start) < time.Second)
+	require.Equal(blob.Content, b.Bytes())
+}
+
+func TestClusterClientStrictReadPolicyCancelsAbandonedOrigin(t *testing.T) {
+	require := require.New(t)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockResolver := mockblobclient.NewMockClientResolver(ctrl)
+
+	p, err := blobclient.ReadPolicyConfig{
+		Rules: []blobclient.ReadRule{{
+			Namespace: "^strict/",
+			Sources: []blobclient.ReadSource{
+				{Source: blobclient.ReadSourcePrimary, Budget: 50 * time.Millisecond},
+				{Source: blobclient.ReadSourceReplica},
+			},
+		}},
+	}.Build()
+	require.NoError(err)
+	cc := blobclient.NewClusterClient(mockResolver, blobclient.WithReadPolicy(p))
+
+	blob := core.SizedBlobFixture(256, 8)
+	namespace := "strict/repo"
+
+	cancelled := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+			close(cancelled)
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	defer slow.Close()
+
+	fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(blob.Content)
+	}))
+	defer fast.Close()
+
+	mockResolver.EXPECT().Resolve(blob.Digest).Return([]blobclient.Client{
+		blobclient.New(strings.TrimPrefix(slow.URL, "http://")),
+		blobclient.New(strings.TrimPrefix(fast.URL, "http://")),
+	}, nil)
+
+	var b bytes.Buffer
+	require.NoError(cc.DownloadBlob(namespace, blob.Digest, &b))
+	require.Equal(blob.Content, b.Bytes())
+
+	select {
+	case <-cancelled:
+	case <-time.After(time.Second):
+		require.FailNow("abandoned download not cancelled")
+	}
+}
+
+func TestClusterClientStrictReadPolicyHedgesSlowOrigin(t *testing.T) {
+	require := require.New(t)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockResolver := mockblobclient.NewMockClientResolver(ctrl)
+
+	cc := blobclient.NewClusterClient(
+		mockResolver,
+		blobclient.WithReadPolicy(strictReadPolicy(t)),
+		blobclient.WithHedging(blobclient.HedgeConfig{
+			Enabled:     true,
+			Delay:       time.Minute,
+			MaxInflight: 1,
+		}))
+
+	blob := core.SizedBlobFixture(256, 8)
+	namespace := "strict/repo"
+
+	slowClient := mockblobclient.NewMockClient(ctrl)
+	hedgeClient := mockblobclient.NewMockClient(ctrl)
+	mockResolver.EXPECT().Resolve(blob.Digest).Return(
+		[]blobclient.Client{slowClient, hedgeClient}, nil)
+
+	release := make(chan struct{})
+	defer close(release)
+
+	slowClient.EXPECT().Addr().Return("slow").AnyTimes()
+	hedgeClient.EXPECT().Addr().Return("hedge").AnyTimes()
+	slowClient.EXPECT().CheckAvailability(namespace, blob.Digest).Return(blobclient.BlobCold, nil)
+	hedgeClient.EXPECT().CheckAvailability(namespace, blob.Digest).Return(blobclient.BlobCold, nil)
+
+	// The primary exceeds its budget, but keeps racing the hedged replica and
+	// starts serving first.
+	slowClient.EXPECT().DownloadBlob(namespace, blob.Digest, gomock.Any()).DoAndReturn(
+		func(namespace string, d core.Digest, dst io.Writer) error {
+			time.Sleep(150 * time.Millisecond)
+			_, err := dst.Write(blob.Content)
+			return err
+		})
+	hedgeClient.EXPECT().DownloadBlob(namespace, blob.Digest, gomock.Any()).DoAndReturn(
+		func(namespace string, d core.Digest, dst io.Writer) error {
+			<-release
+			_, err := dst.Write([]byte("hedged replica should have been cut off"))
+			return err
+		})
+
+	var b bytes.Buffer
+	require.NoError(cc.DownloadBlob(namespace, blob.Digest, &b))
+	require.Equal(blob.Content, b.Bytes())
+}
+
+func TestClusterClientStrictReadPolicyPrefersCachedOrigin(t *testing.T) {
+	require := require.New(t)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockResolver := mockblobclient.NewMockClientResolver(ctrl)
+
+	cc := blobclient.NewClusterClient(mockResolver, blobclient.WithReadPolicy(strictReadPolicy(t)))
+
+	blob := core.SizedBlobFixture(256, 8)
+	namespace := "strict/repo"
+
+	coldClient := mockblobclient.NewMockClient(ctrl)
+	cachedClient := mockblobclient.NewMockClient(ctrl)
+	mockResolver.EXPECT().Resolve(blob.Digest).Return(
+		[]blobclient.Client{coldClient, cachedClient}, nil)
+
+	cachedClient.EXPECT().Addr().Return("cached").AnyTimes()
+	coldClient.EXPECT().CheckAvailability(namespace, blob.Digest).Return(blobclient.BlobCold, nil)
+	cachedClient.EXPECT().CheckAvailability(namespace, blob.Digest).Return(
+		blobclient.BlobAvailable, nil)
+	cachedClient.EXPECT().DownloadBlob(namespace, blob.Digest, gomock.Any()).DoAndReturn(
+		func(namespace string, d core.Digest, dst io.Writer) error {
+			_, err := dst.Write(blob.Content)
+			return err
+		})
+
+	var b bytes.Buffer
+	require.NoError(cc.DownloadBlob(namespace, blob.Digest, &b))
+	require.Equal(blob.Content, b.Bytes())
+}
+
+func TestClusterClientReadPolicyUnmatchedNamespaceWaitsForSlowOrigin(t *testing.T) {
+	require := require.New(t)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockResolver := mockblobclient.NewMockClientResolver(ctrl)
+
+	cc := blobclient.NewClusterClient(mockResolver, blobclient.WithReadPolicy(strictReadPolicy(t)))
+
+	blob := core.SizedBlobFixture(256, 8)
+	namespace := "besteffort/repo"
+
+	slowClient := mockblobclient.NewMockClient(ctrl)
+	otherClient := mockblobclient.NewMockClient(ctrl)
+	mockResolver.EXPECT().Resolve(blob.Digest).Return(
+		[]blobclient.Client{slowClient, otherClient}, nil)
+
+	slowClient.EXPECT().DownloadBlob(namespace, blob.Digest, gomock.Any()).DoAndReturn(
+		func(namespace string, d core.Digest, dst io.Writer) error {
+			time.Sleep(200 * time.Millisecond)
+			_, err := dst.Write(blob.Content)
+			return err
+		})
+
+	var b bytes.Buffer
+	require.NoError(cc.DownloadBlob(namespace, blob.Digest, &b))
+	require.Equal(blob.Content, b.Bytes())
+}
+
+func TestReadPolicyConfigBuildRejectsInvalidSource(t *testing.T) {
+	_, err := blobclient.ReadPolicyConfig{
+		Rules: []blobclient.ReadRule{{
+			Namespace: ".*",
+			Sources:   []blobclient.ReadSource{{Source: "backend"}},
+		}},
+	}.Build()
+	require.Error(t, err)
+}
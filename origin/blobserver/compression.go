@@ -0,0 +1,128 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package blobserver
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/c2h5oh/datasize"
+)
+
+// CompressionConfig defines gzip transfer compression of blob downloads for
+// clients which send "Accept-Encoding: gzip". Only the transfer is compressed:
+// the stored blob, and thus its digest, remain those of the original bytes.
+type CompressionConfig struct {
+	Enabled bool `yaml:"enabled"`
+
+	// Level is the gzip compression level.
+	Level int `yaml:"level"`
+
+	// SampleSize is how much of the head of a blob is trial-compressed to
+	// detect whether the blob is compressible.
+	SampleSize datasize.ByteSize `yaml:"sample_size"`
+
+	// MaxRatio is the compressed to original size ratio of the sample above
+	// which the blob is considered incompressible and sent as-is.
+	MaxRatio float64 `yaml:"max_ratio"`
+}
+
+func (c CompressionConfig) applyDefaults() CompressionConfig {
+	if c.Level == 0 {
+		c.Level = gzip.BestSpeed
+	}
+	if c.SampleSize == 0 {
+		c.SampleSize = 64 * datasize.KB
+	}
+	if c.MaxRatio == 0 {
+		c.MaxRatio = 0.9
+	}
+	return c
+}
+
+// acceptsGzip returns true if r accepts a gzip content encoding.
+func acceptsGzip(r *http.Request) bool {
+	for _, v := range r.Header["Accept-Encoding"] {
+		for _, enc := range strings.Split(v, ",") {
+			parts := strings.Split(strings.TrimSpace(enc), ";")
+			if strings.TrimSpace(parts[0]) != "gzip" {
+				continue
+			}
+			for _, p := range parts[1:] {
+				p = strings.TrimSpace(p)
+				if strings.HasPrefix(p, "q=") {
+					if q, err := strconv.ParseFloat(p[2:], 64); err == nil && q == 0 {
+						return false
+					}
+				}
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// compressible trial-compresses the head of src and returns whether it is worth
+// compressing, along with a reader which replays the full contents of src.
+func (c CompressionConfig) compressible(src io.Reader) (io.Reader, bool, error) {
+	sample := make([]byte, int64(c.SampleSize))
+	n, err := io.ReadFull(src, sample)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, false, fmt.Errorf("read sample: %s", err)
+	}
+	sample = sample[:n]
+	replay := io.MultiReader(bytes.NewReader(sample), src)
+	if n == 0 {
+		return replay, false, nil
+	}
+	var cw countingWriter
+	gw, err := gzip.NewWriterLevel(&cw, c.Level)
+	if err != nil {
+		return nil, false, fmt.Errorf("gzip writer: %s", err)
+	}
+	if _, err := gw.Write(sample); err != nil {
+		return nil, false, fmt.Errorf("compress sample: %s", err)
+	}
+	if err := gw.Close(); err != nil {
+		return nil, false, fmt.Errorf("compress sample: %s", err)
+	}
+	return replay, float64(cw.n)/float64(n) <= c.MaxRatio, nil
+}
+
+// copyCompressed writes src to w as a gzip encoded response.
+func (c CompressionConfig) copyCompressed(w http.ResponseWriter, src io.Reader) error {
+	w.Header().Set("Content-Encoding", "gzip")
+	gw, err := gzip.NewWriterLevel(w, c.Level)
+	if err != nil {
+		return fmt.Errorf("gzip writer: %s", err)
+	}
+	if _, err := io.Copy(gw, src); err != nil {
+		return err
+	}
+	return gw.Close()
+}
+
+type countingWriter struct {
+	n int64
+}
+
+func (w *countingWriter) Write(b []byte) (int, error) {
+	w.n += int64(len(b))
+	return len(b), nil
+}
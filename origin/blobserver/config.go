@@ -17,17 +17,82 @@ import (
 	"time"
 
 	"github.com/uber/kraken/utils/listener"
+	"github.com/uber/kraken/utils/syncutil"
 )
 
 // Config defines the configuration used by Origin cluster for hashing blob digests.
 type Config struct {
-	Listener                  listener.Config `yaml:"listener"`
-	DuplicateWriteBackStagger time.Duration   `yaml:"duplicate_write_back_stagger"`
+	Listener                  listener.Config   `yaml:"listener"`
+	DuplicateWriteBackStagger time.Duration     `yaml:"duplicate_write_back_stagger"`
+	Compression               CompressionConfig `yaml:"compression"`
+	Broadcast                 BroadcastConfig   `yaml:"broadcast"`
+	MemoryTier                MemoryTierConfig  `yaml:"memory_tier"`
+	WarmList                  WarmListConfig    `yaml:"warm_list"`
+
+	// Verification bounds the concurrency of upload verification, which is
+	// shared fairly across namespaces.
+	Verification VerificationConfig `yaml:"verification"`
+
+	// PartialCache caches the byte ranges of blobs read via range requests.
+	PartialCache PartialCacheConfig `yaml:"partial_cache"`
+
+	// Eviction defines eviction of blobs no longer referenced by any tag.
+	Eviction EvictionConfig `yaml:"eviction"`
+
+	// ClientLimit bounds the concurrent downloads of each client.
+	ClientLimit ClientLimitConfig `yaml:"client_limit"`
+
+	// Fanout bounds the goroutines replicating blobs to other origins.
+	Fanout syncutil.FanoutConfig `yaml:"fanout"`
+
+	// ConditionalUpload enables If-None-Match on streamed uploads, such that
+	// uploads of blobs which the owning origin already has are not transferred.
+	ConditionalUpload bool `yaml:"conditional_upload"`
+
+	// Assembly enables serving blobs assembled from chunk manifests.
+	Assembly AssemblyConfig `yaml:"assembly"`
+
+	// Preverify defines verification of stored blobs on startup.
+	Preverify PreverifyConfig `yaml:"preverify"`
+
+	// VerificationCache skips re-verifying blobs on serve which were verified
+	// recently.
+	VerificationCache VerificationCacheConfig `yaml:"verification_cache"`
+
+	// SignedRedirect redirects downloads of large cold blobs to the backend.
+	SignedRedirect SignedRedirectConfig `yaml:"signed_redirect"`
+}
+
+// BroadcastConfig defines warming of sibling origins. When enabled, an origin
+// which fetches a blob from the backend notifies the other origins owning the
+// blob, which then pull it from the fetching origin. Broadcasts are best-effort
+// and never block serving the blob.
+type BroadcastConfig struct {
+	Enabled bool `yaml:"enabled"`
+
+	// PullRPS and PullBurst limit the rate at which an origin starts pulls in
+	// response to broadcasts. Broadcasts exceeding the limit are dropped.
+	PullRPS   float64 `yaml:"pull_rps"`
+	PullBurst int     `yaml:"pull_burst"`
+}
+
+func (c BroadcastConfig) applyDefaults() BroadcastConfig {
+	if c.PullRPS == 0 {
+		c.PullRPS = 10
+	}
+	if c.PullBurst == 0 {
+		c.PullBurst = 10
+	}
+	return c
 }
 
 func (c Config) applyDefaults() Config {
 	if c.DuplicateWriteBackStagger == 0 {
 		c.DuplicateWriteBackStagger = 30 * time.Minute
 	}
+	c.Compression = c.Compression.applyDefaults()
+	c.Broadcast = c.Broadcast.applyDefaults()
+	c.Assembly = c.Assembly.applyDefaults()
+	c.SignedRedirect = c.SignedRedirect.applyDefaults()
 	return c
 }
@@ -0,0 +1,131 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package blobserver
+
+import (
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/utils/handler"
+	"github.com/uber/kraken/utils/httputil"
+	"github.com/uber/kraken/utils/log"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/uber-go/tally"
+)
+
+// EvictionConfig defines eviction of blobs which are no longer referenced by
+// any tag. Build-index marks such blobs as eviction candidates, which are
+// evicted from disk once the grace period has elapsed. Since origins are a
+// cache in front of the backend, evicted blobs are re-fetched on demand.
+type EvictionConfig struct {
+	// GracePeriod is how long candidates are kept, such that in-flight
+	// downloads of them may complete.
+	GracePeriod time.Duration `yaml:"grace_period"`
+}
+
+func (c EvictionConfig) applyDefaults() EvictionConfig {
+	if c.GracePeriod == 0 {
+		c.GracePeriod = 10 * time.Minute
+	}
+	return c
+}
+
+// evictionCandidates tracks blobs pending eviction.
+type evictionCandidates struct {
+	config EvictionConfig
+	stats  tally.Scope
+	clk    clock.Clock
+	evict  func(core.Digest) error
+
+	mu      sync.Mutex
+	pending map[core.Digest]*clock.Timer
+}
+
+func newEvictionCandidates(
+	config EvictionConfig,
+	stats tally.Scope,
+	clk clock.Clock,
+	evict func(core.Digest) error) *evictionCandidates {
+
+	return &evictionCandidates{
+		config:  config.applyDefaults(),
+		stats:   stats.SubScope("eviction"),
+		clk:     clk,
+		evict:   evict,
+		pending: make(map[core.Digest]*clock.Timer),
+	}
+}
+
+// mark schedules d for eviction after the grace period. Marking a pending
+// candidate again does not extend its grace period.
+func (e *evictionCandidates) mark(d core.Digest) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if _, ok := e.pending[d]; ok {
+		return
+	}
+	e.pending[d] = e.clk.AfterFunc(e.config.GracePeriod, func() {
+		e.mu.Lock()
+		delete(e.pending, d)
+		e.mu.Unlock()
+
+		if err := e.evict(d); err != nil {
+			if os.IsNotExist(err) {
+				return
+			}
+			e.stats.Counter("errors").Inc(1)
+			log.With("digest", d).Errorf("Error evicting unreferenced blob: %s", err)
+			return
+		}
+		e.stats.Counter("evicted").Inc(1)
+	})
+	e.stats.Counter("marked").Inc(1)
+}
+
+// isPending returns true if d is pending eviction.
+func (e *evictionCandidates) isPending(d core.Digest) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	_, ok := e.pending[d]
+	return ok
+}
+
+// markEvictionCandidateHandler schedules a blob which is no longer referenced
+// by any tag for eviction.
+func (s *Server) markEvictionCandidateHandler(w http.ResponseWriter, r *http.Request) error {
+	d, err := httputil.ParseDigest(r, "digest")
+	if err != nil {
+		return err
+	}
+	if ok, err := blobExists(s.cas, d); err != nil {
+		return handler.Errorf("check blob: %s", err)
+	} else if !ok {
+		return handler.ErrorStatus(http.StatusNotFound)
+	}
+	s.evictions.mark(d)
+	w.WriteHeader(http.StatusAccepted)
+	return nil
+}
+
+// evictBlob deletes the blob of d from disk and memory.
+func (s *Server) evictBlob(d core.Digest) error {
+	defer s.memoryTier.evict(d)
+	return s.cas.DeleteCacheFile(d.Hex())
+}
@@ -0,0 +1,67 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package blobserver
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/origin/blobclient"
+	"github.com/uber/kraken/utils/httputil"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMarkEvictionCandidateEvictsBlobAfterGracePeriod(t *testing.T) {
+	require := require.New(t)
+
+	cp := newTestClientProvider()
+
+	config := Config{Eviction: EvictionConfig{GracePeriod: time.Minute}}
+	s := newTestServerWithConfig(t, config, master1, hashRingMaxReplica(), cp)
+	defer s.cleanup()
+
+	client := cp.Provide(s.host)
+
+	blob := core.NewBlobFixture()
+	namespace := core.TagFixture()
+
+	require.NoError(client.TransferBlob(blob.Digest, bytes.NewReader(blob.Content)))
+
+	require.NoError(client.MarkEvictionCandidate(blob.Digest))
+	require.True(s.server.evictions.isPending(blob.Digest))
+
+	// The blob is still served during the grace period.
+	ensureHasBlob(t, client, namespace, blob)
+
+	s.clk.Add(time.Minute)
+
+	require.False(s.server.evictions.isPending(blob.Digest))
+	_, err := client.StatLocal(namespace, blob.Digest)
+	require.Equal(blobclient.ErrBlobNotFound, err)
+}
+
+func TestMarkEvictionCandidateNotFound(t *testing.T) {
+	require := require.New(t)
+
+	cp := newTestClientProvider()
+
+	s := newTestServer(t, master1, hashRingMaxReplica(), cp)
+	defer s.cleanup()
+
+	err := cp.Provide(s.host).MarkEvictionCandidate(core.DigestFixture())
+	require.True(httputil.IsNotFound(err))
+}
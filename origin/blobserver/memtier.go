@@ -0,0 +1,222 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package blobserver
+
+import (
+	"bytes"
+	"container/list"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sync"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/store"
+
+	"github.com/c2h5oh/datasize"
+	"github.com/uber-go/tally"
+)
+
+// MemoryTierConfig defines an in-memory cache tier in front of the disk cache.
+// Small blobs which are downloaded repeatedly are promoted into memory, and
+// evicted back to disk-only in least-recently-used order.
+type MemoryTierConfig struct {
+	Enabled bool `yaml:"enabled"`
+
+	// Size bounds the total size of blobs held in memory.
+	Size datasize.ByteSize `yaml:"size"`
+
+	// MaxBlobSize is the size above which blobs are never promoted.
+	MaxBlobSize datasize.ByteSize `yaml:"max_blob_size"`
+
+	// PromoteAfter is the number of downloads from disk after which a blob is
+	// promoted.
+	PromoteAfter int `yaml:"promote_after"`
+}
+
+func (c MemoryTierConfig) applyDefaults() MemoryTierConfig {
+	if c.Size == 0 {
+		c.Size = 256 * datasize.MB
+	}
+	if c.MaxBlobSize == 0 {
+		c.MaxBlobSize = datasize.MB
+	}
+	if c.PromoteAfter == 0 {
+		c.PromoteAfter = 2
+	}
+	return c
+}
+
+// _maxTrackedAccesses bounds the access counts kept for blobs not yet promoted.
+const _maxTrackedAccesses = 10000
+
+type memoryEntry struct {
+	d    core.Digest
+	blob []byte
+}
+
+// memoryTier holds the hottest small blobs in memory. Blobs deleted from disk,
+// either by the blob server or by cache cleanup, are evicted from memory. A nil
+// memoryTier always reads from disk.
+type memoryTier struct {
+	config MemoryTierConfig
+	stats  tally.Scope
+
+	mu       sync.Mutex
+	lru      *list.List
+	entries  map[core.Digest]*list.Element
+	size     int64
+	accesses map[core.Digest]int
+
+	memoryHits int64
+	diskHits   int64
+}
+
+func newMemoryTier(config MemoryTierConfig, stats tally.Scope) *memoryTier {
+	if !config.Enabled {
+		return nil
+	}
+	return &memoryTier{
+		config:   config.applyDefaults(),
+		stats:    stats.SubScope("memory_tier"),
+		lru:      list.New(),
+		entries:  make(map[core.Digest]*list.Element),
+		accesses: make(map[core.Digest]int),
+	}
+}
+
+// reader returns a reader of the blob of d. Blobs which are not in memory are
+// read from disk via open, and are promoted once accessed often enough.
+//
+// Blobs served from memory are still opened on disk, without being read, which
+// refreshes their access time such that cache cleanup does not consider hot
+// blobs idle, and detects blobs which cleanup deleted since.
+func (t *memoryTier) reader(
+	d core.Digest, open func() (store.FileReader, error)) (io.ReadCloser, error) {
+
+	if t == nil {
+		return open()
+	}
+	if blob, ok := t.get(d); ok {
+		f, err := open()
+		if err == nil {
+			f.Close()
+			t.mu.Lock()
+			t.hit(&t.memoryHits, "memory")
+			t.mu.Unlock()
+			return ioutil.NopCloser(bytes.NewReader(blob)), nil
+		}
+		if !os.IsNotExist(err) {
+			return nil, err
+		}
+		t.evict(d)
+		t.stats.Counter("cleanup_evictions").Inc(1)
+		return nil, err
+	}
+	f, err := open()
+	if err != nil {
+		return nil, err
+	}
+	if !t.access(d, f.Size()) {
+		return f, nil
+	}
+	defer f.Close()
+	blob, err := ioutil.ReadAll(f)
+	if err != nil {
+		return nil, fmt.Errorf("read blob into memory: %s", err)
+	}
+	t.add(d, blob)
+	return ioutil.NopCloser(bytes.NewReader(blob)), nil
+}
+
+func (t *memoryTier) get(d core.Digest) ([]byte, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	e, ok := t.entries[d]
+	if !ok {
+		return nil, false
+	}
+	t.lru.MoveToFront(e)
+	return e.Value.(*memoryEntry).blob, true
+}
+
+// access records a disk read of d, and returns whether d should be promoted.
+func (t *memoryTier) access(d core.Digest, size int64) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.hit(&t.diskHits, "disk")
+	if size > int64(t.config.MaxBlobSize) || size > int64(t.config.Size) {
+		return false
+	}
+	if len(t.accesses) >= _maxTrackedAccesses {
+		t.accesses = make(map[core.Digest]int)
+	}
+	t.accesses[d]++
+	return t.accesses[d] >= t.config.PromoteAfter
+}
+
+func (t *memoryTier) add(d core.Digest, blob []byte) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	delete(t.accesses, d)
+	if _, ok := t.entries[d]; ok {
+		return
+	}
+	for t.size+int64(len(blob)) > int64(t.config.Size) {
+		t.remove(t.lru.Back())
+		t.stats.Counter("evictions").Inc(1)
+	}
+	t.entries[d] = t.lru.PushFront(&memoryEntry{d, blob})
+	t.size += int64(len(blob))
+	t.stats.Counter("promotions").Inc(1)
+	t.stats.Gauge("bytes").Update(float64(t.size))
+}
+
+// evict removes d from memory, e.g. once it is deleted from disk.
+func (t *memoryTier) evict(d core.Digest) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if e, ok := t.entries[d]; ok {
+		t.remove(e)
+	}
+	delete(t.accesses, d)
+}
+
+func (t *memoryTier) remove(e *list.Element) {
+	entry := t.lru.Remove(e).(*memoryEntry)
+	delete(t.entries, entry.d)
+	t.size -= int64(len(entry.blob))
+	t.stats.Gauge("bytes").Update(float64(t.size))
+}
+
+// hit records a hit of tier, and updates the hit ratios of both tiers. Must be
+// called with t.mu held.
+func (t *memoryTier) hit(count *int64, tier string) {
+	*count++
+	t.stats.Tagged(map[string]string{"tier": tier}).Counter("hits").Inc(1)
+
+	total := float64(t.memoryHits + t.diskHits)
+	t.stats.Tagged(map[string]string{"tier": "memory"}).Gauge("hit_ratio").Update(
+		float64(t.memoryHits) / total)
+	t.stats.Tagged(map[string]string{"tier": "disk"}).Gauge("hit_ratio").Update(
+		float64(t.diskHits) / total)
+}
@@ -0,0 +1,200 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package blobserver
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/store"
+
+	"github.com/c2h5oh/datasize"
+	"github.com/stretchr/testify/require"
+	"github.com/uber-go/tally"
+)
+
+// countingOpener opens blobs from cas and counts the blobs read from disk.
+type countingOpener struct {
+	cas   *store.CAStore
+	opens int
+}
+
+func (o *countingOpener) open(d core.Digest) func() (store.FileReader, error) {
+	return func() (store.FileReader, error) {
+		f, err := o.cas.GetCacheFileReader(d.Hex())
+		if err != nil {
+			return nil, err
+		}
+		return &diskReadCounter{f, o, false}, nil
+	}
+}
+
+// diskReadCounter counts the first read of a blob as a disk read.
+type diskReadCounter struct {
+	store.FileReader
+	o    *countingOpener
+	read bool
+}
+
+func (r *diskReadCounter) Read(p []byte) (int, error) {
+	if !r.read {
+		r.read = true
+		r.o.opens++
+	}
+	return r.FileReader.Read(p)
+}
+
+func readTier(t *testing.T, tier *memoryTier, o *countingOpener, d core.Digest) []byte {
+	r, err := tier.reader(d, o.open(d))
+	require.NoError(t, err)
+	defer r.Close()
+	b, err := ioutil.ReadAll(r)
+	require.NoError(t, err)
+	return b
+}
+
+func TestMemoryTierServesPromotedBlobWithoutDiskReads(t *testing.T) {
+	require := require.New(t)
+
+	cas, cleanup := store.CAStoreFixture()
+	defer cleanup()
+
+	blob := core.SizedBlobFixture(256, 8)
+	require.NoError(cas.CreateCacheFile(blob.Digest.Hex(), bytes.NewReader(blob.Content)))
+
+	tier := newMemoryTier(MemoryTierConfig{Enabled: true, PromoteAfter: 2}, tally.NoopScope)
+	o := &countingOpener{cas: cas}
+
+	// Promoted on the second access.
+	for i := 0; i < 2; i++ {
+		require.Equal(blob.Content, readTier(t, tier, o, blob.Digest))
+	}
+	require.Equal(2, o.opens)
+
+	for i := 0; i < 10; i++ {
+		require.Equal(blob.Content, readTier(t, tier, o, blob.Digest))
+	}
+	require.Equal(2, o.opens)
+}
+
+func TestMemoryTierDoesNotPromoteLargeBlobs(t *testing.T) {
+	require := require.New(t)
+
+	cas, cleanup := store.CAStoreFixture()
+	defer cleanup()
+
+	blob := core.SizedBlobFixture(256, 8)
+	require.NoError(cas.CreateCacheFile(blob.Digest.Hex(), bytes.NewReader(blob.Content)))
+
+	tier := newMemoryTier(MemoryTierConfig{
+		Enabled:      true,
+		MaxBlobSize:  128,
+		PromoteAfter: 1,
+	}, tally.NoopScope)
+	o := &countingOpener{cas: cas}
+
+	for i := 0; i < 3; i++ {
+		require.Equal(blob.Content, readTier(t, tier, o, blob.Digest))
+	}
+	require.Equal(3, o.opens)
+}
+
+func TestMemoryTierEvictsLeastRecentlyUsed(t *testing.T) {
+	require := require.New(t)
+
+	cas, cleanup := store.CAStoreFixture()
+	defer cleanup()
+
+	blob1 := core.SizedBlobFixture(256, 8)
+	blob2 := core.SizedBlobFixture(256, 8)
+	for _, blob := range []*core.BlobFixture{blob1, blob2} {
+		require.NoError(cas.CreateCacheFile(blob.Digest.Hex(), bytes.NewReader(blob.Content)))
+	}
+
+	tier := newMemoryTier(MemoryTierConfig{
+		Enabled:      true,
+		Size:         300 * datasize.B,
+		PromoteAfter: 1,
+	}, tally.NoopScope)
+	o := &countingOpener{cas: cas}
+
+	readTier(t, tier, o, blob1.Digest)
+	readTier(t, tier, o, blob2.Digest)
+	require.Equal(2, o.opens)
+
+	// blob1 was evicted back to disk-only to make room for blob2.
+	require.Equal(blob1.Content, readTier(t, tier, o, blob1.Digest))
+	require.Equal(3, o.opens)
+
+	tier.evict(blob1.Digest)
+	require.Equal(blob1.Content, readTier(t, tier, o, blob1.Digest))
+	require.Equal(4, o.opens)
+}
+
+func TestMemoryTierHitsRefreshAccessTime(t *testing.T) {
+	require := require.New(t)
+
+	config, c := store.CAStoreConfigFixture()
+	defer c()
+	config.Capacity = 2
+	cas, err := store.NewCAStore(config, tally.NoopScope)
+	require.NoError(err)
+	defer cas.Close()
+
+	blob1 := core.SizedBlobFixture(256, 8)
+	blob2 := core.SizedBlobFixture(256, 8)
+	blob3 := core.SizedBlobFixture(256, 8)
+
+	tier := newMemoryTier(MemoryTierConfig{Enabled: true, PromoteAfter: 1}, tally.NoopScope)
+	o := &countingOpener{cas: cas}
+
+	require.NoError(cas.CreateCacheFile(blob1.Digest.Hex(), bytes.NewReader(blob1.Content)))
+	readTier(t, tier, o, blob1.Digest)
+	require.NoError(cas.CreateCacheFile(blob2.Digest.Hex(), bytes.NewReader(blob2.Content)))
+
+	// Serving blob1 from memory makes blob2 the least recently used on disk.
+	readTier(t, tier, o, blob1.Digest)
+	require.Equal(1, o.opens)
+	require.NoError(cas.CreateCacheFile(blob3.Digest.Hex(), bytes.NewReader(blob3.Content)))
+
+	_, err = cas.GetCacheFileStat(blob1.Digest.Hex())
+	require.NoError(err)
+	_, err = cas.GetCacheFileStat(blob2.Digest.Hex())
+	require.True(os.IsNotExist(err))
+}
+
+func TestMemoryTierEvictsBlobsDeletedFromDisk(t *testing.T) {
+	require := require.New(t)
+
+	cas, cleanup := store.CAStoreFixture()
+	defer cleanup()
+
+	blob := core.SizedBlobFixture(256, 8)
+	require.NoError(cas.CreateCacheFile(blob.Digest.Hex(), bytes.NewReader(blob.Content)))
+
+	tier := newMemoryTier(MemoryTierConfig{Enabled: true, PromoteAfter: 1}, tally.NoopScope)
+	o := &countingOpener{cas: cas}
+
+	readTier(t, tier, o, blob.Digest)
+
+	// Deleted by cache cleanup, which does not go through the tier.
+	require.NoError(cas.DeleteCacheFile(blob.Digest.Hex()))
+
+	_, err := tier.reader(blob.Digest, o.open(blob.Digest))
+	require.True(os.IsNotExist(err))
+	require.Equal(int64(0), tier.size)
+}
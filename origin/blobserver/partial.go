@@ -0,0 +1,299 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package blobserver
+
+import (
+	"container/list"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/backend"
+
+	"github.com/c2h5oh/datasize"
+	"github.com/uber-go/tally"
+)
+
+// PartialCacheConfig defines caching of byte ranges of blobs which are not
+// cached in full. Range requests of such blobs are served from the ranges
+// already cached, and the missing ranges are fetched from the backend on
+// demand, without fetching the full blob. Requires backends supporting ranged
+// downloads.
+type PartialCacheConfig struct {
+	Enabled bool `yaml:"enabled"`
+
+	// Dir holds the partially cached blobs. It is cleared on startup, since
+	// cached ranges are only tracked in memory.
+	Dir string `yaml:"dir"`
+
+	// Size bounds the total size of cached ranges. Blobs are evicted in
+	// least-recently-used order.
+	Size datasize.ByteSize `yaml:"size"`
+}
+
+func (c PartialCacheConfig) applyDefaults() PartialCacheConfig {
+	if c.Size == 0 {
+		c.Size = 10 * datasize.GB
+	}
+	return c
+}
+
+// byteRange is the half-open range [start, end).
+type byteRange struct {
+	start, end int64
+}
+
+func (r byteRange) len() int64 {
+	return r.end - r.start
+}
+
+// rangeSet is a sorted set of non-overlapping, non-adjacent ranges.
+type rangeSet []byteRange
+
+// add returns s with r merged into it.
+func (s rangeSet) add(r byteRange) rangeSet {
+	var result rangeSet
+	for _, x := range s {
+		if x.end < r.start || r.end < x.start {
+			result = append(result, x)
+			continue
+		}
+		if x.start < r.start {
+			r.start = x.start
+		}
+		if x.end > r.end {
+			r.end = x.end
+		}
+	}
+	result = append(result, r)
+	sort.Slice(result, func(i, j int) bool { return result[i].start < result[j].start })
+	return result
+}
+
+// missing returns the parts of r which are not in s, in order.
+func (s rangeSet) missing(r byteRange) []byteRange {
+	var gaps []byteRange
+	pos := r.start
+	for _, x := range s {
+		if x.end <= pos {
+			continue
+		}
+		if x.start >= r.end {
+			break
+		}
+		if x.start > pos {
+			gaps = append(gaps, byteRange{pos, x.start})
+		}
+		pos = x.end
+	}
+	if pos < r.end {
+		gaps = append(gaps, byteRange{pos, r.end})
+	}
+	return gaps
+}
+
+// size returns the total length of the ranges in s.
+func (s rangeSet) size() int64 {
+	var n int64
+	for _, x := range s {
+		n += x.len()
+	}
+	return n
+}
+
+type partialBlob struct {
+	d    core.Digest
+	size int64
+	path string
+	elem *list.Element
+
+	// Guards ranges and the file, and serializes fetches of the blob.
+	mu     sync.Mutex
+	ranges rangeSet
+
+	// Number of reads in progress, guarded by the cache lock. Blobs are only
+	// evicted while no read is in progress.
+	readers int
+}
+
+// partialCache caches byte ranges of blobs in sparse files. A nil partialCache
+// caches nothing.
+type partialCache struct {
+	config PartialCacheConfig
+	stats  tally.Scope
+
+	mu     sync.Mutex
+	lru    *list.List
+	blobs  map[core.Digest]*partialBlob
+	cached int64
+}
+
+func newPartialCache(config PartialCacheConfig, stats tally.Scope) (*partialCache, error) {
+	if !config.Enabled {
+		return nil, nil
+	}
+	config = config.applyDefaults()
+	if config.Dir == "" {
+		return nil, errors.New("dir required")
+	}
+	if err := os.RemoveAll(config.Dir); err != nil {
+		return nil, fmt.Errorf("clear dir: %s", err)
+	}
+	if err := os.MkdirAll(config.Dir, 0775); err != nil {
+		return nil, fmt.Errorf("create dir: %s", err)
+	}
+	return &partialCache{
+		config: config,
+		stats:  stats.SubScope("partial_cache"),
+		lru:    list.New(),
+		blobs:  make(map[core.Digest]*partialBlob),
+	}, nil
+}
+
+// acquire returns the tracked blob of d, which must be released once read.
+func (c *partialCache) acquire(d core.Digest, size int64) *partialBlob {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	b, ok := c.blobs[d]
+	if ok {
+		c.lru.MoveToFront(b.elem)
+	} else {
+		b = &partialBlob{d: d, size: size, path: filepath.Join(c.config.Dir, d.Hex())}
+		b.elem = c.lru.PushFront(b)
+		c.blobs[d] = b
+	}
+	b.readers++
+	return b
+}
+
+func (c *partialCache) release(b *partialBlob) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	b.readers--
+}
+
+// size returns the size of d if any of its ranges are cached.
+func (c *partialCache) size(d core.Digest) (int64, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	b, ok := c.blobs[d]
+	if !ok {
+		return 0, false
+	}
+	return b.size, true
+}
+
+// cachedRanges returns the ranges of d which are cached.
+func (c *partialCache) cachedRanges(d core.Digest) rangeSet {
+	c.mu.Lock()
+	b, ok := c.blobs[d]
+	c.mu.Unlock()
+	if !ok {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append(rangeSet(nil), b.ranges...)
+}
+
+// grow accounts n newly cached bytes, and evicts idle blobs in
+// least-recently-used order until the cache fits its size again.
+func (c *partialCache) grow(n int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.cached += n
+	for e := c.lru.Back(); e != nil && c.cached > int64(c.config.Size); {
+		b := e.Value.(*partialBlob)
+		e = e.Prev()
+		if b.readers > 0 {
+			continue
+		}
+		c.lru.Remove(b.elem)
+		delete(c.blobs, b.d)
+		c.cached -= b.ranges.size()
+		if err := os.Remove(b.path); err != nil && !os.IsNotExist(err) {
+			c.stats.Counter("eviction_errors").Inc(1)
+		}
+		c.stats.Counter("evictions").Inc(1)
+	}
+	c.stats.Gauge("size").Update(float64(c.cached))
+}
+
+// offsetWriter writes to f sequentially, starting at offset.
+type offsetWriter struct {
+	f      *os.File
+	offset int64
+}
+
+func (w *offsetWriter) Write(p []byte) (int, error) {
+	n, err := w.f.WriteAt(p, w.offset)
+	w.offset += int64(n)
+	return n, err
+}
+
+// read passes a reader of r of the blob of d, which has the given size, to
+// serve. Missing parts of r are downloaded from client and cached first, such
+// that serve is only called once r is available.
+func (c *partialCache) read(
+	client backend.RangeClient,
+	namespace string,
+	d core.Digest,
+	size int64,
+	r byteRange,
+	serve func(io.Reader) error) error {
+
+	b := c.acquire(d, size)
+	defer c.release(b)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	f, err := os.OpenFile(b.path, os.O_RDWR|os.O_CREATE, 0664)
+	if err != nil {
+		return fmt.Errorf("open: %s", err)
+	}
+	defer f.Close()
+
+	var fetched int64
+	for _, gap := range b.ranges.missing(r) {
+		w := &offsetWriter{f, gap.start}
+		if err := client.DownloadRange(namespace, d.Hex(), gap.start, gap.len(), w); err != nil {
+			return fmt.Errorf("download range %d-%d: %s", gap.start, gap.end-1, err)
+		}
+		if w.offset != gap.end {
+			return fmt.Errorf(
+				"download range %d-%d: expected %d bytes, got %d",
+				gap.start, gap.end-1, gap.len(), w.offset-gap.start)
+		}
+		before := b.ranges.size()
+		b.ranges = b.ranges.add(gap)
+		fetched += b.ranges.size() - before
+	}
+	c.stats.Counter("hit_bytes").Inc(r.len() - fetched)
+	c.stats.Counter("miss_bytes").Inc(fetched)
+
+	if fetched > 0 {
+		c.grow(fetched)
+	}
+	return serve(io.NewSectionReader(f, r.start, r.len()))
+}
@@ -0,0 +1,237 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package blobserver
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/backend/namepath"
+	"github.com/uber/kraken/lib/backend/testfs"
+	"github.com/uber/kraken/utils/testutil"
+
+	"github.com/stretchr/testify/require"
+	"github.com/uber-go/tally"
+)
+
+func TestRangeSetAdd(t *testing.T) {
+	var s rangeSet
+	s = s.add(byteRange{10, 20})
+	s = s.add(byteRange{30, 40})
+	require.Equal(t, rangeSet{{10, 20}, {30, 40}}, s)
+	s = s.add(byteRange{20, 30})
+	require.Equal(t, rangeSet{{10, 40}}, s)
+	s = s.add(byteRange{0, 5})
+	require.Equal(t, rangeSet{{0, 5}, {10, 40}}, s)
+	require.Equal(t, int64(35), s.size())
+}
+
+func TestRangeSetMissing(t *testing.T) {
+	s := rangeSet{{10, 20}, {30, 40}}
+
+	require.Equal(t, []byteRange{{0, 10}}, s.missing(byteRange{0, 15}))
+	require.Equal(t, []byteRange{{20, 30}}, s.missing(byteRange{15, 35}))
+	require.Equal(t, []byteRange{{0, 10}, {20, 30}, {40, 50}}, s.missing(byteRange{0, 50}))
+	require.Empty(t, s.missing(byteRange{12, 18}))
+}
+
+func TestParseRange(t *testing.T) {
+	tests := []struct {
+		header   string
+		expected byteRange
+		ok       bool
+		err      bool
+	}{
+		{"bytes=0-9", byteRange{0, 10}, true, false},
+		{"bytes=90-", byteRange{90, 100}, true, false},
+		{"bytes=-10", byteRange{90, 100}, true, false},
+		{"bytes=50-500", byteRange{50, 100}, true, false},
+		{"bytes=0-1,5-6", byteRange{}, false, false},
+		{"items=0-1", byteRange{}, false, false},
+		{"bytes=100-", byteRange{}, false, true},
+		{"bytes=9-1", byteRange{}, false, true},
+		{"bytes=a-b", byteRange{}, false, true},
+	}
+	for _, test := range tests {
+		t.Run(test.header, func(t *testing.T) {
+			require := require.New(t)
+
+			r, ok, err := parseRange(test.header, 100)
+			if test.err {
+				require.Error(err)
+				return
+			}
+			require.NoError(err)
+			require.Equal(test.ok, ok)
+			require.Equal(test.expected, r)
+		})
+	}
+}
+
+// rangeRecordingClient records the ranges downloaded from the backend.
+type rangeRecordingClient struct {
+	*testfs.Client
+
+	mu     sync.Mutex
+	ranges []byteRange
+}
+
+func (c *rangeRecordingClient) DownloadRange(
+	namespace, name string, offset, length int64, dst io.Writer) error {
+
+	c.mu.Lock()
+	c.ranges = append(c.ranges, byteRange{offset, offset + length})
+	c.mu.Unlock()
+	return c.Client.DownloadRange(namespace, name, offset, length, dst)
+}
+
+func (c *rangeRecordingClient) downloaded() []byteRange {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]byteRange(nil), c.ranges...)
+}
+
+func getRange(
+	t *testing.T, addr, namespace string, d core.Digest, rng string) (int, []byte) {
+
+	req, err := http.NewRequest(
+		"GET", fmt.Sprintf("http://%s/namespace/%s/blobs/%s", addr, namespace, d), nil)
+	require.NoError(t, err)
+	req.Header.Set("Range", rng)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return resp.StatusCode, b
+}
+
+func TestPartialCacheServesRangesWithoutFetchingFullBlob(t *testing.T) {
+	require := require.New(t)
+
+	dir, err := ioutil.TempDir("", "partial")
+	require.NoError(err)
+	defer os.RemoveAll(dir)
+
+	fs := testfs.NewServer()
+	defer fs.Cleanup()
+	fsAddr, stop := testutil.StartServer(fs.Handler())
+	defer stop()
+
+	fsClient, err := testfs.NewClient(testfs.Config{Addr: fsAddr, NamePath: namepath.Identity})
+	require.NoError(err)
+	client := &rangeRecordingClient{Client: fsClient}
+
+	config := Config{PartialCache: PartialCacheConfig{Enabled: true, Dir: dir}}
+	s := newTestServerWithConfig(t, config, master1, hashRingNoReplica(), newTestClientProvider())
+	defer s.cleanup()
+
+	namespace := "partial"
+	require.NoError(s.backendManager.Register(namespace, client))
+
+	blob := core.SizedBlobFixture(1000, 100)
+	require.NoError(client.Upload(namespace, blob.Digest.Hex(), bytes.NewReader(blob.Content)))
+
+	status, body := getRange(t, s.addr, namespace, blob.Digest, "bytes=100-199")
+	require.Equal(http.StatusPartialContent, status)
+	require.Equal(blob.Content[100:200], body)
+	require.Equal([]byteRange{{100, 200}}, client.downloaded())
+	require.Equal(rangeSet{{100, 200}}, s.server.partialCache.cachedRanges(blob.Digest))
+
+	// Only the requested range is cached, not the full blob.
+	_, err = s.cas.GetCacheFileStat(blob.Digest.Hex())
+	require.True(os.IsNotExist(err))
+
+	// The overlapping part is served from cache, and only the rest is fetched.
+	status, body = getRange(t, s.addr, namespace, blob.Digest, "bytes=150-299")
+	require.Equal(http.StatusPartialContent, status)
+	require.Equal(blob.Content[150:300], body)
+	require.Equal([]byteRange{{100, 200}, {200, 300}}, client.downloaded())
+	require.Equal(rangeSet{{100, 300}}, s.server.partialCache.cachedRanges(blob.Digest))
+}
+
+func TestPartialCacheRejectsUnsatisfiableRange(t *testing.T) {
+	require := require.New(t)
+
+	dir, err := ioutil.TempDir("", "partial")
+	require.NoError(err)
+	defer os.RemoveAll(dir)
+
+	fs := testfs.NewServer()
+	defer fs.Cleanup()
+	fsAddr, stop := testutil.StartServer(fs.Handler())
+	defer stop()
+
+	client, err := testfs.NewClient(testfs.Config{Addr: fsAddr, NamePath: namepath.Identity})
+	require.NoError(err)
+
+	config := Config{PartialCache: PartialCacheConfig{Enabled: true, Dir: dir}}
+	s := newTestServerWithConfig(t, config, master1, hashRingNoReplica(), newTestClientProvider())
+	defer s.cleanup()
+
+	namespace := "partial"
+	require.NoError(s.backendManager.Register(namespace, client))
+
+	blob := core.SizedBlobFixture(100, 10)
+	require.NoError(client.Upload(namespace, blob.Digest.Hex(), bytes.NewReader(blob.Content)))
+
+	status, _ := getRange(t, s.addr, namespace, blob.Digest, "bytes=100-")
+	require.Equal(http.StatusRequestedRangeNotSatisfiable, status)
+}
+
+func TestPartialCacheEvictsLeastRecentlyUsedBlobs(t *testing.T) {
+	require := require.New(t)
+
+	dir, err := ioutil.TempDir("", "partial")
+	require.NoError(err)
+	defer os.RemoveAll(dir)
+
+	fs := testfs.NewServer()
+	defer fs.Cleanup()
+	fsAddr, stop := testutil.StartServer(fs.Handler())
+	defer stop()
+
+	client, err := testfs.NewClient(testfs.Config{Addr: fsAddr, NamePath: namepath.Identity})
+	require.NoError(err)
+
+	c, err := newPartialCache(PartialCacheConfig{Enabled: true, Dir: dir, Size: 150}, tally.NoopScope)
+	require.NoError(err)
+
+	namespace := "partial"
+	blob1 := core.SizedBlobFixture(100, 10)
+	blob2 := core.SizedBlobFixture(100, 10)
+	for _, blob := range []*core.BlobFixture{blob1, blob2} {
+		require.NoError(client.Upload(namespace, blob.Digest.Hex(), bytes.NewReader(blob.Content)))
+		var b bytes.Buffer
+		copyTo := func(r io.Reader) error {
+			_, err := io.Copy(&b, r)
+			return err
+		}
+		require.NoError(c.read(client, namespace, blob.Digest, 100, byteRange{0, 100}, copyTo))
+		require.Equal(blob.Content, b.Bytes())
+	}
+
+	require.Empty(c.cachedRanges(blob1.Digest))
+	require.Equal(rangeSet{{0, 100}}, c.cachedRanges(blob2.Digest))
+	_, err = os.Stat(filepath.Join(dir, blob1.Digest.Hex()))
+	require.True(os.IsNotExist(err))
+}
@@ -0,0 +1,317 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package blobserver
+
+import (
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/uber-go/tally"
+	"go.uber.org/atomic"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/store"
+	"github.com/uber/kraken/lib/store/metadata"
+	"github.com/uber/kraken/utils/log"
+)
+
+// Pre-verification modes.
+const (
+	PreverifyOff     = "off"
+	PreverifyFull    = "full"
+	PreverifySampled = "sampled"
+)
+
+// PreverifyConfig defines verification of stored blobs on startup. Blobs are
+// re-hashed, and blobs whose contents do not match their digest are
+// quarantined, such that corruption left by disk faults or unclean shutdowns
+// is repaired from the backend instead of being served.
+type PreverifyConfig struct {
+	// Mode is one of "off", "full", which verifies every stored blob, or
+	// "sampled", which verifies a random SampleRate fraction of stored blobs.
+	// Defaults to "off".
+	Mode string `yaml:"mode"`
+
+	SampleRate float64 `yaml:"sample_rate"`
+
+	// BackgroundThreshold is the number of stored blobs above which
+	// verification runs in the background instead of gating health checks.
+	// Zero always gates health checks. Blobs not yet verified are verified
+	// on demand before being served or seeded either way.
+	BackgroundThreshold int `yaml:"background_threshold"`
+
+	// QuarantineDir, if set, keeps a copy of each corrupt blob for inspection.
+	// Corrupt blobs are always removed from the store.
+	QuarantineDir string `yaml:"quarantine_dir"`
+}
+
+func (c PreverifyConfig) applyDefaults() PreverifyConfig {
+	if c.Mode == "" {
+		c.Mode = PreverifyOff
+	}
+	if c.SampleRate == 0 {
+		c.SampleRate = 0.1
+	}
+	return c
+}
+
+func (c PreverifyConfig) validate() error {
+	switch c.Mode {
+	case PreverifyOff, PreverifyFull, PreverifySampled:
+	default:
+		return fmt.Errorf("invalid mode %q", c.Mode)
+	}
+	if c.SampleRate < 0 || c.SampleRate > 1 {
+		return fmt.Errorf("sample rate %v not in [0, 1]", c.SampleRate)
+	}
+	return nil
+}
+
+// preverifier verifies the blobs stored in cas on startup.
+type preverifier struct {
+	config PreverifyConfig
+	stats  tally.Scope
+	cas    store.Driver
+	ready  *atomic.Bool
+
+	mu      sync.Mutex
+	pending map[string]*pendingBlob
+}
+
+// pendingBlob is a stored blob which is yet to be verified, either by the
+// startup pass or on demand, whichever reads it first.
+type pendingBlob struct {
+	once sync.Once
+}
+
+func newPreverifier(
+	config PreverifyConfig, stats tally.Scope, cas store.Driver) (*preverifier, error) {
+
+	config = config.applyDefaults()
+	if err := config.validate(); err != nil {
+		return nil, fmt.Errorf("preverify: %s", err)
+	}
+	if config.Mode == PreverifyOff {
+		return nil, nil
+	}
+	return &preverifier{
+		config:  config,
+		stats:   stats.SubScope("preverify"),
+		cas:     cas,
+		ready:   atomic.NewBool(false),
+		pending: make(map[string]*pendingBlob),
+	}, nil
+}
+
+// isReady returns whether s passes health checks. Always true if v is nil.
+func (v *preverifier) isReady() bool {
+	if v == nil {
+		return true
+	}
+	return v.ready.Load()
+}
+
+// Preverify verifies stored blobs in the background. Health checks fail until
+// verification completes, unless more than the configured threshold of blobs
+// is stored, in which case health checks are not gated. Blobs which are read
+// before the pass reaches them are verified on demand. Should be called on
+// startup, before blobs are served or seeded. Does nothing if pre-verification
+// is off.
+func (s *Server) Preverify() {
+	v := s.preverifier
+	if v == nil {
+		return
+	}
+	names, err := s.cas.ListCacheFiles()
+	if err != nil {
+		log.Errorf("Error listing blobs for pre-verification: %s", err)
+		v.ready.Store(true)
+		return
+	}
+	if v.config.BackgroundThreshold > 0 && len(names) > v.config.BackgroundThreshold {
+		log.Infof("Pre-verifying %d blobs in the background", len(names))
+		v.ready.Store(true)
+	}
+	sampled := v.track(names)
+	go func() {
+		v.run(sampled, len(names))
+		v.ready.Store(true)
+	}()
+}
+
+// track marks the blobs to verify out of names as pending, and returns them.
+func (v *preverifier) track(names []string) []string {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	var sampled []string
+	for _, name := range names {
+		if v.config.Mode == PreverifySampled && rand.Float64() >= v.config.SampleRate {
+			v.stats.Counter("skipped").Inc(1)
+			continue
+		}
+		v.pending[name] = &pendingBlob{}
+		sampled = append(sampled, name)
+	}
+	return sampled
+}
+
+func (v *preverifier) run(names []string, total int) {
+	start := time.Now()
+	for _, name := range names {
+		v.verify(name)
+	}
+	v.stats.Timer("duration").Record(time.Since(start))
+	log.Infof("Pre-verified %d of %d blobs in %s", len(names), total, time.Since(start))
+}
+
+// verify verifies name if it is pending, quarantining it if it is corrupt.
+// Blocks until name is verified if it is already being verified. Does nothing
+// if v is nil.
+func (v *preverifier) verify(name string) {
+	if v == nil {
+		return
+	}
+	v.mu.Lock()
+	p, ok := v.pending[name]
+	v.mu.Unlock()
+	if !ok {
+		return
+	}
+	p.once.Do(func() {
+		v.check(name)
+		v.mu.Lock()
+		delete(v.pending, name)
+		v.mu.Unlock()
+	})
+}
+
+func (v *preverifier) check(name string) {
+	ok, err := verifyBlob(v.cas, name)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.With("name", name).Errorf("Error pre-verifying blob: %s", err)
+			v.stats.Counter("errors").Inc(1)
+		}
+		return
+	}
+	v.stats.Counter("verified").Inc(1)
+	if ok {
+		return
+	}
+	v.stats.Counter("corrupt").Inc(1)
+	log.With("name", name).Error("Quarantining corrupt blob")
+	if err := quarantineBlob(v.cas, name, v.config.QuarantineDir); err != nil {
+		log.With("name", name).Errorf("Error quarantining corrupt blob: %s", err)
+		v.stats.Counter("errors").Inc(1)
+	}
+}
+
+// preverifiedDriver is a store.Driver which verifies pending blobs before they
+// are read.
+type preverifiedDriver struct {
+	store.Driver
+	v *preverifier
+}
+
+func (d *preverifiedDriver) GetCacheFileReader(name string) (store.FileReader, error) {
+	d.v.verify(name)
+	return d.Driver.GetCacheFileReader(name)
+}
+
+func (d *preverifiedDriver) GetCacheFileMetadata(name string, md metadata.Metadata) error {
+	d.v.verify(name)
+	return d.Driver.GetCacheFileMetadata(name, md)
+}
+
+// SeedStore returns the store which the scheduler should seed blobs from, such
+// that blobs are not seeded before they are pre-verified.
+func (s *Server) SeedStore() store.Driver {
+	if s.preverifier == nil {
+		return s.cas
+	}
+	return &preverifiedDriver{s.cas, s.preverifier}
+}
+
+// verifyBlob returns whether the contents of name hash to name.
+func verifyBlob(cas store.Driver, name string) (bool, error) {
+	d, err := digestFromName(name)
+	if err != nil {
+		return false, err
+	}
+	digester, err := core.NewDigesterWithAlgo(d.Algo())
+	if err != nil {
+		return false, err
+	}
+	f, err := cas.GetCacheFileReader(name)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	computed, err := digester.FromReader(f)
+	if err != nil {
+		return false, fmt.Errorf("hash: %s", err)
+	}
+	return computed == d, nil
+}
+
+// quarantineBlob removes name from the store, keeping a copy in dir if set.
+// Persisted blobs are removed too, since writing corrupt contents back to the
+// backend would spread the corruption.
+func quarantineBlob(cas store.Driver, name, dir string) error {
+	if dir != "" {
+		if err := copyToQuarantine(cas, name, dir); err != nil {
+			return fmt.Errorf("copy to quarantine: %s", err)
+		}
+	}
+	if err := cas.DeleteCacheFileMetadata(name, &metadata.Persist{}); err != nil {
+		return fmt.Errorf("delete persist metadata: %s", err)
+	}
+	if err := cas.DeleteCacheFile(name); err != nil {
+		return fmt.Errorf("delete: %s", err)
+	}
+	return nil
+}
+
+func copyToQuarantine(cas store.Driver, name, dir string) error {
+	if err := os.MkdirAll(dir, 0775); err != nil {
+		return err
+	}
+	r, err := cas.GetCacheFileReader(name)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	f, err := os.Create(filepath.Join(dir, name))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(f, r)
+	return err
+}
+
+// digestFromName parses the digest of a stored blob from its name, which is
+// the hex of a sha256 or sha512 digest.
+func digestFromName(name string) (core.Digest, error) {
+	if d, err := core.NewSHA256DigestFromHex(name); err == nil {
+		return d, nil
+	}
+	return core.NewDigestFromHex(core.SHA512, name)
+}
@@ -0,0 +1,122 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package blobserver
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/backend/backenderrors"
+	"github.com/uber/kraken/lib/store"
+	"github.com/uber/kraken/utils/httputil"
+	"github.com/uber/kraken/utils/testutil"
+
+	"github.com/stretchr/testify/require"
+	"github.com/uber-go/tally"
+)
+
+func TestPreverifyQuarantinesCorruptBlobs(t *testing.T) {
+	require := require.New(t)
+
+	dir, err := ioutil.TempDir("", "quarantine")
+	require.NoError(err)
+	defer os.RemoveAll(dir)
+
+	config := Config{Preverify: PreverifyConfig{
+		Mode:          PreverifyFull,
+		QuarantineDir: dir,
+	}}
+	namespace := core.TagFixture()
+
+	cp := newTestClientProvider()
+
+	s := newTestServerWithConfig(t, config, master1, hashRingMaxReplica(), cp)
+	defer s.cleanup()
+
+	good := core.NewBlobFixture()
+	require.NoError(s.cas.CreateCacheFile(good.Digest.Hex(), bytes.NewReader(good.Content)))
+
+	corrupt := core.NewBlobFixture()
+	require.NoError(s.cas.CreateCacheFile(corrupt.Digest.Hex(), bytes.NewReader(corrupt.Content)))
+	require.NoError(s.cas.(*store.MemoryDriver).Corrupt(corrupt.Digest.Hex(), []byte("corrupt")))
+
+	health := fmt.Sprintf("http://%s/health", s.addr)
+
+	_, err = httputil.Get(health)
+	require.True(httputil.IsStatus(err, http.StatusServiceUnavailable))
+
+	s.server.Preverify()
+
+	require.NoError(testutil.PollUntilTrue(5*time.Second, func() bool {
+		_, err := httputil.Get(health)
+		return err == nil
+	}))
+
+	_, err = s.cas.GetCacheFileStat(corrupt.Digest.Hex())
+	require.True(os.IsNotExist(err))
+
+	b, err := ioutil.ReadFile(filepath.Join(dir, corrupt.Digest.Hex()))
+	require.NoError(err)
+	require.Equal("corrupt", string(b))
+
+	ensureHasBlob(t, cp.Provide(master1), namespace, good)
+
+	backendClient := s.backendClient(namespace)
+	backendClient.EXPECT().Stat(namespace, corrupt.Digest.Hex()).Return(nil, backenderrors.ErrBlobNotFound)
+
+	err = cp.Provide(master1).DownloadBlob(namespace, corrupt.Digest, ioutil.Discard)
+	require.Error(err)
+	require.Equal(http.StatusNotFound, err.(httputil.StatusError).Status)
+}
+
+func TestPreverifyRejectsInvalidMode(t *testing.T) {
+	_, err := newPreverifier(PreverifyConfig{Mode: "partial"}, tally.NoopScope, nil)
+	require.Error(t, err)
+}
+
+func TestPreverifiedDriverVerifiesPendingBlobsBeforeReads(t *testing.T) {
+	require := require.New(t)
+
+	cas := store.NewMemoryDriver()
+	v, err := newPreverifier(PreverifyConfig{Mode: PreverifyFull}, tally.NoopScope, cas)
+	require.NoError(err)
+
+	good := core.NewBlobFixture()
+	require.NoError(cas.CreateCacheFile(good.Digest.Hex(), bytes.NewReader(good.Content)))
+
+	corrupt := core.NewBlobFixture()
+	require.NoError(cas.CreateCacheFile(corrupt.Digest.Hex(), bytes.NewReader(corrupt.Content)))
+	require.NoError(cas.Corrupt(corrupt.Digest.Hex(), []byte("corrupt")))
+
+	// Track the blobs without running the pass, as if the pass has not yet
+	// reached them.
+	require.Len(v.track([]string{good.Digest.Hex(), corrupt.Digest.Hex()}), 2)
+
+	d := &preverifiedDriver{cas, v}
+
+	f, err := d.GetCacheFileReader(good.Digest.Hex())
+	require.NoError(err)
+	f.Close()
+
+	_, err = d.GetCacheFileReader(corrupt.Digest.Hex())
+	require.True(os.IsNotExist(err))
+	require.Empty(v.pending)
+}
@@ -0,0 +1,147 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package blobserver
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/backend"
+	"github.com/uber/kraken/utils/log"
+
+	"github.com/c2h5oh/datasize"
+)
+
+// SignedRedirectConfig defines serving of large cold blobs by redirecting
+// clients to signed backend URLs, such that clients download them directly
+// from the backend instead of through the origin. Only backends which support
+// signed URLs are redirected to. Blobs which are cached by the origin, smaller
+// than Threshold, or stored in other backends are served by the origin.
+type SignedRedirectConfig struct {
+	Enabled bool `yaml:"enabled"`
+
+	// Threshold is the minimum size of redirected blobs.
+	Threshold datasize.ByteSize `yaml:"threshold"`
+
+	// TTL is the duration for which signed URLs are valid.
+	TTL time.Duration `yaml:"ttl"`
+
+	// SizeCacheSize bounds the number of backend blob sizes remembered, such
+	// that repeated cold downloads of a blob do not stat the backend again.
+	SizeCacheSize int `yaml:"size_cache_size"`
+}
+
+func (c SignedRedirectConfig) applyDefaults() SignedRedirectConfig {
+	if c.Threshold == 0 {
+		c.Threshold = 512 * datasize.MB
+	}
+	if c.TTL == 0 {
+		c.TTL = 15 * time.Minute
+	}
+	if c.SizeCacheSize == 0 {
+		c.SizeCacheSize = 10000
+	}
+	return c
+}
+
+// blobSizes is an LRU cache of backend blob sizes. Since blobs are content
+// addressed, cached sizes never go stale.
+type blobSizes struct {
+	mu      sync.Mutex
+	maxSize int
+	order   *list.List
+	entries map[core.Digest]*list.Element
+}
+
+type blobSize struct {
+	d    core.Digest
+	size int64
+}
+
+func newBlobSizes(maxSize int) *blobSizes {
+	return &blobSizes{
+		maxSize: maxSize,
+		order:   list.New(),
+		entries: make(map[core.Digest]*list.Element),
+	}
+}
+
+func (c *blobSizes) get(d core.Digest) (int64, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[d]
+	if !ok {
+		return 0, false
+	}
+	c.order.MoveToFront(e)
+	return e.Value.(*blobSize).size, true
+}
+
+func (c *blobSizes) add(d core.Digest, size int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e, ok := c.entries[d]; ok {
+		c.order.MoveToFront(e)
+		return
+	}
+	c.entries[d] = c.order.PushFront(&blobSize{d, size})
+	for c.order.Len() > c.maxSize {
+		e := c.order.Back()
+		c.order.Remove(e)
+		delete(c.entries, e.Value.(*blobSize).d)
+	}
+}
+
+// signedRedirectURL returns a signed backend URL for d if downloads of d should
+// be redirected to the backend. Any failure falls back to serving d from the
+// origin.
+func (s *Server) signedRedirectURL(namespace string, d core.Digest) (string, bool) {
+	if !s.config.SignedRedirect.Enabled {
+		return "", false
+	}
+	if _, err := s.cas.GetCacheFileStat(d.Hex()); err == nil {
+		return "", false
+	}
+	client, err := s.backends.GetClient(namespace)
+	if err != nil || !client.Capabilities().SignedURLs {
+		return "", false
+	}
+	signer, ok := client.(backend.SignedURLClient)
+	if !ok {
+		return "", false
+	}
+	size, ok := s.blobSizes.get(d)
+	if !ok {
+		info, err := client.Stat(namespace, d.Hex())
+		if err != nil {
+			return "", false
+		}
+		size = info.Size
+		s.blobSizes.add(d, size)
+	}
+	if size < int64(s.config.SignedRedirect.Threshold) {
+		return "", false
+	}
+	u, err := signer.SignedURL(namespace, d.Hex(), s.config.SignedRedirect.TTL)
+	if err != nil {
+		log.With("blob", d.Hex()).Errorf("Error signing backend URL: %s", err)
+		return "", false
+	}
+	s.stats.Counter("signed_redirects").Inc(1)
+	return u, true
+}
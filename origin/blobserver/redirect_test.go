@@ -0,0 +1,215 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package blobserver
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/backend"
+	"github.com/uber/kraken/mocks/lib/backend"
+	"github.com/uber/kraken/utils/httputil"
+	"github.com/uber/kraken/utils/mockutil"
+	"github.com/uber/kraken/utils/testutil"
+
+	"github.com/c2h5oh/datasize"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+)
+
+func signedRedirectConfig(threshold int) Config {
+	return Config{
+		SignedRedirect: SignedRedirectConfig{
+			Enabled:   true,
+			Threshold: datasize.ByteSize(threshold),
+		},
+	}
+}
+
+func (s *testServer) signedURLBackendClient(
+	namespace string, blob *core.BlobFixture) *mockbackend.MockSignedURLClient {
+
+	client := mockbackend.NewMockSignedURLClient(s.ctrl)
+	if err := s.backendManager.Register(namespace, client); err != nil {
+		panic(err)
+	}
+	client.EXPECT().Capabilities().Return(
+		backend.BackendCapabilities{SignedURLs: true}).AnyTimes()
+	client.EXPECT().Stat(namespace, blob.Digest.Hex()).Return(
+		core.NewBlobInfo(int64(len(blob.Content))), nil).AnyTimes()
+	return client
+}
+
+// signedURLServer serves content at a fake signed URL.
+func signedURLServer(content []byte) (*httptest.Server, string) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(content)
+	}))
+	return srv, srv.URL + "/signed?X-Amz-Signature=abc"
+}
+
+func TestSignedRedirectAboveThreshold(t *testing.T) {
+	require := require.New(t)
+
+	cp := newTestClientProvider()
+	ring := hashRingNoReplica()
+
+	blob := computeBlobForHosts(ring, master1)
+	s := newTestServerWithConfig(t, signedRedirectConfig(len(blob.Content)), master1, ring, cp)
+	defer s.cleanup()
+
+	namespace := core.TagFixture()
+
+	srv, signed := signedURLServer(blob.Content)
+	defer srv.Close()
+
+	client := s.signedURLBackendClient(namespace, blob)
+	client.EXPECT().SignedURL(namespace, blob.Digest.Hex(), 15*time.Minute).Return(
+		signed, nil).Times(2)
+
+	// The origin redirects instead of serving the blob.
+	resp, err := httputil.Get(
+		fmt.Sprintf("http://%s/namespace/%s/blobs/%s",
+			s.addr, url.PathEscape(namespace), blob.Digest),
+		httputil.SendRedirect(func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		}),
+		httputil.SendAcceptedCodes(http.StatusTemporaryRedirect))
+	require.NoError(err)
+	resp.Body.Close()
+	require.Equal(signed, resp.Header.Get("Location"))
+
+	// The blob client follows the redirect.
+	var b bytes.Buffer
+	require.NoError(cp.Provide(master1).DownloadBlob(namespace, blob.Digest, &b))
+	require.Equal(blob.Content, b.Bytes())
+}
+
+func TestSignedRedirectVerifiesDigest(t *testing.T) {
+	require := require.New(t)
+
+	cp := newTestClientProvider()
+	ring := hashRingNoReplica()
+
+	blob := computeBlobForHosts(ring, master1)
+	s := newTestServerWithConfig(t, signedRedirectConfig(len(blob.Content)), master1, ring, cp)
+	defer s.cleanup()
+
+	namespace := core.TagFixture()
+
+	srv, signed := signedURLServer(append([]byte("corrupt"), blob.Content...))
+	defer srv.Close()
+
+	client := s.signedURLBackendClient(namespace, blob)
+	client.EXPECT().SignedURL(namespace, blob.Digest.Hex(), 15*time.Minute).Return(signed, nil)
+
+	var b bytes.Buffer
+	err := cp.Provide(master1).DownloadBlob(namespace, blob.Digest, &b)
+	require.Error(err)
+	require.Contains(err.Error(), "digest mismatch")
+}
+
+func TestSignedRedirectBelowThresholdIsProxied(t *testing.T) {
+	require := require.New(t)
+
+	cp := newTestClientProvider()
+	ring := hashRingNoReplica()
+
+	blob := computeBlobForHosts(ring, master1)
+	s := newTestServerWithConfig(
+		t, signedRedirectConfig(len(blob.Content)+1), master1, ring, cp)
+	defer s.cleanup()
+
+	namespace := core.TagFixture()
+
+	client := s.signedURLBackendClient(namespace, blob)
+	client.EXPECT().Download(
+		namespace, blob.Digest.Hex(), mockutil.MatchWriter(blob.Content)).Return(nil)
+
+	err := cp.Provide(master1).DownloadBlob(namespace, blob.Digest, &bytes.Buffer{})
+	require.True(httputil.IsAccepted(err))
+
+	require.NoError(testutil.PollUntilTrue(5*time.Second, func() bool {
+		err := cp.Provide(master1).DownloadBlob(namespace, blob.Digest, &bytes.Buffer{})
+		return !httputil.IsAccepted(err)
+	}))
+
+	var b bytes.Buffer
+	require.NoError(cp.Provide(master1).DownloadBlob(namespace, blob.Digest, &b))
+	require.Equal(blob.Content, b.Bytes())
+}
+
+func TestSignedRedirectStatsColdBlobOnce(t *testing.T) {
+	require := require.New(t)
+
+	cp := newTestClientProvider()
+	ring := hashRingNoReplica()
+
+	blob := computeBlobForHosts(ring, master1)
+	s := newTestServerWithConfig(
+		t, signedRedirectConfig(len(blob.Content)+1), master1, ring, cp)
+	defer s.cleanup()
+
+	namespace := core.TagFixture()
+
+	client := mockbackend.NewMockSignedURLClient(s.ctrl)
+	require.NoError(s.backendManager.Register(namespace, client))
+	client.EXPECT().Capabilities().Return(
+		backend.BackendCapabilities{SignedURLs: true}).AnyTimes()
+	// Each download stats the blob once in the refresher, plus once for the
+	// redirect decision of the first download only.
+	client.EXPECT().Stat(namespace, blob.Digest.Hex()).Return(
+		core.NewBlobInfo(int64(len(blob.Content))), nil).Times(4)
+	client.EXPECT().Download(
+		namespace, blob.Digest.Hex(), gomock.Any()).DoAndReturn(
+		func(string, string, io.Writer) error {
+			time.Sleep(200 * time.Millisecond)
+			return errors.New("some error")
+		}).AnyTimes()
+
+	for i := 0; i < 3; i++ {
+		cp.Provide(master1).DownloadBlob(namespace, blob.Digest, &bytes.Buffer{})
+	}
+}
+
+func TestSignedRedirectSkippedForBackendWithoutSignedURLs(t *testing.T) {
+	require := require.New(t)
+
+	cp := newTestClientProvider()
+	ring := hashRingNoReplica()
+
+	blob := computeBlobForHosts(ring, master1)
+	s := newTestServerWithConfig(t, signedRedirectConfig(1), master1, ring, cp)
+	defer s.cleanup()
+
+	namespace := core.TagFixture()
+
+	client := s.backendClient(namespace)
+	client.EXPECT().Capabilities().Return(backend.BackendCapabilities{}).AnyTimes()
+	client.EXPECT().Stat(namespace, blob.Digest.Hex()).Return(
+		core.NewBlobInfo(int64(len(blob.Content))), nil).AnyTimes()
+	client.EXPECT().Download(
+		namespace, blob.Digest.Hex(), gomock.Any()).Return(nil).AnyTimes()
+
+	err := cp.Provide(master1).DownloadBlob(namespace, blob.Digest, &bytes.Buffer{})
+	require.True(httputil.IsAccepted(err))
+}
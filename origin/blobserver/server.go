@@ -14,6 +14,7 @@
 package blobserver
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -36,6 +37,7 @@ import (
 	"github.com/uber/kraken/lib/persistedretry/writeback"
 	"github.com/uber/kraken/lib/store"
 	"github.com/uber/kraken/lib/store/metadata"
+	"github.com/uber/kraken/metrics"
 	"github.com/uber/kraken/origin/blobclient"
 	"github.com/uber/kraken/utils/errutil"
 	"github.com/uber/kraken/utils/handler"
@@ -44,10 +46,12 @@ import (
 	"github.com/uber/kraken/utils/log"
 	"github.com/uber/kraken/utils/memsize"
 	"github.com/uber/kraken/utils/stringset"
+	"github.com/uber/kraken/utils/syncutil"
 
 	"github.com/andres-erbsen/clock"
 	"github.com/pressly/chi"
 	"github.com/uber-go/tally"
+	"golang.org/x/time/rate"
 )
 
 const _uploadChunkSize = 16 * memsize.MB
@@ -59,7 +63,7 @@ type Server struct {
 	clk               clock.Clock
 	addr              string
 	hashRing          hashring.Ring
-	cas               *store.CAStore
+	cas               store.Driver
 	clientProvider    blobclient.Provider
 	clusterProvider   blobclient.ClusterProvider
 	backends          *backend.Manager
@@ -67,6 +71,18 @@ type Server struct {
 	metaInfoGenerator *metainfogen.Generator
 	uploader          *uploader
 	writeBackManager  persistedretry.Manager
+	pullLimiter       *rate.Limiter
+	pulls             sync.Map // In-flight pulls from siblings, keyed by digest.
+	memoryTier        *memoryTier
+	warmList          *warmList
+	partialCache      *partialCache
+	evictions         *evictionCandidates
+	clientLimiter     *clientLimiter
+	fanout            *syncutil.FanoutPool
+	preverifier       *preverifier
+	verifications     *verificationCache
+	blobSizes         *blobSizes
+	namespaces        *metrics.NamespaceTagger
 
 	// This is an unfortunate coupling between the p2p client and the blob server.
 	// Tracker queries the origin cluster to discover which origins can seed
@@ -75,6 +91,16 @@ type Server struct {
 	pctx core.PeerContext
 }
 
+// Option allows setting optional Server parameters.
+type Option func(*Server)
+
+// WithNamespaceTags configures the Server to tag per-namespace metrics with
+// the namespace patterns of t. Otherwise, they are tagged with
+// metrics.OtherNamespace.
+func WithNamespaceTags(t *metrics.NamespaceTagger) Option {
+	return func(s *Server) { s.namespaces = t }
+}
+
 // New initializes a new Server.
 func New(
 	config Config,
@@ -82,14 +108,15 @@ func New(
 	clk clock.Clock,
 	addr string,
 	hashRing hashring.Ring,
-	cas *store.CAStore,
+	cas store.Driver,
 	clientProvider blobclient.Provider,
 	clusterProvider blobclient.ClusterProvider,
 	pctx core.PeerContext,
 	backends *backend.Manager,
 	blobRefresher *blobrefresh.Refresher,
 	metaInfoGenerator *metainfogen.Generator,
-	writeBackManager persistedretry.Manager) (*Server, error) {
+	writeBackManager persistedretry.Manager,
+	opts ...Option) (*Server, error) {
 
 	config = config.applyDefaults()
 
@@ -97,7 +124,17 @@ func New(
 		"module": "blobserver",
 	})
 
-	return &Server{
+	partialCache, err := newPartialCache(config.PartialCache, stats)
+	if err != nil {
+		return nil, fmt.Errorf("partial cache: %s", err)
+	}
+
+	preverifier, err := newPreverifier(config.Preverify, stats, cas)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Server{
 		config:            config,
 		stats:             stats,
 		clk:               clk,
@@ -109,10 +146,51 @@ func New(
 		backends:          backends,
 		blobRefresher:     blobRefresher,
 		metaInfoGenerator: metaInfoGenerator,
-		uploader:          newUploader(cas),
 		writeBackManager:  writeBackManager,
-		pctx:              pctx,
-	}, nil
+		pullLimiter: rate.NewLimiter(
+			rate.Limit(config.Broadcast.PullRPS), config.Broadcast.PullBurst),
+		memoryTier:   newMemoryTier(config.MemoryTier, stats),
+		warmList:     newWarmList(config.WarmList, stats, clk),
+		partialCache: partialCache,
+		pctx:         pctx,
+		preverifier:  preverifier,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	s.uploader = newUploader(cas, newVerifier(config.Verification, stats, s.namespaces))
+	s.blobSizes = newBlobSizes(config.SignedRedirect.SizeCacheSize)
+	s.verifications = newVerificationCache(config.VerificationCache, stats, clk, cas)
+	s.clientLimiter = newClientLimiter(config.ClientLimit, stats, clk)
+	s.fanout = syncutil.NewFanoutPool(config.Fanout, stats)
+	s.evictions = newEvictionCandidates(config.Eviction, stats, clk, s.evictBlob)
+	return s, nil
+}
+
+// Warm re-fetches the blobs of the warm list saved by the last graceful
+// shutdown in the background, bounded by the disk utilization of cacheDir.
+// Should be called on startup, once backends are configured. Does nothing if
+// the warm list is disabled.
+func (s *Server) Warm(cacheDir string) {
+	if s.warmList == nil {
+		return
+	}
+	go s.warm(context.Background(), cacheDir)
+}
+
+// RecordSeeded records d of namespace in the warm list when it is seeded to
+// peers, since blobs distributed over p2p are part of the working set even if
+// they are never downloaded over http. Does nothing if the warm list is
+// disabled.
+func (s *Server) RecordSeeded(namespace string, d core.Digest, size int64) {
+	s.warmList.record(namespace, d, size)
+}
+
+// SaveWarmList persists the blobs most recently downloaded from s, such that
+// they are warmed when s restarts. Should be called on graceful shutdown. Does
+// nothing if the warm list is disabled.
+func (s *Server) SaveWarmList() error {
+	return s.warmList.save()
 }
 
 // Addr returns the address the blob server is configured on.
@@ -137,12 +215,23 @@ func (s *Server) Handler() http.Handler {
 	r.Patch("/namespace/{namespace}/blobs/{digest}/uploads/{uid}", handler.Wrap(s.patchClusterUploadHandler))
 	r.Put("/namespace/{namespace}/blobs/{digest}/uploads/{uid}", handler.Wrap(s.commitClusterUploadHandler))
 
-	r.Get("/namespace/{namespace}/blobs/{digest}", handler.Wrap(s.downloadBlobHandler))
+	r.Put("/namespace/{namespace}/blobs/uploads", handler.Wrap(s.streamClusterUploadHandler))
+
+	r.With(s.limitClients).Get("/namespace/{namespace}/blobs/{digest}", handler.Wrap(s.downloadBlobHandler))
+
+	if s.config.Assembly.Enabled {
+		r.With(s.limitClients).Get(
+			"/namespace/{namespace}/blobs/{digest}/assembled",
+			handler.Wrap(s.downloadAssembledBlobHandler))
+	}
 
 	r.Post("/namespace/{namespace}/blobs/{digest}/remote/{remote}", handler.Wrap(s.replicateToRemoteHandler))
 
 	r.Post("/forcecleanup", handler.Wrap(s.forceCleanupHandler))
 
+	// Returns the clients with the most in-flight requests.
+	r.Get("/x/clients", handler.Wrap(s.clientsHandler))
+
 	// Internal endpoints:
 
 	r.Post("/internal/blobs/{digest}/uploads", handler.Wrap(s.startTransferHandler))
@@ -151,13 +240,17 @@ func (s *Server) Handler() http.Handler {
 
 	r.Delete("/internal/blobs/{digest}", handler.Wrap(s.deleteBlobHandler))
 
+	r.Post("/internal/blobs/{digest}/evict", handler.Wrap(s.markEvictionCandidateHandler))
+
 	r.Post("/internal/blobs/{digest}/metainfo", handler.Wrap(s.overwriteMetaInfoHandler))
 
 	r.Get("/internal/peercontext", handler.Wrap(s.getPeerContextHandler))
 
-	r.Head("/internal/namespace/{namespace}/blobs/{digest}", handler.Wrap(s.statHandler))
+	r.With(s.limitClients).Head("/internal/namespace/{namespace}/blobs/{digest}", handler.Wrap(s.statHandler))
+
+	r.With(s.limitClients).Get("/internal/namespace/{namespace}/blobs/{digest}/metainfo", handler.Wrap(s.getMetaInfoHandler))
 
-	r.Get("/internal/namespace/{namespace}/blobs/{digest}/metainfo", handler.Wrap(s.getMetaInfoHandler))
+	r.Post("/internal/namespace/{namespace}/blobs/{digest}/pull", handler.Wrap(s.pullBlobHandler))
 
 	r.Put(
 		"/internal/duplicate/namespace/{namespace}/blobs/{digest}/uploads/{uid}",
@@ -174,7 +267,19 @@ func (s *Server) ListenAndServe(h http.Handler) error {
 	return listener.Serve(s.config.Listener, h)
 }
 
+// ListenAndServeContext is like ListenAndServe, but gracefully shuts down once
+// ctx is done.
+func (s *Server) ListenAndServeContext(ctx context.Context, h http.Handler) error {
+	log.Infof("Starting blob server on %s", s.config.Listener)
+	return listener.ServeContext(ctx, s.config.Listener, h)
+}
+
+// healthCheckHandler fails until stored blobs are pre-verified, such that
+// clients and the hash ring avoid s until then.
 func (s *Server) healthCheckHandler(w http.ResponseWriter, r *http.Request) error {
+	if !s.preverifier.isReady() {
+		return handler.Errorf("pre-verifying stored blobs").Status(http.StatusServiceUnavailable)
+	}
 	fmt.Fprintln(w, "OK")
 	return nil
 }
@@ -194,8 +299,19 @@ func (s *Server) statHandler(w http.ResponseWriter, r *http.Request) error {
 		return err
 	}
 
+	reportWarming, err := strconv.ParseBool(httputil.GetQueryArg(r, "warming", "false"))
+	if err != nil {
+		return handler.Errorf("parse arg `warming` as bool: %s", err)
+	}
+
 	bi, err := s.stat(namespace, d, checkLocal)
 	if os.IsNotExist(err) {
+		// Blobs which are currently being fetched from the backend will be
+		// available shortly, which callers may opt into distinguishing.
+		if checkLocal && reportWarming && s.blobRefresher.Pending(namespace, d) {
+			w.WriteHeader(http.StatusAccepted)
+			return nil
+		}
 		return handler.ErrorStatus(http.StatusNotFound)
 	} else if err != nil {
 		return fmt.Errorf("stat: %s", err)
@@ -238,7 +354,26 @@ func (s *Server) downloadBlobHandler(w http.ResponseWriter, r *http.Request) err
 	if err != nil {
 		return err
 	}
-	if err := s.downloadBlob(namespace, d, w); err != nil {
+	// Blobs are immutable by digest, so clients which already have d never need
+	// to download it again.
+	setETag(w, d)
+	if etagMatches(r.Header.Get("If-None-Match"), d) {
+		w.WriteHeader(http.StatusNotModified)
+		return nil
+	}
+	if u, ok := s.signedRedirectURL(namespace, d); ok {
+		http.Redirect(w, r, u, http.StatusTemporaryRedirect)
+		return nil
+	}
+	s.preverifier.verify(d.Hex())
+	if s.partialCache != nil && r.Header.Get("Range") != "" {
+		return s.downloadBlobRange(namespace, d, w, r)
+	}
+	compress := s.config.Compression.Enabled && acceptsGzip(r)
+	if s.config.Compression.Enabled {
+		w.Header().Add("Vary", "Accept-Encoding")
+	}
+	if err := s.downloadBlob(namespace, d, w, compress); err != nil {
 		return err
 	}
 	setOctetStreamContentType(w)
@@ -258,24 +393,43 @@ func (s *Server) replicateToRemoteHandler(w http.ResponseWriter, r *http.Request
 	if err != nil {
 		return err
 	}
-	return s.replicateToRemote(namespace, d, remote)
+	transferred, err := s.replicateToRemote(namespace, d, remote)
+	if err != nil {
+		return err
+	}
+	w.Header().Set(blobclient.ReplicatedHeader, strconv.FormatBool(transferred))
+	return nil
 }
 
-func (s *Server) replicateToRemote(namespace string, d core.Digest, remoteDNS string) error {
+// replicateToRemote uploads the blob of d to the remote cluster, unless the
+// remote already has it, in which case false is returned.
+func (s *Server) replicateToRemote(
+	namespace string, d core.Digest, remoteDNS string) (transferred bool, err error) {
+
+	s.preverifier.verify(d.Hex())
 	f, err := s.cas.GetCacheFileReader(d.Hex())
 	if err != nil {
 		if os.IsNotExist(err) {
-			return s.startRemoteBlobDownload(namespace, d, false)
+			return false, s.startRemoteBlobDownload(namespace, d, false)
 		}
-		return handler.Errorf("file store: %s", err)
+		return false, handler.Errorf("file store: %s", err)
 	}
 	defer f.Close()
 
 	remote, err := s.clusterProvider.Provide(remoteDNS)
 	if err != nil {
-		return handler.Errorf("remote cluster provider: %s", err)
+		return false, handler.Errorf("remote cluster provider: %s", err)
 	}
-	return remote.UploadBlob(namespace, d, f)
+	if _, err := remote.Stat(namespace, d); err == nil {
+		s.stats.Counter("remote_replications_skipped").Inc(1)
+		return false, nil
+	} else if err != blobclient.ErrBlobNotFound {
+		log.With("blob", d.Hex(), "remote", remoteDNS).Errorf("Error stating remote blob: %s", err)
+	}
+	if err := remote.UploadBlob(namespace, d, f); err != nil {
+		return false, err
+	}
+	return true, nil
 }
 
 // deleteBlobHandler deletes blob data.
@@ -325,7 +479,10 @@ func (s *Server) getMetaInfoHandler(w http.ResponseWriter, r *http.Request) erro
 	if err != nil {
 		return err
 	}
-	w.Write(raw)
+	// Metainfo only changes if overwritten, so clients may revalidate it.
+	if err := httputil.WriteWithETag(w, r, raw); err != nil {
+		return handler.Errorf("write metainfo: %s", err)
+	}
 	return nil
 }
 
@@ -364,6 +521,7 @@ func (s *Server) overwriteMetaInfo(d core.Digest, pieceLength int64) error {
 // This download is asynchronous and getMetaInfo will immediately return a
 // "202 Accepted" server error.
 func (s *Server) getMetaInfo(namespace string, d core.Digest) ([]byte, error) {
+	s.preverifier.verify(d.Hex())
 	var tm metadata.TorrentMeta
 	if err := s.cas.GetCacheFileMetadata(d.Hex(), &tm); os.IsNotExist(err) {
 		return nil, s.startRemoteBlobDownload(namespace, d, true)
@@ -392,7 +550,10 @@ func (s *Server) startRemoteBlobDownload(
 	namespace string, d core.Digest, replicateLocally bool) error {
 
 	var hooks []blobrefresh.PostHook
-	if replicateLocally {
+	if s.config.Broadcast.Enabled {
+		// Siblings pull the blob, which replaces pushing it to them.
+		hooks = append(hooks, &broadcastHook{s, namespace})
+	} else if replicateLocally {
 		hooks = append(hooks, &localReplicationHook{s})
 	}
 	err := s.blobRefresher.Refresh(namespace, d, hooks...)
@@ -426,25 +587,18 @@ func (s *Server) replicateBlobLocally(d core.Digest) error {
 func (s *Server) applyToReplicas(d core.Digest, f func(i int, c blobclient.Client) error) error {
 	replicas := stringset.FromSlice(s.hashRing.Locations(d))
 	replicas.Remove(s.addr)
+	addrs := replicas.ToSlice()
 
 	var mu sync.Mutex
 	var errs []error
 
-	var wg sync.WaitGroup
-	var i int
-	for replica := range replicas {
-		wg.Add(1)
-		go func(i int, replica string) {
-			defer wg.Done()
-			if err := f(i, s.clientProvider.Provide(replica)); err != nil {
-				mu.Lock()
-				errs = append(errs, err)
-				mu.Unlock()
-			}
-		}(i, replica)
-		i++
-	}
-	wg.Wait()
+	s.fanout.Run(len(addrs), func(i int) {
+		if err := f(i, s.clientProvider.Provide(addrs[i])); err != nil {
+			mu.Lock()
+			errs = append(errs, err)
+			mu.Unlock()
+		}
+	})
 
 	return errutil.Join(errs)
 }
@@ -452,9 +606,14 @@ func (s *Server) applyToReplicas(d core.Digest, f func(i int, c blobclient.Clien
 // downloadBlob downloads blob for d into dst. If no blob exists under d, a
 // download of the blob from the storage backend configured for namespace will
 // be initiated. This download is asynchronous and downloadBlob will immediately
-// return a "202 Accepted" handler error.
-func (s *Server) downloadBlob(namespace string, d core.Digest, dst io.Writer) error {
-	f, err := s.cas.GetCacheFileReader(d.Hex())
+// return a "202 Accepted" handler error. If compress is set, the blob is gzip
+// encoded on the wire unless it is detected as incompressible.
+func (s *Server) downloadBlob(
+	namespace string, d core.Digest, w http.ResponseWriter, compress bool) error {
+
+	f, err := s.memoryTier.reader(d, func() (store.FileReader, error) {
+		return s.cas.GetCacheFileReader(d.Hex())
+	})
 	if os.IsNotExist(err) {
 		return s.startRemoteBlobDownload(namespace, d, true)
 	} else if err != nil {
@@ -462,13 +621,99 @@ func (s *Server) downloadBlob(namespace string, d core.Digest, dst io.Writer) er
 	}
 	defer f.Close()
 
-	if _, err := io.Copy(dst, f); err != nil {
+	var src io.Reader = f
+	if compress {
+		src, compress, err = s.config.Compression.compressible(f)
+		if err != nil {
+			return handler.Errorf("check compressible: %s", err)
+		}
+	}
+	if compress {
+		setOctetStreamContentType(w)
+		if err := s.config.Compression.copyCompressed(w, src); err != nil {
+			return handler.Errorf("copy compressed blob: %s", err)
+		}
+		s.stats.Counter("compressed_downloads").Inc(1)
+		s.recordWarm(namespace, d)
+		return nil
+	}
+	n, err := io.Copy(w, src)
+	if err != nil {
 		return handler.Errorf("copy blob: %s", err)
 	}
+	s.warmList.record(namespace, d, n)
 	return nil
 }
 
+// downloadBlobRange serves the byte range requested by r. Blobs cached in full
+// are served from disk. Otherwise, the range is served from the partial cache,
+// which fetches missing parts of the range from the backend, such that blobs of
+// which only some ranges are read are never fetched in full. Requests which
+// cannot be served partially fall back to downloading the full blob.
+func (s *Server) downloadBlobRange(
+	namespace string, d core.Digest, w http.ResponseWriter, r *http.Request) error {
+
+	f, err := s.cas.GetCacheFileReader(d.Hex())
+	if err == nil {
+		defer f.Close()
+		setOctetStreamContentType(w)
+		http.ServeContent(w, r, "", time.Time{}, f)
+		return nil
+	} else if !os.IsNotExist(err) {
+		return handler.Errorf("get cache file: %s", err)
+	}
+	client, err := s.backends.GetClient(namespace)
+	if err != nil {
+		return handler.Errorf("get backend client: %s", err)
+	}
+	if !client.Capabilities().Ranges {
+		return s.downloadBlob(namespace, d, w, false)
+	}
+	size, ok := s.partialCache.size(d)
+	if !ok {
+		bi, err := client.Stat(namespace, d.Hex())
+		if err == backenderrors.ErrBlobNotFound {
+			return handler.ErrorStatus(http.StatusNotFound)
+		} else if err != nil {
+			return handler.Errorf("backend stat: %s", err)
+		}
+		size = bi.Size
+	}
+	rng, ok, err := parseRange(r.Header.Get("Range"), size)
+	if err != nil {
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", size))
+		return err
+	}
+	if !ok {
+		return s.downloadBlob(namespace, d, w, false)
+	}
+	return s.partialCache.read(
+		client.(backend.RangeClient), namespace, d, size, rng, func(src io.Reader) error {
+			setOctetStreamContentType(w)
+			w.Header().Set("Accept-Ranges", "bytes")
+			w.Header().Set(
+				"Content-Range", fmt.Sprintf("bytes %d-%d/%d", rng.start, rng.end-1, size))
+			w.Header().Set("Content-Length", strconv.FormatInt(rng.len(), 10))
+			w.WriteHeader(http.StatusPartialContent)
+			if _, err := io.Copy(w, src); err != nil {
+				log.With("blob", d.Hex()).Errorf("Error copying blob range: %s", err)
+			}
+			return nil
+		})
+}
+
+// recordWarm records d in the warm list when its size is not known.
+func (s *Server) recordWarm(namespace string, d core.Digest) {
+	if s.warmList == nil {
+		return
+	}
+	if info, err := s.cas.GetCacheFileStat(d.Hex()); err == nil {
+		s.warmList.record(namespace, d, info.Size())
+	}
+}
+
 func (s *Server) deleteBlob(d core.Digest) error {
+	defer s.memoryTier.evict(d)
 	if err := s.cas.DeleteCacheFile(d.Hex()); err != nil {
 		if os.IsNotExist(err) {
 			return handler.ErrorStatus(http.StatusNotFound)
@@ -489,7 +734,7 @@ func (s *Server) startTransferHandler(w http.ResponseWriter, r *http.Request) er
 	} else if ok {
 		return handler.ErrorStatus(http.StatusConflict)
 	}
-	uid, err := s.uploader.start(d)
+	uid, err := s.uploader.start("", d)
 	if err != nil {
 		return err
 	}
@@ -512,7 +757,11 @@ func (s *Server) patchTransferHandler(w http.ResponseWriter, r *http.Request) er
 	if err != nil {
 		return err
 	}
-	return s.uploader.patch(d, uid, r.Body, start, end)
+	chunkDigest, err := parseChunkDigest(r.Header)
+	if err != nil {
+		return err
+	}
+	return s.uploader.patch(d, uid, r.Body, start, end, chunkDigest)
 }
 
 // commitTransferHandler commits the upload of an internal blob transfer.
@@ -526,7 +775,7 @@ func (s *Server) commitTransferHandler(w http.ResponseWriter, r *http.Request) e
 	if err != nil {
 		return err
 	}
-	if err := s.uploader.commit(d, uid); err != nil {
+	if err := s.uploader.commit(_transferNamespace, d, uid); err != nil {
 		return err
 	}
 	if err := s.metaInfoGenerator.Generate(d); err != nil {
@@ -558,7 +807,7 @@ func (s *Server) startClusterUploadHandler(w http.ResponseWriter, r *http.Reques
 	if err != nil {
 		return err
 	}
-	uid, err := s.uploader.start(d)
+	uid, err := s.uploader.start(namespace, d)
 	if err != nil {
 		return s.handleUploadConflict(err, namespace, d)
 	}
@@ -585,7 +834,11 @@ func (s *Server) patchClusterUploadHandler(w http.ResponseWriter, r *http.Reques
 	if err != nil {
 		return err
 	}
-	if err := s.uploader.patch(d, uid, r.Body, start, end); err != nil {
+	chunkDigest, err := parseChunkDigest(r.Header)
+	if err != nil {
+		return err
+	}
+	if err := s.uploader.patch(d, uid, r.Body, start, end, chunkDigest); err != nil {
 		return s.handleUploadConflict(err, namespace, d)
 	}
 	return nil
@@ -608,13 +861,19 @@ func (s *Server) commitClusterUploadHandler(w http.ResponseWriter, r *http.Reque
 		return err
 	}
 
-	if err := s.uploader.commit(d, uid); err != nil {
+	return s.commitClusterUpload(namespace, d, uid)
+}
+
+// commitClusterUpload commits upload uid of d, and writes it back to remote
+// storage asynchronously.
+func (s *Server) commitClusterUpload(namespace string, d core.Digest, uid string) error {
+	if err := s.uploader.commit(namespace, d, uid); err != nil {
 		return s.handleUploadConflict(err, namespace, d)
 	}
 	if err := s.writeBack(namespace, d, 0); err != nil {
 		return err
 	}
-	err = s.applyToReplicas(d, func(i int, client blobclient.Client) error {
+	err := s.applyToReplicas(d, func(i int, client blobclient.Client) error {
 		delay := s.config.DuplicateWriteBackStagger * time.Duration(i+1)
 		f, err := s.cas.GetCacheFileReader(d.Hex())
 		if err != nil {
@@ -632,6 +891,82 @@ func (s *Server) commitClusterUploadHandler(w http.ResponseWriter, r *http.Reque
 	return nil
 }
 
+// streamClusterUploadHandler uploads an external blob in a single streamed
+// request, whose digest is declared in a trailer once the blob was sent. Since
+// clients cannot pick the origins owning the blob upfront, uploads received by
+// other origins are forwarded to an owner.
+func (s *Server) streamClusterUploadHandler(w http.ResponseWriter, r *http.Request) error {
+	namespace, err := httputil.ParseParam(r, "namespace")
+	if err != nil {
+		return err
+	}
+	if ok, err := s.uploadNotModified(namespace, r); err != nil {
+		return err
+	} else if ok {
+		w.WriteHeader(http.StatusNotModified)
+		return nil
+	}
+	algo := httputil.GetQueryArg(r, "algo", core.SHA256)
+	d, uid, err := s.uploader.stream(r, namespace, algo)
+	if err != nil {
+		return err
+	}
+	locations := s.hashRing.Locations(d)
+	if stringset.FromSlice(locations).Has(s.addr) {
+		err := s.commitClusterUpload(namespace, d, uid)
+		if herr, ok := err.(*handler.Error); ok && herr.GetStatus() == http.StatusConflict {
+			// The blob was already uploaded, and handleUploadConflict made
+			// sure it is written back.
+			return nil
+		}
+		return err
+	}
+	defer s.cas.DeleteUploadFile(uid)
+	f, err := s.cas.GetUploadFileReadWriter(uid)
+	if err != nil {
+		return handler.Errorf("get upload file: %s", err)
+	}
+	defer f.Close()
+	if err := s.clientProvider.Provide(locations[0]).UploadBlob(namespace, d, f); err != nil {
+		return handler.Errorf("forward upload to %s: %s", locations[0], err)
+	}
+	s.stats.Counter("forwarded_stream_uploads").Inc(1)
+	return nil
+}
+
+// uploadNotModified returns true if upload r is conditional on If-None-Match
+// naming a digest, and the origin owning the digest already has its blob. Since
+// blobs are content-addressed and verified on commit, the upload would be
+// identical and need not be transferred.
+func (s *Server) uploadNotModified(namespace string, r *http.Request) (bool, error) {
+	if !s.config.ConditionalUpload {
+		return false, nil
+	}
+	d, ok := parseIfNoneMatchDigest(r.Header.Get("If-None-Match"))
+	if !ok {
+		return false, nil
+	}
+	locations := s.hashRing.Locations(d)
+	if stringset.FromSlice(locations).Has(s.addr) {
+		if ok, err := blobExists(s.cas, d); err != nil || !ok {
+			return false, err
+		}
+		// Like conflicting uploads, the blob must be written back before the
+		// client is told to stop.
+		if err := s.writeBack(namespace, d, 0); err != nil {
+			return false, err
+		}
+	} else if _, err := s.clientProvider.Provide(locations[0]).StatLocal(namespace, d); err != nil {
+		if err != blobclient.ErrBlobNotFound {
+			log.With("blob", d.Hex(), "owner", locations[0]).Infof(
+				"Error checking conditional upload, forwarding upload: %s", err)
+		}
+		return false, nil
+	}
+	s.stats.Counter("conditional_uploads_skipped").Inc(1)
+	return true, nil
+}
+
 // duplicateCommitClusterUploadHandler commits a duplicate blob upload, which
 // will attempt to write-back after the requested delay.
 func (s *Server) duplicateCommitClusterUploadHandler(w http.ResponseWriter, r *http.Request) error {
@@ -654,7 +989,7 @@ func (s *Server) duplicateCommitClusterUploadHandler(w http.ResponseWriter, r *h
 	}
 	delay := dr.Delay
 
-	if err := s.uploader.commit(d, uid); err != nil {
+	if err := s.uploader.commit(namespace, d, uid); err != nil {
 		return err
 	}
 	return s.writeBack(namespace, d, delay)
@@ -744,6 +1079,7 @@ func (s *Server) maybeDelete(name string, ttl time.Duration) (deleted bool, err
 		if err := s.cas.DeleteCacheFile(name); err != nil {
 			return false, fmt.Errorf("delete: %s", err)
 		}
+		s.memoryTier.evict(d)
 		return true, nil
 	}
 	return false, nil
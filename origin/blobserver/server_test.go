@@ -15,15 +15,23 @@ package blobserver
 
 import (
 	"bytes"
+	"compress/gzip"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
+	stdhttputil "net/http/httputil"
+	"net/url"
+	"os"
+	"strconv"
 	"testing"
 	"time"
 
+	"github.com/andres-erbsen/clock"
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/require"
+	"go.uber.org/atomic"
 
 	"github.com/uber/kraken/core"
 	"github.com/uber/kraken/lib/backend/backenderrors"
@@ -33,6 +41,7 @@ import (
 	"github.com/uber/kraken/origin/blobclient"
 	"github.com/uber/kraken/utils/httputil"
 	"github.com/uber/kraken/utils/mockutil"
+	"github.com/uber/kraken/utils/randutil"
 	"github.com/uber/kraken/utils/testutil"
 )
 
@@ -147,6 +156,49 @@ func TestStatHandlerReturnSize(t *testing.T) {
 	require.Equal(int64(256), bi.Size)
 }
 
+func TestCheckAvailabilityReportsWarmingDuringBackendFetch(t *testing.T) {
+	require := require.New(t)
+
+	ring := hashRingNoReplica()
+	cp := newTestClientProvider()
+
+	s := newTestServer(t, master1, ring, cp)
+	defer s.cleanup()
+
+	client := cp.Provide(s.host)
+	blob := computeBlobForHosts(ring, s.host)
+	namespace := core.TagFixture()
+
+	a, err := client.CheckAvailability(namespace, blob.Digest)
+	require.NoError(err)
+	require.Equal(blobclient.BlobCold, a)
+
+	release := make(chan struct{})
+	backendClient := s.backendClient(namespace)
+	backendClient.EXPECT().Stat(namespace,
+		blob.Digest.Hex()).Return(core.NewBlobInfo(int64(len(blob.Content))), nil).AnyTimes()
+	backendClient.EXPECT().Download(namespace, blob.Digest.Hex(), gomock.Any()).DoAndReturn(
+		func(namespace, name string, dst io.Writer) error {
+			<-release
+			_, err := dst.Write(blob.Content)
+			return err
+		})
+
+	_, err = client.GetMetaInfo(namespace, blob.Digest)
+	require.True(httputil.IsAccepted(err))
+
+	a, err = client.CheckAvailability(namespace, blob.Digest)
+	require.NoError(err)
+	require.Equal(blobclient.BlobWarming, a)
+
+	close(release)
+
+	require.NoError(testutil.PollUntilTrue(5*time.Second, func() bool {
+		a, err := client.CheckAvailability(namespace, blob.Digest)
+		return err == nil && a == blobclient.BlobAvailable
+	}))
+}
+
 func TestDownloadBlobInvalidParam(t *testing.T) {
 	digest := core.DigestFixture()
 
@@ -200,6 +252,105 @@ func TestDownloadBlobNotFound(t *testing.T) {
 	require.Equal(http.StatusNotFound, err.(httputil.StatusError).Status)
 }
 
+func TestDownloadBlobIfNoneMatch(t *testing.T) {
+	require := require.New(t)
+
+	cp := newTestClientProvider()
+
+	s := newTestServer(t, master1, hashRingMaxReplica(), cp)
+	defer s.cleanup()
+
+	blob := core.SizedBlobFixture(256, 8)
+	namespace := core.TagFixture()
+
+	require.NoError(cp.Provide(s.host).TransferBlob(blob.Digest, bytes.NewReader(blob.Content)))
+
+	u := fmt.Sprintf(
+		"http://%s/namespace/%s/blobs/%s", s.addr, url.PathEscape(namespace), blob.Digest)
+
+	// Matching ETag yields no body.
+	resp, err := httputil.Get(
+		u,
+		httputil.SendHeaders(map[string]string{"If-None-Match": fmt.Sprintf("%q", blob.Digest)}),
+		httputil.SendAcceptedCodes(http.StatusNotModified))
+	require.NoError(err)
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(resp.Body)
+	require.NoError(err)
+	require.Empty(b)
+	require.Equal(fmt.Sprintf("%q", blob.Digest), resp.Header.Get("ETag"))
+
+	// Non-matching ETag yields the body.
+	resp, err = httputil.Get(
+		u,
+		httputil.SendHeaders(map[string]string{"If-None-Match": fmt.Sprintf("%q", core.DigestFixture())}))
+	require.NoError(err)
+	defer resp.Body.Close()
+	b, err = ioutil.ReadAll(resp.Body)
+	require.NoError(err)
+	require.Equal(blob.Content, b)
+	require.Equal(fmt.Sprintf("%q", blob.Digest), resp.Header.Get("ETag"))
+}
+
+func TestDownloadBlobCompression(t *testing.T) {
+	compressible := bytes.Repeat([]byte("kraken"), 32*1024)
+	incompressible := randutil.Blob(192 * 1024)
+
+	tests := []struct {
+		desc       string
+		content    []byte
+		compressed bool
+	}{
+		{"compressible", compressible, true},
+		{"incompressible", incompressible, false},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			require := require.New(t)
+
+			cp := newTestClientProvider()
+
+			config := Config{Compression: CompressionConfig{Enabled: true}}
+			s := newTestServerWithConfig(t, config, master1, hashRingMaxReplica(), cp)
+			defer s.cleanup()
+
+			d, err := core.NewDigester().FromBytes(test.content)
+			require.NoError(err)
+			namespace := core.TagFixture()
+
+			client := blobclient.New(s.addr, blobclient.WithCompression())
+			require.NoError(client.TransferBlob(d, bytes.NewReader(test.content)))
+
+			resp, err := httputil.Get(
+				fmt.Sprintf("http://%s/namespace/%s/blobs/%s", s.addr, url.PathEscape(namespace), d),
+				httputil.SendHeaders(map[string]string{"Accept-Encoding": "gzip"}))
+			require.NoError(err)
+			defer resp.Body.Close()
+			b, err := ioutil.ReadAll(resp.Body)
+			require.NoError(err)
+
+			if test.compressed {
+				require.Equal("gzip", resp.Header.Get("Content-Encoding"))
+				require.True(len(b) < len(test.content))
+				gr, err := gzip.NewReader(bytes.NewReader(b))
+				require.NoError(err)
+				b, err = ioutil.ReadAll(gr)
+				require.NoError(err)
+			} else {
+				require.Empty(resp.Header.Get("Content-Encoding"))
+			}
+			require.Equal(test.content, b)
+
+			// The client decompresses transparently, so the digest still matches.
+			var buf bytes.Buffer
+			require.NoError(client.DownloadBlob(namespace, d, &buf))
+			result, err := core.NewDigester().FromBytes(buf.Bytes())
+			require.NoError(err)
+			require.Equal(d, result)
+		})
+	}
+}
+
 func TestDeleteBlob(t *testing.T) {
 	require := require.New(t)
 
@@ -306,6 +457,95 @@ func TestGetMetaInfoDownloadsBlobAndReplicates(t *testing.T) {
 	}))
 }
 
+func TestBroadcastWarmsCoOwnersAfterBackendFetch(t *testing.T) {
+	require := require.New(t)
+
+	ring := hashRingMaxReplica()
+	cp := newTestClientProvider()
+	namespace := core.TagFixture()
+
+	config := Config{Broadcast: BroadcastConfig{Enabled: true}}
+
+	s1 := newTestServerWithConfig(t, config, master1, ring, cp)
+	defer s1.cleanup()
+
+	s2 := newTestServerWithConfig(t, config, master2, ring, cp)
+	defer s2.cleanup()
+
+	s3 := newTestServerWithConfig(t, config, master3, ring, cp)
+	defer s3.cleanup()
+
+	blob := computeBlobForHosts(ring, s1.host, s2.host, s3.host)
+
+	// Only s1 fetches from the backend. Co-owners pull from s1.
+	backendClient := s1.backendClient(namespace)
+	backendClient.EXPECT().Stat(namespace,
+		blob.Digest.Hex()).Return(core.NewBlobInfo(int64(len(blob.Content))), nil).AnyTimes()
+	backendClient.EXPECT().Download(namespace, blob.Digest.Hex(), mockutil.MatchWriter(blob.Content)).Return(nil)
+
+	err := cp.Provide(master1).DownloadBlob(namespace, blob.Digest, ioutil.Discard)
+	require.True(httputil.IsAccepted(err))
+
+	for _, host := range []string{master2, master3} {
+		require.NoError(testutil.PollUntilTrue(5*time.Second, func() bool {
+			_, err := cp.Provide(host).StatLocal(namespace, blob.Digest)
+			return err == nil
+		}))
+		ensureHasBlob(t, cp.Provide(host), namespace, blob)
+	}
+}
+
+func TestPullBlobRejectsNonOwnerSource(t *testing.T) {
+	require := require.New(t)
+
+	ring := hashRingSomeReplica()
+	cp := newTestClientProvider()
+	namespace := core.TagFixture()
+
+	s1 := newTestServer(t, master1, ring, cp)
+	defer s1.cleanup()
+
+	blob := computeBlobForHosts(ring, s1.host, master2)
+
+	err := cp.Provide(master1).PullBlob(namespace, blob.Digest, master3)
+	require.True(httputil.IsStatus(err, http.StatusBadRequest))
+}
+
+func TestGetMetaInfoRevalidatedWithETag(t *testing.T) {
+	require := require.New(t)
+
+	cp := newTestClientProvider()
+
+	s := newTestServer(t, master1, hashRingMaxReplica(), cp)
+	defer s.cleanup()
+
+	blob := core.SizedBlobFixture(256, 8)
+	namespace := core.TagFixture()
+
+	require.NoError(cp.Provide(s.host).TransferBlob(blob.Digest, bytes.NewReader(blob.Content)))
+
+	u := fmt.Sprintf(
+		"http://%s/internal/namespace/%s/blobs/%s/metainfo",
+		s.addr, url.PathEscape(namespace), blob.Digest)
+
+	resp, err := httputil.Get(u)
+	require.NoError(err)
+	resp.Body.Close()
+	etag := resp.Header.Get("ETag")
+	require.NotEmpty(etag)
+
+	_, err = httputil.Get(u, httputil.SendHeaders(map[string]string{"If-None-Match": etag}))
+	require.True(httputil.IsStatus(err, http.StatusNotModified))
+
+	cache := httputil.NewResponseCache(httputil.ResponseCacheConfig{}, clock.NewMock())
+	client := blobclient.New(s.addr, blobclient.WithResponseCache(cache))
+	expected, err := client.GetMetaInfo(namespace, blob.Digest)
+	require.NoError(err)
+	mi, err := client.GetMetaInfo(namespace, blob.Digest)
+	require.NoError(err)
+	require.Equal(expected, mi)
+}
+
 func TestGetMetaInfoBlobNotFound(t *testing.T) {
 	require := require.New(t)
 
@@ -489,6 +729,69 @@ func TestTransferBlobSmallChunkSize(t *testing.T) {
 	ensureHasBlob(t, client, namespace, blob)
 }
 
+func TestTransferBlobResendsCorruptChunk(t *testing.T) {
+	require := require.New(t)
+
+	s := newTestServer(t, master1, hashRingMaxReplica(), newTestClientProvider())
+	defer s.cleanup()
+
+	blob := core.SizedBlobFixture(32, 4)
+	namespace := core.TagFixture()
+
+	target, err := url.Parse("http://" + s.addr)
+	require.NoError(err)
+	proxy := stdhttputil.NewSingleHostReverseProxy(target)
+
+	// Corrupt the first attempt of the second chunk in transit.
+	var patches, corrupted int
+	addr, stop := testutil.StartServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPatch {
+			patches++
+			if r.Header.Get("Content-Range") == "16-32" && corrupted == 0 {
+				corrupted++
+				b, err := ioutil.ReadAll(r.Body)
+				require.NoError(err)
+				b[0]++
+				r.Body = ioutil.NopCloser(bytes.NewReader(b))
+			}
+		}
+		proxy.ServeHTTP(w, r)
+	}))
+	defer stop()
+
+	client := blobclient.New(addr, blobclient.WithChunkSize(16))
+
+	require.NoError(client.TransferBlob(blob.Digest, bytes.NewReader(blob.Content)))
+	require.Equal(1, corrupted)
+	require.Equal(3, patches)
+	ensureHasBlob(t, client, namespace, blob)
+}
+
+func TestTransferBlobCorruptChunkRejected(t *testing.T) {
+	require := require.New(t)
+
+	s := newTestServer(t, master1, hashRingMaxReplica(), newTestClientProvider())
+	defer s.cleanup()
+
+	blob := core.SizedBlobFixture(32, 4)
+
+	resp, err := httputil.Post(fmt.Sprintf("http://%s/internal/blobs/%s/uploads", s.addr, blob.Digest))
+	require.NoError(err)
+	uid := resp.Header.Get("Location")
+
+	chunkDigest, err := core.NewDigester().FromBytes(blob.Content[:16])
+	require.NoError(err)
+
+	_, err = httputil.Patch(
+		fmt.Sprintf("http://%s/internal/blobs/%s/uploads/%s", s.addr, blob.Digest, uid),
+		httputil.SendBody(bytes.NewReader(blob.Content[16:])),
+		httputil.SendHeaders(map[string]string{
+			"Content-Range":              "0-16",
+			blobclient.ChunkDigestHeader: chunkDigest.String(),
+		}))
+	require.True(httputil.IsStatus(err, http.StatusUnprocessableEntity))
+}
+
 func TestOverwriteMetainfo(t *testing.T) {
 	require := require.New(t)
 
@@ -531,10 +834,36 @@ func TestReplicateToRemote(t *testing.T) {
 	remote := "remote:80"
 
 	remoteCluster := s.expectRemoteCluster(remote)
+	remoteCluster.EXPECT().Stat(namespace, blob.Digest).Return(nil, blobclient.ErrBlobNotFound)
 	remoteCluster.EXPECT().UploadBlob(
 		namespace, blob.Digest, mockutil.MatchReader(blob.Content)).Return(nil)
 
-	require.NoError(cp.Provide(master1).ReplicateToRemote(namespace, blob.Digest, remote))
+	transferred, err := cp.Provide(master1).ReplicateToRemote(namespace, blob.Digest, remote)
+	require.NoError(err)
+	require.True(transferred)
+}
+
+func TestReplicateToRemoteSkipsBlobWhichRemoteHas(t *testing.T) {
+	require := require.New(t)
+
+	cp := newTestClientProvider()
+
+	s := newTestServer(t, master1, hashRingMaxReplica(), cp)
+	defer s.cleanup()
+
+	blob := core.NewBlobFixture()
+	namespace := core.TagFixture()
+
+	require.NoError(cp.Provide(master1).TransferBlob(blob.Digest, bytes.NewReader(blob.Content)))
+
+	remote := "remote:80"
+
+	remoteCluster := s.expectRemoteCluster(remote)
+	remoteCluster.EXPECT().Stat(namespace, blob.Digest).Return(blob.Info(), nil)
+
+	transferred, err := cp.Provide(master1).ReplicateToRemote(namespace, blob.Digest, remote)
+	require.NoError(err)
+	require.False(transferred)
 }
 
 func TestReplicateToRemoteInvalidParam(t *testing.T) {
@@ -590,11 +919,12 @@ func TestReplicateToRemoteWhenBlobInStorageBackend(t *testing.T) {
 	remote := "remote:80"
 
 	remoteCluster := s.expectRemoteCluster(remote)
+	remoteCluster.EXPECT().Stat(namespace, blob.Digest).Return(nil, blobclient.ErrBlobNotFound)
 	remoteCluster.EXPECT().UploadBlob(
 		namespace, blob.Digest, mockutil.MatchReader(blob.Content)).Return(nil)
 
 	require.NoError(testutil.PollUntilTrue(5*time.Second, func() bool {
-		err := cp.Provide(master1).ReplicateToRemote(namespace, blob.Digest, remote)
+		_, err := cp.Provide(master1).ReplicateToRemote(namespace, blob.Digest, remote)
 		return !httputil.IsAccepted(err)
 	}))
 }
@@ -631,6 +961,216 @@ func TestUploadBlobDuplicatesWriteBackTaskToReplicas(t *testing.T) {
 	require.Error(cp.Provide(s2.host).DeleteBlob(blob.Digest))
 }
 
+func TestStreamUploadBlobWithTrailerDigest(t *testing.T) {
+	require := require.New(t)
+
+	ring := hashRingNoReplica()
+	namespace := core.TagFixture()
+
+	cp := newTestClientProvider()
+
+	s := newTestServer(t, master1, ring, cp)
+	defer s.cleanup()
+
+	blob := computeBlobForHosts(ring, s.host)
+
+	s.writeBackManager.EXPECT().Add(
+		writeback.MatchTask(writeback.NewTask(namespace, blob.Digest.Hex(), 0))).Return(nil)
+
+	d, err := cp.Provide(s.host).StreamUploadBlob(namespace, bytes.NewReader(blob.Content))
+	require.NoError(err)
+	require.Equal(blob.Digest, d)
+
+	ensureHasBlob(t, cp.Provide(s.host), namespace, blob)
+}
+
+func TestStreamUploadBlobForwardsToOwner(t *testing.T) {
+	require := require.New(t)
+
+	ring := hashRingNoReplica()
+	namespace := core.TagFixture()
+
+	cp := newTestClientProvider()
+
+	s1 := newTestServer(t, master1, ring, cp)
+	defer s1.cleanup()
+
+	s2 := newTestServer(t, master2, ring, cp)
+	defer s2.cleanup()
+
+	blob := computeBlobForHosts(ring, s2.host)
+
+	s2.writeBackManager.EXPECT().Add(
+		writeback.MatchTask(writeback.NewTask(namespace, blob.Digest.Hex(), 0))).Return(nil)
+
+	d, err := cp.Provide(s1.host).StreamUploadBlob(namespace, bytes.NewReader(blob.Content))
+	require.NoError(err)
+	require.Equal(blob.Digest, d)
+
+	ensureHasBlob(t, cp.Provide(s2.host), namespace, blob)
+	_, err = s1.cas.GetCacheFileStat(blob.Digest.Hex())
+	require.True(os.IsNotExist(err))
+}
+
+func TestStreamUploadBlobRejectsTrailerDigestMismatch(t *testing.T) {
+	require := require.New(t)
+
+	ring := hashRingNoReplica()
+	namespace := core.TagFixture()
+
+	cp := newTestClientProvider()
+
+	s := newTestServer(t, master1, ring, cp)
+	defer s.cleanup()
+
+	blob := computeBlobForHosts(ring, s.host)
+	other := core.DigestFixture()
+
+	tests := []struct {
+		desc    string
+		trailer string
+		status  int
+	}{
+		{"mismatch", other.String(), http.StatusUnprocessableEntity},
+		{"missing", "", http.StatusBadRequest},
+		{"invalid", "foo", http.StatusBadRequest},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			trailer := http.Header{blobclient.BlobDigestTrailer: nil}
+			if test.trailer != "" {
+				trailer.Set(blobclient.BlobDigestTrailer, test.trailer)
+			}
+			_, err := httputil.Put(
+				fmt.Sprintf("http://%s/namespace/%s/blobs/uploads", s.addr, url.PathEscape(namespace)),
+				httputil.SendBody(bytes.NewReader(blob.Content)),
+				httputil.SendRequestHooks(func(req *http.Request) error {
+					req.ContentLength = -1
+					req.Trailer = trailer
+					return nil
+				}))
+			require.True(httputil.IsStatus(err, test.status), "%s", err)
+		})
+	}
+
+	_, err := s.cas.GetCacheFileStat(blob.Digest.Hex())
+	require.True(os.IsNotExist(err))
+	_, err = s.cas.GetCacheFileStat(other.Hex())
+	require.True(os.IsNotExist(err))
+}
+
+type countingReader struct {
+	r io.Reader
+	n *atomic.Int64
+}
+
+func (r countingReader) Read(b []byte) (int, error) {
+	n, err := r.r.Read(b)
+	r.n.Add(int64(n))
+	return n, err
+}
+
+// conditionalStreamUpload streams an upload of size bytes to addr which is
+// conditional on d, and returns the number of bytes which were sent.
+func conditionalStreamUpload(addr, namespace string, d core.Digest, size int64) (int64, error) {
+	body := countingReader{bytes.NewReader(make([]byte, size)), atomic.NewInt64(0)}
+	_, err := httputil.Put(
+		fmt.Sprintf("http://%s/namespace/%s/blobs/uploads", addr, url.PathEscape(namespace)),
+		httputil.SendBody(body),
+		httputil.SendHeaders(map[string]string{"If-None-Match": strconv.Quote(d.String())}),
+		httputil.SendAcceptedCodes(http.StatusNotModified),
+		httputil.SendRequestHooks(func(req *http.Request) error {
+			req.ContentLength = -1
+			req.Trailer = http.Header{blobclient.BlobDigestTrailer: nil}
+			return nil
+		}))
+	return body.n.Load(), err
+}
+
+func TestStreamUploadBlobIfNoneMatchSkipsTransfer(t *testing.T) {
+	require := require.New(t)
+
+	ring := hashRingNoReplica()
+	namespace := core.TagFixture()
+
+	cp := newTestClientProvider()
+
+	s := newTestServerWithConfig(t, Config{ConditionalUpload: true}, master1, ring, cp)
+	defer s.cleanup()
+
+	blob := computeBlobForHosts(ring, s.host)
+
+	// Written back once by the initial upload, and once more before the
+	// conditional upload is skipped.
+	s.writeBackManager.EXPECT().Add(
+		writeback.MatchTask(writeback.NewTask(namespace, blob.Digest.Hex(), 0))).Return(nil).Times(2)
+
+	_, err := cp.Provide(s.host).StreamUploadBlob(namespace, bytes.NewReader(blob.Content))
+	require.NoError(err)
+
+	const size = 64 << 20
+	sent, err := conditionalStreamUpload(s.addr, namespace, blob.Digest, size)
+	require.NoError(err)
+	require.True(sent < size/2, "sent %d of %d bytes", sent, size)
+}
+
+func TestStreamUploadBlobIfNoneMatchChecksOwner(t *testing.T) {
+	require := require.New(t)
+
+	ring := hashRingNoReplica()
+	namespace := core.TagFixture()
+
+	cp := newTestClientProvider()
+
+	s1 := newTestServerWithConfig(t, Config{ConditionalUpload: true}, master1, ring, cp)
+	defer s1.cleanup()
+
+	s2 := newTestServer(t, master2, ring, cp)
+	defer s2.cleanup()
+
+	blob := computeBlobForHosts(ring, s2.host)
+
+	s2.writeBackManager.EXPECT().Add(
+		writeback.MatchTask(writeback.NewTask(namespace, blob.Digest.Hex(), 0))).Return(nil)
+
+	require.NoError(cp.Provide(s2.host).UploadBlob(namespace, blob.Digest, bytes.NewReader(blob.Content)))
+
+	const size = 64 << 20
+	sent, err := conditionalStreamUpload(s1.addr, namespace, blob.Digest, size)
+	require.NoError(err)
+	require.True(sent < size/2, "sent %d of %d bytes", sent, size)
+}
+
+func TestStreamUploadBlobIfNoneMatchUploadsMissingBlob(t *testing.T) {
+	require := require.New(t)
+
+	ring := hashRingNoReplica()
+	namespace := core.TagFixture()
+
+	cp := newTestClientProvider()
+
+	s := newTestServerWithConfig(t, Config{ConditionalUpload: true}, master1, ring, cp)
+	defer s.cleanup()
+
+	blob := computeBlobForHosts(ring, s.host)
+
+	s.writeBackManager.EXPECT().Add(
+		writeback.MatchTask(writeback.NewTask(namespace, blob.Digest.Hex(), 0))).Return(nil)
+
+	_, err := httputil.Put(
+		fmt.Sprintf("http://%s/namespace/%s/blobs/uploads", s.addr, url.PathEscape(namespace)),
+		httputil.SendBody(bytes.NewReader(blob.Content)),
+		httputil.SendHeaders(map[string]string{"If-None-Match": strconv.Quote(blob.Digest.String())}),
+		httputil.SendRequestHooks(func(req *http.Request) error {
+			req.ContentLength = -1
+			req.Trailer = http.Header{blobclient.BlobDigestTrailer: []string{blob.Digest.String()}}
+			return nil
+		}))
+	require.NoError(err)
+
+	ensureHasBlob(t, cp.Provide(s.host), namespace, blob)
+}
+
 func TestUploadBlobRetriesWriteBackFailure(t *testing.T) {
 	require := require.New(t)
 
@@ -94,7 +94,8 @@ type testServer struct {
 	ctrl             *gomock.Controller
 	host             string
 	addr             string
-	cas              *store.CAStore
+	server           *Server
+	cas              store.Driver
 	cp               *testClientProvider
 	clusterProvider  *mockblobclient.MockClusterProvider
 	pctx             core.PeerContext
@@ -107,6 +108,16 @@ type testServer struct {
 func newTestServer(
 	t *testing.T, host string, ring hashring.Ring, cp *testClientProvider) *testServer {
 
+	return newTestServerWithConfig(t, Config{}, host, ring, cp)
+}
+
+func newTestServerWithConfig(
+	t *testing.T,
+	config Config,
+	host string,
+	ring hashring.Ring,
+	cp *testClientProvider) *testServer {
+
 	var cleanup testutil.Cleanup
 	defer cleanup.Recover()
 
@@ -117,8 +128,7 @@ func newTestServer(
 
 	pctx := core.PeerContextFixture()
 
-	cas, c := store.CAStoreFixture()
-	cleanup.Add(c)
+	cas := store.NewMemoryDriver()
 
 	bm := backend.ManagerFixture()
 
@@ -132,7 +142,7 @@ func newTestServer(
 	clk.Set(time.Now())
 
 	s, err := New(
-		Config{}, tally.NoopScope, clk, host, ring, cas, cp, clusterProvider, pctx,
+		config, tally.NoopScope, clk, host, ring, cas, cp, clusterProvider, pctx,
 		bm, br, mg, writeBackManager)
 	if err != nil {
 		panic(err)
@@ -147,6 +157,7 @@ func newTestServer(
 		ctrl:             ctrl,
 		host:             host,
 		addr:             addr,
+		server:           s,
 		cas:              cas,
 		cp:               cp,
 		clusterProvider:  clusterProvider,
@@ -21,33 +21,38 @@ import (
 	"github.com/docker/distribution/uuid"
 	"github.com/uber/kraken/core"
 	"github.com/uber/kraken/lib/store"
+	"github.com/uber/kraken/origin/blobclient"
 	"github.com/uber/kraken/utils/handler"
 )
 
 // uploader executes a chunked upload.
 type uploader struct {
-	cas *store.CAStore
+	cas      store.Driver
+	verifier *verifier
 }
 
-func newUploader(cas *store.CAStore) *uploader {
-	return &uploader{cas}
+func newUploader(cas store.Driver, verifier *verifier) *uploader {
+	return &uploader{cas, verifier}
 }
 
-func (u *uploader) start(d core.Digest) (uid string, err error) {
+func (u *uploader) start(namespace string, d core.Digest) (uid string, err error) {
 	if ok, err := blobExists(u.cas, d); err != nil {
 		return "", err
 	} else if ok {
 		return "", handler.ErrorStatus(http.StatusConflict)
 	}
 	uid = uuid.Generate().String()
-	if err := u.cas.CreateUploadFile(uid, 0); err != nil {
+	if err := u.cas.CreateUploadFileInNamespace(namespace, uid, 0); err != nil {
 		return "", handler.Errorf("create upload file: %s", err)
 	}
 	return uid, nil
 }
 
+// patch writes chunk into the upload file at [start, end). If chunkDigest is
+// set, the chunk is verified against it such that corrupt chunks are rejected
+// immediately, rather than only once the whole blob is committed.
 func (u *uploader) patch(
-	d core.Digest, uid string, chunk io.Reader, start, end int64) error {
+	d core.Digest, uid string, chunk io.Reader, start, end int64, chunkDigest *core.Digest) error {
 
 	if ok, err := blobExists(u.cas, d); err != nil {
 		return err
@@ -65,14 +70,85 @@ func (u *uploader) patch(
 	if _, err := f.Seek(start, 0); err != nil {
 		return handler.Errorf("seek offset %d: %s", start, err).Status(http.StatusBadRequest)
 	}
+	var digester *core.Digester
+	if chunkDigest != nil {
+		digester, err = core.NewDigesterWithAlgo(chunkDigest.Algo())
+		if err != nil {
+			return handler.Errorf("chunk digester: %s", err).Status(http.StatusBadRequest)
+		}
+		chunk = digester.Tee(chunk)
+	}
 	if _, err := io.CopyN(f, chunk, end-start); err != nil {
 		return handler.Errorf("copy: %s", err)
 	}
+	if digester != nil {
+		// Corrupt bytes are left in the upload file, and are overwritten when the
+		// client re-sends the chunk.
+		if actual := digester.Digest(); actual != *chunkDigest {
+			return handler.Errorf(
+				"chunk %d-%d digest mismatch: expected %s, got %s",
+				start, end, chunkDigest, actual).Status(http.StatusUnprocessableEntity)
+		}
+	}
 	return nil
 }
 
-func (u *uploader) commit(d core.Digest, uid string) error {
-	if err := u.cas.MoveUploadFileToCache(uid, d.Hex()); err != nil {
+// stream writes body into a new upload file, and returns the digest declared by
+// the BlobDigestTrailer trailer of r once body is read. The declared digest is
+// verified against the received content, and the upload file is deleted if
+// the upload fails.
+func (u *uploader) stream(
+	r *http.Request, namespace, algo string) (d core.Digest, uid string, err error) {
+
+	digester, err := core.NewDigesterWithAlgo(algo)
+	if err != nil {
+		return core.Digest{}, "", handler.Errorf("digester: %s", err).Status(http.StatusBadRequest)
+	}
+	uid = uuid.Generate().String()
+	if err := u.cas.CreateUploadFileInNamespace(namespace, uid, 0); err != nil {
+		return core.Digest{}, "", handler.Errorf("create upload file: %s", err)
+	}
+	defer func() {
+		if err != nil {
+			u.cas.DeleteUploadFile(uid)
+		}
+	}()
+	f, err := u.cas.GetUploadFileReadWriter(uid)
+	if err != nil {
+		return core.Digest{}, "", handler.Errorf("get upload file: %s", err)
+	}
+	defer f.Close()
+	if _, err := io.Copy(f, digester.Tee(r.Body)); err != nil {
+		return core.Digest{}, "", handler.Errorf("copy: %s", err)
+	}
+
+	// Trailers are only populated once the body was read to EOF.
+	raw := r.Trailer.Get(blobclient.BlobDigestTrailer)
+	if raw == "" {
+		return core.Digest{}, "", handler.Errorf(
+			"no %s trailer", blobclient.BlobDigestTrailer).Status(http.StatusBadRequest)
+	}
+	d, err = core.ParseDigest(raw)
+	if err != nil {
+		return core.Digest{}, "", handler.Errorf(
+			"cannot parse %s trailer %q: %s", blobclient.BlobDigestTrailer, raw, err).
+			Status(http.StatusBadRequest)
+	}
+	if actual := digester.Digest(); actual != d {
+		return core.Digest{}, "", handler.Errorf(
+			"digest mismatch: declared %s, got %s", d, actual).
+			Status(http.StatusUnprocessableEntity)
+	}
+	return d, uid, nil
+}
+
+// commit verifies upload uid against d, and moves it into the cache. Uploads
+// are verified once namespace is granted a verification slot.
+func (u *uploader) commit(namespace string, d core.Digest, uid string) error {
+	err := u.verifier.do(namespace, func() error {
+		return u.cas.MoveUploadFileToCache(uid, d.Hex())
+	})
+	if err != nil {
 		if os.IsNotExist(err) {
 			return handler.ErrorStatus(http.StatusNotFound)
 		}
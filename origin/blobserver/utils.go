@@ -21,9 +21,26 @@ import (
 
 	"github.com/uber/kraken/core"
 	"github.com/uber/kraken/lib/store"
+	"github.com/uber/kraken/origin/blobclient"
 	"github.com/uber/kraken/utils/handler"
 )
 
+// parseChunkDigest parses the optional digest of an upload chunk. Returns nil
+// if no digest was sent.
+func parseChunkDigest(h http.Header) (*core.Digest, error) {
+	raw := h.Get(blobclient.ChunkDigestHeader)
+	if raw == "" {
+		return nil, nil
+	}
+	d, err := core.ParseDigest(raw)
+	if err != nil {
+		return nil, handler.Errorf(
+			"cannot parse %s header %q: %s", blobclient.ChunkDigestHeader, raw, err).
+			Status(http.StatusBadRequest)
+	}
+	return &d, nil
+}
+
 // parseContentRange parses start / end integers from a Content-Range header.
 func parseContentRange(h http.Header) (start, end int64, err error) {
 	contentRange := h.Get("Content-Range")
@@ -53,8 +70,60 @@ func parseContentRange(h http.Header) (start, end int64, err error) {
 	return start, end, nil
 }
 
+// parseRange parses a Range header value h of a blob of the given size. Returns
+// false if h is not a single byte range, in which case the full blob should be
+// served instead.
+func parseRange(h string, size int64) (byteRange, bool, error) {
+	if !strings.HasPrefix(h, "bytes=") || strings.Contains(h, ",") {
+		return byteRange{}, false, nil
+	}
+	spec := strings.TrimSpace(strings.TrimPrefix(h, "bytes="))
+	parts := strings.Split(spec, "-")
+	if len(parts) != 2 {
+		return byteRange{}, false, handler.Errorf(
+			"invalid range %q", h).Status(http.StatusRequestedRangeNotSatisfiable)
+	}
+	var r byteRange
+	if parts[0] == "" {
+		// Suffix range of the last n bytes.
+		n, err := strconv.ParseInt(parts[1], 10, 64)
+		if err != nil || n <= 0 {
+			return byteRange{}, false, handler.Errorf(
+				"invalid range %q", h).Status(http.StatusRequestedRangeNotSatisfiable)
+		}
+		if n > size {
+			n = size
+		}
+		r = byteRange{size - n, size}
+	} else {
+		start, err := strconv.ParseInt(parts[0], 10, 64)
+		if err != nil || start < 0 {
+			return byteRange{}, false, handler.Errorf(
+				"invalid range %q", h).Status(http.StatusRequestedRangeNotSatisfiable)
+		}
+		end := size
+		if parts[1] != "" {
+			last, err := strconv.ParseInt(parts[1], 10, 64)
+			if err != nil || last < start {
+				return byteRange{}, false, handler.Errorf(
+					"invalid range %q", h).Status(http.StatusRequestedRangeNotSatisfiable)
+			}
+			if last+1 < end {
+				end = last + 1
+			}
+		}
+		r = byteRange{start, end}
+	}
+	if r.start >= size || r.len() <= 0 {
+		return byteRange{}, false, handler.Errorf(
+			"range %q not satisfiable for size %d", h, size).
+			Status(http.StatusRequestedRangeNotSatisfiable)
+	}
+	return r, true, nil
+}
+
 // blobExists returns true if cas has a cached blob for d.
-func blobExists(cas *store.CAStore, d core.Digest) (bool, error) {
+func blobExists(cas store.Driver, d core.Digest) (bool, error) {
 	if _, err := cas.GetCacheFileStat(d.Hex()); err != nil {
 		if os.IsNotExist(err) {
 			return false, nil
@@ -75,3 +144,38 @@ func setContentLength(w http.ResponseWriter, n int) {
 func setOctetStreamContentType(w http.ResponseWriter) {
 	w.Header().Set("Content-Type", "application/octet-stream-v1")
 }
+
+// setETag sets the ETag of a blob response to the blob digest.
+func setETag(w http.ResponseWriter, d core.Digest) {
+	w.Header().Set("ETag", strconv.Quote(d.String()))
+}
+
+// parseIfNoneMatchDigest parses the digest named by the If-None-Match header
+// value h, either as a bare digest or as an ETag.
+func parseIfNoneMatchDigest(h string) (core.Digest, bool) {
+	v := strings.TrimPrefix(strings.TrimSpace(h), "W/")
+	if unquoted, err := strconv.Unquote(v); err == nil {
+		v = unquoted
+	}
+	d, err := core.ParseDigest(v)
+	if err != nil {
+		return core.Digest{}, false
+	}
+	return d, true
+}
+
+// etagMatches returns true if the If-None-Match header value h matches the
+// ETag of d.
+func etagMatches(h string, d core.Digest) bool {
+	if h == "" {
+		return false
+	}
+	etag := strconv.Quote(d.String())
+	for _, v := range strings.Split(h, ",") {
+		v = strings.TrimPrefix(strings.TrimSpace(v), "W/")
+		if v == etag {
+			return true
+		}
+	}
+	return false
+}
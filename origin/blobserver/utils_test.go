@@ -14,9 +14,11 @@
 package blobserver
 
 import (
+	"fmt"
 	"net/http"
 	"testing"
 
+	"github.com/uber/kraken/core"
 	"github.com/uber/kraken/utils/handler"
 	"github.com/stretchr/testify/require"
 )
@@ -45,3 +47,26 @@ func TestParseContentRangeHeaderBadRequests(t *testing.T) {
 		})
 	}
 }
+
+func TestETagMatches(t *testing.T) {
+	d := core.DigestFixture()
+	other := core.DigestFixture()
+
+	tests := []struct {
+		desc     string
+		header   string
+		expected bool
+	}{
+		{"empty", "", false},
+		{"exact", fmt.Sprintf("%q", d), true},
+		{"weak", fmt.Sprintf("W/%q", d), true},
+		{"list", fmt.Sprintf("%q, %q", other, d), true},
+		{"unquoted", d.String(), false},
+		{"other", fmt.Sprintf("%q", other), false},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			require.Equal(t, test.expected, etagMatches(test.header, d))
+		})
+	}
+}
@@ -0,0 +1,166 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package blobserver
+
+import (
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/uber/kraken/metrics"
+
+	"github.com/uber-go/tally"
+)
+
+// _transferNamespace is the namespace internal blob transfers are verified
+// under, since they do not carry one.
+const _transferNamespace = "_transfer"
+
+// VerificationConfig defines fair scheduling of upload verification across
+// namespaces. Verifying large uploads is CPU-bound, therefore when enabled,
+// commits of uploads share a bounded number of verification slots. Free slots
+// are granted to the waiting namespace with the fewest active verifications,
+// and no namespace holds more than PerNamespace slots at once, such that bulk
+// uploads to one namespace do not starve interactive uploads to others.
+type VerificationConfig struct {
+	Enabled bool `yaml:"enabled"`
+
+	// Concurrency is the total number of concurrent verifications. Defaults
+	// to the number of CPUs.
+	Concurrency int `yaml:"concurrency"`
+
+	// PerNamespace is the number of concurrent verifications of a single
+	// namespace. Defaults to half of Concurrency.
+	PerNamespace int `yaml:"per_namespace"`
+}
+
+func (c VerificationConfig) applyDefaults() VerificationConfig {
+	if c.Concurrency == 0 {
+		c.Concurrency = runtime.NumCPU()
+	}
+	if c.PerNamespace == 0 {
+		c.PerNamespace = c.Concurrency / 2
+	}
+	if c.PerNamespace < 1 {
+		c.PerNamespace = 1
+	}
+	return c
+}
+
+// verifier grants verification slots to namespaces.
+type verifier struct {
+	config     VerificationConfig
+	stats      tally.Scope
+	namespaces *metrics.NamespaceTagger
+
+	mu      sync.Mutex
+	inuse   int
+	active  map[string]int
+	waiting map[string][]chan struct{}
+}
+
+func newVerifier(
+	config VerificationConfig, stats tally.Scope, namespaces *metrics.NamespaceTagger) *verifier {
+
+	if !config.Enabled {
+		return nil
+	}
+	return &verifier{
+		config:     config.applyDefaults(),
+		stats:      stats,
+		namespaces: namespaces,
+		active:     make(map[string]int),
+		waiting:    make(map[string][]chan struct{}),
+	}
+}
+
+// do runs verify once namespace is granted a verification slot. Runs verify
+// immediately if v is nil.
+func (v *verifier) do(namespace string, verify func() error) error {
+	if v == nil {
+		return verify()
+	}
+	v.acquire(namespace)
+	defer v.release(namespace)
+
+	return verify()
+}
+
+func (v *verifier) eligible(namespace string) bool {
+	return v.inuse < v.config.Concurrency && v.active[namespace] < v.config.PerNamespace
+}
+
+func (v *verifier) acquire(namespace string) {
+	start := time.Now()
+	defer func() {
+		v.stats.Tagged(map[string]string{
+			"namespace": v.namespaces.Tag(namespace),
+		}).Timer("verification_queue_wait").Record(time.Since(start))
+	}()
+
+	v.mu.Lock()
+	if v.eligible(namespace) && len(v.waiting[namespace]) == 0 {
+		v.inuse++
+		v.active[namespace]++
+		v.mu.Unlock()
+		return
+	}
+	c := make(chan struct{})
+	v.waiting[namespace] = append(v.waiting[namespace], c)
+	v.mu.Unlock()
+
+	<-c
+}
+
+// release returns a verification slot of namespace and grants free slots to
+// waiters.
+func (v *verifier) release(namespace string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	v.inuse--
+	if v.active[namespace]--; v.active[namespace] == 0 {
+		delete(v.active, namespace)
+	}
+	for {
+		next, ok := v.next()
+		if !ok {
+			return
+		}
+		c := v.waiting[next][0]
+		if v.waiting[next] = v.waiting[next][1:]; len(v.waiting[next]) == 0 {
+			delete(v.waiting, next)
+		}
+		v.inuse++
+		v.active[next]++
+		close(c)
+	}
+}
+
+// next returns the eligible waiting namespace with the fewest active
+// verifications. Ties are broken by namespace for determinism.
+func (v *verifier) next() (string, bool) {
+	var best string
+	var found bool
+	for ns := range v.waiting {
+		if !v.eligible(ns) {
+			continue
+		}
+		if !found || v.active[ns] < v.active[best] ||
+			(v.active[ns] == v.active[best] && ns < best) {
+			best, found = ns, true
+		}
+	}
+	return best, found
+}
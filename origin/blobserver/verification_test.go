@@ -0,0 +1,145 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package blobserver
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/uber/kraken/metrics"
+	"github.com/uber/kraken/utils/testutil"
+
+	"github.com/stretchr/testify/require"
+	"github.com/uber-go/tally"
+)
+
+func TestVerifierDisabledRunsImmediately(t *testing.T) {
+	require := require.New(t)
+
+	v := newVerifier(VerificationConfig{}, tally.NoopScope, nil)
+	require.Nil(v)
+
+	var ran bool
+	require.NoError(v.do("ns", func() error {
+		ran = true
+		return nil
+	}))
+	require.True(ran)
+}
+
+func TestVerifierFloodDoesNotBlockOtherNamespace(t *testing.T) {
+	require := require.New(t)
+
+	v := newVerifier(VerificationConfig{
+		Enabled:      true,
+		Concurrency:  4,
+		PerNamespace: 2,
+	}, tally.NoopScope, nil)
+
+	unblock := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			v.do("bulk", func() error {
+				<-unblock
+				return nil
+			})
+		}()
+	}
+	defer func() {
+		close(unblock)
+		wg.Wait()
+	}()
+
+	// Wait until the flood holds every slot it may hold.
+	require.NoError(testutil.PollUntilTrue(5*time.Second, func() bool {
+		v.mu.Lock()
+		defer v.mu.Unlock()
+		return v.active["bulk"] == 2 && len(v.waiting["bulk"]) == 18
+	}))
+
+	done := make(chan struct{})
+	go func() {
+		v.do("interactive", func() error { return nil })
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		require.FailNow("interactive verification blocked by bulk verifications")
+	}
+}
+
+func TestVerifierBoundsTotalConcurrency(t *testing.T) {
+	require := require.New(t)
+
+	v := newVerifier(VerificationConfig{
+		Enabled:      true,
+		Concurrency:  3,
+		PerNamespace: 2,
+	}, tally.NoopScope, nil)
+
+	var mu sync.Mutex
+	var active, max int
+	var wg sync.WaitGroup
+	for i := 0; i < 30; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			v.do(fmt.Sprintf("ns-%d", i%5), func() error {
+				mu.Lock()
+				active++
+				if active > max {
+					max = active
+				}
+				mu.Unlock()
+				time.Sleep(time.Millisecond)
+				mu.Lock()
+				active--
+				mu.Unlock()
+				return nil
+			})
+		}(i)
+	}
+	wg.Wait()
+
+	require.True(max <= 3, "max concurrency %d", max)
+	require.Empty(v.active)
+	require.Empty(v.waiting)
+	require.Equal(0, v.inuse)
+}
+
+func TestVerifierTagsQueueWaitWithNamespacePatterns(t *testing.T) {
+	require := require.New(t)
+
+	namespaces, err := metrics.NamespacesConfig{Patterns: []string{"library/.*"}}.Build()
+	require.NoError(err)
+
+	stats := tally.NewTestScope("", nil)
+	v := newVerifier(VerificationConfig{Enabled: true}, stats, namespaces)
+
+	for _, ns := range []string{"library/a", "library/b", "team-1/a", "team-2/a"} {
+		require.NoError(v.do(ns, func() error { return nil }))
+	}
+
+	tags := make(map[string]int)
+	for _, timer := range stats.Snapshot().Timers() {
+		tags[timer.Tags()["namespace"]] += len(timer.Values())
+	}
+	require.Equal(map[string]int{"library/.*": 2, metrics.OtherNamespace: 2}, tags)
+}
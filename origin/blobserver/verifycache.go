@@ -0,0 +1,149 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package blobserver
+
+import (
+	"os"
+	"time"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/uber-go/tally"
+
+	"github.com/uber/kraken/lib/store"
+	"github.com/uber/kraken/lib/store/metadata"
+	"github.com/uber/kraken/utils/log"
+)
+
+// VerificationCacheConfig defines caching of the verification of blobs which
+// are verified on every serve, such as assembled blobs. A blob which passed
+// verification is trusted for ReverifyInterval, such that hot blobs are not
+// re-hashed on every serve. If ScrubInterval is set, all stored blobs are
+// re-hashed in the background at that interval, and corrupt blobs are
+// quarantined, such that latent corruption is still caught.
+type VerificationCacheConfig struct {
+	Enabled bool `yaml:"enabled"`
+
+	ReverifyInterval time.Duration `yaml:"reverify_interval"`
+
+	// ScrubInterval is the interval between background scrubs. Zero disables
+	// scrubbing.
+	ScrubInterval time.Duration `yaml:"scrub_interval"`
+}
+
+func (c VerificationCacheConfig) applyDefaults() VerificationCacheConfig {
+	if c.ReverifyInterval == 0 {
+		c.ReverifyInterval = time.Hour
+	}
+	return c
+}
+
+// verificationCache records when blobs passed verification in their metadata.
+// A nil verificationCache records nothing, such that blobs are always verified.
+type verificationCache struct {
+	config VerificationCacheConfig
+	stats  tally.Scope
+	clk    clock.Clock
+	cas    store.Driver
+}
+
+func newVerificationCache(
+	config VerificationCacheConfig,
+	stats tally.Scope,
+	clk clock.Clock,
+	cas store.Driver) *verificationCache {
+
+	if !config.Enabled {
+		return nil
+	}
+	return &verificationCache{
+		config: config.applyDefaults(),
+		stats:  stats.SubScope("verification_cache"),
+		clk:    clk,
+		cas:    cas,
+	}
+}
+
+// fresh returns whether name passed verification within the reverify interval.
+func (c *verificationCache) fresh(name string) bool {
+	if c == nil {
+		return false
+	}
+	var v metadata.VerifiedAt
+	if err := c.cas.GetCacheFileMetadata(name, &v); err != nil {
+		if !os.IsNotExist(err) {
+			log.With("name", name).Errorf("Error getting verified at metadata: %s", err)
+		}
+		c.stats.Counter("misses").Inc(1)
+		return false
+	}
+	if c.clk.Now().Sub(v.Time) > c.config.ReverifyInterval {
+		c.stats.Counter("expired").Inc(1)
+		return false
+	}
+	c.stats.Counter("hits").Inc(1)
+	return true
+}
+
+// record records that name passed verification now.
+func (c *verificationCache) record(name string) {
+	if c == nil {
+		return
+	}
+	if _, err := c.cas.SetCacheFileMetadata(name, metadata.NewVerifiedAt(c.clk.Now())); err != nil {
+		log.With("name", name).Errorf("Error setting verified at metadata: %s", err)
+	}
+}
+
+// Scrub re-hashes all stored blobs in the background at the configured scrub
+// interval, and quarantines corrupt blobs. Should be called on startup. Does
+// nothing if scrubbing is disabled.
+func (s *Server) Scrub() {
+	c := s.verifications
+	if c == nil || c.config.ScrubInterval == 0 {
+		return
+	}
+	ticker := c.clk.Ticker(c.config.ScrubInterval)
+	go func() {
+		for range ticker.C {
+			s.scrub()
+		}
+	}()
+}
+
+func (s *Server) scrub() {
+	c := s.verifications
+	names, err := s.cas.ListCacheFiles()
+	if err != nil {
+		log.Errorf("Error listing blobs for scrubbing: %s", err)
+		return
+	}
+	for _, name := range names {
+		ok, err := verifyBlob(s.cas, name)
+		if err != nil {
+			if !os.IsNotExist(err) {
+				log.With("name", name).Errorf("Error scrubbing blob: %s", err)
+			}
+			continue
+		}
+		c.stats.Counter("scrubbed").Inc(1)
+		if ok {
+			continue
+		}
+		c.stats.Counter("scrub_corrupt").Inc(1)
+		log.With("name", name).Error("Quarantining corrupt blob found by scrub")
+		if err := quarantineBlob(s.cas, name, s.config.Preverify.QuarantineDir); err != nil {
+			log.With("name", name).Errorf("Error quarantining corrupt blob: %s", err)
+		}
+	}
+}
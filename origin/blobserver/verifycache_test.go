@@ -0,0 +1,90 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package blobserver
+
+import (
+	"bytes"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/store"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerificationCacheSkipsRecentlyVerifiedAssembledBlobs(t *testing.T) {
+	require := require.New(t)
+
+	config := Config{
+		Assembly: AssemblyConfig{Enabled: true},
+		VerificationCache: VerificationCacheConfig{
+			Enabled:          true,
+			ReverifyInterval: time.Hour,
+		},
+	}
+	s := newTestServerWithConfig(t, config, master1, hashRingNoReplica(), newTestClientProvider())
+	defer s.cleanup()
+
+	chunks, manifest, whole := chunkedBlobFixture(t, 3)
+	for _, c := range append(chunks, manifest) {
+		require.NoError(s.cas.CreateCacheFile(c.Digest.Hex(), bytes.NewReader(c.Content)))
+	}
+
+	status, body := getAssembled(t, s.addr, "ns", manifest.Digest)
+	require.Equal(http.StatusOK, status)
+	require.Equal(whole, body)
+
+	// Corrupting a chunk goes unnoticed while the verification is fresh, which
+	// shows that the chunks are not re-hashed.
+	corrupt := bytes.Repeat([]byte("x"), len(chunks[0].Content))
+	require.NoError(s.cas.(*store.MemoryDriver).Corrupt(chunks[0].Digest.Hex(), corrupt))
+
+	status, body = getAssembled(t, s.addr, "ns", manifest.Digest)
+	require.Equal(http.StatusOK, status)
+	require.NotEqual(whole, body)
+
+	// Once expired, the assembled blob is verified again.
+	s.clk.Add(2 * time.Hour)
+
+	status, _ = getAssembled(t, s.addr, "ns", manifest.Digest)
+	require.Equal(http.StatusInternalServerError, status)
+}
+
+func TestScrubQuarantinesCorruptBlobs(t *testing.T) {
+	require := require.New(t)
+
+	config := Config{VerificationCache: VerificationCacheConfig{
+		Enabled:       true,
+		ScrubInterval: time.Hour,
+	}}
+	s := newTestServerWithConfig(t, config, master1, hashRingNoReplica(), newTestClientProvider())
+	defer s.cleanup()
+
+	good := core.NewBlobFixture()
+	corrupt := core.NewBlobFixture()
+	for _, blob := range []*core.BlobFixture{good, corrupt} {
+		require.NoError(s.cas.CreateCacheFile(blob.Digest.Hex(), bytes.NewReader(blob.Content)))
+	}
+	require.NoError(s.cas.(*store.MemoryDriver).Corrupt(corrupt.Digest.Hex(), []byte("corrupt")))
+
+	s.server.scrub()
+
+	_, err := s.cas.GetCacheFileStat(good.Digest.Hex())
+	require.NoError(err)
+	_, err = s.cas.GetCacheFileStat(corrupt.Digest.Hex())
+	require.True(os.IsNotExist(err))
+}
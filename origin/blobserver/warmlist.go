@@ -0,0 +1,269 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package blobserver
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/blobrefresh"
+	"github.com/uber/kraken/utils/log"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/c2h5oh/datasize"
+	"github.com/uber-go/tally"
+	"golang.org/x/time/rate"
+)
+
+// WarmListConfig defines persistence of the working set of an origin across
+// restarts. The most recently downloaded or seeded blobs are saved on graceful
+// shutdown, and re-fetched from the backend in the background on startup, such
+// that restarted origins do not stampede the backend with cold downloads.
+type WarmListConfig struct {
+	Enabled bool `yaml:"enabled"`
+
+	// Path is the file the warm list is saved to.
+	Path string `yaml:"path"`
+
+	// MaxEntries bounds the number of blobs in the warm list.
+	MaxEntries int `yaml:"max_entries"`
+
+	// MaxSize optionally bounds the total size of blobs warmed on startup.
+	MaxSize datasize.ByteSize `yaml:"max_size"`
+
+	// MaxDiskUtil bounds the fraction of the cache volume which may be used
+	// once blobs are warmed, such that warming never fills the disk beyond
+	// what cache cleanup keeps free.
+	MaxDiskUtil float64 `yaml:"max_disk_util"`
+
+	// MaxAge skips blobs which were last downloaded longer ago than MaxAge
+	// before shutdown, since they are no longer part of the working set.
+	MaxAge time.Duration `yaml:"max_age"`
+
+	// RPS limits the rate at which blobs are re-fetched on startup.
+	RPS float64 `yaml:"rps"`
+}
+
+func (c WarmListConfig) applyDefaults() WarmListConfig {
+	if c.MaxEntries == 0 {
+		c.MaxEntries = 10000
+	}
+	if c.MaxDiskUtil == 0 {
+		c.MaxDiskUtil = 0.8
+	}
+	if c.MaxAge == 0 {
+		c.MaxAge = 6 * time.Hour
+	}
+	if c.RPS == 0 {
+		c.RPS = 5
+	}
+	return c
+}
+
+// warmEntry is a blob in the warm list.
+type warmEntry struct {
+	Namespace  string      `json:"namespace"`
+	Digest     core.Digest `json:"digest"`
+	Size       int64       `json:"size"`
+	LastAccess time.Time   `json:"last_access"`
+}
+
+// warmList tracks the most recently downloaded blobs. A nil warmList records
+// nothing.
+type warmList struct {
+	config WarmListConfig
+	stats  tally.Scope
+	clk    clock.Clock
+
+	mu      sync.Mutex
+	lru     *list.List
+	entries map[core.Digest]*list.Element
+}
+
+func newWarmList(config WarmListConfig, stats tally.Scope, clk clock.Clock) *warmList {
+	if !config.Enabled {
+		return nil
+	}
+	return &warmList{
+		config:  config.applyDefaults(),
+		stats:   stats.SubScope("warm_list"),
+		clk:     clk,
+		lru:     list.New(),
+		entries: make(map[core.Digest]*list.Element),
+	}
+}
+
+// record marks d of namespace as recently downloaded or seeded.
+func (l *warmList) record(namespace string, d core.Digest, size int64) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	entry := &warmEntry{namespace, d, size, l.clk.Now()}
+	if e, ok := l.entries[d]; ok {
+		e.Value = entry
+		l.lru.MoveToFront(e)
+		return
+	}
+	l.entries[d] = l.lru.PushFront(entry)
+	for l.lru.Len() > l.config.MaxEntries {
+		e := l.lru.Back()
+		l.lru.Remove(e)
+		delete(l.entries, e.Value.(*warmEntry).Digest)
+	}
+}
+
+// save persists the warm list, most recently downloaded first. The previous
+// warm list is atomically replaced.
+func (l *warmList) save() error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	entries := make([]*warmEntry, 0, l.lru.Len())
+	for e := l.lru.Front(); e != nil; e = e.Next() {
+		entries = append(entries, e.Value.(*warmEntry))
+	}
+	l.mu.Unlock()
+
+	b, err := json.Marshal(entries)
+	if err != nil {
+		return fmt.Errorf("json marshal: %s", err)
+	}
+	f, err := ioutil.TempFile(filepath.Dir(l.config.Path), filepath.Base(l.config.Path)+".")
+	if err != nil {
+		return fmt.Errorf("create temp file: %s", err)
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return fmt.Errorf("write temp file: %s", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("close temp file: %s", err)
+	}
+	if err := os.Rename(f.Name(), l.config.Path); err != nil {
+		return fmt.Errorf("rename: %s", err)
+	}
+	return nil
+}
+
+// load returns the persisted warm list, or nil if none was saved.
+func (l *warmList) load() ([]*warmEntry, error) {
+	b, err := ioutil.ReadFile(l.config.Path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("read file: %s", err)
+	}
+	var entries []*warmEntry
+	if err := json.Unmarshal(b, &entries); err != nil {
+		return nil, fmt.Errorf("json unmarshal: %s", err)
+	}
+	return entries, nil
+}
+
+// diskBudget returns how many bytes may be written to the volume of dir before
+// its utilization exceeds maxUtil.
+func diskBudget(dir string, maxUtil float64) (int64, error) {
+	var fs syscall.Statfs_t
+	if err := syscall.Statfs(dir, &fs); err != nil {
+		return 0, err
+	}
+	total := int64(fs.Blocks) * int64(fs.Bsize)
+	used := int64(fs.Blocks-fs.Bavail) * int64(fs.Bsize)
+	return int64(maxUtil*float64(total)) - used, nil
+}
+
+// warm re-fetches the blobs of the persisted warm list which are missing from
+// disk, most recently used first, until the volume of cacheDir reaches
+// MaxDiskUtil. Warmed blobs are recorded, such that they remain in the warm
+// list even if they are not downloaded before the next shutdown.
+func (s *Server) warm(ctx context.Context, cacheDir string) {
+	l := s.warmList
+	entries, err := l.load()
+	if err != nil {
+		log.Errorf("Error loading warm list: %s", err)
+		return
+	}
+	if len(entries) == 0 {
+		return
+	}
+	budget, err := diskBudget(cacheDir, l.config.MaxDiskUtil)
+	if err != nil {
+		log.Errorf("Error checking disk usage of %s: %s", cacheDir, err)
+		return
+	}
+	log.Infof("Warming %d blobs from warm list", len(entries))
+
+	limiter := rate.NewLimiter(rate.Limit(l.config.RPS), 1)
+	var newest time.Time
+	for _, e := range entries {
+		if e.LastAccess.After(newest) {
+			newest = e.LastAccess
+		}
+	}
+	var size, fetched int64
+	for _, e := range entries {
+		if newest.Sub(e.LastAccess) > l.config.MaxAge {
+			l.stats.Counter("skipped_stale").Inc(1)
+			continue
+		}
+		if _, err := s.cas.GetCacheFileStat(e.Digest.Hex()); err == nil {
+			l.record(e.Namespace, e.Digest, e.Size)
+			size += e.Size
+			continue
+		}
+		if fetched+e.Size > budget ||
+			(l.config.MaxSize > 0 && size+e.Size > int64(l.config.MaxSize)) {
+			l.stats.Counter("skipped_over_quota").Inc(1)
+			continue
+		}
+		for {
+			if err := limiter.Wait(ctx); err != nil {
+				return
+			}
+			err := s.blobRefresher.Refresh(e.Namespace, e.Digest)
+			if err == blobrefresh.ErrWorkersBusy {
+				continue
+			}
+			switch err {
+			case nil, blobrefresh.ErrPending:
+				l.record(e.Namespace, e.Digest, e.Size)
+				size += e.Size
+				fetched += e.Size
+				l.stats.Counter("warmed").Inc(1)
+			case blobrefresh.ErrNotFound:
+				// The blob was deleted from the backend since shutdown.
+				l.stats.Counter("skipped_not_found").Inc(1)
+			default:
+				log.With("digest", e.Digest).Errorf("Error warming blob: %s", err)
+				l.stats.Counter("errors").Inc(1)
+			}
+			break
+		}
+	}
+}
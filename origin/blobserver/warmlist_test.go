@@ -0,0 +1,141 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package blobserver
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/backend/backenderrors"
+	"github.com/uber/kraken/utils/mockutil"
+	"github.com/uber/kraken/utils/testutil"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/stretchr/testify/require"
+	"github.com/uber-go/tally"
+)
+
+func TestServerWarmsBlobsOfWarmListAfterRestart(t *testing.T) {
+	require := require.New(t)
+
+	dir, err := ioutil.TempDir("", "warmlist")
+	require.NoError(err)
+	defer os.RemoveAll(dir)
+
+	config := Config{WarmList: WarmListConfig{
+		Enabled: true,
+		Path:    filepath.Join(dir, "warmlist.json"),
+		RPS:     100,
+	}}
+	namespace := core.TagFixture()
+	blobs := []*core.BlobFixture{core.NewBlobFixture(), core.NewBlobFixture()}
+	deleted := core.NewBlobFixture()
+
+	cp := newTestClientProvider()
+
+	s1 := newTestServerWithConfig(t, config, master1, hashRingNoReplica(), cp)
+	for _, blob := range append(blobs, deleted) {
+		require.NoError(s1.cas.CreateCacheFile(blob.Digest.Hex(), bytes.NewReader(blob.Content)))
+		ensureHasBlob(t, cp.Provide(master1), namespace, blob)
+	}
+	require.NoError(s1.server.SaveWarmList())
+	s1.cleanup()
+
+	// Restart with an empty disk.
+	s2 := newTestServerWithConfig(t, config, master1, hashRingNoReplica(), cp)
+	defer s2.cleanup()
+
+	backendClient := s2.backendClient(namespace)
+	for _, blob := range blobs {
+		backendClient.EXPECT().Stat(namespace, blob.Digest.Hex()).Return(
+			core.NewBlobInfo(int64(len(blob.Content))), nil)
+		backendClient.EXPECT().Download(
+			namespace, blob.Digest.Hex(), mockutil.MatchWriter(blob.Content)).Return(nil)
+	}
+	// Blobs deleted from the backend since shutdown are skipped.
+	backendClient.EXPECT().Stat(namespace, deleted.Digest.Hex()).Return(
+		nil, backenderrors.ErrBlobNotFound)
+
+	s2.server.Warm(dir)
+
+	require.NoError(testutil.PollUntilTrue(5*time.Second, func() bool {
+		for _, blob := range blobs {
+			if _, err := s2.cas.GetCacheFileStat(blob.Digest.Hex()); err != nil {
+				return false
+			}
+		}
+		return true
+	}))
+	_, err = s2.cas.GetCacheFileStat(deleted.Digest.Hex())
+	require.True(os.IsNotExist(err))
+}
+
+func TestServerSkipsWarmingBlobsBeyondMaxDiskUtil(t *testing.T) {
+	require := require.New(t)
+
+	dir, err := ioutil.TempDir("", "warmlist")
+	require.NoError(err)
+	defer os.RemoveAll(dir)
+
+	config := Config{WarmList: WarmListConfig{
+		Enabled:     true,
+		Path:        filepath.Join(dir, "warmlist.json"),
+		MaxDiskUtil: 1e-9,
+		RPS:         100,
+	}}
+	namespace := core.TagFixture()
+	blob := core.NewBlobFixture()
+
+	cp := newTestClientProvider()
+
+	s1 := newTestServerWithConfig(t, config, master1, hashRingNoReplica(), cp)
+	s1.server.RecordSeeded(namespace, blob.Digest, int64(len(blob.Content)))
+	require.NoError(s1.server.SaveWarmList())
+	s1.cleanup()
+
+	s2 := newTestServerWithConfig(t, config, master1, hashRingNoReplica(), cp)
+	defer s2.cleanup()
+
+	entries, err := s2.server.warmList.load()
+	require.NoError(err)
+	require.Len(entries, 1)
+
+	// Any backend fetch fails the test, since no expectations are set.
+	s2.server.warm(context.Background(), dir)
+
+	_, err = s2.cas.GetCacheFileStat(blob.Digest.Hex())
+	require.True(os.IsNotExist(err))
+}
+
+func TestWarmListEvictsLeastRecentlyDownloaded(t *testing.T) {
+	require := require.New(t)
+
+	l := newWarmList(WarmListConfig{Enabled: true, MaxEntries: 2}, tally.NoopScope, clock.New())
+
+	d1, d2, d3 := core.DigestFixture(), core.DigestFixture(), core.DigestFixture()
+	l.record("ns", d1, 1)
+	l.record("ns", d2, 1)
+	l.record("ns", d1, 1)
+	l.record("ns", d3, 1)
+
+	require.Len(l.entries, 2)
+	require.Contains(l.entries, d1)
+	require.Contains(l.entries, d3)
+}
@@ -14,15 +14,19 @@
 package cmd
 
 import (
+	"context"
 	"encoding/json"
 	"flag"
 	"fmt"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/uber/kraken/core"
 	"github.com/uber/kraken/lib/backend"
 	"github.com/uber/kraken/lib/blobrefresh"
+	"github.com/uber/kraken/lib/faults"
 	"github.com/uber/kraken/lib/hashring"
 	"github.com/uber/kraken/lib/healthcheck"
 	"github.com/uber/kraken/lib/hostlist"
@@ -186,7 +190,14 @@ func Run(flags *Flags, opts ...Option) {
 		log.Fatalf("Failed to create peer context: %s", err)
 	}
 
-	backendManager, err := backend.NewManager(config.Backends, config.Auth)
+	faultInjector, err := faults.New(config.FaultInjection, stats)
+	if err != nil {
+		log.Fatalf("Error creating fault injector: %s", err)
+	}
+
+	backendManager, err := backend.NewManager(
+		config.Backends, config.Auth, stats, backend.WithWriteFairness(config.WriteFairness),
+		backend.WithFaultInjector(faultInjector), backend.WithHistograms(config.Metrics.Histograms))
 	if err != nil {
 		log.Fatalf("Error creating backend manager: %s", err)
 	}
@@ -217,12 +228,6 @@ func Run(flags *Flags, opts ...Option) {
 		log.Fatalf("Error creating network event producer: %s", err)
 	}
 
-	sched, err := scheduler.NewOriginScheduler(
-		config.Scheduler, stats, pctx, cas, netevents, blobRefresher)
-	if err != nil {
-		log.Fatalf("Error creating scheduler: %s", err)
-	}
-
 	cluster, err := hostlist.New(config.Cluster)
 	if err != nil {
 		log.Fatalf("Error creating cluster host list: %s", err)
@@ -258,6 +263,11 @@ func Run(flags *Flags, opts ...Option) {
 		}
 	}
 
+	namespaceTags, err := config.Metrics.Namespaces.Build()
+	if err != nil {
+		log.Fatalf("Error building metric namespaces: %s", err)
+	}
+
 	server, err := blobserver.New(
 		config.BlobServer,
 		stats,
@@ -271,23 +281,72 @@ func Run(flags *Flags, opts ...Option) {
 		backendManager,
 		blobRefresher,
 		metaInfoGenerator,
-		writeBackManager)
+		writeBackManager,
+		blobserver.WithNamespaceTags(namespaceTags))
 	if err != nil {
 		log.Fatalf("Error initializing blob server: %s", err)
 	}
 
+	server.Preverify()
+
+	// Seed from the pre-verified store, such that stored blobs are not seeded
+	// before they are verified.
+	sched, err := scheduler.NewOriginScheduler(
+		config.Scheduler, stats, pctx, server.SeedStore(), netevents, blobRefresher,
+		scheduler.WithSeedHook(server.RecordSeeded),
+		scheduler.WithFaultInjector(faultInjector))
+	if err != nil {
+		log.Fatalf("Error creating scheduler: %s", err)
+	}
+
+	server.Scrub()
+	server.Warm(config.CAStore.CacheDir)
+
 	h := addTorrentDebugEndpoints(server.Handler(), sched)
+	h = faultInjector.Mount(h)
+
+	// On shutdown, nginx is stopped before the blob server, such that requests
+	// proxied by nginx complete. The warm list is saved once no more blobs are
+	// downloaded.
+	shutdown, stop := context.WithCancel(context.Background())
+	serverShutdown, stopServer := context.WithCancel(context.Background())
+	serverDone := make(chan struct{})
+	go func() {
+		if err := server.ListenAndServeContext(serverShutdown, h); err != nil {
+			log.Fatal(err)
+		}
+		close(serverDone)
+	}()
 
-	go func() { log.Fatal(server.ListenAndServe(h)) }()
+	go func() {
+		sigs := make(chan os.Signal, 1)
+		signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+		sig := <-sigs
+		log.Infof("Received %s, shutting down...", sig)
+		stop()
+	}()
 
 	log.Info("Starting nginx...")
-	log.Fatal(nginx.Run(
+	if err := nginx.Run(
 		config.Nginx,
 		map[string]interface{}{
 			"port":   flags.BlobServerPort,
 			"server": nginx.GetServer(config.BlobServer.Listener.Net, config.BlobServer.Listener.Addr),
 		},
-		nginx.WithTLS(config.TLS)))
+		nginx.WithTLS(config.TLS),
+		nginx.WithContext(shutdown)); err != nil {
+		log.Fatalf("Error running nginx: %s", err)
+	}
+	if shutdown.Err() == nil {
+		log.Fatal("Nginx exited unexpectedly")
+	}
+	stopServer()
+	<-serverDone
+	sched.Stop()
+	if err := server.SaveWarmList(); err != nil {
+		log.Fatalf("Error saving warm list: %s", err)
+	}
+	log.Info("Shut down")
 }
 
 // addTorrentDebugEndpoints mounts experimental debugging endpoints which are
@@ -17,6 +17,7 @@ import (
 	"github.com/uber/kraken/core"
 	"github.com/uber/kraken/lib/backend"
 	"github.com/uber/kraken/lib/blobrefresh"
+	"github.com/uber/kraken/lib/faults"
 	"github.com/uber/kraken/lib/hashring"
 	"github.com/uber/kraken/lib/healthcheck"
 	"github.com/uber/kraken/lib/hostlist"
@@ -38,22 +39,27 @@ import (
 // TODO(evelynl94): consolidate cluster and hashring.
 type Config struct {
 	Verbose       bool
-	ZapLogging    zap.Config               `yaml:"zap"`
-	Cluster       hostlist.Config          `yaml:"cluster"`
-	HashRing      hashring.Config          `yaml:"hashring"`
-	HealthCheck   healthcheck.FilterConfig `yaml:"healthcheck"`
-	BlobServer    blobserver.Config        `yaml:"blobserver"`
-	CAStore       store.CAStoreConfig      `yaml:"castore"`
-	Scheduler     scheduler.Config         `yaml:"scheduler"`
-	NetworkEvent  networkevent.Config      `yaml:"network_event"`
-	PeerIDFactory core.PeerIDFactory       `yaml:"peer_id_factory"`
-	Metrics       metrics.Config           `yaml:"metrics"`
-	MetaInfoGen   metainfogen.Config       `yaml:"metainfogen"`
-	Backends      []backend.Config         `yaml:"backends"`
-	Auth          backend.AuthConfig       `yaml:"auth"`
-	BlobRefresh   blobrefresh.Config       `yaml:"blobrefresh"`
-	LocalDB       localdb.Config           `yaml:"localdb"`
-	WriteBack     persistedretry.Config    `yaml:"writeback"`
-	Nginx         nginx.Config             `yaml:"nginx"`
-	TLS           httputil.TLSConfig       `yaml:"tls"`
+	ZapLogging    zap.Config                  `yaml:"zap"`
+	Cluster       hostlist.Config             `yaml:"cluster"`
+	HashRing      hashring.Config             `yaml:"hashring"`
+	HealthCheck   healthcheck.FilterConfig    `yaml:"healthcheck"`
+	BlobServer    blobserver.Config           `yaml:"blobserver"`
+	CAStore       store.CAStoreConfig         `yaml:"castore"`
+	Scheduler     scheduler.Config            `yaml:"scheduler"`
+	NetworkEvent  networkevent.Config         `yaml:"network_event"`
+	PeerIDFactory core.PeerIDFactory          `yaml:"peer_id_factory"`
+	Metrics       metrics.Config              `yaml:"metrics"`
+	MetaInfoGen   metainfogen.Config          `yaml:"metainfogen"`
+	Backends      []backend.Config            `yaml:"backends"`
+	Auth          backend.AuthConfig          `yaml:"auth"`
+	WriteFairness backend.WriteFairnessConfig `yaml:"backend_write_fairness"`
+	BlobRefresh   blobrefresh.Config          `yaml:"blobrefresh"`
+	LocalDB       localdb.Config              `yaml:"localdb"`
+	WriteBack     persistedretry.Config       `yaml:"writeback"`
+	Nginx         nginx.Config                `yaml:"nginx"`
+	TLS           httputil.TLSConfig          `yaml:"tls"`
+
+	// FaultInjection injects faults into backend operations, for chaos testing
+	// only.
+	FaultInjection faults.Config `yaml:"fault_injection"`
 }
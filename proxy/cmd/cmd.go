@@ -33,6 +33,7 @@ import (
 	"github.com/uber/kraken/utils/flagutil"
 	"github.com/uber/kraken/utils/log"
 
+	"github.com/andres-erbsen/clock"
 	"github.com/uber-go/tally"
 	"go.uber.org/zap"
 )
@@ -147,15 +148,26 @@ func Run(flags *Flags, opts ...Option) {
 		log.Fatalf("Error building origin host list: %s", err)
 	}
 
+	readPolicy, err := config.OriginReads.Build()
+	if err != nil {
+		log.Fatalf("Error building origin read policy: %s", err)
+	}
+
 	r := blobclient.NewClientResolver(blobclient.NewProvider(blobclient.WithTLS(tls)), origins)
-	originCluster := blobclient.NewClusterClient(r)
+	originCluster := blobclient.NewClusterClient(
+		r,
+		blobclient.WithHedging(config.OriginHedging),
+		blobclient.WithHealthTracking(config.OriginHealth, clock.New()),
+		blobclient.WithReadPolicy(readPolicy),
+		blobclient.WithOriginWeights(config.OriginWeights))
 
 	buildIndexes, err := config.BuildIndex.Build(upstream.WithHealthCheck(healthcheck.Default(tls)))
 	if err != nil {
 		log.Fatalf("Error building build-index host list: %s", err)
 	}
 
-	tagClient := tagclient.NewClusterClient(buildIndexes, tls)
+	tagClient := tagclient.NewClusterClient(
+		buildIndexes, tls, tagclient.WithBudget(config.BuildIndexBudget))
 
 	transferer := transfer.NewReadWriteTransferer(stats, tagClient, originCluster, cas)
 
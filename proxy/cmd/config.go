@@ -14,11 +14,13 @@
 package cmd
 
 import (
+	"github.com/uber/kraken/build-index/tagclient"
 	"github.com/uber/kraken/lib/dockerregistry"
 	"github.com/uber/kraken/lib/store"
 	"github.com/uber/kraken/lib/upstream"
 	"github.com/uber/kraken/metrics"
 	"github.com/uber/kraken/nginx"
+	"github.com/uber/kraken/origin/blobclient"
 	"github.com/uber/kraken/proxy/registryoverride"
 	"github.com/uber/kraken/utils/httputil"
 
@@ -27,13 +29,21 @@ import (
 
 // Config defines proxy configuration
 type Config struct {
-	CAStore          store.CAStoreConfig     `yaml:"castore"`
-	Registry         dockerregistry.Config   `yaml:"registry"`
-	BuildIndex       upstream.ActiveConfig   `yaml:"build_index"`
-	Origin           upstream.ActiveConfig   `yaml:"origin"`
-	ZapLogging       zap.Config              `yaml:"zap"`
-	Metrics          metrics.Config          `yaml:"metrics"`
-	RegistryOverride registryoverride.Config `yaml:"registryoverride"`
-	Nginx            nginx.Config            `yaml:"nginx"`
-	TLS              httputil.TLSConfig      `yaml:"tls"`
+	CAStore          store.CAStoreConfig         `yaml:"castore"`
+	Registry         dockerregistry.Config       `yaml:"registry"`
+	BuildIndex       upstream.ActiveConfig       `yaml:"build_index"`
+	Origin           upstream.ActiveConfig       `yaml:"origin"`
+	OriginHedging    blobclient.HedgeConfig      `yaml:"origin_hedging"`
+	OriginHealth     blobclient.HealthConfig     `yaml:"origin_health"`
+	OriginReads      blobclient.ReadPolicyConfig `yaml:"origin_reads"`
+	OriginWeights    map[string]int              `yaml:"origin_weights"`
+	ZapLogging       zap.Config                  `yaml:"zap"`
+	Metrics          metrics.Config              `yaml:"metrics"`
+	RegistryOverride registryoverride.Config     `yaml:"registryoverride"`
+	Nginx            nginx.Config                `yaml:"nginx"`
+	TLS              httputil.TLSConfig          `yaml:"tls"`
+
+	// BuildIndexBudget bounds the total time of build-index requests across
+	// retries against different build-indexes.
+	BuildIndexBudget tagclient.BudgetConfig `yaml:"build_index_budget"`
 }
@@ -21,6 +21,7 @@ from threading import Thread
 import pytest
 import requests
 
+from uploader import Uploader
 from utils import concurrently_apply
 from utils import tls_opts
 
@@ -34,6 +35,15 @@ def test_origin_upload_no_client_cert(origin_cluster):
     assert res.status_code == 403
 
 
+def test_origin_stream_upload_through_nginx(origin_cluster, agent):
+    name, blob = _generate_blob()
+
+    addr = origin_cluster.get_location(name)
+    assert Uploader(addr).stream_upload(name, blob) == 200
+
+    agent.download(name, blob)
+
+
 def test_concurrent_agent_downloads(origin_cluster, agent_factory):
     name, blob = _generate_blob()
 
@@ -13,8 +13,15 @@
 # limitations under the License.
 from __future__ import absolute_import
 
+import ssl
+
 import requests
 
+try:
+    from http.client import HTTPSConnection
+except ImportError:
+    from httplib import HTTPSConnection
+
 from utils import tls_opts_with_client_certs
 
 
@@ -46,3 +53,28 @@ class Uploader(object):
         uid = self._start(name)
         self._patch(name, uid, 0, len(blob), blob)
         self._commit(name, uid)
+
+    def stream_upload(self, name, blob, chunk_size=1 << 20):
+        """Uploads blob in a single chunked request, declaring its digest in the
+        X-Blob-Digest trailer. Returns the response status."""
+        cert, key = tls_opts_with_client_certs()['cert']
+        context = ssl.SSLContext(ssl.PROTOCOL_TLS_CLIENT)
+        context.check_hostname = False
+        context.verify_mode = ssl.CERT_NONE
+        context.load_cert_chain(cert, key)
+        host, port = self.addr.split(':')
+        conn = HTTPSConnection(host, int(port), context=context)
+        conn.putrequest('PUT', '/namespace/testfs/blobs/uploads')
+        conn.putheader('Transfer-Encoding', 'chunked')
+        conn.putheader('Trailer', 'X-Blob-Digest')
+        conn.endheaders()
+        for i in range(0, len(blob), chunk_size):
+            chunk = blob[i:i + chunk_size]
+            conn.send(('%x\r\n' % len(chunk)).encode())
+            conn.send(chunk)
+            conn.send(b'\r\n')
+        conn.send(('0\r\nX-Blob-Digest: sha256:%s\r\n\r\n' % name).encode())
+        res = conn.getresponse()
+        res.read()
+        conn.close()
+        return res.status
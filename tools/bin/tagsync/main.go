@@ -0,0 +1,61 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/uber/kraken/build-index/tagclient"
+	"github.com/uber/kraken/build-index/tagsync"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/uber-go/tally"
+)
+
+// tagsync incrementally syncs the tags of a namespace from a source build-index
+// to a destination build-index, whose address must match a remote of the
+// source. Run it periodically with the same checkpoint file to keep the
+// destination in sync.
+func main() {
+	source := flag.String("source", "", "source build-index address")
+	dest := flag.String("dest", "", "destination build-index address")
+	namespace := flag.String("namespace", "", "namespace prefix of tags to sync")
+	checkpoint := flag.String("checkpoint", "", "checkpoint file")
+	pageSize := flag.Int("page_size", 0, "tags listed per page")
+	flag.Parse()
+
+	if *source == "" || *dest == "" || *namespace == "" || *checkpoint == "" {
+		panic("-source, -dest, -namespace and -checkpoint required")
+	}
+
+	syncer, err := tagsync.New(
+		tagsync.Config{Source: *source, Destination: *dest, PageSize: *pageSize},
+		tally.NoopScope,
+		clock.New(),
+		tagclient.NewSingleClient(*source, nil),
+		tagclient.NewSingleClient(*dest, nil),
+		tagsync.NewFileCheckpointStore(*checkpoint))
+	if err != nil {
+		panic(err)
+	}
+
+	result, err := syncer.Sync(*namespace)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error syncing %s: %s\n", *namespace, err)
+		os.Exit(1)
+	}
+	fmt.Printf("Scanned %d tags, synced %d\n", result.Scanned, result.Synced)
+}
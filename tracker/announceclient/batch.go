@@ -0,0 +1,264 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package announceclient
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/utils/httputil"
+	"github.com/uber/kraken/utils/log"
+)
+
+// BatchClient is implemented by Clients which support announcing multiple
+// torrents in a single request.
+type BatchClient interface {
+	Client
+
+	// AnnounceBatch announces every torrent of announces, returning one result
+	// per announce in the same order.
+	AnnounceBatch(announces []BatchAnnounce) []BatchAnnounceResult
+}
+
+var _ BatchClient = (*client)(nil)
+
+const (
+	// unbatchedProbeInterval is how long trackers which do not support batch
+	// announces are announced to per torrent, before support is probed again.
+	unbatchedProbeInterval = 10 * time.Minute
+
+	minBatchBackoff = 5 * time.Second
+	maxBatchBackoff = 5 * time.Minute
+)
+
+// batchBackoff delays batch announces to a tracker which failed a batch.
+type batchBackoff struct {
+	delay time.Duration
+	until time.Time
+}
+
+// BatchAnnounce identifies a torrent announced as part of a batch.
+type BatchAnnounce struct {
+	Digest   core.Digest
+	InfoHash core.InfoHash
+	Complete bool
+}
+
+// BatchAnnounceResult is the outcome of a single announce of a batch.
+type BatchAnnounceResult struct {
+	Response *Response
+	Err      error
+}
+
+// BatchRequest defines an announce request covering multiple torrents.
+type BatchRequest struct {
+	Announces []*Request `json:"announces"`
+}
+
+// BatchResult defines the response to a single announce of a BatchRequest.
+// Exactly one of Response and Error is set.
+type BatchResult struct {
+	InfoHash core.InfoHash `json:"info_hash"`
+	Response *Response     `json:"response,omitempty"`
+	Error    string        `json:"error,omitempty"`
+}
+
+// BatchResponse defines the response to a BatchRequest, holding one result per
+// announce in request order.
+type BatchResponse struct {
+	Results []BatchResult `json:"results"`
+}
+
+// AnnounceBatch announces every torrent of announces, sending a single request
+// to each tracker owning some of them. Announces owned by trackers which do not
+// support batching fall back to per-torrent announces, and support is probed
+// again after unbatchedProbeInterval. Trackers which fail a batch are backed off,
+// failing their announces until the backoff expires.
+func (c *client) AnnounceBatch(announces []BatchAnnounce) []BatchAnnounceResult {
+	results := make([]BatchAnnounceResult, len(announces))
+
+	// Indices of announces, grouped by the tracker which owns them.
+	byAddr := make(map[string][]int)
+	var addrs []string
+	for i, a := range announces {
+		locs := c.ring.Locations(a.Digest)
+		if len(locs) == 0 {
+			results[i].Err = fmt.Errorf("no trackers for %s", a.Digest)
+			continue
+		}
+		addr := locs[0]
+		if c.unbatchedTracker(addr) {
+			results[i] = c.announceOne(a)
+			continue
+		}
+		if c.backingOff(addr) {
+			results[i].Err = fmt.Errorf("batch announces to %s backing off", addr)
+			continue
+		}
+		if _, ok := byAddr[addr]; !ok {
+			addrs = append(addrs, addr)
+		}
+		byAddr[addr] = append(byAddr[addr], i)
+	}
+	for _, addr := range addrs {
+		indices := byAddr[addr]
+		batch := make([]BatchAnnounce, len(indices))
+		for j, i := range indices {
+			batch[j] = announces[i]
+		}
+		batchResults, err := c.sendBatch(addr, batch)
+		if err != nil {
+			if httputil.IsNotFound(err) || httputil.IsStatus(err, http.StatusMethodNotAllowed) {
+				log.With("addr", addr).Info("Tracker does not support batch announce")
+				c.markUnbatched(addr)
+				for _, i := range indices {
+					results[i] = c.announceOne(announces[i])
+				}
+				continue
+			}
+			if httputil.IsNetworkError(err) {
+				c.ring.Failed(addr)
+			}
+			log.With("addr", addr).Errorf("Error sending batch announce: %s", err)
+			c.backOff(addr)
+			for _, i := range indices {
+				results[i].Err = fmt.Errorf("batch announce: %s", err)
+			}
+			continue
+		}
+		c.resetBackOff(addr)
+		for j, i := range indices {
+			results[i] = batchResults[j]
+		}
+	}
+	return results
+}
+
+// unbatchedTracker returns true if the tracker at addr is known to not support
+// batch announces, and is not yet due to be probed again.
+func (c *client) unbatchedTracker(addr string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	probe, ok := c.unbatched[addr]
+	if !ok {
+		return false
+	}
+	if !c.clk.Now().Before(probe) {
+		delete(c.unbatched, addr)
+		return false
+	}
+	return true
+}
+
+func (c *client) markUnbatched(addr string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.unbatched[addr] = c.clk.Now().Add(unbatchedProbeInterval)
+}
+
+// backingOff returns true if batch announces to the tracker at addr are backed
+// off after a failure.
+func (c *client) backingOff(addr string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	b, ok := c.backoffs[addr]
+	return ok && c.clk.Now().Before(b.until)
+}
+
+// backOff doubles the backoff of the tracker at addr.
+func (c *client) backOff(addr string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	b, ok := c.backoffs[addr]
+	if !ok {
+		b = &batchBackoff{}
+		c.backoffs[addr] = b
+	}
+	b.delay *= 2
+	if b.delay < minBatchBackoff {
+		b.delay = minBatchBackoff
+	}
+	if b.delay > maxBatchBackoff {
+		b.delay = maxBatchBackoff
+	}
+	b.until = c.clk.Now().Add(b.delay)
+}
+
+func (c *client) resetBackOff(addr string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.backoffs, addr)
+}
+
+func (c *client) announceOne(a BatchAnnounce) BatchAnnounceResult {
+	resp, err := c.Announce(a.Digest, a.InfoHash, a.Complete, V2)
+	return BatchAnnounceResult{resp, err}
+}
+
+// sendBatch sends a single batch announce of batch to the tracker at addr.
+func (c *client) sendBatch(addr string, batch []BatchAnnounce) ([]BatchAnnounceResult, error) {
+	req := BatchRequest{}
+	for _, a := range batch {
+		d := a.Digest
+		req.Announces = append(req.Announces, &Request{
+			Name:     d.Hex(),
+			Digest:   &d,
+			InfoHash: a.InfoHash,
+			Peer:     core.PeerInfoFromContext(c.pctx, a.Complete),
+		})
+	}
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("marshal request: %s", err)
+	}
+	httpResp, err := httputil.Post(
+		fmt.Sprintf("http://%s/batch/announce", addr),
+		httputil.SendBody(bytes.NewReader(body)),
+		httputil.SendTimeout(10*time.Second),
+		httputil.SendTLS(c.tls))
+	if err != nil {
+		return nil, err
+	}
+	defer httpResp.Body.Close()
+	var resp BatchResponse
+	if err := json.NewDecoder(httpResp.Body).Decode(&resp); err != nil {
+		return nil, fmt.Errorf("decode response: %s", err)
+	}
+	if len(resp.Results) != len(batch) {
+		return nil, fmt.Errorf("expected %d results, got %d", len(batch), len(resp.Results))
+	}
+	results := make([]BatchAnnounceResult, len(batch))
+	for i, r := range resp.Results {
+		switch {
+		case r.InfoHash != batch[i].InfoHash:
+			results[i].Err = fmt.Errorf("result for %s out of order", r.InfoHash)
+		case r.Error != "":
+			results[i].Err = fmt.Errorf("tracker: %s", r.Error)
+		case r.Response == nil:
+			results[i].Err = fmt.Errorf("empty result")
+		default:
+			results[i].Response = r.Response
+		}
+	}
+	return results, nil
+}
@@ -0,0 +1,98 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package announceclient
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/hashring"
+	"github.com/uber/kraken/lib/hostlist"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/atomic"
+)
+
+func newTestClient(addr string) (*client, *clock.Mock) {
+	clk := clock.NewMock()
+	c := New(core.PeerContextFixture(), hashring.NoopPassiveRing(hostlist.Fixture(addr)), nil).(*client)
+	c.clk = clk
+	return c, clk
+}
+
+func TestAnnounceBatchBacksOffFailedTracker(t *testing.T) {
+	require := require.New(t)
+
+	requests := atomic.NewInt64(0)
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Inc()
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer s.Close()
+
+	c, clk := newTestClient(strings.TrimPrefix(s.URL, "http://"))
+
+	announces := []BatchAnnounce{
+		{Digest: core.DigestFixture(), InfoHash: core.InfoHashFixture()},
+		{Digest: core.DigestFixture(), InfoHash: core.InfoHashFixture()},
+	}
+
+	// A failed batch does not fall back to announcing each torrent.
+	for _, r := range c.AnnounceBatch(announces) {
+		require.Error(r.Err)
+	}
+	require.Equal(int64(1), requests.Load())
+
+	for _, r := range c.AnnounceBatch(announces) {
+		require.Error(r.Err)
+	}
+	require.Equal(int64(1), requests.Load())
+
+	clk.Add(minBatchBackoff)
+	c.AnnounceBatch(announces)
+	require.Equal(int64(2), requests.Load())
+}
+
+func TestAnnounceBatchProbesUnbatchedTrackerAgain(t *testing.T) {
+	require := require.New(t)
+
+	batches := atomic.NewInt64(0)
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/batch/announce" {
+			batches.Inc()
+			http.NotFound(w, r)
+			return
+		}
+		json.NewEncoder(w).Encode(&Response{})
+	}))
+	defer s.Close()
+
+	c, clk := newTestClient(strings.TrimPrefix(s.URL, "http://"))
+
+	announces := []BatchAnnounce{{Digest: core.DigestFixture(), InfoHash: core.InfoHashFixture()}}
+
+	for i := 0; i < 2; i++ {
+		require.NoError(c.AnnounceBatch(announces)[0].Err)
+	}
+	require.Equal(int64(1), batches.Load())
+
+	clk.Add(unbatchedProbeInterval)
+	require.NoError(c.AnnounceBatch(announces)[0].Err)
+	require.Equal(int64(2), batches.Load())
+}
@@ -20,11 +20,14 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"sync"
 	"time"
 
 	"github.com/uber/kraken/core"
 	"github.com/uber/kraken/lib/hashring"
 	"github.com/uber/kraken/utils/httputil"
+
+	"github.com/andres-erbsen/clock"
 )
 
 // ErrDisabled is returned when announce is disabled.
@@ -54,6 +57,11 @@ func (r *Request) GetDigest() (core.Digest, error) {
 type Response struct {
 	Peers    []*core.PeerInfo `json:"peers"`
 	Interval time.Duration    `json:"interval"`
+
+	// PieceOffset is an optional hint of the piece from which the peer should
+	// start downloading, wrapped around the number of pieces. Peers joining a
+	// swarm are assigned distinct offsets.
+	PieceOffset *int `json:"piece_offset,omitempty"`
 }
 
 // Client defines a client for announcing and getting peers.
@@ -62,18 +70,35 @@ type Client interface {
 		d core.Digest,
 		h core.InfoHash,
 		complete bool,
-		version int) ([]*core.PeerInfo, time.Duration, error)
+		version int) (*Response, error)
 }
 
 type client struct {
 	pctx core.PeerContext
 	ring hashring.PassiveRing
 	tls  *tls.Config
+	clk  clock.Clock
+
+	mu sync.Mutex
+
+	// Trackers which do not support batch announces, keyed to the time after
+	// which support is probed again.
+	unbatched map[string]time.Time
+
+	// Trackers which failed a batch announce.
+	backoffs map[string]*batchBackoff
 }
 
-// New creates a new client.
+// New creates a new client. The returned Client implements BatchClient.
 func New(pctx core.PeerContext, ring hashring.PassiveRing, tls *tls.Config) Client {
-	return &client{pctx, ring, tls}
+	return &client{
+		pctx:      pctx,
+		ring:      ring,
+		tls:       tls,
+		clk:       clock.New(),
+		unbatched: make(map[string]time.Time),
+		backoffs:  make(map[string]*batchBackoff),
+	}
 }
 
 // Announce versionss.
@@ -96,7 +121,7 @@ func (c *client) Announce(
 	d core.Digest,
 	h core.InfoHash,
 	complete bool,
-	version int) (peers []*core.PeerInfo, interval time.Duration, err error) {
+	version int) (*Response, error) {
 
 	body, err := json.Marshal(&Request{
 		Name:     d.Hex(), // For backwards compatability. TODO(codyg): Remove.
@@ -105,7 +130,7 @@ func (c *client) Announce(
 		Peer:     core.PeerInfoFromContext(c.pctx, complete),
 	})
 	if err != nil {
-		return nil, 0, fmt.Errorf("marshal request: %s", err)
+		return nil, fmt.Errorf("marshal request: %s", err)
 	}
 	var httpResp *http.Response
 	for _, addr := range c.ring.Locations(d) {
@@ -121,16 +146,16 @@ func (c *client) Announce(
 				c.ring.Failed(addr)
 				continue
 			}
-			return nil, 0, err
+			return nil, err
 		}
 		defer httpResp.Body.Close()
 		var resp Response
 		if err := json.NewDecoder(httpResp.Body).Decode(&resp); err != nil {
-			return nil, 0, fmt.Errorf("decode response: %s", err)
+			return nil, fmt.Errorf("decode response: %s", err)
 		}
-		return resp.Peers, resp.Interval, nil
+		return &resp, nil
 	}
-	return nil, 0, err
+	return nil, err
 }
 
 // DisabledClient rejects all announces. Suitable for origin peers which should
@@ -144,7 +169,7 @@ func Disabled() Client {
 
 // Announce always returns error.
 func (c DisabledClient) Announce(
-	d core.Digest, h core.InfoHash, complete bool, version int) ([]*core.PeerInfo, time.Duration, error) {
+	d core.Digest, h core.InfoHash, complete bool, version int) (*Response, error) {
 
-	return nil, 0, ErrDisabled
+	return nil, ErrDisabled
 }
@@ -26,6 +26,7 @@ import (
 	"github.com/uber/kraken/tracker/peerstore"
 	"github.com/uber/kraken/tracker/trackerserver"
 	"github.com/uber/kraken/utils/configutil"
+	"github.com/uber/kraken/utils/httputil"
 	"github.com/uber/kraken/utils/log"
 
 	"github.com/andres-erbsen/clock"
@@ -145,8 +146,17 @@ func Run(flags *Flags, opts ...Option) {
 		log.Fatalf("Could not load peer handout policy: %s", err)
 	}
 
-	r := blobclient.NewClientResolver(blobclient.NewProvider(blobclient.WithTLS(tls)), origins)
-	originCluster := blobclient.NewClusterClient(r)
+	originClientOpts := []blobclient.Option{blobclient.WithTLS(tls)}
+	if config.OriginResponseCache.Enabled {
+		originClientOpts = append(originClientOpts, blobclient.WithResponseCache(
+			httputil.NewResponseCache(config.OriginResponseCache, clock.New())))
+	}
+	r := blobclient.NewClientResolver(blobclient.NewProvider(originClientOpts...), origins)
+	originCluster := blobclient.NewClusterClient(
+		r,
+		blobclient.WithHedging(config.OriginHedging),
+		blobclient.WithHealthTracking(config.OriginHealth, clock.New()),
+		blobclient.WithOriginWeights(config.OriginWeights))
 
 	server := trackerserver.New(
 		config.TrackerServer, stats, policy, peerStore, originStore, originCluster)
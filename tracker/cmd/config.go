@@ -19,6 +19,7 @@ import (
 	"github.com/uber/kraken/lib/upstream"
 	"github.com/uber/kraken/metrics"
 	"github.com/uber/kraken/nginx"
+	"github.com/uber/kraken/origin/blobclient"
 	"github.com/uber/kraken/tracker/originstore"
 	"github.com/uber/kraken/tracker/peerhandoutpolicy"
 	"github.com/uber/kraken/tracker/peerstore"
@@ -34,7 +35,14 @@ type Config struct {
 	TrackerServer     trackerserver.Config     `yaml:"trackerserver"`
 	PeerHandoutPolicy peerhandoutpolicy.Config `yaml:"peerhandoutpolicy"`
 	Origin            upstream.ActiveConfig    `yaml:"origin"`
+	OriginHedging     blobclient.HedgeConfig   `yaml:"origin_hedging"`
+	OriginHealth      blobclient.HealthConfig  `yaml:"origin_health"`
+	OriginWeights     map[string]int           `yaml:"origin_weights"`
 	Metrics           metrics.Config           `yaml:"metrics"`
 	Nginx             nginx.Config             `yaml:"nginx"`
 	TLS               httputil.TLSConfig       `yaml:"tls"`
+
+	// OriginResponseCache caches metainfo fetched from origins, which is
+	// revalidated with its ETag on subsequent fetches.
+	OriginResponseCache httputil.ResponseCacheConfig `yaml:"origin_response_cache"`
 }
@@ -72,6 +72,40 @@ func (s *Server) announceHandlerV2(w http.ResponseWriter, r *http.Request) error
 	return nil
 }
 
+// announceBatchHandler announces every torrent of a batch request, and returns
+// the peer handout of each in request order. Failed announces do not fail the
+// batch, but are reported in their result.
+func (s *Server) announceBatchHandler(w http.ResponseWriter, r *http.Request) error {
+	req := new(announceclient.BatchRequest)
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		return handler.Errorf("json decode request: %s", err)
+	}
+	if len(req.Announces) > s.config.MaxAnnounceBatch {
+		return handler.Errorf(
+			"batch of %d announces exceeds limit of %d",
+			len(req.Announces), s.config.MaxAnnounceBatch).Status(http.StatusBadRequest)
+	}
+	resp := announceclient.BatchResponse{Results: []announceclient.BatchResult{}}
+	for _, a := range req.Announces {
+		result := announceclient.BatchResult{InfoHash: a.InfoHash}
+		if a.Peer == nil {
+			result.Error = "missing peer"
+		} else if d, err := a.GetDigest(); err != nil {
+			result.Error = fmt.Sprintf("get request digest: %s", err)
+		} else if ar, err := s.announce(d, a.InfoHash, a.Peer); err != nil {
+			result.Error = err.Error()
+		} else {
+			result.Response = ar
+		}
+		resp.Results = append(resp.Results, result)
+	}
+	s.stats.Counter("batch_announces").Inc(int64(len(req.Announces)))
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		return handler.Errorf("json encode response: %s", err)
+	}
+	return nil
+}
+
 func (s *Server) announce(
 	d core.Digest, h core.InfoHash, peer *core.PeerInfo) (*announceclient.Response, error) {
 
@@ -84,10 +118,14 @@ func (s *Server) announce(
 	if err != nil {
 		return nil, err
 	}
-	return &announceclient.Response{
+	resp := &announceclient.Response{
 		Peers:    peers,
 		Interval: s.config.AnnounceInterval,
-	}, nil
+	}
+	if !peer.Complete {
+		resp.PieceOffset = s.pieces.assign(h, peer.PeerID)
+	}
+	return resp, nil
 }
 
 func (s *Server) getPeerHandout(
@@ -16,6 +16,7 @@ package trackerserver
 import (
 	"errors"
 	"fmt"
+	"net/http"
 	"testing"
 	"time"
 
@@ -25,8 +26,10 @@ import (
 	"github.com/uber/kraken/tracker/announceclient"
 	"github.com/uber/kraken/utils/testutil"
 
+	"github.com/andres-erbsen/clock"
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/require"
+	"go.uber.org/atomic"
 )
 
 func newAnnounceClient(pctx core.PeerContext, addr string) announceclient.Client {
@@ -59,11 +62,12 @@ func TestAnnounceSinglePeerResponse(t *testing.T) {
 			mocks.peerStore.EXPECT().UpdatePeer(
 				blob.MetaInfo.InfoHash(), core.PeerInfoFromContext(pctx, false)).Return(nil)
 
-			result, interval, err := client.Announce(
+			resp, err := client.Announce(
 				blob.Digest, blob.MetaInfo.InfoHash(), false, version)
 			require.NoError(err)
-			require.Equal(peers, result)
-			require.Equal(config.AnnounceInterval, interval)
+			require.Equal(peers, resp.Peers)
+			require.Equal(config.AnnounceInterval, resp.Interval)
+			require.Nil(resp.PieceOffset)
 		})
 	}
 }
@@ -91,10 +95,10 @@ func TestAnnounceUnavailablePeerStoreCanStillProvideOrigins(t *testing.T) {
 		blob.MetaInfo.InfoHash(), gomock.Any()).Return(nil, storeErr)
 	mocks.originStore.EXPECT().GetOrigins(blob.Digest).Return(origins, nil)
 
-	result, _, err := client.Announce(
+	resp, err := client.Announce(
 		blob.Digest, blob.MetaInfo.InfoHash(), false, announceclient.V2)
 	require.NoError(err)
-	require.Equal(origins, result)
+	require.Equal(origins, resp.Peers)
 }
 
 func TestAnnouceUnavailableOriginClusterCanStillProvidePeers(t *testing.T) {
@@ -119,10 +123,79 @@ func TestAnnouceUnavailableOriginClusterCanStillProvidePeers(t *testing.T) {
 		blob.MetaInfo.InfoHash(), gomock.Any()).Return(peers, nil)
 	mocks.originStore.EXPECT().GetOrigins(blob.Digest).Return(nil, errors.New("some error"))
 
-	result, _, err := client.Announce(
+	resp, err := client.Announce(
 		blob.Digest, blob.MetaInfo.InfoHash(), false, announceclient.V2)
 	require.NoError(err)
-	require.Equal(peers, result)
+	require.Equal(peers, resp.Peers)
+}
+
+func TestAnnounceAssignsDistinctPieceOffsets(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t, Config{
+		PieceAssignment: PieceAssignmentConfig{Enabled: true},
+	})
+	defer cleanup()
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	blob := core.NewBlobFixture()
+	h := blob.MetaInfo.InfoHash()
+	origins := []*core.PeerInfo{core.OriginPeerInfoFixture()}
+
+	mocks.peerStore.EXPECT().UpdatePeer(h, gomock.Any()).Return(nil).AnyTimes()
+	mocks.peerStore.EXPECT().GetPeers(h, gomock.Any()).Return(nil, nil).AnyTimes()
+	mocks.originStore.EXPECT().GetOrigins(blob.Digest).Return(origins, nil).AnyTimes()
+
+	announce := func(pctx core.PeerContext, complete bool) *int {
+		resp, err := newAnnounceClient(pctx, addr).Announce(
+			blob.Digest, h, complete, announceclient.V2)
+		require.NoError(err)
+		return resp.PieceOffset
+	}
+
+	var pctxs []core.PeerContext
+	offsets := make(map[int]bool)
+	for i := 0; i < 10; i++ {
+		pctx := core.PeerContextFixture()
+		pctxs = append(pctxs, pctx)
+		offset := announce(pctx, false)
+		require.NotNil(offset)
+		require.False(offsets[*offset], "offset %d assigned twice", *offset)
+		offsets[*offset] = true
+	}
+
+	// Re-announcing peers keep their offset.
+	first := announce(pctxs[0], false)
+	require.NotNil(first)
+	require.Equal(0, *first)
+
+	// Complete peers do not download, and are not assigned offsets.
+	require.Nil(announce(core.PeerContextFixture(), true))
+}
+
+func TestPieceAssignerForgetsIdleSwarms(t *testing.T) {
+	require := require.New(t)
+
+	clk := clock.NewMock()
+	a := newPieceAssigner(PieceAssignmentConfig{Enabled: true, TTL: time.Minute}, clk)
+	h1 := core.InfoHashFixture()
+	h2 := core.InfoHashFixture()
+	p1 := core.PeerIDFixture()
+	p2 := core.PeerIDFixture()
+
+	require.Equal(0, *a.assign(h1, p1))
+	require.Equal(1, *a.assign(h1, p2))
+
+	clk.Add(30 * time.Second)
+	require.Equal(0, *a.assign(h2, p1))
+
+	clk.Add(30 * time.Second)
+	require.Equal(1, *a.assign(h2, p2))
+
+	// h1 was idle for the TTL, so its assignments restart.
+	require.Equal(0, *a.assign(h1, p2))
 }
 
 func TestAnnounceRequestGetDigestBackwardsCompatibility(t *testing.T) {
@@ -168,3 +241,119 @@ func TestAnnounceRequestGetDigestBackwardsCompatibility(t *testing.T) {
 		})
 	}
 }
+
+func TestAnnounceBatchReturnsPeersOfEveryTorrentInOneRequest(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t, Config{})
+	defer cleanup()
+
+	requests := atomic.NewInt64(0)
+	addr, stop := testutil.StartServer(countRequests(mocks.handler(), requests))
+	defer stop()
+
+	pctx := core.PeerContextFixture()
+	client := newAnnounceClient(pctx, addr).(announceclient.BatchClient)
+
+	var announces []announceclient.BatchAnnounce
+	var expected [][]*core.PeerInfo
+	for i := 0; i < 3; i++ {
+		blob := core.NewBlobFixture()
+		h := blob.MetaInfo.InfoHash()
+		peers := []*core.PeerInfo{core.PeerInfoFixture()}
+
+		mocks.peerStore.EXPECT().UpdatePeer(h, core.PeerInfoFromContext(pctx, false)).Return(nil)
+		mocks.peerStore.EXPECT().GetPeers(h, gomock.Any()).Return(peers, nil)
+		mocks.originStore.EXPECT().GetOrigins(blob.Digest).Return(nil, nil)
+
+		announces = append(announces, announceclient.BatchAnnounce{Digest: blob.Digest, InfoHash: h})
+		expected = append(expected, peers)
+	}
+
+	results := client.AnnounceBatch(announces)
+	require.Len(results, 3)
+	for i, r := range results {
+		require.NoError(r.Err)
+		require.Equal(expected[i], r.Response.Peers)
+	}
+	require.Equal(int64(1), requests.Load())
+}
+
+func TestAnnounceBatchReportsFailuresPerTorrent(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t, Config{})
+	defer cleanup()
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	pctx := core.PeerContextFixture()
+	client := newAnnounceClient(pctx, addr).(announceclient.BatchClient)
+
+	found := core.NewBlobFixture()
+	missing := core.NewBlobFixture()
+	peers := []*core.PeerInfo{core.PeerInfoFixture()}
+
+	for _, blob := range []*core.BlobFixture{found, missing} {
+		mocks.peerStore.EXPECT().UpdatePeer(
+			blob.MetaInfo.InfoHash(), core.PeerInfoFromContext(pctx, false)).Return(nil)
+		mocks.originStore.EXPECT().GetOrigins(blob.Digest).Return(nil, nil)
+	}
+	mocks.peerStore.EXPECT().GetPeers(found.MetaInfo.InfoHash(), gomock.Any()).Return(peers, nil)
+	mocks.peerStore.EXPECT().GetPeers(missing.MetaInfo.InfoHash(), gomock.Any()).Return(nil, nil)
+
+	results := client.AnnounceBatch([]announceclient.BatchAnnounce{
+		{Digest: found.Digest, InfoHash: found.MetaInfo.InfoHash()},
+		{Digest: missing.Digest, InfoHash: missing.MetaInfo.InfoHash()},
+	})
+	require.NoError(results[0].Err)
+	require.Equal(peers, results[0].Response.Peers)
+	require.Error(results[1].Err)
+}
+
+func TestAnnounceBatchFallsBackToPerTorrentAnnounce(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t, Config{})
+	defer cleanup()
+
+	// Simulates a tracker which predates batch announces.
+	h := mocks.handler()
+	addr, stop := testutil.StartServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/batch/announce" {
+			http.NotFound(w, r)
+			return
+		}
+		h.ServeHTTP(w, r)
+	}))
+	defer stop()
+
+	pctx := core.PeerContextFixture()
+	client := newAnnounceClient(pctx, addr).(announceclient.BatchClient)
+
+	blob := core.NewBlobFixture()
+	peers := []*core.PeerInfo{core.PeerInfoFixture()}
+
+	mocks.peerStore.EXPECT().UpdatePeer(
+		blob.MetaInfo.InfoHash(), core.PeerInfoFromContext(pctx, false)).Return(nil).Times(2)
+	mocks.peerStore.EXPECT().GetPeers(
+		blob.MetaInfo.InfoHash(), gomock.Any()).Return(peers, nil).Times(2)
+	mocks.originStore.EXPECT().GetOrigins(blob.Digest).Return(nil, nil).Times(2)
+
+	// The second batch skips the unsupported batch endpoint.
+	for i := 0; i < 2; i++ {
+		results := client.AnnounceBatch([]announceclient.BatchAnnounce{
+			{Digest: blob.Digest, InfoHash: blob.MetaInfo.InfoHash()},
+		})
+		require.NoError(results[0].Err)
+		require.Equal(peers, results[0].Response.Peers)
+	}
+}
+
+func countRequests(h http.Handler, n *atomic.Int64) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n.Inc()
+		h.ServeHTTP(w, r)
+	})
+}
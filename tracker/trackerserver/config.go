@@ -29,6 +29,13 @@ type Config struct {
 
 	AnnounceInterval time.Duration `yaml:"announce_interval"`
 
+	// MaxAnnounceBatch bounds the torrents of a single batch announce.
+	MaxAnnounceBatch int `yaml:"max_announce_batch"`
+
+	// PieceAssignment spreads the initial piece requests of peers joining a
+	// swarm across the blob.
+	PieceAssignment PieceAssignmentConfig `yaml:"piece_assignment"`
+
 	Listener listener.Config `yaml:"listener"`
 }
 
@@ -42,5 +49,8 @@ func (c Config) applyDefaults() Config {
 	if c.AnnounceInterval == 0 {
 		c.AnnounceInterval = 3 * time.Second
 	}
+	if c.MaxAnnounceBatch == 0 {
+		c.MaxAnnounceBatch = 100
+	}
 	return c
 }
@@ -0,0 +1,107 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package trackerserver
+
+import (
+	"sync"
+	"time"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/uber/kraken/core"
+)
+
+// PieceAssignmentConfig defines assignment of distinct initial piece offsets
+// to peers joining a swarm.
+type PieceAssignmentConfig struct {
+	Enabled bool `yaml:"enabled"`
+
+	// TTL is how long a swarm's assignments are remembered after its last
+	// announce. Peers re-announcing within TTL keep their offset.
+	TTL time.Duration `yaml:"ttl"`
+}
+
+func (c PieceAssignmentConfig) applyDefaults() PieceAssignmentConfig {
+	if c.TTL == 0 {
+		c.TTL = 5 * time.Minute
+	}
+	return c
+}
+
+type swarmAssignment struct {
+	next     int
+	offsets  map[core.PeerID]int
+	lastSeen time.Time
+}
+
+// pieceAssigner hands out round-robin piece offsets to the downloading peers
+// of each swarm, such that peers joining together begin downloading different
+// parts of the blob instead of all reading the first pieces from origins.
+// Offsets are unbounded; peers wrap them around the number of pieces.
+type pieceAssigner struct {
+	config PieceAssignmentConfig
+	clk    clock.Clock
+
+	mu        sync.Mutex
+	swarms    map[core.InfoHash]*swarmAssignment
+	lastSweep time.Time
+}
+
+func newPieceAssigner(config PieceAssignmentConfig, clk clock.Clock) *pieceAssigner {
+	if !config.Enabled {
+		return nil
+	}
+	return &pieceAssigner{
+		config:    config.applyDefaults(),
+		clk:       clk,
+		swarms:    make(map[core.InfoHash]*swarmAssignment),
+		lastSweep: clk.Now(),
+	}
+}
+
+// assign returns the piece offset of peerID in swarm h. A nil pieceAssigner
+// assigns nothing.
+func (a *pieceAssigner) assign(h core.InfoHash, peerID core.PeerID) *int {
+	if a == nil {
+		return nil
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	now := a.clk.Now()
+	if now.Sub(a.lastSweep) >= a.config.TTL {
+		a.sweep(now)
+	}
+	s, ok := a.swarms[h]
+	if !ok {
+		s = &swarmAssignment{offsets: make(map[core.PeerID]int)}
+		a.swarms[h] = s
+	}
+	s.lastSeen = now
+	offset, ok := s.offsets[peerID]
+	if !ok {
+		offset = s.next
+		s.offsets[peerID] = offset
+		s.next++
+	}
+	return &offset
+}
+
+func (a *pieceAssigner) sweep(now time.Time) {
+	for h, s := range a.swarms {
+		if now.Sub(s.lastSeen) >= a.config.TTL {
+			delete(a.swarms, h)
+		}
+	}
+	a.lastSweep = now
+}
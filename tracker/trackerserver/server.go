@@ -18,6 +18,7 @@ import (
 	"net/http"
 	_ "net/http/pprof" // Registers /debug/pprof endpoints in http.DefaultServeMux.
 
+	"github.com/andres-erbsen/clock"
 	"github.com/pressly/chi"
 	chimiddleware "github.com/pressly/chi/middleware"
 	"github.com/uber-go/tally"
@@ -40,6 +41,7 @@ type Server struct {
 	peerStore   peerstore.Store
 	originStore originstore.Store
 	policy      *peerhandoutpolicy.PriorityPolicy
+	pieces      *pieceAssigner
 
 	originCluster blobclient.ClusterClient
 }
@@ -65,6 +67,7 @@ func New(
 		peerStore:     peerStore,
 		originStore:   originStore,
 		policy:        policy,
+		pieces:        newPieceAssigner(config.PieceAssignment, clock.New()),
 		originCluster: originCluster,
 	}
 }
@@ -79,6 +82,7 @@ func (s *Server) Handler() http.Handler {
 	r.Get("/health", handler.Wrap(s.healthHandler))
 	r.Get("/announce", handler.Wrap(s.announceHandlerV1))
 	r.Post("/announce/{infohash}", handler.Wrap(s.announceHandlerV2))
+	r.Post("/batch/announce", handler.Wrap(s.announceBatchHandler))
 	r.Get("/namespace/{namespace}/blobs/{digest}/metainfo", handler.Wrap(s.getMetaInfoHandler))
 
 	r.Mount("/debug", chimiddleware.Profiler())
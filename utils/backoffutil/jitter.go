@@ -0,0 +1,140 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package backoffutil
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+)
+
+// Jitter is a strategy for randomizing exponential backoff delays, such that
+// clients which failed together do not retry in lockstep.
+type Jitter string
+
+// Jitter strategies. Given the exponential delay t of an attempt:
+const (
+	// JitterNone sleeps exactly t.
+	JitterNone Jitter = "none"
+
+	// JitterEqual sleeps a random delay in [t/2, t).
+	JitterEqual Jitter = "equal"
+
+	// JitterFull sleeps a random delay in [0, t).
+	JitterFull Jitter = "full"
+
+	// JitterDecorrelated ignores t, and instead sleeps a random delay between
+	// the initial interval and three times the previous delay.
+	JitterDecorrelated Jitter = "decorrelated"
+)
+
+// Validate returns an error if j is not a known strategy. The empty strategy is
+// valid, and left to callers to default.
+func (j Jitter) Validate() error {
+	switch j {
+	case "", JitterNone, JitterEqual, JitterFull, JitterDecorrelated:
+		return nil
+	}
+	return fmt.Errorf("unknown jitter strategy %q", j)
+}
+
+// BackOff implements backoff.BackOff, growing delays exponentially from an
+// initial interval up to a max interval and randomizing them with a Jitter
+// strategy. BackOff never stops; callers bound the number of retries. Not
+// thread-safe.
+type BackOff struct {
+	jitter     Jitter
+	initial    time.Duration
+	max        time.Duration
+	multiplier float64
+	rand       *rand.Rand
+
+	attempt int
+	prev    time.Duration
+}
+
+// New creates a new BackOff. Delays are drawn from r, which is seeded with the
+// current time if nil.
+func New(
+	jitter Jitter,
+	initial, max time.Duration,
+	multiplier float64,
+	r *rand.Rand) *BackOff {
+
+	if r == nil {
+		r = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+	if max < initial {
+		max = initial
+	}
+	if multiplier < 1 {
+		multiplier = 1
+	}
+	b := &BackOff{
+		jitter:     jitter,
+		initial:    initial,
+		max:        max,
+		multiplier: multiplier,
+		rand:       r,
+	}
+	b.Reset()
+	return b
+}
+
+// Reset restarts delays from the initial interval.
+func (b *BackOff) Reset() {
+	b.attempt = 0
+	b.prev = b.initial
+}
+
+// NextBackOff returns the delay before the next retry.
+func (b *BackOff) NextBackOff() time.Duration {
+	t := b.exponential()
+	b.attempt++
+
+	var d time.Duration
+	switch b.jitter {
+	case JitterEqual:
+		d = t/2 + b.between(0, t-t/2)
+	case JitterFull:
+		d = b.between(0, t)
+	case JitterDecorrelated:
+		d = b.between(b.initial, 3*b.prev)
+		if d > b.max {
+			d = b.max
+		}
+	default:
+		d = t
+	}
+	b.prev = d
+	return d
+}
+
+// exponential returns the delay of the current attempt without jitter.
+func (b *BackOff) exponential() time.Duration {
+	t := float64(b.initial) * math.Pow(b.multiplier, float64(b.attempt))
+	if t >= float64(b.max) {
+		return b.max
+	}
+	return time.Duration(t)
+}
+
+// between returns a random duration in [lo, hi), or lo if the range is empty.
+func (b *BackOff) between(lo, hi time.Duration) time.Duration {
+	if hi <= lo {
+		return lo
+	}
+	return lo + time.Duration(b.rand.Int63n(int64(hi-lo)))
+}
@@ -0,0 +1,146 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package backoffutil
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	_initial = 100 * time.Millisecond
+	_max     = 5 * time.Second
+)
+
+func newTestBackOff(jitter Jitter) *BackOff {
+	return New(jitter, _initial, _max, 2, rand.New(rand.NewSource(0)))
+}
+
+// exponentialDelay returns the delay of attempt without jitter.
+func exponentialDelay(attempt int) time.Duration {
+	d := _initial
+	for i := 0; i < attempt && d < _max; i++ {
+		d *= 2
+	}
+	if d > _max {
+		d = _max
+	}
+	return d
+}
+
+func TestBackOffNone(t *testing.T) {
+	require := require.New(t)
+
+	b := newTestBackOff(JitterNone)
+	for i := 0; i < 10; i++ {
+		require.Equal(exponentialDelay(i), b.NextBackOff())
+	}
+	b.Reset()
+	require.Equal(_initial, b.NextBackOff())
+}
+
+func TestBackOffEqual(t *testing.T) {
+	require := require.New(t)
+
+	for trial := 0; trial < 100; trial++ {
+		b := newTestBackOff(JitterEqual)
+		for i := 0; i < 10; i++ {
+			t := exponentialDelay(i)
+			d := b.NextBackOff()
+			require.True(d >= t/2 && d < t, "attempt %d: %s not in [%s, %s)", i, d, t/2, t)
+		}
+	}
+}
+
+func TestBackOffFull(t *testing.T) {
+	require := require.New(t)
+
+	for trial := 0; trial < 100; trial++ {
+		b := newTestBackOff(JitterFull)
+		for i := 0; i < 10; i++ {
+			t := exponentialDelay(i)
+			d := b.NextBackOff()
+			require.True(d >= 0 && d < t, "attempt %d: %s not in [0, %s)", i, d, t)
+		}
+	}
+}
+
+func TestBackOffDecorrelated(t *testing.T) {
+	require := require.New(t)
+
+	for trial := 0; trial < 100; trial++ {
+		b := newTestBackOff(JitterDecorrelated)
+		prev := _initial
+		for i := 0; i < 20; i++ {
+			d := b.NextBackOff()
+			require.True(d >= _initial && d <= _max, "attempt %d: %s not in [%s, %s]", i, d, _initial, _max)
+			require.True(d < 3*prev || d == _initial, "attempt %d: %s exceeds 3 * %s", i, d, prev)
+			prev = d
+		}
+	}
+}
+
+func TestBackOffJitterDistribution(t *testing.T) {
+	const samples = 10000
+
+	// Delays at the max interval are uniform over the range of each strategy,
+	// so their means are the midpoints of the ranges.
+	tests := []struct {
+		jitter Jitter
+		mean   time.Duration
+	}{
+		{JitterNone, _max},
+		{JitterEqual, 3 * _max / 4},
+		{JitterFull, _max / 2},
+	}
+	for _, test := range tests {
+		t.Run(string(test.jitter), func(t *testing.T) {
+			b := newTestBackOff(test.jitter)
+			for exponentialDelay(b.attempt) < _max {
+				b.NextBackOff()
+			}
+			var sum time.Duration
+			for i := 0; i < samples; i++ {
+				sum += b.NextBackOff()
+			}
+			mean := sum / samples
+			require.InDelta(t, float64(test.mean), float64(mean), float64(_max)/20)
+		})
+	}
+}
+
+func TestBackOffDecorrelatedSpreadsDelays(t *testing.T) {
+	require := require.New(t)
+
+	// Unlike the other strategies, decorrelated delays after many attempts
+	// are not pinned to the max interval.
+	b := newTestBackOff(JitterDecorrelated)
+	var belowMax int
+	for i := 0; i < 1000; i++ {
+		if b.NextBackOff() < _max {
+			belowMax++
+		}
+	}
+	require.True(belowMax > 100, "only %d of 1000 delays below max", belowMax)
+}
+
+func TestJitterValidate(t *testing.T) {
+	for _, j := range []Jitter{"", JitterNone, JitterEqual, JitterFull, JitterDecorrelated} {
+		require.NoError(t, j.Validate())
+	}
+	require.Error(t, Jitter("random").Validate())
+}
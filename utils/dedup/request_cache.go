@@ -131,6 +131,14 @@ func (c *RequestCache) Start(id string, r Request) error {
 	return nil
 }
 
+// Pending returns true if a function is currently executing under id.
+func (c *RequestCache) Pending(id string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.pending[id]
+}
+
 func (c *RequestCache) reserve(id string) error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
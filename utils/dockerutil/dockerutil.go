@@ -14,14 +14,18 @@
 package dockerutil
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
 
 	"github.com/uber/kraken/core"
+
 	"github.com/docker/distribution"
+	"github.com/docker/distribution/manifest/ocischema"
 	"github.com/docker/distribution/manifest/schema2"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
 )
 
 // ParseManifestV2 returns a parsed v2 manifest and its digest
@@ -30,6 +34,49 @@ func ParseManifestV2(r io.Reader) (distribution.Manifest, core.Digest, error) {
 	if err != nil {
 		return nil, core.Digest{}, fmt.Errorf("read: %s", err)
 	}
+	return parseManifestV2(b)
+}
+
+// ParseManifest returns a parsed v2 or OCI image manifest and its digest. OCI
+// manifests are recognized by their media type, or by the media type of their
+// config if the manifest omits its own.
+func ParseManifest(r io.Reader) (distribution.Manifest, core.Digest, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, core.Digest{}, fmt.Errorf("read: %s", err)
+	}
+	var header struct {
+		MediaType string `json:"mediaType"`
+		Config    struct {
+			MediaType string `json:"mediaType"`
+		} `json:"config"`
+	}
+	if err := json.Unmarshal(b, &header); err != nil {
+		return nil, core.Digest{}, fmt.Errorf("unmarshal manifest: %s", err)
+	}
+	if header.MediaType == ocispec.MediaTypeImageManifest ||
+		(header.MediaType == "" && header.Config.MediaType == ocispec.MediaTypeImageConfig) {
+		return parseManifestOCI(b)
+	}
+	return parseManifestV2(b)
+}
+
+func parseManifestOCI(b []byte) (distribution.Manifest, core.Digest, error) {
+	manifest, desc, err := distribution.UnmarshalManifest(ocispec.MediaTypeImageManifest, b)
+	if err != nil {
+		return nil, core.Digest{}, fmt.Errorf("unmarshal manifest: %s", err)
+	}
+	if _, ok := manifest.(*ocischema.DeserializedManifest); !ok {
+		return nil, core.Digest{}, errors.New("expected ocischema.DeserializedManifest")
+	}
+	d, err := core.ParseSHA256Digest(string(desc.Digest))
+	if err != nil {
+		return nil, core.Digest{}, fmt.Errorf("parse digest: %s", err)
+	}
+	return manifest, d, nil
+}
+
+func parseManifestV2(b []byte) (distribution.Manifest, core.Digest, error) {
 	manifest, desc, err := distribution.UnmarshalManifest(schema2.MediaTypeManifest, b)
 	if err != nil {
 		return nil, core.Digest{}, fmt.Errorf("unmarshal manifest: %s", err)
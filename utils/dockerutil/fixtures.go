@@ -50,3 +50,35 @@ func ManifestFixture(config core.Digest, layer1 core.Digest, layer2 core.Digest)
 
 	return d, raw
 }
+
+// OCIManifestFixture creates an OCI image manifest blob for testing purposes.
+func OCIManifestFixture(config core.Digest, layer1 core.Digest, layer2 core.Digest) (core.Digest, []byte) {
+	raw := []byte(fmt.Sprintf(`{
+	   "schemaVersion": 2,
+	   "mediaType": "application/vnd.oci.image.manifest.v1+json",
+	   "config": {
+		  "mediaType": "application/vnd.oci.image.config.v1+json",
+		  "size": 2940,
+		  "digest": "%s"
+	   },
+	   "layers": [
+		  {
+			 "mediaType": "application/vnd.oci.image.layer.v1.tar+gzip",
+			 "size": 1902063,
+			 "digest": "%s"
+		  },
+		  {
+			 "mediaType": "application/vnd.oci.image.layer.v1.tar+gzip",
+			 "size": 2345077,
+			 "digest": "%s"
+		  }
+	   ]
+	}`, config, layer1, layer2))
+
+	d, err := core.NewDigester().FromBytes(raw)
+	if err != nil {
+		panic(err)
+	}
+
+	return d, raw
+}
@@ -14,6 +14,7 @@
 package handler
 
 import (
+	"encoding/json"
 	"fmt"
 	"net/http"
 
@@ -23,9 +24,18 @@ import (
 // Error defines an HTTP handler error which encapsulates status and headers
 // to be set in the HTTP response.
 type Error struct {
-	status int
-	header http.Header
-	msg    string
+	status  int
+	header  http.Header
+	msg     string
+	code    string
+	details map[string]string
+}
+
+// ErrorResponse is the JSON body of Errors which carry a machine-readable code.
+type ErrorResponse struct {
+	Code    string            `json:"code"`
+	Message string            `json:"message"`
+	Details map[string]string `json:"details,omitempty"`
 }
 
 // Errorf creates a new Error with Printf-style formatting. Defaults to 500 error.
@@ -54,6 +64,22 @@ func (e *Error) Header(k, v string) *Error {
 	return e
 }
 
+// Code sets a machine-readable code on e. Errors with a code are written as a
+// JSON ErrorResponse instead of a plain text message.
+func (e *Error) Code(code string) *Error {
+	e.code = code
+	return e
+}
+
+// Detail adds a detail to the ErrorResponse of e.
+func (e *Error) Detail(k, v string) *Error {
+	if e.details == nil {
+		e.details = make(map[string]string)
+	}
+	e.details[k] = v
+	return e
+}
+
 // GetStatus returns the error status.
 func (e *Error) GetStatus() int {
 	return e.status
@@ -75,6 +101,7 @@ func Wrap(h ErrHandler) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var status int
 		var errMsg string
+		var body []byte
 		if err := h(w, r); err != nil {
 			switch e := err.(type) {
 			case *Error:
@@ -85,12 +112,19 @@ func Wrap(h ErrHandler) http.HandlerFunc {
 				}
 				status = e.status
 				errMsg = e.msg
+				if e.code != "" {
+					w.Header().Set("Content-Type", "application/json")
+					body, _ = json.Marshal(ErrorResponse{e.code, e.msg, e.details})
+				}
 			default:
 				status = http.StatusInternalServerError
 				errMsg = e.Error()
 			}
+			if body == nil {
+				body = []byte(errMsg)
+			}
 			w.WriteHeader(status)
-			w.Write([]byte(errMsg))
+			w.Write(body)
 		} else {
 			status = http.StatusOK
 		}
@@ -3,6 +3,8 @@ package httputil
 import (
 	"time"
 
+	"github.com/uber/kraken/utils/backoffutil"
+
 	"github.com/cenkalti/backoff"
 )
 
@@ -14,6 +16,10 @@ type ExponentialBackOffConfig struct {
 	Multiplier          float64       `yaml:"multiplier"`
 	MaxInterval         time.Duration `yaml:"max_interval"`
 	MaxRetries          uint64        `yaml:"max_retries"`
+
+	// Jitter selects how backoffs are randomized. If unset, backoffs are
+	// randomized by RandomizationFactor either way.
+	Jitter backoffutil.Jitter `yaml:"jitter"`
 }
 
 func (c *ExponentialBackOffConfig) applyDefaults() {
@@ -38,6 +44,10 @@ func (c *ExponentialBackOffConfig) applyDefaults() {
 func (c ExponentialBackOffConfig) Build() backoff.BackOff {
 	if c.Enabled {
 		c.applyDefaults()
+		if c.Jitter != "" {
+			b := backoffutil.New(c.Jitter, c.InitialInterval, c.MaxInterval, c.Multiplier, nil)
+			return backoff.WithMaxRetries(b, c.MaxRetries)
+		}
 		b := &backoff.ExponentialBackOff{
 			InitialInterval:     c.InitialInterval,
 			RandomizationFactor: c.RandomizationFactor,
@@ -0,0 +1,190 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package httputil
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/andres-erbsen/clock"
+)
+
+// ResponseCacheConfig defines client-side caching of responses, which are
+// revalidated against the server with their ETags.
+type ResponseCacheConfig struct {
+	Enabled bool `yaml:"enabled"`
+
+	// MaxEntries bounds the number of cached responses. The least recently used
+	// responses are evicted first.
+	MaxEntries int `yaml:"max_entries"`
+
+	// TTL is how long a cached response may be revalidated. Expired responses
+	// are fetched in full again.
+	TTL time.Duration `yaml:"ttl"`
+}
+
+func (c ResponseCacheConfig) applyDefaults() ResponseCacheConfig {
+	if c.MaxEntries == 0 {
+		c.MaxEntries = 1000
+	}
+	if c.TTL == 0 {
+		c.TTL = 5 * time.Minute
+	}
+	return c
+}
+
+type cachedResponse struct {
+	key     string
+	etag    string
+	body    []byte
+	expires time.Time
+}
+
+// ResponseCache caches response bodies with their ETags, such that repeated
+// requests send If-None-Match and are served from the cache on 304 Not
+// Modified. Safe for concurrent use, and intended to be shared by all clients
+// of a process.
+type ResponseCache struct {
+	config ResponseCacheConfig
+	clk    clock.Clock
+
+	mu      sync.Mutex
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+// NewResponseCache creates a new ResponseCache.
+func NewResponseCache(config ResponseCacheConfig, clk clock.Clock) *ResponseCache {
+	return &ResponseCache{
+		config:  config.applyDefaults(),
+		clk:     clk,
+		order:   list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+// Get returns the body of the response to the request sent by send, which must
+// pass options through to Send. If a response cached under key is still valid,
+// it is revalidated and served from the cache on 304 Not Modified.
+func (c *ResponseCache) Get(
+	key string, send func(options ...SendOption) (*http.Response, error)) ([]byte, error) {
+
+	cached := c.lookup(key)
+	var options []SendOption
+	if cached != nil {
+		options = append(options,
+			SendAcceptedCodes(http.StatusOK, http.StatusNotModified),
+			SendRequestHooks(func(req *http.Request) error {
+				req.Header.Set("If-None-Match", cached.etag)
+				return nil
+			}))
+	}
+	resp, err := send(options...)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotModified {
+		c.touch(cached)
+		return cached.body, nil
+	}
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read body: %s", err)
+	}
+	if etag := resp.Header.Get("ETag"); etag != "" {
+		c.add(&cachedResponse{key: key, etag: etag, body: b})
+	} else if cached != nil {
+		c.remove(key)
+	}
+	return b, nil
+}
+
+func (c *ResponseCache) lookup(key string) *cachedResponse {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[key]
+	if !ok {
+		return nil
+	}
+	r := e.Value.(*cachedResponse)
+	if !c.clk.Now().Before(r.expires) {
+		c.order.Remove(e)
+		delete(c.entries, key)
+		return nil
+	}
+	c.order.MoveToFront(e)
+	return r
+}
+
+// touch extends the expiry of r, since the server just revalidated it.
+func (c *ResponseCache) touch(r *cachedResponse) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	r.expires = c.clk.Now().Add(c.config.TTL)
+}
+
+func (c *ResponseCache) add(r *cachedResponse) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	r.expires = c.clk.Now().Add(c.config.TTL)
+	if e, ok := c.entries[r.key]; ok {
+		e.Value = r
+		c.order.MoveToFront(e)
+		return
+	}
+	c.entries[r.key] = c.order.PushFront(r)
+	if c.order.Len() > c.config.MaxEntries {
+		e := c.order.Back()
+		c.order.Remove(e)
+		delete(c.entries, e.Value.(*cachedResponse).key)
+	}
+}
+
+func (c *ResponseCache) remove(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e, ok := c.entries[key]; ok {
+		c.order.Remove(e)
+		delete(c.entries, key)
+	}
+}
+
+// WriteWithETag writes b with an ETag derived from its content, or responds
+// with 304 Not Modified if the If-None-Match header of r already matches it.
+func WriteWithETag(w http.ResponseWriter, r *http.Request, b []byte) error {
+	sum := sha256.Sum256(b)
+	etag := strconv.Quote(hex.EncodeToString(sum[:16]))
+	w.Header().Set("ETag", etag)
+	for _, v := range strings.Split(r.Header.Get("If-None-Match"), ",") {
+		if strings.TrimPrefix(strings.TrimSpace(v), "W/") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return nil
+		}
+	}
+	_, err := w.Write(b)
+	return err
+}
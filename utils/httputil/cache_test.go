@@ -0,0 +1,121 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package httputil
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/atomic"
+)
+
+// etagServer serves body with its ETag and records the response statuses.
+type etagServer struct {
+	body   *atomic.String
+	full   *atomic.Int64
+	cached *atomic.Int64
+}
+
+func newETagServer(body string) (*etagServer, *httptest.Server) {
+	s := &etagServer{atomic.NewString(body), atomic.NewInt64(0), atomic.NewInt64(0)}
+	return s, httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := httptest.NewRecorder()
+		if err := WriteWithETag(rec, r, []byte(s.body.Load())); err != nil {
+			panic(err)
+		}
+		if rec.Code == http.StatusNotModified {
+			s.cached.Inc()
+		} else {
+			s.full.Inc()
+		}
+		for k, v := range rec.Header() {
+			w.Header()[k] = v
+		}
+		w.WriteHeader(rec.Code)
+		w.Write(rec.Body.Bytes())
+	}))
+}
+
+func TestResponseCacheRevalidates(t *testing.T) {
+	require := require.New(t)
+
+	s, server := newETagServer("some value")
+	defer server.Close()
+
+	cache := NewResponseCache(ResponseCacheConfig{}, clock.NewMock())
+	get := func(options ...SendOption) (*http.Response, error) {
+		return Get(server.URL, options...)
+	}
+
+	for i := 0; i < 3; i++ {
+		b, err := cache.Get(server.URL, get)
+		require.NoError(err)
+		require.Equal("some value", string(b))
+	}
+	require.Equal(int64(1), s.full.Load())
+	require.Equal(int64(2), s.cached.Load())
+
+	s.body.Store("other value")
+	b, err := cache.Get(server.URL, get)
+	require.NoError(err)
+	require.Equal("other value", string(b))
+	require.Equal(int64(2), s.full.Load())
+}
+
+func TestResponseCacheExpires(t *testing.T) {
+	require := require.New(t)
+
+	s, server := newETagServer("some value")
+	defer server.Close()
+
+	clk := clock.NewMock()
+	cache := NewResponseCache(ResponseCacheConfig{TTL: time.Minute}, clk)
+	get := func(options ...SendOption) (*http.Response, error) {
+		return Get(server.URL, options...)
+	}
+
+	_, err := cache.Get(server.URL, get)
+	require.NoError(err)
+
+	clk.Add(time.Minute)
+
+	b, err := cache.Get(server.URL, get)
+	require.NoError(err)
+	require.Equal("some value", string(b))
+	require.Equal(int64(2), s.full.Load())
+	require.Equal(int64(0), s.cached.Load())
+}
+
+func TestResponseCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	require := require.New(t)
+
+	s, server := newETagServer("some value")
+	defer server.Close()
+
+	cache := NewResponseCache(ResponseCacheConfig{MaxEntries: 1}, clock.NewMock())
+	get := func(options ...SendOption) (*http.Response, error) {
+		return Get(server.URL, options...)
+	}
+
+	for _, key := range []string{"a", "b", "a"} {
+		_, err := cache.Get(key, get)
+		require.NoError(err)
+	}
+	require.Equal(int64(3), s.full.Load())
+	require.Equal(int64(0), s.cached.Load())
+}
@@ -22,6 +22,7 @@ import (
 	"io/ioutil"
 	"net/http"
 	"net/url"
+	"strconv"
 	"time"
 
 	"github.com/cenkalti/backoff"
@@ -38,6 +39,10 @@ var retryableCodes = map[int]struct{}{
 	http.StatusGatewayTimeout:     {},
 }
 
+// DeadlineHeader carries the remaining time budget of a request, in
+// milliseconds, such that servers may abandon work the client gave up on.
+const DeadlineHeader = "X-Request-Deadline"
+
 // RoundTripper is an alias of the http.RoundTripper for mocking purposes.
 type RoundTripper = http.RoundTripper
 
@@ -139,9 +144,13 @@ type sendOptions struct {
 	acceptedCodes map[int]bool
 	headers       map[string]string
 	redirect      func(req *http.Request, via []*http.Request) error
-	retry         retryOptions
+	retry         Interceptor
+	interceptors  []Interceptor
 	transport     http.RoundTripper
 	ctx           context.Context
+	sendDeadline  bool
+	requestHooks  []RequestHook
+	responseHooks []ResponseHook
 
 	// This is not a valid http option. It provides a way to override
 	// parts of the url. For example, url.Scheme can be changed from
@@ -205,7 +214,9 @@ type retryOptions struct {
 // RetryOption allows overriding defaults for the SendRetry option.
 type RetryOption func(*retryOptions)
 
-// RetryBackoff adds exponential backoff between retries.
+// RetryBackoff adds exponential backoff between retries. Since b is reset and
+// advanced by every request retried, interceptors configured with it must not
+// be shared by concurrent requests.
 func RetryBackoff(b backoff.BackOff) RetryOption {
 	return func(o *retryOptions) { o.backoff = b }
 }
@@ -222,18 +233,60 @@ func RetryCodes(codes ...int) RetryOption {
 	}
 }
 
-// SendRetry will we retry the request on network / 5XX errors.
+// SendRetry will we retry the request on network / 5XX errors. The retry runs
+// as the innermost interceptor, such that other interceptors run once per
+// request rather than once per attempt.
 func SendRetry(options ...RetryOption) SendOption {
-	retry := retryOptions{
-		backoff: backoff.WithMaxRetries(
-			backoff.NewConstantBackOff(250*time.Millisecond),
-			2),
-		extraCodes: make(map[int]bool),
-	}
+	retry := RetryInterceptor(options...)
+	return func(o *sendOptions) { o.retry = retry }
+}
+
+// RetryInterceptor returns an Interceptor which retries requests on network /
+// 5XX errors, and on errors of the codes added by RetryCodes. Unless configured
+// with RetryBackoff, each request is retried twice, 250ms apart.
+func RetryInterceptor(options ...RetryOption) Interceptor {
+	var retry retryOptions
+	retry.extraCodes = make(map[int]bool)
 	for _, o := range options {
 		o(&retry)
 	}
-	return func(o *sendOptions) { o.retry = retry }
+	return func(req *http.Request, next RoundTrip) (*http.Response, error) {
+		b := retry.backoff
+		if b == nil {
+			b = backoff.WithMaxRetries(backoff.NewConstantBackOff(250*time.Millisecond), 2)
+		}
+		b.Reset()
+		for {
+			resp, err := next(req)
+			if err == nil || !retry.retryable(err) {
+				return resp, err
+			}
+			d := b.NextBackOff()
+			if d == backoff.Stop {
+				return nil, err // Backoff timed out.
+			}
+			select {
+			case <-time.After(d):
+			case <-req.Context().Done():
+				return nil, err
+			}
+			if req.GetBody != nil {
+				body, berr := req.GetBody()
+				if berr != nil {
+					return nil, fmt.Errorf("rewind body: %s", berr)
+				}
+				req.Body = body
+			}
+		}
+	}
+}
+
+func (o retryOptions) retryable(err error) bool {
+	if IsNetworkError(err) {
+		return true
+	}
+	serr, ok := err.(StatusError)
+	return ok && (isRetryable(serr.Status) || o.extraCodes[serr.Status])
 }
 
 // DisableHTTPFallback disables http fallback when https request fails.
@@ -272,6 +325,48 @@ func SendContext(ctx context.Context) SendOption {
 	return func(o *sendOptions) { o.ctx = ctx }
 }
 
+// SendDeadline propagates the remaining time budget of the request, derived
+// from the timeout and context deadline, to the server via DeadlineHeader.
+func SendDeadline() SendOption {
+	return func(o *sendOptions) { o.sendDeadline = true }
+}
+
+// RequestHook is run against each request before it is sent. Returning an error
+// aborts the request.
+type RequestHook func(req *http.Request) error
+
+// ResponseHook is run once a request completes, with either the accepted
+// response or the error Send returns.
+type ResponseHook func(resp *http.Response, err error)
+
+// SendRequestHooks adds hooks which are run, in order, against the request
+// before it is sent.
+func SendRequestHooks(hooks ...RequestHook) SendOption {
+	return func(o *sendOptions) { o.requestHooks = append(o.requestHooks, hooks...) }
+}
+
+// SendResponseHooks adds hooks which are run, in order, once the request
+// completes.
+func SendResponseHooks(hooks ...ResponseHook) SendOption {
+	return func(o *sendOptions) { o.responseHooks = append(o.responseHooks, hooks...) }
+}
+
+// RoundTrip sends a single request, returning either an accepted response or
+// the error Send would return.
+type RoundTrip func(req *http.Request) (*http.Response, error)
+
+// Interceptor wraps the sending of each request. It may mutate req before
+// calling next, call next several times, or inspect the result of next.
+// Cross-cutting concerns such as auth, tracing and retries are expressed as
+// interceptors.
+type Interceptor func(req *http.Request, next RoundTrip) (*http.Response, error)
+
+// SendInterceptors adds interceptors which wrap the request, in order, such
+// that the first interceptor is the outermost.
+func SendInterceptors(interceptors ...Interceptor) SendOption {
+	return func(o *sendOptions) { o.interceptors = append(o.interceptors, interceptors...) }
+}
+
 // Send sends an HTTP request. May return NetworkError or StatusError (see above).
 func Send(method, rawurl string, options ...SendOption) (*http.Response, error) {
 	u, err := url.Parse(rawurl)
@@ -283,7 +378,6 @@ func Send(method, rawurl string, options ...SendOption) (*http.Response, error)
 		timeout:              60 * time.Second,
 		acceptedCodes:        map[int]bool{http.StatusOK: true},
 		headers:              map[string]string{},
-		retry:                retryOptions{backoff: &backoff.StopBackOff{}},
 		transport:            nil, // Use HTTP default.
 		ctx:                  context.Background(),
 		url:                  u,
@@ -304,35 +398,50 @@ func Send(method, rawurl string, options ...SendOption) (*http.Response, error)
 		Transport:     opts.transport,
 	}
 
-	var resp *http.Response
-	for {
-		resp, err = client.Do(req)
-		// Retry without tls. During migration there would be a time when the
-		// component receiving the tls request does not serve https response.
-		// TODO (@evelynl): disable retry after tls migration.
-		if err != nil && req.URL.Scheme == "https" && !opts.httpFallbackDisabled {
-			originalErr := err
-			resp, err = fallbackToHTTP(client, method, opts)
-			if err != nil {
-				// Sometimes the request fails for a reason unrelated to https.
-				// To keep this reason visible, we always include the original
-				// error.
-				err = fmt.Errorf(
-					"failed to fallback https to http, original https error: %s,\n"+
-						"fallback http error: %s", originalErr, err)
-			}
-		}
-		if err != nil ||
-			(isRetryable(resp.StatusCode) && !opts.acceptedCodes[resp.StatusCode]) ||
-			(opts.retry.extraCodes[resp.StatusCode]) {
-			d := opts.retry.backoff.NextBackOff()
-			if d == backoff.Stop {
-				break // Backoff timed out.
-			}
-			time.Sleep(d)
-			continue
+	send := func(req *http.Request) (*http.Response, error) {
+		return roundTrip(client, req, opts)
+	}
+	interceptors := opts.interceptors
+	if opts.retry != nil {
+		interceptors = append(interceptors[:len(interceptors):len(interceptors)], opts.retry)
+	}
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		send = intercept(interceptors[i], send)
+	}
+	resp, err := send(req)
+	for _, hook := range opts.responseHooks {
+		hook(resp, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func intercept(interceptor Interceptor, next RoundTrip) RoundTrip {
+	return func(req *http.Request) (*http.Response, error) {
+		return interceptor(req, next)
+	}
+}
+
+// roundTrip sends a single attempt of req, converting failures into
+// NetworkError and unaccepted responses into StatusError.
+func roundTrip(client *http.Client, req *http.Request, opts *sendOptions) (*http.Response, error) {
+	resp, err := client.Do(req)
+	// Retry without tls. During migration there would be a time when the
+	// component receiving the tls request does not serve https response.
+	// TODO (@evelynl): disable retry after tls migration.
+	if err != nil && req.URL.Scheme == "https" && !opts.httpFallbackDisabled {
+		originalErr := err
+		resp, err = fallbackToHTTP(client, req)
+		if err != nil {
+			// Sometimes the request fails for a reason unrelated to https.
+			// To keep this reason visible, we always include the original
+			// error.
+			err = fmt.Errorf(
+				"failed to fallback https to http, original https error: %s,\n"+
+					"fallback http error: %s", originalErr, err)
 		}
-		break
 	}
 	if err != nil {
 		return nil, NetworkError{err}
@@ -446,18 +555,48 @@ func newRequest(method string, opts *sendOptions) (*http.Request, error) {
 	for key, val := range opts.headers {
 		req.Header.Set(key, val)
 	}
+	if opts.sendDeadline {
+		if budget, ok := remainingBudget(opts); ok {
+			req.Header.Set(DeadlineHeader, strconv.FormatInt(int64(budget/time.Millisecond), 10))
+		}
+	}
+	for _, hook := range opts.requestHooks {
+		if err := hook(req); err != nil {
+			return nil, fmt.Errorf("request hook: %s", err)
+		}
+	}
 	return req, nil
 }
 
-func fallbackToHTTP(
-	client *http.Client, method string, opts *sendOptions) (*http.Response, error) {
-
-	req, err := newRequest(method, opts)
-	if err != nil {
-		return nil, err
+// remainingBudget returns the lesser of the timeout and the time left until
+// the context deadline. Returns false if neither is set.
+func remainingBudget(opts *sendOptions) (time.Duration, bool) {
+	budget := opts.timeout
+	deadline, ok := opts.ctx.Deadline()
+	if !ok {
+		return budget, budget > 0
 	}
-	req.URL.Scheme = "http"
+	if left := time.Until(deadline); budget <= 0 || left < budget {
+		budget = left
+	}
+	if budget < 0 {
+		budget = 0
+	}
+	return budget, true
+}
 
+// fallbackToHTTP resends req over http, keeping the changes interceptors made
+// to it.
+func fallbackToHTTP(client *http.Client, req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.URL.Scheme = "http"
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, fmt.Errorf("rewind body: %s", err)
+		}
+		req.Body = body
+	}
 	return client.Do(req)
 }
 
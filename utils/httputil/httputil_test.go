@@ -19,6 +19,7 @@ import (
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
 	"testing"
 	"time"
 
@@ -66,6 +67,117 @@ func TestSendOptions(t *testing.T) {
 	require.NoError(err)
 }
 
+func TestSendDeadline(t *testing.T) {
+	require := require.New(t)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	transport := mockhttputil.NewMockRoundTripper(ctrl)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	transport.EXPECT().RoundTrip(gomock.Any()).DoAndReturn(
+		func(req *http.Request) (*http.Response, error) {
+			budget, err := strconv.Atoi(req.Header.Get(DeadlineHeader))
+			require.NoError(err)
+			require.True(budget > 1000 && budget <= 2000)
+			return newResponse(200), nil
+		})
+
+	_, err := Get(
+		_testURL,
+		SendTransport(transport),
+		SendTimeout(30*time.Second),
+		SendContext(ctx),
+		SendDeadline())
+	require.NoError(err)
+}
+
+func TestSendHooks(t *testing.T) {
+	require := require.New(t)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	transport := mockhttputil.NewMockRoundTripper(ctrl)
+
+	transport.EXPECT().RoundTrip(gomock.Any()).DoAndReturn(
+		func(req *http.Request) (*http.Response, error) {
+			require.Equal("bar", req.Header.Get("X-Foo"))
+			return newResponse(500), nil
+		})
+
+	var statuses []int
+	_, err := Get(
+		_testURL,
+		SendTransport(transport),
+		SendRequestHooks(func(req *http.Request) error {
+			req.Header.Set("X-Foo", "bar")
+			return nil
+		}),
+		SendResponseHooks(func(resp *http.Response, err error) {
+			require.Nil(resp)
+			statuses = append(statuses, err.(StatusError).Status)
+		}))
+	require.True(IsStatus(err, 500))
+	require.Equal([]int{500}, statuses)
+}
+
+func TestSendRequestHookError(t *testing.T) {
+	require := require.New(t)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	transport := mockhttputil.NewMockRoundTripper(ctrl)
+
+	_, err := Get(
+		_testURL,
+		SendTransport(transport),
+		SendRequestHooks(func(req *http.Request) error {
+			return errors.New("some error")
+		}))
+	require.Error(err)
+}
+
+func TestSendInterceptorsWrapRetries(t *testing.T) {
+	require := require.New(t)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	transport := mockhttputil.NewMockRoundTripper(ctrl)
+
+	for _, status := range []int{503, 200} {
+		status := status
+		transport.EXPECT().RoundTrip(gomock.Any()).DoAndReturn(
+			func(req *http.Request) (*http.Response, error) {
+				require.Equal("bar", req.Header.Get("X-Foo"))
+				return newResponse(status), nil
+			})
+	}
+
+	var calls []string
+	_, err := Get(
+		_testURL,
+		SendTransport(transport),
+		SendRetry(RetryBackoff(backoff.WithMaxRetries(backoff.NewConstantBackOff(0), 1))),
+		SendInterceptors(
+			func(req *http.Request, next RoundTrip) (*http.Response, error) {
+				calls = append(calls, "outer")
+				return next(req)
+			},
+			func(req *http.Request, next RoundTrip) (*http.Response, error) {
+				calls = append(calls, "inner")
+				req.Header.Set("X-Foo", "bar")
+				return next(req)
+			}))
+	require.NoError(err)
+	require.Equal([]string{"outer", "inner"}, calls)
+}
+
 func TestSendRetry(t *testing.T) {
 	require := require.New(t)
 
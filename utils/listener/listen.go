@@ -14,10 +14,17 @@
 package listener
 
 import (
+	"context"
+	"fmt"
 	"net"
 	"net/http"
+	"time"
 )
 
+// _shutdownTimeout bounds how long ServeContext waits for in-flight requests
+// to complete once ctx is done.
+const _shutdownTimeout = 30 * time.Second
+
 // Serve serves h on a listener configured by config. Useful for easily
 // swapping tcp / unix servers.
 func Serve(config Config, h http.Handler) error {
@@ -27,3 +34,27 @@ func Serve(config Config, h http.Handler) error {
 	}
 	return http.Serve(l, h)
 }
+
+// ServeContext is like Serve, but gracefully shuts down the server once ctx is
+// done, waiting for in-flight requests to complete. Returns nil once the server
+// is shut down.
+func ServeContext(ctx context.Context, config Config, h http.Handler) error {
+	l, err := net.Listen(config.Net, config.Addr)
+	if err != nil {
+		return err
+	}
+	srv := &http.Server{Handler: h}
+	errc := make(chan error, 1)
+	go func() { errc <- srv.Serve(l) }()
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+	}
+	sctx, cancel := context.WithTimeout(context.Background(), _shutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(sctx); err != nil {
+		return fmt.Errorf("shutdown: %s", err)
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package syncutil
+
+import (
+	"github.com/uber-go/tally"
+	"go.uber.org/atomic"
+)
+
+// FanoutConfig bounds the goroutines spawned by operations which fan out in
+// proportion to their input, e.g. batch requests and replication to peers.
+type FanoutConfig struct {
+	Enabled bool `yaml:"enabled"`
+
+	// MaxWorkers is the number of goroutines executing fan-out tasks, shared
+	// by all operations.
+	MaxWorkers int `yaml:"max_workers"`
+
+	// MaxQueued bounds the tasks waiting for a worker. Once the queue is full,
+	// operations execute their tasks on their own goroutine instead.
+	MaxQueued int `yaml:"max_queued"`
+}
+
+func (c FanoutConfig) applyDefaults() FanoutConfig {
+	if c.MaxWorkers == 0 {
+		c.MaxWorkers = 64
+	}
+	if c.MaxQueued == 0 {
+		c.MaxQueued = 1024
+	}
+	return c
+}
+
+// FanoutPool executes fan-out tasks on a fixed number of workers, such that the
+// goroutines of fan-out operations are bounded regardless of their input size.
+// A nil FanoutPool spawns a goroutine per task.
+type FanoutPool struct {
+	tasks  chan func()
+	active *atomic.Int64
+	stats  tally.Scope
+}
+
+// NewFanoutPool creates and starts a new FanoutPool. Returns nil if config is
+// not enabled.
+func NewFanoutPool(config FanoutConfig, stats tally.Scope) *FanoutPool {
+	if !config.Enabled {
+		return nil
+	}
+	config = config.applyDefaults()
+	p := &FanoutPool{
+		tasks:  make(chan func(), config.MaxQueued),
+		active: atomic.NewInt64(0),
+		stats:  stats,
+	}
+	for i := 0; i < config.MaxWorkers; i++ {
+		go p.work()
+	}
+	return p
+}
+
+func (p *FanoutPool) work() {
+	for task := range p.tasks {
+		p.stats.Gauge("fanout_active").Update(float64(p.active.Inc()))
+		task()
+		p.stats.Gauge("fanout_active").Update(float64(p.active.Dec()))
+	}
+}
+
+// Run calls f for every i in [0, n) concurrently and waits for all calls to
+// return. While waiting, the caller executes queued tasks itself, such that
+// nested fan-outs make progress even if every worker is waiting on one.
+func (p *FanoutPool) Run(n int, f func(i int)) {
+	if n == 0 {
+		return
+	}
+	remaining := atomic.NewInt64(int64(n))
+	done := make(chan struct{})
+	task := func(i int) func() {
+		return func() {
+			defer func() {
+				if remaining.Dec() == 0 {
+					close(done)
+				}
+			}()
+			f(i)
+		}
+	}
+	if p == nil {
+		for i := 0; i < n; i++ {
+			go task(i)()
+		}
+		<-done
+		return
+	}
+	for i := 0; i < n; i++ {
+		select {
+		case p.tasks <- task(i):
+		default:
+			p.stats.Counter("fanout_queue_full").Inc(1)
+			task(i)()
+		}
+	}
+	p.stats.Gauge("fanout_queued").Update(float64(len(p.tasks)))
+	for {
+		select {
+		case <-done:
+			return
+		case t := <-p.tasks:
+			t()
+		}
+	}
+}
@@ -0,0 +1,120 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package syncutil
+
+import (
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/uber-go/tally"
+	"go.uber.org/atomic"
+)
+
+func TestFanoutPoolBoundsGoroutinesOfLargeBatch(t *testing.T) {
+	require := require.New(t)
+
+	const workers = 4
+
+	p := NewFanoutPool(FanoutConfig{
+		Enabled:    true,
+		MaxWorkers: workers,
+		MaxQueued:  16,
+	}, tally.NoopScope)
+
+	base := runtime.NumGoroutine()
+
+	var running, maxRunning, maxGoroutines, calls atomic.Int64
+	p.Run(1000, func(i int) {
+		n := running.Inc()
+		defer running.Dec()
+		for {
+			m := maxRunning.Load()
+			if n <= m || maxRunning.CAS(m, n) {
+				break
+			}
+		}
+		if g := int64(runtime.NumGoroutine()); g > maxGoroutines.Load() {
+			maxGoroutines.Store(g)
+		}
+		calls.Inc()
+		time.Sleep(100 * time.Microsecond)
+	})
+
+	require.Equal(int64(1000), calls.Load())
+	// Tasks execute on the workers and the calling goroutine only.
+	require.True(maxRunning.Load() <= workers+1, "%d tasks ran concurrently", maxRunning.Load())
+	require.True(
+		maxGoroutines.Load() <= int64(base), "%d goroutines, started with %d", maxGoroutines.Load(), base)
+}
+
+func TestFanoutPoolNestedRunDoesNotDeadlock(t *testing.T) {
+	p := NewFanoutPool(FanoutConfig{
+		Enabled:    true,
+		MaxWorkers: 2,
+		MaxQueued:  4,
+	}, tally.NoopScope)
+
+	var calls atomic.Int64
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		p.Run(10, func(int) {
+			p.Run(10, func(int) { calls.Inc() })
+		})
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("nested fan-out deadlocked")
+	}
+	require.Equal(t, int64(100), calls.Load())
+}
+
+func TestFanoutPoolReportsActiveWorkers(t *testing.T) {
+	require := require.New(t)
+
+	stats := tally.NewTestScope("", nil)
+	p := NewFanoutPool(FanoutConfig{
+		Enabled:    true,
+		MaxWorkers: 2,
+	}, stats)
+
+	release := make(chan struct{})
+	started := make(chan struct{}, 2)
+	go p.Run(2, func(int) {
+		started <- struct{}{}
+		<-release
+	})
+	<-started
+	<-started
+
+	// Either both tasks run on workers, or one runs on the calling goroutine.
+	active := stats.Snapshot().Gauges()["fanout_active+"].Value()
+	require.True(active >= 1 && active <= 2, "%v active workers", active)
+
+	close(release)
+}
+
+func TestNilFanoutPoolRunsAllTasks(t *testing.T) {
+	p := NewFanoutPool(FanoutConfig{}, tally.NoopScope)
+	require.Nil(t, p)
+
+	var calls atomic.Int64
+	p.Run(100, func(int) { calls.Inc() })
+	require.Equal(t, int64(100), calls.Load())
+
+	p.Run(0, func(int) { t.Fatal("unexpected call") })
+}